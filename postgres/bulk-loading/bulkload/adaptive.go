@@ -0,0 +1,217 @@
+package bulkload
+
+// ============================================================================
+// ADAPTIVE PARALLELISM (-adaptive)
+// ============================================================================
+//
+// The best worker count depends on the server (cores, disks, WAL, other
+// load), not on the loader. With -adaptive the loader starts
+// -max-goroutines workers but lets only a controlled number COPY at once,
+// starting from config.Goroutines. Every -adaptive-interval a controller
+// compares rows/sec with the previous interval and hill-climbs:
+//   - throughput up by more than 5%: keep moving in the same direction
+//   - throughput down by more than 5%: reverse; after two reversals the
+//     step is halved, so the limit settles on the fastest stable value
+//   - roughly flat: hold
+// Independently it steps down when the database shows stress: more than
+// half of the loader's active backends waiting on IO/LWLock, the server
+// near max_connections, or a throttle (-max-replica-lag, -max-wal-rate)
+// backing the load off.
+//
+// Workers take a slot per batch, so generated loads COPY in BatchSize
+// batches while adaptive mode is on.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// workerLimiter is a semaphore whose size the controller changes.
+type workerLimiter struct {
+	mu     sync.Mutex
+	active int
+	limit  int
+
+	copied  atomic.Int64 // Rows COPYed through the limiter
+	history []string     // Limit changes, for the report
+	peak    float64      // Best observed rows/sec
+}
+
+// workers is set in adaptive mode.
+var workers *workerLimiter
+
+func (w *workerLimiter) acquire(ctx context.Context) error {
+	for {
+		w.mu.Lock()
+		if w.active < w.limit {
+			w.active++
+			w.mu.Unlock()
+			return nil
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *workerLimiter) release(rows int64) {
+	w.copied.Add(rows)
+	w.mu.Lock()
+	w.active--
+	w.mu.Unlock()
+}
+
+func (w *workerLimiter) setLimit(n int, reason string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n == w.limit {
+		return
+	}
+	fmt.Printf("      🎛️  Adaptive: %d → %d workers (%s)\n", w.limit, n, reason)
+	w.history = append(w.history, fmt.Sprintf("%d→%d", w.limit, n))
+	w.limit = n
+}
+
+func (w *workerLimiter) currentLimit() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.limit
+}
+
+// initAdaptive sizes the worker pool for adaptive mode; call it before the
+// connection pool is created. config.Goroutines becomes the number of
+// workers started, and the initial limit is the configured value.
+func initAdaptive() {
+	if !config.Adaptive {
+		return
+	}
+	start := min(config.Goroutines, config.MaxGoroutines)
+	workers = &workerLimiter{limit: start}
+	config.Goroutines = config.MaxGoroutines
+}
+
+// startAdaptive runs the controller until the returned func is called.
+func startAdaptive(ctx context.Context, pool *pgxpool.Pool) func() {
+	if workers == nil {
+		return func() {}
+	}
+	fmt.Printf("🎛️  Adaptive parallelism: starting at %d of %d workers, adjusting every %v\n",
+		workers.currentLimit(), config.MaxGoroutines, config.AdaptiveInterval)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runAdaptive(ctx, pool)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// dbLoad is the database side of an adaptive sample.
+type dbLoad struct {
+	active         int // Active client backends
+	loaderActive   int // Active backends of this loader
+	loaderWaiting  int // ... of those waiting on IO or LWLock
+	maxConnections int
+}
+
+func sampleDBLoad(ctx context.Context, pool *pgxpool.Pool) (dbLoad, error) {
+	var l dbLoad
+	err := pool.QueryRow(ctx, `
+		SELECT count(*) FILTER (WHERE state = 'active'),
+		       count(*) FILTER (WHERE state = 'active' AND application_name = 'bulk_loader'),
+		       count(*) FILTER (WHERE state = 'active' AND application_name = 'bulk_loader'
+		                          AND wait_event_type IN ('IO', 'LWLock')),
+		       current_setting('max_connections')::int
+		FROM pg_stat_activity
+		WHERE backend_type = 'client backend'
+	`).Scan(&l.active, &l.loaderActive, &l.loaderWaiting, &l.maxConnections)
+	return l, err
+}
+
+func runAdaptive(ctx context.Context, pool *pgxpool.Pool) {
+	ticker := time.NewTicker(config.AdaptiveInterval)
+	defer ticker.Stop()
+
+	step := max(1, workers.currentLimit()/4)
+	direction := 1
+	reversals := 0
+	var prevRate float64
+	lastCopied := workers.copied.Load()
+	lastWaited := throttle.waited.Load()
+	last := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		copied, waited := workers.copied.Load(), throttle.waited.Load()
+		rate := float64(copied-lastCopied) / time.Since(last).Seconds()
+		backedOff := waited > lastWaited
+		lastCopied, lastWaited, last = copied, waited, time.Now()
+		workers.peak = max(workers.peak, rate)
+
+		load, err := sampleDBLoad(ctx, pool)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("      ⚠️  Adaptive: load sample failed: %v\n", err)
+			}
+			continue
+		}
+
+		limit := workers.currentLimit()
+		next, reason := limit, ""
+		switch {
+		case backedOff:
+			next, reason = limit-step, "throttled"
+			direction = -1
+		case load.loaderActive > 0 && load.loaderWaiting*2 > load.loaderActive:
+			next, reason = limit-step, fmt.Sprintf("%d/%d backends waiting on IO/locks", load.loaderWaiting, load.loaderActive)
+			direction = -1
+		case load.active*10 > load.maxConnections*9:
+			next, reason = limit-step, fmt.Sprintf("%d/%d connections active", load.active, load.maxConnections)
+			direction = -1
+		case prevRate == 0 || rate > prevRate*1.05:
+			next, reason = limit+direction*step, fmt.Sprintf("%.0f rows/sec", rate)
+		case rate < prevRate*0.95:
+			direction = -direction
+			if reversals++; reversals >= 2 {
+				step = max(1, step/2)
+				reversals = 0
+			}
+			next, reason = limit+direction*step, fmt.Sprintf("%.0f rows/sec, down from %.0f", rate, prevRate)
+		}
+		prevRate = rate
+
+		next = max(1, min(next, config.MaxGoroutines))
+		if next != limit {
+			workers.setLimit(next, reason)
+		}
+	}
+}
+
+// printAdaptiveReport adds the controller's outcome to the load report.
+func printAdaptiveReport() {
+	if workers == nil {
+		return
+	}
+	fmt.Printf("Adaptive Workers:     settled on %d (peak %.0f rows/sec)\n", workers.currentLimit(), workers.peak)
+	if len(workers.history) > 0 {
+		fmt.Printf("                      changes: %v\n", workers.history)
+	}
+}
@@ -0,0 +1,133 @@
+package bulkload
+
+// ============================================================================
+// INCREMENTAL APPEND (-mode=append)
+// ============================================================================
+//
+// Growing a benchmark dataset (say 5M to 50M rows) with -mode=all would
+// drop and recreate it. -mode=append keeps the table and what is in it:
+//   - no schema drop, no TRUNCATE and no SET UNLOGGED (which rewrites the
+//     whole table and loses it on a crash)
+//   - indexes and foreign keys stay unless -drop-indexes is given; on a big
+//     table, keeping them is usually cheaper than rebuilding over all rows
+//   - autovacuum off and the session settings of prepare, as usual
+//   - finalize runs analyze and autovacuum (plus indexes with -drop-indexes)
+// Row numbering continues after the existing data: generated rows are
+// numbered from MAX(transaction_id) (count(*) for tables without it), so
+// with -seed the appended rows don't repeat existing UUIDs, and the
+// transaction_id sequence is moved past MAX first in case rows were loaded
+// with explicit ids. -append-from=N pins the starting row, e.g. to resume a
+// checkpointed append with the same numbering.
+//
+//   go run ./cmd/prod_loader -mode=append -rows=45000000 -seed=42
+//   go run ./cmd/prod_loader -mode=append -rows=45000000 -drop-indexes -checkpoint -append-from=5000000
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// appendBase is added to the position of every generated row (see
+// seed.go), so appended rows continue the existing numbering.
+var appendBase int64
+
+// configureAppend turns off every prepare step that would lose existing
+// rows; explicit -drop-indexes and -finalize-steps are kept.
+func configureAppend() {
+	for name, on := range map[string]bool{"create-schema": config.CreateSchema, "truncate": config.Truncate, "unlogged": config.Unlogged} {
+		if on && flagSet(name) {
+			log.Fatalf("-mode=append keeps the existing data; drop -%s", name)
+		}
+	}
+	config.CreateSchema, config.Truncate, config.Unlogged = false, false, false
+	if !flagSet("drop-indexes") {
+		config.DropIndexes = false
+	}
+	if !flagSet("finalize-steps") {
+		config.FinalizeSteps = []string{"analyze", "autovacuum"}
+		if config.DropIndexes {
+			config.FinalizeSteps = []string{"indexes", "analyze", "autovacuum"}
+		}
+	}
+}
+
+func runAppend(ctx context.Context, pool, ddl *pgxpool.Pool, metrics *LoadMetrics) error {
+	defer beginPhase("append")()
+
+	fmt.Println("\n➕ INCREMENTAL APPEND")
+	fmt.Println(strings.Repeat("=", 80))
+
+	var exists, hasID bool
+	err := ddl.QueryRow(ctx, `
+		SELECT to_regclass($1) IS NOT NULL,
+		       EXISTS (SELECT 1 FROM pg_attribute WHERE attrelid = to_regclass($1) AND attname = 'transaction_id' AND NOT attisdropped)
+	`, config.TableName).Scan(&exists, &hasID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s doesn't exist, nothing to append to (use -mode=all)", config.TableName)
+	}
+
+	var existing int64
+	if hasID {
+		err = ddl.QueryRow(ctx, "SELECT coalesce(max(transaction_id), 0) FROM "+config.TableName).Scan(&existing)
+	} else {
+		err = ddl.QueryRow(ctx, "SELECT count(*) FROM "+config.TableName).Scan(&existing)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to size %s: %w", config.TableName, err)
+	}
+	appendBase = existing
+	if flagSet("append-from") {
+		appendBase = config.AppendFrom
+	}
+	fmt.Printf("Existing data: %s, up to row %d; appending %d rows numbered from %d\n",
+		getTableSize(ctx, ddl, config.TableName), existing, config.TotalRows, appendBase)
+	if config.Checkpoint && !flagSet("append-from") {
+		fmt.Printf("   To resume this append with the same numbering, pass -append-from=%d\n", appendBase)
+	}
+
+	if hasID && existing > 0 && !cockroach() {
+		if err := advanceSequence(ctx, ddl, existing); err != nil {
+			return err
+		}
+	}
+
+	if err := prepareForLoad(ctx, ddl); err != nil {
+		return err
+	}
+	if err := executeLoad(ctx, pool, metrics); err != nil {
+		return err
+	}
+	return finalizeLoad(ctx, ddl, metrics)
+}
+
+// advanceSequence moves transaction_id's sequence past maxID, so rows
+// loaded without ids don't collide with rows loaded with them.
+func advanceSequence(ctx context.Context, ddl *pgxpool.Pool, maxID int64) error {
+	var seq *string
+	if err := ddl.QueryRow(ctx, "SELECT pg_get_serial_sequence($1, 'transaction_id')", config.TableName).Scan(&seq); err != nil {
+		return err
+	}
+	if seq == nil {
+		return nil // Not serial: ids come from the source
+	}
+	var last int64
+	var called bool
+	if err := ddl.QueryRow(ctx, "SELECT last_value, is_called FROM "+*seq).Scan(&last, &called); err != nil {
+		return err
+	}
+	if last > maxID || (last == maxID && called) {
+		return nil
+	}
+	if _, err := ddl.Exec(ctx, "SELECT setval($1, $2)", *seq, maxID); err != nil {
+		return fmt.Errorf("failed to advance %s: %w", *seq, err)
+	}
+	fmt.Printf("   🔢 %s moved from %d to %d\n", *seq, last, maxID)
+	return nil
+}
@@ -0,0 +1,260 @@
+package bulkload
+
+// ============================================================================
+// PARAMETER SWEEP (-mode=bench-matrix)
+// ============================================================================
+//
+// Which worker count, batch size, table persistence and synchronous_commit
+// are right depends on the server, its storage and its replicas; the only
+// reliable answer is to measure. -mode=bench-matrix loads -matrix-rows
+// generated rows once per combination of
+//   -matrix-goroutines   e.g. 4,8,16
+//   -matrix-batch-sizes  e.g. 5000,20000
+//   -matrix-logging      unlogged, logged
+//   -matrix-sync-commit  off, on (any synchronous_commit value)
+// and prints rows/sec and WAL generated for each, fastest marked ★.
+//
+// Runs go into <table>_bench, a copy of the target's definition (LIKE ...
+// INCLUDING ALL) that is truncated and switched LOGGED/UNLOGGED before each
+// run and dropped at the end; the target itself is not touched. With
+// -drop-indexes (default) only the indexes backing constraints are kept on
+// it, like after prepare. Every run gets its own connection pool so
+// synchronous_commit and the pool size match the combination.
+// -matrix-out also writes the results as CSV.
+//
+//   go run ./cmd/prod_loader -mode=bench-matrix -matrix-rows=500000
+//   go run ./cmd/prod_loader -mode=bench-matrix -matrix-goroutines=8,16,32 -matrix-logging=logged -matrix-out=matrix.csv
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// matrixRun is one combination and its outcome.
+type matrixRun struct {
+	goroutines int
+	batchSize  int
+	logging    string // unlogged, logged
+	syncCommit string
+	rowsPerSec float64
+	walBytes   int64
+	duration   time.Duration
+	err        error
+}
+
+func runBenchMatrix(ctx context.Context, ddl *pgxpool.Pool) error {
+	defer beginPhase("bench-matrix")()
+
+	if config.Source != "generate" || config.Adaptive || config.Checkpoint {
+		return fmt.Errorf("-mode=bench-matrix uses generated rows; drop -source, -adaptive and -checkpoint")
+	}
+	for _, l := range config.MatrixLogging {
+		if l != "logged" && l != "unlogged" {
+			return fmt.Errorf("-matrix-logging takes logged and unlogged, not %q", l)
+		}
+	}
+
+	var exists bool
+	if err := ddl.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", config.TableName).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		if err := createSchema(ctx, ddl); err != nil {
+			return err
+		}
+	}
+
+	target := config.TableName
+	bench := target + "_bench"
+	if err := createBenchTable(ctx, ddl, target, bench); err != nil {
+		return err
+	}
+	defer ddl.Exec(context.Background(), "DROP TABLE IF EXISTS "+bench)
+	saved := config
+	defer func() { config = saved }()
+	config.TableName = bench
+	config.TotalRows = config.MatrixRows
+
+	var runs []matrixRun
+	for _, g := range config.MatrixGoroutines {
+		for _, b := range config.MatrixBatchSizes {
+			for _, l := range config.MatrixLogging {
+				for _, s := range config.MatrixSyncCommit {
+					runs = append(runs, matrixRun{goroutines: g, batchSize: b, logging: l, syncCommit: s})
+				}
+			}
+		}
+	}
+
+	fmt.Println("\n🧪 PARAMETER SWEEP")
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("%d combinations × %d rows into %s\n", len(runs), config.MatrixRows, bench)
+	for i := range runs {
+		r := &runs[i]
+		fmt.Printf("\n▶️  Run %d/%d: goroutines=%d batch-size=%d %s synchronous_commit=%s\n",
+			i+1, len(runs), r.goroutines, r.batchSize, r.logging, r.syncCommit)
+		r.err = benchOnce(ctx, ddl, r)
+		if r.err != nil {
+			fmt.Printf("   ❌ %v\n", r.err)
+		}
+	}
+
+	printMatrix(runs)
+	if config.MatrixOut != "" {
+		if err := writeMatrixCSV(config.MatrixOut, runs); err != nil {
+			return err
+		}
+		fmt.Printf("📄 Results written to %s\n", config.MatrixOut)
+	}
+	return nil
+}
+
+// createBenchTable recreates bench with target's definition.
+func createBenchTable(ctx context.Context, ddl *pgxpool.Pool, target, bench string) error {
+	_, err := ddl.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s; CREATE TABLE %s (LIKE %s INCLUDING ALL)", bench, bench, target))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", bench, err)
+	}
+	if !config.DropIndexes {
+		return nil
+	}
+	// Keep the indexes behind PRIMARY KEY/UNIQUE, as prepare does.
+	_, err = ddl.Exec(ctx, fmt.Sprintf(`
+		DO $$
+		DECLARE
+			idx regclass;
+		BEGIN
+			FOR idx IN
+				SELECT i.indexrelid::regclass FROM pg_index i
+				WHERE i.indrelid = '%s'::regclass
+				AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = i.indexrelid)
+			LOOP
+				EXECUTE 'DROP INDEX ' || idx;
+			END LOOP;
+		END $$;
+	`, bench))
+	return err
+}
+
+// benchOnce runs one combination on a fresh pool.
+func benchOnce(ctx context.Context, ddl *pgxpool.Pool, r *matrixRun) error {
+	config.Goroutines, config.BatchSize, config.SynchronousCommit = r.goroutines, r.batchSize, r.syncCommit
+	if _, err := ddl.Exec(ctx, fmt.Sprintf("TRUNCATE %s; ALTER TABLE %s SET %s",
+		config.TableName, config.TableName, strings.ToUpper(r.logging))); err != nil {
+		return err
+	}
+
+	pool, err := initConnectionPool(ctx, config.DBConnString)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	startWAL := getCurrentWAL(ctx, pool)
+	metrics := NewLoadMetrics()
+	metrics.TotalRows = config.TotalRows
+	if err := executeLoad(ctx, pool, metrics); err != nil {
+		return err
+	}
+	metrics.Finalize()
+	if metrics.SuccessRows < config.TotalRows/int64(config.Goroutines)*int64(config.Goroutines) {
+		return fmt.Errorf("only %d of %d rows loaded", metrics.SuccessRows, config.TotalRows)
+	}
+
+	r.rowsPerSec, r.duration = metrics.RowsPerSecond, metrics.Duration
+	if err := pool.QueryRow(ctx, "SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), $1)::bigint", startWAL).Scan(&r.walBytes); err != nil {
+		r.walBytes = -1
+	}
+	return nil
+}
+
+// printMatrix prints the comparison table, fastest run marked.
+func printMatrix(runs []matrixRun) {
+	best := -1
+	for i, r := range runs {
+		if r.err == nil && (best < 0 || r.rowsPerSec > runs[best].rowsPerSec) {
+			best = i
+		}
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Println("📊 PARAMETER SWEEP RESULTS")
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("   %10s %10s %9s %12s %12s %12s %10s\n", "goroutines", "batch", "table", "sync_commit", "rows/sec", "WAL", "duration")
+	for i, r := range runs {
+		mark := " "
+		if i == best {
+			mark = "★"
+		}
+		if r.err != nil {
+			fmt.Printf(" %s %10d %10d %9s %12s   failed: %v\n", mark, r.goroutines, r.batchSize, r.logging, r.syncCommit, r.err)
+			continue
+		}
+		wal := "unknown"
+		if r.walBytes >= 0 {
+			wal = formatBytes(r.walBytes)
+		}
+		fmt.Printf(" %s %10d %10d %9s %12s %12.0f %12s %10v\n", mark, r.goroutines, r.batchSize, r.logging, r.syncCommit,
+			r.rowsPerSec, wal, r.duration.Round(time.Millisecond))
+	}
+	if best >= 0 {
+		b := runs[best]
+		fmt.Printf("\n★ Fastest: -goroutines=%d -batch-size=%d -unlogged=%t -synchronous-commit=%s (%.0f rows/sec)\n",
+			b.goroutines, b.batchSize, b.logging == "unlogged", b.syncCommit, b.rowsPerSec)
+	}
+	fmt.Println(strings.Repeat("=", 80))
+}
+
+// writeMatrixCSV writes the results for spreadsheets and plots.
+func writeMatrixCSV(path string, runs []matrixRun) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"goroutines", "batch_size", "logging", "synchronous_commit", "rows_per_sec", "wal_bytes", "duration_ms", "error"})
+	for _, r := range runs {
+		errText := ""
+		if r.err != nil {
+			errText = r.err.Error()
+		}
+		w.Write([]string{
+			strconv.Itoa(r.goroutines), strconv.Itoa(r.batchSize), r.logging, r.syncCommit,
+			strconv.FormatFloat(r.rowsPerSec, 'f', 0, 64), strconv.FormatInt(r.walBytes, 10),
+			strconv.FormatInt(r.duration.Milliseconds(), 10), errText,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// parseIntList parses a comma separated list of positive integers.
+func parseIntList(flagName, s string) ([]int, error) {
+	var out []int
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		n, err := strconv.Atoi(item)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("-%s: %q is not a positive number", flagName, item)
+		}
+		out = append(out, n)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("-%s is empty", flagName)
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+// Package bulkload loads large volumes of rows into PostgreSQL (and
+// CockroachDB or MySQL) the way it is done by hand for a migration: strip
+// the target of indexes, constraints and WAL, COPY in parallel, then
+// rebuild, analyze and report what each step cost.
+//
+// The prod_loader and prod_loader_ultra commands under cmd/ are thin
+// wrappers around Main and UltraMain. Other tools embed the pipeline:
+//
+//	cfg := bulkload.Defaults()
+//	cfg.TableName = "ledger_2024"
+//	cfg.Goroutines = 16
+//	bulkload.Configure(cfg)
+//	pool, err := bulkload.Connect(ctx)
+//	...
+//	metrics := bulkload.NewLoadMetrics()
+//	err = bulkload.NewPipeline(pool, pool).Run(ctx, metrics)
+//
+// Its stages are interfaces, so a tool can replace one and keep the
+// others, e.g. load its own rows with SourceRunner.
+package bulkload
+
+// ============================================================================
+// PIPELINE (embedding the loader)
+// ============================================================================
+//
+// The package keeps one configuration per process, as the commands do:
+// Configure it before building a pipeline, and don't run two at once.
+// Features that the command line sets up from flags (-payload-*, -faker,
+// -data-profile, -unique-columns, checkpoints, throttles) are off unless
+// their Config fields say otherwise.
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Optimizer gets the target ready for a bulk load: truncated, without
+// secondary indexes and constraints, UNLOGGED.
+type Optimizer interface {
+	Prepare(ctx context.Context) error
+}
+
+// CopyRunner writes the rows into the prepared target.
+type CopyRunner interface {
+	Load(ctx context.Context, metrics *LoadMetrics) error
+}
+
+// Finalizer restores what the Optimizer took away and makes the table
+// ready for queries.
+type Finalizer interface {
+	Finalize(ctx context.Context, metrics *LoadMetrics) error
+}
+
+// Pipeline runs the stages of a load in order; a nil stage is skipped.
+type Pipeline struct {
+	Optimizer Optimizer
+	Runner    CopyRunner
+	Finalizer Finalizer
+}
+
+// Run prepares, loads and finalizes. It stops at the first error; call
+// metrics.Finalize afterwards for the duration and throughput.
+func (p Pipeline) Run(ctx context.Context, metrics *LoadMetrics) error {
+	if p.Optimizer != nil {
+		if err := p.Optimizer.Prepare(ctx); err != nil {
+			return err
+		}
+	}
+	if p.Runner != nil {
+		if err := p.Runner.Load(ctx, metrics); err != nil {
+			return err
+		}
+	}
+	if p.Finalizer != nil {
+		if err := p.Finalizer.Finalize(ctx, metrics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewPipeline returns the prod_loader stages (-mode=all without
+// create-schema). ddl runs the DDL and may be pool itself; it differs when
+// pool goes through a transaction pooler.
+func NewPipeline(pool, ddl *pgxpool.Pool) Pipeline {
+	return Pipeline{
+		Optimizer: tablePrep{ddl},
+		Runner:    SourceRunner{Pool: pool},
+		Finalizer: tableFinalize{ddl},
+	}
+}
+
+// NewUltraPipeline returns the prod_loader_ultra stages: no constraints
+// or WAL during the load, all of them restored after it. Its Runner
+// finalizes metrics itself, so that FinalizeDuration stays separate.
+func NewUltraPipeline(pool *pgxpool.Pool) Pipeline {
+	return Pipeline{
+		Optimizer: ultraPrep{pool},
+		Runner:    ultraLoad{pool},
+		Finalizer: ultraRestore{pool},
+	}
+}
+
+// SourceRunner is the COPY stage of prod_loader: parallel workers,
+// bad row quarantine and the progress, throttling and checkpoint features
+// that Config enables. It loads Source, or the rows of Config.Source
+// (generated by default) when Source is nil. A Source given here is used
+// as is; -mask rules apply to Config.Source only.
+type SourceRunner struct {
+	Pool   *pgxpool.Pool
+	Source Source
+}
+
+func (r SourceRunner) Load(ctx context.Context, metrics *LoadMetrics) error {
+	return loadRows(ctx, r.Pool, r.Source, metrics)
+}
+
+type tablePrep struct{ pool *pgxpool.Pool }
+
+func (s tablePrep) Prepare(ctx context.Context) error { return prepareForLoad(ctx, s.pool) }
+
+type tableFinalize struct{ pool *pgxpool.Pool }
+
+func (s tableFinalize) Finalize(ctx context.Context, metrics *LoadMetrics) error {
+	return finalizeLoad(ctx, s.pool, metrics)
+}
+
+type ultraPrep struct{ pool *pgxpool.Pool }
+
+func (s ultraPrep) Prepare(ctx context.Context) error { return prepareUltraFast(ctx, s.pool) }
+
+type ultraLoad struct{ pool *pgxpool.Pool }
+
+func (s ultraLoad) Load(ctx context.Context, metrics *LoadMetrics) error {
+	return executeUltraFastLoad(ctx, s.pool, metrics)
+}
+
+type ultraRestore struct{ pool *pgxpool.Pool }
+
+func (s ultraRestore) Finalize(ctx context.Context, metrics *LoadMetrics) error {
+	return restoreConstraints(ctx, s.pool, metrics)
+}
+
+// Defaults returns the configuration the commands start from before flags.
+func Defaults() Config {
+	return defaults
+}
+
+// Configure replaces the configuration every stage reads.
+func Configure(c Config) {
+	config = c
+}
+
+// Connect opens a connection pool for Config.DBConnString (empty: PG*
+// environment variables; secret:// references are resolved first).
+func Connect(ctx context.Context) (*pgxpool.Pool, error) {
+	dsn, err := resolveDSN(ctx, config.DBConnString)
+	if err != nil {
+		return nil, err
+	}
+	config.DBConnString = dsn
+	return initConnectionPool(ctx, dsn)
+}
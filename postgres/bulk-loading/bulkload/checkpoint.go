@@ -0,0 +1,213 @@
+package bulkload
+
+// ============================================================================
+// CHECKPOINTED / RESUMABLE LOADS (-checkpoint, -resume)
+// ============================================================================
+//
+// With -checkpoint the load is split into chunks of config.BatchSize rows.
+// Each chunk is COPYed and recorded in bulk_load_checkpoints in the same
+// transaction, so a chunk is either fully loaded and checkpointed or not at
+// all. After an interruption, rerun with -resume and the same -load-id:
+// prepare skips TRUNCATE and completed chunks are skipped.
+//
+// Chunk ids are stable across runs regardless of -goroutines:
+//   - generated rows: chunk k covers rows [k*BatchSize, (k+1)*BatchSize)
+//   - file sources: chunk k is the k-th batch read from the file (the file is
+//     re-read on resume, but skipped chunks are not decoded into COPYs)
+//
+// Caveat: UNLOGGED tables are truncated by crash recovery. If the server
+// crashed mid-load the table is empty while the checkpoints survive; resume
+// detects that and refuses to continue.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const checkpointTable = "bulk_load_checkpoints"
+
+type checkpointState struct {
+	loadID string
+	done   map[int64]bool
+	mu     sync.Mutex
+}
+
+var checkpoints *checkpointState
+
+// defaultLoadID identifies a load by target and input so a resume without
+// -load-id finds its own checkpoints.
+func defaultLoadID() string {
+	if config.Source == "generate" {
+		return fmt.Sprintf("%s:generate:%d:%d", config.TableName, config.TotalRows, config.BatchSize)
+	}
+	return fmt.Sprintf("%s:%s:%s:%d", config.TableName, config.Source, config.SourceFile, config.BatchSize)
+}
+
+// initCheckpoints creates the control table and, on resume, loads the
+// completed chunks. A fresh (non-resume) load forgets earlier checkpoints.
+func initCheckpoints(ctx context.Context, pool *pgxpool.Pool) error {
+	if config.LoadID == "" {
+		config.LoadID = defaultLoadID()
+	}
+
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS `+checkpointTable+` (
+			load_id      text        NOT NULL,
+			chunk_id     bigint      NOT NULL,
+			rows         bigint      NOT NULL,
+			committed_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (load_id, chunk_id)
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", checkpointTable, err)
+	}
+
+	checkpoints = &checkpointState{loadID: config.LoadID, done: make(map[int64]bool)}
+
+	if !config.Resume {
+		_, err := pool.Exec(ctx, `DELETE FROM `+checkpointTable+` WHERE load_id = $1`, config.LoadID)
+		if err != nil {
+			return fmt.Errorf("failed to reset checkpoints: %w", err)
+		}
+		fmt.Printf("📍 Checkpointing load %q every %d rows\n", config.LoadID, config.BatchSize)
+		return nil
+	}
+
+	rows, err := pool.Query(ctx, `SELECT chunk_id, rows FROM `+checkpointTable+` WHERE load_id = $1`, config.LoadID)
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var chunkRows int64
+	for rows.Next() {
+		var id, n int64
+		if err := rows.Scan(&id, &n); err != nil {
+			return err
+		}
+		checkpoints.done[id] = true
+		chunkRows += n
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(checkpoints.done) > 0 {
+		var empty bool
+		err := pool.QueryRow(ctx, fmt.Sprintf(`SELECT NOT EXISTS (SELECT 1 FROM %s)`,
+			pgx.Identifier{config.TableName}.Sanitize())).Scan(&empty)
+		if err != nil {
+			return err
+		}
+		if empty {
+			return fmt.Errorf("%d chunks are checkpointed but %s is empty (UNLOGGED tables are truncated by crash recovery); rerun without -resume",
+				len(checkpoints.done), config.TableName)
+		}
+	}
+
+	fmt.Printf("📍 Resuming load %q: %d chunks (%d rows) already committed\n",
+		config.LoadID, len(checkpoints.done), chunkRows)
+	return nil
+}
+
+func (c *checkpointState) isDone(chunkID int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[chunkID]
+}
+
+func (c *checkpointState) markDone(chunkID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done[chunkID] = true
+}
+
+// copyChunk COPYs one chunk and records its checkpoint atomically (bad rows
+// quarantined from the chunk commit with it).
+func copyChunk(ctx context.Context, conn *pgxpool.Conn, goroutineID int, chunkID int64, columns []string, rows [][]interface{}, metrics *LoadMetrics) (int64, error) {
+	var n int64
+	err := retryTxn(ctx, conn, func() error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		if n, err = copyRows(ctx, tx, goroutineID, config.TableName, columns, rows, metrics); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO `+checkpointTable+` (load_id, chunk_id, rows) VALUES ($1, $2, $3)`,
+			checkpoints.loadID, chunkID, n)
+		if err != nil {
+			return fmt.Errorf("failed to record checkpoint: %w", err)
+		}
+		return tx.Commit(ctx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	checkpoints.markDone(chunkID)
+	return n, nil
+}
+
+// loadGeneratedChunks is the checkpointed version of loadInGoroutine: the
+// goroutine takes every Goroutines-th chunk of the generated row range.
+func loadGeneratedChunks(ctx context.Context, pool *pgxpool.Pool, goroutineID int, metrics *LoadMetrics) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	batch := int64(config.BatchSize)
+	totalChunks := (config.TotalRows + batch - 1) / batch
+
+	var myRows int64
+	for k := int64(goroutineID); k < totalChunks; k += int64(config.Goroutines) {
+		myRows += min(batch, config.TotalRows-k*batch)
+	}
+
+	start := time.Now()
+	fmt.Printf("   🔄 Goroutine %d: Starting load of %d rows\n", goroutineID, myRows)
+	gen := &transactionGenerator{totalRows: myRows, goroutineID: goroutineID, metrics: metrics}
+
+	var loaded, skipped int64
+	for k := int64(goroutineID); k < totalChunks; k += int64(config.Goroutines) {
+		n := min(batch, config.TotalRows-k*batch)
+		if checkpoints.isDone(k) {
+			gen.currentRow += n
+			skipped += n
+			continue
+		}
+
+		batchDone, err := beginBatch(ctx)
+		if err != nil {
+			return err
+		}
+		gen.rowOffset = k*batch - gen.currentRow
+		rows, err := collectRows(gen, n)
+		if err != nil {
+			batchDone(0)
+			return err
+		}
+		copied, err := copyChunk(ctx, conn, goroutineID, k, loadedColumns, rows, metrics)
+		batchDone(copied)
+		if err != nil {
+			metrics.RecordError(goroutineID)
+			return fmt.Errorf("chunk %d: %w", k, err)
+		}
+		metrics.RecordSuccess(goroutineID, copied)
+		loaded += copied
+	}
+
+	duration := time.Since(start)
+	logWorker(goroutineID, loaded, duration, "skipped_rows", skipped)
+	fmt.Printf("   ✅ Goroutine %d: Completed %d rows in %v (%.0f rows/sec, %d rows skipped from checkpoints)\n",
+		goroutineID, loaded, duration, float64(loaded)/duration.Seconds(), skipped)
+	return nil
+}
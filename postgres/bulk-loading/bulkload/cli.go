@@ -0,0 +1,471 @@
+package bulkload
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// COMMAND LINE (cmd/prod_loader)
+// ============================================================================
+
+// Main is the prod_loader command: it parses the command line flags into
+// the package configuration and runs -mode, exiting the process on errors.
+func Main() {
+	mode := flag.String("mode", "all", "Mode: prepare, load, finalize, validate, all, append, create-schema, upsert, swap, backfill, generate, dump-bench, bench-matrix")
+	configFile := flag.String("config", "", "YAML load plan with flag defaults and named profiles (see loader.example.yaml)")
+	profileName := flag.String("profile", "", "Profile from -config, e.g. initial-load, backfill, staging-refresh")
+	registerDSNFlags(&config.DBConnString)
+	registerPayloadFlags()
+	flag.StringVar(&config.Backend, "backend", config.Backend, "Target database: postgres, cockroach, mysql")
+	flag.BoolVar(&config.Import, "import", config.Import, "CockroachDB: load csv/avro files in object storage with IMPORT INTO")
+	flag.StringVar(&config.Source, "source", config.Source, "Row source: generate, introspect (any existing table), csv, avro, ndjson")
+	flag.StringVar(&config.TableName, "table", config.TableName, "Target table")
+	flag.Int64Var(&config.TotalRows, "rows", config.TotalRows, "Rows to generate")
+	flag.IntVar(&config.Goroutines, "goroutines", config.Goroutines, "Concurrent COPY workers")
+	flag.IntVar(&config.BatchSize, "batch-size", config.BatchSize, "Rows per COPY batch")
+	flag.StringVar(&config.SourceFile, "file", "", "Input file for file sources (local path, s3://bucket/key, gs://bucket/object)")
+	flag.StringVar(&config.Compression, "compression", config.Compression, "Input compression: auto (by extension), gzip, zstd, none; output compression for -mode=generate")
+	flag.IntVar(&config.ReadConcurrency, "read-concurrency", config.ReadConcurrency, "Parallel range reads for object store input")
+	flag.Int64Var(&config.PartSize, "part-size", config.PartSize, "Bytes per object store range read")
+	flag.BoolVar(&config.LogBadRows, "log-bad-rows", config.LogBadRows, "Bisect failing batches and quarantine bad rows instead of aborting")
+	flag.Int64Var(&config.MaxBadRows, "max-bad-rows", config.MaxBadRows, "Abort after quarantining this many rows (0 = no limit)")
+	flag.StringVar(&config.WriteMethod, "write-method", config.WriteMethod, "How rows are written: copy, insert (multi-row INSERT, for proxies that break COPY), fdw (file_fdw over server-local CSV files)")
+	flag.IntVar(&config.InsertBatch, "insert-batch", config.InsertBatch, "Rows per INSERT statement with -write-method=insert")
+	flag.IntVar(&config.CommitRows, "commit-rows", 0, "Rows per transaction with -write-method=insert (0 = one per batch)")
+	flag.StringVar(&config.OutDir, "out", "", "-mode=generate: directory for the generated files")
+	flag.StringVar(&config.OutFormat, "format", config.OutFormat, "-mode=generate file format: text, binary (COPY), csv, parquet")
+	flag.StringVar(&config.DumpDir, "dump-dir", "", "-mode=dump-bench: pg_dump directory (default: a temporary one)")
+	flag.IntVar(&config.DumpJobs, "dump-jobs", config.DumpJobs, "-mode=dump-bench: pg_dump/pg_restore -j")
+	flag.BoolVar(&config.KeepDump, "keep-dump", false, "-mode=dump-bench: keep the dump and the scratch database")
+	flag.Int64Var(&config.MatrixRows, "matrix-rows", config.MatrixRows, "-mode=bench-matrix: rows loaded per combination")
+	matrixGoroutines := flag.String("matrix-goroutines", "4,8,16", "-mode=bench-matrix: worker counts to try")
+	matrixBatchSizes := flag.String("matrix-batch-sizes", "5000,20000", "-mode=bench-matrix: batch sizes to try")
+	matrixLogging := flag.String("matrix-logging", "unlogged,logged", "-mode=bench-matrix: table persistence to try")
+	matrixSyncCommit := flag.String("matrix-sync-commit", "off,on", "-mode=bench-matrix: synchronous_commit values to try")
+	flag.StringVar(&config.MatrixOut, "matrix-out", "", "-mode=bench-matrix: also write the results to this CSV file")
+	flag.BoolVar(&config.ApplySettings, "apply-settings", false, "Apply the pre-flight max_wal_size/checkpoint_timeout/wal_compression advice with ALTER SYSTEM")
+	flag.StringVar(&config.DiskCheck, "disk-check", config.DiskCheck, "Pre-flight disk space forecast: fail (refuse to start when short), warn, off")
+	freeSpace := flag.String("free-space", "", "Free disk space for the load, e.g. 2TB (default: df on the server, if permitted)")
+	flag.StringVar(&config.Pooler, "pooler", config.Pooler, "Transaction pooler (PgBouncer) in front of the DSN: auto, on, off")
+	flag.StringVar(&config.DirectDSN, "direct-dsn", "", "Connection bypassing the pooler, for DDL and session settings")
+	flag.BoolVar(&config.Checkpoint, "checkpoint", false, "Commit every batch with a checkpoint so the load can be resumed")
+	flag.BoolVar(&config.Resume, "resume", false, "Resume a checkpointed load (skips TRUNCATE and committed chunks)")
+	flag.StringVar(&config.LoadID, "load-id", "", "Checkpoint key (default: derived from table, source and batch size)")
+	flag.DurationVar(&config.ProgressInterval, "progress-interval", config.ProgressInterval, "How often to print and persist load progress")
+	flag.StringVar(&config.StatusFile, "status-file", "", "Keep a JSON progress snapshot in this file")
+	flag.BoolVar(&config.StatusTable, "status-table", false, "Keep a progress row in bulk_load_status")
+	flag.StringVar(&config.LogFormat, "log-format", config.LogFormat, "Output: text (console), json (structured events on stdout, console on stderr)")
+	flag.StringVar(&config.MetricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9108")
+	conflictKeys := flag.String("conflict-keys", strings.Join(config.ConflictKeys, ","), "Upsert key columns, comma separated")
+	flag.BoolVar(&config.RoutePartitions, "route-partitions", config.RoutePartitions, "COPY straight into the partitions of a range partitioned target")
+	flag.StringVar(&config.Partitioned, "partitioned", "", "create-schema: build the table RANGE partitioned by transaction_date (monthly, daily)")
+	flag.StringVar(&config.PartitionInterval, "partition-interval", config.PartitionInterval, "Range of auto-created partitions: auto, daily, monthly")
+	flag.DurationVar(&config.MaxReplicaLag, "max-replica-lag", 0, "Pause/slow COPY workers while replica replay lag exceeds this (e.g. 30s, 0 = off)")
+	maxWALRate := flag.String("max-wal-rate", "", "Cap WAL generation for LOGGED targets, bytes/sec (e.g. 64MB)")
+	flag.Int64Var(&config.MaxRowsPerSec, "max-rows-per-sec", 0, "Cap total load throughput, e.g. for backfills during business hours (0 = unlimited)")
+	flag.BoolVar(&config.PauseSignals, "pause-signals", config.PauseSignals, "Pause COPY workers at batch boundaries on SIGUSR1, resume on SIGUSR2")
+	flag.StringVar(&config.ControlSocket, "control-socket", "", "Unix socket taking pause, resume and status commands during the load")
+	flag.StringVar(&config.ReplicaDSN, "replica-dsn", "", "Read replay lag from this replica instead of pg_stat_replication")
+	flag.StringVar(&config.DataProfile, "data-profile", "", "YAML file with per-column distributions for generated rows")
+	nullFrac, ndistinct := columnSettings{}, columnSettings{}
+	flag.Var(nullFrac, "null-frac", "Fraction of NULLs per generated column, column=fraction,... (overrides -data-profile)")
+	flag.Var(ndistinct, "ndistinct", "Distinct values per generated column, column=n,... (overrides -data-profile)")
+	flag.Int64Var(&config.Seed, "seed", 0, "Generate the same rows on every run (0 = random)")
+	uniqueCols := flag.String("unique-columns", "", "Generated columns with one value per row, e.g. account_id,correlation_id (for extra UNIQUE constraints)")
+	asOf := flag.String("as-of", "", "Date generated rows count back from, YYYY-MM-DD (default: now)")
+	flag.BoolVar(&config.Faker, "faker", false, "Generate realistic cities, names, merchants, IPs and user agents")
+	locales := flag.String("locales", "", "Faker locales, comma separated (en_US, en_GB, de_DE, fr_FR, ja_JP; default: weighted mix)")
+	flag.BoolVar(&config.Adaptive, "adaptive", false, "Tune the number of concurrent COPY workers from throughput and database load")
+	flag.IntVar(&config.MaxGoroutines, "max-goroutines", config.MaxGoroutines, "Upper bound on COPY workers in -adaptive mode")
+	flag.DurationVar(&config.AdaptiveInterval, "adaptive-interval", config.AdaptiveInterval, "How often -adaptive re-evaluates the worker count")
+	flag.BoolVar(&config.CreateSchema, "create-schema", config.CreateSchema, "-mode=all drops and recreates the schema")
+	flag.Int64Var(&config.AppendFrom, "append-from", 0, "-mode=append: number generated rows from here (default: MAX(transaction_id))")
+	flag.BoolVar(&config.DropIndexes, "drop-indexes", config.DropIndexes, "prepare: drop secondary indexes and foreign keys")
+	flag.BoolVar(&config.Truncate, "truncate", config.Truncate, "prepare: truncate the target")
+	flag.BoolVar(&config.Unlogged, "unlogged", config.Unlogged, "prepare: make the target UNLOGGED")
+	flag.StringVar(&config.SynchronousCommit, "synchronous-commit", config.SynchronousCommit, "synchronous_commit for load sessions (empty = server setting)")
+	finalizeSteps := flag.String("finalize-steps", strings.Join(config.FinalizeSteps, ","), "Finalize steps to run: "+strings.Join(finalizeStepNames, ","))
+	flag.IntVar(&config.IndexParallelism, "index-parallelism", config.IndexParallelism, "Indexes built at once in finalize")
+	flag.StringVar(&config.IndexMem, "index-mem", config.IndexMem, "maintenance_work_mem for each index build")
+	flag.BoolVar(&config.TuneStats, "tune-stats", false, "finalize: raise statistics targets of skewed/high-cardinality -stats-columns before ANALYZE")
+	flag.BoolVar(&config.FirstRead, "first-read", false, "finalize: time full and index scans right after the load and again after VACUUM (hint-bit penalty)")
+	flag.BoolVar(&config.FirstReadFreeze, "first-read-freeze", false, "With -first-read: also against a COPY FREEZE copy of the table (needs as much free space as the table)")
+	statsColumns := flag.String("stats-columns", strings.Join(config.StatsColumns, ","), "Columns considered by -tune-stats")
+	flag.IntVar(&config.ValidateSample, "validate-sample", config.ValidateSample, "Rows sampled by -mode=validate for NOT NULL/CHECK conformance")
+	flag.IntVar(&config.VerifySample, "verify-sample", 0, "After a file load (and in -mode=validate), compare this many sampled source rows with the table (0 = off)")
+	verifyKey := flag.String("verify-key", "", "Columns matching source rows to loaded rows for -verify-sample (default: primary key)")
+	flag.StringVar(&config.UpsertMethod, "upsert-method", config.UpsertMethod, "Upsert statement: auto, on-conflict, merge (PG15+)")
+	flag.StringVar(&config.TriggerMode, "trigger-mode", config.TriggerMode, "Target triggers: safe (keep them firing), fast (disable INSERT triggers during the load, then run -reconcile-sql)")
+	flag.StringVar(&config.ReconcileSQL, "reconcile-sql", "", "-trigger-mode=fast: statement doing what the disabled triggers would have, run after the load")
+	flag.StringVar(&config.SwapTable, "swap-table", "", "-mode=swap: staging table (default <table>_new)")
+	flag.DurationVar(&config.SwapLockTimeout, "swap-lock-timeout", config.SwapLockTimeout, "-mode=swap: longest wait for the swap's locks before retrying")
+	flag.BoolVar(&config.SwapDropOld, "swap-drop-old", false, "-mode=swap: drop <table>_old after the swap instead of keeping it for a rollback")
+	flag.StringVar(&config.Backfill, "backfill", config.Backfill, "-mode=backfill change: amount-usd, soft-delete, custom")
+	flag.StringVar(&config.BackfillSet, "backfill-set", "", "-backfill=custom: SET list, e.g. \"fee_amount = amount * 0.03\"")
+	flag.StringVar(&config.BackfillWhere, "backfill-where", "", "-backfill=custom: rows to update")
+	flag.IntVar(&config.BackfillAgeDays, "backfill-age-days", config.BackfillAgeDays, "-backfill=soft-delete: rows older than this many days")
+	flag.DurationVar(&config.BackfillSleep, "backfill-sleep", config.BackfillSleep, "Pause between backfill batches")
+	flag.Int64Var(&config.BackfillVacuumEvery, "backfill-vacuum-every", config.BackfillVacuumEvery, "VACUUM after this many updated rows (0 = never)")
+	flag.Int64Var(&config.BackfillFrom, "backfill-from", 0, "Resume a backfill after this transaction_id")
+	fieldMap := flag.String("field-map", "", "Source field to column renames: field=column,...")
+	mask := columnSettings{}
+	flag.Var(mask, "mask", "Masking rules for file sources: column=nullify|hash|tokenize|fake,...")
+	flag.StringVar(&config.MaskKey, "mask-key", "", "Secret key for -mask hash, tokenize and fake (default $LOADER_MASK_KEY)")
+	flag.StringVar(&config.MaskVault, "mask-vault", "", "Write tokenize token,value pairs to this CSV file")
+	columns := flag.String("columns", "", "Comma separated target columns (default: CSV header)")
+	flag.StringVar(&config.Delimiter, "delimiter", config.Delimiter, "CSV field delimiter (\\t for TSV)")
+	flag.BoolVar(&config.Header, "header", config.Header, "CSV file has a header row")
+	flag.StringVar(&config.NullToken, "null", config.NullToken, "Field value loaded as NULL")
+	flag.StringVar(&config.SpillColumn, "spill-column", config.SpillColumn, "JSONB column for unmapped NDJSON fields (empty to drop them)")
+	flag.Parse()
+
+	if *configFile != "" {
+		if err := applyConfigFile(*configFile, *profileName); err != nil {
+			log.Fatal(err)
+		}
+	} else if *profileName != "" {
+		log.Fatal("-profile needs -config")
+	}
+	if err := initLogging(); err != nil {
+		log.Fatal(err)
+	}
+	if config.Goroutines < 1 || config.BatchSize < 1 {
+		log.Fatal("-goroutines and -batch-size must be positive")
+	}
+	config.StatsColumns = nil
+	for _, col := range strings.Split(*statsColumns, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			config.StatsColumns = append(config.StatsColumns, col)
+		}
+	}
+	config.FinalizeSteps = nil
+	for _, step := range strings.Split(*finalizeSteps, ",") {
+		if step = strings.TrimSpace(step); step == "" {
+			continue
+		}
+		if !slices.Contains(finalizeStepNames, step) {
+			log.Fatalf("Unknown finalize step %q (use %s)", step, strings.Join(finalizeStepNames, ", "))
+		}
+		config.FinalizeSteps = append(config.FinalizeSteps, step)
+	}
+	if config.FirstReadFreeze {
+		config.FirstRead = true
+	}
+	if config.FirstRead && config.Backend != "postgres" {
+		log.Fatal("-first-read measures PostgreSQL hint bits and freezing; it needs -backend=postgres")
+	}
+	if *mode == "append" {
+		configureAppend()
+	}
+	if !slices.Contains([]string{"", "on", "off", "local", "remote_write", "remote_apply"}, config.SynchronousCommit) {
+		log.Fatalf("Invalid -synchronous-commit %q (use on, off, local, remote_write, remote_apply)", config.SynchronousCommit)
+	}
+	if *mode == "bench-matrix" {
+		var err error
+		if config.MatrixGoroutines, err = parseIntList("matrix-goroutines", *matrixGoroutines); err != nil {
+			log.Fatal(err)
+		}
+		if config.MatrixBatchSizes, err = parseIntList("matrix-batch-sizes", *matrixBatchSizes); err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range strings.Split(*matrixLogging, ",") {
+			config.MatrixLogging = append(config.MatrixLogging, strings.TrimSpace(l))
+		}
+		for _, s := range strings.Split(*matrixSyncCommit, ",") {
+			if s = strings.TrimSpace(s); !slices.Contains([]string{"on", "off", "local", "remote_write", "remote_apply"}, s) {
+				log.Fatalf("Invalid -matrix-sync-commit value %q", s)
+			}
+			config.MatrixSyncCommit = append(config.MatrixSyncCommit, s)
+		}
+	}
+	if *columns != "" {
+		for _, col := range strings.Split(*columns, ",") {
+			config.SourceColumns = append(config.SourceColumns, strings.TrimSpace(col))
+		}
+	}
+	if config.Resume {
+		config.Checkpoint = true
+	}
+	if config.Source == "introspect" && (*mode == "all" || *mode == "create-schema") {
+		log.Fatal("-source=introspect loads an existing table; use -mode=load")
+	}
+	for _, key := range strings.Split(*verifyKey, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.VerifyKey = append(config.VerifyKey, key)
+		}
+	}
+	config.ConflictKeys = nil
+	for _, key := range strings.Split(*conflictKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			config.ConflictKeys = append(config.ConflictKeys, key)
+		}
+	}
+	if *maxWALRate != "" {
+		rate, err := parseByteSize(*maxWALRate)
+		if err != nil {
+			log.Fatalf("Invalid -max-wal-rate: %v", err)
+		}
+		config.MaxWALRate = rate
+	}
+	if !slices.Contains([]string{"fail", "warn", "off"}, config.DiskCheck) {
+		log.Fatalf("Invalid -disk-check %q (use fail, warn, off)", config.DiskCheck)
+	}
+	if *freeSpace != "" {
+		free, err := parseByteSize(*freeSpace)
+		if err != nil {
+			log.Fatalf("Invalid -free-space: %v", err)
+		}
+		config.FreeSpace = free
+	}
+	if config.Adaptive && (config.MaxGoroutines < 1 || config.AdaptiveInterval <= 0) {
+		log.Fatal("-max-goroutines and -adaptive-interval must be positive")
+	}
+	initAdaptive()
+	for _, loc := range strings.Split(*locales, ",") {
+		if loc = strings.TrimSpace(loc); loc != "" {
+			config.Locales = append(config.Locales, loc)
+		}
+	}
+	if *asOf != "" {
+		t, err := time.Parse("2006-01-02", *asOf)
+		if err != nil {
+			log.Fatalf("Invalid -as-of: %v", err)
+		}
+		config.AsOf = t
+	}
+	if config.Seed != 0 && config.AsOf.IsZero() {
+		fmt.Println("ℹ️  -seed without -as-of: generated dates still move with the current day")
+	}
+	if err := initFaker(); err != nil {
+		log.Fatal(err)
+	}
+	if err := initPayload(); err != nil {
+		log.Fatal(err)
+	}
+	if config.DataProfile != "" {
+		if err := loadDataProfile(config.DataProfile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := applyColumnFlags(nullFrac, ndistinct); err != nil {
+		log.Fatal(err)
+	}
+	for _, col := range strings.Split(*uniqueCols, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			config.UniqueColumns = append(config.UniqueColumns, col)
+		}
+	}
+	if err := initKeySpaces(config.UniqueColumns); err != nil {
+		log.Fatal(err)
+	}
+	if !slices.Contains([]string{"copy", "insert", "fdw"}, config.WriteMethod) {
+		log.Fatalf("Invalid -write-method %q (use copy, insert or fdw)", config.WriteMethod)
+	}
+	if config.WriteMethod == "fdw" {
+		if err := checkFDW(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if config.WriteMethod == "insert" && (config.InsertBatch < 1 || config.CommitRows < 0) {
+		log.Fatal("-insert-batch must be positive and -commit-rows not negative")
+	}
+	if !slices.Contains([]string{"postgres", "cockroach", "mysql"}, config.Backend) {
+		log.Fatalf("Invalid -backend %q (use postgres, cockroach or mysql)", config.Backend)
+	}
+	if cockroach() && !flagSet("write-method") {
+		config.WriteMethod = "insert" // Batched INSERTs with transaction retries
+	}
+	if config.Pooler != "auto" && config.Pooler != "on" && config.Pooler != "off" {
+		log.Fatalf("Invalid -pooler %q (use auto, on or off)", config.Pooler)
+	}
+	if config.ProgressInterval <= 0 {
+		log.Fatal("-progress-interval must be positive")
+	}
+	if config.TriggerMode != "safe" && config.TriggerMode != "fast" {
+		log.Fatalf("Invalid -trigger-mode %q (use safe or fast)", config.TriggerMode)
+	}
+	if config.ReconcileSQL != "" && config.TriggerMode != "fast" {
+		log.Fatal("-reconcile-sql needs -trigger-mode=fast")
+	}
+	if *mode == "swap" && config.SwapLockTimeout <= 0 {
+		log.Fatal("-swap-lock-timeout must be positive")
+	}
+	if config.ReadConcurrency < 1 || config.PartSize < 1 {
+		log.Fatal("-read-concurrency and -part-size must be positive")
+	}
+	if *fieldMap != "" {
+		config.FieldMap = make(map[string]string)
+		for _, pair := range strings.Split(*fieldMap, ",") {
+			field, column, ok := strings.Cut(pair, "=")
+			if !ok {
+				log.Fatalf("Invalid -field-map entry %q (want field=column)", pair)
+			}
+			config.FieldMap[strings.TrimSpace(field)] = strings.TrimSpace(column)
+		}
+	}
+	config.Mask = mask
+	if len(config.Mask) > 0 && config.Source == "generate" {
+		log.Fatal("-mask applies to -source=csv, avro, ndjson or introspect; generated rows hold no PII")
+	}
+
+	if *mode == "generate" {
+		// No database involved
+		if err := generateToFiles(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	ctx := context.Background()
+
+	if config.Backend == "mysql" {
+		// database/sql and LOAD DATA instead of pgx and COPY
+		if err := runMySQL(ctx, *mode); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("\n✅ All operations completed successfully!")
+		return
+	}
+
+	// Secrets and TLS flags; an empty main DSN means PG* environment variables.
+	for _, dsn := range []*string{&config.DBConnString, &config.DirectDSN, &config.ReplicaDSN} {
+		if *dsn == "" && dsn != &config.DBConnString {
+			continue
+		}
+		resolved, err := resolveDSN(ctx, *dsn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		*dsn = resolved
+	}
+
+	// Initialize connection pools (ddl bypasses a transaction pooler)
+	pool, ddl, err := openPools(ctx)
+	if err != nil {
+		log.Fatal("Failed to initialize connection pool:", err)
+	}
+	defer pool.Close()
+	if ddl != pool {
+		defer ddl.Close()
+	}
+
+	fmt.Printf("✅ Connected to %s\n", backendName())
+	fmt.Printf("Configuration: %d rows, %d goroutines, batch size %d\n",
+		config.TotalRows, config.Goroutines, config.BatchSize)
+
+	metrics := NewLoadMetrics()
+	metrics.TotalRows = config.TotalRows
+	if config.MetricsAddr != "" {
+		if err := startMetricsServer(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	switch *mode {
+	case "prepare", "load", "all", "append", "upsert", "swap":
+		runsPrepare := *mode == "prepare" || *mode == "all" || *mode == "append" || *mode == "swap"
+		if err := adviseWALSettings(ctx, ddl, runsPrepare); err != nil {
+			log.Fatal(err)
+		}
+		if err := checkDiskSpace(ctx, ddl, runsPrepare); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	switch *mode {
+	case "create-schema":
+		if err := createSchema(ctx, ddl); err != nil {
+			log.Fatal(err)
+		}
+
+	case "prepare":
+		if err := prepareForLoad(ctx, ddl); err != nil {
+			log.Fatal(err)
+		}
+
+	case "load":
+		if err := executeLoad(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+		metrics.Finalize()
+		metrics.PrintReport()
+
+	case "finalize":
+		if err := finalizeLoad(ctx, ddl, metrics); err != nil {
+			log.Fatal(err)
+		}
+		printFirstReadReport()
+
+	case "validate":
+		if err := runValidation(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+
+	case "dump-bench":
+		if err := runDumpBench(ctx, ddl); err != nil {
+			log.Fatal(err)
+		}
+
+	case "bench-matrix":
+		if err := runBenchMatrix(ctx, ddl); err != nil {
+			log.Fatal(err)
+		}
+
+	case "backfill":
+		if err := runBackfill(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+
+	case "append":
+		if err := runAppend(ctx, pool, ddl, metrics); err != nil {
+			log.Fatal(err)
+		}
+		metrics.Finalize()
+		metrics.PrintReport()
+
+	case "upsert":
+		if err := runUpsert(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+		metrics.Finalize()
+		metrics.PrintReport()
+
+	case "swap":
+		if err := runSwap(ctx, pool, ddl, metrics); err != nil {
+			log.Fatal(err)
+		}
+		metrics.Finalize()
+		metrics.PrintReport()
+
+	case "all":
+		// Full pipeline (a resumed load keeps the existing table)
+		if !config.Resume && config.CreateSchema {
+			if err := createSchema(ctx, ddl); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := NewPipeline(pool, ddl).Run(ctx, metrics); err != nil {
+			log.Fatal(err)
+		}
+		metrics.Finalize()
+		metrics.PrintReport()
+
+	default:
+		log.Fatal("Invalid mode. Use: prepare, load, finalize, validate, all, append, create-schema, upsert, swap, backfill, generate, dump-bench, or bench-matrix")
+	}
+
+	switch *mode {
+	case "load", "all", "append", "upsert":
+		if err := verifyAfterLoad(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Println("\n✅ All operations completed successfully!")
+}
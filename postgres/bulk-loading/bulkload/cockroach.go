@@ -0,0 +1,438 @@
+package bulkload
+
+// ============================================================================
+// COCKROACHDB BACKEND (-backend=cockroach)
+// ============================================================================
+//
+// CockroachDB speaks the PostgreSQL wire protocol, so the same generator,
+// sources, checkpoints and metrics can benchmark its ingestion. What it
+// doesn't have is the PostgreSQL load machinery: no UNLOGGED tables (every
+// write is replicated through Raft), no autovacuum or VACUUM (MVCC garbage
+// is collected by the storage layer), no maintenance_work_mem, no WAL LSNs.
+// With -backend=cockroach:
+//   create-schema  the same table with a hash-sharded primary key, so
+//                  sequential transaction_ids spread over all ranges instead
+//                  of one hot range
+//   prepare        drops secondary indexes and foreign keys, truncates;
+//                  the UNLOGGED/autovacuum/session steps are left out
+//   load           csv and avro files in object storage (s3://, gs://,
+//                  azure://, http(s)://, nodelocal://, userfile://) go
+//                  through IMPORT INTO: the nodes read the files themselves
+//                  and ingest SSTs directly. Everything else is written as
+//                  multi-row INSERTs (insert.go), one transaction per
+//                  -batch-size batch, retried with backoff when the cluster
+//                  asks for a transaction retry (SQLSTATE 40001).
+//   finalize       rebuilds the indexes (distributed backfill jobs) and
+//                  runs ANALYZE; logged/autovacuum/vacuum have no equivalent
+// The WAL advisor, -partitioned and -tune-stats don't apply.
+//
+// IMPORT INTO takes the table offline until the job finishes, reads the
+// files with the cluster's credentials (AUTH=implicit is added to s3:// and
+// gs:// URLs without one) and fails the whole job on a bad row, so
+// -log-bad-rows and -checkpoint have no effect on it (the job itself
+// survives node restarts). Without -columns a CSV must hold every table
+// column in order. Pass -import=false to compare it with INSERTs.
+//
+//   go run ./cmd/prod_loader -backend=cockroach -dsn="postgresql://root@crdb:26257/avro?sslmode=disable" -mode=all
+//   go run ./cmd/prod_loader -backend=cockroach -mode=load -source=csv -file=s3://exports/txns.csv -columns=...
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxTxnRetries = 10 // Attempts per transaction before giving up
+
+// txnRetries counts CockroachDB transaction retries, for the load report.
+var txnRetries atomic.Int64
+
+// cockroach reports whether the target is CockroachDB.
+func cockroach() bool {
+	return config.Backend == "cockroach"
+}
+
+// backendName names the target database in messages.
+func backendName() string {
+	if cockroach() {
+		return "CockroachDB"
+	}
+	return "PostgreSQL"
+}
+
+// checkBackend makes sure -backend matches the server behind pool.
+func checkBackend(ctx context.Context, pool *pgxpool.Pool) error {
+	var version string
+	if err := pool.QueryRow(ctx, "SELECT version()").Scan(&version); err != nil {
+		return err
+	}
+	isCRDB := strings.Contains(version, "CockroachDB")
+	switch {
+	case isCRDB && !cockroach():
+		return fmt.Errorf("server is CockroachDB (%s); pass -backend=cockroach", version)
+	case !isCRDB && cockroach():
+		return fmt.Errorf("-backend=cockroach but the server is not CockroachDB (%s)", version)
+	}
+	return nil
+}
+
+// retryTxn runs fn, one whole transaction on db, again while CockroachDB
+// asks for a transaction retry. Inside an outer transaction the retry is
+// up to whoever owns that transaction, so fn runs once.
+func retryTxn(ctx context.Context, db copyTarget, fn func() error) error {
+	if _, inTx := db.(pgx.Tx); !cockroach() || inTx {
+		return fn()
+	}
+	backoff := 50 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isRetryError(err) || attempt == maxTxnRetries {
+			return err
+		}
+		txnRetries.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff + time.Duration(rand.Int63n(int64(backoff)))):
+		}
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
+
+// isRetryError reports whether err is a serialization failure the
+// transaction can simply be retried after.
+func isRetryError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "40001"
+}
+
+// printRetryReport adds the transaction retries to the load report.
+func printRetryReport() {
+	if n := txnRetries.Load(); n > 0 {
+		fmt.Printf("Transaction Retries:  %d (SQLSTATE 40001)\n", n)
+	}
+}
+
+// cockroachSchemaSQL is createTableSQL as separate statements, with the
+// primary key hash-sharded.
+func cockroachSchemaSQL() []string {
+	schema := strings.Replace(createTableSQL,
+		"transaction_id      BIGSERIAL PRIMARY KEY,",
+		"transaction_id      BIGSERIAL PRIMARY KEY USING HASH,", 1)
+
+	var statements []string
+	for _, stmt := range strings.Split(schema, ";\n") {
+		var lines []string
+		for _, line := range strings.Split(stmt, "\n") {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			statements = append(statements, strings.Join(lines, "\n"))
+		}
+	}
+	return statements
+}
+
+// createCockroachSchema runs the schema one statement at a time; CockroachDB
+// can't drop and recreate a table in one implicit transaction.
+func createCockroachSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	if config.Partitioned != "" {
+		return fmt.Errorf("-partitioned is PostgreSQL declarative partitioning; CockroachDB splits ranges itself")
+	}
+	for _, stmt := range cockroachSchemaSQL() {
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	fmt.Println("✅ Schema created successfully (hash-sharded primary key)")
+	return nil
+}
+
+// prepareCockroach is prepareForLoad for CockroachDB.
+func prepareCockroach(ctx context.Context, pool *pgxpool.Pool) error {
+	steps := []struct {
+		name string
+		run  func() error
+		off  bool
+	}{
+		{
+			name: "1. Drop non-unique indexes (keep constraints)",
+			run: func() error {
+				names, err := queryNames(ctx, pool, `
+					SELECT indexname FROM pg_indexes
+					WHERE tablename = $1 AND indexname NOT LIKE '%_pkey' AND indexname NOT LIKE '%_key'
+				`)
+				if err != nil {
+					return err
+				}
+				for _, name := range names {
+					if _, err := pool.Exec(ctx, fmt.Sprintf("DROP INDEX IF EXISTS %s@%s",
+						config.TableName, pgx.Identifier{name}.Sanitize())); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			off: !config.DropIndexes,
+		},
+		{
+			name: "2. Drop foreign key constraints (if any)",
+			run: func() error {
+				names, err := queryNames(ctx, pool, `
+					SELECT conname FROM pg_constraint
+					WHERE conrelid = $1::regclass AND contype = 'f'
+				`)
+				if err != nil {
+					return err
+				}
+				for _, name := range names {
+					if _, err := pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+						config.TableName, pgx.Identifier{name}.Sanitize())); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			off: !config.DropIndexes,
+		},
+		{
+			name: "3. Truncate target table",
+			run: func() error {
+				_, err := pool.Exec(ctx, fmt.Sprintf("TRUNCATE TABLE %s", config.TableName))
+				return err
+			},
+			off: !config.Truncate || config.Resume,
+		},
+	}
+
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		if step.off {
+			fmt.Println(" ⏭️  (off in this load plan)")
+			continue
+		}
+		if err := step.run(); err != nil {
+			fmt.Printf(" ⚠️  (skipped: %v)\n", err)
+		} else {
+			fmt.Println(" ✅")
+		}
+	}
+	fmt.Println("   UNLOGGED, autovacuum and session memory settings: ⏭️  (no CockroachDB equivalent)")
+	return nil
+}
+
+// queryNames runs a one-column query with config.TableName as $1.
+func queryNames(ctx context.Context, pool *pgxpool.Pool, sql string) ([]string, error) {
+	rows, err := pool.Query(ctx, sql, config.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// finalizeCockroach is finalizeLoad for CockroachDB: indexes and ANALYZE.
+func finalizeCockroach(ctx context.Context, pool *pgxpool.Pool) error {
+	var finalizeErr error
+	if want("indexes") {
+		fmt.Printf("   1. Rebuild indexes (backfill jobs)...")
+		start := time.Now()
+		if err := buildCockroachIndexes(ctx, pool); err != nil {
+			fmt.Printf("   ❌ %v\n", err)
+			finalizeErr = err
+		} else {
+			fmt.Printf("   ✅ (took %v)\n", time.Since(start))
+		}
+	}
+	if want("analyze") {
+		fmt.Printf("   2. Run ANALYZE to update statistics...")
+		start := time.Now()
+		if _, err := pool.Exec(ctx, fmt.Sprintf("ANALYZE %s", config.TableName)); err != nil {
+			fmt.Printf(" ⚠️  (error: %v)\n", err)
+		} else {
+			fmt.Printf(" ✅ (took %v)\n", time.Since(start))
+		}
+	}
+	fmt.Println("   LOGGED, autovacuum and VACUUM: ⏭️  (no CockroachDB equivalent)")
+	return finalizeErr
+}
+
+// want reports whether the load plan includes a finalize step.
+func want(step string) bool {
+	for _, s := range config.FinalizeSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// buildCockroachIndexes creates the secondary indexes, -index-parallelism
+// schema change jobs at a time.
+func buildCockroachIndexes(ctx context.Context, pool *pgxpool.Pool) error {
+	parallelism := max(1, min(config.IndexParallelism, len(financialIndexes)))
+	fmt.Printf("\n      Building %d indexes, %d at a time\n", len(financialIndexes), parallelism)
+
+	results := make([]indexBuild, len(financialIndexes))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, idx := range financialIndexes {
+		wg.Add(1)
+		go func(i int, idx indexDef) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			_, err := pool.Exec(ctx, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s %s", idx.name, config.TableName, idx.def))
+			results[i] = indexBuild{name: idx.name, duration: time.Since(start), err: err}
+		}(i, idx)
+	}
+	wg.Wait()
+
+	var failed []string
+	for _, r := range results {
+		if r.err != nil {
+			fmt.Printf("      ❌ %-22s failed after %v: %v\n", r.name, r.duration.Round(time.Millisecond), r.err)
+			failed = append(failed, r.name)
+		} else {
+			fmt.Printf("      ✅ %-22s %10v\n", r.name, r.duration.Round(time.Millisecond))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("index builds failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// useImport reports whether the load goes through IMPORT INTO.
+func useImport() bool {
+	if !cockroach() || !config.Import || (config.Source != "csv" && config.Source != "avro") {
+		return false
+	}
+	if len(config.FieldMap) > 0 || len(config.Mask) > 0 || config.Compression == "zstd" || strings.HasSuffix(config.SourceFile, ".zst") {
+		return false // Renames, masking and zstd are done client side
+	}
+	u, err := url.Parse(config.SourceFile)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "s3", "gs", "azure", "http", "https", "nodelocal", "userfile":
+		return true
+	}
+	return false
+}
+
+// importInto loads config.SourceFile with IMPORT INTO and waits for the job.
+func importInto(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	stmt, err := importSQL()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Source: %s (%s) via IMPORT INTO, the cluster reads the file\n", config.SourceFile, config.Source)
+	if config.LogBadRows || config.Checkpoint {
+		fmt.Println("   (IMPORT fails as a whole on bad rows; -log-bad-rows and -checkpoint don't apply)")
+	}
+
+	start := time.Now()
+	rows, err := pool.Query(ctx, stmt)
+	if err != nil {
+		return fmt.Errorf("IMPORT INTO failed: %w", err)
+	}
+	defer rows.Close()
+	var imported int64
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return err
+		}
+		for i, fd := range rows.FieldDescriptions() {
+			if fd.Name == "rows" {
+				if n, ok := values[i].(int64); ok {
+					imported += n
+				}
+			}
+		}
+		if len(values) > 0 {
+			fmt.Printf("   📦 Job %v: %v\n", values[0], values[1:])
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("IMPORT INTO failed: %w", err)
+	}
+
+	metrics.RecordSuccess(0, imported)
+	elapsed := time.Since(start)
+	fmt.Printf("   ✅ Imported %d rows in %v (%.0f rows/sec)\n", imported, elapsed, float64(imported)/elapsed.Seconds())
+	return nil
+}
+
+// importSQL builds the IMPORT INTO statement for the configured file.
+func importSQL() (string, error) {
+	u, err := url.Parse(config.SourceFile)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme == "s3" || u.Scheme == "gs") && u.Query().Get("AUTH") == "" {
+		q := u.Query()
+		q.Set("AUTH", "implicit")
+		u.RawQuery = q.Encode()
+	}
+
+	var b strings.Builder
+	b.WriteString("IMPORT INTO " + config.TableName)
+	if len(config.SourceColumns) > 0 {
+		quoted := make([]string, len(config.SourceColumns))
+		for i, col := range config.SourceColumns {
+			quoted[i] = pgx.Identifier{col}.Sanitize()
+		}
+		b.WriteString(" (" + strings.Join(quoted, ", ") + ")")
+	}
+
+	var options []string
+	switch config.Source {
+	case "csv":
+		fmt.Fprintf(&b, " CSV DATA (%s)", quoteLiteral(u.String()))
+		if config.Delimiter != "," {
+			delimiter := config.Delimiter
+			if delimiter == `\t` {
+				delimiter = "\t"
+			}
+			options = append(options, "delimiter = "+quoteLiteral(delimiter))
+		}
+		options = append(options, "nullif = "+quoteLiteral(config.NullToken))
+		if config.Header {
+			options = append(options, "skip = '1'")
+		}
+	case "avro":
+		fmt.Fprintf(&b, " AVRO DATA (%s)", quoteLiteral(u.String()))
+	}
+	if config.Compression == "gzip" {
+		options = append(options, "decompress = 'gzip'")
+	}
+	if len(options) > 0 {
+		b.WriteString(" WITH " + strings.Join(options, ", "))
+	}
+	return b.String(), nil
+}
+
+// quoteLiteral quotes s as a SQL string literal, escape-string syntax when
+// it holds a tab.
+func quoteLiteral(s string) string {
+	quoted := "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	if strings.Contains(s, "\t") {
+		return "e" + strings.ReplaceAll(strings.ReplaceAll(quoted, `\`, `\\`), "\t", `\t`)
+	}
+	return quoted
+}
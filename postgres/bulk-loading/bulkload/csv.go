@@ -0,0 +1,130 @@
+package bulkload
+
+// ============================================================================
+// CSV SOURCE (-source=csv)
+// ============================================================================
+//
+// -file       path to the CSV file
+// -columns    target columns, comma separated. With -header they select and
+//             order fields by header name; without, they are positional.
+//             Defaults to every header field.
+// -delimiter  field separator (default ",", use "\t" for TSV)
+// -header     first line is a header row (default true)
+// -null       field value that means NULL (default: empty field)
+//
+// Fields are coerced to the target column types (see coerceValue).
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+type csvSource struct {
+	file    io.ReadCloser
+	reader  *csv.Reader
+	columns []string
+	fields  []int    // Index into the CSV record for each column
+	types   []string // Target type for each column
+	line    int
+}
+
+func openCSVSource(ctx context.Context, path string, columns []string, types map[string]string) (*csvSource, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-source=csv requires -file")
+	}
+	if config.Delimiter == `\t` {
+		config.Delimiter = "\t"
+	}
+	delim, size := utf8.DecodeRuneInString(config.Delimiter)
+	if size == 0 || size != len(config.Delimiter) {
+		return nil, fmt.Errorf("delimiter must be a single character, got %q", config.Delimiter)
+	}
+
+	f, err := openInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(f)
+	r.Comma = delim
+	r.ReuseRecord = true
+
+	s := &csvSource{file: f, reader: r}
+
+	if config.Header {
+		header, err := r.Read()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		s.line++
+		byName := make(map[string]int, len(header))
+		for i, name := range header {
+			byName[name] = i
+		}
+		if len(columns) == 0 {
+			columns = append([]string(nil), header...)
+		}
+		for _, col := range columns {
+			idx, ok := byName[col]
+			if !ok {
+				f.Close()
+				return nil, fmt.Errorf("column %q not found in CSV header", col)
+			}
+			s.fields = append(s.fields, idx)
+		}
+	} else {
+		for i := range columns {
+			s.fields = append(s.fields, i)
+		}
+	}
+
+	if err := checkColumns(columns, types); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.columns = columns
+	for _, col := range columns {
+		s.types = append(s.types, types[col])
+	}
+	return s, nil
+}
+
+func (s *csvSource) Columns() []string {
+	return s.columns
+}
+
+func (s *csvSource) Next() ([]interface{}, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	s.line++
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]interface{}, len(s.fields))
+	for i, idx := range s.fields {
+		if idx >= len(record) {
+			return nil, fmt.Errorf("line %d: missing field for column %s", s.line, s.columns[i])
+		}
+		raw := record[idx]
+		if raw == config.NullToken {
+			continue
+		}
+		v, err := coerceValue(raw, s.types[i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d column %s: %w", s.line, s.columns[i], err)
+		}
+		row[i] = v
+	}
+	return row, nil
+}
+
+func (s *csvSource) Close() error {
+	return s.file.Close()
+}
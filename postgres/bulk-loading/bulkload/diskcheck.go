@@ -0,0 +1,249 @@
+package bulkload
+
+// ============================================================================
+// DISK SPACE PRE-FLIGHT (-disk-check, -free-space)
+// ============================================================================
+//
+// A load that fills the data volume halfway through stops with "could not
+// extend file", and one that fills pg_wal takes the whole server down.
+// Before prepare, load, all, append and upsert the loader forecasts the
+// space the run needs and compares it with what is free:
+//   heap       -rows × row width (as in the WAL advisor)
+//   indexes    -rows × index bytes per row of the target, else half the heap
+//   WAL        the WAL advisor's estimate; without replication slots pg_wal
+//              is recycled at max_wal_size, so only that much is kept
+//   transient  SET LOGGED copies the heap before the old copy is dropped,
+//              and index builds sort in temp files (about one index per
+//              -index-parallelism build); the larger of the two counts
+// Rows that prepare truncates (or create-schema drops) are credited back.
+// The total needs 10% headroom.
+//
+// Free space comes from -free-space, or from the server: roles with
+// pg_execute_server_program (or superusers) run df on the tablespace and
+// pg_wal via COPY FROM PROGRAM, so a separate WAL volume is checked on its
+// own. Without either, the forecast is printed and not checked.
+// -disk-check=fail (default) refuses to start when space is short, warn
+// only reports it, off skips the check.
+//
+//   go run ./cmd/prod_loader -mode=all -rows=500000000 -free-space=2TB
+//   go run ./cmd/prod_loader -mode=append -rows=50000000 -disk-check=warn
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// diskHeadroom is the margin the forecast needs on top of itself.
+const diskHeadroom = 1.10
+
+// volume is one filesystem as reported by df.
+type volume struct {
+	mount string
+	free  int64 // Bytes available
+}
+
+// diskForecast is the space a load is expected to take, in bytes.
+type diskForecast struct {
+	heap, indexes, wal, transient, freed int64
+	transientWhy                         string
+}
+
+func (f diskForecast) data() int64 { return f.heap + f.indexes + f.transient - f.freed }
+
+// checkDiskSpace forecasts the space the load needs and compares it with
+// the free space; runsPrepare is as for adviseWALSettings.
+func checkDiskSpace(ctx context.Context, pool *pgxpool.Pool, runsPrepare bool) error {
+	if config.DiskCheck == "off" || cockroach() {
+		return nil
+	}
+	fmt.Println("\n🩺 PRE-FLIGHT: DISK SPACE")
+	fmt.Println(strings.Repeat("=", 80))
+	defer fmt.Println(strings.Repeat("=", 80))
+
+	f, err := forecastDisk(ctx, pool, runsPrepare)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Forecast for %d rows:\n", config.TotalRows)
+	fmt.Printf("   Heap:       %12s\n", formatBytes(f.heap))
+	fmt.Printf("   Indexes:    %12s\n", formatBytes(f.indexes))
+	fmt.Printf("   WAL:        %12s kept in pg_wal\n", formatBytes(f.wal))
+	fmt.Printf("   Transient:  %12s (%s)\n", formatBytes(f.transient), f.transientWhy)
+	if f.freed > 0 {
+		fmt.Printf("   Freed:     -%12s (current table, truncated by prepare)\n", formatBytes(f.freed))
+	}
+	if config.Source != "generate" && config.Source != "introspect" {
+		fmt.Println("   (file source: the forecast assumes -rows rows)")
+	}
+
+	var short []string
+	check := func(what string, need, free int64) {
+		need = int64(float64(max(need, 0)) * diskHeadroom)
+		mark := "✅"
+		if need > free {
+			mark = "❌"
+			short = append(short, fmt.Sprintf("%s needs %s, %s free", what, formatBytes(need), formatBytes(free)))
+		}
+		fmt.Printf("%s %-28s needs %s with headroom, %s free\n", mark, what, formatBytes(need), formatBytes(free))
+	}
+
+	switch {
+	case config.FreeSpace > 0:
+		check("Data and WAL (-free-space)", f.data()+f.wal, config.FreeSpace)
+	default:
+		data, wal, err := serverVolumes(ctx, pool)
+		if err != nil {
+			fmt.Printf("⚠️  Free space unknown (%v); pass -free-space to check it\n", err)
+			return nil
+		}
+		if data.mount == wal.mount {
+			check("Data and WAL on "+data.mount, f.data()+f.wal, data.free)
+		} else {
+			check("Data on "+data.mount, f.data(), data.free)
+			check("pg_wal on "+wal.mount, f.wal, wal.free)
+		}
+	}
+
+	if len(short) == 0 {
+		return nil
+	}
+	if config.DiskCheck == "warn" {
+		fmt.Println("⚠️  Not enough disk space; continuing because of -disk-check=warn")
+		return nil
+	}
+	return fmt.Errorf("not enough disk space for this load: %s (free space, lower -rows, or pass -disk-check=warn)",
+		strings.Join(short, "; "))
+}
+
+// forecastDisk estimates what the load adds to the data volume and pg_wal.
+func forecastDisk(ctx context.Context, pool *pgxpool.Pool, runsPrepare bool) (diskForecast, error) {
+	var f diskForecast
+	t, err := inspectTarget(ctx, pool)
+	if err != nil {
+		return f, err
+	}
+	s, err := readWALSettings(ctx, pool)
+	if err != nil {
+		return f, err
+	}
+	wal, _, err := estimateLoadWAL(ctx, pool, s, runsPrepare)
+	if err != nil {
+		return f, err
+	}
+	var slots int
+	if err := pool.QueryRow(ctx, "SELECT count(*) FROM pg_replication_slots").Scan(&slots); err != nil {
+		return f, fmt.Errorf("failed to read replication slots: %w", err)
+	}
+
+	rows := float64(config.TotalRows)
+	f.heap = int64(rows * t.rowBytes)
+	f.indexes = int64(rows * t.indexBytes)
+	if t.indexBytes == 0 {
+		f.indexes = f.heap / 2
+	}
+	f.wal = wal
+	if slots == 0 {
+		f.wal = min(wal, s.maxWALSize)
+	}
+
+	rebuild := config.DropIndexes && want("indexes")
+	unlogged := t.persistence == "u" || (runsPrepare && config.Unlogged)
+	var sortSpace int64
+	if rebuild {
+		n := int64(len(financialIndexes))
+		sortSpace = f.indexes * min(int64(config.IndexParallelism), n) / n
+	}
+	f.transient, f.transientWhy = sortSpace, "index build sorts"
+	if unlogged && want("logged") && f.heap > sortSpace {
+		f.transient, f.transientWhy = f.heap, "SET LOGGED copies the heap"
+	}
+	if f.transient == 0 {
+		f.transientWhy = "no rewrite or index rebuild"
+	}
+	if runsPrepare && !config.Resume && (config.Truncate || config.CreateSchema) {
+		f.freed = t.totalBytes
+	}
+	return f, nil
+}
+
+// serverVolumes runs df on the server for the target's tablespace and
+// pg_wal. It needs superuser or pg_execute_server_program.
+func serverVolumes(ctx context.Context, pool *pgxpool.Pool) (volume, volume, error) {
+	var allowed bool
+	err := pool.QueryRow(ctx, `
+		SELECT rolsuper OR pg_has_role(current_user, 'pg_execute_server_program', 'MEMBER')
+		FROM pg_roles WHERE rolname = current_user
+	`).Scan(&allowed)
+	if err != nil {
+		return volume{}, volume{}, err
+	}
+	if !allowed {
+		return volume{}, volume{}, fmt.Errorf("df on the server needs pg_execute_server_program")
+	}
+
+	var dataDir, location string
+	err = pool.QueryRow(ctx, `
+		SELECT current_setting('data_directory'),
+		       coalesce(pg_tablespace_location(coalesce(nullif(
+		           (SELECT reltablespace FROM pg_class WHERE oid = to_regclass($1)), 0),
+		           (SELECT dattablespace FROM pg_database WHERE datname = current_database()))), '')
+	`, config.TableName).Scan(&dataDir, &location)
+	if err != nil {
+		return volume{}, volume{}, err
+	}
+	if location == "" {
+		location = dataDir
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return volume{}, volume{}, err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "CREATE TEMP TABLE IF NOT EXISTS loader_df (line text)"); err != nil {
+		return volume{}, volume{}, err
+	}
+	defer conn.Exec(context.Background(), "DROP TABLE IF EXISTS loader_df")
+	program := fmt.Sprintf("df -Pk %s %s", shellQuote(location), shellQuote(dataDir+"/pg_wal/"))
+	if _, err := conn.Exec(ctx, "COPY loader_df FROM PROGRAM "+quoteLiteral(program)); err != nil {
+		return volume{}, volume{}, err
+	}
+	rows, err := conn.Query(ctx, "SELECT line FROM loader_df")
+	if err != nil {
+		return volume{}, volume{}, err
+	}
+	defer rows.Close()
+
+	var vols []volume
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return volume{}, volume{}, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		avail, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue // Header
+		}
+		vols = append(vols, volume{mount: fields[5], free: avail * 1024})
+	}
+	if err := rows.Err(); err != nil {
+		return volume{}, volume{}, err
+	}
+	if len(vols) != 2 {
+		return volume{}, volume{}, fmt.Errorf("unexpected df output")
+	}
+	return vols[0], vols[1], nil
+}
+
+// shellQuote quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,202 @@
+package bulkload
+
+// ============================================================================
+// CONNECTION SETTINGS (-dsn, PG* env vars, TLS, secret://)
+// ============================================================================
+//
+// Shared by both loaders:
+//   go run ./cmd/prod_loader ...
+//   go run ./cmd/prod_loader_ultra ...
+//
+// Where the connection string comes from:
+//   -dsn="postgres://user@host:5432/avro"   URL or key=value form
+//   (no -dsn)                              libpq environment: PGHOST, PGPORT,
+//                                          PGDATABASE, PGUSER, PGPASSWORD,
+//                                          PGSSLMODE, ~/.pgpass, ...
+//   -dsn=secret://aws/<secret-id>           AWS Secrets Manager (default
+//                                          credential chain and region)
+//   -dsn=secret://vault/<path>             Vault KV v1 or v2 over HTTP, with
+//                                          VAULT_ADDR and VAULT_TOKEN
+//                                          (e.g. secret://vault/secret/data/loader)
+// A secret holds either the connection string itself, JSON with a "dsn"
+// field, or the RDS layout (username, password, host, port, dbname).
+//
+// -sslmode, -sslrootcert, -sslcert and -sslkey are added to whatever
+// connection string results, overriding the same settings in it:
+//   -dsn=secret://aws/prod/loader -sslmode=verify-full -sslrootcert=rds-ca.pem
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// tlsOptions are the -ssl* flags, applied by resolveDSN.
+var tlsOptions struct {
+	mode, rootCert, cert, key string
+}
+
+// registerDSNFlags adds -dsn (stored in dsn) and the TLS flags.
+func registerDSNFlags(dsn *string) {
+	flag.StringVar(dsn, "dsn", *dsn, "Connection string or secret://aws/<id>, secret://vault/<path> (default: PG* environment variables)")
+	flag.StringVar(&tlsOptions.mode, "sslmode", "", "TLS mode: disable, prefer, require, verify-ca, verify-full")
+	flag.StringVar(&tlsOptions.rootCert, "sslrootcert", "", "CA certificate file for verify-ca/verify-full")
+	flag.StringVar(&tlsOptions.cert, "sslcert", "", "Client certificate file")
+	flag.StringVar(&tlsOptions.key, "sslkey", "", "Client key file")
+}
+
+// resolveDSN fetches a secret:// DSN and applies the TLS flags. An empty
+// DSN stays empty apart from TLS settings, so pgx reads the environment.
+func resolveDSN(ctx context.Context, dsn string) (string, error) {
+	if ref, ok := strings.CutPrefix(dsn, "secret://"); ok {
+		var err error
+		if dsn, err = fetchSecretDSN(ctx, ref); err != nil {
+			return "", fmt.Errorf("secret://%s: %w", ref, err)
+		}
+		fmt.Printf("🔐 Connection string read from secret://%s\n", ref)
+	}
+
+	params := []struct{ key, value string }{
+		{"sslmode", tlsOptions.mode},
+		{"sslrootcert", tlsOptions.rootCert},
+		{"sslcert", tlsOptions.cert},
+		{"sslkey", tlsOptions.key},
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid connection URL: %w", err)
+		}
+		q := u.Query()
+		for _, p := range params {
+			if p.value != "" {
+				q.Set(p.key, p.value)
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	// key=value form: a later setting wins.
+	for _, p := range params {
+		if p.value != "" {
+			quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(p.value)
+			dsn = strings.TrimSpace(fmt.Sprintf("%s %s='%s'", dsn, p.key, quoted))
+		}
+	}
+	return dsn, nil
+}
+
+// fetchSecretDSN reads aws/<id> or vault/<path> and turns it into a
+// connection string.
+func fetchSecretDSN(ctx context.Context, ref string) (string, error) {
+	backend, name, _ := strings.Cut(ref, "/")
+	if name == "" {
+		return "", fmt.Errorf("want secret://aws/<secret-id> or secret://vault/<path>")
+	}
+
+	switch backend {
+	case "aws":
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &name})
+		if err != nil {
+			return "", err
+		}
+		if out.SecretString == nil {
+			return "", fmt.Errorf("secret has no string value")
+		}
+		return secretDSN(*out.SecretString)
+
+	case "vault":
+		fields, err := readVault(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return "", err
+		}
+		return secretDSN(string(raw))
+
+	default:
+		return "", fmt.Errorf("unknown secret backend %q (use aws or vault)", backend)
+	}
+}
+
+// readVault returns the fields of a KV secret.
+func readVault(ctx context.Context, path string) (map[string]interface{}, error) {
+	addr, token := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+	// KV v2 nests the fields next to "metadata".
+	if inner, ok := body.Data["data"].(map[string]interface{}); ok && body.Data["metadata"] != nil {
+		return inner, nil
+	}
+	return body.Data, nil
+}
+
+// secretDSN accepts a connection string, {"dsn": ...} or the RDS secret
+// layout.
+func secretDSN(secret string) (string, error) {
+	secret = strings.TrimSpace(secret)
+	if !strings.HasPrefix(secret, "{") {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not valid JSON: %w", err)
+	}
+	field := func(name string) string {
+		if v, ok := fields[name]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	if dsn := field("dsn"); dsn != "" {
+		return dsn, nil
+	}
+
+	user, host := field("username"), field("host")
+	if user == "" || host == "" {
+		return "", fmt.Errorf(`secret needs a "dsn" field or username, password, host, port and dbname`)
+	}
+	u := &url.URL{Scheme: "postgres", User: url.UserPassword(user, field("password")), Host: host, Path: "/" + field("dbname")}
+	if port := field("port"); port != "" {
+		u.Host += ":" + port
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,219 @@
+package bulkload
+
+// ============================================================================
+// DUMP/RESTORE BENCHMARK (-mode=dump-bench)
+// ============================================================================
+//
+// Migrations can move a table by reloading it with COPY or by a logical
+// dump and restore. -mode=dump-bench times the second path on the loaded
+// table so the two can be compared on the same data and hardware:
+//   1. pg_dump -Fd -j <dump-jobs> -t <table> into -dump-dir
+//   2. pg_restore into a scratch database (<db>_restore_bench, created and
+//      dropped by the benchmark), one section at a time:
+//        pre-data    CREATE TABLE
+//        data        COPY, -j <dump-jobs> (one job per table, so a single
+//                    table restores its data on one connection)
+//        post-data   indexes and constraints
+// The report lists each step's duration, the dump size on disk and rows/sec,
+// next to the last COPY load of the table recorded in bulk_load_status
+// (-status-table). data ≈ -mode=load and post-data ≈ finalize's index
+// rebuild. pg_dump/pg_restore must be on PATH and at least the server's
+// major version; they connect with -direct-dsn when one is given.
+//
+//   go run ./cmd/prod_loader -mode=dump-bench -dump-jobs=8 -dump-dir=/data/bench
+//   go run ./cmd/prod_loader -mode=dump-bench -keep-dump   # keep the dump and the scratch database
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// benchStep is one timed pg_dump/pg_restore run.
+type benchStep struct {
+	name     string
+	duration time.Duration
+}
+
+func runDumpBench(ctx context.Context, pool *pgxpool.Pool) error {
+	defer beginPhase("dump-bench")()
+
+	fmt.Println("\n📦 DUMP/RESTORE BENCHMARK")
+	fmt.Println(strings.Repeat("=", 80))
+
+	for _, tool := range []string{"pg_dump", "pg_restore"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return fmt.Errorf("%s not found on PATH (install the PostgreSQL client matching the server)", tool)
+		}
+	}
+
+	var rows int64
+	var size, database string
+	err := pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT count(*), pg_size_pretty(pg_total_relation_size('%s')), current_database() FROM %s
+	`, config.TableName, config.TableName)).Scan(&rows, &size, &database)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", config.TableName, err)
+	}
+	fmt.Printf("Table: %s, %d rows, %s with indexes\n", config.TableName, rows, size)
+
+	dir, cleanup := config.DumpDir, config.DumpDir
+	if dir == "" {
+		if cleanup, err = os.MkdirTemp("", "dump-bench-"); err != nil {
+			return err
+		}
+		dir = filepath.Join(cleanup, "dump")
+	} else if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("-dump-dir %s already exists (pg_dump -Fd creates it)", dir)
+	}
+	if !config.KeepDump {
+		defer os.RemoveAll(cleanup)
+	}
+
+	dsn := config.DBConnString
+	if config.DirectDSN != "" {
+		dsn = config.DirectDSN
+	}
+	jobs := fmt.Sprint(config.DumpJobs)
+
+	var steps []benchStep
+	d, err := runTool(ctx, "pg_dump", "--dbname="+dsn, "-Fd", "-j", jobs, "-t", config.TableName, "-f", dir)
+	if err != nil {
+		return err
+	}
+	steps = append(steps, benchStep{"pg_dump -Fd -j " + jobs, d})
+	dumpBytes, err := dirSize(dir)
+	if err != nil {
+		return err
+	}
+
+	scratch := database + "_restore_bench"
+	ident := pgx.Identifier{scratch}.Sanitize()
+	if _, err := pool.Exec(ctx, "DROP DATABASE IF EXISTS "+ident); err != nil {
+		return err
+	}
+	if _, err := pool.Exec(ctx, "CREATE DATABASE "+ident); err != nil {
+		return fmt.Errorf("failed to create scratch database %s: %w", scratch, err)
+	}
+	if !config.KeepDump {
+		defer pool.Exec(context.Background(), "DROP DATABASE IF EXISTS "+ident)
+	}
+
+	restoreDSN := withDatabase(dsn, scratch)
+	for _, section := range []string{"pre-data", "data", "post-data"} {
+		args := []string{"--dbname=" + restoreDSN, "--section=" + section, "--no-owner", "--no-acl"}
+		if section != "pre-data" {
+			args = append(args, "-j", jobs)
+		}
+		d, err := runTool(ctx, "pg_restore", append(args, dir)...)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, benchStep{"pg_restore " + section, d})
+	}
+
+	fmt.Println()
+	var restore time.Duration
+	for i, s := range steps {
+		line := fmt.Sprintf("   %-26s %12v", s.name, s.duration.Round(time.Millisecond))
+		switch {
+		case i == 0:
+			line += fmt.Sprintf("   %s on disk, %.0f rows/sec", formatBytes(dumpBytes), float64(rows)/s.duration.Seconds())
+		case s.name == "pg_restore data":
+			line += fmt.Sprintf("   %.0f rows/sec", float64(rows)/s.duration.Seconds())
+		case s.name == "pg_restore post-data":
+			line += "   (indexes and constraints)"
+		}
+		if i > 0 {
+			restore += s.duration
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("   %-26s %12v   %.0f rows/sec end to end\n", "restore total", restore.Round(time.Millisecond),
+		float64(rows)/restore.Seconds())
+
+	var loadRows int64
+	var loadTime float64
+	err = pool.QueryRow(ctx, `
+		SELECT rows_committed, extract(epoch FROM updated_at - started_at)::float8
+		FROM `+statusTable+`
+		WHERE table_name = $1 AND state = 'done'
+		ORDER BY updated_at DESC LIMIT 1
+	`, config.TableName).Scan(&loadRows, &loadTime)
+	if err == nil && loadTime > 0 {
+		took := time.Duration(loadTime * float64(time.Second))
+		fmt.Printf("   %-26s %12v   %.0f rows/sec (last load in %s)\n", "COPY load", took.Round(time.Millisecond),
+			float64(loadRows)/loadTime, statusTable)
+	} else {
+		fmt.Println("   (run the load with -status-table to see its COPY rate here)")
+	}
+	if config.KeepDump {
+		fmt.Printf("   Kept %s and database %s\n", dir, scratch)
+	}
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+// runTool runs a PostgreSQL client program and returns how long it took.
+func runTool(ctx context.Context, name string, args ...string) (time.Duration, error) {
+	fmt.Printf("   ⏱️  %s %s\n", name, strings.Join(redactArgs(args), " "))
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return time.Since(start), nil
+}
+
+// redactArgs hides the connection string, which may hold a password.
+func redactArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "--dbname=") {
+			arg = "--dbname=…"
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// withDatabase points a libpq connection string at another database.
+func withDatabase(dsn, database string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			u.Path = "/" + database
+			return u.String()
+		}
+	}
+	// The last dbname in key=value form wins.
+	return strings.TrimSpace(dsn + " dbname='" + strings.ReplaceAll(database, "'", `\'`) + "'")
+}
+
+// dirSize adds up the files under dir.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,171 @@
+package bulkload
+
+// ============================================================================
+// FAKER-BASED ROW CONTENT (-faker, -locales)
+// ============================================================================
+//
+// The built-in generator draws city, region and country from four or five
+// hardcoded strings and puts the same user agent and referrer in every
+// row, so after a load the planner sees a handful of distinct values where
+// production has thousands. With -faker each row gets:
+//   - a locale, drawn from -locales (default: all, weighted by
+//     fakeLocaleWeights), which fixes country_code, currency and region and
+//     supplies the city
+//   - customer and merchant names in metadata (locale names; gofakeit for
+//     en_US)
+//   - a real-looking IPv4 address, user agent and referrer URL in metadata
+//
+// Columns set in -data-profile keep their profiled values.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+type fakeLocale struct {
+	Name       string
+	Country    string
+	Currency   string
+	Region     string
+	Cities     []string // Empty: gofakeit cities
+	FirstNames []string // Empty: gofakeit names
+	LastNames  []string
+}
+
+var fakeLocales = map[string]*fakeLocale{
+	"en_US": {Name: "en_US", Country: "US", Currency: "USD", Region: "North America"},
+	"en_GB": {
+		Name: "en_GB", Country: "GB", Currency: "GBP", Region: "Europe",
+		Cities: []string{"London", "Manchester", "Birmingham", "Leeds", "Glasgow", "Liverpool",
+			"Bristol", "Edinburgh", "Sheffield", "Cardiff", "Belfast", "Nottingham", "Leicester", "Newcastle"},
+		FirstNames: []string{"Oliver", "Amelia", "George", "Isla", "Harry", "Ava", "Jack", "Emily", "Charlie", "Sophie"},
+		LastNames:  []string{"Smith", "Jones", "Taylor", "Brown", "Williams", "Wilson", "Davies", "Evans", "Thomas", "Roberts"},
+	},
+	"de_DE": {
+		Name: "de_DE", Country: "DE", Currency: "EUR", Region: "Europe",
+		Cities: []string{"Berlin", "Hamburg", "München", "Köln", "Frankfurt am Main", "Stuttgart",
+			"Düsseldorf", "Leipzig", "Dortmund", "Essen", "Bremen", "Dresden", "Hannover", "Nürnberg"},
+		FirstNames: []string{"Lukas", "Mia", "Leon", "Emma", "Finn", "Hannah", "Paul", "Sophia", "Jonas", "Lea"},
+		LastNames:  []string{"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann"},
+	},
+	"fr_FR": {
+		Name: "fr_FR", Country: "FR", Currency: "EUR", Region: "Europe",
+		Cities: []string{"Paris", "Marseille", "Lyon", "Toulouse", "Nice", "Nantes", "Strasbourg",
+			"Montpellier", "Bordeaux", "Lille", "Rennes", "Reims", "Toulon", "Grenoble"},
+		FirstNames: []string{"Gabriel", "Louise", "Raphaël", "Jade", "Léo", "Emma", "Louis", "Alice", "Jules", "Chloé"},
+		LastNames:  []string{"Martin", "Bernard", "Dubois", "Thomas", "Robert", "Richard", "Petit", "Durand", "Leroy", "Moreau"},
+	},
+	"ja_JP": {
+		Name: "ja_JP", Country: "JP", Currency: "JPY", Region: "Asia",
+		Cities: []string{"東京", "横浜", "大阪", "名古屋", "札幌", "福岡", "神戸", "川崎", "京都", "さいたま",
+			"広島", "仙台", "千葉", "北九州"},
+		FirstNames: []string{"蓮", "陽葵", "湊", "凛", "大翔", "結菜", "悠真", "咲良", "陽翔", "芽依"},
+		LastNames:  []string{"佐藤", "鈴木", "高橋", "田中", "伊藤", "渡辺", "山本", "中村", "小林", "加藤"},
+	},
+}
+
+// fakeLocaleWeights is the default locale mix, roughly our traffic split.
+var fakeLocaleWeights = map[string]int{"en_US": 55, "en_GB": 15, "de_DE": 12, "fr_FR": 10, "ja_JP": 8}
+
+// fakerLocales is the weighted locale list rows are drawn from.
+var fakerLocales []*fakeLocale
+
+// initFaker resolves -locales; call it after flag parsing.
+func initFaker() error {
+	if !config.Faker {
+		return nil
+	}
+	names := config.Locales
+	if len(names) == 0 {
+		for name := range fakeLocaleWeights {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	fakerLocales = nil
+	for _, name := range names {
+		loc, ok := fakeLocales[name]
+		if !ok {
+			known := make([]string, 0, len(fakeLocales))
+			for k := range fakeLocales {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown locale %q (use %s)", name, strings.Join(known, ", "))
+		}
+		weight := 1
+		if len(config.Locales) == 0 {
+			weight = fakeLocaleWeights[name]
+		}
+		for i := 0; i < weight; i++ {
+			fakerLocales = append(fakerLocales, loc)
+		}
+	}
+	fmt.Printf("🎭 Faker data, locales: %s\n", strings.Join(names, ", "))
+	return nil
+}
+
+// fakeRow is the faked content of one row.
+type fakeRow struct {
+	locale *fakeLocale
+	city   string
+}
+
+// faker returns the generator's gofakeit instance. It draws from the
+// generator's row source, so -seed covers faked values too.
+func (g *transactionGenerator) faker() *gofakeit.Faker {
+	if g.fake == nil {
+		g.random()
+		g.fake = gofakeit.NewFaker(g.src, false)
+	}
+	return g.fake
+}
+
+// fakeRow picks a locale and fills the faked metadata fields.
+func (g *transactionGenerator) fakeRow(metadata map[string]interface{}) *fakeRow {
+	f := g.faker()
+	loc := fakerLocales[g.random().Intn(len(fakerLocales))]
+	row := &fakeRow{locale: loc}
+
+	if len(loc.Cities) > 0 {
+		row.city = loc.Cities[g.random().Intn(len(loc.Cities))]
+		metadata["customer_name"] = loc.FirstNames[g.random().Intn(len(loc.FirstNames))] + " " +
+			loc.LastNames[g.random().Intn(len(loc.LastNames))]
+	} else {
+		row.city = f.City()
+		metadata["customer_name"] = f.Name()
+	}
+	metadata["merchant_name"] = f.Company()
+	metadata["locale"] = loc.Name
+	metadata["ip_address"] = f.IPv4Address()
+	metadata["user_agent"] = f.UserAgent()
+	metadata["referrer"] = f.URL()
+	return row
+}
+
+// applyFake writes the faked columns into a generated row, leaving
+// profiled columns alone.
+func (g *transactionGenerator) applyFake(row []interface{}, fake *fakeRow) {
+	set := func(name, value string) {
+		if g.column(name) == nil {
+			row[generatedIndex[name]] = value
+		}
+	}
+	set("country_code", fake.locale.Country)
+	set("currency", fake.locale.Currency)
+	set("region", fake.locale.Region)
+	set("city", fake.city)
+}
+
+// generatedIndex maps generatedColumns to their positions.
+var generatedIndex = func() map[string]int {
+	m := make(map[string]int, len(generatedColumns))
+	for i, col := range generatedColumns {
+		m[col] = i
+	}
+	return m
+}()
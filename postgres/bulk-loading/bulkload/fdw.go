@@ -0,0 +1,263 @@
+package bulkload
+
+// ============================================================================
+// SERVER-SIDE LOAD WITH FILE_FDW (-write-method=fdw)
+// ============================================================================
+//
+// When the CSV files already sit on the database host, shipping them
+// through the client and COPY FROM STDIN is a detour. -write-method=fdw
+// loads them where they are, for comparison with client-side COPY:
+//   - CREATE EXTENSION file_fdw and a loader_files server
+//   - one foreign table per file, typed like the target's columns (or
+//     -columns), with the CSV options of the load (-delimiter, -null,
+//     -header); .gz and .zst files are read through gzip/zstd -dc
+//   - INSERT INTO target SELECT * FROM the foreign table, -goroutines
+//     files at a time, each on its own backend
+// -file is a server path, a comma separated list of them or a glob
+// (expanded with pg_ls_dir on the server). PostgreSQL never runs INSERT
+// in parallel itself, so a single file is loaded by a single backend:
+// split big files first (split -n l/8) to use more cores. Reading files
+// needs pg_read_server_files (and pg_execute_server_program for
+// compressed ones). With -checkpoint each file is a chunk. A bad row
+// fails its whole file, so -log-bad-rows doesn't apply, and throttles
+// can't pace a single statement.
+//
+//   go run ./cmd/prod_loader -mode=all -source=csv -write-method=fdw -file='/data/export/part-*.csv' -goroutines=8
+//   go run ./cmd/prod_loader -mode=load -source=csv -write-method=fdw -file=/data/ledger.csv.gz -header=false
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const fdwServer = "loader_files"
+
+// checkFDW reports why -write-method=fdw can't load this source, if it can't.
+func checkFDW() error {
+	switch {
+	case config.Backend != "postgres":
+		return fmt.Errorf("-write-method=fdw needs PostgreSQL")
+	case config.Source != "csv":
+		return fmt.Errorf("-write-method=fdw reads CSV files (-source=csv)")
+	case len(config.Mask) > 0 || len(config.FieldMap) > 0:
+		return fmt.Errorf("-mask and -field-map are applied client side; use -write-method=copy")
+	case strings.Contains(config.SourceFile, "://"):
+		return fmt.Errorf("-write-method=fdw reads files on the database host, not %s", config.SourceFile)
+	}
+	return nil
+}
+
+// loadViaFDW loads every file of -file with INSERT ... SELECT from file_fdw.
+func loadViaFDW(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	if _, err := pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS file_fdw"); err != nil {
+		return fmt.Errorf("file_fdw isn't available: %w", err)
+	}
+	if _, err := pool.Exec(ctx, "CREATE SERVER IF NOT EXISTS "+fdwServer+" FOREIGN DATA WRAPPER file_fdw"); err != nil {
+		return err
+	}
+	files, err := serverFiles(ctx, pool, config.SourceFile)
+	if err != nil {
+		return err
+	}
+	columns, err := fdwColumns(ctx, pool)
+	if err != nil {
+		return err
+	}
+	loadedColumns = make([]string, len(columns))
+	for i, c := range columns {
+		loadedColumns[i] = c.name
+	}
+	fmt.Printf("Source: %d server-side file(s) via file_fdw, %d at a time, columns: %s\n",
+		len(files), min(config.Goroutines, len(files)), strings.Join(loadedColumns, ", "))
+	if config.LogBadRows {
+		fmt.Println("   (a bad row fails its whole file; -log-bad-rows doesn't apply)")
+	}
+
+	sem := make(chan struct{}, config.Goroutines)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+	for i, file := range files {
+		if checkpoints != nil && checkpoints.isDone(int64(i)) {
+			fmt.Printf("   📍 %s already loaded by an earlier run\n", file)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, file string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			n, err := loadFDWFile(ctx, pool, i, file, columns)
+			if err != nil {
+				fmt.Printf("   ❌ %s: %v\n", file, err)
+				mu.Lock()
+				failed = append(failed, file)
+				mu.Unlock()
+				return
+			}
+			metrics.RecordSuccess(i%config.Goroutines, n)
+			elapsed := time.Since(start)
+			fmt.Printf("   ✅ %s: %d rows in %v (%.0f rows/sec)\n", file, n, elapsed.Round(time.Millisecond), float64(n)/elapsed.Seconds())
+		}(i, file)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("file_fdw load failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// fdwColumn is a column of the foreign table.
+type fdwColumn struct {
+	name, typ string
+}
+
+// fdwColumns returns the file's columns: -columns, else every column of
+// the target that accepts values, in table order.
+func fdwColumns(ctx context.Context, pool *pgxpool.Pool) ([]fdwColumn, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT attname::text, format_type(atttypid, atttypmod)
+		FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND attgenerated = ''
+		ORDER BY attnum
+	`, config.TableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", config.TableName, err)
+	}
+	all, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (fdwColumn, error) {
+		var c fdwColumn
+		err := row.Scan(&c.name, &c.typ)
+		return c, err
+	})
+	if err != nil || len(config.SourceColumns) == 0 {
+		return all, err
+	}
+
+	var picked []fdwColumn
+	for _, name := range config.SourceColumns {
+		found := false
+		for _, c := range all {
+			if c.name == name {
+				picked, found = append(picked, c), true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("column %q does not exist in %s", name, config.TableName)
+		}
+	}
+	return picked, nil
+}
+
+// loadFDWFile creates the foreign table over one file and copies it into
+// the target, with its checkpoint when -checkpoint is on.
+func loadFDWFile(ctx context.Context, pool *pgxpool.Pool, i int, file string, columns []fdwColumn) (int64, error) {
+	foreign := pgx.Identifier{fmt.Sprintf("loader_fdw_%d", i)}.Sanitize()
+	defs := make([]string, len(columns))
+	names := make([]string, len(columns))
+	for j, c := range columns {
+		names[j] = pgx.Identifier{c.name}.Sanitize()
+		defs[j] = names[j] + " " + c.typ
+	}
+
+	options := []string{"format 'csv'", "null " + quoteLiteral(config.NullToken)}
+	switch {
+	case strings.HasSuffix(file, ".gz"):
+		options = append(options, "program "+quoteLiteral("gzip -dc "+shellQuote(file)))
+	case strings.HasSuffix(file, ".zst"):
+		options = append(options, "program "+quoteLiteral("zstd -dc "+shellQuote(file)))
+	default:
+		options = append(options, "filename "+quoteLiteral(file))
+	}
+	if config.Header {
+		options = append(options, "header 'true'")
+	}
+	if delimiter := config.Delimiter; delimiter != "," {
+		if delimiter == `\t` {
+			delimiter = "\t"
+		}
+		options = append(options, "delimiter "+quoteLiteral(delimiter))
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "DROP FOREIGN TABLE IF EXISTS "+foreign); err != nil {
+		return 0, err
+	}
+	_, err = conn.Exec(ctx, fmt.Sprintf("CREATE FOREIGN TABLE %s (%s) SERVER %s OPTIONS (%s)",
+		foreign, strings.Join(defs, ", "), fdwServer, strings.Join(options, ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Exec(context.Background(), "DROP FOREIGN TABLE IF EXISTS "+foreign)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	cols := strings.Join(names, ", ")
+	tag, err := tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", config.TableName, cols, cols, foreign))
+	if err != nil {
+		return 0, err
+	}
+	if checkpoints != nil {
+		_, err = tx.Exec(ctx, `INSERT INTO `+checkpointTable+` (load_id, chunk_id, rows) VALUES ($1, $2, $3)`,
+			checkpoints.loadID, int64(i), tag.RowsAffected())
+		if err != nil {
+			return 0, fmt.Errorf("failed to record checkpoint: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	if checkpoints != nil {
+		checkpoints.markDone(int64(i))
+	}
+	return tag.RowsAffected(), nil
+}
+
+// serverFiles expands -file into server paths: comma separated, and globs
+// are matched against pg_ls_dir of their directory.
+func serverFiles(ctx context.Context, pool *pgxpool.Pool, spec string) ([]string, error) {
+	var files []string
+	for _, f := range strings.Split(spec, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		if !strings.ContainsAny(f, "*?[") {
+			files = append(files, f)
+			continue
+		}
+		dir, pattern := path.Split(f)
+		names, err := queryStrings(ctx, pool, "SELECT name FROM pg_ls_dir($1) AS name ORDER BY name", path.Clean(dir))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s on the server: %w", dir, err)
+		}
+		matched := 0
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				files = append(files, path.Join(dir, name))
+				matched++
+			}
+		}
+		if matched == 0 {
+			return nil, fmt.Errorf("no files on the server match %s", f)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("-write-method=fdw needs -file")
+	}
+	return files, nil
+}
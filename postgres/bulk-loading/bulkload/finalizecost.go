@@ -0,0 +1,112 @@
+package bulkload
+
+// ============================================================================
+// FINALIZE COST (time and WAL per finalize step)
+// ============================================================================
+//
+// Loading UNLOGGED makes COPY fast because it writes no WAL, but the WAL
+// isn't avoided, it moves: SET LOGGED rewrites the table into WAL (unless
+// wal_level=minimal), and every index build logs its index. A load report
+// that only shows COPY throughput hides that bill. Finalize therefore
+// measures each step's duration and the WAL written while it ran
+// (pg_current_wal_lsn before and after; the LSN is cluster-wide, so other
+// writers on the server count too) and prints a summary. After -mode=all
+// the load report adds the end-to-end view: COPY alone against COPY plus
+// finalize, in time, WAL and rows/sec.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// stepCost is what one finalize step took.
+type stepCost struct {
+	key      string // In finalizeStepNames
+	name     string
+	duration time.Duration
+	wal      int64 // Bytes, -1 if unknown
+	failed   bool
+}
+
+// finalizeCosts are the steps of the last finalize, in order.
+var finalizeCosts []stepCost
+
+// walSince returns the WAL written since lsn, or -1.
+func walSince(ctx context.Context, pool *pgxpool.Pool, lsn string) int64 {
+	var n int64
+	if err := pool.QueryRow(ctx, "SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), $1)::bigint", lsn).Scan(&n); err != nil {
+		return -1
+	}
+	return n
+}
+
+// recordStep adds a finished finalize step and returns its WAL for the
+// step's progress line.
+func recordStep(ctx context.Context, pool *pgxpool.Pool, key, name, startLSN string, start time.Time, err error) string {
+	cost := stepCost{key: key, name: name, duration: time.Since(start), wal: -1, failed: err != nil}
+	if !cockroach() {
+		cost.wal = walSince(ctx, pool, startLSN)
+	}
+	logStep("finalize", key, cost.duration, err, "wal_bytes", cost.wal)
+	finalizeCosts = append(finalizeCosts, cost)
+	if cost.wal < 0 {
+		return ""
+	}
+	return ", " + formatBytes(cost.wal) + " WAL"
+}
+
+// printFinalizeCost prints the per-step summary at the end of finalize.
+func printFinalizeCost() {
+	if len(finalizeCosts) == 0 {
+		return
+	}
+	var total time.Duration
+	var wal int64
+	fmt.Println("\n   ⏱️  Finalize cost:")
+	for _, c := range finalizeCosts {
+		status := ""
+		if c.failed {
+			status = "   (failed)"
+		}
+		fmt.Printf("      %-45s %12v %12s%s\n", c.name, c.duration.Round(time.Millisecond), walText(c.wal), status)
+		total += c.duration
+		wal += max(c.wal, 0)
+	}
+	fmt.Printf("      %-45s %12v %12s\n", "Total", total.Round(time.Millisecond), walText(wal))
+}
+
+// printEndToEndCost adds load + finalize totals to the load report.
+func printEndToEndCost(m *LoadMetrics) {
+	phases.mu.Lock()
+	load := phases.finished["load"]
+	phases.mu.Unlock()
+	if len(finalizeCosts) == 0 || load == 0 {
+		return
+	}
+	var finalize time.Duration
+	var wal int64
+	for _, c := range finalizeCosts {
+		finalize += c.duration
+		wal += max(c.wal, 0)
+	}
+	for _, c := range finalizeCosts {
+		if c.key == "logged" && c.wal >= 0 {
+			fmt.Printf("SET LOGGED:           %v, %s WAL\n", c.duration.Round(time.Millisecond), formatBytes(c.wal))
+		}
+	}
+	fmt.Printf("Load only:            %v, %s WAL, %.0f rows/sec\n", load.Round(time.Millisecond), walText(m.WALBytes),
+		float64(m.SuccessRows)/load.Seconds())
+	fmt.Printf("Load + finalize:      %v, %s WAL, %.0f rows/sec end to end\n", (load + finalize).Round(time.Millisecond),
+		walText(max(m.WALBytes, 0)+wal), float64(m.SuccessRows)/(load+finalize).Seconds())
+}
+
+// walText formats a WAL byte count, -1 as unknown.
+func walText(n int64) string {
+	if n < 0 {
+		return "unknown"
+	}
+	return formatBytes(n)
+}
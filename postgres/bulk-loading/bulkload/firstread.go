@@ -0,0 +1,332 @@
+package bulkload
+
+// ============================================================================
+// FIRST READ AFTER LOAD (finalize, -first-read)
+// ============================================================================
+//
+// A freshly loaded row carries only its inserting transaction id. The first
+// reader has to look that transaction up in pg_xact and records the answer
+// in the tuple's hint bits, which dirties the page: the first scan after a
+// load writes about as much as it reads (and, with data checksums or
+// wal_log_hints, logs a full page image per page). VACUUM sets the hint
+// bits and the visibility map once, so later scans skip per-tuple checks
+// and index-only scans skip the heap. COPY ... FREEZE into a table created
+// in the same transaction writes the rows already frozen and all-visible,
+// so there is no first-read penalty at all.
+//
+// With -first-read finalize times the same probes at two points:
+//   - after load: before the first finalize step, i.e. what the first
+//     queries against the new table would pay
+//   - after VACUUM: after the finalize steps, when the vacuum step ran
+// The probes run under EXPLAIN (ANALYZE, BUFFERS) in their own transaction,
+// without parallel workers, in this order: an index-only scan and an index
+// scan over the first 100k primary key values, then a full scan, then the
+// full scan again (the steady state). Each one reports execution time,
+// shared blocks read, dirtied and written, heap fetches and the WAL written
+// while it ran (cluster-wide). The index probes need a primary key; they
+// are skipped on tables without one.
+//
+// -first-read-freeze adds a third pass: the table is copied with COPY
+// FREEZE into <table>_first_read (needs as much free space as the table),
+// given the same primary key, probed and dropped. The comparison is part
+// of the load report.
+//
+//   go run ./cmd/prod_loader -mode=all -first-read -first-read-freeze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// firstReadIndexRows is how many primary key values the index probes read.
+const firstReadIndexRows = 100000
+
+// readProbe is one timed read of the table.
+type readProbe struct {
+	name        string
+	duration    time.Duration // EXPLAIN ANALYZE execution time
+	read        int64         // Shared blocks
+	dirtied     int64
+	written     int64
+	heapFetches int64
+	wal         int64 // Bytes, -1 if unknown
+	err         error
+}
+
+// readPass is the probes at one point: after load, after VACUUM or after
+// COPY FREEZE.
+type readPass struct {
+	name     string
+	probes   []readProbe
+	copyTook time.Duration // COPY FREEZE only
+	skipped  string        // Why the pass didn't run
+}
+
+// firstReads is filled by finalize and printed by PrintReport.
+var firstReads []readPass
+
+// explainNode is the part of an EXPLAIN (FORMAT JSON) plan node the probes
+// look at.
+type explainNode struct {
+	SharedReadBlocks    int64         `json:"Shared Read Blocks"`
+	SharedDirtiedBlocks int64         `json:"Shared Dirtied Blocks"`
+	SharedWrittenBlocks int64         `json:"Shared Written Blocks"`
+	HeapFetches         int64         `json:"Heap Fetches"`
+	Plans               []explainNode `json:"Plans"`
+}
+
+// heapFetches sums the heap fetches of the index-only scans in the tree.
+func (n explainNode) heapFetches() int64 {
+	total := n.HeapFetches
+	for _, child := range n.Plans {
+		total += child.heapFetches()
+	}
+	return total
+}
+
+// primaryKeyColumn returns the first column of table's primary key, or ""
+// if it has none.
+func primaryKeyColumn(ctx context.Context, pool *pgxpool.Pool, table string) (string, error) {
+	var column string
+	err := pool.QueryRow(ctx, `
+		SELECT a.attname FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+		WHERE i.indrelid = $1::regclass AND i.indisprimary
+	`, table).Scan(&column)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return column, err
+}
+
+// measureFirstRead runs the probes against table and records them as a
+// pass named name.
+func measureFirstRead(ctx context.Context, pool *pgxpool.Pool, name, table string) readPass {
+	pass := readPass{name: name}
+	key, err := primaryKeyColumn(ctx, pool, table)
+	if err != nil {
+		pass.skipped = err.Error()
+		return pass
+	}
+
+	type probe struct {
+		name     string
+		sql      string
+		settings []string
+	}
+	var probes []probe
+	if key != "" {
+		// The LIMIT keeps the subquery from being flattened, so the index
+		// scan has to return whole rows from the heap.
+		probes = append(probes,
+			probe{
+				name:     "index-only scan",
+				sql:      fmt.Sprintf("SELECT count(*) FROM (SELECT %s FROM %s ORDER BY 1 LIMIT %d) s", key, table, firstReadIndexRows),
+				settings: []string{"enable_seqscan", "enable_bitmapscan"},
+			},
+			probe{
+				name:     "index scan",
+				sql:      fmt.Sprintf("SELECT count(*) FROM (SELECT * FROM %s ORDER BY %s LIMIT %d) s", table, key, firstReadIndexRows),
+				settings: []string{"enable_seqscan", "enable_bitmapscan", "enable_indexonlyscan"},
+			})
+	}
+	fullScan := fmt.Sprintf("SELECT count(*) FROM %s", table)
+	fullSettings := []string{"enable_indexscan", "enable_indexonlyscan", "enable_bitmapscan"}
+	probes = append(probes,
+		probe{name: "full scan", sql: fullScan, settings: fullSettings},
+		probe{name: "full scan again", sql: fullScan, settings: fullSettings})
+
+	fmt.Printf("\n   🧊 First read %s:\n", name)
+	for _, p := range probes {
+		r := runReadProbe(ctx, pool, p.name, p.sql, p.settings)
+		if r.err != nil {
+			fmt.Printf("      %-18s ⚠️  %v\n", r.name, r.err)
+		} else {
+			fmt.Printf("      %-18s %12v   %d read, %d dirtied, %d written blocks, %s WAL\n", r.name,
+				r.duration.Round(time.Millisecond), r.read, r.dirtied, r.written, walText(r.wal))
+		}
+		logStep("first-read", name+": "+r.name, r.duration, r.err, "read_blocks", r.read,
+			"dirtied_blocks", r.dirtied, "written_blocks", r.written, "heap_fetches", r.heapFetches, "wal_bytes", r.wal)
+		pass.probes = append(pass.probes, r)
+	}
+	return pass
+}
+
+// runReadProbe runs sql under EXPLAIN (ANALYZE, BUFFERS) with the given
+// planner settings off and without parallel workers.
+func runReadProbe(ctx context.Context, pool *pgxpool.Pool, name, sql string, off []string) readProbe {
+	r := readProbe{name: name, wal: -1}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer tx.Rollback(ctx)
+
+	settings := []string{"SET LOCAL max_parallel_workers_per_gather = 0"}
+	for _, setting := range off {
+		settings = append(settings, "SET LOCAL "+setting+" = off")
+	}
+	for _, set := range settings {
+		if _, err := tx.Exec(ctx, set); err != nil {
+			r.err = err
+			return r
+		}
+	}
+
+	startWAL := getCurrentWAL(ctx, pool)
+	var raw string
+	if err := tx.QueryRow(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+sql).Scan(&raw); err != nil {
+		r.err = err
+		return r
+	}
+	r.wal = walSince(ctx, pool, startWAL)
+
+	var plans []struct {
+		Plan          explainNode `json:"Plan"`
+		ExecutionTime float64     `json:"Execution Time"`
+	}
+	if err := json.Unmarshal([]byte(raw), &plans); err != nil || len(plans) == 0 {
+		r.err = fmt.Errorf("unreadable EXPLAIN output: %v", err)
+		return r
+	}
+	plan := plans[0]
+	r.duration = time.Duration(plan.ExecutionTime * float64(time.Millisecond))
+	r.read = plan.Plan.SharedReadBlocks
+	r.dirtied = plan.Plan.SharedDirtiedBlocks
+	r.written = plan.Plan.SharedWrittenBlocks
+	r.heapFetches = plan.Plan.heapFetches()
+	return r
+}
+
+// measureCopyFreeze copies the table with COPY FREEZE into a scratch table,
+// gives it the same primary key, probes it and drops it.
+func measureCopyFreeze(ctx context.Context, pool *pgxpool.Pool) readPass {
+	const name = "after COPY FREEZE"
+	scratch := config.TableName + "_first_read"
+	key, err := primaryKeyColumn(ctx, pool, config.TableName)
+	if err != nil {
+		return readPass{name: name, skipped: err.Error()}
+	}
+
+	fmt.Printf("\n   🧊 Copying %s into %s with COPY FREEZE...", config.TableName, scratch)
+	start := time.Now()
+	if err := copyFreeze(ctx, pool, scratch); err != nil {
+		fmt.Printf(" ⚠️  (error: %v)\n", err)
+		pool.Exec(ctx, "DROP TABLE IF EXISTS "+scratch)
+		return readPass{name: name, skipped: err.Error()}
+	}
+	took := time.Since(start)
+	fmt.Printf(" ✅ (took %v)\n", took.Round(time.Millisecond))
+	defer func() {
+		if _, err := pool.Exec(ctx, "DROP TABLE IF EXISTS "+scratch); err != nil {
+			fmt.Printf("   ⚠️  Failed to drop %s: %v\n", scratch, err)
+		}
+	}()
+
+	if key != "" {
+		// Frozen tuples carry their hint bits, so the index build leaves
+		// the heap as COPY FREEZE wrote it.
+		if _, err := pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", scratch, key)); err != nil {
+			return readPass{name: name, skipped: err.Error()}
+		}
+	}
+	pass := measureFirstRead(ctx, pool, name, scratch)
+	pass.copyTook = took
+	return pass
+}
+
+// copyFreeze streams the table out of one session and into scratch on
+// another, where scratch is created in the COPY's transaction as FREEZE
+// requires.
+func copyFreeze(ctx context.Context, pool *pgxpool.Pool, scratch string) error {
+	src, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Release()
+	dst, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer dst.Release()
+
+	tx, err := dst.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (LIKE %s)", scratch, config.TableName)); err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := src.Conn().PgConn().CopyTo(ctx, pw, fmt.Sprintf("COPY %s TO STDOUT (FORMAT binary)", config.TableName))
+		pw.CloseWithError(err)
+	}()
+	_, err = tx.Conn().PgConn().CopyFrom(ctx, pr, fmt.Sprintf("COPY %s FROM STDIN (FORMAT binary, FREEZE)", scratch))
+	pr.CloseWithError(err) // Unblocks the reader side if the COPY failed early
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// printFirstReadReport adds the first-read comparison to the load report.
+func printFirstReadReport() {
+	if len(firstReads) == 0 {
+		return
+	}
+	fmt.Println("\n🧊 First Read After Load:")
+	fmt.Printf("  %-18s %-18s %12s %10s %10s %10s %10s %12s\n", "Pass", "Probe", "Time", "Read", "Dirtied", "Written", "Heap fetch", "WAL")
+	for _, pass := range firstReads {
+		if pass.skipped != "" {
+			fmt.Printf("  %-18s (skipped: %s)\n", pass.name, pass.skipped)
+			continue
+		}
+		for _, p := range pass.probes {
+			if p.err != nil {
+				fmt.Printf("  %-18s %-18s (failed: %v)\n", pass.name, p.name, p.err)
+				continue
+			}
+			fmt.Printf("  %-18s %-18s %12v %10d %10d %10d %10d %12s\n", pass.name, p.name, p.duration.Round(time.Millisecond),
+				p.read, p.dirtied, p.written, p.heapFetches, walText(p.wal))
+		}
+		if pass.copyTook > 0 {
+			fmt.Printf("  %-18s %-18s %12v\n", pass.name, "(COPY FREEZE)", pass.copyTook.Round(time.Millisecond))
+		}
+	}
+
+	// The headline: the first full scan after load against the others.
+	first := firstReadProbe(firstReads[0], "full scan")
+	if first == nil || first.duration == 0 {
+		return
+	}
+	if again := firstReadProbe(firstReads[0], "full scan again"); again != nil && again.duration > 0 {
+		fmt.Printf("  First full scan after load: %v, %.1fx the second one (%d pages dirtied by hint bits)\n",
+			first.duration.Round(time.Millisecond), first.duration.Seconds()/again.duration.Seconds(), first.dirtied)
+	}
+	for _, pass := range firstReads[1:] {
+		if p := firstReadProbe(pass, "full scan"); p != nil && p.duration > 0 {
+			fmt.Printf("  First full scan %-18s %v (%.1fx faster than after load)\n", pass.name+":",
+				p.duration.Round(time.Millisecond), first.duration.Seconds()/p.duration.Seconds())
+		}
+	}
+}
+
+// firstReadProbe returns the named probe of pass, if it ran.
+func firstReadProbe(pass readPass, name string) *readProbe {
+	for i := range pass.probes {
+		if pass.probes[i].name == name && pass.probes[i].err == nil {
+			return &pass.probes[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package bulkload
+
+// ============================================================================
+// PARALLEL INDEX REBUILD (finalize, -index-parallelism)
+// ============================================================================
+//
+// CREATE INDEX CONCURRENTLY can't run inside a multi-statement string, and
+// one connection builds one index at a time. Finalize builds every index on
+// its own connection, -index-parallelism at a time, each session with
+// -index-mem of maintenance_work_mem (so the peak is parallelism × mem).
+// Afterwards pg_index is checked: a failed CONCURRENTLY build leaves an
+// INVALID index behind that still slows every write, so finalize fails
+// until it is dropped and rebuilt. Rerunning finalize does exactly that:
+// valid indexes are kept, invalid ones are dropped and built again.
+//
+// Each build's time and size go into LoadMetrics, and after -mode=all the
+// load report lists them next to the total finalize time: on a big table
+// the index builds can take longer than the COPY did.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// indexDef is one secondary index restored by finalize.
+type indexDef struct {
+	name string
+	def  string // Everything after "ON <table>"
+}
+
+var financialIndexes = []indexDef{
+	{"idx_txn_date", "(transaction_date)"},
+	{"idx_txn_status", "(transaction_status)"},
+	{"idx_txn_customer", "(customer_id)"},
+	{"idx_txn_account", "(account_id)"},
+	{"idx_txn_external_id", "(external_txn_id)"},
+	{"idx_txn_created_at", "(created_at)"},
+	{"idx_txn_amount", "(amount) WHERE amount > 10000"},
+	{"idx_txn_metadata", "USING GIN(metadata)"},
+	{"idx_txn_tags", "USING GIN(tags)"},
+	{"idx_txn_active", "(transaction_id) WHERE is_deleted = FALSE"},
+}
+
+// indexBuild is the outcome of one index, for the summary.
+type indexBuild struct {
+	name     string
+	duration time.Duration
+	size     int64 // Bytes
+	err      error
+	skipped  bool
+}
+
+func rebuildIndexes(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	parallelism := max(1, min(config.IndexParallelism, len(financialIndexes), int(pool.Config().MaxConns)-1))
+	fmt.Printf("\n      Building %d indexes, %d at a time (maintenance_work_mem %s each)\n",
+		len(financialIndexes), parallelism, config.IndexMem)
+
+	results := make([]indexBuild, len(financialIndexes))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, idx := range financialIndexes {
+		wg.Add(1)
+		go func(i int, idx indexDef) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = buildIndex(ctx, pool, idx)
+		}(i, idx)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].duration > results[j].duration })
+	var failed []string
+	for _, r := range results {
+		switch {
+		case r.skipped:
+			fmt.Printf("      ⏭️  %-22s already exists\n", r.name)
+			continue
+		case r.err != nil:
+			fmt.Printf("      ❌ %-22s failed after %v: %v\n", r.name, r.duration.Round(time.Millisecond), r.err)
+			failed = append(failed, r.name)
+		default:
+			fmt.Printf("      ✅ %-22s %10v  %s\n", r.name, r.duration.Round(time.Millisecond), formatBytes(r.size))
+		}
+		logStep("finalize", "index", r.duration, r.err, "index", r.name, "size_bytes", r.size)
+		metrics.mu.Lock()
+		metrics.IndexBuilds = append(metrics.IndexBuilds, IndexMetrics{
+			Name:       r.name,
+			Duration:   r.duration,
+			SizeBytes:  r.size,
+			Concurrent: true,
+			Failed:     r.err != nil,
+		})
+		metrics.mu.Unlock()
+	}
+
+	invalid, err := invalidIndexes(ctx, pool)
+	if err != nil {
+		return err
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("INVALID indexes on %s: %s (rerun -mode=finalize to rebuild them)",
+			config.TableName, strings.Join(invalid, ", "))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("index builds failed: %s", strings.Join(failed, ", "))
+	}
+	fmt.Println("      ✅ No INVALID indexes")
+	return nil
+}
+
+// buildIndex builds one index on its own connection, replacing an INVALID
+// leftover from an earlier attempt.
+func buildIndex(ctx context.Context, pool *pgxpool.Pool, idx indexDef) indexBuild {
+	r := indexBuild{name: idx.name}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer conn.Release()
+
+	var valid *bool
+	err = conn.QueryRow(ctx, `
+		SELECT i.indisvalid FROM pg_index i
+		WHERE i.indexrelid = to_regclass($1) AND i.indrelid = $2::regclass
+	`, idx.name, config.TableName).Scan(&valid)
+	switch {
+	case err == nil && valid != nil && *valid:
+		r.skipped = true
+		return r
+	case err == nil:
+		if _, err := conn.Exec(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+idx.name); err != nil {
+			r.err = fmt.Errorf("dropping INVALID index: %w", err)
+			return r
+		}
+	}
+
+	// A transaction pooler would apply the setting to some other backend.
+	if !pooledDDL() {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET maintenance_work_mem = '%s'", config.IndexMem)); err != nil {
+			r.err = err
+			return r
+		}
+		// The pool is shared with other builds; don't hand the setting on.
+		defer conn.Exec(context.Background(), "RESET maintenance_work_mem")
+	}
+
+	start := time.Now()
+	_, r.err = conn.Exec(ctx, fmt.Sprintf("CREATE INDEX CONCURRENTLY %s ON %s %s", idx.name, config.TableName, idx.def))
+	r.duration = time.Since(start)
+	if r.err == nil {
+		conn.QueryRow(ctx, "SELECT pg_relation_size($1::regclass)", idx.name).Scan(&r.size)
+	}
+	return r
+}
+
+// printIndexReport adds the index builds of finalize to the load report.
+func printIndexReport(m *LoadMetrics) {
+	if m.FinalizeDuration == 0 {
+		return
+	}
+	fmt.Printf("Finalize:             %v\n", m.FinalizeDuration.Round(time.Millisecond))
+	if len(m.IndexBuilds) == 0 {
+		return
+	}
+	var total time.Duration
+	var size int64
+	fmt.Println("\n🏗️  Index Builds:")
+	for _, b := range m.IndexBuilds {
+		how := "CONCURRENTLY"
+		if !b.Concurrent {
+			how = "blocking"
+		}
+		if b.Failed {
+			how += ", failed"
+		}
+		fmt.Printf("  %-24s %12v %12s   %s\n", b.Name, b.Duration.Round(time.Millisecond), formatBytes(b.SizeBytes), how)
+		total += b.Duration
+		size += b.SizeBytes
+	}
+	fmt.Printf("  %-24s %12v %12s   (summed; builds overlap with -index-parallelism)\n", "Total",
+		total.Round(time.Millisecond), formatBytes(size))
+}
+
+// invalidIndexes lists indexes on the target left INVALID by failed builds.
+func invalidIndexes(ctx context.Context, pool *pgxpool.Pool) ([]string, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT indexrelid::regclass::text FROM pg_index
+		WHERE indrelid = $1::regclass AND NOT indisvalid
+		ORDER BY 1
+	`, config.TableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for invalid indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
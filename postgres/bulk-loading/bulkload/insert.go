@@ -0,0 +1,110 @@
+package bulkload
+
+// ============================================================================
+// INSERT FALLBACK (-write-method=insert)
+// ============================================================================
+//
+// Some managed proxies and pooler setups break the COPY sub-protocol. With
+// -write-method=insert every batch that would be COPYed is written as
+// multi-row INSERT statements instead, pipelined through a pgx.Batch:
+//   -insert-batch  rows per INSERT statement (capped so a statement stays
+//                  under PostgreSQL's 65535 bind parameters)
+//   -commit-rows   rows per transaction; 0 commits once per -batch-size
+//                  batch, like COPY
+// Sources, checkpoints, bad-row bisection, throttles and metrics work the
+// same; generated loads are cut into -batch-size batches. Expect a
+// fraction of COPY throughput: every value is a bind parameter and every
+// statement is planned. It is also the write path for -backend=cockroach,
+// where a commit group is retried on transaction retry errors.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// writeRows loads rows with the configured write method.
+func writeRows(ctx context.Context, db copyTarget, table string, columns []string, rows [][]interface{}) (int64, error) {
+	if config.WriteMethod == "insert" {
+		return insertRows(ctx, db, table, columns, rows)
+	}
+	return db.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+}
+
+// insertRows writes rows as multi-row INSERTs, one pipelined batch per
+// commit group. On a connection each group is its own implicit
+// transaction; inside a transaction (checkpoints, bisection savepoints)
+// they all belong to it.
+func insertRows(ctx context.Context, db copyTarget, table string, columns []string, rows [][]interface{}) (int64, error) {
+	perStatement := max(1, min(config.InsertBatch, 65535/len(columns)))
+	perCommit := len(rows)
+	if config.CommitRows > 0 {
+		perCommit = config.CommitRows
+	}
+
+	var total int64
+	for len(rows) > 0 {
+		group := rows[:min(perCommit, len(rows))]
+		rows = rows[len(group):]
+
+		batch := &pgx.Batch{}
+		for len(group) > 0 {
+			chunk := group[:min(perStatement, len(group))]
+			group = group[len(chunk):]
+			args := make([]interface{}, 0, len(chunk)*len(columns))
+			for _, row := range chunk {
+				args = append(args, row...)
+			}
+			batch.Queue(insertSQL(table, columns, len(chunk)), args...)
+		}
+
+		var n int64
+		err := retryTxn(ctx, db, func() error {
+			n = 0
+			results := db.SendBatch(ctx, batch)
+			for i := 0; i < batch.Len(); i++ {
+				tag, err := results.Exec()
+				if err != nil {
+					results.Close()
+					return err
+				}
+				n += tag.RowsAffected()
+			}
+			return results.Close()
+		})
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// insertSQL is INSERT INTO table (columns) VALUES ($1, ...), ... for rows rows.
+func insertSQL(table string, columns []string, rows int) string {
+	var b strings.Builder
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+	}
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", pgx.Identifier{table}.Sanitize(), strings.Join(quoted, ", "))
+
+	param := 1
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for c := range columns {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", param)
+			param++
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
@@ -0,0 +1,852 @@
+package bulkload
+
+// ============================================================================
+// GENERIC TABLES (-source=introspect)
+// ============================================================================
+//
+// transactionGenerator only knows financial_transactions. With
+// -source=introspect the loader reads the target table from pg_catalog and
+// information_schema and derives a generator per column:
+//   - type: integers, numeric/real/double, boolean, text/varchar/char,
+//     uuid, date, timestamp(tz), time, interval, json/jsonb, bytea,
+//     inet/cidr, enums, and arrays of text or integers
+//   - length and precision: varchar(n)/char(n) limits, numeric(p,s) range
+//     and scale
+//   - NOT NULL: nullable columns get NULL in 5% of rows
+//   - single-column CHECK constraints: comparisons with literals, BETWEEN,
+//     IN lists and length limits (domain CHECKs included)
+//   - PRIMARY KEY / UNIQUE: one column per key gets unique values (integers
+//     continue above the current max, text gets a per-run prefix)
+//   - FOREIGN KEY: values are sampled from the referenced table
+// Identity, serial and generated columns are left to the server; other
+// columns with defaults are generated so the data isn't flat.
+//
+// CHECKs the parser doesn't understand are reported before the load; add
+// -log-bad-rows to quarantine rows they reject rather than abort. -seed,
+// -as-of, -faker (by column name) and -columns apply; -data-profile doesn't.
+//
+//   go run ./cmd/prod_loader -mode=load -source=introspect -table=orders -rows=5000000
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// introspectNullFraction is the share of NULLs in nullable columns.
+const introspectNullFraction = 0.05
+
+// fkSampleSize caps the referenced keys read per foreign key.
+const fkSampleSize = 100_000
+
+// columnGen generates one column of an introspected table.
+type columnGen struct {
+	name      string
+	typ       string // Base type as regtype text; element type for arrays
+	array     bool
+	notNull   bool
+	unique    bool
+	maxLen    int // 0: unlimited
+	minLen    int
+	precision int
+	scale     int
+	domain    uint32 // Domain type, for its CHECKs
+
+	values      []interface{} // Enum labels or CHECK IN list
+	lo, hi      *checkBound
+	fk          *fkSample
+	fkPos       int
+	uniqueBase  int64
+	from, to    time.Time // date/timestamp window
+	unsupported bool      // Always NULL
+}
+
+// checkBound is one side of a CHECK range.
+type checkBound struct {
+	value     string
+	inclusive bool
+}
+
+// fkSample holds referenced keys; each row picks one tuple for all of the
+// key's columns.
+type fkSample struct {
+	ref     string
+	columns []string
+	rows    [][]interface{}
+	pick    int
+}
+
+// introspectSource generates config.TotalRows rows for config.TableName.
+type introspectSource struct {
+	columns []string
+	gens    []*columnGen
+	fks     []*fkSample
+	row     int64
+	total   int64
+	runID   string
+
+	src  *rowSource
+	rng  *rand.Rand
+	fake *gofakeit.Faker
+}
+
+func openIntrospectSource(ctx context.Context, pool *pgxpool.Pool, columns []string) (*introspectSource, error) {
+	gens, err := introspectColumns(ctx, pool, config.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) > 0 {
+		byName := make(map[string]*columnGen, len(gens))
+		for _, c := range gens {
+			byName[c.name] = c
+		}
+		gens = gens[:0]
+		for _, name := range columns {
+			c, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("column %q of %s is missing or filled by the server", name, config.TableName)
+			}
+			gens = append(gens, c)
+		}
+	}
+	if len(gens) == 0 {
+		return nil, fmt.Errorf("%s has no columns to generate", config.TableName)
+	}
+
+	s := &introspectSource{gens: gens, total: config.TotalRows}
+	s.src = &rowSource{state: uint64(rand.Int63())}
+	if config.Seed != 0 {
+		s.src.seek(config.Seed, -1)
+	}
+	s.rng = rand.New(s.src)
+	s.fake = gofakeit.NewFaker(s.src, false)
+	s.runID = strconv.FormatInt(s.rng.Int63n(36*36*36*36), 36)
+
+	if err := s.applyConstraints(ctx, pool); err != nil {
+		return nil, err
+	}
+	for _, c := range gens {
+		if err := c.prepare(ctx, pool, s.total); err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.name, err)
+		}
+		s.columns = append(s.columns, c.name)
+	}
+	s.printPlan()
+	return s, nil
+}
+
+// introspectColumns reads the generatable columns of table in attnum order.
+func introspectColumns(ctx context.Context, pool *pgxpool.Pool, table string) ([]*columnGen, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT a.attname,
+		       (CASE WHEN bt.typcategory = 'A' THEN bt.typelem ELSE bt.oid END)::regtype::text,
+		       bt.typcategory = 'A',
+		       a.attnotnull OR t.typnotnull,
+		       a.attidentity <> '' OR a.attgenerated <> ''
+		           OR coalesce(pg_get_expr(d.adbin, d.adrelid) LIKE 'nextval(%', false),
+		       coalesce(ic.character_maximum_length, 0)::int,
+		       coalesce(ic.numeric_precision, 0)::int,
+		       coalesce(ic.numeric_scale, 0)::int,
+		       ARRAY(SELECT e.enumlabel::text FROM pg_enum e
+		             WHERE e.enumtypid = CASE WHEN bt.typcategory = 'A' THEN bt.typelem ELSE bt.oid END
+		             ORDER BY e.enumsortorder),
+		       CASE WHEN t.typtype = 'd' THEN t.oid ELSE 0::oid END
+		FROM pg_attribute a
+		JOIN pg_class c ON c.oid = a.attrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_type t ON t.oid = a.atttypid
+		JOIN pg_type bt ON bt.oid = CASE WHEN t.typtype = 'd' THEN t.typbasetype ELSE t.oid END
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		LEFT JOIN information_schema.columns ic
+		       ON ic.table_schema = n.nspname AND ic.table_name = c.relname AND ic.column_name = a.attname
+		WHERE a.attrelid = $1::regclass
+		  AND a.attnum > 0
+		  AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var gens []*columnGen
+	for rows.Next() {
+		c := &columnGen{}
+		var skip bool
+		var labels []string
+		if err := rows.Scan(&c.name, &c.typ, &c.array, &c.notNull, &skip,
+			&c.maxLen, &c.precision, &c.scale, &labels, &c.domain); err != nil {
+			return nil, err
+		}
+		if skip {
+			continue
+		}
+		for _, l := range labels {
+			c.values = append(c.values, l)
+		}
+		gens = append(gens, c)
+	}
+	return gens, rows.Err()
+}
+
+// applyConstraints folds keys, foreign keys and CHECKs into the generators.
+func (s *introspectSource) applyConstraints(ctx context.Context, pool *pgxpool.Pool) error {
+	byName := make(map[string]*columnGen, len(s.gens))
+	for _, c := range s.gens {
+		byName[c.name] = c
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT c.contype::text, pg_get_constraintdef(c.oid),
+		       ARRAY(SELECT a.attname::text FROM unnest(c.conkey) WITH ORDINALITY k(num, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.num ORDER BY k.ord),
+		       CASE WHEN c.contype = 'f' THEN c.confrelid::regclass::text ELSE '' END,
+		       ARRAY(SELECT a.attname::text FROM unnest(c.confkey) WITH ORDINALITY k(num, ord)
+		             JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.num ORDER BY k.ord)
+		FROM pg_constraint c
+		WHERE c.conrelid = $1::regclass AND c.contype IN ('p', 'u', 'f', 'c')
+		UNION ALL
+		SELECT 'u', '',
+		       ARRAY(SELECT a.attname::text FROM unnest(i.indkey::int2[]) WITH ORDINALITY k(num, ord)
+		             JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.num ORDER BY k.ord),
+		       '', '{}'
+		FROM pg_index i
+		WHERE i.indrelid = $1::regclass AND i.indisunique
+		  AND i.indexprs IS NULL AND i.indpred IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conindid = i.indexrelid)
+		ORDER BY 1 DESC
+	`, config.TableName)
+	if err != nil {
+		return fmt.Errorf("failed to read constraints of %s: %w", config.TableName, err)
+	}
+	type constraint struct {
+		kind, def, ref string
+		cols, refCols  []string
+	}
+	var cons []constraint
+	for rows.Next() {
+		var k constraint
+		if err := rows.Scan(&k.kind, &k.def, &k.cols, &k.ref, &k.refCols); err != nil {
+			rows.Close()
+			return err
+		}
+		cons = append(cons, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Domain CHECKs read like column CHECKs on VALUE.
+	for _, c := range s.gens {
+		if c.domain == 0 {
+			continue
+		}
+		rows, err := pool.Query(ctx, `
+			SELECT pg_get_constraintdef(oid) FROM pg_constraint WHERE contypid = $1 AND contype = 'c'
+		`, c.domain)
+		if err != nil {
+			return fmt.Errorf("failed to read domain checks of %s: %w", c.name, err)
+		}
+		for rows.Next() {
+			var def string
+			if err := rows.Scan(&def); err != nil {
+				rows.Close()
+				return err
+			}
+			if !c.parseCheck(def, "VALUE") {
+				fmt.Printf("⚠️  Domain CHECK on %s not understood, rows may be rejected: %s\n", c.name, def)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	// Foreign keys and CHECKs first, so keys pick a column that's still free.
+	for _, k := range cons {
+		switch k.kind {
+		case "f":
+			if err := s.sampleForeignKey(ctx, pool, k.ref, k.cols, k.refCols, byName); err != nil {
+				return err
+			}
+		case "c":
+			c := byName[k.cols[0]]
+			if len(k.cols) != 1 || c == nil || !c.parseCheck(k.def, c.name) {
+				fmt.Printf("⚠️  CHECK not understood, rows may be rejected: %s\n", k.def)
+			}
+		}
+	}
+	for _, k := range cons {
+		if k.kind != "p" && k.kind != "u" {
+			continue
+		}
+		var pick *columnGen
+		satisfied := false
+		for _, name := range k.cols {
+			c := byName[name]
+			if c == nil || c.unique {
+				satisfied = true // Filled by the server, or already unique
+				break
+			}
+			if pick == nil && c.canBeUnique() {
+				pick = c
+			}
+		}
+		switch {
+		case satisfied:
+		case pick != nil:
+			pick.unique = true
+		default:
+			fmt.Printf("⚠️  No column of key (%s) can be made unique, rows may collide\n", strings.Join(k.cols, ", "))
+		}
+	}
+	return nil
+}
+
+// sampleForeignKey reads up to fkSampleSize keys from the referenced table.
+func (s *introspectSource) sampleForeignKey(ctx context.Context, pool *pgxpool.Pool, ref string, cols, refCols []string, byName map[string]*columnGen) error {
+	fk := &fkSample{ref: ref, columns: refCols}
+	var where []string
+	quoted := make([]string, len(refCols))
+	for i, col := range refCols {
+		quoted[i] = pgx.Identifier{col}.Sanitize()
+		where = append(where, quoted[i]+" IS NOT NULL")
+	}
+	rows, err := pool.Query(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE %s LIMIT %d",
+		strings.Join(quoted, ", "), ref, strings.Join(where, " AND "), fkSampleSize))
+	if err != nil {
+		return fmt.Errorf("failed to sample %s for foreign key: %w", ref, err)
+	}
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		fk.rows = append(fk.rows, values)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, name := range cols {
+		c := byName[name]
+		if c == nil {
+			continue
+		}
+		if len(fk.rows) == 0 && c.notNull {
+			return fmt.Errorf("%s references %s, which is empty: load it first", name, ref)
+		}
+		c.fk, c.fkPos = fk, i
+	}
+	s.fks = append(s.fks, fk)
+	return nil
+}
+
+var (
+	checkOp      = `(>=|<=|<>|>|<|=)`
+	checkLiteral = `\(*('(?:[^']|'')*'|-?\d+(?:\.\d+)?)\)*(?:::[a-z][a-z0-9_ ]*(?:\[\])?)?\)*`
+	checkCast    = `(?:::[a-z][a-z0-9_ ]*(?:\[\])?)?`
+	checkElement = regexp.MustCompile(`'(?:[^']|'')*'|-?\d+(?:\.\d+)?`)
+	checkNoise   = regexp.MustCompile(`CHECK|NOT VALID|\bAND\b|[()\s]`)
+)
+
+// parseCheck applies a CHECK whose column is referenced as ref and reports
+// whether every part of it was understood.
+func (c *columnGen) parseCheck(def, ref string) bool {
+	if strings.Contains(def, " OR ") {
+		return false // Bounds from one branch would be wrong
+	}
+	col := `\(*(?:` + regexp.QuoteMeta(ref) + `\b|"` + regexp.QuoteMeta(strings.ReplaceAll(ref, `"`, `""`)) + `")\)*` + checkCast
+	patterns := []struct {
+		re    *regexp.Regexp
+		apply func(m []string)
+	}{
+		{regexp.MustCompile(col + `\s*=\s*ANY\s*\(\(*ARRAY\[([^\]]*)\]\)*` + checkCast + `\)`), func(m []string) {
+			c.values = nil
+			for _, e := range checkElement.FindAllString(m[1], -1) {
+				if v, err := coerceValue(unquoteLiteral(e), c.typ); err == nil {
+					c.values = append(c.values, v)
+				}
+			}
+		}},
+		{regexp.MustCompile(`(?:length|char_length|character_length)\(` + col + `\)\s*` + checkOp + `\s*` + checkLiteral), func(m []string) {
+			n, _ := strconv.Atoi(unquoteLiteral(m[2]))
+			switch m[1] {
+			case "<=":
+				c.maxLen = n
+			case "<":
+				c.maxLen = n - 1
+			case ">=":
+				c.minLen = n
+			case ">":
+				c.minLen = n + 1
+			case "=":
+				c.minLen, c.maxLen = n, n
+			}
+		}},
+		{regexp.MustCompile(col + `\s*` + checkOp + `\s*` + checkLiteral), func(m []string) {
+			c.bound(m[1], unquoteLiteral(m[2]))
+		}},
+		{regexp.MustCompile(checkLiteral + `\s*` + checkOp + `\s*` + col), func(m []string) {
+			mirror := map[string]string{">=": "<=", "<=": ">=", ">": "<", "<": ">", "=": "=", "<>": "<>"}
+			c.bound(mirror[m[2]], unquoteLiteral(m[1]))
+		}},
+		{regexp.MustCompile(col + `\s+IS NOT NULL`), func([]string) { c.notNull = true }},
+	}
+
+	rest := def
+	for _, p := range patterns {
+		rest = p.re.ReplaceAllStringFunc(rest, func(match string) string {
+			p.apply(p.re.FindStringSubmatch(match))
+			return ""
+		})
+	}
+	return checkNoise.ReplaceAllString(rest, "") == ""
+}
+
+// bound records "column op value" from a CHECK.
+func (c *columnGen) bound(op, value string) {
+	switch op {
+	case ">=", ">":
+		c.lo = &checkBound{value: value, inclusive: op == ">="}
+	case "<=", "<":
+		c.hi = &checkBound{value: value, inclusive: op == "<="}
+	case "=":
+		c.values = nil
+		if v, err := coerceValue(value, c.typ); err == nil {
+			c.values = []interface{}{v}
+		}
+	}
+}
+
+func unquoteLiteral(s string) string {
+	if strings.HasPrefix(s, "'") {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+func (c *columnGen) isInt() bool {
+	return c.typ == "smallint" || c.typ == "integer" || c.typ == "bigint"
+}
+
+func (c *columnGen) isText() bool {
+	switch c.typ {
+	case "text", "character varying", "character", "name", "citext":
+		return true
+	}
+	return false
+}
+
+func (c *columnGen) canBeUnique() bool {
+	if c.array || c.fk != nil || len(c.values) > 0 {
+		return false
+	}
+	return c.isInt() || c.typ == "numeric" || c.isText() || c.typ == "uuid"
+}
+
+// rangeSpan is the width of generated numeric ranges that CHECKs leave open.
+const rangeSpan = 1_000_000
+
+// intLimit is the largest integer the column stores.
+func (c *columnGen) intLimit() int64 {
+	switch c.typ {
+	case "smallint":
+		return math.MaxInt16
+	case "integer":
+		return math.MaxInt32
+	case "numeric":
+		if c.precision > 0 && c.precision-c.scale < 18 {
+			return int64(math.Pow10(c.precision-c.scale)) - 1
+		}
+	}
+	return math.MaxInt64
+}
+
+// intRange is the column's integer range after CHECKs.
+func (c *columnGen) intRange() (int64, int64) {
+	limit := c.intLimit()
+	lo, hi := int64(1), min(limit, rangeSpan)
+	if c.lo != nil {
+		if v, err := strconv.ParseFloat(c.lo.value, 64); err == nil {
+			lo = int64(math.Ceil(v))
+			if !c.lo.inclusive && float64(lo) == v {
+				lo++
+			}
+			hi = limit
+			if limit-lo > rangeSpan {
+				hi = lo + rangeSpan
+			}
+		}
+	}
+	if c.hi != nil {
+		if v, err := strconv.ParseFloat(c.hi.value, 64); err == nil {
+			hi = int64(math.Floor(v))
+			if !c.hi.inclusive && float64(hi) == v {
+				hi--
+			}
+			if c.lo == nil && hi < lo {
+				lo = hi - rangeSpan
+			}
+		}
+	}
+	return lo, hi
+}
+
+// digits is the number of decimals generated for the column.
+func (c *columnGen) digits() int {
+	if c.typ == "numeric" && c.precision > 0 {
+		return c.scale
+	}
+	if c.typ == "numeric" {
+		return 2
+	}
+	return 6
+}
+
+func (c *columnGen) floatRange() (float64, float64) {
+	step := math.Pow10(-c.digits())
+	limit := math.MaxFloat64
+	if c.typ == "numeric" && c.precision > 0 {
+		limit = math.Pow10(c.precision-c.scale) - step
+	}
+	lo, hi := 0.0, min(limit, rangeSpan)
+	if c.lo != nil {
+		if v, err := strconv.ParseFloat(c.lo.value, 64); err == nil {
+			lo = v
+			if !c.lo.inclusive {
+				lo += step
+			}
+			hi = min(limit, lo+rangeSpan)
+		}
+	}
+	if c.hi != nil {
+		if v, err := strconv.ParseFloat(c.hi.value, 64); err == nil {
+			hi = v
+			if !c.hi.inclusive {
+				hi -= step
+			}
+			if c.lo == nil && hi < lo {
+				lo = hi - rangeSpan
+			}
+		}
+	}
+	return lo, hi
+}
+
+// prepare resolves ranges and unique starting points before the load.
+func (c *columnGen) prepare(ctx context.Context, pool *pgxpool.Pool, total int64) error {
+	switch {
+	case c.fk != nil || len(c.values) > 0:
+	case c.isInt(), c.typ == "numeric", c.typ == "real", c.typ == "double precision":
+		if !c.unique {
+			break
+		}
+		lo, hi := c.intRange()
+		var maxExisting float64
+		err := pool.QueryRow(ctx, fmt.Sprintf("SELECT coalesce(max(%s), 0)::float8 FROM %s",
+			pgx.Identifier{c.name}.Sanitize(), config.TableName)).Scan(&maxExisting)
+		if err != nil {
+			return err
+		}
+		c.uniqueBase = max(lo, int64(maxExisting)+1)
+		if c.uniqueBase+total-1 > hi {
+			return fmt.Errorf("no room for %d unique values between %d and %d", total, c.uniqueBase, hi)
+		}
+	case c.isText():
+		if c.unique && c.maxLen > 0 && c.maxLen < 5+len(strconv.FormatInt(total, 36)) {
+			return fmt.Errorf("varchar(%d) is too short for %d unique values", c.maxLen, total)
+		}
+	case c.typ == "date", strings.HasPrefix(c.typ, "timestamp"):
+		c.from, c.to = generatedWindow()
+		unit := time.Second
+		if c.typ == "date" {
+			unit = 24 * time.Hour
+		}
+		if c.lo != nil {
+			if t, ok := parseTime(c.lo.value); ok {
+				if !c.lo.inclusive {
+					t = t.Add(unit)
+				}
+				if t.After(c.from) {
+					c.from = t
+				}
+				if !c.to.After(c.from) {
+					c.to = c.from.AddDate(0, 0, generatedDays)
+				}
+			}
+		}
+		if c.hi != nil {
+			if t, ok := parseTime(c.hi.value); ok {
+				if c.hi.inclusive {
+					t = t.Add(unit)
+				}
+				if t.Before(c.to) {
+					c.to = t
+				}
+				if !c.to.After(c.from) {
+					c.from = c.to.AddDate(0, 0, -generatedDays)
+				}
+			}
+		}
+	case c.typ == "boolean", c.typ == "uuid", c.typ == "time without time zone", c.typ == "interval",
+		c.typ == "json", c.typ == "jsonb", c.typ == "bytea", c.typ == "inet", c.typ == "cidr":
+	default:
+		if c.notNull {
+			return fmt.Errorf("no generator for type %s", c.typ)
+		}
+		c.unsupported = true
+	}
+	if c.array && !c.isText() && !c.isInt() && len(c.values) == 0 {
+		if c.notNull {
+			return fmt.Errorf("no generator for %s[] columns", c.typ)
+		}
+		c.unsupported = true
+	}
+	return nil
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// describe is the plan line for the column.
+func (c *columnGen) describe() string {
+	typ := c.typ
+	if c.array {
+		typ += "[]"
+	}
+	var d string
+	switch {
+	case c.unsupported:
+		d = "NULL (unsupported type)"
+	case c.fk != nil:
+		d = fmt.Sprintf("sampled from %s(%s), %d keys", c.fk.ref, strings.Join(c.fk.columns, ", "), len(c.fk.rows))
+	case len(c.values) > 0:
+		d = fmt.Sprintf("one of %d values", len(c.values))
+	case c.unique && (c.isText() || c.typ == "uuid"):
+		d = "unique"
+	case c.unique:
+		d = fmt.Sprintf("unique from %d", c.uniqueBase)
+	case c.isInt():
+		lo, hi := c.intRange()
+		d = fmt.Sprintf("%d..%d", lo, hi)
+	case c.typ == "numeric" || c.typ == "real" || c.typ == "double precision":
+		lo, hi := c.floatRange()
+		d = fmt.Sprintf("%g..%g", lo, hi)
+	case c.isText():
+		d = fmt.Sprintf("length %d..%d", max(c.minLen, 1), c.textMax())
+	case !c.from.IsZero():
+		d = fmt.Sprintf("%s..%s", c.from.Format("2006-01-02"), c.to.Format("2006-01-02"))
+	default:
+		d = "random"
+	}
+	if !c.notNull && !c.unsupported {
+		d += fmt.Sprintf(", %.0f%% NULL", introspectNullFraction*100)
+	}
+	return fmt.Sprintf("%-28s %-28s %s", c.name, typ, d)
+}
+
+func (s *introspectSource) printPlan() {
+	fmt.Printf("🔎 Introspected %s: generating %d columns\n", config.TableName, len(s.gens))
+	for _, c := range s.gens {
+		fmt.Printf("   %s\n", c.describe())
+	}
+}
+
+func (s *introspectSource) Columns() []string {
+	return s.columns
+}
+
+func (s *introspectSource) Next() ([]interface{}, error) {
+	if s.row >= s.total {
+		return nil, io.EOF
+	}
+	if config.Seed != 0 {
+		s.src.seek(config.Seed, s.row)
+	}
+	for _, fk := range s.fks {
+		if len(fk.rows) > 0 {
+			fk.pick = s.rng.Intn(len(fk.rows))
+		}
+	}
+
+	row := make([]interface{}, len(s.gens))
+	for i, c := range s.gens {
+		if c.unsupported || (!c.notNull && s.rng.Float64() < introspectNullFraction) {
+			continue
+		}
+		if c.array {
+			n := s.rng.Intn(4)
+			if c.isInt() {
+				elems := make([]int64, n)
+				for j := range elems {
+					elems[j] = c.value(s).(int64)
+				}
+				row[i] = elems
+			} else {
+				elems := make([]string, n)
+				for j := range elems {
+					elems[j] = c.value(s).(string)
+				}
+				row[i] = elems
+			}
+			continue
+		}
+		row[i] = c.value(s)
+	}
+	s.row++
+	return row, nil
+}
+
+// value generates one non-NULL value (one element for arrays).
+func (c *columnGen) value(s *introspectSource) interface{} {
+	r := s.rng
+	if c.fk != nil {
+		if len(c.fk.rows) == 0 {
+			return nil
+		}
+		return c.fk.rows[c.fk.pick][c.fkPos]
+	}
+	if len(c.values) > 0 {
+		return c.values[r.Intn(len(c.values))]
+	}
+
+	switch {
+	case c.isInt():
+		if c.unique {
+			return c.uniqueBase + s.row
+		}
+		lo, hi := c.intRange()
+		if hi-lo+1 <= 0 {
+			return lo + r.Int63()
+		}
+		return lo + r.Int63n(hi-lo+1)
+	case c.typ == "numeric" || c.typ == "real" || c.typ == "double precision":
+		if c.unique {
+			return float64(c.uniqueBase + s.row)
+		}
+		lo, hi := c.floatRange()
+		v := lo + r.Float64()*(hi-lo)
+		if c.typ == "numeric" {
+			scale := math.Pow10(c.digits())
+			v = math.Max(math.Ceil(lo*scale), math.Min(math.Round(v*scale), math.Floor(hi*scale))) / scale
+		}
+		return v
+	case c.isText():
+		return c.text(s)
+	case c.typ == "boolean":
+		return r.Intn(2) == 1
+	case c.typ == "uuid":
+		return newUUID(s.src)
+	case c.typ == "date":
+		days := max(1, int(c.to.Sub(c.from).Hours()/24))
+		return c.from.AddDate(0, 0, r.Intn(days))
+	case strings.HasPrefix(c.typ, "timestamp"):
+		span := max(int64(1), int64(c.to.Sub(c.from)/time.Second))
+		return c.from.Add(time.Duration(r.Int63n(span)) * time.Second)
+	case c.typ == "time without time zone":
+		return pgtype.Time{Microseconds: r.Int63n(86_400_000_000), Valid: true}
+	case c.typ == "interval":
+		return pgtype.Interval{Days: int32(r.Intn(30)), Microseconds: r.Int63n(86_400_000_000), Valid: true}
+	case c.typ == "json" || c.typ == "jsonb":
+		return fmt.Sprintf(`{"row": %d, "value": %q}`, s.row, randomWord(r, 8))
+	case c.typ == "bytea":
+		b := make([]byte, 16)
+		s.src.Read(b)
+		return b
+	case c.typ == "inet" || c.typ == "cidr":
+		addr := netip.AddrFrom4([4]byte{byte(1 + r.Intn(223)), byte(r.Intn(256)), byte(r.Intn(256)), byte(1 + r.Intn(254))})
+		return netip.PrefixFrom(addr, 32)
+	}
+	return nil
+}
+
+// textMax is the longest text value generated for the column.
+func (c *columnGen) textMax() int {
+	n := max(16, c.minLen)
+	if c.maxLen > 0 {
+		n = min(n, c.maxLen)
+	}
+	return n
+}
+
+func (c *columnGen) text(s *introspectSource) string {
+	if c.unique {
+		return s.runID + "-" + strconv.FormatInt(s.row, 36)
+	}
+	if config.Faker && c.minLen == 0 {
+		if v := fakeByName(s.fake, c.name); v != "" {
+			if runes := []rune(v); c.maxLen > 0 && len(runes) > c.maxLen {
+				v = string(runes[:c.maxLen])
+			}
+			return v
+		}
+	}
+	lo, hi := max(c.minLen, 1), c.textMax()
+	return randomWord(s.rng, lo+s.rng.Intn(hi-lo+1))
+}
+
+// fakeByName guesses realistic content from the column name.
+func fakeByName(f *gofakeit.Faker, name string) string {
+	n := strings.ToLower(name)
+	switch {
+	case strings.Contains(n, "email"):
+		return f.Email()
+	case n == "first_name" || n == "firstname":
+		return f.FirstName()
+	case n == "last_name" || n == "lastname" || n == "surname":
+		return f.LastName()
+	case strings.Contains(n, "company") || strings.Contains(n, "merchant"):
+		return f.Company()
+	case strings.HasSuffix(n, "name"):
+		return f.Name()
+	case strings.Contains(n, "phone"):
+		return f.Phone()
+	case strings.Contains(n, "city"):
+		return f.City()
+	case strings.Contains(n, "country"):
+		return f.CountryAbr()
+	case strings.Contains(n, "address") || strings.Contains(n, "street"):
+		return f.Street()
+	case strings.Contains(n, "url") || strings.Contains(n, "website"):
+		return f.URL()
+	case strings.Contains(n, "description") || strings.Contains(n, "comment") || strings.Contains(n, "note"):
+		return f.Sentence(8)
+	}
+	return ""
+}
+
+func randomWord(r *rand.Rand, n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func (s *introspectSource) Close() error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package bulkload
+
+// ============================================================================
+// PER-WORKER KEY SPACES (-unique-columns)
+// ============================================================================
+//
+// Generated account_id, customer_id and correlation_id values are drawn at
+// random, so two goroutines (or two rows of one) produce the same value
+// sooner or later, and a UNIQUE constraint on anything but external_txn_id
+// fails the load. -unique-columns gives the listed columns one value per
+// row instead, derived from the row's position in the load (see
+// seed.go): goroutine g writes rows [g*rows/goroutines, ...), so its
+// keys are a range no other goroutine touches, without coordination and
+// whatever -goroutines is. Checkpointed, partition-routed and appended
+// loads number rows the same way, so resumes and appends stay unique too.
+//   integer columns   the row position (from 1; -mode=append continues
+//                     after the existing rows)
+//   UUID columns      a version 8 UUID holding a hash of the column name and
+//                     the row position, so columns don't share values
+// Supported: account_id, customer_id, merchant_id, processing_duration_ms
+// (INTEGER: up to 2^31 rows), external_txn_id and correlation_id. A unique
+// column can't also have a -data-profile distribution or -ndistinct cap;
+// -null-frac still applies (NULLs don't collide).
+//
+//   go run ./cmd/prod_loader -mode=all -goroutines=16 -unique-columns=account_id,correlation_id
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// uniqueColumn is a generated column with one value per row.
+type uniqueColumn struct {
+	name  string
+	index int    // Position in generatedColumns
+	kind  string // int, uuid, uuid-text
+	salt  uint64 // Hash of the name, for UUIDs
+}
+
+// uniqueColumns are the -unique-columns, nil when off.
+var uniqueColumns []uniqueColumn
+
+// initKeySpaces checks -unique-columns against what the generator produces.
+func initKeySpaces(names []string) error {
+	for _, name := range names {
+		index := slices.Index(generatedColumns, name)
+		if index < 0 {
+			return fmt.Errorf("-unique-columns: %q isn't a generated column", name)
+		}
+		c := uniqueColumn{name: name, index: index}
+		switch {
+		case generatedKinds[name] == "int":
+			c.kind = "int"
+		case generatedKinds[name] == "uuid":
+			c.kind = "uuid"
+		case name == "correlation_id":
+			c.kind = "uuid-text"
+		default:
+			return fmt.Errorf("-unique-columns: %s can't be made unique (use integer or UUID columns)", name)
+		}
+		if profile != nil {
+			if p := profile.Columns[name]; p != nil && (p.Distribution != "" || len(p.Values) > 0 || p.NDistinct > 0) {
+				return fmt.Errorf("-unique-columns: %s also has a -data-profile distribution or -ndistinct cap", name)
+			}
+		}
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		c.salt = h.Sum64()
+		uniqueColumns = append(uniqueColumns, c)
+	}
+	if len(uniqueColumns) > 0 {
+		fmt.Printf("🔑 Unique per row: %s (keys follow row positions, ~%d per goroutine)\n",
+			strings.Join(names, ", "), config.TotalRows/int64(config.Goroutines))
+	}
+	return nil
+}
+
+// applyKeySpaces replaces the values of unique columns with the row's keys.
+func (g *transactionGenerator) applyKeySpaces(row []interface{}) {
+	pos := g.position()
+	for _, c := range uniqueColumns {
+		switch c.kind {
+		case "int":
+			row[c.index] = pos
+		case "uuid":
+			row[c.index] = keyUUID(c.salt, pos)
+		case "uuid-text":
+			row[c.index] = keyUUID(c.salt, pos).String()
+		}
+	}
+}
+
+// keyUUID packs salt and pos into a version 8 (custom) UUID.
+func keyUUID(salt uint64, pos int64) uuid.UUID {
+	var id uuid.UUID
+	binary.BigEndian.PutUint64(id[:8], salt)
+	binary.BigEndian.PutUint64(id[8:], uint64(pos))
+	id[6] = id[6]&0x0f | 0x80 // Version 8
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant, pos < 2^62
+	return id
+}
@@ -0,0 +1,1130 @@
+package bulkload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// CONFIGURATION
+// ============================================================================
+
+type Config struct {
+	DBConnString   string
+	Backend        string // postgres, cockroach (see cockroach.go), mysql (see mysql.go)
+	Import         bool   // CockroachDB: IMPORT INTO for files in object storage
+	TableName      string
+	TotalRows      int64
+	Goroutines     int
+	BatchSize      int
+	LogBadRows     bool
+	BadRowsTable   string
+	MaxBadRows     int64 // Abort once this many rows are quarantined (0 = no limit)
+	MetricsEnabled bool
+	Dedupe         bool // Ultra-fast mode: move duplicate keys to BadRowsTable before restoring constraints (see ultra.go)
+
+	// Input source (see source.go)
+	Source        string // generate, introspect, csv, avro, ndjson
+	SourceFile    string
+	SourceColumns []string
+	FieldMap      map[string]string // Source field -> target column
+	Mask          map[string]string // Column -> masking rule (see mask.go)
+	MaskKey       string            // HMAC key for hash, tokenize and fake
+	MaskVault     string            // CSV of token,value pairs written by tokenize
+	SpillColumn   string            // JSONB column for unmapped NDJSON fields
+	Compression   string            // auto, gzip, zstd, none
+	ReadConcurrency int             // Parallel range reads for s3:// and gs://
+	PartSize      int64             // Bytes per range read
+
+	// Progress reporting (see progress.go)
+	ProgressInterval time.Duration
+	StatusFile       string
+	StatusTable      bool
+	MetricsAddr      string // Prometheus endpoint (see prometheus.go)
+	LogFormat        string // text, json (see logging.go)
+
+	// Write method (see insert.go)
+	WriteMethod string // copy, insert, fdw (see fdw.go)
+	InsertBatch int    // Rows per INSERT statement
+	CommitRows  int    // Rows per INSERT transaction, 0 = one per batch
+
+	// -mode=generate output (see generate.go)
+	OutDir    string
+	OutFormat string // text, binary, csv, parquet
+
+	ApplySettings bool // ALTER SYSTEM the WAL advisor's recommendations (see walcheck.go)
+	DiskCheck     string // fail, warn, off (see diskcheck.go)
+	FreeSpace     int64  // Bytes free for the load, 0 = ask the server
+
+	// -mode=dump-bench (see dumpbench.go)
+	DumpDir  string
+	DumpJobs int
+	KeepDump bool
+
+	// -mode=bench-matrix (see benchmatrix.go)
+	MatrixRows       int64
+	MatrixGoroutines []int
+	MatrixBatchSizes []int
+	MatrixLogging    []string // unlogged, logged
+	MatrixSyncCommit []string
+	MatrixOut        string // CSV copy of the results
+
+	// Transaction poolers (see pooler.go)
+	Pooler    string // auto, on, off
+	DirectDSN string // Bypasses the pooler for DDL
+
+	// Checkpointing (see checkpoint.go)
+	Checkpoint bool
+	Resume     bool
+	LoadID     string
+
+	DataProfile string   // YAML per-column distributions (see profile.go)
+	Faker       bool     // Realistic names/cities/IPs (see faker.go)
+	Seed        int64     // Deterministic rows, 0 = random (see seed.go)
+	UniqueColumns []string // One value per row, from per-worker key spaces (see keyspace.go)
+	AsOf        time.Time // Fixed "now" for generated dates
+	Locales     []string // Faker locales, empty = weighted mix of all
+
+	// Partitioned targets (see partition.go)
+	RoutePartitions   bool
+	PartitionInterval string // auto, daily, monthly
+	Partitioned       string // create-schema layout: "" (plain), monthly, daily
+
+	// Throttling (see throttle.go)
+	MaxReplicaLag time.Duration
+	ReplicaDSN    string
+	MaxWALRate    int64 // WAL bytes/sec budget for LOGGED targets (0 = off)
+	MaxRowsPerSec int64 // Total load rate cap (0 = unlimited)
+	PauseSignals  bool   // SIGUSR1 pauses, SIGUSR2 resumes (see pause.go)
+	ControlSocket string // Unix socket taking pause, resume and status
+
+	// Adaptive parallelism (see adaptive.go)
+	Adaptive         bool
+	MaxGoroutines    int
+	AdaptiveInterval time.Duration
+
+	// Load plan toggles, usually set per profile (see loadplan.go)
+	CreateSchema      bool     // -mode=all recreates the schema
+	AppendFrom        int64    // -mode=append: first row number (default: MAX(transaction_id))
+	DropIndexes       bool     // prepare drops secondary indexes and FKs
+	Truncate          bool     // prepare truncates the target
+	Unlogged          bool     // prepare sets the target UNLOGGED
+	SynchronousCommit string   // For load sessions, "" = server setting
+	FinalizeSteps     []string // Subset of finalizeStepNames
+
+	// Finalize (see indexes.go)
+	IndexParallelism int
+	IndexMem         string // maintenance_work_mem per index build
+	ValidateSample   int    // Rows sampled by -mode=validate (see validate.go)
+	VerifySample     int      // Source rows compared with the table after a file load (see verify.go)
+	VerifyKey        []string // Columns matching source rows to loaded ones, empty = primary key
+	TuneStats        bool     // Raise statistics targets before ANALYZE (see stats.go)
+	StatsColumns     []string
+	FirstRead        bool     // Time scans after load vs after VACUUM (see firstread.go)
+	FirstReadFreeze  bool     // Also against a COPY FREEZE copy
+
+	// Upsert mode (see upsert.go)
+	ConflictKeys []string
+	UpsertMethod string // auto, on-conflict, merge
+
+	// Triggers and generated columns (see triggers.go)
+	TriggerMode  string // safe, fast
+	ReconcileSQL string // Run after a -trigger-mode=fast load
+
+	// Swap mode (see swap.go)
+	SwapTable       string        // Staging table, empty = <table>_new
+	SwapLockTimeout time.Duration // Longest wait for the swap's locks
+	SwapDropOld     bool          // Drop <table>_old after the swap
+
+	// Backfill mode (see backfill.go)
+	Backfill            string // amount-usd, soft-delete, custom
+	BackfillSet         string // custom: SET list
+	BackfillWhere       string // custom: row filter
+	BackfillAgeDays     int
+	BackfillSleep       time.Duration
+	BackfillVacuumEvery int64 // Updated rows between VACUUMs, 0 = never
+	BackfillFrom        int64 // Resume after this transaction_id
+	Delimiter     string
+	Header        bool
+	NullToken     string
+}
+
+// defaults is the configuration before flags (see Defaults).
+var defaults = Config{
+	DBConnString:   "", // -dsn, or PG* environment variables (see dsn.go)
+	Backend:        "postgres",
+	Import:         true,
+	TableName:      "financial_transactions",
+	TotalRows:      1_000_000, // 1 million rows
+	Goroutines:     8,
+	BatchSize:      10000,
+	LogBadRows:     true,
+	BadRowsTable:   "financial_transactions_errors",
+	MaxBadRows:     1000,
+	ConflictKeys:   []string{"external_txn_id"},
+	UpsertMethod:   "auto",
+	SwapLockTimeout: 5 * time.Second,
+	TriggerMode:    "safe",
+	RoutePartitions: true,
+	MaxGoroutines:  32,
+	IndexParallelism: 4,
+	CreateSchema:   true,
+	DropIndexes:    true,
+	Truncate:       true,
+	Unlogged:       true,
+	SynchronousCommit: "off",
+	FinalizeSteps:  finalizeStepNames,
+	IndexMem:       "1GB",
+	StatsColumns:   []string{"customer_id", "amount", "transaction_date"},
+	WriteMethod:    "copy",
+	InsertBatch:    500,
+	Pooler:         "auto",
+	OutFormat:      "text",
+	DumpJobs:       4,
+	DiskCheck:      "fail",
+	Backfill:       "amount-usd",
+	BackfillAgeDays: 365,
+	BackfillSleep:  100 * time.Millisecond,
+	BackfillVacuumEvery: 1_000_000,
+	MatrixRows:     200_000,
+	ProgressInterval: 10 * time.Second,
+	ValidateSample: 10000,
+	AdaptiveInterval: 5 * time.Second,
+	PartitionInterval: "auto",
+	MetricsEnabled: true,
+	Source:         "generate",
+	Delimiter:      ",",
+	Header:         true,
+	SpillColumn:    "metadata",
+	Compression:    "auto",
+	ReadConcurrency: 8,
+	PartSize:       16 << 20, // 16MB
+	PauseSignals:   true,
+	LogFormat:      "text",
+}
+
+// config is what every phase reads; the command line and Configure set it.
+var config = defaults
+
+// ============================================================================
+// PRODUCTION-GRADE TABLE SCHEMA
+// ============================================================================
+
+const createTableSQL = `
+-- Drop existing objects
+DROP TABLE IF EXISTS financial_transactions CASCADE;
+DROP TABLE IF EXISTS financial_transactions_errors CASCADE;
+DROP SEQUENCE IF EXISTS financial_transactions_id_seq CASCADE;
+
+-- Main transactions table with realistic production data types
+CREATE TABLE financial_transactions (
+    -- Primary key
+    transaction_id      BIGSERIAL PRIMARY KEY,
+    
+    -- Transaction identifiers
+    external_txn_id     UUID NOT NULL UNIQUE,
+    correlation_id      VARCHAR(100),
+    
+    -- Temporal data
+    transaction_date    DATE NOT NULL,
+    transaction_time    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    settlement_date     DATE,
+    created_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    
+    -- Financial data (use NUMERIC for money - NEVER use FLOAT!)
+    amount              NUMERIC(15,2) NOT NULL CHECK (amount >= 0),
+    currency            CHAR(3) NOT NULL DEFAULT 'USD',
+    exchange_rate       NUMERIC(10,6),
+    amount_usd          NUMERIC(15,2),
+    fee_amount          NUMERIC(15,2) DEFAULT 0,
+    tax_amount          NUMERIC(15,2) DEFAULT 0,
+    
+    -- Transaction details
+    transaction_type    VARCHAR(50) NOT NULL,
+    transaction_status  VARCHAR(20) NOT NULL DEFAULT 'pending',
+    payment_method      VARCHAR(50),
+    merchant_category   VARCHAR(10),
+    
+    -- Account information
+    account_id          BIGINT NOT NULL,
+    customer_id         BIGINT NOT NULL,
+    merchant_id         BIGINT,
+    
+    -- Geographic data
+    country_code        CHAR(2),
+    region              VARCHAR(50),
+    city                VARCHAR(100),
+    
+    -- Risk and fraud detection
+    risk_score          NUMERIC(5,2) CHECK (risk_score BETWEEN 0 AND 100),
+    is_flagged          BOOLEAN DEFAULT FALSE,
+    fraud_check_status  VARCHAR(20),
+    
+    -- Metadata (JSONB for flexible schema)
+    metadata            JSONB,
+    tags                TEXT[],
+    
+    -- Audit trail
+    processed_by        VARCHAR(100),
+    processing_duration_ms INTEGER,
+    
+    -- Soft delete
+    is_deleted          BOOLEAN DEFAULT FALSE,
+    deleted_at          TIMESTAMP WITH TIME ZONE
+);
+
+-- Error logging table for bad rows
+CREATE TABLE financial_transactions_errors (
+    error_id            BIGSERIAL PRIMARY KEY,
+    failed_at           TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    error_message       TEXT,
+    row_data            JSONB,
+    goroutine_id        INTEGER
+);
+
+-- Indexes (we'll drop these before load and rebuild after)
+CREATE INDEX idx_txn_date ON financial_transactions(transaction_date);
+CREATE INDEX idx_txn_status ON financial_transactions(transaction_status);
+CREATE INDEX idx_txn_customer ON financial_transactions(customer_id);
+CREATE INDEX idx_txn_account ON financial_transactions(account_id);
+CREATE INDEX idx_txn_external_id ON financial_transactions(external_txn_id);
+CREATE INDEX idx_txn_created_at ON financial_transactions(created_at);
+CREATE INDEX idx_txn_amount ON financial_transactions(amount) WHERE amount > 10000;
+CREATE INDEX idx_txn_metadata ON financial_transactions USING GIN(metadata);
+CREATE INDEX idx_txn_tags ON financial_transactions USING GIN(tags);
+
+-- Partial index for active transactions
+CREATE INDEX idx_txn_active ON financial_transactions(transaction_id) 
+    WHERE is_deleted = FALSE;
+
+COMMENT ON TABLE financial_transactions IS 'Production financial transactions with optimizations';
+`
+
+// ============================================================================
+// METRICS AND MONITORING
+// ============================================================================
+
+type LoadMetrics struct {
+	StartTime          time.Time
+	EndTime            time.Time
+	TotalRows          int64
+	SuccessRows        int64
+	FailedRows         int64
+	Duration           time.Duration
+	RowsPerSecond      float64
+	GoroutineMetrics   map[int]*GoroutineMetrics
+	PreLoadTableSize   string
+	PostLoadTableSize  string
+	WALGenerated       string
+	WALBytes           int64 // -1 if unknown
+	IndexBuilds        []IndexMetrics
+	FinalizeDuration   time.Duration
+	LastCommit         time.Time
+	mu                 sync.Mutex
+}
+
+type GoroutineMetrics struct {
+	GoroutineID   int
+	RowsProcessed int64
+	Duration      time.Duration
+	ErrorCount    int64
+}
+
+// IndexMetrics is one index rebuilt by finalize.
+type IndexMetrics struct {
+	Name       string
+	Duration   time.Duration
+	SizeBytes  int64
+	Concurrent bool
+	Failed     bool
+}
+
+func NewLoadMetrics() *LoadMetrics {
+	return &LoadMetrics{
+		StartTime:        time.Now(),
+		GoroutineMetrics: make(map[int]*GoroutineMetrics),
+	}
+}
+
+func (m *LoadMetrics) RecordSuccess(goroutineID int, rows int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.SuccessRows += rows
+	m.LastCommit = time.Now()
+	if _, exists := m.GoroutineMetrics[goroutineID]; !exists {
+		m.GoroutineMetrics[goroutineID] = &GoroutineMetrics{GoroutineID: goroutineID}
+	}
+	m.GoroutineMetrics[goroutineID].RowsProcessed += rows
+}
+
+func (m *LoadMetrics) RecordError(goroutineID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.FailedRows++
+	if _, exists := m.GoroutineMetrics[goroutineID]; !exists {
+		m.GoroutineMetrics[goroutineID] = &GoroutineMetrics{GoroutineID: goroutineID}
+	}
+	m.GoroutineMetrics[goroutineID].ErrorCount++
+}
+
+func (m *LoadMetrics) Finalize() {
+	m.EndTime = time.Now()
+	m.Duration = m.EndTime.Sub(m.StartTime)
+	if m.Duration.Seconds() > 0 {
+		m.RowsPerSecond = float64(m.SuccessRows) / m.Duration.Seconds()
+	}
+}
+
+func (m *LoadMetrics) PrintReport() {
+	logger.Info("load finished", "rows", m.SuccessRows, "failed_rows", m.FailedRows, "duration_ms", m.Duration.Milliseconds(),
+		"rows_per_sec", m.RowsPerSecond, "wal_bytes", m.WALBytes)
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Println("📊 LOAD METRICS REPORT")
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("Start Time:           %s\n", m.StartTime.Format(time.RFC3339))
+	fmt.Printf("End Time:             %s\n", m.EndTime.Format(time.RFC3339))
+	fmt.Printf("Duration:             %v\n", m.Duration)
+	fmt.Printf("Total Rows:           %d\n", m.TotalRows)
+	fmt.Printf("Success:              %d (%.2f%%)\n", m.SuccessRows, float64(m.SuccessRows)/float64(m.TotalRows)*100)
+	fmt.Printf("Failed:               %d (%.2f%%)\n", m.FailedRows, float64(m.FailedRows)/float64(m.TotalRows)*100)
+	fmt.Printf("Throughput:           %.0f rows/sec\n", m.RowsPerSecond)
+	fmt.Printf("Pre-load Table Size:  %s\n", m.PreLoadTableSize)
+	fmt.Printf("Post-load Table Size: %s\n", m.PostLoadTableSize)
+	fmt.Printf("WAL Generated:        %s\n", m.WALGenerated)
+	if m.FailedRows > 0 && config.LogBadRows {
+		fmt.Printf("Bad Rows:             quarantined in %s\n", config.BadRowsTable)
+	}
+	printAdaptiveReport()
+	printStatsReport()
+	printRetryReport()
+	printPauseReport()
+	printTriggerReport()
+	printEndToEndCost(m)
+	printIndexReport(m)
+	printFirstReadReport()
+	if waited := time.Duration(throttle.waited.Load()); waited > 0 {
+		fmt.Printf("Throttled:            %v of worker time\n", waited.Round(time.Millisecond))
+	}
+	if paced := time.Duration(throttle.paced.Load()); paced > 0 {
+		fmt.Printf("Rate Limited:         %v of worker time (-max-rows-per-sec=%d)\n", paced.Round(time.Millisecond), config.MaxRowsPerSec)
+	}
+	
+	fmt.Println("\n📈 Per-Goroutine Breakdown:")
+	for id, gm := range m.GoroutineMetrics {
+		fmt.Printf("  Goroutine %d: %d rows, %d errors\n", id, gm.RowsProcessed, gm.ErrorCount)
+	}
+	fmt.Println(strings.Repeat("=", 80))
+}
+
+// ============================================================================
+// DATABASE CONNECTION POOL
+// ============================================================================
+
+func initConnectionPool(ctx context.Context, connString string) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	// Optimize pool for bulk operations
+	poolConfig.MaxConns = int32(config.Goroutines + 5) // Extra connections for monitoring
+	poolConfig.MinConns = 4
+	poolConfig.MaxConnLifetime = time.Hour
+	poolConfig.MaxConnIdleTime = 30 * time.Minute
+	poolConfig.HealthCheckPeriod = 30 * time.Second
+
+	// Connection-level optimizations
+	poolConfig.ConnConfig.RuntimeParams = map[string]string{
+		"application_name": "bulk_loader",
+	}
+	if poolerMode && connString == config.DBConnString {
+		applyPoolerSettings(poolConfig)
+	} else if config.SynchronousCommit != "" && !cockroach() {
+		// Poolers reject unknown startup parameters; elsewhere every load session gets it.
+		poolConfig.ConnConfig.RuntimeParams["synchronous_commit"] = config.SynchronousCommit
+	}
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pool: %w", err)
+	}
+
+	if err := pool.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return pool, nil
+}
+
+// ============================================================================
+// PHASE 1: PRE-LOAD OPTIMIZATIONS
+// ============================================================================
+
+func prepareForLoad(ctx context.Context, pool *pgxpool.Pool) error {
+	defer beginPhase("prepare")()
+
+	fmt.Println("\n🔧 PHASE 1: PREPARING DATABASE FOR BULK LOAD")
+	fmt.Println(strings.Repeat("=", 80))
+	if cockroach() {
+		defer fmt.Println(strings.Repeat("=", 80))
+		return prepareCockroach(ctx, pool)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	steps := []struct {
+		name string
+		sql  string
+		off  bool // Disabled by the load plan
+	}{
+		{
+			name: "1. Disable autovacuum on target table",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET (autovacuum_enabled = false)", config.TableName),
+		},
+		{
+			name: "2. Increase maintenance_work_mem for this session",
+			sql:  "SET maintenance_work_mem = '2GB'",
+		},
+		{
+			name: "3. Increase work_mem for sorting",
+			sql:  "SET work_mem = '256MB'",
+		},
+		{
+			name: "4. Disable synchronous_commit (faster, but less durable)",
+			sql:  fmt.Sprintf("SET synchronous_commit = %s", config.SynchronousCommit),
+			off:  config.SynchronousCommit == "",
+		},
+		{
+			name: "5. Drop non-unique indexes (keep constraints)",
+			sql: fmt.Sprintf(`
+				DO $ 
+				DECLARE 
+					idx RECORD;
+				BEGIN
+					FOR idx IN 
+						SELECT indexname 
+						FROM pg_indexes 
+						WHERE tablename = '%s' 
+						AND indexname NOT LIKE '%%_pkey'
+						AND indexname NOT LIKE '%%_key'
+					LOOP
+						EXECUTE 'DROP INDEX IF EXISTS ' || idx.indexname;
+						RAISE NOTICE 'Dropped index: %%', idx.indexname;
+					END LOOP;
+				END $;
+			`, config.TableName),
+			off: !config.DropIndexes,
+		},
+		{
+			name: "6. Drop foreign key constraints (if any)",
+			sql: fmt.Sprintf(`
+				DO $$
+				DECLARE
+					fk RECORD;
+				BEGIN
+					FOR fk IN
+						SELECT conname
+						FROM pg_constraint
+						WHERE conrelid = '%s'::regclass
+						AND contype = 'f'
+					LOOP
+						EXECUTE 'ALTER TABLE %s DROP CONSTRAINT ' || fk.conname;
+						RAISE NOTICE 'Dropped FK: %%', fk.conname;
+					END LOOP;
+				END $$;
+			`, config.TableName, config.TableName),
+			off: !config.DropIndexes,
+		},
+		{
+			name: "7. Truncate target table",
+			sql:  fmt.Sprintf("TRUNCATE TABLE %s", config.TableName),
+			off:  !config.Truncate,
+		},
+		{
+			name: "8. Convert to UNLOGGED table (no WAL writes - FASTEST)",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET UNLOGGED", config.TableName),
+			off:  !config.Unlogged,
+		},
+	}
+
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		if step.off {
+			fmt.Println(" ⏭️  (off in this load plan)")
+			logStep("prepare", step.name, 0, nil, "skipped", "off in this load plan")
+			continue
+		}
+		if config.Resume && strings.HasPrefix(step.sql, "TRUNCATE") {
+			fmt.Println(" ⏭️  (skipped: resuming checkpointed load)")
+			logStep("prepare", step.name, 0, nil, "skipped", "resuming checkpointed load")
+			continue
+		}
+		if pooledDDL() && sessionOnly(step.sql) {
+			fmt.Println(" ⏭️  (skipped: behind a transaction pooler, pass -direct-dsn)")
+			logStep("prepare", step.name, 0, nil, "skipped", "behind a transaction pooler")
+			continue
+		}
+		start := time.Now()
+		_, err := conn.Exec(ctx, step.sql)
+		logStep("prepare", step.name, time.Since(start), err)
+		if err != nil {
+			fmt.Printf(" ⚠️  (skipped: %v)\n", err)
+		} else {
+			fmt.Println(" ✅")
+		}
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+// ============================================================================
+// PHASE 2: BULK LOAD WITH COPY PROTOCOL
+// ============================================================================
+
+func executeLoad(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	return loadRows(ctx, pool, nil, metrics)
+}
+
+// loadRows loads src, or the -source rows when src is nil.
+func loadRows(ctx context.Context, pool *pgxpool.Pool, src Source, metrics *LoadMetrics) (err error) {
+	defer beginPhase("load")()
+
+	fmt.Println("\n🚀 PHASE 2: EXECUTING PARALLEL BULK LOAD")
+	fmt.Println(strings.Repeat("=", 80))
+
+	// Get pre-load table size and starting WAL position
+	metrics.PreLoadTableSize = getTableSize(ctx, pool, config.TableName)
+	startWAL := getCurrentWAL(ctx, pool)
+	fmt.Printf("Pre-load table size: %s\n", metrics.PreLoadTableSize)
+
+	if config.LogBadRows {
+		if err := ensureBadRowsTable(ctx, pool); err != nil {
+			return err
+		}
+	}
+	if config.Checkpoint {
+		if err := initCheckpoints(ctx, pool); err != nil {
+			return err
+		}
+	}
+	if err := detectPartitions(ctx, pool); err != nil {
+		return err
+	}
+	endTriggers, err := applyTriggerMode(ctx, pool)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if terr := endTriggers(err); err == nil {
+			err = terr
+		}
+	}()
+	stopThrottles, err := startThrottles(ctx, pool)
+	if err != nil {
+		return err
+	}
+	defer stopThrottles()
+	defer startAdaptive(ctx, pool)()
+	progress, err := startProgress(ctx, pool, metrics)
+	if err != nil {
+		return err
+	}
+	defer func() { progress.stop(err) }()
+
+	if src != nil {
+		if src, err = wrapGenerated(ctx, pool, src); err != nil {
+			return err
+		}
+		loadedColumns = src.Columns()
+		fmt.Printf("Source: provided by the caller, columns: %s\n", strings.Join(loadedColumns, ", "))
+		if err := loadFromSource(ctx, pool, src, metrics); err != nil {
+			return err
+		}
+	} else if useImport() {
+		if err := importInto(ctx, pool, metrics); err != nil {
+			return err
+		}
+	} else if config.WriteMethod == "fdw" {
+		if err := loadViaFDW(ctx, pool, metrics); err != nil {
+			return err
+		}
+	} else if config.Source != "generate" {
+		src, err := openSource(ctx, pool)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		loadedColumns = src.Columns()
+		fmt.Printf("Source: %s (%s), columns: %s\n", sourceName(), config.Source, strings.Join(loadedColumns, ", "))
+		if err := loadFromSource(ctx, pool, src, metrics); err != nil {
+			return err
+		}
+	} else {
+		generated, err := generatedColumnNames(ctx, pool, config.TableName)
+		if err != nil {
+			return err
+		}
+		loadedColumns = skipGeneratedColumns(generated)
+		defer func() { generatedSkip = nil }()
+		var units []partitionUnit
+		if partitions != nil {
+			var err error
+			if units, err = prepareGeneratedPartitions(ctx, pool); err != nil {
+				return err
+			}
+		}
+		if len(units) > 0 {
+			loadGeneratedPartitioned(ctx, pool, units, metrics)
+		} else {
+			loadGenerated(ctx, pool, metrics)
+		}
+	}
+
+	// Get post-load metrics
+	metrics.PostLoadTableSize = getTableSize(ctx, pool, config.TableName)
+	endWAL := getCurrentWAL(ctx, pool)
+	metrics.WALGenerated = getWALDiff(ctx, pool, startWAL, endWAL)
+	metrics.WALBytes = walSince(ctx, pool, startWAL)
+	if payload != nil && !cockroach() {
+		printToastReport(ctx, pool, metrics.SuccessRows)
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+func loadGenerated(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) {
+	rowsPerGoroutine := config.TotalRows / int64(config.Goroutines)
+	
+	var wg sync.WaitGroup
+	errChan := make(chan error, config.Goroutines)
+
+	for g := 0; g < config.Goroutines; g++ {
+		wg.Add(1)
+		go func(goroutineID int) {
+			defer wg.Done()
+
+			load := func() error { return loadInGoroutine(ctx, pool, goroutineID, rowsPerGoroutine, metrics) }
+			if config.Checkpoint {
+				load = func() error { return loadGeneratedChunks(ctx, pool, goroutineID, metrics) }
+			}
+			if err := load(); err != nil {
+				errChan <- fmt.Errorf("goroutine %d failed: %w", goroutineID, err)
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	// Check for errors
+	for err := range errChan {
+		log.Printf("Error during load: %v", err)
+	}
+}
+
+func loadInGoroutine(ctx context.Context, pool *pgxpool.Pool, goroutineID int, rowCount int64, metrics *LoadMetrics) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	start := time.Now()
+	fmt.Printf("   🔄 Goroutine %d: Starting load of %d rows\n", goroutineID, rowCount)
+
+	gen := &transactionGenerator{
+		totalRows:   rowCount,
+		currentRow:  0,
+		rowOffset:   int64(goroutineID) * rowCount,
+		goroutineID: goroutineID,
+		metrics:     metrics,
+	}
+
+	// Use COPY protocol for maximum performance
+	var copyCount int64
+	if config.LogBadRows || throttling() || workers != nil || config.WriteMethod == "insert" {
+		copyCount, err = copyGeneratedBatches(ctx, conn, goroutineID, config.TableName, gen, metrics)
+	} else {
+		copyCount, err = conn.Conn().CopyFrom(ctx, pgx.Identifier{config.TableName}, loadedColumns, gen)
+	}
+
+	if err != nil {
+		metrics.RecordError(goroutineID)
+		return err
+	}
+
+	metrics.RecordSuccess(goroutineID, copyCount)
+
+	duration := time.Since(start)
+	logWorker(goroutineID, copyCount, duration)
+	
+	fmt.Printf("   ✅ Goroutine %d: Completed %d rows in %v (%.0f rows/sec)\n",
+		goroutineID, copyCount, duration, float64(copyCount)/duration.Seconds())
+
+	return nil
+}
+
+// ============================================================================
+// DATA GENERATOR (implements pgx.CopyFromSource)
+// ============================================================================
+
+// generatedColumns lists the columns transactionGenerator.Values returns.
+var generatedColumns = []string{
+	"external_txn_id", "correlation_id", "transaction_date", "transaction_time",
+	"settlement_date", "amount", "currency", "exchange_rate", "amount_usd",
+	"fee_amount", "tax_amount", "transaction_type", "transaction_status",
+	"payment_method", "merchant_category", "account_id", "customer_id",
+	"merchant_id", "country_code", "region", "city", "risk_score",
+	"is_flagged", "fraud_check_status", "metadata", "tags",
+	"processed_by", "processing_duration_ms",
+}
+
+type transactionGenerator struct {
+	totalRows   int64
+	currentRow  int64
+	goroutineID int
+	metrics     *LoadMetrics
+	lastReport  time.Time
+
+	// Set for partition-routed loads: transaction_date is drawn from
+	// [dateFrom, dateFrom+days) instead of the last 90 days.
+	dateFrom time.Time
+	days     int
+
+	// Per-generator randomness; with -seed every row is a function of the
+	// seed and rowOffset+currentRow (see seed.go)
+	rowOffset int64
+	src       *rowSource
+	rng       *rand.Rand
+	zipfs     map[string]*rand.Zipf // -data-profile zipf columns
+	reference bool                  // Builds an ndistinct slot (see profile.go)
+	fake  *gofakeit.Faker // -faker (see faker.go)
+}
+
+func (g *transactionGenerator) Next() bool {
+	g.currentRow++
+	
+	// Print progress every 10,000 rows
+	if g.currentRow%10000 == 0 {
+		if g.lastReport.IsZero() || time.Since(g.lastReport) > 2*time.Second {
+			fmt.Printf("      💾 Goroutine %d: %d/%d rows (%.1f%%)\n", 
+				g.goroutineID, g.currentRow, g.totalRows, 
+				float64(g.currentRow)/float64(g.totalRows)*100)
+			g.lastReport = time.Now()
+		}
+	}
+	
+	return g.currentRow <= g.totalRows
+}
+
+func (g *transactionGenerator) Values() ([]interface{}, error) {
+	// Generate realistic transaction data
+	r := g.random()
+	if config.Seed != 0 {
+		g.src.seek(config.Seed, g.position())
+	}
+	now := generatorNow()
+	txnDate := now.AddDate(0, 0, -r.Intn(90)) // Last 90 days
+	if g.days > 0 {
+		txnDate = g.dateFrom.AddDate(0, 0, r.Intn(g.days))
+	}
+
+	amount := g.floatValue("amount", float64(r.Intn(100000)) + r.Float64()*100)
+	currency := g.stringValue("currency", []string{"USD", "EUR", "GBP", "JPY"}[r.Intn(4)])
+	exchangeRate := g.floatValue("exchange_rate", 1.0 + r.Float64()*0.5)
+
+	metadata := map[string]interface{}{
+		"ip_address":    fmt.Sprintf("192.168.%d.%d", r.Intn(255), r.Intn(255)),
+		"user_agent":    "Mozilla/5.0",
+		"device_type":   []string{"mobile", "desktop", "tablet"}[r.Intn(3)],
+		"session_id":    newUUID(g.src).String(),
+		"referrer":      "https://example.com",
+		"goroutine_id":  g.goroutineID,
+	}
+	var fake *fakeRow
+	if config.Faker {
+		fake = g.fakeRow(metadata)
+	}
+	if payload != nil {
+		payload.pad(metadata, r)
+	}
+	metadataJSON, _ := json.Marshal(metadata)
+
+	tags := []string{
+		fmt.Sprintf("batch_%d", r.Intn(100)),
+		fmt.Sprintf("region_%s", []string{"US", "EU", "APAC"}[r.Intn(3)]),
+	}
+
+	row := []interface{}{
+		newUUID(g.src),                                                           // external_txn_id
+		g.stringValue("correlation_id", newUUID(g.src).String()),                                                  // correlation_id
+		txnDate,                                                              // transaction_date
+		txnDate.Add(time.Duration(r.Intn(86400)) * time.Second),         // transaction_time
+		txnDate.AddDate(0, 0, 2),                                            // settlement_date
+		amount,                                                               // amount
+		currency,                                                             // currency
+		exchangeRate,                                                         // exchange_rate
+		amount * exchangeRate,                                                // amount_usd
+		amount * 0.029,                                                       // fee_amount (2.9%)
+		amount * 0.08,                                                        // tax_amount (8%)
+		g.stringValue("transaction_type", []string{"purchase", "refund", "transfer", "withdrawal"}[r.Intn(4)]), // transaction_type
+		g.stringValue("transaction_status", []string{"pending", "completed", "failed"}[r.Intn(3)]),            // transaction_status
+		g.stringValue("payment_method", []string{"credit_card", "debit_card", "paypal", "bank_transfer"}[r.Intn(4)]), // payment_method
+		g.stringValue("merchant_category", fmt.Sprintf("%04d", r.Intn(10000))),                               // merchant_category
+		g.intValue("account_id", r.Int63n(1000000)),                                                 // account_id
+		g.intValue("customer_id", r.Int63n(100000)),                                                  // customer_id
+		g.intValue("merchant_id", r.Int63n(50000)),                                                   // merchant_id
+		g.stringValue("country_code", []string{"US", "GB", "DE", "FR", "JP"}[r.Intn(5)]),               // country_code
+		g.stringValue("region", []string{"North America", "Europe", "Asia"}[r.Intn(3)]),          // region
+		g.stringValue("city", []string{"New York", "London", "Tokyo", "Paris"}[r.Intn(4)]),     // city
+		g.floatValue("risk_score", float64(r.Intn(100))),                                              // risk_score
+		g.boolValue("is_flagged", r.Intn(100) < 5),                                                   // is_flagged (5% flagged)
+		g.stringValue("fraud_check_status", []string{"pass", "review", "fail"}[r.Intn(3)]),                   // fraud_check_status
+		string(metadataJSON),                                                 // metadata
+		tags,                                                                 // tags
+		g.stringValue("processed_by", fmt.Sprintf("loader_goroutine_%d", g.goroutineID)),                  // processed_by
+		g.intValue("processing_duration_ms", int64(r.Intn(1000))),                                                      // processing_duration_ms
+	}
+	if fake != nil {
+		g.applyFake(row, fake)
+	}
+	if uniqueColumns != nil && !g.reference {
+		g.applyKeySpaces(row)
+	}
+	if profile != nil && !g.reference {
+		g.applyDistinct(row)
+		g.applyNulls(row)
+	}
+	if generatedSkip != nil && !g.reference {
+		row = withoutPositions(row, generatedSkip) // Computed by the server (see triggers.go)
+	}
+	return row, nil
+}
+
+func (g *transactionGenerator) Err() error {
+	return nil
+}
+
+// position is the current row's number in the whole load (see seed.go).
+func (g *transactionGenerator) position() int64 {
+	row := g.rowOffset + g.currentRow
+	if !g.reference {
+		row += appendBase // -mode=append continues the numbering
+	}
+	return row
+}
+
+// ============================================================================
+// PHASE 3: POST-LOAD FINALIZATION
+// ============================================================================
+
+func finalizeLoad(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	defer beginPhase("finalize")()
+	finalizeStart := time.Now()
+	defer func() { metrics.FinalizeDuration = time.Since(finalizeStart) }()
+
+	fmt.Println("\n🔨 PHASE 3: POST-LOAD FINALIZATION")
+	fmt.Println(strings.Repeat("=", 80))
+	if cockroach() {
+		defer fmt.Println(strings.Repeat("=", 80))
+		return finalizeCockroach(ctx, pool)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	steps := []struct {
+		key  string // In finalizeStepNames
+		name string
+		sql  string
+		run  func(context.Context, *pgxpool.Pool) error // Instead of sql
+		off  bool
+	}{
+		{
+			key:  "logged",
+			name: "1. Convert back to LOGGED table (enable WAL)",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET LOGGED", config.TableName),
+		},
+		{
+			key:  "indexes",
+			name: "2. Rebuild indexes (this will take time...)",
+			run: func(ctx context.Context, pool *pgxpool.Pool) error {
+				return rebuildIndexes(ctx, pool, metrics)
+			},
+		},
+		{
+			key:  "analyze",
+			name: "3. Tune statistics targets",
+			run:  tuneStatistics,
+			off:  !config.TuneStats,
+		},
+		{
+			key:  "analyze",
+			name: "4. Run ANALYZE to update statistics",
+			sql:  fmt.Sprintf("ANALYZE %s", config.TableName),
+		},
+		{
+			key:  "autovacuum",
+			name: "5. Re-enable autovacuum",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET (autovacuum_enabled = true)", config.TableName),
+		},
+		{
+			key:  "vacuum",
+			name: "6. Run VACUUM to reclaim space",
+			sql:  fmt.Sprintf("VACUUM ANALYZE %s", config.TableName),
+		},
+	}
+
+	firstReads = nil
+	if config.FirstRead {
+		firstReads = append(firstReads, measureFirstRead(ctx, pool, "after load", config.TableName))
+	}
+
+	var finalizeErr error
+	finalizeCosts = nil
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		if step.off || !slices.Contains(config.FinalizeSteps, step.key) {
+			fmt.Println(" ⏭️  (off in this load plan)")
+			continue
+		}
+		start, startWAL := time.Now(), getCurrentWAL(ctx, pool)
+		if step.run != nil {
+			err := step.run(ctx, pool)
+			wal := recordStep(ctx, pool, step.key, step.name, startWAL, start, err)
+			if err != nil {
+				fmt.Printf("   ❌ %v\n", err)
+				finalizeErr = err
+			} else {
+				fmt.Printf("   ✅ (took %v%s)\n", time.Since(start), wal)
+			}
+			continue
+		}
+		if pooledDDL() && sessionOnly(step.sql) {
+			fmt.Println(" ⏭️  (skipped: behind a transaction pooler, pass -direct-dsn)")
+			continue
+		}
+		_, err := conn.Exec(ctx, step.sql)
+		wal := recordStep(ctx, pool, step.key, step.name, startWAL, start, err)
+		if err != nil {
+			fmt.Printf(" ⚠️  (error: %v)\n", err)
+		} else {
+			fmt.Printf(" ✅ (took %v%s)\n", time.Since(start), wal)
+		}
+	}
+	printFinalizeCost()
+
+	if config.FirstRead {
+		vacuumed := false
+		for _, c := range finalizeCosts {
+			vacuumed = vacuumed || (c.key == "vacuum" && !c.failed)
+		}
+		if vacuumed {
+			firstReads = append(firstReads, measureFirstRead(ctx, pool, "after VACUUM", config.TableName))
+		} else {
+			firstReads = append(firstReads, readPass{name: "after VACUUM", skipped: "the vacuum step did not run"})
+		}
+		if config.FirstReadFreeze {
+			firstReads = append(firstReads, measureCopyFreeze(ctx, pool))
+		}
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+	return finalizeErr
+}
+
+// ============================================================================
+// UTILITY FUNCTIONS
+// ============================================================================
+
+func getTableSize(ctx context.Context, pool *pgxpool.Pool, tableName string) string {
+	var size string
+	err := pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT pg_size_pretty(pg_total_relation_size('%s'))
+	`, tableName)).Scan(&size)
+	if err != nil {
+		return "unknown"
+	}
+	return size
+}
+
+func getCurrentWAL(ctx context.Context, pool *pgxpool.Pool) string {
+	var wal string
+	err := pool.QueryRow(ctx, `SELECT pg_current_wal_lsn()`).Scan(&wal)
+	if err != nil {
+		return "0/0"
+	}
+	return wal
+}
+
+func getWALDiff(ctx context.Context, pool *pgxpool.Pool, startWAL, endWAL string) string {
+	var diff string
+	err := pool.QueryRow(ctx, `
+		SELECT pg_size_pretty(pg_wal_lsn_diff($1, $2))
+	`, endWAL, startWAL).Scan(&diff)
+	if err != nil {
+		return "unknown"
+	}
+	return diff
+}
+
+func createSchema(ctx context.Context, pool *pgxpool.Pool) error {
+	defer beginPhase("create-schema")()
+
+	fmt.Println("\n📋 Creating production-grade table schema...")
+	if cockroach() {
+		return createCockroachSchema(ctx, pool)
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	schemaSQL := createTableSQL
+	if config.Partitioned != "" {
+		if config.Partitioned != "monthly" && config.Partitioned != "daily" {
+			return fmt.Errorf("unknown -partitioned=%q (use monthly, daily)", config.Partitioned)
+		}
+		if schemaSQL, err = partitionedTableSQL(); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Exec(ctx, schemaSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	if config.Partitioned != "" {
+		config.PartitionInterval = config.Partitioned
+		if err := createPartitions(ctx, pool); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("✅ Schema created successfully")
+	return nil
+}
@@ -0,0 +1,131 @@
+package bulkload
+
+// ============================================================================
+// LOAD PLANS (-config, -profile)
+// ============================================================================
+//
+// A YAML file keeps the flags of recurring loads in one reviewed place.
+// Keys are flag names without the dash; "defaults" applies to every run and
+// a profile from "profiles" is layered on top of it:
+//
+//   defaults:
+//     table: financial_transactions
+//     goroutines: 16
+//   profiles:
+//     backfill:
+//       create-schema: false
+//       truncate: false
+//       finalize-steps: [analyze, autovacuum]
+//
+// Flags given on the command line win over the file, so a profile can be
+// reused with one setting changed. Besides every existing flag, the file
+// is where the load plan toggles usually live:
+//   create-schema, drop-indexes, truncate, unlogged   (true by default)
+//   synchronous-commit                                (off by default)
+//   finalize-steps  logged, indexes, analyze, autovacuum, vacuum
+// See loader.example.yaml for initial-load, backfill and staging-refresh.
+//
+//   go run ./cmd/prod_loader -config=loader.example.yaml -profile=backfill -file=2023.csv
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// finalizeStepNames are the finalize steps a load plan can choose from.
+var finalizeStepNames = []string{"logged", "indexes", "analyze", "autovacuum", "vacuum"}
+
+// loadPlanFile is the -config file.
+type loadPlanFile struct {
+	Defaults map[string]interface{}            `yaml:"defaults"`
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// applyConfigFile sets every flag from the file's defaults and profile
+// that wasn't given on the command line.
+func applyConfigFile(path, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	var file loadPlanFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	settings := make(map[string]interface{})
+	for key, value := range file.Defaults {
+		settings[key] = value
+	}
+	if profile != "" {
+		values, ok := file.Profiles[profile]
+		if !ok {
+			names := make([]string, 0, len(file.Profiles))
+			for name := range file.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("config %s has no profile %q (profiles: %s)", path, profile, strings.Join(names, ", "))
+		}
+		for key, value := range values {
+			settings[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	applied, overridden := 0, 0
+	for _, key := range keys {
+		if key == "config" || key == "profile" || flag.Lookup(key) == nil {
+			return fmt.Errorf("config %s: unknown setting %q", path, key)
+		}
+		if flagSet(key) {
+			overridden++
+			continue
+		}
+		if err := flag.Set(key, settingValue(settings[key])); err != nil {
+			return fmt.Errorf("config %s: %s: %w", path, key, err)
+		}
+		applied++
+	}
+
+	name := "defaults"
+	if profile != "" {
+		name = "profile " + profile
+	}
+	fmt.Printf("📄 Config %s (%s): %d settings applied, %d overridden on the command line\n", path, name, applied, overridden)
+	return nil
+}
+
+// settingValue renders a YAML value the way it would be written as a flag;
+// lists become comma separated and maps key=value pairs (-mask).
+func settingValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(v))
+		for key, value := range v {
+			pairs = append(pairs, key+"="+fmt.Sprint(value))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
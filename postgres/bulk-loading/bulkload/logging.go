@@ -0,0 +1,90 @@
+package bulkload
+
+// ============================================================================
+// STRUCTURED LOGGING (-log-format)
+// ============================================================================
+//
+// The console output is written for a person at a terminal: banners,
+// aligned tables and emoji. Runs started from CI or cron need something a
+// log pipeline can parse and alert on, so with -log-format=json the loader
+// writes one JSON object per event to stdout (log/slog) and moves the
+// console output to stderr:
+//   phase started / phase finished    phase, duration_ms
+//   step finished                     phase, step, duration_ms, error
+//                                     (prepare and finalize steps, indexes)
+//   worker finished                   phase, goroutine, rows, duration_ms
+//   load finished                     rows, failed_rows, duration_ms,
+//                                     rows_per_sec, wal_bytes
+//   progress                          rows, rows_per_sec, state, eta
+//   check                             phase, check, ok, detail (validate)
+//   error                             phase, error; every fatal error and
+//                                     log.Printf message, level ERROR
+// Failed steps and checks are logged at level WARN.
+//
+//   go run ./cmd/prod_loader -mode=all -log-format=json 2>console.log | jq -c 'select(.level != "INFO")'
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// logger receives the structured events; it discards them unless
+// -log-format=json.
+var logger = slog.New(slog.DiscardHandler)
+
+// initLogging switches to JSON events on stdout for -log-format=json.
+func initLogging() error {
+	switch config.LogFormat {
+	case "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("invalid -log-format %q (use text or json)", config.LogFormat)
+	}
+	logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	// Everything printed with fmt goes to the console stream from here on.
+	os.Stdout = os.Stderr
+	log.SetFlags(0)
+	log.SetOutput(errorLog{os.Stderr})
+	return nil
+}
+
+// errorLog copies the standard logger's messages (log.Fatal included) to
+// the structured log as errors.
+type errorLog struct{ console io.Writer }
+
+func (w errorLog) Write(p []byte) (int, error) {
+	logger.Error("error", "phase", currentPhase(), "error", strings.TrimSpace(string(p)))
+	return w.console.Write(p)
+}
+
+// currentPhase is the running phase, or the last one that ran.
+func currentPhase() string {
+	phases.mu.Lock()
+	defer phases.mu.Unlock()
+	if phases.current != "" {
+		return phases.current
+	}
+	return phases.last
+}
+
+// logStep records a finished prepare or finalize step.
+func logStep(phase, step string, d time.Duration, err error, attrs ...any) {
+	args := append([]any{"phase", phase, "step", step, "duration_ms", d.Milliseconds()}, attrs...)
+	if err != nil {
+		logger.Warn("step finished", append(args, "error", err.Error())...)
+		return
+	}
+	logger.Info("step finished", args...)
+}
+
+// logWorker records a COPY worker that finished its share.
+func logWorker(goroutine int, rows int64, d time.Duration, attrs ...any) {
+	args := append([]any{"phase", currentPhase(), "goroutine", goroutine, "rows", rows, "duration_ms", d.Milliseconds()}, attrs...)
+	logger.Info("worker finished", args...)
+}
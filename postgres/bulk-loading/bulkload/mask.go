@@ -0,0 +1,371 @@
+package bulkload
+
+// ============================================================================
+// DATA MASKING (-mask, -mask-key, -mask-vault)
+// ============================================================================
+//
+// Production extracts loaded into staging shouldn't carry customer PII.
+// -mask puts a transform between the source and COPY that rewrites the
+// listed columns of every row before it leaves the loader:
+//   nullify    NULL (a NOT NULL column sends the row to -log-bad-rows)
+//   hash       keyed SHA-256, keeping the column type: hex text cut to the
+//              column's length, a non-negative integer, a UUID or bytea
+//   tokenize   text only: tok_ plus 16 base32 characters; -mask-vault
+//              writes token,value pairs to a local CSV for detokenization
+//   fake       format preserving: letters become random letters of the same
+//              case and digits random digits (emails, card and phone numbers
+//              keep their shape), dates and timestamps move up to 180 days,
+//              and booleans are drawn at random
+// Every rule but nullify is keyed with -mask-key (default $LOADER_MASK_KEY)
+// and depends only on the key and the original value, so the same customer
+// masks to the same value in every table and every run: joins, unique
+// constraints and GROUP BY keep working. Arrays are masked element by
+// element. Rules apply to file and introspect sources; IMPORT INTO and
+// MySQL LOAD DATA read files server side and can't be masked. The rules
+// can also live in a load plan (-config) as a map:
+//
+//   staging-refresh:
+//     mask: {email: hash, card_number: fake, customer_name: tokenize, notes: nullify}
+//
+//   LOADER_MASK_KEY=... go run ./cmd/prod_loader -mode=all -source=csv -file=prod_extract.csv -mask email=hash,card_number=fake
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maskRules are the supported -mask rules.
+var maskRules = []string{"nullify", "hash", "tokenize", "fake"}
+
+// maskedColumn is one -mask rule bound to its position in the source.
+type maskedColumn struct {
+	name    string
+	rule    string
+	index   int
+	pgType  string // regtype name, e.g. "character varying"
+	maxLen  int    // varchar(n)/char(n) length, 0 = unlimited
+	notNull bool
+}
+
+// maskedSource applies the -mask rules to the rows of another source.
+type maskedSource struct {
+	Source
+	columns []maskedColumn
+	key     []byte
+	vault   *csv.Writer
+	vaultF  *os.File
+	tokens  map[string]bool // Tokens already in the vault
+}
+
+// wrapMasking returns src unchanged without -mask rules.
+func wrapMasking(ctx context.Context, pool *pgxpool.Pool, src Source) (Source, error) {
+	if len(config.Mask) == 0 {
+		return src, nil
+	}
+	key := config.MaskKey
+	if key == "" {
+		key = os.Getenv("LOADER_MASK_KEY")
+	}
+	m := &maskedSource{Source: src, key: []byte(key)}
+
+	position := make(map[string]int)
+	for i, col := range src.Columns() {
+		position[col] = i
+	}
+	names := make([]string, 0, len(config.Mask))
+	for name := range config.Mask {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	needKey := false
+	for _, name := range names {
+		rule := config.Mask[name]
+		index, ok := position[name]
+		if !ok {
+			return nil, fmt.Errorf("-mask %s: not a loaded column (columns: %s)", name, strings.Join(src.Columns(), ", "))
+		}
+		c := maskedColumn{name: name, rule: rule, index: index}
+		err := pool.QueryRow(ctx, `
+			SELECT atttypid::regtype::text,
+			       CASE WHEN atttypid IN ('varchar'::regtype, 'bpchar'::regtype) AND atttypmod > 4 THEN atttypmod - 4 ELSE 0 END,
+			       attnotnull
+			FROM pg_attribute
+			WHERE attrelid = $1::regclass AND attname = $2 AND NOT attisdropped
+		`, config.TableName, name).Scan(&c.pgType, &c.maxLen, &c.notNull)
+		if err != nil {
+			return nil, fmt.Errorf("-mask %s: %w", name, err)
+		}
+		if err := c.check(); err != nil {
+			return nil, fmt.Errorf("-mask %s=%s: %w", name, rule, err)
+		}
+		if rule == "nullify" && c.notNull {
+			fmt.Printf("⚠️  -mask %s=nullify: the column is NOT NULL, rows will fail (see -log-bad-rows)\n", name)
+		}
+		needKey = needKey || rule != "nullify"
+		m.columns = append(m.columns, c)
+	}
+	if needKey && len(m.key) == 0 {
+		return nil, fmt.Errorf("-mask: hash, tokenize and fake need -mask-key (or LOADER_MASK_KEY), otherwise masked values can be recomputed from guesses")
+	}
+
+	if config.MaskVault != "" {
+		f, err := os.OpenFile(config.MaskVault, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("-mask-vault: %w", err)
+		}
+		m.vaultF, m.vault, m.tokens = f, csv.NewWriter(f), make(map[string]bool)
+		m.vault.Write([]string{"column", "token", "value"})
+	}
+
+	rules := make([]string, len(m.columns))
+	for i, c := range m.columns {
+		rules[i] = c.name + "=" + c.rule
+	}
+	fmt.Printf("🎭 Masking: %s\n", strings.Join(rules, ", "))
+	return m, nil
+}
+
+// check rejects rules that can't keep the column's type.
+func (c *maskedColumn) check() error {
+	if !slices.Contains(maskRules, c.rule) {
+		return fmt.Errorf("unknown rule (use %s)", strings.Join(maskRules, ", "))
+	}
+	base := strings.TrimSuffix(c.pgType, "[]")
+	switch {
+	case c.rule == "nullify":
+		return nil
+	case base == "json" || base == "jsonb":
+		return fmt.Errorf("JSON columns can only be nullified")
+	case c.rule == "tokenize" && !textType(base):
+		return fmt.Errorf("tokenize needs a text column, not %s", c.pgType)
+	case c.rule == "tokenize" && c.maxLen > 0 && c.maxLen < 20:
+		return fmt.Errorf("tokens are 20 characters, %s is %s(%d)", c.name, base, c.maxLen)
+	case c.rule == "hash" && !textType(base) && !isInteger(base) && base != "uuid" && base != "bytea":
+		return fmt.Errorf("hash keeps text, integer, uuid and bytea columns, not %s (use fake or nullify)", c.pgType)
+	case c.rule == "fake" && base == "bytea":
+		return fmt.Errorf("fake doesn't apply to bytea (use hash or nullify)")
+	}
+	return nil
+}
+
+func (m *maskedSource) Next() ([]interface{}, error) {
+	row, err := m.Source.Next()
+	if err != nil {
+		return nil, err
+	}
+	for i := range m.columns {
+		c := &m.columns[i]
+		if c.rule == "nullify" {
+			row[c.index] = nil
+			continue
+		}
+		if elems, ok := row[c.index].([]string); ok {
+			masked := make([]string, len(elems))
+			for j, e := range elems {
+				v, err := m.mask(c, e)
+				if err != nil {
+					return nil, err
+				}
+				masked[j] = v.(string)
+			}
+			row[c.index] = masked
+			continue
+		}
+		if row[c.index], err = m.mask(c, row[c.index]); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+func (m *maskedSource) Close() error {
+	err := m.Source.Close()
+	if m.vault != nil {
+		m.vault.Flush()
+		if werr := m.vault.Error(); werr != nil && err == nil {
+			err = werr
+		}
+		if cerr := m.vaultF.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		fmt.Printf("🔐 Token vault %s: %d tokens\n", config.MaskVault, len(m.tokens))
+	}
+	return err
+}
+
+// mask applies c's rule to one non-array value.
+func (m *maskedSource) mask(c *maskedColumn, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	digest := m.digest(v)
+	switch c.rule {
+	case "hash":
+		return hashValue(c, v, digest)
+	case "tokenize":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("-mask %s=tokenize: %T is not text", c.name, v)
+		}
+		token := "tok_" + strings.ToLower(base32.StdEncoding.EncodeToString(digest[:10]))
+		if m.vault != nil && !m.tokens[c.name+" "+token] {
+			m.tokens[c.name+" "+token] = true
+			m.vault.Write([]string{c.name, token, s})
+		}
+		return token, nil
+	default:
+		return fakeValue(c, v, rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(digest)))))
+	}
+}
+
+// digest is the keyed hash of a value's text form.
+func (m *maskedSource) digest(v interface{}) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte(maskText(v)))
+	return h.Sum(nil)
+}
+
+// maskText renders a source value as text, the same way for every source.
+func maskText(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case uuid.UUID:
+		return x.String()
+	case pgtype.Numeric:
+		if s, err := x.Value(); err == nil && s != nil {
+			return s.(string)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+// hashValue turns a digest into a value of the column's type.
+func hashValue(c *maskedColumn, v interface{}, digest []byte) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		s := hex.EncodeToString(digest)
+		if c.maxLen > 0 && c.maxLen < len(s) {
+			s = s[:c.maxLen]
+		}
+		return s, nil
+	case []byte:
+		return digest, nil
+	case int64:
+		n := int64(binary.BigEndian.Uint64(digest) >> 1)
+		switch strings.TrimSuffix(c.pgType, "[]") {
+		case "smallint":
+			n %= 1 << 15
+		case "integer":
+			n %= 1 << 31
+		}
+		return n, nil
+	case uuid.UUID:
+		var id uuid.UUID
+		copy(id[:], digest)
+		id[6] = id[6]&0x0f | 0x80 // Version 8: custom
+		id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+		return id, nil
+	default:
+		return nil, fmt.Errorf("-mask %s=hash: can't hash %T", c.name, x)
+	}
+}
+
+// fakeValue replaces v with a random value of the same shape, drawn from r.
+func fakeValue(c *maskedColumn, v interface{}, r *rand.Rand) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		return fakeText(x, r), nil
+	case int64:
+		s := fakeText(strconv.FormatInt(x, 10), r)
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || (c.pgType == "smallint" && (n > 1<<15-1 || n < -1<<15)) ||
+			(c.pgType == "integer" && (n > 1<<31-1 || n < -1<<31)) {
+			// The same number of digits would overflow, stay below x
+			if x < 0 {
+				return -r.Int63n(-x), nil
+			}
+			return r.Int63n(x), nil
+		}
+		return n, nil
+	case float64:
+		return strconv.ParseFloat(fakeText(strconv.FormatFloat(x, 'f', -1, 64), r), 64)
+	case pgtype.Numeric:
+		return coerceValue(fakeText(maskText(x), r), "numeric")
+	case bool:
+		return r.Intn(2) == 0, nil
+	case time.Time:
+		return x.AddDate(0, 0, r.Intn(361)-180), nil
+	case uuid.UUID:
+		var id uuid.UUID
+		r.Read(id[:])
+		id[6] = id[6]&0x0f | 0x40
+		id[8] = id[8]&0x3f | 0x80
+		return id, nil
+	default:
+		return nil, fmt.Errorf("-mask %s=fake: can't fake %T", c.name, x)
+	}
+}
+
+// fakeText keeps the shape of s: letters stay letters of the same case,
+// digits stay digits (a leading digit stays non-zero), the rest is kept.
+func fakeText(s string, r *rand.Rand) string {
+	out := []rune(s)
+	leading := true
+	for i, ch := range out {
+		switch {
+		case ch >= 'a' && ch <= 'z':
+			out[i] = rune('a' + r.Intn(26))
+		case ch >= 'A' && ch <= 'Z':
+			out[i] = rune('A' + r.Intn(26))
+		case ch >= '0' && ch <= '9':
+			if leading && ch != '0' {
+				out[i] = rune('1' + r.Intn(9))
+			} else {
+				out[i] = rune('0' + r.Intn(10))
+			}
+		case ch > 0x7f:
+			out[i] = rune('a' + r.Intn(26)) // Names in other scripts
+		}
+		leading = ch < '0' || ch > '9'
+	}
+	return string(out)
+}
+
+// textType reports whether a base type holds free text.
+func textType(t string) bool {
+	return t == "text" || t == "character varying" || t == "character"
+}
+
+// isInteger reports whether a base type is an integer type.
+func isInteger(t string) bool {
+	return t == "smallint" || t == "integer" || t == "bigint"
+}
@@ -0,0 +1,763 @@
+package bulkload
+
+// ============================================================================
+// MYSQL BACKEND (-backend=mysql, LOAD DATA LOCAL INFILE)
+// ============================================================================
+//
+// The same pipeline for MySQL 8 / InnoDB fleets, with MySQL's equivalents:
+//   create-schema  financial_transactions in MySQL types (JSON for metadata
+//                  and tags, DECIMAL for money, TIMESTAMP(6) in UTC)
+//   prepare        drop secondary indexes (InnoDB ignores DISABLE KEYS; a
+//                  MyISAM table gets DISABLE KEYS) and foreign keys,
+//                  TRUNCATE, and with -unlogged
+//                  ALTER INSTANCE DISABLE INNODB REDO_LOG (8.0.21+)
+//   load           LOAD DATA LOCAL INFILE, one statement per -batch-size
+//                  batch on each of -goroutines connections, streamed from
+//                  the generator; sessions run with unique_checks=0 and
+//                  foreign_key_checks=0. -source=csv loads a local file in
+//                  one LOAD DATA. -log-bad-rows adds IGNORE: rows that
+//                  don't convert are skipped with a warning and counted
+//                  as failed instead of aborting the batch.
+//   finalize       logged: re-enable the redo log; indexes: one ALTER TABLE
+//                  adding every index (sorted builds, -index-parallelism
+//                  innodb_ddl_threads, -index-mem innodb_ddl_buffer_size);
+//                  analyze: ANALYZE TABLE. autovacuum/vacuum have no
+//                  equivalent.
+// The report's WAL line is the InnoDB redo written (Innodb_os_log_written).
+//
+// The redo log switch is instance-wide: until finalize re-enables it, a
+// crash loses every table on the server, not just this one. The server
+// needs local_infile=ON. -dsn is a Go MySQL driver DSN (or secret://...):
+//
+//   go run ./cmd/prod_loader -backend=mysql -dsn="loader:pw@tcp(mysql:3306)/avro" -mode=all
+//   go run ./cmd/prod_loader -backend=mysql -mode=load -source=csv -file=extract.csv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+)
+
+const createMySQLTableSQL = `
+CREATE TABLE financial_transactions (
+    transaction_id      BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    external_txn_id     CHAR(36) NOT NULL,
+    correlation_id      VARCHAR(100),
+    transaction_date    DATE NOT NULL,
+    transaction_time    TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    settlement_date     DATE,
+    created_at          TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+    updated_at          TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+    amount              DECIMAL(15,2) NOT NULL CHECK (amount >= 0),
+    currency            CHAR(3) NOT NULL DEFAULT 'USD',
+    exchange_rate       DECIMAL(10,6),
+    amount_usd          DECIMAL(15,2),
+    fee_amount          DECIMAL(15,2) DEFAULT 0,
+    tax_amount          DECIMAL(15,2) DEFAULT 0,
+    transaction_type    VARCHAR(50) NOT NULL,
+    transaction_status  VARCHAR(20) NOT NULL DEFAULT 'pending',
+    payment_method      VARCHAR(50),
+    merchant_category   VARCHAR(10),
+    account_id          BIGINT NOT NULL,
+    customer_id         BIGINT NOT NULL,
+    merchant_id         BIGINT,
+    country_code        CHAR(2),
+    region              VARCHAR(50),
+    city                VARCHAR(100),
+    risk_score          DECIMAL(5,2) CHECK (risk_score BETWEEN 0 AND 100),
+    is_flagged          BOOLEAN DEFAULT FALSE,
+    fraud_check_status  VARCHAR(20),
+    metadata            JSON,
+    tags                JSON,
+    processed_by        VARCHAR(100),
+    processing_duration_ms INT,
+    is_deleted          BOOLEAN DEFAULT FALSE,
+    deleted_at          TIMESTAMP(6) NULL,
+    UNIQUE KEY financial_transactions_external_txn_id_key (external_txn_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`
+
+// mysqlIndexes are financialIndexes in MySQL terms: partial indexes become
+// full ones, the tags GIN index a multi-valued index, and there is no
+// equivalent for the metadata GIN index or the is_deleted partial index.
+var mysqlIndexes = []indexDef{
+	{"idx_txn_date", "(transaction_date)"},
+	{"idx_txn_status", "(transaction_status)"},
+	{"idx_txn_customer", "(customer_id)"},
+	{"idx_txn_account", "(account_id)"},
+	{"idx_txn_created_at", "(created_at)"},
+	{"idx_txn_amount", "(amount)"},
+	{"idx_txn_tags", "((CAST(tags AS CHAR(64) ARRAY)))"},
+}
+
+// runMySQL runs mode against MySQL instead of PostgreSQL.
+func runMySQL(ctx context.Context, mode string) error {
+	db, err := openMySQL(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT version()").Scan(&version); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Connected to MySQL %s\n", version)
+	fmt.Printf("Configuration: %d rows, %d goroutines, batch size %d\n",
+		config.TotalRows, config.Goroutines, config.BatchSize)
+
+	metrics := NewLoadMetrics()
+	metrics.TotalRows = config.TotalRows
+
+	switch mode {
+	case "create-schema":
+		return createMySQLSchema(ctx, db)
+	case "prepare":
+		return prepareMySQL(ctx, db)
+	case "load":
+		if err := loadMySQL(ctx, db, metrics); err != nil {
+			return err
+		}
+		metrics.Finalize()
+		metrics.PrintReport()
+	case "finalize":
+		return finalizeMySQL(ctx, db)
+	case "all":
+		if !config.Resume && config.CreateSchema {
+			if err := createMySQLSchema(ctx, db); err != nil {
+				return err
+			}
+		}
+		if err := prepareMySQL(ctx, db); err != nil {
+			return err
+		}
+		if err := loadMySQL(ctx, db, metrics); err != nil {
+			return err
+		}
+		if err := finalizeMySQL(ctx, db); err != nil {
+			return err
+		}
+		metrics.Finalize()
+		metrics.PrintReport()
+	default:
+		return fmt.Errorf("-backend=mysql supports -mode=create-schema, prepare, load, finalize and all")
+	}
+	return nil
+}
+
+// openMySQL connects with the session settings every load connection needs.
+func openMySQL(ctx context.Context) (*sql.DB, error) {
+	dsn := config.DBConnString
+	if ref, ok := strings.CutPrefix(dsn, "secret://"); ok {
+		var err error
+		if dsn, err = fetchSecretDSN(ctx, ref); err != nil {
+			return nil, fmt.Errorf("secret://%s: %w", ref, err)
+		}
+		fmt.Printf("🔐 Connection string read from secret://%s\n", ref)
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("-backend=mysql needs -dsn, e.g. loader:pw@tcp(mysql:3306)/avro")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL DSN: %w", err)
+	}
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+	// Sent as SET statements on every new connection.
+	cfg.Params["unique_checks"] = "0"
+	cfg.Params["foreign_key_checks"] = "0"
+	cfg.Params["time_zone"] = "'+00:00'"
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(config.Goroutines + 2)
+	db.SetMaxIdleConns(config.Goroutines + 2)
+	db.SetConnMaxLifetime(time.Hour)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping MySQL: %w", err)
+	}
+	return db, nil
+}
+
+func createMySQLSchema(ctx context.Context, db *sql.DB) error {
+	defer beginPhase("create-schema")()
+
+	fmt.Println("\n📋 Creating production-grade table schema (MySQL)...")
+	for _, stmt := range []string{
+		"DROP TABLE IF EXISTS financial_transactions",
+		createMySQLTableSQL,
+	} {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to create schema: %w", err)
+		}
+	}
+	for _, idx := range mysqlIndexes {
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE INDEX %s ON financial_transactions %s", idx.name, idx.def)); err != nil {
+			return fmt.Errorf("failed to create %s: %w", idx.name, err)
+		}
+	}
+	fmt.Println("✅ Schema created successfully")
+	return nil
+}
+
+func prepareMySQL(ctx context.Context, db *sql.DB) error {
+	defer beginPhase("prepare")()
+
+	fmt.Println("\n🔧 PHASE 1: PREPARING MYSQL FOR BULK LOAD")
+	fmt.Println(strings.Repeat("=", 80))
+
+	var engine string
+	if err := db.QueryRowContext(ctx, `
+		SELECT engine FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = ?
+	`, config.TableName).Scan(&engine); err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", config.TableName, err)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+		off  bool
+	}{
+		{
+			name: "1. Drop secondary indexes (InnoDB) / DISABLE KEYS (MyISAM)",
+			run: func() error {
+				if !strings.EqualFold(engine, "InnoDB") {
+					_, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DISABLE KEYS", config.TableName))
+					return err
+				}
+				names, err := mysqlNames(ctx, db, `
+					SELECT DISTINCT index_name FROM information_schema.statistics
+					WHERE table_schema = DATABASE() AND table_name = ? AND non_unique = 1
+				`)
+				if err != nil || len(names) == 0 {
+					return err
+				}
+				drops := make([]string, len(names))
+				for i, name := range names {
+					drops[i] = "DROP INDEX " + mysqlIdent(name)
+				}
+				_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s %s", config.TableName, strings.Join(drops, ", ")))
+				return err
+			},
+			off: !config.DropIndexes,
+		},
+		{
+			name: "2. Drop foreign key constraints (if any)",
+			run: func() error {
+				names, err := mysqlNames(ctx, db, `
+					SELECT constraint_name FROM information_schema.table_constraints
+					WHERE table_schema = DATABASE() AND table_name = ? AND constraint_type = 'FOREIGN KEY'
+				`)
+				for _, name := range names {
+					if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", config.TableName, mysqlIdent(name))); err != nil {
+						return err
+					}
+				}
+				return err
+			},
+			off: !config.DropIndexes,
+		},
+		{
+			name: "3. Truncate target table",
+			run: func() error {
+				_, err := db.ExecContext(ctx, fmt.Sprintf("TRUNCATE TABLE %s", config.TableName))
+				return err
+			},
+			off: !config.Truncate || config.Resume,
+		},
+		{
+			name: "4. Disable the InnoDB redo log (instance-wide, no crash safety)",
+			run: func() error {
+				_, err := db.ExecContext(ctx, "ALTER INSTANCE DISABLE INNODB REDO_LOG")
+				return err
+			},
+			off: !config.Unlogged,
+		},
+	}
+
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		if step.off {
+			fmt.Println(" ⏭️  (off in this load plan)")
+			continue
+		}
+		if err := step.run(); err != nil {
+			fmt.Printf(" ⚠️  (skipped: %v)\n", err)
+		} else {
+			fmt.Println(" ✅")
+		}
+	}
+	fmt.Println("   unique_checks=0, foreign_key_checks=0 on every load session")
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+func loadMySQL(ctx context.Context, db *sql.DB, metrics *LoadMetrics) error {
+	defer beginPhase("load")()
+
+	fmt.Println("\n🚀 PHASE 2: EXECUTING PARALLEL LOAD DATA")
+	fmt.Println(strings.Repeat("=", 80))
+
+	metrics.PreLoadTableSize = mysqlTableSize(ctx, db)
+	metrics.WALGenerated = "unknown"
+	startRedo := mysqlRedoWritten(ctx, db)
+	fmt.Printf("Pre-load table size: %s\n", metrics.PreLoadTableSize)
+
+	var err error
+	switch config.Source {
+	case "generate":
+		err = loadMySQLGenerated(ctx, db, metrics)
+	case "csv":
+		if len(config.Mask) > 0 {
+			return fmt.Errorf("-mask: LOAD DATA reads the file as is, mask it with -backend=postgres or beforehand")
+		}
+		err = loadMySQLFile(ctx, db, metrics)
+	default:
+		err = fmt.Errorf("-backend=mysql loads -source=generate or csv, not %s", config.Source)
+	}
+	if err != nil {
+		return err
+	}
+
+	metrics.PostLoadTableSize = mysqlTableSize(ctx, db)
+	if startRedo >= 0 {
+		if endRedo := mysqlRedoWritten(ctx, db); endRedo >= startRedo {
+			metrics.WALGenerated = formatBytes(endRedo-startRedo) + " (InnoDB redo)"
+		}
+	}
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+func loadMySQLGenerated(ctx context.Context, db *sql.DB, metrics *LoadMetrics) error {
+	rowsPerGoroutine := config.TotalRows / int64(config.Goroutines)
+
+	var wg sync.WaitGroup
+	errs := make([]error, config.Goroutines)
+	for g := 0; g < config.Goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			if errs[g] = loadMySQLGoroutine(ctx, db, g, rowsPerGoroutine, metrics); errs[g] != nil {
+				metrics.RecordError(g)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g, err := range errs {
+		if err != nil {
+			return fmt.Errorf("goroutine %d failed: %w", g, err)
+		}
+	}
+	return nil
+}
+
+// loadMySQLGoroutine sends rowCount generated rows as LOAD DATA batches
+// over one connection.
+func loadMySQLGoroutine(ctx context.Context, db *sql.DB, goroutineID int, rowCount int64, metrics *LoadMetrics) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	fmt.Printf("   🔄 Goroutine %d: Starting load of %d rows\n", goroutineID, rowCount)
+
+	gen := &transactionGenerator{
+		totalRows:   rowCount,
+		rowOffset:   int64(goroutineID) * rowCount,
+		goroutineID: goroutineID,
+		metrics:     metrics,
+	}
+	handler := fmt.Sprintf("gen_%d", goroutineID)
+	defer mysql.DeregisterReaderHandler(handler)
+
+	var loaded int64
+	var buf bytes.Buffer
+	for gen.currentRow < rowCount {
+		buf.Reset()
+		sent := int64(0)
+		for sent < int64(config.BatchSize) && gen.Next() {
+			values, err := gen.Values()
+			if err != nil {
+				return err
+			}
+			writeMySQLRow(&buf, values)
+			sent++
+		}
+		if sent == 0 {
+			break
+		}
+
+		data := buf.Bytes()
+		mysql.RegisterReaderHandler(handler, func() io.Reader { return bytes.NewReader(data) })
+		res, err := conn.ExecContext(ctx, loadDataSQL("Reader::"+handler, generatedColumns,
+			"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n'", nil))
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		recordLoadData(metrics, goroutineID, sent, n)
+		loaded += n
+	}
+
+	duration := time.Since(start)
+	fmt.Printf("   ✅ Goroutine %d: Completed %d rows in %v (%.0f rows/sec)\n",
+		goroutineID, loaded, duration, float64(loaded)/duration.Seconds())
+	return nil
+}
+
+// loadMySQLFile loads a local CSV file with a single LOAD DATA.
+func loadMySQLFile(ctx context.Context, db *sql.DB, metrics *LoadMetrics) error {
+	if strings.Contains(config.SourceFile, "://") || config.Compression == "gzip" || config.Compression == "zstd" ||
+		strings.HasSuffix(config.SourceFile, ".gz") || strings.HasSuffix(config.SourceFile, ".zst") {
+		return fmt.Errorf("-backend=mysql loads plain local files; decompress/download %s first", config.SourceFile)
+	}
+	delimiter := config.Delimiter
+	if delimiter == `\t` {
+		delimiter = "\t"
+	}
+
+	columns := config.SourceColumns
+	if len(columns) == 0 {
+		if !config.Header {
+			return fmt.Errorf("-columns is required when the file has no header")
+		}
+		f, err := os.Open(config.SourceFile)
+		if err != nil {
+			return err
+		}
+		r := csv.NewReader(bufio.NewReader(f))
+		r.Comma = []rune(delimiter)[0]
+		columns, err = r.Read()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read the header of %s: %w", config.SourceFile, err)
+		}
+	}
+	fmt.Printf("Source: %s (csv via LOAD DATA LOCAL INFILE), columns: %s\n", config.SourceFile, strings.Join(columns, ", "))
+
+	mysql.RegisterLocalFile(config.SourceFile)
+	defer mysql.DeregisterLocalFile(config.SourceFile)
+
+	format := fmt.Sprintf("FIELDS TERMINATED BY %s OPTIONALLY ENCLOSED BY '\"' ESCAPED BY '' LINES TERMINATED BY '\\n'",
+		mysqlString(delimiter))
+	if config.Header {
+		format += " IGNORE 1 LINES"
+	}
+	start := time.Now()
+	res, err := db.ExecContext(ctx, loadDataSQL(config.SourceFile, columns, format, &config.NullToken))
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	// Rows sent aren't known without reading the file; count the warnings.
+	var skipped int64
+	if config.LogBadRows {
+		db.QueryRowContext(ctx, "SELECT @@warning_count").Scan(&skipped)
+	}
+	recordLoadData(metrics, 0, n+skipped, n)
+	fmt.Printf("   ✅ Loaded %d rows in %v\n", n, time.Since(start))
+	return nil
+}
+
+// loadDataSQL builds LOAD DATA LOCAL INFILE for file into columns. With
+// nullToken, fields equal to it load as NULL (CSV files have no \N).
+func loadDataSQL(file string, columns []string, format string, nullToken *string) string {
+	var b strings.Builder
+	b.WriteString("LOAD DATA LOCAL INFILE " + mysqlString(file))
+	if config.LogBadRows {
+		b.WriteString(" IGNORE")
+	}
+	fmt.Fprintf(&b, " INTO TABLE %s CHARACTER SET utf8mb4 %s", mysqlIdent(config.TableName), format)
+
+	targets := make([]string, len(columns))
+	var sets []string
+	for i, col := range columns {
+		if nullToken == nil {
+			targets[i] = mysqlIdent(col)
+			continue
+		}
+		targets[i] = fmt.Sprintf("@c%d", i)
+		sets = append(sets, fmt.Sprintf("%s = NULLIF(@c%d, %s)", mysqlIdent(col), i, mysqlString(*nullToken)))
+	}
+	b.WriteString(" (" + strings.Join(targets, ", ") + ")")
+	if len(sets) > 0 {
+		b.WriteString(" SET " + strings.Join(sets, ", "))
+	}
+	return b.String()
+}
+
+// recordLoadData books one LOAD DATA statement: rows loaded, and rows
+// skipped by IGNORE as failed.
+func recordLoadData(metrics *LoadMetrics, goroutineID int, sent, loaded int64) {
+	metrics.RecordSuccess(goroutineID, loaded)
+	if skipped := sent - loaded; skipped > 0 {
+		metrics.mu.Lock()
+		metrics.FailedRows += skipped
+		metrics.mu.Unlock()
+	}
+}
+
+// writeMySQLRow appends generated values as one tab separated line in LOAD
+// DATA's default escaping (\N for NULL, backslash escapes). Dates and
+// decimals are cut to the column's type so strict mode has nothing to
+// truncate.
+func writeMySQLRow(buf *bytes.Buffer, values []interface{}) {
+	for i, v := range values {
+		typ := generatedColumnTypes[generatedColumns[i]]
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+		if v == nil {
+			buf.WriteString(`\N`)
+			continue
+		}
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case uuid.UUID:
+			s = v.String()
+		case time.Time:
+			if typ == "date" {
+				s = v.Format("2006-01-02")
+			} else {
+				s = v.UTC().Format("2006-01-02 15:04:05.999999")
+			}
+		case float64:
+			_, scale := numericTypmod(typ)
+			s = strconv.FormatFloat(v, 'f', scale, 64)
+		case bool:
+			s = "0"
+			if v {
+				s = "1"
+			}
+		case []string:
+			b, _ := json.Marshal(v)
+			s = string(b)
+		default:
+			s = fmt.Sprint(v)
+		}
+		for j := 0; j < len(s); j++ {
+			switch c := s[j]; c {
+			case '\\':
+				buf.WriteString(`\\`)
+			case '\t':
+				buf.WriteString(`\t`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+func finalizeMySQL(ctx context.Context, db *sql.DB) error {
+	defer beginPhase("finalize")()
+
+	fmt.Println("\n🔨 PHASE 3: POST-LOAD FINALIZATION (MYSQL)")
+	fmt.Println(strings.Repeat("=", 80))
+
+	steps := []struct {
+		key  string
+		name string
+		run  func() error
+	}{
+		{
+			key:  "logged",
+			name: "1. Re-enable the InnoDB redo log",
+			run: func() error {
+				var enabled string
+				err := db.QueryRowContext(ctx, "SELECT variable_value FROM performance_schema.global_status WHERE variable_name = 'Innodb_redo_log_enabled'").Scan(&enabled)
+				if err == nil && enabled == "ON" {
+					return nil
+				}
+				_, err = db.ExecContext(ctx, "ALTER INSTANCE ENABLE INNODB REDO_LOG")
+				return err
+			},
+		},
+		{
+			key:  "indexes",
+			name: "2. Rebuild indexes (one ALTER TABLE, sorted builds)",
+			run:  func() error { return buildMySQLIndexes(ctx, db) },
+		},
+		{
+			key:  "analyze",
+			name: "3. Run ANALYZE TABLE to update statistics",
+			run: func() error {
+				rows, err := db.QueryContext(ctx, "ANALYZE TABLE "+mysqlIdent(config.TableName))
+				if err != nil {
+					return err
+				}
+				defer rows.Close()
+				for rows.Next() {
+				}
+				return rows.Err()
+			},
+		},
+	}
+
+	var finalizeErr error
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		if !want(step.key) {
+			fmt.Println(" ⏭️  (off in this load plan)")
+			continue
+		}
+		start := time.Now()
+		if err := step.run(); err != nil {
+			fmt.Printf(" ⚠️  (error: %v)\n", err)
+			if step.key != "analyze" {
+				finalizeErr = err
+			}
+		} else {
+			fmt.Printf(" ✅ (took %v)\n", time.Since(start))
+		}
+	}
+	fmt.Println("   autovacuum and VACUUM: ⏭️  (no MySQL equivalent; purge runs continuously)")
+	fmt.Println(strings.Repeat("=", 80))
+	return finalizeErr
+}
+
+// buildMySQLIndexes re-enables MyISAM keys, or adds the missing InnoDB
+// indexes in one ALTER TABLE so the table is scanned once.
+func buildMySQLIndexes(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var engine string
+	if err := conn.QueryRowContext(ctx, `
+		SELECT engine FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = ?
+	`, config.TableName).Scan(&engine); err != nil {
+		return err
+	}
+	if !strings.EqualFold(engine, "InnoDB") {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ENABLE KEYS", config.TableName))
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT DISTINCT index_name FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ?
+	`, config.TableName)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	var adds []string
+	for _, idx := range mysqlIndexes {
+		if !existing[idx.name] {
+			adds = append(adds, fmt.Sprintf("ADD INDEX %s %s", idx.name, idx.def))
+		}
+	}
+	if len(adds) == 0 {
+		fmt.Print(" (all indexes exist)")
+		return nil
+	}
+
+	// Parallel sorted index builds, MySQL 8.0.27+; older servers ignore the miss.
+	if mem, err := parseByteSize(config.IndexMem); err == nil {
+		conn.ExecContext(ctx, fmt.Sprintf("SET SESSION innodb_ddl_buffer_size = %d", mem))
+	}
+	conn.ExecContext(ctx, fmt.Sprintf("SET SESSION innodb_ddl_threads = %d", max(1, config.IndexParallelism)))
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s %s", config.TableName, strings.Join(adds, ", ")))
+	return err
+}
+
+// mysqlNames runs a one-column query with config.TableName as the argument.
+func mysqlNames(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, config.TableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// mysqlTableSize is data plus indexes from information_schema (refreshed
+// by ANALYZE TABLE, so it lags during the load).
+func mysqlTableSize(ctx context.Context, db *sql.DB) string {
+	var size int64
+	err := db.QueryRowContext(ctx, `
+		SELECT coalesce(data_length + index_length, 0) FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = ?
+	`, config.TableName).Scan(&size)
+	if err != nil {
+		return "unknown"
+	}
+	return formatBytes(size)
+}
+
+// mysqlRedoWritten returns Innodb_os_log_written, or -1.
+func mysqlRedoWritten(ctx context.Context, db *sql.DB) int64 {
+	var written int64
+	err := db.QueryRowContext(ctx, `
+		SELECT variable_value FROM performance_schema.global_status
+		WHERE variable_name = 'Innodb_os_log_written'
+	`).Scan(&written)
+	if err != nil {
+		return -1
+	}
+	return written
+}
+
+// mysqlIdent quotes an identifier with backticks.
+func mysqlIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// mysqlString quotes a string literal (backslashes are escapes in MySQL).
+func mysqlString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\t", `\t`, "\n", `\n`)
+	return "'" + r.Replace(s) + "'"
+}
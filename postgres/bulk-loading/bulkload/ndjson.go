@@ -0,0 +1,161 @@
+package bulkload
+
+// ============================================================================
+// NDJSON / JSONL SOURCE (-source=ndjson)
+// ============================================================================
+//
+// One JSON object per line, e.g. application event dumps. Top-level fields
+// map to columns by name (-field-map=field=column,... renames them). Without
+// -columns the column list is taken from the first object.
+//
+// Fields that don't map to a loaded column are not dropped: they are
+// collected into the -spill-column JSONB column (default "metadata"), merged
+// with any object the record already puts there. -spill-column="" disables
+// spilling.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type ndjsonSource struct {
+	file    io.ReadCloser
+	decoder *json.Decoder
+	columns []string
+	types   []string
+	index   map[string]int // Column -> position in the row
+	spill   int            // Position of the spill column, -1 if disabled
+	first   map[string]interface{}
+	record  int
+}
+
+func openNDJSONSource(ctx context.Context, path string, columns []string, types map[string]string) (*ndjsonSource, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-source=ndjson requires -file")
+	}
+
+	f, err := openInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bufio.NewReaderSize(f, 1<<20))
+	dec.UseNumber()
+	s := &ndjsonSource{file: f, decoder: dec, spill: -1}
+
+	if len(columns) == 0 {
+		// Infer the column list from the first object.
+		if err := dec.Decode(&s.first); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read first record: %w", err)
+		}
+		fields := make([]string, 0, len(s.first))
+		for field := range s.first {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			column := s.column(field)
+			if _, ok := types[column]; ok && column != config.SpillColumn {
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	if config.SpillColumn != "" {
+		if _, ok := types[config.SpillColumn]; !ok {
+			f.Close()
+			return nil, fmt.Errorf("spill column %q does not exist in %s", config.SpillColumn, config.TableName)
+		}
+		found := false
+		for _, col := range columns {
+			found = found || col == config.SpillColumn
+		}
+		if !found {
+			columns = append(columns, config.SpillColumn)
+		}
+	}
+
+	if err := checkColumns(columns, types); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.columns = columns
+	s.index = make(map[string]int, len(columns))
+	for i, col := range columns {
+		s.index[col] = i
+		s.types = append(s.types, types[col])
+		if col == config.SpillColumn {
+			s.spill = i
+		}
+	}
+	return s, nil
+}
+
+func (s *ndjsonSource) column(field string) string {
+	if mapped, ok := config.FieldMap[field]; ok {
+		return mapped
+	}
+	return field
+}
+
+func (s *ndjsonSource) Columns() []string {
+	return s.columns
+}
+
+func (s *ndjsonSource) Next() ([]interface{}, error) {
+	obj := s.first
+	s.first = nil
+	if obj == nil {
+		if err := s.decoder.Decode(&obj); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("record %d: %w", s.record+1, err)
+		}
+	}
+	s.record++
+
+	values := make([]interface{}, len(s.columns))
+	leftovers := make(map[string]interface{})
+	for field, v := range obj {
+		i, ok := s.index[s.column(field)]
+		if !ok {
+			leftovers[field] = v
+			continue
+		}
+		values[i] = v
+	}
+
+	if s.spill >= 0 && len(leftovers) > 0 {
+		if existing, ok := values[s.spill].(map[string]interface{}); ok {
+			for k, v := range leftovers {
+				if _, dup := existing[k]; !dup {
+					existing[k] = v
+				}
+			}
+		} else {
+			if values[s.spill] != nil {
+				leftovers[config.SpillColumn] = values[s.spill]
+			}
+			values[s.spill] = leftovers
+		}
+	}
+
+	row := make([]interface{}, len(s.columns))
+	for i, v := range values {
+		var err error
+		if row[i], err = coerceNative(v, s.types[i]); err != nil {
+			return nil, fmt.Errorf("record %d column %s: %w", s.record, s.columns[i], err)
+		}
+	}
+	return row, nil
+}
+
+func (s *ndjsonSource) Close() error {
+	return s.file.Close()
+}
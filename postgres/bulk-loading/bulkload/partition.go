@@ -0,0 +1,538 @@
+package bulkload
+
+// ============================================================================
+// PARTITION-AWARE LOADING (declaratively range-partitioned targets)
+// ============================================================================
+//
+// COPY into a partitioned parent works, but every row is routed by the
+// server and all goroutines contend on the same parent. When the target is
+// RANGE partitioned on a single date/timestamp column the loader instead:
+//   1. reads the partition bounds from the catalog
+//   2. creates the partitions missing for the loaded date range
+//      (-partition-interval=auto|daily|monthly, auto follows the existing
+//      partitions and defaults to monthly)
+//   3. COPYs each batch straight into its partition
+//
+// Generated rows cover the last 90 days of transaction_date; the range is cut
+// into per-partition work units that goroutines pick from a queue, so each
+// COPY targets one partition. File sources are routed batch by batch, and a
+// row outside every partition creates its partition on the fly.
+//
+// -mode=create-schema -partitioned=monthly|daily builds such a table from
+// createTableSQL, for comparing partitioned and monolithic layouts.
+//
+// Checkpointed loads (-checkpoint) keep COPYing into the parent so chunk ids
+// stay stable, as does -route-partitions=false; generated loads still
+// pre-create their partitions.
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// generatedDays is the transaction_date window of transactionGenerator.
+const generatedDays = 90
+
+type partitionInfo struct {
+	Name string
+	From time.Time // Inclusive; zero for MINVALUE
+	To   time.Time // Exclusive; zero for MAXVALUE
+}
+
+func (p partitionInfo) contains(t time.Time) bool {
+	return (p.From.IsZero() || !t.Before(p.From)) && (p.To.IsZero() || t.Before(p.To))
+}
+
+func (p partitionInfo) overlaps(from, to time.Time) bool {
+	return (p.From.IsZero() || p.From.Before(to)) && (p.To.IsZero() || p.To.After(from))
+}
+
+type partitionScheme struct {
+	Parent   string
+	Key      string
+	KeyType  string
+	Interval string // daily, monthly
+	Parts    []partitionInfo
+	mu       sync.Mutex
+}
+
+// partitions is set by detectPartitions when the target is range partitioned.
+var partitions *partitionScheme
+
+var boundPattern = regexp.MustCompile(`FROM \((.+)\) TO \((.+)\)`)
+
+// detectPartitions inspects config.TableName and, if it is partitioned in a
+// way we can route, sets partitions.
+func detectPartitions(ctx context.Context, pool *pgxpool.Pool) error {
+	partitions = nil
+	if cockroach() {
+		return nil // Ranges split by themselves
+	}
+
+	var strategy, key, keyType string
+	var nattrs int
+	err := pool.QueryRow(ctx, `
+		SELECT p.partstrat::text, p.partnatts, coalesce(a.attname::text, ''), coalesce(format_type(a.atttypid, NULL), '')
+		FROM pg_partitioned_table p
+		LEFT JOIN pg_attribute a ON a.attrelid = p.partrelid AND a.attnum = p.partattrs[0]
+		WHERE p.partrelid = $1::regclass
+	`, config.TableName).Scan(&strategy, &nattrs, &key, &keyType)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect partitioning of %s: %w", config.TableName, err)
+	}
+
+	if strategy != "r" || nattrs != 1 || key == "" {
+		fmt.Printf("ℹ️  %s is partitioned but not by RANGE on one column; the server routes rows\n", config.TableName)
+		return nil
+	}
+	switch keyType {
+	case "date", "timestamp without time zone", "timestamp with time zone":
+	default:
+		fmt.Printf("ℹ️  %s is partitioned on %s (%s), not a date; the server routes rows\n", config.TableName, key, keyType)
+		return nil
+	}
+
+	ps := &partitionScheme{Parent: config.TableName, Key: key, KeyType: keyType}
+	if err := ps.refresh(ctx, pool); err != nil {
+		return err
+	}
+
+	ps.Interval = config.PartitionInterval
+	if ps.Interval == "auto" {
+		ps.Interval = "monthly"
+		for _, p := range ps.Parts {
+			if !p.From.IsZero() && !p.To.IsZero() && p.To.Sub(p.From) <= 25*time.Hour {
+				ps.Interval = "daily"
+				break
+			}
+		}
+	}
+	if ps.Interval != "daily" && ps.Interval != "monthly" {
+		return fmt.Errorf("unknown partition interval %q (use auto, daily, monthly)", config.PartitionInterval)
+	}
+
+	fmt.Printf("🗂️  %s is RANGE partitioned on %s (%s): %d partitions, %s interval\n",
+		config.TableName, key, keyType, len(ps.Parts), ps.Interval)
+	partitions = ps
+	return nil
+}
+
+// refresh reloads the partition list and bounds from the catalog.
+func (ps *partitionScheme) refresh(ctx context.Context, pool *pgxpool.Pool) error {
+	rows, err := pool.Query(ctx, `
+		SELECT c.relname::text, pg_get_expr(c.relpartbound, c.oid)
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass
+	`, ps.Parent)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions of %s: %w", ps.Parent, err)
+	}
+	defer rows.Close()
+
+	var parts []partitionInfo
+	for rows.Next() {
+		var name, bound string
+		if err := rows.Scan(&name, &bound); err != nil {
+			return err
+		}
+		m := boundPattern.FindStringSubmatch(bound)
+		if m == nil {
+			continue // DEFAULT partition
+		}
+		from, err := parseBound(m[1])
+		if err != nil {
+			return fmt.Errorf("partition %s: %w", name, err)
+		}
+		to, err := parseBound(m[2])
+		if err != nil {
+			return fmt.Errorf("partition %s: %w", name, err)
+		}
+		parts = append(parts, partitionInfo{Name: name, From: from, To: to})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].From.Before(parts[j].From) })
+	ps.Parts = parts
+	return nil
+}
+
+// parseBound parses one range bound; MINVALUE/MAXVALUE give the zero time.
+func parseBound(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "MINVALUE" || s == "MAXVALUE" {
+		return time.Time{}, nil
+	}
+	s = strings.Trim(s, "'")
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported range bound %q", s)
+}
+
+// find returns the partition holding t, or nil.
+func (ps *partitionScheme) find(t time.Time) *partitionInfo {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for i := range ps.Parts {
+		if ps.Parts[i].contains(t) {
+			p := ps.Parts[i]
+			return &p
+		}
+	}
+	return nil
+}
+
+// slot returns the interval-aligned range [from, to) containing t.
+func (ps *partitionScheme) slot(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	if ps.Interval == "daily" {
+		from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 0, 1)
+	}
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 1, 0)
+}
+
+// ensureRange creates partitions so every instant in [from, to) has one.
+// Slots partly covered by existing partitions only get their gaps filled.
+func (ps *partitionScheme) ensureRange(ctx context.Context, pool *pgxpool.Pool, from, to time.Time) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	var created []string
+	for slotFrom, _ := ps.slot(from); slotFrom.Before(to); {
+		_, slotTo := ps.slot(slotFrom)
+		gapFrom := slotFrom
+		for _, p := range ps.Parts {
+			if !p.overlaps(gapFrom, slotTo) {
+				continue
+			}
+			if !p.From.IsZero() && p.From.After(gapFrom) {
+				name, err := ps.create(ctx, pool, gapFrom, p.From, slotFrom, slotTo)
+				if err != nil {
+					return err
+				}
+				created = append(created, name)
+			}
+			if p.To.IsZero() || !p.To.Before(slotTo) {
+				gapFrom = slotTo
+				break
+			}
+			gapFrom = p.To
+		}
+		if gapFrom.Before(slotTo) {
+			name, err := ps.create(ctx, pool, gapFrom, slotTo, slotFrom, slotTo)
+			if err != nil {
+				return err
+			}
+			created = append(created, name)
+		}
+		slotFrom = slotTo
+	}
+
+	if len(created) > 0 {
+		fmt.Printf("   🗂️  Created %d partitions: %s\n", len(created), strings.Join(created, ", "))
+		sort.Slice(ps.Parts, func(i, j int) bool { return ps.Parts[i].From.Before(ps.Parts[j].From) })
+	}
+	return nil
+}
+
+// create adds the partition [from, to). Full slots are named by the slot
+// (<table>_p202401, <table>_p20240115); gap fillers by their start day.
+func (ps *partitionScheme) create(ctx context.Context, pool *pgxpool.Pool, from, to, slotFrom, slotTo time.Time) (string, error) {
+	suffix := from.Format("20060102")
+	if ps.Interval == "monthly" && from.Equal(slotFrom) && to.Equal(slotTo) {
+		suffix = from.Format("200601")
+	}
+	name := fmt.Sprintf("%s_p%s", ps.Parent, suffix)
+
+	_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+		pgx.Identifier{name}.Sanitize(), pgx.Identifier{ps.Parent}.Sanitize(),
+		ps.boundLiteral(from), ps.boundLiteral(to)))
+	if err != nil {
+		return "", fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+	ps.Parts = append(ps.Parts, partitionInfo{Name: name, From: from, To: to})
+	return name, nil
+}
+
+func (ps *partitionScheme) boundLiteral(t time.Time) string {
+	switch ps.KeyType {
+	case "date":
+		return t.Format("2006-01-02")
+	case "timestamp with time zone":
+		return t.Format("2006-01-02 15:04:05-07")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// generatedKeyOffset is how far the partition key of a generated row is from
+// its transaction_date, or false if the generator doesn't fill the key.
+func generatedKeyOffset(key string) (int, bool) {
+	switch key {
+	case "transaction_date", "transaction_time":
+		return 0, true
+	case "settlement_date":
+		return 2, true
+	}
+	return 0, false
+}
+
+// generatedWindow is the transaction_date range the generator draws from.
+func generatedWindow() (time.Time, time.Time) {
+	now := generatorNow().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return today.AddDate(0, 0, -(generatedDays - 1)), today.AddDate(0, 0, 1)
+}
+
+// partitionUnit is one goroutine task: rows for a single partition, with
+// transaction_date drawn from [from, to).
+type partitionUnit struct {
+	partition string
+	from, to  time.Time
+	rows      int64
+	offset    int64 // Position of the unit's first row in the load (-seed)
+}
+
+// prepareGeneratedPartitions pre-creates the partitions for the generated
+// window and returns the work units, or nil when the key isn't generated.
+func prepareGeneratedPartitions(ctx context.Context, pool *pgxpool.Pool) ([]partitionUnit, error) {
+	offset, ok := generatedKeyOffset(partitions.Key)
+	if !ok {
+		fmt.Printf("ℹ️  Partition key %s is not generated by the loader; the server routes rows\n", partitions.Key)
+		return nil, nil
+	}
+
+	from, to := generatedWindow()
+	if err := partitions.ensureRange(ctx, pool, from.AddDate(0, 0, offset), to.AddDate(0, 0, offset)); err != nil {
+		return nil, err
+	}
+	if !config.RoutePartitions || config.Checkpoint {
+		return nil, nil
+	}
+
+	// Split the window at partition bounds; rows are spread evenly per day.
+	var units []partitionUnit
+	for day := from; day.Before(to); {
+		p := partitions.find(day.AddDate(0, 0, offset))
+		if p == nil {
+			return nil, fmt.Errorf("no partition for %s after pre-creating partitions", day.Format("2006-01-02"))
+		}
+		end := day.AddDate(0, 0, 1)
+		for end.Before(to) && p.contains(end.AddDate(0, 0, offset)) {
+			end = end.AddDate(0, 0, 1)
+		}
+		units = append(units, partitionUnit{partition: p.Name, from: day, to: end})
+		day = end
+	}
+
+	var assigned int64
+	for i := range units {
+		days := int64(units[i].to.Sub(units[i].from).Hours() / 24)
+		units[i].rows = config.TotalRows * days / generatedDays
+		assigned += units[i].rows
+	}
+	units[len(units)-1].rows += config.TotalRows - assigned
+
+	// Too few partitions to keep every goroutine busy: split them further.
+	if split := (config.Goroutines + len(units) - 1) / len(units); split > 1 {
+		var finer []partitionUnit
+		for _, u := range units {
+			for k := 0; k < split; k++ {
+				part := u
+				part.rows = u.rows / int64(split)
+				if k == split-1 {
+					part.rows = u.rows - part.rows*int64(split-1)
+				}
+				finer = append(finer, part)
+			}
+		}
+		units = finer
+	}
+
+	var next int64
+	for i := range units {
+		units[i].offset = next
+		next += units[i].rows
+	}
+	return units, nil
+}
+
+// loadGeneratedPartitioned is loadGenerated for routed partitions:
+// goroutines take units off a queue and COPY each into its partition.
+func loadGeneratedPartitioned(ctx context.Context, pool *pgxpool.Pool, units []partitionUnit, metrics *LoadMetrics) {
+	fmt.Printf("Routing %d rows to %d partition units across %d goroutines\n", config.TotalRows, len(units), config.Goroutines)
+
+	queue := make(chan partitionUnit, len(units))
+	for _, u := range units {
+		queue <- u
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, config.Goroutines)
+	for g := 0; g < config.Goroutines; g++ {
+		wg.Add(1)
+		go func(goroutineID int) {
+			defer wg.Done()
+			for u := range queue {
+				if err := loadPartitionUnit(ctx, pool, goroutineID, u, metrics); err != nil {
+					errChan <- fmt.Errorf("goroutine %d (%s) failed: %w", goroutineID, u.partition, err)
+					return
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+	close(errChan)
+	for err := range errChan {
+		fmt.Printf("Error during load: %v\n", err)
+	}
+}
+
+func loadPartitionUnit(ctx context.Context, pool *pgxpool.Pool, goroutineID int, u partitionUnit, metrics *LoadMetrics) error {
+	if u.rows == 0 {
+		return nil
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	start := time.Now()
+	fmt.Printf("   🔄 Goroutine %d: Starting load of %d rows into %s\n", goroutineID, u.rows, u.partition)
+
+	gen := &transactionGenerator{
+		totalRows:   u.rows,
+		rowOffset:   u.offset,
+		goroutineID: goroutineID,
+		metrics:     metrics,
+		dateFrom:    u.from,
+		days:        int(u.to.Sub(u.from).Hours() / 24),
+	}
+
+	var copyCount int64
+	if config.LogBadRows || throttling() || workers != nil || config.WriteMethod == "insert" {
+		copyCount, err = copyGeneratedBatches(ctx, conn, goroutineID, u.partition, gen, metrics)
+	} else {
+		copyCount, err = conn.Conn().CopyFrom(ctx, pgx.Identifier{u.partition}, loadedColumns, gen)
+	}
+	if err != nil {
+		metrics.RecordError(goroutineID)
+		return err
+	}
+	metrics.RecordSuccess(goroutineID, copyCount)
+
+	duration := time.Since(start)
+	logWorker(goroutineID, copyCount, duration, "partition", u.partition)
+	fmt.Printf("   ✅ Goroutine %d: Completed %d rows into %s in %v (%.0f rows/sec)\n",
+		goroutineID, copyCount, u.partition, duration, float64(copyCount)/duration.Seconds())
+	return nil
+}
+
+// routeBatch splits a source batch by partition. Rows whose key has no
+// partition yet get one created; NULL keys stay with the parent so the
+// server reports them (or puts them in a DEFAULT partition).
+func routeBatch(ctx context.Context, pool *pgxpool.Pool, columns []string, rows [][]interface{}) (map[string][][]interface{}, error) {
+	keyIdx := -1
+	for i, col := range columns {
+		if col == partitions.Key {
+			keyIdx = i
+		}
+	}
+	routed := make(map[string][][]interface{})
+	if keyIdx < 0 {
+		routed[partitions.Parent] = rows
+		return routed, nil
+	}
+
+	for _, row := range rows {
+		t, ok := row[keyIdx].(time.Time)
+		if !ok {
+			routed[partitions.Parent] = append(routed[partitions.Parent], row)
+			continue
+		}
+		p := partitions.find(t)
+		if p == nil {
+			from, to := partitions.slot(t)
+			if err := partitions.ensureRange(ctx, pool, from, to); err != nil {
+				return nil, err
+			}
+			if p = partitions.find(t); p == nil {
+				return nil, fmt.Errorf("no partition for %s = %v", partitions.Key, t)
+			}
+		}
+		routed[p.Name] = append(routed[p.Name], row)
+	}
+	return routed, nil
+}
+
+// copyRouted COPYs one source batch partition by partition.
+func copyRouted(ctx context.Context, pool *pgxpool.Pool, conn *pgxpool.Conn, goroutineID int, columns []string, rows [][]interface{}, metrics *LoadMetrics) (int64, error) {
+	routed, err := routeBatch(ctx, pool, columns, rows)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for table, part := range routed {
+		n, err := copyRows(ctx, conn, goroutineID, table, columns, part, metrics)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return total, nil
+}
+
+// partitionedTableSQL turns createTableSQL into a RANGE partitioned layout
+// on transaction_date (-partitioned=monthly|daily). Primary and unique keys
+// must include the partition key; the indexes are created on the parent and
+// cascade to every partition.
+func partitionedTableSQL() (string, error) {
+	sql := createTableSQL
+	for _, r := range [][2]string{
+		{"transaction_id      BIGSERIAL PRIMARY KEY,", "transaction_id      BIGSERIAL,"},
+		{"external_txn_id     UUID NOT NULL UNIQUE,", "external_txn_id     UUID NOT NULL,"},
+		{"    deleted_at          TIMESTAMP WITH TIME ZONE\n);", "    deleted_at          TIMESTAMP WITH TIME ZONE,\n\n" +
+			"    PRIMARY KEY (transaction_id, transaction_date),\n" +
+			"    UNIQUE (external_txn_id, transaction_date)\n" +
+			") PARTITION BY RANGE (transaction_date);"},
+	} {
+		if !strings.Contains(sql, r[0]) {
+			return "", fmt.Errorf("createTableSQL no longer contains %q; update partitionedTableSQL", r[0])
+		}
+		sql = strings.Replace(sql, r[0], r[1], 1)
+	}
+	return sql, nil
+}
+
+// createPartitions pre-creates the partitions of a freshly created
+// partitioned schema: the generated window plus the next interval.
+func createPartitions(ctx context.Context, pool *pgxpool.Pool) error {
+	if err := detectPartitions(ctx, pool); err != nil {
+		return err
+	}
+	if partitions == nil {
+		return fmt.Errorf("%s was not created as a range partitioned table", config.TableName)
+	}
+	from, to := generatedWindow()
+	_, next := partitions.slot(to)
+	return partitions.ensureRange(ctx, pool, from, next)
+}
@@ -0,0 +1,192 @@
+package bulkload
+
+// ============================================================================
+// OPERATOR PAUSE AND RESUME (SIGUSR1/SIGUSR2, -control-socket)
+// ============================================================================
+//
+// An urgent production issue shouldn't force a choice between the incident
+// and hours of loaded rows. While a load or backfill runs:
+//   kill -USR1 <pid>   pause: every worker finishes the batch in flight,
+//                      commits it and waits at the batch boundary
+//   kill -USR2 <pid>   resume
+// With -control-socket the same works by name, e.g. from a runbook or a
+// container without a shell:
+//   echo pause  | nc -U /run/loader.sock
+//   echo resume | nc -U /run/loader.sock
+//   echo status | nc -U /run/loader.sock   # running or paused, idle workers
+// A paused worker keeps its connection, idle and outside any transaction,
+// so it holds no locks and no snapshot (mind idle_session_timeout for long
+// pauses). The pause is one more throttle (see throttle.go), so generated
+// loads COPY in -batch-size batches. -pause-signals=false leaves SIGUSR1
+// and SIGUSR2 alone. The ultra loader and -write-method=fdw load in one
+// statement per stream and can't be paused.
+//
+//   go run ./cmd/prod_loader -mode=all -rows=500000000 -control-socket=/run/loader.sock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// operatorMonitor is the throttle name of operator pauses.
+const operatorMonitor = "operator"
+
+// pauseState records operator pauses for the report.
+var pauseState struct {
+	mu     sync.Mutex
+	since  time.Time // Zero while running
+	total  time.Duration
+	count  int
+	signal sync.Once
+}
+
+// idleWorkers counts workers waiting at a batch boundary while paused.
+var idleWorkers atomic.Int64
+
+// pauseControl reports whether the operator can pause loads.
+func pauseControl() bool {
+	return config.PauseSignals || config.ControlSocket != ""
+}
+
+// startPauseControl listens for pause and resume requests. Signal handling
+// stays installed for the rest of the process, so a late SIGUSR1 doesn't
+// kill it; the socket is closed when ctx ends.
+func startPauseControl(ctx context.Context, wg *sync.WaitGroup) error {
+	if config.PauseSignals {
+		pauseState.signal.Do(func() {
+			if notifyPauseSignals() {
+				pid := os.Getpid()
+				fmt.Printf("⏯️  Pause with kill -USR1 %d, resume with kill -USR2 %d\n", pid, pid)
+			}
+		})
+	}
+	if config.ControlSocket == "" {
+		return nil
+	}
+
+	// A socket left behind by a killed run would make Listen fail.
+	if fi, err := os.Stat(config.ControlSocket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(config.ControlSocket)
+	}
+	ln, err := net.Listen("unix", config.ControlSocket)
+	if err != nil {
+		return fmt.Errorf("-control-socket: %w", err)
+	}
+	fmt.Printf("⏯️  Control socket %s: pause, resume, status\n", config.ControlSocket)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if err != nil {
+				fmt.Printf("      ⚠️  Control socket: %v\n", err)
+				continue
+			}
+			go serveControl(conn)
+		}
+	}()
+	return nil
+}
+
+// serveControl answers one command per line.
+func serveControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var reply string
+		switch cmd := strings.ToLower(strings.TrimSpace(scanner.Text())); cmd {
+		case "pause":
+			pauseLoad("control socket")
+			reply = pauseStatus()
+		case "resume":
+			resumeLoad("control socket")
+			reply = pauseStatus()
+		case "status":
+			reply = pauseStatus()
+		case "":
+			continue
+		default:
+			reply = fmt.Sprintf("unknown command %q (use pause, resume, status)", cmd)
+		}
+		if _, err := fmt.Fprintln(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// pauseLoad stops workers at their next batch boundary.
+func pauseLoad(by string) {
+	pauseState.mu.Lock()
+	defer pauseState.mu.Unlock()
+	if !pauseState.since.IsZero() {
+		return
+	}
+	pauseState.since = time.Now()
+	pauseState.count++
+	throttle.set(operatorMonitor, "paused by "+by, 0)
+	logger.Info("paused", "phase", currentPhase(), "by", by)
+	fmt.Printf("      ⏸️  Paused by %s: workers stop after their current batch\n", by)
+}
+
+// resumeLoad lets paused workers continue.
+func resumeLoad(by string) {
+	pauseState.mu.Lock()
+	defer pauseState.mu.Unlock()
+	if pauseState.since.IsZero() {
+		return
+	}
+	paused := time.Since(pauseState.since)
+	pauseState.total += paused
+	pauseState.since = time.Time{}
+	throttle.set(operatorMonitor, "", 0)
+	logger.Info("resumed", "phase", currentPhase(), "by", by, "paused_ms", paused.Milliseconds())
+	fmt.Printf("      ▶️  Resumed by %s after %v\n", by, paused.Round(time.Second))
+}
+
+// loadPaused reports whether the operator has paused the load.
+func loadPaused() bool {
+	pauseState.mu.Lock()
+	defer pauseState.mu.Unlock()
+	return !pauseState.since.IsZero()
+}
+
+// pauseStatus is the control socket's answer to status.
+func pauseStatus() string {
+	pauseState.mu.Lock()
+	defer pauseState.mu.Unlock()
+	if pauseState.since.IsZero() {
+		return "running"
+	}
+	return fmt.Sprintf("paused for %v, %d worker(s) idle at a batch boundary",
+		time.Since(pauseState.since).Round(time.Second), idleWorkers.Load())
+}
+
+// printPauseReport adds operator pauses to the load report.
+func printPauseReport() {
+	pauseState.mu.Lock()
+	defer pauseState.mu.Unlock()
+	total := pauseState.total
+	if !pauseState.since.IsZero() {
+		total += time.Since(pauseState.since)
+	}
+	if pauseState.count > 0 {
+		fmt.Printf("Paused by operator:   %v (%d time(s))\n", total.Round(time.Second), pauseState.count)
+	}
+}
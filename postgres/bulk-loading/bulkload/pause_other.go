@@ -0,0 +1,9 @@
+//go:build !unix
+
+package bulkload
+
+// notifyPauseSignals does nothing: there is no SIGUSR1 or SIGUSR2 here,
+// use -control-socket.
+func notifyPauseSignals() bool {
+	return false
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package bulkload
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyPauseSignals pauses loads on SIGUSR1 and resumes them on SIGUSR2.
+func notifyPauseSignals() bool {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range ch {
+			if sig == syscall.SIGUSR1 {
+				pauseLoad("SIGUSR1")
+			} else {
+				resumeLoad("SIGUSR2")
+			}
+		}
+	}()
+	return true
+}
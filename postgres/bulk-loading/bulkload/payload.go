@@ -0,0 +1,290 @@
+package bulkload
+
+// ============================================================================
+// JSONB PAYLOAD SIZES (-payload-size, -payload-tail, -payload-shape)
+// ============================================================================
+//
+// The generated metadata is a ~200 byte object (and the ultra loader reuses
+// one cached blob), so loads never exercise TOAST and the GIN index on
+// metadata stays small. These flags pad metadata with a payload whose size
+// is drawn per row:
+//   -payload-size=fixed:4KB
+//   -payload-size=uniform:256B-8KB
+//   -payload-size=lognormal:1KB,1.5   median, sigma (log scale)
+//   -payload-size=pareto:512B,1.2     minimum, alpha: heavy tailed, alpha
+//                                     near 1 gives the odd multi-MB row
+//   -payload-tail=0.02:64KB-2MB       on top: that fraction of rows gets a
+//                                     uniform size from the range instead
+// Sizes are capped at maxPayload. Rows whose metadata ends up over about
+// 2KB are compressed or moved out of line by TOAST; the padding is random
+// base64, which pglz and lz4 can't shrink much, so most of it stays that
+// size on disk. -payload-shape picks what the padding looks like:
+//   fields (default)  "attrs": {"a0000": "<53 chars>", ...}, one GIN key
+//                     and value per 64 bytes, for GIN build cost
+//   blob              "blob": "<n chars>", a single GIN entry, for TOAST
+// With -seed the payloads are deterministic like the rest of the row.
+// After the load a TOAST report shows the heap/TOAST split and sampled
+// metadata sizes. Shared with the ultra loader:
+//   go run ./cmd/prod_loader -mode=all -payload-size=lognormal:1KB,1.5 -payload-tail=0.01:64KB-1MB
+//   go run ./cmd/prod_loader_ultra -mode=all -payload-size=pareto:512B,1.1 -payload-shape=blob
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxPayload keeps payloads well below jsonb's 255MB limit.
+const maxPayload = 64 << 20
+
+// payloadField is the JSON size of one "a0000":"<53 chars>", entry.
+const payloadField = 64
+
+// payloadSpec is a parsed -payload-size/-payload-tail/-payload-shape.
+type payloadSpec struct {
+	dist     string  // fixed, uniform, lognormal, pareto
+	a, b     float64 // fixed: size; uniform: min, max; lognormal: median, sigma; pareto: min, alpha
+	tailFrac float64
+	tailMin  int64
+	tailMax  int64
+	shape    string // fields, blob
+}
+
+// payload is the active spec, nil for the built-in metadata.
+var payload *payloadSpec
+
+// payloadFlags are the raw flags, parsed by initPayload.
+var payloadFlags struct {
+	size, tail, shape string
+}
+
+// registerPayloadFlags adds the -payload-* flags.
+func registerPayloadFlags() {
+	flag.StringVar(&payloadFlags.size, "payload-size", "", "Metadata payload size per row: fixed:SIZE, uniform:MIN-MAX, lognormal:MEDIAN,SIGMA, pareto:MIN,ALPHA (default: no payload)")
+	flag.StringVar(&payloadFlags.tail, "payload-tail", "", "Heavy tail on top of -payload-size, FRACTION:MIN-MAX (e.g. 0.01:64KB-1MB)")
+	flag.StringVar(&payloadFlags.shape, "payload-shape", "fields", "Payload layout: fields (many small keys, GIN heavy), blob (one long string, TOAST heavy)")
+}
+
+// initPayload parses the flags into payload.
+func initPayload() error {
+	if payloadFlags.size == "" && payloadFlags.tail == "" {
+		return nil
+	}
+	p := &payloadSpec{dist: "fixed", shape: payloadFlags.shape}
+	if p.shape != "fields" && p.shape != "blob" {
+		return fmt.Errorf("-payload-shape=%q (use fields, blob)", p.shape)
+	}
+
+	if payloadFlags.size != "" {
+		dist, args, _ := strings.Cut(payloadFlags.size, ":")
+		p.dist = dist
+		var err error
+		switch dist {
+		case "fixed":
+			var n int64
+			n, err = parseByteSize(args)
+			p.a = float64(n)
+		case "uniform":
+			var lo, hi int64
+			lo, hi, err = parseSizeRange(args)
+			p.a, p.b = float64(lo), float64(hi)
+		case "lognormal", "pareto":
+			size, param, ok := strings.Cut(args, ",")
+			if !ok {
+				return fmt.Errorf("-payload-size=%s needs SIZE,%s", dist, map[string]string{"lognormal": "SIGMA", "pareto": "ALPHA"}[dist])
+			}
+			var n int64
+			if n, err = parseByteSize(size); err == nil {
+				p.a = float64(n)
+				p.b, err = strconv.ParseFloat(strings.TrimSpace(param), 64)
+			}
+			if err == nil && (p.b <= 0 || (dist == "pareto" && p.a <= 0)) {
+				err = fmt.Errorf("sigma, alpha and the pareto minimum must be positive")
+			}
+		default:
+			return fmt.Errorf("unknown -payload-size distribution %q (use fixed, uniform, lognormal, pareto)", dist)
+		}
+		if err != nil {
+			return fmt.Errorf("-payload-size: %w", err)
+		}
+	}
+
+	if payloadFlags.tail != "" {
+		frac, sizes, ok := strings.Cut(payloadFlags.tail, ":")
+		if !ok {
+			return fmt.Errorf("-payload-tail takes FRACTION:MIN-MAX")
+		}
+		var err error
+		if p.tailFrac, err = strconv.ParseFloat(frac, 64); err != nil || p.tailFrac <= 0 || p.tailFrac > 1 {
+			return fmt.Errorf("-payload-tail: fraction must be in (0, 1]")
+		}
+		if p.tailMin, p.tailMax, err = parseSizeRange(sizes); err != nil {
+			return fmt.Errorf("-payload-tail: %w", err)
+		}
+	}
+
+	payload = p
+	fmt.Printf("📦 Metadata payload: %s\n", p)
+	return nil
+}
+
+func (p *payloadSpec) String() string {
+	var s string
+	switch p.dist {
+	case "fixed":
+		s = fmt.Sprintf("%d bytes", int64(p.a))
+	case "uniform":
+		s = fmt.Sprintf("uniform %d-%d bytes", int64(p.a), int64(p.b))
+	case "lognormal":
+		s = fmt.Sprintf("lognormal, median %d bytes, sigma %g", int64(p.a), p.b)
+	case "pareto":
+		s = fmt.Sprintf("pareto, min %d bytes, alpha %g", int64(p.a), p.b)
+	}
+	if p.tailFrac > 0 {
+		s += fmt.Sprintf(", %g%% of rows %d-%d bytes", p.tailFrac*100, p.tailMin, p.tailMax)
+	}
+	return s + ", " + p.shape
+}
+
+// size draws one row's payload size in bytes.
+func (p *payloadSpec) size(r *rand.Rand) int {
+	var n float64
+	switch {
+	case p.tailFrac > 0 && r.Float64() < p.tailFrac:
+		n = float64(p.tailMin) + r.Float64()*float64(p.tailMax-p.tailMin)
+	case p.dist == "uniform":
+		n = p.a + r.Float64()*(p.b-p.a)
+	case p.dist == "lognormal":
+		n = p.a * math.Exp(r.NormFloat64()*p.b)
+	case p.dist == "pareto":
+		n = p.a / math.Pow(1-r.Float64(), 1/p.b)
+	default:
+		n = p.a
+	}
+	return int(min(max(n, 0), maxPayload))
+}
+
+// pad adds a payload of a drawn size to metadata.
+func (p *payloadSpec) pad(metadata map[string]interface{}, r *rand.Rand) {
+	n := p.size(r)
+	if n == 0 {
+		return
+	}
+	if p.shape == "blob" {
+		metadata["blob"] = randomText(r, n)
+		return
+	}
+	attrs := make(map[string]string, n/payloadField+1)
+	for i := 0; i*payloadField < n; i++ {
+		attrs[fmt.Sprintf("a%04d", i)] = randomText(r, payloadField-11)
+	}
+	metadata["attrs"] = attrs
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// randomText returns n random base64 characters, ten per draw from r.
+func randomText(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := 0; i < n; {
+		v := r.Uint64()
+		for j := 0; j < 10 && i < n; j++ {
+			b[i] = base64Chars[v&63]
+			v >>= 6
+			i++
+		}
+	}
+	return string(b)
+}
+
+// printToastReport shows how the loaded metadata was stored. rows sizes
+// the sample to about 100k rows.
+func printToastReport(ctx context.Context, pool *pgxpool.Pool, rows int64) {
+	var heap, toast, indexes string
+	var toastShare float64
+	err := pool.QueryRow(ctx, `
+		SELECT pg_size_pretty(pg_relation_size(c.oid)),
+		       pg_size_pretty(coalesce(pg_total_relation_size(nullif(c.reltoastrelid, 0)), 0)),
+		       pg_size_pretty(pg_indexes_size(c.oid)),
+		       coalesce(coalesce(pg_total_relation_size(nullif(c.reltoastrelid, 0)), 0)::float8 /
+		           nullif(pg_table_size(c.oid), 0), 0)
+		FROM pg_class c WHERE c.oid = $1::regclass
+	`, config.TableName).Scan(&heap, &toast, &indexes, &toastShare)
+	if err != nil {
+		fmt.Printf("⚠️  TOAST report unavailable: %v\n", err)
+		return
+	}
+
+	pct := 100.0
+	if rows > 100_000 {
+		pct = max(100*100_000/float64(rows), 0.01)
+	}
+	var sampled, over int64
+	var avg, p50, p99, biggest float64
+	err = pool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT count(*), count(*) FILTER (WHERE s > 2000),
+		       coalesce(avg(s), 0), coalesce(percentile_cont(0.5) WITHIN GROUP (ORDER BY s), 0),
+		       coalesce(percentile_cont(0.99) WITHIN GROUP (ORDER BY s), 0), coalesce(max(s), 0)
+		FROM (SELECT pg_column_size(metadata)::float8 AS s FROM %s TABLESAMPLE SYSTEM (%g)) m
+	`, config.TableName, pct)).Scan(&sampled, &over, &avg, &p50, &p99, &biggest)
+
+	fmt.Println("\n📦 TOAST REPORT")
+	fmt.Printf("   Heap: %s, TOAST: %s (%.0f%% of table data), indexes: %s\n", heap, toast, toastShare*100, indexes)
+	if err != nil || sampled == 0 {
+		return
+	}
+	fmt.Printf("   metadata as stored (%d sampled rows): avg %.0f B, p50 %.0f B, p99 %.0f B, max %.0f B\n",
+		sampled, avg, p50, p99, biggest)
+	fmt.Printf("   %.1f%% of rows over the ~2kB TOAST threshold (compressed or out of line)\n",
+		float64(over)/float64(sampled)*100)
+}
+
+// parseSizeRange parses MIN-MAX, e.g. 64KB-2MB.
+func parseSizeRange(s string) (int64, int64, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not MIN-MAX", s)
+	}
+	from, err := parseByteSize(lo)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseByteSize(hi)
+	if err != nil {
+		return 0, 0, err
+	}
+	if to < from {
+		return 0, 0, fmt.Errorf("%q: MAX is below MIN", s)
+	}
+	return from, to, nil
+}
+
+// parseByteSize parses sizes like 64MB, 1.5GiB or 1048576 (bytes).
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+	mult := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s, mult = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
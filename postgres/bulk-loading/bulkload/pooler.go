@@ -0,0 +1,156 @@
+package bulkload
+
+// ============================================================================
+// TRANSACTION POOLER MODE (-pooler, -direct-dsn)
+// ============================================================================
+//
+// Behind PgBouncer (pool_mode=transaction) or a similar pooler every
+// transaction may run on a different server backend. Session state doesn't
+// survive that: SET maintenance_work_mem lands on whichever backend the
+// statement got and then leaks to another client, named prepared statements
+// vanish, and the UNLOGGED/LOGGED round trip runs far from the connection
+// that thinks it owns the table. None of that errors; the load just ends up
+// slower or stranger than expected. In pooler mode the loader:
+//   - uses the simple query protocol (no prepared statements)
+//   - writes with multi-row INSERTs (insert.go) unless -write-method
+//     is given explicitly
+//   - runs schema creation, prepare and finalize over -direct-dsn, a
+//     connection straight to PostgreSQL (e.g. port 5432 next to PgBouncer's
+//     6432). Without it, session SETs and SET UNLOGGED/LOGGED are skipped
+//     and indexes are built with the server's maintenance_work_mem.
+//
+// -pooler=auto (default) assumes a pooler when the DSN uses port 6432, when
+// the server reports a different port than the one dialed, or when one
+// client connection sees more than one backend PID. Port forwarding can
+// trip the second check; pass -pooler=off then.
+//
+//   go run ./cmd/prod_loader -mode=all -pooler=on -direct-dsn="postgres://...@db:5432/avro"
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// poolerMode is set once openPools decides the DSN goes through a
+// transaction pooler.
+var poolerMode bool
+
+// openPools connects to config.DBConnString and returns the pool for
+// loading and the pool for DDL and session settings. They are the same
+// pool unless the loader runs behind a pooler with -direct-dsn.
+func openPools(ctx context.Context) (pool, ddl *pgxpool.Pool, err error) {
+	pool, err = initConnectionPool(ctx, config.DBConnString)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkBackend(ctx, pool); err != nil {
+		pool.Close()
+		return nil, nil, err
+	}
+	if cockroach() {
+		return pool, pool, nil // Every node is a gateway; there is no pooler to detect
+	}
+
+	switch config.Pooler {
+	case "on":
+		poolerMode = true
+	case "auto":
+		var reason string
+		poolerMode, reason = detectPooler(ctx, pool)
+		if poolerMode {
+			fmt.Printf("🔀 Transaction pooler detected (%s)\n", reason)
+		}
+	}
+	if !poolerMode {
+		return pool, pool, nil
+	}
+
+	// Reconnect with pooler-safe settings.
+	pool.Close()
+	if pool, err = initConnectionPool(ctx, config.DBConnString); err != nil {
+		return nil, nil, err
+	}
+	if !flagSet("write-method") {
+		config.WriteMethod = "insert"
+	}
+	fmt.Printf("🔀 Pooler mode: simple protocol, -write-method=%s\n", config.WriteMethod)
+
+	if config.DirectDSN == "" {
+		fmt.Println("⚠️  No -direct-dsn: session settings and SET UNLOGGED/LOGGED will be skipped")
+		return pool, pool, nil
+	}
+	if ddl, err = initConnectionPool(ctx, config.DirectDSN); err != nil {
+		pool.Close()
+		return nil, nil, fmt.Errorf("direct connection: %w", err)
+	}
+	fmt.Println("🔀 DDL runs over the direct connection")
+	return pool, ddl, nil
+}
+
+// applyPoolerSettings makes a pool config safe for transaction pooling.
+func applyPoolerSettings(poolConfig *pgxpool.Config) {
+	poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+}
+
+// detectPooler reports whether pool looks like it goes through a
+// transaction pooler, and why.
+func detectPooler(ctx context.Context, pool *pgxpool.Pool) (bool, string) {
+	dialed := pool.Config().ConnConfig.Port
+	if dialed == 6432 {
+		return true, "port 6432"
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return false, ""
+	}
+	defer conn.Release()
+
+	// Simple protocol: a pooler may not keep prepared statements around.
+	simple := pgx.QueryExecModeSimpleProtocol
+	var serverPort *int32
+	if err := conn.QueryRow(ctx, "SELECT inet_server_port()", simple).Scan(&serverPort); err == nil &&
+		serverPort != nil && uint16(*serverPort) != dialed {
+		return true, fmt.Sprintf("dialed port %d, server listens on %d", dialed, *serverPort)
+	}
+
+	var first int32
+	if err := conn.QueryRow(ctx, "SELECT pg_backend_pid()", simple).Scan(&first); err != nil {
+		return false, ""
+	}
+	for i := 0; i < 5; i++ {
+		var pid int32
+		if err := conn.QueryRow(ctx, "SELECT pg_backend_pid()", simple).Scan(&pid); err == nil && pid != first {
+			return true, "backend PID changed between transactions"
+		}
+	}
+	return false, ""
+}
+
+// pooledDDL reports whether DDL has to go through the pooler because no
+// -direct-dsn was given.
+func pooledDDL() bool {
+	return poolerMode && config.DirectDSN == ""
+}
+
+// flagSet reports whether name was given on the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// sessionOnly reports whether a prepare/finalize statement depends on
+// session state or table persistence and is skipped by pooledDDL.
+func sessionOnly(sql string) bool {
+	return strings.HasPrefix(sql, "SET ") || strings.HasSuffix(sql, " SET UNLOGGED") || strings.HasSuffix(sql, " SET LOGGED")
+}
@@ -0,0 +1,434 @@
+package bulkload
+
+// ============================================================================
+// SYNTHETIC DATA PROFILES (-data-profile profile.yaml)
+// ============================================================================
+//
+// The built-in generator has fixed cardinalities (1M accounts, 100k
+// customers, 50k merchants) and uniform value lists. A data profile
+// overrides them per column so generated datasets match production shape:
+//
+//   columns:
+//     customer_id:   {distribution: zipf, cardinality: 2000000, zipf_s: 1.2}
+//     amount:        {distribution: lognormal, mean: 3.5, stddev: 1.2, max: 250000}
+//     currency:      {values: [USD, EUR, GBP], weights: [80, 15, 5]}
+//     merchant_id:   {cardinality: 400000, null_fraction: 0.08}
+//
+// Distributions: uniform (default), zipf, normal, lognormal. Integer
+// columns draw from [min, min+cardinality); float columns from [min, max]
+// (normal and lognormal are clamped to it). values/weights work for text
+// and boolean columns. null_fraction works for every generated column; a
+// NOT NULL column will send those rows to the bad-rows table.
+//
+// ndistinct caps any column (derived amounts excepted) at N distinct
+// values: rows pick one of N slots uniformly, and slot k holds the value
+// the column has in reference row k, so UUIDs, faker names and profiled
+// distributions keep their format. With -seed the slots are deterministic
+// too. Both knobs are also flags, which override the file and don't need
+// one; each takes column=value pairs, comma separated or repeated:
+//
+//   -null-frac settlement_date=0.3,correlation_id=0.6 -ndistinct merchant_category=400
+//
+// See data_profile.example.yaml for a complete example.
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+type dataProfile struct {
+	Columns map[string]*columnProfile `yaml:"columns"`
+}
+
+type columnProfile struct {
+	Distribution string    `yaml:"distribution"` // uniform, zipf, normal, lognormal
+	Cardinality  int64     `yaml:"cardinality"`  // Distinct integer values
+	Min          *float64  `yaml:"min"`
+	Max          *float64  `yaml:"max"`
+	Mean         float64   `yaml:"mean"`   // normal; mean of log for lognormal
+	Stddev       float64   `yaml:"stddev"` // normal; stddev of log for lognormal
+	ZipfS        float64   `yaml:"zipf_s"` // Skew, > 1 (default 1.1)
+	Values       []string  `yaml:"values"`
+	Weights      []float64 `yaml:"weights"`
+	NullFraction float64   `yaml:"null_fraction"`
+	NDistinct    int64     `yaml:"ndistinct"` // At most this many distinct values, 0 = no cap
+
+	cumulative []float64 // Running weight totals for values
+	index      int       // Position in generatedColumns
+
+	mu    sync.Mutex
+	slots map[int64]interface{} // ndistinct slot -> value, filled on first use
+}
+
+// generatedKinds is what transactionGenerator produces for each column, and
+// so which profile settings apply.
+var generatedKinds = map[string]string{
+	"external_txn_id": "uuid", "correlation_id": "text", "transaction_date": "date",
+	"transaction_time": "timestamp", "settlement_date": "date", "amount": "float",
+	"currency": "text", "exchange_rate": "float", "amount_usd": "derived",
+	"fee_amount": "derived", "tax_amount": "derived", "transaction_type": "text",
+	"transaction_status": "text", "payment_method": "text", "merchant_category": "text",
+	"account_id": "int", "customer_id": "int", "merchant_id": "int",
+	"country_code": "text", "region": "text", "city": "text", "risk_score": "float",
+	"is_flagged": "bool", "fraud_check_status": "text", "metadata": "json", "tags": "array",
+	"processed_by": "text", "processing_duration_ms": "int",
+}
+
+// profile is the loaded -data-profile, nil when generating defaults.
+var profile *dataProfile
+
+// nullable lists profiled columns with a null_fraction, for applyNulls.
+var nullable []*columnProfile
+
+// capped lists profiled columns with ndistinct, for applyDistinct.
+var capped []*columnProfile
+
+// distinctRowBase numbers the reference rows behind ndistinct slots, far
+// from any row a load generates.
+const distinctRowBase = int64(-1) << 62
+
+// columnSettings collects column=value pairs from a repeatable flag.
+type columnSettings map[string]string
+
+func (s columnSettings) String() string {
+	pairs := make([]string, 0, len(s))
+	for column, value := range s {
+		pairs = append(pairs, column+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (s columnSettings) Set(v string) error {
+	for _, pair := range strings.Split(v, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		column, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("%q is not column=value", pair)
+		}
+		s[strings.TrimSpace(column)] = strings.TrimSpace(value)
+	}
+	return nil
+}
+
+func loadDataProfile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read data profile: %w", err)
+	}
+	var p dataProfile
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("failed to parse data profile %s: %w", path, err)
+	}
+
+	if p.Columns == nil {
+		p.Columns = make(map[string]*columnProfile)
+	}
+	if err := p.compile(); err != nil {
+		return err
+	}
+	profile = &p
+	fmt.Printf("📐 Data profile %s: %d columns profiled\n", path, len(p.Columns))
+	return nil
+}
+
+// applyColumnFlags layers -null-frac and -ndistinct over the data profile,
+// creating one if there is no -data-profile.
+func applyColumnFlags(nullFrac, ndistinct columnSettings) error {
+	if len(nullFrac) == 0 && len(ndistinct) == 0 {
+		return nil
+	}
+	if profile == nil {
+		profile = &dataProfile{Columns: make(map[string]*columnProfile)}
+	}
+	column := func(name string) *columnProfile {
+		if profile.Columns[name] == nil {
+			profile.Columns[name] = &columnProfile{}
+		}
+		return profile.Columns[name]
+	}
+	for name, value := range nullFrac {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("-null-frac %s: %w", name, err)
+		}
+		column(name).NullFraction = f
+	}
+	for name, value := range ndistinct {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("-ndistinct %s: %w", name, err)
+		}
+		column(name).NDistinct = n
+	}
+	if err := profile.compile(); err != nil {
+		return err
+	}
+	fmt.Printf("📐 Column overrides: null fraction %s; ndistinct %s\n", orNone(nullFrac.String()), orNone(ndistinct.String()))
+	return nil
+}
+
+// orNone prints an empty setting list as "none".
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// compile checks every column and rebuilds nullable and capped.
+func (p *dataProfile) compile() error {
+	names := make([]string, 0, len(p.Columns))
+	for name := range p.Columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nullable, capped = nil, nil
+	for _, name := range names {
+		c := p.Columns[name]
+		if err := c.compile(name); err != nil {
+			return fmt.Errorf("data profile column %s: %w", name, err)
+		}
+		if c.NullFraction > 0 {
+			nullable = append(nullable, c)
+		}
+		if c.NDistinct > 0 {
+			capped = append(capped, c)
+		}
+	}
+	return nil
+}
+
+func (c *columnProfile) compile(name string) error {
+	kind, ok := generatedKinds[name]
+	if !ok {
+		return fmt.Errorf("not a generated column")
+	}
+	for i, col := range generatedColumns {
+		if col == name {
+			c.index = i
+		}
+	}
+	if c.NullFraction < 0 || c.NullFraction > 1 {
+		return fmt.Errorf("null_fraction must be between 0 and 1")
+	}
+	if c.NDistinct < 0 {
+		return fmt.Errorf("ndistinct must not be negative")
+	}
+	if c.NDistinct > 0 && kind == "derived" {
+		return fmt.Errorf("ndistinct doesn't apply to amounts derived from amount")
+	}
+	if c.NDistinct > 0 && name == "external_txn_id" {
+		fmt.Println("⚠️  ndistinct on external_txn_id: repeated values violate its UNIQUE constraint")
+	}
+	c.cumulative = nil
+	if !c.generates() {
+		return nil
+	}
+
+	switch kind {
+	case "int", "float":
+		if len(c.Values) > 0 {
+			return fmt.Errorf("values only apply to text and boolean columns")
+		}
+		switch c.Distribution {
+		case "", "uniform", "normal", "lognormal":
+		case "zipf":
+			if kind != "int" {
+				return fmt.Errorf("zipf only applies to integer columns")
+			}
+			if c.ZipfS == 0 {
+				c.ZipfS = 1.1
+			}
+			if c.ZipfS <= 1 {
+				return fmt.Errorf("zipf_s must be greater than 1")
+			}
+		default:
+			return fmt.Errorf("unknown distribution %q (use uniform, zipf, normal, lognormal)", c.Distribution)
+		}
+		if kind == "int" && c.Cardinality <= 0 && (c.Max == nil || c.Distribution == "zipf") {
+			return fmt.Errorf("integer columns need cardinality (or min/max)")
+		}
+		if kind == "float" && (c.Distribution == "" || c.Distribution == "uniform") && c.Max == nil {
+			return fmt.Errorf("uniform float columns need max")
+		}
+	case "text", "bool":
+		if len(c.Values) == 0 {
+			return fmt.Errorf("%s columns are profiled with values (and optional weights)", kind)
+		}
+		if kind == "bool" {
+			for _, v := range c.Values {
+				if _, err := strconv.ParseBool(v); err != nil {
+					return fmt.Errorf("invalid boolean %q", v)
+				}
+			}
+		}
+		if len(c.Weights) > 0 && len(c.Weights) != len(c.Values) {
+			return fmt.Errorf("%d weights for %d values", len(c.Weights), len(c.Values))
+		}
+		var total float64
+		for i := range c.Values {
+			w := 1.0
+			if len(c.Weights) > 0 {
+				w = c.Weights[i]
+			}
+			if w < 0 {
+				return fmt.Errorf("negative weight")
+			}
+			total += w
+			c.cumulative = append(c.cumulative, total)
+		}
+		if total == 0 {
+			return fmt.Errorf("weights add up to 0")
+		}
+	default:
+		return fmt.Errorf("%s columns only support null_fraction", kind)
+	}
+	return nil
+}
+
+// generates reports whether the profile replaces the column's values rather
+// than only adding NULLs.
+func (c *columnProfile) generates() bool {
+	return c.Distribution != "" || c.Cardinality > 0 || c.Min != nil || c.Max != nil ||
+		c.Mean != 0 || c.Stddev != 0 || len(c.Values) > 0
+}
+
+// column returns the generating profile for name, or nil.
+func (g *transactionGenerator) column(name string) *columnProfile {
+	if profile == nil {
+		return nil
+	}
+	c := profile.Columns[name]
+	if c == nil || !c.generates() {
+		return nil
+	}
+	return c
+}
+
+// intValue returns a profiled value for an integer column, or def.
+func (g *transactionGenerator) intValue(name string, def int64) int64 {
+	c := g.column(name)
+	if c == nil {
+		return def
+	}
+	lo := int64(0)
+	if c.Min != nil {
+		lo = int64(*c.Min)
+	}
+	n := c.Cardinality
+	if n <= 0 {
+		n = int64(*c.Max) - lo + 1
+	}
+
+	switch c.Distribution {
+	case "zipf":
+		if g.zipfs == nil {
+			g.zipfs = make(map[string]*rand.Zipf)
+		}
+		z := g.zipfs[name]
+		if z == nil {
+			z = rand.NewZipf(g.random(), c.ZipfS, 1, uint64(n-1))
+			g.zipfs[name] = z
+		}
+		return lo + int64(z.Uint64())
+	case "normal", "lognormal":
+		v := int64(c.sample(g.random()))
+		return min(max(v, lo), lo+n-1)
+	}
+	return lo + g.random().Int63n(n)
+}
+
+// floatValue returns a profiled value for a float column, or def.
+func (g *transactionGenerator) floatValue(name string, def float64) float64 {
+	c := g.column(name)
+	if c == nil {
+		return def
+	}
+	v := c.sample(g.random())
+	if c.Min != nil {
+		v = math.Max(v, *c.Min)
+	}
+	if c.Max != nil {
+		v = math.Min(v, *c.Max)
+	}
+	return v
+}
+
+// sample draws from a float distribution before clamping.
+func (c *columnProfile) sample(r *rand.Rand) float64 {
+	switch c.Distribution {
+	case "normal":
+		return c.Mean + r.NormFloat64()*c.Stddev
+	case "lognormal":
+		return math.Exp(c.Mean + r.NormFloat64()*c.Stddev)
+	}
+	lo := 0.0
+	if c.Min != nil {
+		lo = *c.Min
+	}
+	return lo + r.Float64()*(*c.Max-lo)
+}
+
+// stringValue returns a weighted pick from a profiled value list, or def.
+func (g *transactionGenerator) stringValue(name, def string) string {
+	c := g.column(name)
+	if c == nil {
+		return def
+	}
+	x := g.random().Float64() * c.cumulative[len(c.cumulative)-1]
+	return c.Values[sort.SearchFloat64s(c.cumulative, x)]
+}
+
+// boolValue is stringValue for boolean columns.
+func (g *transactionGenerator) boolValue(name string, def bool) bool {
+	if g.column(name) == nil {
+		return def
+	}
+	b, _ := strconv.ParseBool(g.stringValue(name, ""))
+	return b
+}
+
+// applyDistinct replaces the values of ndistinct columns with one of their
+// slots.
+func (g *transactionGenerator) applyDistinct(row []interface{}) {
+	for _, c := range capped {
+		row[c.index] = c.slot(g.random().Int63n(c.NDistinct))
+	}
+}
+
+// slot returns ndistinct slot k: the column's value in reference row k.
+func (c *columnProfile) slot(k int64) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.slots[k]; ok {
+		return v
+	}
+	if c.slots == nil {
+		c.slots = make(map[int64]interface{})
+	}
+	ref := &transactionGenerator{totalRows: 1, currentRow: 1, rowOffset: distinctRowBase + k, reference: true}
+	row, _ := ref.Values()
+	c.slots[k] = row[c.index]
+	return row[c.index]
+}
+
+// applyNulls blanks profiled columns according to their null_fraction.
+func (g *transactionGenerator) applyNulls(row []interface{}) {
+	for _, c := range nullable {
+		if g.random().Float64() < c.NullFraction {
+			row[c.index] = nil
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package bulkload
+
+// ============================================================================
+// PROGRESS AND ETA (-progress-interval, -status-file, -status-table)
+// ============================================================================
+//
+// Every -progress-interval the load prints one line: rows committed, table
+// size, rows/sec over the interval with its trend, and an ETA. The ETA
+// divides the remaining rows by an exponentially smoothed rate (weight 0.3
+// on the newest interval), so it follows a slowing load (checkpoints, index
+// pages no longer cached) without jumping on every hiccup. File sources
+// don't know their row count up front and show no ETA.
+//
+// The same snapshot can be persisted, for watching a multi-hour load from
+// another terminal or a dashboard even if the controlling shell is gone:
+//   -status-file=load.json   rewritten atomically (write + rename)
+//   -status-table            one row per load_id in bulk_load_status
+//
+//   watch -n5 cat load.json
+//   psql -c "SELECT load_id, state, rows_committed, rows_per_sec, eta FROM bulk_load_status;"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const statusTable = "bulk_load_status"
+
+// progressSnapshot is what gets printed and persisted.
+type progressSnapshot struct {
+	LoadID        string    `json:"load_id"`
+	Table         string    `json:"table"`
+	State         string    `json:"state"` // running, paused, done, failed
+	Host          string    `json:"host"`
+	PID           int       `json:"pid"`
+	StartedAt     time.Time `json:"started_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	RowsCommitted int64     `json:"rows_committed"`
+	RowsTotal     int64     `json:"rows_total,omitempty"` // 0: unknown
+	TableBytes    int64     `json:"table_bytes"`
+	RowsPerSec    float64   `json:"rows_per_sec"` // Smoothed
+	Trend         string    `json:"trend"`        // up, down, steady
+	ETA           time.Time `json:"eta,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+type progressTracker struct {
+	pool    *pgxpool.Pool
+	metrics *LoadMetrics
+	snap    progressSnapshot
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// startProgress reports progress until stop is called with the load's
+// outcome.
+func startProgress(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) (*progressTracker, error) {
+	host, _ := os.Hostname()
+	p := &progressTracker{
+		pool:    pool,
+		metrics: metrics,
+		done:    make(chan struct{}),
+		snap: progressSnapshot{
+			LoadID:    config.LoadID,
+			Table:     config.TableName,
+			State:     "running",
+			Host:      host,
+			PID:       os.Getpid(),
+			StartedAt: time.Now(),
+		},
+	}
+	if p.snap.LoadID == "" {
+		p.snap.LoadID = defaultLoadID()
+	}
+	if config.Source == "generate" || config.Source == "introspect" {
+		p.snap.RowsTotal = config.TotalRows
+	}
+
+	if config.StatusTable {
+		_, err := pool.Exec(ctx, `
+			CREATE TABLE IF NOT EXISTS `+statusTable+` (
+				load_id        text PRIMARY KEY,
+				table_name     text        NOT NULL,
+				state          text        NOT NULL,
+				host           text,
+				pid            integer,
+				started_at     timestamptz NOT NULL,
+				updated_at     timestamptz NOT NULL,
+				rows_committed bigint      NOT NULL,
+				rows_total     bigint,
+				table_bytes    bigint,
+				rows_per_sec   float8,
+				trend          text,
+				eta            timestamptz,
+				error          text
+			)`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", statusTable, err)
+		}
+	}
+	if err := p.persist(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, p.cancel = context.WithCancel(ctx)
+	go p.run(ctx)
+	return p, nil
+}
+
+func (p *progressTracker) run(ctx context.Context) {
+	defer close(p.done)
+	ticker := time.NewTicker(config.ProgressInterval)
+	defer ticker.Stop()
+
+	last, lastRows := time.Now(), int64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		rows := p.committed()
+		rate := float64(rows-lastRows) / time.Since(last).Seconds()
+		last, lastRows = time.Now(), rows
+		p.update(ctx, rows, rate)
+		p.print()
+		if err := p.persist(ctx); err != nil && ctx.Err() == nil {
+			fmt.Printf("      ⚠️  Progress: %v\n", err)
+		}
+	}
+}
+
+func (p *progressTracker) committed() int64 {
+	p.metrics.mu.Lock()
+	defer p.metrics.mu.Unlock()
+	return p.metrics.SuccessRows
+}
+
+// update folds one interval into the snapshot.
+func (p *progressTracker) update(ctx context.Context, rows int64, rate float64) {
+	s := &p.snap
+	prev := s.RowsPerSec
+	if prev == 0 {
+		s.RowsPerSec = rate
+	} else {
+		s.RowsPerSec = 0.3*rate + 0.7*prev
+	}
+	loadRate.Store(math.Float64bits(s.RowsPerSec))
+	switch {
+	case prev == 0 || (s.RowsPerSec <= prev*1.05 && s.RowsPerSec >= prev*0.95):
+		s.Trend = "steady"
+	case s.RowsPerSec > prev:
+		s.Trend = "up"
+	default:
+		s.Trend = "down"
+	}
+
+	s.RowsCommitted = rows
+	s.UpdatedAt = time.Now()
+	s.ETA = time.Time{}
+	s.State = "running"
+	if loadPaused() {
+		s.State = "paused"
+	}
+	if s.RowsTotal > 0 && s.RowsPerSec > 0 && s.State == "running" {
+		remaining := float64(max(0, s.RowsTotal-rows)) / s.RowsPerSec
+		s.ETA = s.UpdatedAt.Add(time.Duration(remaining * float64(time.Second)))
+	}
+	p.pool.QueryRow(ctx, "SELECT pg_total_relation_size($1::regclass)", config.TableName).Scan(&s.TableBytes)
+}
+
+func (p *progressTracker) print() {
+	s := p.snap
+	args := []any{"phase", currentPhase(), "rows", s.RowsCommitted, "rows_per_sec", s.RowsPerSec, "state", s.State}
+	if !s.ETA.IsZero() {
+		args = append(args, "eta", s.ETA)
+	}
+	logger.Info("progress", args...)
+	arrows := map[string]string{"up": "↑", "down": "↓", "steady": "→"}
+	line := fmt.Sprintf("   📈 Progress: %d rows", s.RowsCommitted)
+	if s.RowsTotal > 0 {
+		line += fmt.Sprintf(" / %d (%.1f%%)", s.RowsTotal, float64(s.RowsCommitted)/float64(s.RowsTotal)*100)
+	}
+	line += fmt.Sprintf(", %.0f rows/sec %s, table %.1f MB", s.RowsPerSec, arrows[s.Trend], float64(s.TableBytes)/(1<<20))
+	if s.State == "paused" {
+		line += fmt.Sprintf(", ⏸️  paused (%d worker(s) idle)", idleWorkers.Load())
+	}
+	if !s.ETA.IsZero() {
+		line += fmt.Sprintf(", ETA %v (%s)", time.Until(s.ETA).Round(time.Second), s.ETA.Format("15:04:05"))
+	}
+	fmt.Println(line)
+}
+
+// persist writes the snapshot to the status file and table.
+func (p *progressTracker) persist(ctx context.Context) error {
+	s := p.snap
+	if config.StatusFile != "" {
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(config.StatusFile), ".status-*")
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", config.StatusFile, err)
+		}
+		_, err = tmp.Write(append(data, '\n'))
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), config.StatusFile)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("failed to write %s: %w", config.StatusFile, err)
+		}
+	}
+	if config.StatusTable {
+		var eta *time.Time
+		if !s.ETA.IsZero() {
+			eta = &s.ETA
+		}
+		_, err := p.pool.Exec(ctx, `
+			INSERT INTO `+statusTable+` (load_id, table_name, state, host, pid, started_at, updated_at,
+				rows_committed, rows_total, table_bytes, rows_per_sec, trend, eta, error)
+			VALUES ($1, $2, $3, $4, $5, $6, now(), $7, nullif($8::bigint, 0), $9, $10, $11, $12, nullif($13, ''))
+			ON CONFLICT (load_id) DO UPDATE SET
+				table_name = EXCLUDED.table_name, state = EXCLUDED.state, host = EXCLUDED.host,
+				pid = EXCLUDED.pid, started_at = EXCLUDED.started_at, updated_at = EXCLUDED.updated_at,
+				rows_committed = EXCLUDED.rows_committed, rows_total = EXCLUDED.rows_total,
+				table_bytes = EXCLUDED.table_bytes, rows_per_sec = EXCLUDED.rows_per_sec,
+				trend = EXCLUDED.trend, eta = EXCLUDED.eta, error = EXCLUDED.error
+		`, s.LoadID, s.Table, s.State, s.Host, s.PID, s.StartedAt,
+			s.RowsCommitted, s.RowsTotal, s.TableBytes, s.RowsPerSec, s.Trend, eta, s.Error)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", statusTable, err)
+		}
+	}
+	return nil
+}
+
+// stop ends reporting and records the final state.
+func (p *progressTracker) stop(loadErr error) {
+	p.cancel()
+	<-p.done
+
+	ctx := context.Background()
+	p.snap.State = "done"
+	if loadErr != nil {
+		p.snap.State, p.snap.Error = "failed", loadErr.Error()
+	}
+	p.snap.RowsCommitted = p.committed()
+	p.snap.UpdatedAt = time.Now()
+	p.snap.ETA = time.Time{}
+	p.pool.QueryRow(ctx, "SELECT pg_total_relation_size($1::regclass)", config.TableName).Scan(&p.snap.TableBytes)
+	if err := p.persist(ctx); err != nil {
+		fmt.Printf("⚠️  Progress: %v\n", err)
+	}
+}
@@ -0,0 +1,177 @@
+package bulkload
+
+// ============================================================================
+// PROMETHEUS METRICS (-metrics-addr)
+// ============================================================================
+//
+// With -metrics-addr=:9108 the loader serves /metrics for the whole run:
+//   bulk_loader_rows_total                      rows committed
+//   bulk_loader_failed_rows_total               rows failed or quarantined
+//   bulk_loader_goroutine_rows_total{goroutine} rows per worker
+//   bulk_loader_goroutine_errors_total{goroutine}
+//   bulk_loader_rows_per_second                 smoothed throughput (see progress.go)
+//   bulk_loader_last_commit_timestamp_seconds   when rows were last committed
+//   bulk_loader_wal_bytes                       WAL generated since the loader started
+//   bulk_loader_table_bytes                     pg_total_relation_size of the target
+//   bulk_loader_phase{phase}                    1 for the running phase
+//   bulk_loader_phase_duration_seconds{phase}   finished phases
+//   bulk_loader_pool_connections{state}         pgxpool connections: acquired, idle
+//   bulk_loader_pool_max_connections            pgxpool MaxConns
+//   bulk_loader_pool_acquire_wait_seconds_total time spent waiting for a pool connection
+// WAL and table size are queried on scrape (2s timeout).
+//
+// A stall alert:
+//   time() - bulk_loader_last_commit_timestamp_seconds > 300
+//     and on() bulk_loader_phase{phase="load"} == 1
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// loadRate is the smoothed rows/sec (float64 bits), set by the progress
+// tracker.
+var loadRate atomic.Uint64
+
+// phases tracks the running phase and finished phase durations.
+var phases = struct {
+	mu       sync.Mutex
+	current  string
+	last     string // The phase before current, for errors after it ended
+	started  time.Time
+	finished map[string]time.Duration
+}{finished: make(map[string]time.Duration)}
+
+// beginPhase marks a phase as running; call the returned func when it ends.
+func beginPhase(name string) func() {
+	phases.mu.Lock()
+	phases.current, phases.started = name, time.Now()
+	phases.mu.Unlock()
+	logger.Info("phase started", "phase", name)
+	return func() {
+		phases.mu.Lock()
+		defer phases.mu.Unlock()
+		d := time.Since(phases.started)
+		phases.finished[name] = d
+		phases.current, phases.last = "", name
+		logger.Info("phase finished", "phase", name, "duration_ms", d.Milliseconds())
+	}
+}
+
+// loaderCollector reads LoadMetrics and the database on every scrape.
+type loaderCollector struct {
+	pool     *pgxpool.Pool
+	metrics  *LoadMetrics
+	startWAL string
+
+	rows, failed, goroutineRows, goroutineErrors *prometheus.Desc
+	rate, lastCommit, walBytes, tableBytes       *prometheus.Desc
+	phase, phaseDuration                         *prometheus.Desc
+	poolConns, poolMax, poolWait                 *prometheus.Desc
+}
+
+func newLoaderCollector(pool *pgxpool.Pool, metrics *LoadMetrics, startWAL string) *loaderCollector {
+	table := prometheus.Labels{"table": config.TableName}
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc("bulk_loader_"+name, help, labels, table)
+	}
+	return &loaderCollector{
+		pool:            pool,
+		metrics:         metrics,
+		startWAL:        startWAL,
+		rows:            desc("rows_total", "Rows committed."),
+		failed:          desc("failed_rows_total", "Rows that failed or were quarantined."),
+		goroutineRows:   desc("goroutine_rows_total", "Rows committed per worker.", "goroutine"),
+		goroutineErrors: desc("goroutine_errors_total", "Errors per worker.", "goroutine"),
+		rate:            desc("rows_per_second", "Smoothed load throughput."),
+		lastCommit:      desc("last_commit_timestamp_seconds", "Unix time rows were last committed."),
+		walBytes:        desc("wal_bytes", "WAL generated since the loader started."),
+		tableBytes:      desc("table_bytes", "Total size of the target table."),
+		phase:           desc("phase", "1 for the running phase.", "phase"),
+		phaseDuration:   desc("phase_duration_seconds", "Duration of finished phases.", "phase"),
+		poolConns:       desc("pool_connections", "Connections of the loader's pool by state.", "state"),
+		poolMax:         desc("pool_max_connections", "Size limit of the loader's pool."),
+		poolWait:        desc("pool_acquire_wait_seconds_total", "Time spent waiting for a pool connection."),
+	}
+}
+
+func (c *loaderCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *loaderCollector) Collect(ch chan<- prometheus.Metric) {
+	m := c.metrics
+	m.mu.Lock()
+	ch <- prometheus.MustNewConstMetric(c.rows, prometheus.CounterValue, float64(m.SuccessRows))
+	ch <- prometheus.MustNewConstMetric(c.failed, prometheus.CounterValue, float64(m.FailedRows))
+	for id, gm := range m.GoroutineMetrics {
+		label := strconv.Itoa(id)
+		ch <- prometheus.MustNewConstMetric(c.goroutineRows, prometheus.CounterValue, float64(gm.RowsProcessed), label)
+		ch <- prometheus.MustNewConstMetric(c.goroutineErrors, prometheus.CounterValue, float64(gm.ErrorCount), label)
+	}
+	if !m.LastCommit.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastCommit, prometheus.GaugeValue, float64(m.LastCommit.UnixNano())/1e9)
+	}
+	m.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(c.rate, prometheus.GaugeValue, math.Float64frombits(loadRate.Load()))
+
+	phases.mu.Lock()
+	if phases.current != "" {
+		ch <- prometheus.MustNewConstMetric(c.phase, prometheus.GaugeValue, 1, phases.current)
+	}
+	for name, d := range phases.finished {
+		ch <- prometheus.MustNewConstMetric(c.phaseDuration, prometheus.GaugeValue, d.Seconds(), name)
+	}
+	phases.mu.Unlock()
+
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.poolConns, prometheus.GaugeValue, float64(stat.AcquiredConns()), "acquired")
+	ch <- prometheus.MustNewConstMetric(c.poolConns, prometheus.GaugeValue, float64(stat.IdleConns()), "idle")
+	ch <- prometheus.MustNewConstMetric(c.poolMax, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.poolWait, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var wal, size float64
+	if err := c.pool.QueryRow(ctx, "SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), $1)::float8", c.startWAL).Scan(&wal); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.walBytes, prometheus.GaugeValue, wal)
+	}
+	if err := c.pool.QueryRow(ctx, "SELECT pg_total_relation_size($1::regclass)::float8", config.TableName).Scan(&size); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.tableBytes, prometheus.GaugeValue, size)
+	}
+}
+
+// startMetricsServer serves /metrics on config.MetricsAddr in the
+// background.
+func startMetricsServer(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	var startWAL string
+	if err := pool.QueryRow(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&startWAL); err != nil {
+		return fmt.Errorf("failed to read WAL position for metrics: %w", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newLoaderCollector(pool, metrics, startWAL))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: config.MetricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	fmt.Printf("📡 Prometheus metrics on http://%s/metrics\n", config.MetricsAddr)
+	return nil
+}
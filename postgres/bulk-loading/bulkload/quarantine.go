@@ -0,0 +1,179 @@
+package bulkload
+
+// ============================================================================
+// BAD-ROW QUARANTINE WITH BATCH BISECTION (config.LogBadRows)
+// ============================================================================
+//
+// A single bad row fails the whole COPY it is part of. With LogBadRows the
+// loader COPYs in batches of config.BatchSize rows inside a savepoint; when
+// a batch fails with a data error (SQLSTATE class 22) or an integrity
+// violation (class 23) it is rolled back, split in half and retried until
+// the offending rows are isolated. Each one is written to
+// config.BadRowsTable with the error message and the row as JSON, and the
+// load carries on. Other errors (connection loss, missing table) still
+// fail the load.
+//
+// A batch with b bad rows costs about b*log2(BatchSize) extra COPYs, so
+// -max-bad-rows stops runaway bisection when the input is wholesale wrong.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// copyTarget is satisfied by *pgxpool.Conn and pgx.Tx; Begin on a Tx
+// creates a savepoint.
+type copyTarget interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+var quarantinedRows atomic.Int64
+
+// ensureBadRowsTable creates the quarantine table when loading into a
+// table that didn't come from createTableSQL.
+func ensureBadRowsTable(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			error_id            BIGSERIAL PRIMARY KEY,
+			failed_at           TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			error_message       TEXT,
+			row_data            JSONB,
+			goroutine_id        INTEGER
+		)`, pgx.Identifier{config.BadRowsTable}.Sanitize()))
+	if err != nil {
+		return fmt.Errorf("failed to create bad rows table %s: %w", config.BadRowsTable, err)
+	}
+	return nil
+}
+
+// copyRows loads rows into table (the target or one of its partitions).
+// Without LogBadRows it is a plain COPY; with it, failing batches are
+// bisected and bad rows quarantined.
+func copyRows(ctx context.Context, db copyTarget, goroutineID int, table string, columns []string, rows [][]interface{}, metrics *LoadMetrics) (int64, error) {
+	if !config.LogBadRows {
+		return writeRows(ctx, db, table, columns, rows)
+	}
+	return bisectCopy(ctx, db, goroutineID, table, columns, rows, metrics)
+}
+
+func bisectCopy(ctx context.Context, db copyTarget, goroutineID int, table string, columns []string, rows [][]interface{}, metrics *LoadMetrics) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	var n int64
+	err := retryTxn(ctx, db, func() error {
+		sp, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if n, err = writeRows(ctx, sp, table, columns, rows); err == nil {
+			return sp.Commit(ctx)
+		}
+		if rbErr := sp.Rollback(ctx); rbErr != nil {
+			return rbErr
+		}
+		return err
+	})
+	if err == nil {
+		return n, nil
+	}
+	if !isRowError(err) {
+		return 0, err
+	}
+
+	if len(rows) == 1 {
+		return 0, quarantineRow(ctx, db, goroutineID, columns, rows[0], err, metrics)
+	}
+
+	mid := len(rows) / 2
+	left, err := bisectCopy(ctx, db, goroutineID, table, columns, rows[:mid], metrics)
+	if err != nil {
+		return left, err
+	}
+	right, err := bisectCopy(ctx, db, goroutineID, table, columns, rows[mid:], metrics)
+	return left + right, err
+}
+
+// isRowError reports whether err is caused by row contents rather than the
+// connection or the statement.
+func isRowError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || len(pgErr.Code) < 2 {
+		return false
+	}
+	class := pgErr.Code[:2]
+	return class == "22" || class == "23"
+}
+
+func quarantineRow(ctx context.Context, db copyTarget, goroutineID int, columns []string, row []interface{}, rowErr error, metrics *LoadMetrics) error {
+	data := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		data[col] = row[i]
+	}
+	rowJSON, err := json.Marshal(data)
+	if err != nil {
+		rowJSON, _ = json.Marshal(map[string]string{"unencodable_row": fmt.Sprint(row)})
+	}
+
+	_, err = db.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %s (error_message, row_data, goroutine_id) VALUES ($1, $2, $3)
+	`, pgx.Identifier{config.BadRowsTable}.Sanitize()), rowErr.Error(), string(rowJSON), goroutineID)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine bad row: %w", err)
+	}
+	metrics.RecordError(goroutineID)
+
+	if n := quarantinedRows.Add(1); config.MaxBadRows > 0 && n > config.MaxBadRows {
+		return fmt.Errorf("more than %d bad rows quarantined, giving up (last: %v)", config.MaxBadRows, rowErr)
+	}
+	return nil
+}
+
+// copyGeneratedBatches is loadInGoroutine's COPY with bad-row logging or
+// throttling: the generator stream is cut into BatchSize batches so a bad
+// row only costs its own batch and throttles can act between batches.
+func copyGeneratedBatches(ctx context.Context, conn *pgxpool.Conn, goroutineID int, table string, gen *transactionGenerator, metrics *LoadMetrics) (int64, error) {
+	var loaded int64
+	for {
+		batchDone, err := beginBatch(ctx)
+		if err != nil {
+			return loaded, err
+		}
+		rows, err := collectRows(gen, int64(config.BatchSize))
+		if err != nil || len(rows) == 0 {
+			batchDone(0)
+			return loaded, err
+		}
+		n, err := copyRows(ctx, conn, goroutineID, table, loadedColumns, rows, metrics)
+		batchDone(n)
+		loaded += n
+		if err != nil {
+			return loaded, err
+		}
+	}
+}
+
+// collectRows materializes up to n rows from a generator so they can be
+// retried by bisectCopy.
+func collectRows(src pgx.CopyFromSource, n int64) ([][]interface{}, error) {
+	rows := make([][]interface{}, 0, n)
+	for int64(len(rows)) < n && src.Next() {
+		values, err := src.Values()
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, values)
+	}
+	return rows, src.Err()
+}
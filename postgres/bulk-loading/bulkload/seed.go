@@ -0,0 +1,98 @@
+package bulkload
+
+// ============================================================================
+// DETERMINISTIC GENERATION (-seed, -as-of)
+// ============================================================================
+//
+// With -seed=N every generated row is a pure function of N and the row's
+// position in the load: before each row the generator's random source is
+// reset to hash(seed, row). Rerunning with the same -seed, TotalRows and
+// Goroutines reproduces the dataset byte for byte (UUIDs, faker values and
+// profiled columns included), so a load or a replica can be checked row by
+// row against a regenerated copy.
+//
+// Row positions:
+//   - plain loads: goroutine g generates rows [g*rows/goroutines, ...)
+//   - checkpointed loads: chunk k covers rows [k*BatchSize, ...), so resumed
+//     chunks regenerate exactly what the interrupted run would have written
+//   - partition-routed loads: work units are numbered in partition order
+//   - -mode=append: all of the above, shifted past the existing rows
+//
+// Dates are relative to "now"; pass -as-of=2025-01-31 as well to pin them.
+// metadata.goroutine_id and processed_by still name the goroutine that
+// wrote the row.
+
+import (
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rowSource is a splitmix64 generator: cheap to reposition for every row
+// and usable both as a math/rand Source64 and a math/rand/v2 Source.
+type rowSource struct {
+	state uint64
+}
+
+func (s *rowSource) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *rowSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *rowSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// seek positions the source at the start of row's random stream.
+func (s *rowSource) seek(seed, row int64) {
+	s.state = uint64(seed)
+	s.state ^= s.Uint64() + uint64(row)*0xd1b54a32d192ed03
+}
+
+// random returns the generator's source, creating it on first use.
+func (g *transactionGenerator) random() *rand.Rand {
+	if g.rng == nil {
+		g.src = &rowSource{state: uint64(rand.Int63())}
+		g.rng = rand.New(g.src)
+	}
+	return g.rng
+}
+
+// Read fills p from the stream without buffering leftovers (unlike
+// rand.Rand.Read), so UUIDs stay tied to their row.
+func (s *rowSource) Read(p []byte) (int, error) {
+	for i := 0; i < len(p); i += 8 {
+		v := s.Uint64()
+		for j := i; j < len(p) && j < i+8; j++ {
+			p[j] = byte(v)
+			v >>= 8
+		}
+	}
+	return len(p), nil
+}
+
+// newUUID draws a version 4 UUID from r instead of crypto/rand.
+func newUUID(r io.Reader) uuid.UUID {
+	id, err := uuid.NewRandomFromReader(r)
+	if err != nil {
+		return uuid.New()
+	}
+	return id
+}
+
+// generatorNow is the reference time generated dates count back from.
+func generatorNow() time.Time {
+	if !config.AsOf.IsZero() {
+		return config.AsOf
+	}
+	return time.Now()
+}
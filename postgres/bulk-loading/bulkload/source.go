@@ -0,0 +1,422 @@
+package bulkload
+
+// ============================================================================
+// INPUT SOURCES (-source)
+// ============================================================================
+//
+// By default the loader generates synthetic rows (transactionGenerator).
+// File sources feed real extracts through the same COPY pipeline: a single
+// reader decodes rows and hands batches of config.BatchSize rows to
+// config.Goroutines COPY workers.
+//
+//   go run ./cmd/prod_loader -mode=load -source=csv -file=extract.csv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Source yields rows in Columns() order. Next returns io.EOF when the
+// source is exhausted.
+type Source interface {
+	Columns() []string
+	Next() ([]interface{}, error)
+	Close() error
+}
+
+// openSource opens the source selected by config.Source, masked by the
+// -mask rules (see mask.go) and without generated columns (see
+// triggers.go).
+func openSource(ctx context.Context, pool *pgxpool.Pool) (Source, error) {
+	src, err := openUnmaskedSource(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	masked, err := wrapMasking(ctx, pool, src)
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	loaded, err := wrapGenerated(ctx, pool, masked)
+	if err != nil {
+		masked.Close()
+		return nil, err
+	}
+	return loaded, nil
+}
+
+func openUnmaskedSource(ctx context.Context, pool *pgxpool.Pool) (Source, error) {
+	if config.Source == "introspect" {
+		return openIntrospectSource(ctx, pool, config.SourceColumns)
+	}
+	types, err := columnTypes(ctx, pool, config.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Source {
+	case "csv":
+		return openCSVSource(ctx, config.SourceFile, config.SourceColumns, types)
+	case "avro":
+		return openAvroSource(ctx, config.SourceFile, config.SourceColumns, types)
+	case "ndjson", "jsonl":
+		return openNDJSONSource(ctx, config.SourceFile, config.SourceColumns, types)
+	default:
+		return nil, fmt.Errorf("unknown source %q (use generate, introspect, csv, avro, ndjson)", config.Source)
+	}
+}
+
+// sourceName names the source in progress messages.
+func sourceName() string {
+	if config.Source == "introspect" {
+		return "generator for " + config.TableName
+	}
+	return config.SourceFile
+}
+
+// columnTypes maps each column of the target table to its type name
+// (as rendered by regtype, e.g. "bigint", "numeric", "text[]").
+func columnTypes(ctx context.Context, pool *pgxpool.Pool, tableName string) (map[string]string, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT attname, atttypid::regtype::text
+		FROM pg_attribute
+		WHERE attrelid = $1::regclass
+		  AND attnum > 0
+		  AND NOT attisdropped
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		types[name] = typ
+	}
+	return types, rows.Err()
+}
+
+// checkColumns verifies every source column exists in the target table.
+func checkColumns(columns []string, types map[string]string) error {
+	if len(columns) == 0 {
+		return errors.New("no columns to load (use -columns or a header row)")
+	}
+	for _, col := range columns {
+		if _, ok := types[col]; !ok {
+			return fmt.Errorf("column %q does not exist in %s", col, config.TableName)
+		}
+	}
+	return nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// coerceValue converts a text field into a value CopyFrom can encode for the
+// given PostgreSQL type. Types we don't special-case are passed as text.
+func coerceValue(raw, pgType string) (interface{}, error) {
+	switch pgType {
+	case "smallint", "integer", "bigint":
+		return strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	case "real", "double precision":
+		return strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	case "numeric":
+		var n pgtype.Numeric
+		if err := n.Scan(strings.TrimSpace(raw)); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case "boolean":
+		switch strings.ToLower(strings.TrimSpace(raw)) {
+		case "t", "true", "y", "yes", "on", "1":
+			return true, nil
+		case "f", "false", "n", "no", "off", "0":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", raw)
+	case "date", "timestamp without time zone", "timestamp with time zone":
+		s := strings.TrimSpace(raw)
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid %s %q", pgType, raw)
+	case "uuid":
+		return uuid.Parse(strings.TrimSpace(raw))
+	case "text[]", "character varying[]":
+		return parseTextArray(raw)
+	default:
+		// text, varchar, char, json/jsonb (raw JSON text) and anything else
+		return raw, nil
+	}
+}
+
+// coerceNative converts an already decoded value (Avro, JSON) for the given
+// PostgreSQL type. Strings go through coerceValue.
+func coerceNative(v interface{}, pgType string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if pgType == "json" || pgType == "jsonb" {
+		if b, ok := v.([]byte); ok {
+			return string(b), nil
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+
+	switch x := v.(type) {
+	case string:
+		return coerceValue(x, pgType)
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return coerceInt(n, pgType)
+		}
+		return coerceValue(x.String(), pgType)
+	case time.Time:
+		return x, nil
+	case bool:
+		return coerceValue(strconv.FormatBool(x), pgType)
+	case []byte:
+		if pgType == "bytea" {
+			return x, nil
+		}
+		return coerceValue(string(x), pgType)
+	case *big.Rat:
+		return coerceValue(ratString(x), pgType)
+	case int:
+		return coerceInt(int64(x), pgType)
+	case int32:
+		return coerceInt(int64(x), pgType)
+	case int64:
+		return coerceInt(x, pgType)
+	case float32:
+		return coerceValue(strconv.FormatFloat(float64(x), 'f', -1, 32), pgType)
+	case float64:
+		return coerceValue(strconv.FormatFloat(x, 'f', -1, 64), pgType)
+	case []interface{}:
+		elems := make([]string, len(x))
+		for i, e := range x {
+			elems[i] = fmt.Sprint(e)
+		}
+		return elems, nil
+	}
+	return coerceValue(fmt.Sprint(v), pgType)
+}
+
+// coerceInt treats integers loaded into date/timestamp columns as epoch
+// milliseconds (Avro long without a logical type, JSON event timestamps).
+func coerceInt(n int64, pgType string) (interface{}, error) {
+	switch pgType {
+	case "date", "timestamp without time zone", "timestamp with time zone":
+		return time.UnixMilli(n).UTC(), nil
+	}
+	return coerceValue(strconv.FormatInt(n, 10), pgType)
+}
+
+// ratString renders an Avro decimal exactly enough for NUMERIC columns; the
+// column's own scale does the final rounding.
+func ratString(r *big.Rat) string {
+	s := r.FloatString(18)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// parseTextArray accepts a PostgreSQL array literal ({a,"b c"}) or, for
+// convenience, a bare comma separated list.
+func parseTextArray(raw string) ([]string, error) {
+	s := strings.TrimSpace(raw)
+	if strings.HasPrefix(s, "{") {
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("invalid array literal %q", raw)
+		}
+		s = s[1 : len(s)-1]
+	}
+	if s == "" {
+		return []string{}, nil
+	}
+
+	var out []string
+	var cur strings.Builder
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && inQuotes && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == ',' && !inQuotes:
+			out = append(out, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote in array literal %q", raw)
+	}
+	return append(out, strings.TrimSpace(cur.String())), nil
+}
+
+// loadFromSource streams the source into the target table. The reader runs
+// in this goroutine; COPY workers each take whole batches from the channel.
+func loadFromSource(ctx context.Context, pool *pgxpool.Pool, src Source, metrics *LoadMetrics) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	columns := src.Columns()
+	batches := make(chan sourceBatch, config.Goroutines*2)
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, config.Goroutines)
+	for g := 0; g < config.Goroutines; g++ {
+		wg.Add(1)
+		go func(goroutineID int) {
+			defer wg.Done()
+			if err := copyBatches(ctx, pool, goroutineID, columns, batches, metrics); err != nil {
+				errChan <- fmt.Errorf("goroutine %d failed: %w", goroutineID, err)
+				cancel()
+			}
+		}(g)
+	}
+
+	var readErr error
+	var rowsRead, rowsSkipped int64
+	batch := sourceBatch{rows: make([][]interface{}, 0, config.BatchSize)}
+	lastReport := time.Now()
+read:
+	for {
+		row, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		rowsRead++
+		batch.rows = append(batch.rows, row)
+		if len(batch.rows) < config.BatchSize {
+			continue
+		}
+
+		if checkpoints != nil && checkpoints.isDone(batch.id) {
+			rowsSkipped += int64(len(batch.rows))
+		} else {
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				break read
+			}
+		}
+		batch = sourceBatch{id: batch.id + 1, rows: make([][]interface{}, 0, config.BatchSize)}
+
+		if time.Since(lastReport) > 2*time.Second {
+			fmt.Printf("      💾 Read %d rows from %s\n", rowsRead, sourceName())
+			lastReport = time.Now()
+		}
+	}
+	if len(batch.rows) > 0 && readErr == nil && (checkpoints == nil || !checkpoints.isDone(batch.id)) {
+		select {
+		case batches <- batch:
+		case <-ctx.Done():
+		}
+	}
+	close(batches)
+
+	wg.Wait()
+	close(errChan)
+
+	metrics.TotalRows = rowsRead
+	fmt.Printf("   📄 Read %d rows from %s\n", rowsRead, sourceName())
+	if rowsSkipped > 0 {
+		fmt.Printf("   📍 Skipped %d rows already committed by an earlier run\n", rowsSkipped)
+	}
+
+	var failed bool
+	for err := range errChan {
+		log.Printf("Error during load: %v", err)
+		failed = true
+	}
+	if readErr != nil {
+		return fmt.Errorf("failed reading %s: %w", sourceName(), readErr)
+	}
+	if failed {
+		return errors.New("one or more COPY workers failed")
+	}
+	return nil
+}
+
+// sourceBatch is one chunk of rows; id is its position in the input and
+// doubles as the checkpoint chunk id.
+type sourceBatch struct {
+	id   int64
+	rows [][]interface{}
+}
+
+func copyBatches(ctx context.Context, pool *pgxpool.Pool, goroutineID int, columns []string, batches <-chan sourceBatch, metrics *LoadMetrics) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	start := time.Now()
+	var total int64
+	for batch := range batches {
+		batchDone, err := beginBatch(ctx)
+		if err != nil {
+			return err
+		}
+		var n int64
+		if checkpoints != nil {
+			n, err = copyChunk(ctx, conn, goroutineID, batch.id, columns, batch.rows, metrics)
+		} else if partitions != nil && config.RoutePartitions {
+			n, err = copyRouted(ctx, pool, conn, goroutineID, columns, batch.rows, metrics)
+		} else {
+			n, err = copyRows(ctx, conn, goroutineID, config.TableName, columns, batch.rows, metrics)
+		}
+		batchDone(n)
+		if err != nil {
+			metrics.RecordError(goroutineID)
+			return err
+		}
+		metrics.RecordSuccess(goroutineID, n)
+		total += n
+	}
+
+	duration := time.Since(start)
+	logWorker(goroutineID, total, duration)
+	fmt.Printf("   ✅ Goroutine %d: Completed %d rows in %v (%.0f rows/sec)\n",
+		goroutineID, total, duration, float64(total)/duration.Seconds())
+	return nil
+}
@@ -0,0 +1,671 @@
+package bulkload
+
+// ============================================================================
+// ZERO-DOWNTIME RELOAD (-mode=swap)
+// ============================================================================
+//
+// -mode=all truncates the target, so readers see an empty, then half
+// loaded table for hours. -mode=swap reloads a table that serves live
+// traffic without that:
+//   1. create <table>_new (-swap-table) like the target: columns, defaults,
+//      CHECK and NOT NULL constraints, identity, storage and reloptions,
+//      but no indexes; UNLOGGED with -unlogged
+//   2. COPY into it with the -mode=load pipeline
+//   3. finalize it: SET LOGGED, build the target's indexes, PRIMARY KEY,
+//      UNIQUE and EXCLUSION constraints (plain CREATE INDEX, nobody reads
+//      the table yet), foreign keys, owner and grants, ANALYZE. Triggers
+//      are created with the table, so they fire for the loaded rows, or
+//      here with -trigger-mode=fast (see triggers.go)
+//   4. validate it as -mode=validate does; a failure stops here, the
+//      target untouched
+//   5. swap in one transaction: the target becomes <table>_old, <table>_new
+//      becomes the target, index names and serial sequences move along.
+//      A partition is detached and the new table attached in its place;
+//      a CHECK matching the partition bound, added in step 3, spares
+//      ATTACH PARTITION its scan. -reconcile-sql runs after the swap.
+// The swap takes ACCESS EXCLUSIVE on the target (and the parent of a
+// partition) for the catalog updates only. It waits at most
+// -swap-lock-timeout behind running queries, so it never queues live
+// traffic for long, and retries a few times. <table>_old is kept for a
+// rollback unless -swap-drop-old.
+//
+// Objects that point at the table's OID instead of its name would keep
+// reading <table>_old: views, foreign keys from other tables, publications
+// and row level security policies. The swap refuses such tables.
+//
+//   go run ./cmd/prod_loader -mode=swap -rows=50000000
+//   go run ./cmd/prod_loader -mode=swap -table=financial_transactions_2024_06 -source=csv -file=june.csv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// swapAttempts is how often the swap transaction runs into
+// -swap-lock-timeout before giving up.
+const swapAttempts = 5
+
+// swapIndex is an index of the target rebuilt on the staging table.
+type swapIndex struct {
+	name       string // Unqualified, as in pg_class
+	def        string // pg_get_indexdef
+	contype    string // p, u, x for constraint indexes, else empty
+	condef     string // pg_get_constraintdef for x
+	deferrable string // DEFERRABLE clause for p and u
+}
+
+// swapPlan is what the swap copies from the target.
+type swapPlan struct {
+	target, staging, old string
+	parent, bound        string // Partition: parent table and FOR VALUES
+	boundCheck           string // Partition constraint
+	reloptions           []string
+	comment              *string
+	owner                string // Empty when it's the current user
+	indexes              []swapIndex
+	foreignKeys          []string // ADD CONSTRAINT clauses
+	triggers             []string // pg_get_triggerdef
+	grants               []string
+	serials              [][2]string // Column, sequence owned by the target
+}
+
+// swapMarker comments the staging table, so a rerun only drops tables an
+// earlier swap created.
+func swapMarker(target string) string {
+	return "bulkload -mode=swap staging table for " + target
+}
+
+// suffixed appends suffix to an identifier within PostgreSQL's 63 bytes.
+func suffixed(name, suffix string) string {
+	return name[:min(len(name), 63-len(suffix))] + suffix
+}
+
+func runSwap(ctx context.Context, pool, ddl *pgxpool.Pool, metrics *LoadMetrics) error {
+	if cockroach() {
+		return fmt.Errorf("-mode=swap needs PostgreSQL")
+	}
+	if config.Checkpoint {
+		return fmt.Errorf("-mode=swap recreates its staging table and cannot be resumed; drop -checkpoint")
+	}
+	target := config.TableName
+	staging := config.SwapTable
+	if staging == "" {
+		staging = suffixed(target, "_new")
+	}
+	if staging == target {
+		return fmt.Errorf("-swap-table must differ from -table")
+	}
+
+	fmt.Println("\n🔀 SWAP: RELOAD INTO A STAGING TABLE AND SWAP IT IN")
+	fmt.Println(strings.Repeat("=", 80))
+	plan, err := planSwap(ctx, ddl, target, staging, suffixed(target, "_old"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Target: %s, staging: %s, previous data kept as: %s\n", plan.target, plan.staging, plan.old)
+	if plan.parent != "" {
+		fmt.Printf("Partition of %s %s\n", plan.parent, plan.bound)
+	}
+	fmt.Printf("Copies %d indexes, %d foreign keys, %d triggers, %d grants\n",
+		len(plan.indexes), len(plan.foreignKeys), len(plan.triggers), len(plan.grants))
+	if err := createStaging(ctx, ddl, plan); err != nil {
+		return err
+	}
+	fmt.Println(strings.Repeat("=", 80))
+
+	// -reconcile-sql reads the target, so it runs once the new rows are in it.
+	reconcileSQL := config.ReconcileSQL
+	config.TableName, config.ReconcileSQL = staging, ""
+	defer func() { config.TableName, config.ReconcileSQL = target, reconcileSQL }()
+	if err := executeLoad(ctx, pool, metrics); err != nil {
+		return err
+	}
+	if err := finalizeStaging(ctx, ddl, plan, metrics); err != nil {
+		return fmt.Errorf("%w (%s is left for inspection, %s is untouched)", err, staging, target)
+	}
+
+	// File sources count their rows while loading.
+	expected := config.TotalRows
+	config.TotalRows = metrics.TotalRows
+	err = runValidation(ctx, pool)
+	config.TotalRows = expected
+	if err != nil {
+		return fmt.Errorf("%w; %s not swapped in", err, staging)
+	}
+
+	if err := swapTables(ctx, ddl, plan); err != nil {
+		return err
+	}
+	config.TableName, config.ReconcileSQL = target, reconcileSQL
+	if err := reconcile(ctx, ddl)(nil); err != nil {
+		return err
+	}
+	if config.SwapDropOld {
+		if _, err := ddl.Exec(ctx, "DROP TABLE "+pgx.Identifier{plan.old}.Sanitize()); err != nil {
+			return fmt.Errorf("swapped, but dropping %s failed: %w", plan.old, err)
+		}
+		fmt.Printf("   🗑️  Dropped %s\n", plan.old)
+	} else {
+		fmt.Printf("   💡 Previous data in %s; once satisfied: DROP TABLE %s;\n", plan.old, plan.old)
+	}
+	return nil
+}
+
+// planSwap checks the target can be swapped and reads what the staging
+// table needs to look like it.
+func planSwap(ctx context.Context, pool *pgxpool.Pool, target, staging, old string) (*swapPlan, error) {
+	plan := &swapPlan{target: target, staging: staging, old: old}
+	var relkind string
+	var oldExists bool
+	err := pool.QueryRow(ctx, `
+		SELECT c.relkind::text, coalesce(c.reloptions, '{}'), obj_description(c.oid, 'pg_class'),
+		       CASE WHEN pg_get_userbyid(c.relowner) <> current_user THEN pg_get_userbyid(c.relowner)::text ELSE '' END,
+		       coalesce(i.inhparent::regclass::text, ''), coalesce(pg_get_expr(c.relpartbound, c.oid), ''),
+		       coalesce(pg_get_partition_constraintdef(c.oid), ''),
+		       to_regclass($2) IS NOT NULL
+		FROM pg_class c
+		LEFT JOIN pg_inherits i ON i.inhrelid = c.oid AND c.relispartition
+		WHERE c.oid = to_regclass($1)
+	`, target, old).Scan(&relkind, &plan.reloptions, &plan.comment, &plan.owner,
+		&plan.parent, &plan.bound, &plan.boundCheck, &oldExists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("table %s does not exist", target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case relkind == "p":
+		return nil, fmt.Errorf("%s is partitioned; swap one partition at a time with -table=<partition>", target)
+	case relkind != "r":
+		return nil, fmt.Errorf("%s is not a table", target)
+	case oldExists:
+		return nil, fmt.Errorf("%s is left from an earlier swap; drop it first", old)
+	}
+
+	blockers, err := queryStrings(ctx, pool, `
+		SELECT 'view ' || v.oid::regclass::text
+		FROM pg_depend d
+		JOIN pg_rewrite r ON r.oid = d.objid
+		JOIN pg_class v ON v.oid = r.ev_class
+		WHERE d.classid = 'pg_rewrite'::regclass AND d.refobjid = $1::regclass AND v.oid <> $1::regclass
+		UNION
+		SELECT 'foreign key ' || conname || ' on ' || conrelid::regclass::text
+		FROM pg_constraint WHERE contype = 'f' AND confrelid = $1::regclass AND conparentid = 0
+		UNION
+		SELECT 'publication ' || p.pubname
+		FROM pg_publication_rel pr JOIN pg_publication p ON p.oid = pr.prpubid
+		WHERE pr.prrelid = $1::regclass
+		UNION
+		SELECT 'policy ' || polname FROM pg_policy WHERE polrelid = $1::regclass
+		ORDER BY 1
+	`, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockers) > 0 {
+		return nil, fmt.Errorf("%s can't be swapped, these would keep pointing at the old table: %s",
+			target, strings.Join(blockers, ", "))
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT c.relname::text, pg_get_indexdef(i.indexrelid), coalesce(con.contype::text, ''),
+		       coalesce(pg_get_constraintdef(con.oid), ''),
+		       CASE WHEN con.condeferred THEN ' DEFERRABLE INITIALLY DEFERRED'
+		            WHEN con.condeferrable THEN ' DEFERRABLE' ELSE '' END
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		LEFT JOIN pg_constraint con ON con.conindid = i.indexrelid AND con.conrelid = i.indrelid
+		     AND con.contype IN ('p', 'u', 'x')
+		WHERE i.indrelid = $1::regclass
+		ORDER BY c.relname
+	`, target)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var idx swapIndex
+		if err := rows.Scan(&idx.name, &idx.def, &idx.contype, &idx.condef, &idx.deferrable); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		plan.indexes = append(plan.indexes, idx)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Inherited foreign keys and triggers come back with ATTACH PARTITION.
+	if plan.foreignKeys, err = queryStrings(ctx, pool, `
+		SELECT quote_ident(conname) || ' ' || pg_get_constraintdef(oid)
+		FROM pg_constraint WHERE conrelid = $1::regclass AND contype = 'f' AND conparentid = 0
+		ORDER BY conname
+	`, target); err != nil {
+		return nil, err
+	}
+	if plan.triggers, err = queryStrings(ctx, pool, `
+		SELECT pg_get_triggerdef(oid) FROM pg_trigger
+		WHERE tgrelid = $1::regclass AND NOT tgisinternal AND tgparentid = 0
+		ORDER BY tgname
+	`, target); err != nil {
+		return nil, err
+	}
+	if plan.grants, err = queryStrings(ctx, pool, `
+		SELECT format('GRANT %s ON TABLE %s TO %s%s', a.privilege_type, $2::text,
+		       CASE a.grantee WHEN 0 THEN 'PUBLIC' ELSE quote_ident(pg_get_userbyid(a.grantee)) END,
+		       CASE WHEN a.is_grantable THEN ' WITH GRANT OPTION' ELSE '' END)
+		FROM pg_class c, aclexplode(c.relacl) a
+		WHERE c.oid = $1::regclass AND a.grantee <> c.relowner
+		ORDER BY 1
+	`, target, pgx.Identifier{staging}.Sanitize()); err != nil {
+		return nil, err
+	}
+	serials, err := pool.Query(ctx, `
+		SELECT a.attname::text, pg_get_serial_sequence($1, a.attname)
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped AND a.attidentity = ''
+		  AND pg_get_serial_sequence($1, a.attname) IS NOT NULL
+	`, target)
+	if err != nil {
+		return nil, err
+	}
+	for serials.Next() {
+		var s [2]string
+		if err := serials.Scan(&s[0], &s[1]); err != nil {
+			serials.Close()
+			return nil, err
+		}
+		plan.serials = append(plan.serials, s)
+	}
+	serials.Close()
+	return plan, serials.Err()
+}
+
+// createStaging creates the empty staging table, replacing one left by an
+// earlier swap of the same target.
+func createStaging(ctx context.Context, pool *pgxpool.Pool, plan *swapPlan) error {
+	stagingIdent := pgx.Identifier{plan.staging}.Sanitize()
+	var exists bool
+	var comment *string
+	err := pool.QueryRow(ctx, `
+		SELECT to_regclass($1) IS NOT NULL, obj_description(to_regclass($1), 'pg_class')
+	`, plan.staging).Scan(&exists, &comment)
+	if err != nil {
+		return err
+	}
+	if exists {
+		if comment == nil || *comment != swapMarker(plan.target) {
+			return fmt.Errorf("%s exists and wasn't created by -mode=swap; drop it or pick another -swap-table", plan.staging)
+		}
+		if _, err := pool.Exec(ctx, "DROP TABLE "+stagingIdent); err != nil {
+			return err
+		}
+		fmt.Printf("   🗑️  Dropped %s left by an earlier swap\n", plan.staging)
+	}
+
+	// The target's autovacuum setting comes back in finalizeStaging.
+	options := []string{"autovacuum_enabled = false"}
+	for _, opt := range plan.reloptions {
+		if !strings.HasPrefix(opt, "autovacuum_enabled=") {
+			options = append(options, opt)
+		}
+	}
+	persistence := ""
+	if config.Unlogged {
+		persistence = "UNLOGGED "
+	}
+	_, err = pool.Exec(ctx, fmt.Sprintf(`
+		CREATE %sTABLE %s (LIKE %s INCLUDING ALL EXCLUDING INDEXES) WITH (%s);
+		COMMENT ON TABLE %s IS %s;
+	`, persistence, stagingIdent, pgx.Identifier{plan.target}.Sanitize(), strings.Join(options, ", "),
+		stagingIdent, quoteLiteral(swapMarker(plan.target))))
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", plan.staging, err)
+	}
+	fmt.Printf("   ✅ Created %s%s\n", persistence, plan.staging)
+
+	// -trigger-mode=safe: the loaded rows go through the triggers, as they
+	// would into the target (see triggers.go).
+	if config.TriggerMode == "fast" {
+		return nil
+	}
+	triggers, err := stagingTriggers(plan)
+	if err != nil {
+		return err
+	}
+	for _, sql := range triggers {
+		if _, err := pool.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("failed to create trigger on %s: %w", plan.staging, err)
+		}
+	}
+	return nil
+}
+
+var (
+	// indexDefHead is "CREATE [UNIQUE] INDEX name ON table " of pg_get_indexdef.
+	indexDefHead = regexp.MustCompile(`^(CREATE (?:UNIQUE )?INDEX )\S+ ON (?:ONLY )?\S+ `)
+	// triggerDefHead ends at the table of pg_get_triggerdef.
+	triggerDefHead = regexp.MustCompile(`^(CREATE (?:CONSTRAINT )?TRIGGER \S+ .*? ON )\S+ `)
+)
+
+// finalizeStaging makes the loaded staging table a copy of the target in
+// everything but its rows.
+func finalizeStaging(ctx context.Context, pool *pgxpool.Pool, plan *swapPlan, metrics *LoadMetrics) error {
+	defer beginPhase("finalize")()
+	finalizeStart := time.Now()
+	defer func() { metrics.FinalizeDuration = time.Since(finalizeStart) }()
+
+	fmt.Printf("\n🔨 PHASE 3: FINALIZING %s LIKE %s\n", plan.staging, plan.target)
+	fmt.Println(strings.Repeat("=", 80))
+	stagingIdent := pgx.Identifier{plan.staging}.Sanitize()
+
+	var constraints []string
+	for _, fk := range plan.foreignKeys {
+		constraints = append(constraints, "ALTER TABLE "+stagingIdent+" ADD CONSTRAINT "+fk)
+	}
+	for _, idx := range plan.indexes {
+		if idx.contype == "x" {
+			constraints = append(constraints, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s",
+				stagingIdent, pgx.Identifier{suffixed(idx.name, "_new")}.Sanitize(), idx.condef))
+		}
+	}
+	if plan.boundCheck != "" {
+		constraints = append(constraints, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)",
+			stagingIdent, pgx.Identifier{suffixed(plan.staging, "_bound")}.Sanitize(), plan.boundCheck))
+	}
+	var triggers []string
+	if config.TriggerMode == "fast" {
+		var err error
+		if triggers, err = stagingTriggers(plan); err != nil {
+			return err
+		}
+	}
+	grants := plan.grants
+	if plan.owner != "" {
+		grants = append(grants, fmt.Sprintf("ALTER TABLE %s OWNER TO %s", stagingIdent, pgx.Identifier{plan.owner}.Sanitize()))
+	}
+	autovacuum := fmt.Sprintf("ALTER TABLE %s RESET (autovacuum_enabled)", stagingIdent)
+	for _, opt := range plan.reloptions {
+		if v, ok := strings.CutPrefix(opt, "autovacuum_enabled="); ok {
+			autovacuum = fmt.Sprintf("ALTER TABLE %s SET (autovacuum_enabled = %s)", stagingIdent, v)
+		}
+	}
+
+	steps := []struct {
+		key  string
+		name string
+		sql  []string
+		run  func(context.Context, *pgxpool.Pool) error // Instead of sql
+		off  bool
+	}{
+		{key: "logged", name: "1. Convert to LOGGED table (enable WAL)", sql: []string{"ALTER TABLE " + stagingIdent + " SET LOGGED"}, off: !config.Unlogged},
+		{key: "indexes", name: "2. Build the target's indexes and keys", run: func(ctx context.Context, pool *pgxpool.Pool) error {
+			return buildStagingIndexes(ctx, pool, plan, metrics)
+		}},
+		{key: "constraints", name: "3. Add foreign keys, exclusion and partition constraints", sql: constraints},
+		{key: "triggers", name: "4. Create triggers (-trigger-mode=fast)", sql: triggers},
+		{key: "grants", name: "5. Copy owner and grants", sql: grants},
+		{key: "analyze", name: "6. Run ANALYZE to update statistics", sql: []string{"ANALYZE " + stagingIdent}},
+		{key: "autovacuum", name: "7. Restore autovacuum", sql: []string{autovacuum}},
+	}
+
+	finalizeCosts = nil
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		if step.off || (step.run == nil && len(step.sql) == 0) {
+			fmt.Println(" ⏭️  (nothing to do)")
+			continue
+		}
+		start, startWAL := time.Now(), getCurrentWAL(ctx, pool)
+		var err error
+		if step.run != nil {
+			err = step.run(ctx, pool)
+		}
+		for _, sql := range step.sql {
+			if _, err = pool.Exec(ctx, sql); err != nil {
+				break
+			}
+		}
+		wal := recordStep(ctx, pool, step.key, step.name, startWAL, start, err)
+		if err != nil {
+			fmt.Printf(" ❌ (%v)\n", err)
+			printFinalizeCost()
+			return err
+		}
+		fmt.Printf(" ✅ (took %v%s)\n", time.Since(start), wal)
+	}
+	printFinalizeCost()
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+// stagingTriggers returns the CREATE TRIGGER statements of the target's
+// triggers for the staging table.
+func stagingTriggers(plan *swapPlan) ([]string, error) {
+	var triggers []string
+	for _, def := range plan.triggers {
+		m := triggerDefHead.FindString(def)
+		if m == "" {
+			return nil, fmt.Errorf("unexpected trigger definition: %s", def)
+		}
+		triggers = append(triggers, triggerDefHead.ReplaceAllString(m, "${1}"+pgx.Identifier{plan.staging}.Sanitize()+" ")+def[len(m):])
+	}
+	return triggers, nil
+}
+
+// buildStagingIndexes builds the target's indexes on the staging table,
+// -index-parallelism at a time, and turns the PRIMARY KEY and UNIQUE ones
+// into constraints. Exclusion constraints build their own index later.
+func buildStagingIndexes(ctx context.Context, pool *pgxpool.Pool, plan *swapPlan, metrics *LoadMetrics) error {
+	var builds []swapIndex
+	for _, idx := range plan.indexes {
+		if idx.contype != "x" {
+			builds = append(builds, idx)
+		}
+	}
+	parallelism := max(1, min(config.IndexParallelism, len(builds), int(pool.Config().MaxConns)-1))
+	fmt.Printf("\n      Building %d indexes, %d at a time (maintenance_work_mem %s each)\n",
+		len(builds), parallelism, config.IndexMem)
+
+	results := make([]indexBuild, len(builds))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, idx := range builds {
+		wg.Add(1)
+		go func(i int, idx swapIndex) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = buildStagingIndex(ctx, pool, plan.staging, idx)
+		}(i, idx)
+	}
+	wg.Wait()
+
+	var failed []string
+	for i, r := range results {
+		if r.err == nil && builds[i].contype != "" {
+			kind := "PRIMARY KEY"
+			if builds[i].contype == "u" {
+				kind = "UNIQUE"
+			}
+			name := pgx.Identifier{r.name}.Sanitize()
+			_, r.err = pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s USING INDEX %s%s",
+				pgx.Identifier{plan.staging}.Sanitize(), name, kind, name, builds[i].deferrable))
+		}
+		if r.err != nil {
+			fmt.Printf("      ❌ %-22s failed after %v: %v\n", r.name, r.duration.Round(time.Millisecond), r.err)
+			failed = append(failed, r.name)
+		} else {
+			fmt.Printf("      ✅ %-22s %10v  %s\n", r.name, r.duration.Round(time.Millisecond), formatBytes(r.size))
+		}
+		logStep("finalize", "index", r.duration, r.err, "index", r.name, "size_bytes", r.size)
+		metrics.mu.Lock()
+		metrics.IndexBuilds = append(metrics.IndexBuilds, IndexMetrics{
+			Name:      r.name,
+			Duration:  r.duration,
+			SizeBytes: r.size,
+			Failed:    r.err != nil,
+		})
+		metrics.mu.Unlock()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("index builds failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// buildStagingIndex builds one index as <name>_new on its own connection.
+func buildStagingIndex(ctx context.Context, pool *pgxpool.Pool, staging string, idx swapIndex) indexBuild {
+	r := indexBuild{name: suffixed(idx.name, "_new")}
+	m := indexDefHead.FindStringSubmatch(idx.def)
+	if m == nil {
+		r.err = fmt.Errorf("unexpected index definition: %s", idx.def)
+		return r
+	}
+	sql := m[1] + pgx.Identifier{r.name}.Sanitize() + " ON " + pgx.Identifier{staging}.Sanitize() + " " + idx.def[len(m[0]):]
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		r.err = err
+		return r
+	}
+	defer conn.Release()
+	if !pooledDDL() {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET maintenance_work_mem = '%s'", config.IndexMem)); err != nil {
+			r.err = err
+			return r
+		}
+		defer conn.Exec(context.Background(), "RESET maintenance_work_mem")
+	}
+
+	start := time.Now()
+	_, r.err = conn.Exec(ctx, sql)
+	r.duration = time.Since(start)
+	if r.err == nil {
+		conn.QueryRow(ctx, "SELECT pg_relation_size($1::regclass)", pgx.Identifier{r.name}.Sanitize()).Scan(&r.size)
+	}
+	return r
+}
+
+// swapTables swaps the staging table in, retrying when the locks aren't
+// granted within -swap-lock-timeout.
+func swapTables(ctx context.Context, pool *pgxpool.Pool, plan *swapPlan) error {
+	defer beginPhase("swap")()
+
+	fmt.Printf("\n🔀 SWAPPING %s IN FOR %s (lock_timeout %v)\n", plan.staging, plan.target, config.SwapLockTimeout)
+	fmt.Println(strings.Repeat("=", 80))
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := swapOnce(ctx, pool, plan)
+		logStep("swap", "swap", time.Since(start), err, "attempt", attempt)
+		var pgErr *pgconn.PgError
+		if err != nil && errors.As(err, &pgErr) && pgErr.Code == "55P03" && attempt < swapAttempts {
+			wait := time.Duration(attempt) * time.Second
+			fmt.Printf("   ⏳ Attempt %d: lock not granted within %v, retrying in %v\n", attempt, config.SwapLockTimeout, wait)
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("swap failed, %s is unchanged: %w", plan.target, err)
+		}
+		fmt.Printf("   ✅ Swapped in %v (attempt %d)\n", time.Since(start).Round(time.Millisecond), attempt)
+		fmt.Println(strings.Repeat("=", 80))
+		return nil
+	}
+}
+
+// swapOnce runs the swap transaction.
+func swapOnce(ctx context.Context, pool *pgxpool.Pool, plan *swapPlan) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	target := pgx.Identifier{plan.target}.Sanitize()
+	locked := target
+	if plan.parent != "" {
+		locked = "ONLY " + plan.parent + ", " + target
+	}
+	stmts := []string{
+		fmt.Sprintf("SET LOCAL lock_timeout = %d", config.SwapLockTimeout.Milliseconds()),
+		fmt.Sprintf("LOCK TABLE %s IN ACCESS EXCLUSIVE MODE", locked),
+	}
+	if plan.parent != "" {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", plan.parent, target))
+	}
+	stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", target, pgx.Identifier{plan.old}.Sanitize()))
+	for _, idx := range plan.indexes {
+		stmts = append(stmts, fmt.Sprintf("ALTER INDEX %s RENAME TO %s",
+			pgx.Identifier{idx.name}.Sanitize(), pgx.Identifier{suffixed(idx.name, "_old")}.Sanitize()))
+	}
+	stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", pgx.Identifier{plan.staging}.Sanitize(), target))
+	for _, idx := range plan.indexes {
+		stmts = append(stmts, fmt.Sprintf("ALTER INDEX %s RENAME TO %s",
+			pgx.Identifier{suffixed(idx.name, "_new")}.Sanitize(), pgx.Identifier{idx.name}.Sanitize()))
+	}
+	for _, s := range plan.serials {
+		stmts = append(stmts, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s", s[1], target, pgx.Identifier{s[0]}.Sanitize()))
+	}
+	if plan.parent != "" {
+		stmts = append(stmts,
+			fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s %s", plan.parent, target, plan.bound),
+			fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", target, pgx.Identifier{suffixed(plan.staging, "_bound")}.Sanitize()))
+	}
+	comment := "NULL"
+	if plan.comment != nil {
+		comment = quoteLiteral(*plan.comment)
+	}
+	stmts = append(stmts, fmt.Sprintf("COMMENT ON TABLE %s IS %s", target, comment))
+	for _, sql := range stmts {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("%s: %w", sql, err)
+		}
+	}
+
+	// Rows may carry explicit ids, and the live table kept drawing from the
+	// serial sequences during the load: move every sequence past MAX.
+	sequences, err := tx.Query(ctx, `
+		SELECT a.attname::text, pg_get_serial_sequence($1, a.attname)
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		  AND pg_get_serial_sequence($1, a.attname) IS NOT NULL
+	`, plan.target)
+	if err != nil {
+		return err
+	}
+	var seqs [][2]string
+	for sequences.Next() {
+		var s [2]string
+		if err := sequences.Scan(&s[0], &s[1]); err != nil {
+			sequences.Close()
+			return err
+		}
+		seqs = append(seqs, s)
+	}
+	sequences.Close()
+	for _, s := range seqs {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`
+			SELECT setval($1::regclass, m) FROM (SELECT max(%s) AS m FROM %s) s
+			WHERE m > coalesce(pg_sequence_last_value($1::regclass), 0)
+		`, pgx.Identifier{s[0]}.Sanitize(), target), s[1])
+		if err != nil {
+			return fmt.Errorf("moving %s past MAX(%s): %w", s[1], s[0], err)
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,393 @@
+package bulkload
+
+// ============================================================================
+// LOAD THROTTLING (-max-replica-lag, -max-wal-rate, -max-rows-per-sec)
+// ============================================================================
+//
+// A full-speed COPY can generate WAL faster than streaming replicas replay
+// it. With -max-replica-lag=30s a monitor polls replay lag every couple of
+// seconds and COPY workers consult it before every batch:
+//   - lag above half the limit: each batch is delayed, up to 1s at the limit
+//   - lag at or above the limit: workers pause until lag drops below 80% of
+//     the limit
+//
+// Lag is read from pg_stat_replication on the primary (worst replica), or,
+// with -replica-dsn, from the replica itself (now() - last replayed commit,
+// 0 when fully caught up).
+//
+// With -max-wal-rate=64MB a second monitor samples pg_current_wal_lsn every
+// second and pauses workers while WAL written since the load started is
+// ahead of rate*elapsed (plus a 2s burst), so archive_command and backup
+// streaming keep up. The LSN is cluster-wide, so other writers count
+// against the budget too. It only runs for LOGGED targets; UNLOGGED loads
+// barely write WAL.
+//
+// -max-rows-per-sec caps total throughput for backfills into live systems:
+// batches are spaced so the load as a whole never runs ahead of the rate.
+//
+// Operators can pause and resume the load the same way (see pause.go).
+//
+// Throttling applies between batches (see beginBatch), so generated loads COPY in BatchSize
+// batches while it is enabled.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// loadThrottle is the gate COPY workers pass before each batch. Monitors
+// set a pause or a per-batch delay under their own name.
+type loadThrottle struct {
+	mu     sync.Mutex
+	pauses map[string]string        // Monitor -> reason, while paused
+	delays map[string]time.Duration // Monitor -> delay per batch
+
+	nextRows time.Time // When the next -max-rows-per-sec reservation is due
+
+	waited atomic.Int64 // Total nanoseconds workers spent throttled
+	paced  atomic.Int64 // ... and spent waiting on -max-rows-per-sec
+}
+
+var throttle = &loadThrottle{
+	pauses: make(map[string]string),
+	delays: make(map[string]time.Duration),
+}
+
+// throttling reports whether any throttle monitor is configured.
+func throttling() bool {
+	return config.MaxReplicaLag > 0 || config.MaxWALRate > 0 || config.MaxRowsPerSec > 0 || pauseControl()
+}
+
+// beginBatch is called by COPY workers before each batch: it applies the
+// throttles and the row rate limit and, in adaptive mode, waits for a worker
+// slot. The returned func must be called with the rows copied once the
+// batch is done.
+func beginBatch(ctx context.Context) (func(rows int64), error) {
+	if err := throttle.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	// Reserve a full batch; short batches give the difference back.
+	reserved := int64(config.BatchSize)
+	if err := throttle.reserveRows(ctx, reserved); err != nil {
+		return nil, err
+	}
+	finish := func(rows int64) { throttle.refundRows(reserved - rows) }
+
+	if workers != nil {
+		if err := workers.acquire(ctx); err != nil {
+			finish(0)
+			return nil, err
+		}
+		return func(rows int64) {
+			finish(rows)
+			workers.release(rows)
+		}, nil
+	}
+	return finish, nil
+}
+
+// reserveRows books n rows against -max-rows-per-sec and sleeps until the
+// reservation is due.
+func (t *loadThrottle) reserveRows(ctx context.Context, n int64) error {
+	if config.MaxRowsPerSec <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if t.nextRows.Before(now) {
+		t.nextRows = now
+	}
+	due := t.nextRows
+	t.nextRows = t.nextRows.Add(time.Duration(float64(n) / float64(config.MaxRowsPerSec) * float64(time.Second)))
+	t.mu.Unlock()
+
+	delay := time.Until(due)
+	if delay <= 0 {
+		return nil
+	}
+	t.paced.Add(int64(delay))
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refundRows returns the unused part of a reservation.
+func (t *loadThrottle) refundRows(n int64) {
+	if config.MaxRowsPerSec <= 0 || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextRows = t.nextRows.Add(-time.Duration(float64(n) / float64(config.MaxRowsPerSec) * float64(time.Second)))
+}
+
+// set records a monitor's verdict; an empty reason clears its pause.
+func (t *loadThrottle) set(monitor, pauseReason string, delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if pauseReason != "" {
+		t.pauses[monitor] = pauseReason
+	} else {
+		delete(t.pauses, monitor)
+	}
+	t.delays[monitor] = delay
+}
+
+// wait blocks while any monitor has paused the load, then applies the
+// largest per-batch delay.
+func (t *loadThrottle) wait(ctx context.Context) error {
+	if !throttling() {
+		return nil
+	}
+	start := time.Now()
+	throttled, idle := false, false
+	defer func() {
+		if throttled {
+			t.waited.Add(int64(time.Since(start)))
+		}
+		if idle {
+			idleWorkers.Add(-1)
+		}
+	}()
+
+	for {
+		t.mu.Lock()
+		paused := len(t.pauses) > 0
+		_, byOperator := t.pauses[operatorMonitor]
+		var delay time.Duration
+		for _, d := range t.delays {
+			delay = max(delay, d)
+		}
+		t.mu.Unlock()
+
+		if !paused {
+			if delay == 0 {
+				return nil
+			}
+			throttled = true
+			select {
+			case <-time.After(delay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		throttled = true
+		if byOperator && !idle {
+			idle = true
+			idleWorkers.Add(1)
+		}
+		select {
+		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// startThrottles launches the configured monitors; the returned func stops
+// them.
+func startThrottles(ctx context.Context, pool *pgxpool.Pool) (func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
+	if pauseControl() {
+		if err := startPauseControl(ctx, &wg); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	if config.MaxReplicaLag > 0 {
+		lag, err := newLagReader(ctx, pool)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		fmt.Printf("🐢 Throttling on replica lag above %v (%s)\n", config.MaxReplicaLag, lag.source)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer lag.close()
+			monitorReplicaLag(ctx, lag)
+		}()
+	}
+
+	if config.MaxWALRate > 0 {
+		var persistence string
+		err := pool.QueryRow(ctx, `SELECT relpersistence::text FROM pg_class WHERE oid = $1::regclass`,
+			config.TableName).Scan(&persistence)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if persistence == "u" {
+			fmt.Printf("ℹ️  %s is UNLOGGED; -max-wal-rate not applied\n", config.TableName)
+		} else {
+			fmt.Printf("🐢 Throttling WAL generation to %s/sec\n", formatBytes(config.MaxWALRate))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				monitorWALRate(ctx, pool)
+			}()
+		}
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}, nil
+}
+
+type lagReader struct {
+	source string
+	query  string
+	pool   *pgxpool.Pool
+	conn   *pgx.Conn // Set with -replica-dsn
+}
+
+func newLagReader(ctx context.Context, pool *pgxpool.Pool) (*lagReader, error) {
+	if config.ReplicaDSN == "" {
+		return &lagReader{
+			source: "pg_stat_replication",
+			query:  `SELECT coalesce(max(extract(epoch FROM replay_lag)), 0)::float8 FROM pg_stat_replication`,
+			pool:   pool,
+		}, nil
+	}
+
+	conn, err := pgx.Connect(ctx, config.ReplicaDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to replica: %w", err)
+	}
+	return &lagReader{
+		source: "replica replay lag",
+		query: `SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		                    ELSE coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+		               END::float8`,
+		conn: conn,
+	}, nil
+}
+
+func (l *lagReader) read(ctx context.Context) (time.Duration, error) {
+	var seconds float64
+	var err error
+	if l.conn != nil {
+		err = l.conn.QueryRow(ctx, l.query).Scan(&seconds)
+	} else {
+		err = l.pool.QueryRow(ctx, l.query).Scan(&seconds)
+	}
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+func (l *lagReader) close() {
+	if l.conn != nil {
+		l.conn.Close(context.Background())
+	}
+}
+
+func monitorReplicaLag(ctx context.Context, lag *lagReader) {
+	limit := config.MaxReplicaLag
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	paused := false
+	for {
+		select {
+		case <-ctx.Done():
+			throttle.set("replica-lag", "", 0)
+			return
+		case <-ticker.C:
+		}
+
+		current, err := lag.read(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("      ⚠️  Replica lag check failed: %v\n", err)
+			}
+			continue
+		}
+
+		switch {
+		case current >= limit || (paused && current >= limit*8/10):
+			if !paused {
+				fmt.Printf("      ⏸️  Replica lag %v ≥ %v: pausing COPY workers\n", current.Round(time.Millisecond), limit)
+			}
+			paused = true
+			throttle.set("replica-lag", fmt.Sprintf("replica lag %v", current), 0)
+		case current > limit/2:
+			if paused {
+				fmt.Printf("      ▶️  Replica lag %v: resuming (slowed)\n", current.Round(time.Millisecond))
+			}
+			paused = false
+			// 0 at half the limit, 1s per batch at the limit
+			delay := time.Duration(float64(time.Second) * float64(current-limit/2) / float64(limit/2))
+			throttle.set("replica-lag", "", delay)
+		default:
+			if paused {
+				fmt.Printf("      ▶️  Replica lag %v: resuming\n", current.Round(time.Millisecond))
+			}
+			paused = false
+			throttle.set("replica-lag", "", 0)
+		}
+	}
+}
+
+func monitorWALRate(ctx context.Context, pool *pgxpool.Pool) {
+	const query = `SELECT (pg_current_wal_lsn() - '0/0'::pg_lsn)::float8`
+	var startLSN float64
+	if err := pool.QueryRow(ctx, query).Scan(&startLSN); err != nil {
+		fmt.Printf("      ⚠️  WAL position check failed, not throttling WAL: %v\n", err)
+		return
+	}
+	start := time.Now()
+	budget := float64(config.MaxWALRate)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	paused := false
+	for {
+		select {
+		case <-ctx.Done():
+			throttle.set("wal-rate", "", 0)
+			return
+		case <-ticker.C:
+		}
+
+		var lsn float64
+		if err := pool.QueryRow(ctx, query).Scan(&lsn); err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("      ⚠️  WAL position check failed: %v\n", err)
+			}
+			continue
+		}
+
+		written := lsn - startLSN
+		elapsed := time.Since(start).Seconds()
+		ahead := written - budget*(elapsed+2)
+		if ahead > 0 {
+			if !paused {
+				fmt.Printf("      ⏸️  WAL at %s/sec over %s/sec budget: pausing COPY workers\n",
+					formatBytes(int64(written/elapsed)), formatBytes(config.MaxWALRate))
+			}
+			paused = true
+			throttle.set("wal-rate", fmt.Sprintf("%s WAL ahead of budget", formatBytes(int64(ahead))), 0)
+		} else {
+			if paused {
+				fmt.Printf("      ▶️  WAL back within budget: resuming\n")
+			}
+			paused = false
+			throttle.set("wal-rate", "", 0)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package bulkload
+
+// ============================================================================
+// TRIGGERS AND GENERATED COLUMNS (-trigger-mode)
+// ============================================================================
+//
+// Production tables often carry INSERT triggers (audit rows, denormalized
+// balances, updated_at) and GENERATED columns, which the synthetic schema
+// doesn't. Both are detected at the start of the load:
+//   - generated columns are left out of the COPY column list, whatever the
+//     source offers for them (a CSV header naming amount_usd, say): the
+//     server computes them and rejects values for them
+//   - -trigger-mode=safe (default) leaves triggers enabled and lists the
+//     ones that fire for every loaded row; they cost throughput but keep
+//     the table consistent
+//   - -trigger-mode=fast disables the target's INSERT triggers for the
+//     load, names each one, enables them again afterwards (also when the
+//     load fails) and then runs -reconcile-sql, the set-based equivalent
+//     of what the triggers would have done, e.g.
+//       INSERT INTO account_balances SELECT account_id, sum(amount) FROM financial_transactions GROUP BY 1
+//         ON CONFLICT (account_id) DO UPDATE SET balance = EXCLUDED.balance
+// Only INSERT triggers are disabled, so live UPDATEs and DELETEs on the
+// table keep firing theirs. If the process is killed mid-load they stay
+// disabled: the statement that re-enables them is printed up front.
+//
+//   go run ./cmd/prod_loader -mode=load -trigger-mode=fast -reconcile-sql="CALL rebuild_balances()"
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pg_trigger.tgtype bits.
+const (
+	triggerRow     = 1 << 0
+	triggerBefore  = 1 << 1
+	triggerInsert  = 1 << 2
+	triggerDelete  = 1 << 3
+	triggerUpdate  = 1 << 4
+	triggerInstead = 1 << 6
+)
+
+// tableTrigger is a user trigger on the target.
+type tableTrigger struct {
+	name    string
+	tgtype  int16
+	enabled bool
+}
+
+// describe renders the trigger as in CREATE TRIGGER, e.g. "BEFORE INSERT
+// OR UPDATE, FOR EACH ROW".
+func (t tableTrigger) describe() string {
+	timing := "AFTER"
+	switch {
+	case t.tgtype&triggerInstead != 0:
+		timing = "INSTEAD OF"
+	case t.tgtype&triggerBefore != 0:
+		timing = "BEFORE"
+	}
+	var events []string
+	for _, e := range []struct {
+		bit  int16
+		name string
+	}{{triggerInsert, "INSERT"}, {triggerUpdate, "UPDATE"}, {triggerDelete, "DELETE"}} {
+		if t.tgtype&e.bit != 0 {
+			events = append(events, e.name)
+		}
+	}
+	level := "FOR EACH STATEMENT"
+	if t.tgtype&triggerRow != 0 {
+		level = "FOR EACH ROW"
+	}
+	return fmt.Sprintf("%s %s, %s", timing, strings.Join(events, " OR "), level)
+}
+
+// disabledTriggers are the triggers -trigger-mode=fast turned off, for the
+// load report.
+var disabledTriggers []string
+
+// reconcileResult is what -reconcile-sql did, for the load report.
+var reconcileResult string
+
+// generatedColumnNames lists the target's GENERATED columns.
+func generatedColumnNames(ctx context.Context, pool *pgxpool.Pool, table string) ([]string, error) {
+	if cockroach() {
+		return nil, nil
+	}
+	return queryStrings(ctx, pool, `
+		SELECT attname::text FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND attgenerated <> ''
+		ORDER BY attnum
+	`, table)
+}
+
+// withoutPositions removes the values at skip from row, in place.
+func withoutPositions(row []interface{}, skip []int) []interface{} {
+	out := row[:0]
+	for i, v := range row {
+		if !slices.Contains(skip, i) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// generatedSkip holds the positions in generatedColumns of columns the
+// target generates itself; transactionGenerator.Values leaves them out.
+var generatedSkip []int
+
+// skipGeneratedColumns returns the generated row columns the target
+// accepts and makes transactionGenerator skip the others.
+func skipGeneratedColumns(generated []string) []string {
+	generatedSkip = nil
+	var columns []string
+	for i, col := range generatedColumns {
+		if slices.Contains(generated, col) {
+			generatedSkip = append(generatedSkip, i)
+		} else {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// withoutGeneratedSource drops generated columns from another source.
+type withoutGeneratedSource struct {
+	Source
+	columns []string
+	skip    []int
+}
+
+func (s *withoutGeneratedSource) Columns() []string { return s.columns }
+
+func (s *withoutGeneratedSource) Next() ([]interface{}, error) {
+	row, err := s.Source.Next()
+	if err != nil {
+		return nil, err
+	}
+	return withoutPositions(row, s.skip), nil
+}
+
+// wrapGenerated returns src without the target's generated columns, or src
+// itself when it has none of them.
+func wrapGenerated(ctx context.Context, pool *pgxpool.Pool, src Source) (Source, error) {
+	generated, err := generatedColumnNames(ctx, pool, config.TableName)
+	if err != nil {
+		return nil, err
+	}
+	w := &withoutGeneratedSource{Source: src}
+	for i, col := range src.Columns() {
+		if slices.Contains(generated, col) {
+			w.skip = append(w.skip, i)
+		} else {
+			w.columns = append(w.columns, col)
+		}
+	}
+	if len(w.skip) == 0 {
+		return src, nil
+	}
+	return w, nil
+}
+
+// applyTriggerMode reports the target's triggers and generated columns and,
+// with -trigger-mode=fast, disables its INSERT triggers. The returned
+// function enables them again and, if the load succeeded, runs
+// -reconcile-sql.
+func applyTriggerMode(ctx context.Context, pool *pgxpool.Pool) (func(loadErr error) error, error) {
+	disabledTriggers, reconcileResult = nil, ""
+	done := func(error) error { return nil }
+	if cockroach() {
+		return done, nil
+	}
+
+	generated, err := generatedColumnNames(ctx, pool, config.TableName)
+	if err != nil {
+		return nil, err
+	}
+	if len(generated) > 0 {
+		fmt.Printf("Generated columns (computed by the server, not loaded): %s\n", strings.Join(generated, ", "))
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT tgname::text, tgtype, tgenabled <> 'D'
+		FROM pg_trigger
+		WHERE tgrelid = $1::regclass AND NOT tgisinternal
+		ORDER BY tgname
+	`, config.TableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read triggers of %s: %w", config.TableName, err)
+	}
+	triggers, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (tableTrigger, error) {
+		var t tableTrigger
+		err := row.Scan(&t.name, &t.tgtype, &t.enabled)
+		return t, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var firing []tableTrigger
+	for _, t := range triggers {
+		if t.enabled && t.tgtype&triggerInsert != 0 {
+			firing = append(firing, t)
+		}
+	}
+	if len(firing) == 0 {
+		if config.TriggerMode == "fast" && config.ReconcileSQL != "" {
+			return reconcile(ctx, pool), nil
+		}
+		return done, nil
+	}
+
+	if config.TriggerMode != "fast" {
+		fmt.Printf("Triggers firing during the load (-trigger-mode=safe):\n")
+		for _, t := range firing {
+			fmt.Printf("   ⚡ %-30s %s\n", t.name, t.describe())
+		}
+		return done, nil
+	}
+
+	table := pgx.Identifier{config.TableName}.Sanitize()
+	var enable []string
+	fmt.Printf("Disabling INSERT triggers for the load (-trigger-mode=fast):\n")
+	for _, t := range firing {
+		name := pgx.Identifier{t.name}.Sanitize()
+		if _, err := pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DISABLE TRIGGER %s", table, name)); err != nil {
+			for _, sql := range enable {
+				pool.Exec(context.Background(), sql)
+			}
+			disabledTriggers = nil
+			return nil, fmt.Errorf("failed to disable trigger %s: %w", t.name, err)
+		}
+		enable = append(enable, fmt.Sprintf("ALTER TABLE %s ENABLE TRIGGER %s", table, name))
+		disabledTriggers = append(disabledTriggers, t.name)
+		fmt.Printf("   🔕 %-30s %s\n", t.name, t.describe())
+	}
+	fmt.Printf("   If the loader dies, re-enable them with: %s;\n", strings.Join(enable, "; "))
+	if config.ReconcileSQL == "" {
+		fmt.Println("   ⚠️  No -reconcile-sql: what these triggers do is skipped for the loaded rows")
+	}
+	logger.Warn("triggers disabled", "phase", currentPhase(), "triggers", disabledTriggers)
+
+	return func(loadErr error) error {
+		var failed []string
+		for _, sql := range enable {
+			if _, err := pool.Exec(context.Background(), sql); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", sql, err))
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to re-enable triggers: %s", strings.Join(failed, "; "))
+		}
+		fmt.Printf("   🔔 Re-enabled %d trigger(s): %s\n", len(enable), strings.Join(disabledTriggers, ", "))
+		if loadErr != nil {
+			if config.ReconcileSQL != "" {
+				fmt.Println("   ⏭️  -reconcile-sql skipped: the load failed")
+			}
+			return nil
+		}
+		return reconcile(ctx, pool)(nil)
+	}, nil
+}
+
+// reconcile returns the function running -reconcile-sql after the load.
+func reconcile(ctx context.Context, pool *pgxpool.Pool) func(error) error {
+	return func(loadErr error) error {
+		if loadErr != nil || config.ReconcileSQL == "" {
+			return nil
+		}
+		fmt.Printf("   🔁 Reconciling: %s\n", config.ReconcileSQL)
+		start := time.Now()
+		tag, err := pool.Exec(ctx, config.ReconcileSQL)
+		logStep("load", "reconcile", time.Since(start), err, "rows", tag.RowsAffected())
+		if err != nil {
+			return fmt.Errorf("-reconcile-sql failed: %w", err)
+		}
+		reconcileResult = fmt.Sprintf("%s in %v", tag.String(), time.Since(start).Round(time.Millisecond))
+		fmt.Printf("   ✅ %s\n", reconcileResult)
+		return nil
+	}
+}
+
+// printTriggerReport adds -trigger-mode=fast to the load report.
+func printTriggerReport() {
+	if len(disabledTriggers) > 0 {
+		fmt.Printf("Triggers disabled:    %s\n", strings.Join(disabledTriggers, ", "))
+	}
+	if reconcileResult != "" {
+		fmt.Printf("Reconciled:           %s\n", reconcileResult)
+	}
+}
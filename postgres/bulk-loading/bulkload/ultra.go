@@ -0,0 +1,600 @@
+package bulkload
+
+// ============================================================================
+// ULTRA-FAST MODE (cmd/prod_loader_ultra)
+// ============================================================================
+//
+// Drops every constraint and index, loads UNLOGGED with one COPY per
+// goroutine and no error handling, then restores the constraints. It shares
+// the configuration, connection pool, generated columns, index list and
+// metrics with the prod_loader pipeline; only -dsn, -dedupe and the
+// -payload-* flags apply.
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UltraMain is the prod_loader_ultra command: it parses its flags and runs
+// -mode, exiting the process on errors.
+func UltraMain() {
+	config.Goroutines = 16 // No per-row safety to pay for, so more COPY streams
+	mode := flag.String("mode", "all", "Mode: ultra-fast, restore-constraints, all")
+	registerDSNFlags(&config.DBConnString)
+	flag.BoolVar(&config.Dedupe, "dedupe", false, "Move duplicate transaction_id/external_txn_id rows to the errors table before restoring constraints")
+	registerPayloadFlags()
+	flag.StringVar(&config.LogFormat, "log-format", config.LogFormat, "Output: text (console), json (structured events on stdout, console on stderr)")
+	flag.Parse()
+	if err := initLogging(); err != nil {
+		log.Fatal(err)
+	}
+	if err := initPayload(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	dsn, err := resolveDSN(ctx, config.DBConnString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.DBConnString = dsn
+
+	pool, err := initConnectionPool(ctx, config.DBConnString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	fmt.Println("✅ Connected to PostgreSQL")
+	fmt.Printf("🚀 ULTRA-OPTIMIZED MODE: %d rows, %d goroutines\n", config.TotalRows, config.Goroutines)
+
+	switch *mode {
+	case "ultra-fast":
+		if err := prepareUltraFast(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+		metrics := NewLoadMetrics()
+		if err := executeUltraFastLoad(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+		printUltraReport(metrics)
+		if payload != nil {
+			printToastReport(ctx, pool, config.TotalRows)
+		}
+
+	case "restore-constraints":
+		metrics := &LoadMetrics{}
+		if err := restoreConstraints(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+		printRestoreReport(metrics)
+
+	case "all":
+		if err := prepareUltraFast(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+		metrics := NewLoadMetrics()
+		if err := executeUltraFastLoad(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+		printUltraReport(metrics)
+		if payload != nil {
+			printToastReport(ctx, pool, config.TotalRows)
+		}
+		if err := restoreConstraints(ctx, pool, metrics); err != nil {
+			log.Fatal(err)
+		}
+		printRestoreReport(metrics)
+
+	default:
+		log.Fatal("Invalid mode: use ultra-fast, restore-constraints, or all")
+	}
+
+	fmt.Println("\n✅ Completed successfully!")
+}
+
+// ============================================================================
+// ULTRA-FAST PREPARATION: Remove ALL overhead
+// ============================================================================
+func prepareUltraFast(ctx context.Context, pool *pgxpool.Pool) error {
+	defer beginPhase("prepare")()
+	fmt.Println("\n⚡ PHASE 1: ULTRA-FAST PREPARATION (Removing ALL overhead)")
+	fmt.Println(strings.Repeat("=", 80))
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	steps := []struct {
+		name string
+		sql  string
+	}{
+		{
+			name: "1. Truncate table",
+			sql:  fmt.Sprintf("TRUNCATE TABLE %s CASCADE", config.TableName),
+		},
+		{
+			name: "2. Drop PRIMARY KEY constraint",
+			sql:  fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s_pkey CASCADE", config.TableName, config.TableName),
+		},
+		{
+			name: "3. Drop UNIQUE constraint on external_txn_id",
+			sql:  fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s_external_txn_id_key CASCADE", config.TableName, config.TableName),
+		},
+		{
+			name: "4. Drop ALL indexes",
+			sql: fmt.Sprintf(`
+				DO $$ 
+				DECLARE idx RECORD;
+				BEGIN
+					FOR idx IN SELECT indexname FROM pg_indexes WHERE tablename = '%s'
+					LOOP
+						EXECUTE 'DROP INDEX IF EXISTS ' || idx.indexname || ' CASCADE';
+					END LOOP;
+				END $$;
+			`, config.TableName),
+		},
+		{
+			name: "5. Convert to UNLOGGED (no WAL)",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET UNLOGGED", config.TableName),
+		},
+		{
+			name: "6. Disable autovacuum",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET (autovacuum_enabled = false)", config.TableName),
+		},
+		{
+			name: "7. Disable all triggers",
+			sql:  fmt.Sprintf("ALTER TABLE %s DISABLE TRIGGER ALL", config.TableName),
+		},
+		{
+			name: "8. Session optimizations",
+			sql:  "SET synchronous_commit = OFF; SET maintenance_work_mem = '2GB'; SET work_mem = '512MB';",
+		},
+	}
+
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		start := time.Now()
+		_, err := conn.Exec(ctx, step.sql)
+		logStep("prepare", step.name, time.Since(start), err)
+		if err != nil {
+			fmt.Printf(" ⚠️  (%v)\n", err)
+		} else {
+			fmt.Println(" ✅")
+		}
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+// ============================================================================
+// ULTRA-FAST LOAD: Pure speed, no safety
+// ============================================================================
+func executeUltraFastLoad(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	defer beginPhase("load")()
+	fmt.Println("\n🚀 PHASE 2: ULTRA-FAST LOAD (Pure speed, no constraints)")
+	fmt.Println(strings.Repeat("=", 80))
+
+	metrics.StartTime = time.Now()
+	metrics.TotalRows = config.TotalRows
+	metrics.PreLoadTableSize = getTableSize(ctx, pool, config.TableName)
+	startWAL := getCurrentWAL(ctx, pool)
+
+	rowsPerGoroutine := config.TotalRows / int64(config.Goroutines)
+	var wg sync.WaitGroup
+
+	fmt.Printf("Starting %d goroutines, %d rows each...\n", config.Goroutines, rowsPerGoroutine)
+
+	for g := 0; g < config.Goroutines; g++ {
+		wg.Add(1)
+		go func(gid int) {
+			defer wg.Done()
+			loadWorker(ctx, pool, gid, rowsPerGoroutine, metrics)
+		}(g)
+	}
+
+	wg.Wait()
+
+	metrics.Finalize()
+	metrics.PostLoadTableSize = getTableSize(ctx, pool, config.TableName)
+	metrics.WALGenerated = getWALDiff(ctx, pool, startWAL, getCurrentWAL(ctx, pool))
+	metrics.WALBytes = walSince(ctx, pool, startWAL)
+
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+func loadWorker(ctx context.Context, pool *pgxpool.Pool, gid int, rowCount int64, metrics *LoadMetrics) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		log.Printf("Goroutine %d: failed to acquire conn: %v", gid, err)
+		return
+	}
+	defer conn.Release()
+
+	start := time.Now()
+
+	// Pre-generate UUIDs in batches for better performance
+	copyCount, err := conn.Conn().CopyFrom(
+		ctx,
+		pgx.Identifier{config.TableName},
+		generatedColumns,
+		&fastGenerator{totalRows: rowCount, gid: gid},
+	)
+
+	duration := time.Since(start)
+	if err != nil {
+		log.Printf("❌ Goroutine %d: failed after %v: %v", gid, duration, err)
+	} else {
+		metrics.RecordSuccess(gid, copyCount)
+		logWorker(gid, copyCount, duration)
+		fmt.Printf("   ✅ Goroutine %d: %d rows in %v (%.0f rows/sec)\n",
+			gid, copyCount, duration, float64(copyCount)/duration.Seconds())
+	}
+}
+
+// ============================================================================
+// OPTIMIZED DATA GENERATOR: Minimize allocations
+// ============================================================================
+type fastGenerator struct {
+	totalRows  int64
+	currentRow int64
+	gid        int
+	// Reusable buffers to reduce allocations
+	metadataCache []byte
+	tagsCache     []string
+	rng           *rand.Rand // -payload-size draws, per goroutine
+}
+
+func (g *fastGenerator) Next() bool {
+	g.currentRow++
+	if g.currentRow%25000 == 0 {
+		fmt.Printf("      💾 Goroutine %d: %.0f%% (%d/%d rows)\n",
+			g.gid, float64(g.currentRow)/float64(g.totalRows)*100, g.currentRow, g.totalRows)
+	}
+	return g.currentRow <= g.totalRows
+}
+
+func (g *fastGenerator) Values() ([]interface{}, error) {
+	// Reuse metadata and tags to reduce allocations
+	if g.metadataCache == nil {
+		metadata := map[string]interface{}{
+			"ip_address":  "192.168.1.1",
+			"user_agent":  "Mozilla/5.0",
+			"device_type": "desktop",
+		}
+		g.metadataCache, _ = json.Marshal(metadata)
+		g.tagsCache = []string{"batch_load", "optimized"}
+	}
+	metadataJSON := g.metadataCache
+	if payload != nil {
+		// Sizes vary per row, so the cached blob won't do
+		if g.rng == nil {
+			g.rng = rand.New(rand.NewSource(rand.Int63()))
+		}
+		metadata := map[string]interface{}{
+			"ip_address":  "192.168.1.1",
+			"user_agent":  "Mozilla/5.0",
+			"device_type": "desktop",
+		}
+		payload.pad(metadata, g.rng)
+		metadataJSON, _ = json.Marshal(metadata)
+	}
+
+	now := time.Now()
+	txnDate := now.AddDate(0, 0, -rand.Intn(90))
+	amount := float64(rand.Intn(100000)) + rand.Float64()*100
+
+	return []interface{}{
+		uuid.New(),
+		uuid.New().String(),
+		txnDate,
+		txnDate,
+		txnDate.AddDate(0, 0, 2),
+		amount,
+		"USD",
+		1.0,
+		amount,
+		amount * 0.029,
+		amount * 0.08,
+		"purchase",
+		"completed",
+		"credit_card",
+		"5411",
+		rand.Int63n(1000000),
+		rand.Int63n(100000),
+		rand.Int63n(50000),
+		"US",
+		"North America",
+		"New York",
+		float64(rand.Intn(100)),
+		false,
+		"pass",
+		string(metadataJSON),
+		g.tagsCache,
+		fmt.Sprintf("loader_%d", g.gid),
+		100,
+	}, nil
+}
+
+func (g *fastGenerator) Err() error {
+	return nil
+}
+
+// ============================================================================
+// RESTORE CONSTRAINTS: Add back safety after load
+// ============================================================================
+func restoreConstraints(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	defer beginPhase("finalize")()
+	fmt.Println("\n🔨 PHASE 3: RESTORING CONSTRAINTS & INDEXES")
+	fmt.Println(strings.Repeat("=", 80))
+	restoreStart := time.Now()
+	defer func() { metrics.FinalizeDuration = time.Since(restoreStart) }()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	// Check before SET LOGGED: a failed ADD PRIMARY KEY would waste the
+	// rewrite, and deleting from an UNLOGGED table writes no WAL.
+	if err := resolveDuplicates(ctx, pool); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		name  string
+		sql   string
+		index string // The index the step builds, for the report
+	}{
+		{
+			name: "1. Convert back to LOGGED",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET LOGGED", config.TableName),
+		},
+		{
+			name:  "2. Add PRIMARY KEY (this will take time...)",
+			sql:   fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (transaction_id)", config.TableName),
+			index: config.TableName + "_pkey",
+		},
+		{
+			name:  "3. Add UNIQUE constraint on external_txn_id",
+			sql:   fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s_external_txn_id_key UNIQUE (external_txn_id)", config.TableName, config.TableName),
+			index: config.TableName + "_external_txn_id_key",
+		},
+		{
+			name: "4. Rebuild indexes (this will take several minutes...)",
+			sql:  "", // Handled separately below
+		},
+		{
+			name: "5. Re-enable triggers",
+			sql:  fmt.Sprintf("ALTER TABLE %s ENABLE TRIGGER ALL", config.TableName),
+		},
+		{
+			name: "6. Re-enable autovacuum",
+			sql:  fmt.Sprintf("ALTER TABLE %s SET (autovacuum_enabled = true)", config.TableName),
+		},
+		{
+			name: "7. ANALYZE table",
+			sql:  fmt.Sprintf("ANALYZE %s", config.TableName),
+		},
+	}
+
+	for _, step := range steps {
+		fmt.Printf("   %s...", step.name)
+		start := time.Now()
+
+		if step.sql != "" {
+			_, err := conn.Exec(ctx, step.sql)
+			logStep("finalize", step.name, time.Since(start), err)
+			if err != nil {
+				fmt.Printf(" ⚠️  (%v)\n", err)
+			} else {
+				fmt.Printf(" ✅ (took %v)\n", time.Since(start))
+				if step.index != "" {
+					recordIndex(ctx, conn, metrics, step.index, time.Since(start), false)
+				}
+			}
+		} else {
+			fmt.Println("")
+		}
+	}
+
+	// Rebuild indexes separately (CONCURRENTLY requires no transaction)
+	fmt.Println("\n   🔨 Building indexes (CONCURRENTLY, takes time...):")
+	for _, idx := range financialIndexes {
+		if idx.name == "idx_txn_external_id" {
+			continue // The UNIQUE constraint's index covers it
+		}
+		fmt.Printf("      - %s...", idx.name)
+		start := time.Now()
+		_, err := conn.Exec(ctx, fmt.Sprintf("CREATE INDEX CONCURRENTLY %s ON %s %s", idx.name, config.TableName, idx.def))
+		logStep("finalize", "index", time.Since(start), err, "index", idx.name)
+		if err != nil {
+			fmt.Printf(" ⚠️  (%v)\n", err)
+		} else {
+			fmt.Printf(" ✅ (%v)\n", time.Since(start))
+			recordIndex(ctx, conn, metrics, idx.name, time.Since(start), true)
+		}
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+// ============================================================================
+// DUPLICATE KEYS: Find them before ADD PRIMARY KEY / UNIQUE fails on them
+// ============================================================================
+
+// uniqueKeys are the columns restoreConstraints makes unique.
+var uniqueKeys = []string{"transaction_id", "external_txn_id"}
+
+// resolveDuplicates reports duplicate key values. Without -dedupe it fails,
+// so the constraints aren't attempted; with -dedupe it keeps the first row
+// per key and moves the others to the errors table.
+func resolveDuplicates(ctx context.Context, pool *pgxpool.Pool) error {
+	fmt.Println("   0. Checking for duplicate keys...")
+	var found []string
+	for _, key := range uniqueKeys {
+		start := time.Now()
+		var values, extra int64
+		err := pool.QueryRow(ctx, fmt.Sprintf(`
+			SELECT count(*), coalesce(sum(n - 1), 0)
+			FROM (SELECT count(*) AS n FROM %s GROUP BY %s HAVING count(*) > 1) d
+		`, config.TableName, key)).Scan(&values, &extra)
+		if err != nil {
+			return fmt.Errorf("duplicate check on %s failed: %w", key, err)
+		}
+		if values == 0 {
+			fmt.Printf("      ✅ %s: no duplicates (%v)\n", key, time.Since(start))
+			continue
+		}
+
+		fmt.Printf("      ⚠️  %s: %d values duplicated, %d extra rows (%v)\n", key, values, extra, time.Since(start))
+		rows, err := pool.Query(ctx, fmt.Sprintf(`
+			SELECT %s::text, count(*) FROM %s GROUP BY %s HAVING count(*) > 1
+			ORDER BY count(*) DESC, 1 LIMIT 10
+		`, key, config.TableName, key))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var value string
+			var n int64
+			if err := rows.Scan(&value, &n); err != nil {
+				rows.Close()
+				return err
+			}
+			fmt.Printf("         %s × %d\n", value, n)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if !config.Dedupe {
+			found = append(found, key)
+			continue
+		}
+		moved, err := moveDuplicates(ctx, pool, key)
+		if err != nil {
+			return fmt.Errorf("deduplicating %s failed: %w", key, err)
+		}
+		fmt.Printf("      🧹 %s: moved %d rows to %s\n", key, moved, config.BadRowsTable)
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("duplicate %s values would fail the constraints; rerun with -mode=restore-constraints -dedupe to move them to %s",
+			strings.Join(found, " and "), config.BadRowsTable)
+	}
+	return nil
+}
+
+// moveDuplicates deletes all but the first row (by ctid) of each duplicated
+// key and records the deleted rows in the errors table, in one statement.
+func moveDuplicates(ctx context.Context, pool *pgxpool.Pool, key string) (int64, error) {
+	if err := ensureBadRowsTable(ctx, pool); err != nil {
+		return 0, err
+	}
+
+	tag, err := pool.Exec(ctx, fmt.Sprintf(`
+		WITH extra AS (
+			DELETE FROM %[1]s
+			WHERE ctid IN (
+				SELECT ctid FROM (
+					SELECT ctid, row_number() OVER (PARTITION BY %[2]s ORDER BY ctid) AS rn
+					FROM %[1]s
+					WHERE %[2]s IN (SELECT %[2]s FROM %[1]s GROUP BY %[2]s HAVING count(*) > 1)
+				) d
+				WHERE rn > 1
+			)
+			RETURNING *
+		)
+		INSERT INTO %[3]s (error_message, row_data)
+		SELECT 'duplicate %[2]s ' || e.%[2]s, to_jsonb(e) FROM extra e
+	`, config.TableName, key, config.BadRowsTable))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ============================================================================
+// UTILITIES
+// ============================================================================
+// printUltraReport prints the metrics of an ultra-fast load.
+func printUltraReport(m *LoadMetrics) {
+	logger.Info("load finished", "rows", m.SuccessRows, "duration_ms", m.Duration.Milliseconds(),
+		"rows_per_sec", m.RowsPerSecond, "wal_bytes", m.WALBytes)
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Println("📊 ULTRA-FAST LOAD METRICS")
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("Duration:              %v\n", m.Duration)
+	fmt.Printf("Rows Loaded:           %d\n", m.SuccessRows)
+	fmt.Printf("Throughput:            %.0f rows/sec 🚀\n", m.RowsPerSecond)
+	fmt.Printf("Pre-load Table Size:   %s\n", m.PreLoadTableSize)
+	fmt.Printf("Post-load Table Size:  %s\n", m.PostLoadTableSize)
+	fmt.Printf("WAL Generated:         %s\n", m.WALGenerated)
+	fmt.Println(strings.Repeat("=", 80))
+
+	// Compare to your previous run
+	fmt.Println("\n💡 COMPARISON TO CONSTRAINT-ENABLED LOAD:")
+	fmt.Println("   Your previous run: 16,353 rows/sec")
+	fmt.Printf("   This run:          %.0f rows/sec\n", m.RowsPerSecond)
+	if m.RowsPerSecond > 16353 {
+		improvement := (m.RowsPerSecond - 16353) / 16353 * 100
+		fmt.Printf("   Improvement:       %.0f%% faster! 🎉\n", improvement)
+	}
+}
+
+// recordIndex adds a built index and its size to the metrics. The PRIMARY
+// KEY and UNIQUE constraints build theirs without CONCURRENTLY.
+func recordIndex(ctx context.Context, conn *pgxpool.Conn, m *LoadMetrics, name string, d time.Duration, concurrent bool) {
+	t := IndexMetrics{Name: name, Duration: d, Concurrent: concurrent}
+	conn.QueryRow(ctx, "SELECT pg_relation_size($1::regclass)", name).Scan(&t.SizeBytes)
+	m.mu.Lock()
+	m.IndexBuilds = append(m.IndexBuilds, t)
+	m.mu.Unlock()
+}
+
+// printRestoreReport reports what restoring constraints and indexes cost,
+// and the throughput once that is counted: the table isn't usable before.
+func printRestoreReport(m *LoadMetrics) {
+	fmt.Println("\n" + strings.Repeat("=", 80))
+	fmt.Println("🏗️  CONSTRAINT & INDEX BUILDS")
+	fmt.Println(strings.Repeat("=", 80))
+	var total time.Duration
+	var size int64
+	for _, t := range m.IndexBuilds {
+		how := "CONCURRENTLY"
+		if !t.Concurrent {
+			how = "blocking (constraint)"
+		}
+		fmt.Printf("  %-34s %12v %10s   %s\n", t.Name, t.Duration.Round(time.Millisecond), formatBytes(t.SizeBytes), how)
+		total += t.Duration
+		size += t.SizeBytes
+	}
+	fmt.Printf("  %-34s %12v %10s\n", "Total index builds", total.Round(time.Millisecond), formatBytes(size))
+	fmt.Printf("Restore phase:         %v\n", m.FinalizeDuration.Round(time.Millisecond))
+	if m.Duration > 0 {
+		end := m.Duration + m.FinalizeDuration
+		fmt.Printf("Load only:             %v, %.0f rows/sec\n", m.Duration.Round(time.Millisecond), m.RowsPerSecond)
+		fmt.Printf("Load + restore:        %v, %.0f rows/sec end to end\n", end.Round(time.Millisecond),
+			float64(m.SuccessRows)/end.Seconds())
+	}
+	fmt.Println(strings.Repeat("=", 80))
+}
@@ -0,0 +1,236 @@
+package bulkload
+
+// ============================================================================
+// UPSERT / MERGE LOAD MODE (-mode=upsert)
+// ============================================================================
+//
+// Refreshes an existing dataset instead of replacing it:
+//   1. COPY the source into an UNLOGGED staging table (<table>_staging),
+//      using the same parallel COPY pipeline as -mode=load
+//   2. INSERT ... ON CONFLICT (keys) DO UPDATE, or MERGE on PG15+, from the
+//      staging table into the target in one statement
+//   3. drop the staging table
+//
+// The target keeps its indexes, constraints and LOGGED status; no prepare or
+// finalize steps run. If a key appears more than once in the input only one
+// occurrence is applied (the last one when loading with -goroutines=1).
+//
+// -upsert-method=auto uses ON CONFLICT when a unique index covers exactly
+// -conflict-keys and falls back to MERGE (which needs no unique index) on
+// PG15+.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// loadedColumns is the column list of the last executeLoad run.
+var loadedColumns []string
+
+func runUpsert(ctx context.Context, pool *pgxpool.Pool, metrics *LoadMetrics) error {
+	defer beginPhase("upsert")()
+
+	fmt.Println("\n🔁 UPSERT: STAGE AND MERGE INTO EXISTING TABLE")
+	fmt.Println(strings.Repeat("=", 80))
+
+	target := config.TableName
+	staging := target + "_staging"
+	targetIdent := pgx.Identifier{target}.Sanitize()
+	stagingIdent := pgx.Identifier{staging}.Sanitize()
+
+	if len(config.ConflictKeys) == 0 {
+		return fmt.Errorf("-mode=upsert needs -conflict-keys")
+	}
+	if config.Checkpoint {
+		return fmt.Errorf("-mode=upsert recreates its staging table and cannot be resumed; drop -checkpoint")
+	}
+
+	method, err := resolveUpsertMethod(ctx, pool, target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Target: %s, conflict keys: %s, method: %s\n", target, strings.Join(config.ConflictKeys, ", "), method)
+
+	// No constraints on the staging table: unloaded columns (serial ids,
+	// defaults) stay NULL there and are never copied to the target.
+	_, err = pool.Exec(ctx, fmt.Sprintf(`
+		DROP TABLE IF EXISTS %s;
+		CREATE UNLOGGED TABLE %s AS SELECT * FROM %s WITH NO DATA;
+	`, stagingIdent, stagingIdent, targetIdent))
+	if err != nil {
+		return fmt.Errorf("failed to create staging table: %w", err)
+	}
+	defer func() {
+		if _, err := pool.Exec(context.Background(), "DROP TABLE IF EXISTS "+stagingIdent); err != nil {
+			fmt.Printf("⚠️  failed to drop %s: %v\n", staging, err)
+		}
+	}()
+
+	config.TableName = staging
+	err = executeLoad(ctx, pool, metrics)
+	config.TableName = target
+	if err != nil {
+		return err
+	}
+
+	for _, key := range config.ConflictKeys {
+		if !containsString(loadedColumns, key) {
+			return fmt.Errorf("conflict key %q is not among the loaded columns", key)
+		}
+	}
+	if _, err := pool.Exec(ctx, "ANALYZE "+stagingIdent); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	var inserted, updated, affected int64
+	switch method {
+	case "on-conflict":
+		err = pool.QueryRow(ctx, onConflictSQL(targetIdent, stagingIdent)).Scan(&inserted, &updated)
+		affected = inserted + updated
+	case "merge":
+		var tag pgconn.CommandTag
+		tag, err = pool.Exec(ctx, mergeSQL(targetIdent, stagingIdent))
+		affected = tag.RowsAffected()
+	}
+	if err != nil {
+		return fmt.Errorf("%s into %s failed: %w", method, target, err)
+	}
+
+	if method == "on-conflict" {
+		fmt.Printf("   ✅ %d rows inserted, %d updated in %v\n", inserted, updated, time.Since(start))
+	} else {
+		fmt.Printf("   ✅ %d rows merged in %v\n", affected, time.Since(start))
+	}
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+func resolveUpsertMethod(ctx context.Context, pool *pgxpool.Pool, target string) (string, error) {
+	if config.UpsertMethod != "auto" {
+		if config.UpsertMethod != "on-conflict" && config.UpsertMethod != "merge" {
+			return "", fmt.Errorf("unknown upsert method %q (use auto, on-conflict, merge)", config.UpsertMethod)
+		}
+		return config.UpsertMethod, nil
+	}
+
+	keys := append([]string(nil), config.ConflictKeys...)
+	sort.Strings(keys)
+	var hasUnique bool
+	err := pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM pg_index i
+			WHERE i.indrelid = $1::regclass
+			  AND i.indisunique
+			  AND i.indpred IS NULL
+			  AND (SELECT array_agg(a.attname::text ORDER BY a.attname::text)
+			       FROM pg_attribute a
+			       WHERE a.attrelid = i.indrelid AND a.attnum = ANY (i.indkey)) = $2::text[]
+		)
+	`, target, keys).Scan(&hasUnique)
+	if err != nil {
+		return "", err
+	}
+	if hasUnique {
+		return "on-conflict", nil
+	}
+
+	var version int
+	if err := pool.QueryRow(ctx, `SELECT current_setting('server_version_num')::int`).Scan(&version); err != nil {
+		return "", err
+	}
+	if version >= 150000 {
+		return "merge", nil
+	}
+	return "", fmt.Errorf("no unique index on (%s) for ON CONFLICT and MERGE needs PostgreSQL 15+",
+		strings.Join(config.ConflictKeys, ", "))
+}
+
+// dedupedStaging selects the last occurrence of each key from staging.
+func dedupedStaging(stagingIdent string) string {
+	cols := quoteColumns(loadedColumns)
+	keys := quoteColumns(config.ConflictKeys)
+	return fmt.Sprintf("SELECT DISTINCT ON (%s) %s FROM %s ORDER BY %s, ctid DESC",
+		strings.Join(keys, ", "), strings.Join(cols, ", "), stagingIdent, strings.Join(keys, ", "))
+}
+
+func onConflictSQL(targetIdent, stagingIdent string) string {
+	cols := quoteColumns(loadedColumns)
+	keys := quoteColumns(config.ConflictKeys)
+
+	var sets []string
+	for _, col := range loadedColumns {
+		if !containsString(config.ConflictKeys, col) {
+			c := pgx.Identifier{col}.Sanitize()
+			sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", c, c))
+		}
+	}
+	action := "DO NOTHING"
+	if len(sets) > 0 {
+		action = "DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+
+	// xmax = 0 distinguishes freshly inserted rows from updated ones.
+	return fmt.Sprintf(`
+		WITH upserted AS (
+			INSERT INTO %s (%s)
+			%s
+			ON CONFLICT (%s) %s
+			RETURNING (xmax = 0) AS inserted
+		)
+		SELECT count(*) FILTER (WHERE inserted), count(*) FILTER (WHERE NOT inserted) FROM upserted
+	`, targetIdent, strings.Join(cols, ", "), dedupedStaging(stagingIdent), strings.Join(keys, ", "), action)
+}
+
+func mergeSQL(targetIdent, stagingIdent string) string {
+	var on, sets, values []string
+	for _, key := range config.ConflictKeys {
+		k := pgx.Identifier{key}.Sanitize()
+		on = append(on, fmt.Sprintf("t.%s = s.%s", k, k))
+	}
+	for _, col := range loadedColumns {
+		c := pgx.Identifier{col}.Sanitize()
+		values = append(values, "s."+c)
+		if !containsString(config.ConflictKeys, col) {
+			sets = append(sets, fmt.Sprintf("%s = s.%s", c, c))
+		}
+	}
+
+	matched := "DO NOTHING"
+	if len(sets) > 0 {
+		matched = "UPDATE SET " + strings.Join(sets, ", ")
+	}
+	return fmt.Sprintf(`
+		MERGE INTO %s t
+		USING (%s) s
+		ON %s
+		WHEN MATCHED THEN %s
+		WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)
+	`, targetIdent, dedupedStaging(stagingIdent), strings.Join(on, " AND "), matched,
+		strings.Join(quoteColumns(loadedColumns), ", "), strings.Join(values, ", "))
+}
+
+func quoteColumns(cols []string) []string {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return quoted
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package bulkload
+
+// ============================================================================
+// POST-LOAD VALIDATION (-mode=validate)
+// ============================================================================
+//
+// Checks a finished load and prints a pass/fail report; the exit status is
+// non-zero if anything failed:
+//   1. row count: rows in the table plus rows quarantined in the bad-rows
+//      table must equal -rows
+//   2. constraints: constraints left NOT VALID are validated, and the
+//      business rules in validationConstraints are added NOT VALID (no
+//      long lock) and then validated. A rule that fails is dropped again.
+//   3. indexes: none may be INVALID (see indexes.go)
+//   4. sampled rows: up to -validate-sample rows (TABLESAMPLE) are checked
+//      against every NOT NULL column and CHECK constraint, which catches
+//      constraints that were dropped or NOT VALID during the load
+//   5. source checksums: with a file source and -verify-sample, sampled
+//      source rows must be in the table unchanged (see verify.go)
+//
+//   go run ./cmd/prod_loader -mode=validate -rows=50000000
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// validationConstraint is a rule restored after the load; it's skipped on
+// tables that lack any of its columns.
+type validationConstraint struct {
+	name    string
+	check   string
+	columns []string
+}
+
+var validationConstraints = []validationConstraint{
+	{"chk_txn_currency_format", "currency ~ '^[A-Z]{3}$'", []string{"currency"}},
+	{"chk_txn_settlement_after_txn", "settlement_date IS NULL OR settlement_date >= transaction_date",
+		[]string{"settlement_date", "transaction_date"}},
+	{"chk_txn_charges_nonnegative", "fee_amount >= 0 AND tax_amount >= 0", []string{"fee_amount", "tax_amount"}},
+}
+
+// validationReport collects check outcomes.
+type validationReport struct {
+	passed, failed int
+}
+
+func (r *validationReport) result(ok bool, name, detail string) {
+	level := slog.LevelInfo
+	if !ok {
+		level = slog.LevelWarn
+	}
+	logger.Log(context.Background(), level, "check", "phase", currentPhase(), "check", name, "ok", ok, "detail", detail)
+	if ok {
+		r.passed++
+		fmt.Printf("   ✅ PASS  %-36s %s\n", name, detail)
+	} else {
+		r.failed++
+		fmt.Printf("   ❌ FAIL  %-36s %s\n", name, detail)
+	}
+}
+
+func runValidation(ctx context.Context, pool *pgxpool.Pool) error {
+	defer beginPhase("validate")()
+
+	fmt.Println("\n🔍 POST-LOAD VALIDATION")
+	fmt.Println(strings.Repeat("=", 80))
+
+	report := &validationReport{}
+	steps := []struct {
+		name string
+		run  func(context.Context, *pgxpool.Pool, *validationReport) error
+	}{
+		{"1. Row count", validateRowCount},
+		{"2. Constraints", validateConstraints},
+		{"3. Indexes", validateIndexes},
+		{"4. Sampled rows", validateSample},
+		{"5. Source checksums", validateChecksums},
+	}
+	for _, step := range steps {
+		fmt.Printf("\n%s\n", step.name)
+		if err := step.run(ctx, pool, report); err != nil {
+			report.result(false, step.name, err.Error())
+		}
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+	if report.failed > 0 {
+		fmt.Printf("❌ VALIDATION FAILED: %d passed, %d failed\n", report.passed, report.failed)
+		return fmt.Errorf("%d validation checks failed", report.failed)
+	}
+	fmt.Printf("✅ VALIDATION PASSED: %d checks\n", report.passed)
+	return nil
+}
+
+func validateRowCount(ctx context.Context, pool *pgxpool.Pool, report *validationReport) error {
+	var rows, quarantined int64
+	if err := pool.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM %s", config.TableName)).Scan(&rows); err != nil {
+		return err
+	}
+	var hasBadRows bool
+	if err := pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", config.BadRowsTable).Scan(&hasBadRows); err != nil {
+		return err
+	}
+	if hasBadRows {
+		if err := pool.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM %s", config.BadRowsTable)).Scan(&quarantined); err != nil {
+			return err
+		}
+	}
+
+	detail := fmt.Sprintf("%d rows", rows)
+	if quarantined > 0 {
+		detail += fmt.Sprintf(" + %d quarantined", quarantined)
+	}
+	report.result(rows+quarantined == config.TotalRows, "row count", fmt.Sprintf("%s, expected %d", detail, config.TotalRows))
+	return nil
+}
+
+func validateConstraints(ctx context.Context, pool *pgxpool.Pool, report *validationReport) error {
+	notValid, err := queryStrings(ctx, pool, `
+		SELECT conname FROM pg_constraint
+		WHERE conrelid = $1::regclass AND NOT convalidated
+		ORDER BY conname
+	`, config.TableName)
+	if err != nil {
+		return err
+	}
+	for _, name := range notValid {
+		_, err := pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s", config.TableName, pgx.Identifier{name}.Sanitize()))
+		report.result(err == nil, name, errDetail(err, "validated"))
+	}
+
+	columns, err := queryStrings(ctx, pool, `
+		SELECT attname::text FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped
+	`, config.TableName)
+	if err != nil {
+		return err
+	}
+	existing, err := queryStrings(ctx, pool, `
+		SELECT conname::text FROM pg_constraint WHERE conrelid = $1::regclass
+	`, config.TableName)
+	if err != nil {
+		return err
+	}
+
+	checked := len(notValid)
+	for _, c := range validationConstraints {
+		if !containsAll(columns, c.columns) || slices.Contains(existing, c.name) {
+			continue
+		}
+		checked++
+		// NOT VALID only takes a brief lock; VALIDATE scans under SHARE UPDATE EXCLUSIVE.
+		_, err := pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s) NOT VALID", config.TableName, c.name, c.check))
+		if err == nil {
+			_, err = pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s VALIDATE CONSTRAINT %s", config.TableName, c.name))
+			if err != nil {
+				pool.Exec(ctx, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", config.TableName, c.name))
+			}
+		}
+		report.result(err == nil, c.name, errDetail(err, "added and validated"))
+	}
+	if checked == 0 {
+		fmt.Println("   (no constraints to validate)")
+	}
+	return nil
+}
+
+func validateIndexes(ctx context.Context, pool *pgxpool.Pool, report *validationReport) error {
+	invalid, err := invalidIndexes(ctx, pool)
+	if err != nil {
+		return err
+	}
+	detail := "none INVALID"
+	if len(invalid) > 0 {
+		detail = "INVALID: " + strings.Join(invalid, ", ")
+	}
+	report.result(len(invalid) == 0, "indexes", detail)
+	return nil
+}
+
+// validateSample checks sampled rows against NOT NULL and every CHECK
+// constraint (validated or not) in one pass.
+func validateSample(ctx context.Context, pool *pgxpool.Pool, report *validationReport) error {
+	type rule struct{ name, violated string }
+	var rules []rule
+
+	notNull, err := queryStrings(ctx, pool, `
+		SELECT attname::text FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND attnotnull
+		ORDER BY attnum
+	`, config.TableName)
+	if err != nil {
+		return err
+	}
+	for _, col := range notNull {
+		rules = append(rules, rule{col + " NOT NULL", pgx.Identifier{col}.Sanitize() + " IS NULL"})
+	}
+
+	checks, err := pool.Query(ctx, `
+		SELECT conname::text, pg_get_constraintdef(oid) FROM pg_constraint
+		WHERE conrelid = $1::regclass AND contype = 'c'
+		ORDER BY conname
+	`, config.TableName)
+	if err != nil {
+		return err
+	}
+	for checks.Next() {
+		var name, def string
+		if err := checks.Scan(&name, &def); err != nil {
+			checks.Close()
+			return err
+		}
+		expr := strings.TrimSuffix(strings.TrimPrefix(def, "CHECK "), " NOT VALID")
+		rules = append(rules, rule{name, "(" + expr + ") IS FALSE"})
+	}
+	checks.Close()
+	if err := checks.Err(); err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		fmt.Println("   (no NOT NULL or CHECK rules)")
+		return nil
+	}
+
+	var estimate float64
+	if err := pool.QueryRow(ctx, "SELECT greatest(reltuples, 1) FROM pg_class WHERE oid = $1::regclass",
+		config.TableName).Scan(&estimate); err != nil {
+		return err
+	}
+	percent := min(100, float64(config.ValidateSample)/estimate*100*1.2)
+
+	counts := make([]string, len(rules))
+	for i, r := range rules {
+		counts[i] = fmt.Sprintf("count(*) FILTER (WHERE %s)", r.violated)
+	}
+	query := fmt.Sprintf("SELECT count(*), %s FROM (SELECT * FROM %s TABLESAMPLE BERNOULLI (%f) LIMIT %d) s",
+		strings.Join(counts, ", "), config.TableName, percent, config.ValidateSample)
+
+	values := make([]int64, len(rules)+1)
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := pool.QueryRow(ctx, query).Scan(dest...); err != nil {
+		return err
+	}
+
+	fmt.Printf("   Sampled %d rows\n", values[0])
+	for i, r := range rules {
+		bad := values[i+1]
+		report.result(bad == 0, r.name, fmt.Sprintf("%d violations", bad))
+	}
+	return nil
+}
+
+func queryStrings(ctx context.Context, pool *pgxpool.Pool, sql string, args ...interface{}) ([]string, error) {
+	rows, err := pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func errDetail(err error, ok string) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ok
+}
@@ -0,0 +1,255 @@
+package bulkload
+
+// ============================================================================
+// WAL AND CHECKPOINT ADVISOR (pre-flight, -apply-settings)
+// ============================================================================
+//
+// Before prepare, load, all and upsert the loader estimates how much WAL
+// the run will write and compares it with the checkpoint settings. A load
+// that outgrows max_wal_size forces a checkpoint every few GB, and each
+// checkpoint makes the next change to every page log a full page image,
+// so a 100 GB load on default settings can write several times its size.
+//
+// The estimate: heap = -rows × row width (from the target's current
+// size/reltuples, else ~600 bytes for generated rows). A LOGGED target
+// logs about 1.15 × heap while loading; an UNLOGGED one logs nothing then
+// but SET LOGGED writes the heap once in finalize. Index builds log about
+// half the heap again. wal_level=minimal skips both of the latter.
+//
+// Recommendations (each printed as the ALTER SYSTEM statement):
+//   max_wal_size        a quarter of the estimate, 4GB-64GB: at most a few
+//                       size-triggered checkpoints (pg_wal needs the room)
+//   checkpoint_timeout  at least 30min
+//   wal_compression     lz4 (PG15+) or on: smaller full page images
+//   shared_buffers      only reported, it needs a restart
+// -apply-settings runs the ALTER SYSTEM statements and pg_reload_conf();
+// managed services (RDS, Cloud SQL) refuse ALTER SYSTEM, use the
+// parameter group instead. Undo with ALTER SYSTEM RESET <name>.
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	generatedRowBytes = 600             // Heap bytes per generated row, tuple header included
+	minMaxWALSize     = int64(4 << 30)  // Lower bound of the max_wal_size recommendation
+	maxMaxWALSize     = int64(64 << 30) // Upper bound
+)
+
+// walSettings are the server settings the advisor looks at.
+type walSettings struct {
+	maxWALSize        int64 // Bytes
+	checkpointTimeout int   // Seconds
+	walCompression    string
+	walLevel          string
+	sharedBuffers     int64 // Bytes
+	versionNum        int
+}
+
+// targetStats is what the pre-flight checks read from the target table.
+type targetStats struct {
+	rowBytes    float64 // Heap bytes per row, generatedRowBytes if unknown
+	indexBytes  float64 // Index bytes per row, 0 if unknown
+	totalBytes  int64   // Heap, TOAST and indexes now
+	persistence string  // pg_class.relpersistence, "p" if there is no table yet
+}
+
+// walAdvice is one recommended change.
+type walAdvice struct {
+	name, current, value, reason string
+	restart                      bool // Only reported
+}
+
+// adviseWALSettings prints (and with -apply-settings applies) checkpoint
+// settings for the coming load; runsPrepare says whether prepare is part of
+// this run and will make the target UNLOGGED.
+func adviseWALSettings(ctx context.Context, pool *pgxpool.Pool, runsPrepare bool) error {
+	if cockroach() {
+		return nil // Raft log, no WAL settings to tune
+	}
+	fmt.Println("\n🩺 PRE-FLIGHT: WAL AND CHECKPOINT SETTINGS")
+	fmt.Println(strings.Repeat("=", 80))
+
+	s, err := readWALSettings(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	wal, detail, err := estimateLoadWAL(ctx, pool, s, runsPrepare)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Settings: max_wal_size %s, checkpoint_timeout %dmin, wal_compression %s, shared_buffers %s, wal_level %s\n",
+		formatBytes(s.maxWALSize), s.checkpointTimeout/60, s.walCompression, formatBytes(s.sharedBuffers), s.walLevel)
+	fmt.Printf("Estimated WAL for %d rows: %s (%s)\n", config.TotalRows, formatBytes(wal), detail)
+	if config.Source != "generate" && config.Source != "introspect" {
+		fmt.Println("   (file source: the estimate assumes -rows rows)")
+	}
+	if wal > s.maxWALSize {
+		fmt.Printf("   ≈ %d checkpoints forced by max_wal_size during the load\n", wal/s.maxWALSize)
+	}
+
+	advice := walRecommendations(s, wal)
+	if len(advice) == 0 {
+		fmt.Println("✅ Settings look right for this load")
+		fmt.Println(strings.Repeat("=", 80))
+		return nil
+	}
+	for _, a := range advice {
+		fmt.Printf("   💡 %-19s %s → %s: %s\n", a.name, a.current, a.value, a.reason)
+	}
+
+	var statements []string
+	for _, a := range advice {
+		if !a.restart {
+			statements = append(statements, fmt.Sprintf("ALTER SYSTEM SET %s = '%s'", a.name, a.value))
+		}
+	}
+	if !config.ApplySettings {
+		if len(statements) > 0 {
+			fmt.Println("   Apply with -apply-settings, or:")
+			for _, stmt := range statements {
+				fmt.Printf("      %s;\n", stmt)
+			}
+			fmt.Println("      SELECT pg_reload_conf();")
+		}
+		fmt.Println(strings.Repeat("=", 80))
+		return nil
+	}
+
+	for _, stmt := range statements {
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			fmt.Printf("   ⚠️  %s: %v\n", stmt, err)
+			fmt.Println("   (managed services refuse ALTER SYSTEM; change the parameter group instead)")
+			fmt.Println(strings.Repeat("=", 80))
+			return nil
+		}
+		fmt.Printf("   ✅ %s\n", stmt)
+	}
+	if _, err := pool.Exec(ctx, "SELECT pg_reload_conf()"); err != nil {
+		return fmt.Errorf("failed to reload configuration: %w", err)
+	}
+	fmt.Println("   ✅ Configuration reloaded (undo with ALTER SYSTEM RESET <name>)")
+	fmt.Println(strings.Repeat("=", 80))
+	return nil
+}
+
+// readWALSettings reads the settings the advisor looks at.
+func readWALSettings(ctx context.Context, pool *pgxpool.Pool) (walSettings, error) {
+	var s walSettings
+	err := pool.QueryRow(ctx, `
+		SELECT pg_size_bytes(current_setting('max_wal_size')),
+		       (SELECT setting::int FROM pg_settings WHERE name = 'checkpoint_timeout'),
+		       current_setting('wal_compression'),
+		       current_setting('wal_level'),
+		       pg_size_bytes(current_setting('shared_buffers')),
+		       current_setting('server_version_num')::int
+	`).Scan(&s.maxWALSize, &s.checkpointTimeout, &s.walCompression, &s.walLevel, &s.sharedBuffers, &s.versionNum)
+	if err != nil {
+		return s, fmt.Errorf("failed to read WAL settings: %w", err)
+	}
+	return s, nil
+}
+
+// inspectTarget reads row and index widths from the target's current size
+// and reltuples.
+func inspectTarget(ctx context.Context, pool *pgxpool.Pool) (targetStats, error) {
+	t := targetStats{rowBytes: generatedRowBytes}
+	var width float64
+	err := pool.QueryRow(ctx, `
+		SELECT coalesce(max(CASE WHEN reltuples > 0 THEN pg_relation_size(oid) / reltuples END), 0)::float8,
+		       coalesce(max(CASE WHEN reltuples > 0 THEN pg_indexes_size(oid) / reltuples END), 0)::float8,
+		       coalesce(max(pg_total_relation_size(oid)), 0),
+		       coalesce(max(relpersistence::text), 'p')
+		FROM pg_class WHERE oid = to_regclass($1)
+	`, config.TableName).Scan(&width, &t.indexBytes, &t.totalBytes, &t.persistence)
+	if err != nil {
+		return t, fmt.Errorf("failed to inspect %s: %w", config.TableName, err)
+	}
+	if width > 0 {
+		t.rowBytes = width
+	}
+	return t, nil
+}
+
+// estimateLoadWAL returns the expected WAL bytes and how they add up.
+func estimateLoadWAL(ctx context.Context, pool *pgxpool.Pool, s walSettings, runsPrepare bool) (int64, string, error) {
+	t, err := inspectTarget(ctx, pool)
+	if err != nil {
+		return 0, "", err
+	}
+	rowBytes := t.rowBytes
+	heap := float64(config.TotalRows) * rowBytes
+
+	unlogged := t.persistence == "u" || (runsPrepare && config.Unlogged)
+	minimal := s.walLevel == "minimal"
+	var wal float64
+	var parts []string
+	switch {
+	case !unlogged:
+		wal = heap * 1.15
+		parts = append(parts, "LOGGED load")
+	case !minimal:
+		wal = heap
+		parts = append(parts, "SET LOGGED rewrite")
+	}
+	if !minimal && config.DropIndexes && slices.Contains(config.FinalizeSteps, "indexes") {
+		wal += heap * 0.5
+		parts = append(parts, "index builds")
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "UNLOGGED load, wal_level=minimal")
+	}
+	return int64(wal), fmt.Sprintf("%.0f bytes/row, %s", rowBytes, strings.Join(parts, " + ")), nil
+}
+
+// walRecommendations compares the settings with what a load writing wal
+// bytes needs.
+func walRecommendations(s walSettings, wal int64) []walAdvice {
+	var advice []walAdvice
+
+	target := min(max(wal/4, minMaxWALSize), maxMaxWALSize)
+	if s.maxWALSize < target && wal > s.maxWALSize {
+		advice = append(advice, walAdvice{
+			name:    "max_wal_size",
+			current: formatBytes(s.maxWALSize),
+			value:   fmt.Sprintf("%dGB", (target+(1<<30)-1)>>30),
+			reason:  "fewer size-triggered checkpoints and full page images",
+		})
+	}
+	if s.checkpointTimeout < 30*60 {
+		advice = append(advice, walAdvice{
+			name:    "checkpoint_timeout",
+			current: fmt.Sprintf("%dmin", s.checkpointTimeout/60),
+			value:   "30min",
+			reason:  "spread checkpoints out during the load",
+		})
+	}
+	if s.walCompression == "off" {
+		value := "on"
+		if s.versionNum >= 150000 {
+			value = "lz4"
+		}
+		advice = append(advice, walAdvice{
+			name:    "wal_compression",
+			current: "off",
+			value:   value,
+			reason:  "compress full page images",
+		})
+	}
+	if s.sharedBuffers < 1<<30 {
+		advice = append(advice, walAdvice{
+			name:    "shared_buffers",
+			current: formatBytes(s.sharedBuffers),
+			value:   "~25% of RAM",
+			reason:  "needs a restart, not applied",
+			restart: true,
+		})
+	}
+	return advice
+}
@@ -0,0 +1,209 @@
+/*
+================================================================================
+PRODUCTION-GRADE POSTGRESQL BULK LOADER
+================================================================================
+
+Purpose: Demonstrate enterprise-grade bulk loading with all optimizations
+
+Key Features:
+1. Pre-load database optimizations (indexes, autovacuum, constraints)
+2. COPY protocol for maximum throughput (100k-1M rows/sec)
+3. Parallel loading with connection pooling
+4. Comprehensive error handling and bad row logging
+5. Progress tracking and performance metrics
+6. Post-load cleanup and validation
+7. Production-ready monitoring and observability
+
+Performance Expectations:
+- Single-threaded COPY: 100-200k rows/sec
+- Multi-threaded COPY: 500k-1M rows/sec
+- With optimizations: 2-5x improvement
+
+Usage:
+    go run ./cmd/prod_loader -mode=prepare    # Prepare table for load
+    go run ./cmd/prod_loader -mode=load       # Execute bulk load
+    go run ./cmd/prod_loader -mode=finalize   # Rebuild indexes, analyze
+    go run ./cmd/prod_loader -mode=validate   # Pass/fail checks of the loaded table
+    go run ./cmd/prod_loader -mode=all        # Run all phases
+    go run ./cmd/prod_loader -mode=upsert   # Merge into existing data
+    go run ./cmd/prod_loader -mode=swap     # Reload a live table, swap it in
+    go run ./cmd/prod_loader -mode=generate -out=dataset   # Files only, no database
+    go run ./cmd/prod_loader -mode=dump-bench   # pg_dump/pg_restore timings of the table
+    go run ./cmd/prod_loader -mode=bench-matrix # rows/sec and WAL across a parameter grid
+
+    Connection: -dsn, PG* environment variables, -sslmode/-sslrootcert or
+    -dsn=secret://aws/<id> | secret://vault/<path> (see bulkload/dsn.go)
+    CockroachDB: -backend=cockroach (see bulkload/cockroach.go)
+    MySQL:       -backend=mysql -dsn="user:pw@tcp(host:3306)/db" (see bulkload/mysql.go)
+
+    Input sources other than the synthetic generator live in bulkload/:
+    go run ./cmd/prod_loader -mode=load -source=csv -file=extract.csv
+================================================================================
+*/
+
+// Command prod_loader is the command line of the bulkload package.
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/bulk-loading/bulkload"
+
+func main() {
+	bulkload.Main()
+}
+
+/*
+================================================================================
+USAGE EXAMPLES
+================================================================================
+
+1. Full automated load (recommended for first run):
+   go run ./cmd/prod_loader -mode=all
+   go run ./cmd/prod_loader -mode=append -rows=45000000   # grow it later, existing rows kept
+
+2. Phased approach (for production):
+   go run ./cmd/prod_loader -mode=create-schema
+   go run ./cmd/prod_loader -mode=prepare
+   go run ./cmd/prod_loader -mode=load
+   go run ./cmd/prod_loader -mode=finalize
+   go run ./cmd/prod_loader -mode=validate -rows=1000000   # counts, constraints, indexes, sample
+   go run ./cmd/prod_loader -mode=validate -source=csv -file=ledger.csv -verify-sample=10000   # + source checksums
+
+3. Recurring loads from a reviewed plan (loader.example.yaml):
+   go run ./cmd/prod_loader -config=loader.example.yaml -profile=initial-load
+   go run ./cmd/prod_loader -config=loader.example.yaml -profile=backfill -file=2023.csv
+   go run ./cmd/prod_loader -config=loader.example.yaml -profile=staging-refresh -goroutines=32   # flags win
+
+4. Connecting without credentials in the command line:
+   PGHOST=db.internal PGUSER=loader PGDATABASE=avro go run ./cmd/prod_loader -mode=all   # + ~/.pgpass
+   go run ./cmd/prod_loader -mode=all -dsn="postgres://loader@db.internal/avro" -sslmode=verify-full -sslrootcert=ca.pem
+   go run ./cmd/prod_loader -mode=all -dsn=secret://aws/prod/bulk-loader
+   VAULT_ADDR=https://vault:8200 VAULT_TOKEN=... go run ./cmd/prod_loader -mode=all -dsn=secret://vault/secret/data/bulk-loader
+
+5. Load a real extract instead of synthetic rows (CSV/TSV):
+   go run ./cmd/prod_loader -mode=load -source=csv -file=extract.csv
+   go run ./cmd/prod_loader -mode=load -source=csv -file=extract.tsv \
+       -delimiter='\t' -header=false -null='\N' \
+       -columns=external_txn_id,transaction_date,amount,transaction_type,account_id,customer_id
+   go run ./cmd/prod_loader -mode=load -source=avro -file=txns.avro \
+       -field-map=txn_uuid=external_txn_id,ts=transaction_time
+   go run ./cmd/prod_loader -mode=load -source=ndjson -file=events.jsonl \
+       -field-map=id=external_txn_id,ts=transaction_time   # other fields → metadata
+   go run ./cmd/prod_loader -mode=load -source=csv \
+       -file=s3://exports/txns/2024-06.csv.zst -read-concurrency=16
+   go run ./cmd/prod_loader -mode=load -source=avro -file=gs://exports/txns.avro
+   LOADER_MASK_KEY=... go run ./cmd/prod_loader -mode=all -source=csv -file=prod_extract.csv \
+       -mask=correlation_id=hash,city=fake,processed_by=nullify   # PII never reaches staging
+   go run ./cmd/prod_loader -mode=load -source=csv -write-method=fdw \
+       -file='/data/export/*.csv'   # files already on the database host, read by file_fdw
+
+6. Multi-hour loads that must survive interruptions:
+   go run ./cmd/prod_loader -mode=all -checkpoint -load-id=fx-2024q2
+   # ... connection lost / Ctrl-C ...
+   go run ./cmd/prod_loader -mode=all -resume -load-id=fx-2024q2
+   psql -c "SELECT count(*), sum(rows) FROM bulk_load_checkpoints WHERE load_id = 'fx-2024q2';"
+   kill -USR1 <pid>   # yield to an incident: workers stop at the next batch boundary
+   kill -USR2 <pid>   # carry on (or: echo pause | nc -U <sock> with -control-socket=<sock>)
+
+7. Refresh an existing table (staging COPY + ON CONFLICT / MERGE):
+   go run ./cmd/prod_loader -mode=upsert -source=csv -file=corrections.csv \
+       -conflict-keys=external_txn_id
+   go run ./cmd/prod_loader -mode=swap -rows=50000000   # full reload next to live traffic (see bulkload/swap.go)
+   go run ./cmd/prod_loader -mode=swap -table=financial_transactions_2024_06 -swap-lock-timeout=2s   # one partition
+   go run ./cmd/prod_loader -mode=load -trigger-mode=fast -reconcile-sql="CALL rebuild_balances()"   # see bulkload/triggers.go
+
+8. Range partitioned targets (partitions pre-created, COPY routed per partition):
+   go run ./cmd/prod_loader -mode=all -partitioned=monthly     # vs. the monolithic default
+   go run ./cmd/prod_loader -mode=load -partition-interval=daily
+   go run ./cmd/prod_loader -mode=load -route-partitions=false   # let the server route
+
+9. Loading next to live replicas:
+   go run ./cmd/prod_loader -mode=load -max-replica-lag=30s
+   go run ./cmd/prod_loader -mode=load -max-replica-lag=30s -replica-dsn="postgres://...@replica:5432/avro"
+   go run ./cmd/prod_loader -mode=load -max-wal-rate=64MB   # LOGGED target, keep archiving current
+   go run ./cmd/prod_loader -mode=upsert -source=csv -file=backfill.csv -max-rows-per-sec=5000
+   go run ./cmd/prod_loader -mode=backfill -backfill=amount-usd -batch-size=5000 -max-replica-lag=10s   # batched UPDATE
+
+10. Behind a proxy that breaks COPY, or PgBouncer in transaction mode:
+   go run ./cmd/prod_loader -mode=load -write-method=insert -insert-batch=1000 -commit-rows=50000
+   go run ./cmd/prod_loader -mode=all -pooler=on -direct-dsn="postgres://...@db:5432/avro"
+
+11. Benchmark CockroachDB ingestion with the same data:
+   go run ./cmd/prod_loader -mode=all -backend=cockroach -dsn="postgresql://root@crdb:26257/avro?sslmode=disable"
+   go run ./cmd/prod_loader -mode=load -backend=cockroach -source=csv -file=s3://exports/txns.csv \
+       -columns=external_txn_id,transaction_date,amount,transaction_type,account_id,customer_id   # IMPORT INTO
+   go run ./cmd/prod_loader -mode=load -backend=cockroach -insert-batch=250   # INSERTs, retried on 40001
+
+12. The same pipeline on MySQL (drop keys, LOAD DATA LOCAL INFILE, add keys, ANALYZE TABLE):
+   go run ./cmd/prod_loader -mode=all -backend=mysql -dsn="loader:pw@tcp(mysql:3306)/avro"
+   go run ./cmd/prod_loader -mode=all -backend=mysql -unlogged=false   # keep the redo log on
+   go run ./cmd/prod_loader -mode=load -backend=mysql -source=csv -file=extract.csv
+
+13. Let the loader find the best worker count:
+   go run ./cmd/prod_loader -mode=all -adaptive -max-goroutines=32
+
+14. Generate data shaped like production (cardinalities, skew, NULLs):
+   go run ./cmd/prod_loader -mode=all -data-profile=data_profile.example.yaml
+   go run ./cmd/prod_loader -mode=all -null-frac settlement_date=0.3 -ndistinct merchant_category=400
+   go run ./cmd/prod_loader -mode=all -faker -locales=en_GB,de_DE   # realistic text values
+   go run ./cmd/prod_loader -mode=all -payload-size=lognormal:1KB,1.5 -payload-tail=0.01:64KB-1MB   # TOAST and GIN cost
+   go run ./cmd/prod_loader -mode=all -seed=42 -as-of=2025-01-31       # identical rows every run
+   go run ./cmd/prod_loader -mode=all -unique-columns=account_id,correlation_id   # for extra UNIQUE constraints
+
+15. Generate a dataset once, load it many times (no database needed):
+   go run ./cmd/prod_loader -mode=generate -rows=100000000 -goroutines=16 -out=dataset -format=binary -seed=42
+   go run ./cmd/prod_loader -mode=generate -out=dataset -format=csv -compression=zstd
+   go run ./cmd/prod_loader -mode=generate -out=dataset -format=parquet -faker   # for Spark/DuckDB
+
+16. Compare reloading with COPY against pg_dump/pg_restore (migration planning):
+   go run ./cmd/prod_loader -mode=all -rows=50000000 -status-table
+   go run ./cmd/prod_loader -mode=dump-bench -dump-jobs=8
+
+17. Load any existing table (generators derived from types, keys, FKs and CHECKs):
+   go run ./cmd/prod_loader -mode=load -source=introspect -table=orders -rows=5000000
+   go run ./cmd/prod_loader -mode=load -source=introspect -table=customers -faker -log-bad-rows
+
+18. Monitoring during load:
+   go run ./cmd/prod_loader -mode=all -status-file=load.json -status-table
+   -- In another terminal, monitor progress:
+   cat load.json
+   go run ./cmd/prod_loader -mode=all -metrics-addr=:9108   # Prometheus /metrics for Grafana
+   go run ./cmd/prod_loader -mode=all -log-format=json 2>console.log | jq .   # JSON events per phase, step and worker
+   psql -c "SELECT load_id, state, rows_committed, rows_per_sec, eta FROM bulk_load_status;"
+   psql -c "SELECT * FROM pg_stat_progress_copy;"
+   psql -c "SELECT * FROM pg_stat_activity WHERE application_name = 'bulk_loader';"
+
+19. Performance tuning:
+   - Measure instead of guessing: -mode=bench-matrix tries every combination
+     go run ./cmd/prod_loader -mode=bench-matrix -matrix-goroutines=4,8,16,32 -matrix-out=matrix.csv
+   - Increase -goroutines for more parallelism (8-16 optimal)
+   - Increase -batch-size for larger batches (10000-50000)
+   - Use UNLOGGED tables for initial load (fastest)
+   - Raise -index-parallelism / -index-mem to shorten finalize (peak memory = both multiplied)
+   - -tune-stats raises statistics targets of skewed columns before ANALYZE (see bulkload/stats.go)
+   - Disable synchronous_commit (less durable, but faster)
+   - Follow the pre-flight WAL advice (max_wal_size, checkpoint_timeout, wal_compression):
+     go run ./cmd/prod_loader -mode=all -rows=500000000 -apply-settings
+   - Check the disk space forecast against the volume (df on the server needs pg_execute_server_program):
+     go run ./cmd/prod_loader -mode=all -rows=500000000 -free-space=2TB
+
+20. Dependencies (pinned in go.mod; the commands and the bulkload package share them):
+   go mod download
+   go build ./cmd/...
+
+================================================================================
+PRODUCTION CHECKLIST
+================================================================================
+✅ Connection pooling configured
+✅ Pre-load optimizations (indexes dropped, autovacuum disabled)
+✅ COPY protocol for maximum throughput
+✅ Parallel loading with goroutines
+✅ Error logging to separate table
+✅ Comprehensive metrics and monitoring
+✅ Post-load finalization (rebuild indexes, analyze)
+✅ NUMERIC for financial data (never FLOAT)
+✅ JSONB for flexible metadata
+✅ Proper timestamp handling with time zones
+✅ Realistic production data types
+✅ Documentation and team sharing ready
+
+================================================================================
+*/
@@ -0,0 +1,60 @@
+/*
+================================================================================
+ULTRA-OPTIMIZED POSTGRESQL BULK LOADER
+================================================================================
+Goal: Achieve 100k+ rows/sec by eliminating ALL overhead
+
+Key Optimizations:
+1. Drop ALL constraints (even UNIQUE)
+2. Use UNLOGGED table (no WAL)
+3. Disable all triggers
+4. Pre-allocate UUIDs in batches
+5. Minimize data generation overhead
+6. Rebuild everything after load (duplicate keys are checked first;
+   -dedupe moves them to the errors table instead of failing)
+
+Expected Performance: 100k-500k rows/sec (vs 16k-28k with constraints)
+
+Usage (connection and -payload-* flags are shared with prod_loader, see
+bulkload/dsn.go and bulkload/payload.go):
+    go run ./cmd/prod_loader_ultra -mode=all -dsn="postgres://loader@db/avro" -sslmode=require
+    go run ./cmd/prod_loader_ultra -mode=all -dsn=secret://aws/prod/bulk-loader
+    go run ./cmd/prod_loader_ultra -mode=all -payload-size=lognormal:2KB,1.2
+================================================================================
+*/
+
+// Command prod_loader_ultra is the ultra-fast mode of the bulkload package.
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/bulk-loading/bulkload"
+
+func main() {
+	bulkload.UltraMain()
+}
+
+/*
+================================================================================
+USAGE
+================================================================================
+
+# Full automated ultra-fast load
+go run ./cmd/prod_loader_ultra -mode=all
+
+# Or step by step
+go run ./cmd/prod_loader_ultra -mode=ultra-fast      # Load at maximum speed
+go run ./cmd/prod_loader_ultra -mode=restore-constraints  # Rebuild safety
+
+Expected Results:
+- WITHOUT constraints: 100k-500k rows/sec
+- WITH constraints:    16k-28k rows/sec
+- Improvement:         5-15x faster!
+
+⚠️  WARNING: During ultra-fast mode, your table has:
+   - No primary key
+   - No unique constraints
+   - No indexes
+   - No data durability (UNLOGGED)
+
+This is ONLY safe for bulk initial loads, NOT production use!
+================================================================================
+*/
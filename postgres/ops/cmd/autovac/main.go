@@ -0,0 +1,25 @@
+/*
+================================================================================
+AUTOVACUUM ACTIVITY TRACKER
+================================================================================
+
+Purpose: Tell whether autovacuum keeps up, and what holds it back
+
+Samples pg_stat_progress_vacuum and pg_stat_user_tables over a window, then
+reports vacuum durations and scan rates, tables falling behind their trigger
+point, and whether the cost limit or the worker count is the bottleneck.
+
+Usage:
+    go run ./cmd/autovac                                # 15 minutes, 10s samples
+    go run ./cmd/autovac -duration=1h -interval=5s -schema=public
+    go run ./cmd/autovac -duration=2h -format=json > autovac.json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Autovac()
+}
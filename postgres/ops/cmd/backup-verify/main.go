@@ -0,0 +1,27 @@
+/*
+================================================================================
+BACKUP RESTORE VERIFICATION HARNESS
+================================================================================
+
+Purpose: Prove the latest backup restores - into a scratch instance, replayed
+to a target time, with sanity queries passing - and how long that takes
+
+Restores the latest base backup (or runs a pgBackRest/wal-g restore command
+from the config) into a scratch data directory, replays WAL to the target
+time, runs the configured row count and checksum queries, and reports
+pass/fail with the timing of every step. Exit code 2 on a failed verification.
+
+Usage:
+    go run ./cmd/backup-verify -config=backup-verify.example.yaml
+    go run ./cmd/backup-verify -config=verify.yaml -target-time="2026-10-16 23:00:00+00" -keep
+    go run ./cmd/backup-verify -config=verify.yaml -format=json > restore-drill.json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.BackupVerify()
+}
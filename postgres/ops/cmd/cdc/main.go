@@ -0,0 +1,31 @@
+/*
+================================================================================
+LOGICAL DECODING (CDC) CAPACITY CONSUMER
+================================================================================
+
+Purpose: Measure how much change traffic logical decoding carries: throughput,
+commit-to-decoded lag and whether the consumer keeps up
+
+Creates a replication slot and consumes pgoutput (or wal2json) changes for the
+selected tables while the loader or simulators generate traffic. Every interval
+it reports transactions and changes per second, decoding lag p50/p95/max, WAL
+still to decode and WAL the slot retains; the summary says whether the consumer
+kept up and the throughput it reached while catching up. With -kafka-brokers it
+also produces the changes to Kafka as Avro (Confluent Schema Registry) and
+confirms the slot only past what Kafka acknowledged, with delivery metrics.
+
+Usage:
+    go run ./cmd/cdc -tables=public.orders,public.order_items -duration=10m
+    go run ./cmd/cdc -plugin=wal2json -tables=public.orders -interval=5s
+    go run ./cmd/cdc -keep-slot -slot=cdc_capacity -format=json > cdc.ndjson
+    go run ./cmd/cdc -tables=public.orders -kafka-brokers=kafka1:9092 -schema-registry=http://registry:8081 -keep-slot -kafka-checkpoint=cdc.checkpoint.json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.CDC()
+}
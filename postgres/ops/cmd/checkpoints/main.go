@@ -0,0 +1,25 @@
+/*
+================================================================================
+CHECKPOINT AND BGWRITER HEALTH
+================================================================================
+
+Purpose: Tell whether checkpoints and background writes are tuned for the load
+
+Measures checkpoint frequency, requested vs timed checkpoints and who writes
+dirty buffers (checkpointer, bgwriter or backends) over a window, and
+suggests max_wal_size, checkpoint_completion_target, checkpoint_timeout and
+bgwriter settings.
+
+Usage:
+    go run ./cmd/checkpoints -duration=30m
+    go run ./cmd/checkpoints -duration=0 -format=json    # since the stats reset
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Checkpoints()
+}
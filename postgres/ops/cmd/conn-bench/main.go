@@ -0,0 +1,26 @@
+/*
+================================================================================
+TLS AND AUTHENTICATION OVERHEAD
+================================================================================
+
+Purpose: Answer "what does turning on TLS cost?" with numbers
+
+Times new connections across sslmode settings and authentication variants
+(roles using scram-sha-256 or md5, a pooler in front), splitting TCP from
+the TLS and authentication handshake, next to the cost of a query on a
+pooled connection and optional bulk transfer throughput.
+
+Usage:
+    go run ./cmd/conn-bench -variant=scram=postgres://app_scram@db1/avro -variant=md5=postgres://app_md5@db1/avro
+    go run ./cmd/conn-bench -dsn=postgres://dbre@db1/avro -sslmodes=disable,require,verify-full -connects=500
+    go run ./cmd/conn-bench -variant=direct=... -variant=pgbouncer=... -transfer=8MB -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.ConnBench()
+}
@@ -0,0 +1,26 @@
+/*
+================================================================================
+CONNECTION SATURATION AND PER-ROLE CONNECTION REPORTER
+================================================================================
+
+Purpose: See "too many clients already" coming, and which app is leaking
+
+Tracks client connections by state, role, database, application_name and
+client address against max_connections and CONNECTION LIMITs over time,
+flags long-idle connection groups and apps that only grow, and projects when
+the limit will be hit.
+
+Usage:
+    go run ./cmd/conns -interval=30s -leak-idle=1h
+    go run ./cmd/conns -once -top=20
+    go run ./cmd/conns -max-pct=80 -within=2h -metrics-addr=:9191
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Conns()
+}
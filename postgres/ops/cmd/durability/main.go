@@ -0,0 +1,26 @@
+/*
+================================================================================
+DURABILITY VS LATENCY
+================================================================================
+
+Purpose: Put numbers on the synchronous_commit trade-off
+
+Runs the same write workload under synchronous_commit off, local,
+remote_write and remote_apply (with a synchronous standby) and compares
+commit latency percentiles and throughput; with -crash-command, also crashes
+the server under load and counts the acknowledged commits each level lost.
+
+Usage:
+    go run ./cmd/durability -dsn=postgres://dbre@db1/avro -duration=1m -sessions=16
+    go run ./cmd/durability -levels=off,local -crash-command="docker restart -t 0 pg-scratch"
+    go run ./cmd/durability -format=json > durability.json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Durability()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+AUTO_EXPLAIN LOG PARSER AND PLAN-REGRESSION ANALYZER
+================================================================================
+
+Purpose: Find the queries that switched plans, and their slowest plans, in a
+window of server log
+
+Parses auto_explain entries (text and JSON log_format) from stderr or jsonlog
+server logs, hashes each plan with the same structure hasher as the stress
+tool's plan monitor, and reports plan changes and the slowest plans per query
+fingerprint.
+
+Usage:
+    go run ./cmd/explainlog /var/log/postgresql/postgresql-*.log
+    go run ./cmd/explainlog -since=24h -regress=3 -db=avro postgresql.log.1.gz
+    zcat postgresql.log.*.gz | go run ./cmd/explainlog -format=json - > plans.json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.ExplainLog()
+}
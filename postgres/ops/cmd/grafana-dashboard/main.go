@@ -0,0 +1,27 @@
+/*
+================================================================================
+GRAFANA DASHBOARD GENERATOR
+================================================================================
+
+Purpose: Give every cluster the same dashboards for the metrics the tools serve
+
+Writes importable Grafana dashboard JSON with a row per metrics source
+(workload simulator, bulk loader, waltrack, replag, slots, conns, logscan):
+per-query latency, throughput, pool gauges, WAL rate, lag and connections
+panels. With -from it keeps only what the given /metrics endpoints serve and
+graphs anything new.
+
+Usage:
+    go run ./cmd/grafana-dashboard > dbre.json
+    go run ./cmd/grafana-dashboard -from=http://db1:9108/metrics -from=http://mon1:9187/metrics -out=db1.json
+    go run ./cmd/grafana-dashboard -sections=conns,replag -title="avro primary" -uid=avro-db
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.GrafanaDashboard()
+}
@@ -0,0 +1,26 @@
+/*
+================================================================================
+ONE-SHOT CLUSTER HEALTH CHECK
+================================================================================
+
+Purpose: Grade a cluster's health in one run, for triage or before maintenance
+
+Checks bloat, invalid and droppable indexes, long transactions, replication
+lag, wraparound age, connection saturation and risky settings, prints each
+finding with its severity and a score per check and for the cluster, and
+exits with the Nagios status of the worst finding.
+
+Usage:
+    go run ./cmd/healthcheck
+    go run ./cmd/healthcheck -checks=bloat,indexes -min-size=1GB
+    go run ./cmd/healthcheck -skip=settings -conn-warning=70 -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Healthcheck()
+}
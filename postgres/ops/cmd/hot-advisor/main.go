@@ -0,0 +1,27 @@
+/*
+================================================================================
+HOT UPDATE RATIO AND FILLFACTOR ADVISOR
+================================================================================
+
+Purpose: Find why updates miss HOT and what would fix it
+
+Compares each table's HOT update ratio with the columns its UPDATE
+statements set (from pg_stat_statements or a file) and the columns its
+indexes reference, and recommends fillfactor settings and index drops.
+Read-only.
+
+Usage:
+    go run ./cmd/hot-advisor                          # PG* environment
+    go run ./cmd/hot-advisor -dsn=postgres://dbre@db1/avro -replica-dsn=postgres://dbre@db2/avro
+    go run ./cmd/hot-advisor -workload=updates.sql -min-updates=10000
+    go run ./cmd/hot-advisor -schema=public -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.HOTAdvisor()
+}
@@ -0,0 +1,26 @@
+/*
+================================================================================
+UNUSED AND REDUNDANT INDEX REPORTER
+================================================================================
+
+Purpose: Find indexes that cost writes and space without serving queries
+
+Reports invalid, duplicate, prefix-redundant and never-scanned indexes with
+the space and index writes dropping them would save, and the DROP INDEX
+CONCURRENTLY statements. Read-only.
+
+Usage:
+    go run ./cmd/index-audit                          # PG* environment
+    go run ./cmd/index-audit -dsn=postgres://dbre@db1/avro -replica-dsn=postgres://dbre@db2/avro
+    go run ./cmd/index-audit -schema=public -min-size=10MB
+    go run ./cmd/index-audit -min-stats-age=720h -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.IndexAudit()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+LOCK AND BLOCKING-TREE MONITOR
+================================================================================
+
+Purpose: Show who blocks whom, and for how long, during a lock pile-up
+
+Samples pg_stat_activity and pg_locks, prints blocker→blocked trees with wait
+durations and query text, exports them as JSON, and can cancel or terminate
+root blockers past a threshold.
+
+Usage:
+    go run ./cmd/locks                                # one sample
+    go run ./cmd/locks -interval=5s -min-wait=10s     # watch
+    go run ./cmd/locks -interval=5s -format=json >> locks.ndjson
+    go run ./cmd/locks -interval=5s -cancel-after=2m -dry-run
+    go run ./cmd/locks -interval=5s -cancel-after=2m -terminate -protect-user=replicator
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Locks()
+}
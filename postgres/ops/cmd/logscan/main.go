@@ -0,0 +1,26 @@
+/*
+================================================================================
+CSVLOG INGESTER: ERRORS, SLOW QUERIES, LOCK WAITS, CONNECTION CHURN
+================================================================================
+
+Purpose: pgBadger-lite for the Go toolbox - what the server log says about
+errors, slow queries, lock waits and connections
+
+Batch-parses csvlog files (plain or .gz) into a summary report, or follows the
+newest file of a log directory across rotations and serves the counts as
+Prometheus metrics (dbre_logscan_*).
+
+Usage:
+    go run ./cmd/logscan /var/log/postgresql/postgresql-2026-10-1*.csv
+    go run ./cmd/logscan -slow=500ms -top=20 -format=json postgresql.csv.gz
+    go run ./cmd/logscan -follow='/var/log/postgresql/*.csv' -metrics-addr=:9192
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.LogScan()
+}
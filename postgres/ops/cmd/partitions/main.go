@@ -0,0 +1,26 @@
+/*
+================================================================================
+PARTITION LIFECYCLE
+================================================================================
+
+Purpose: Keep time-range partitioned tables ahead of inserts and within retention
+
+Driven by a YAML policy per table: pre-creates the partitions of the coming
+intervals, detaches or drops partitions past retention, and moves old
+partitions to a slower tablespace. Dry run unless -apply; DDL runs with
+lock_timeout.
+
+Usage:
+    go run ./cmd/partitions -config=partitions.example.yaml          # dry run
+    go run ./cmd/partitions -config=partitions.yaml -apply
+    go run ./cmd/partitions -config=partitions.yaml -table=public.events -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Partitions()
+}
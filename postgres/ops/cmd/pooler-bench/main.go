@@ -0,0 +1,27 @@
+/*
+================================================================================
+CONNECTION POOLER COMPARISON
+================================================================================
+
+Purpose: Choose a pooler (and its mode) from measurements, not folklore
+
+Runs the same workload directly against Postgres and through PgBouncer
+(session and transaction modes) or pgcat, comparing connection cost,
+latency and the throughput ceiling over a ramp of client counts.
+
+Usage:
+    go run ./cmd/pooler-bench -dsn=postgres://dbre@db1:5432/avro \
+        -target=direct=postgres://app@db1:5432/avro \
+        -target=pgbouncer-tx=postgres://app@db1:6432/avro \
+        -target=pgcat=postgres://app@db1:6434/avro
+    go run ./cmd/pooler-bench -target=... -clients=50,200,800 -query="SELECT * FROM orders WHERE id = 42"
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.PoolerBench()
+}
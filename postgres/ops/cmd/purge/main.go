@@ -0,0 +1,26 @@
+/*
+================================================================================
+BATCHED DELETE AND ARCHIVAL
+================================================================================
+
+Purpose: Remove old rows without long locks, WAL bursts or replica lag
+
+Deletes (or copies to an archive table, then deletes) the rows matching a
+condition in small keyset batches with pauses, waits for lagging replicas,
+vacuums as it goes, and reports rows removed, WAL generated and peak lag.
+Dry run unless -apply.
+
+Usage:
+    go run ./cmd/purge -table=events -where="created_at < now() - interval '90 days'"
+    go run ./cmd/purge -table=events -where="created_at < now() - interval '90 days'" -apply
+    go run ./cmd/purge -table=audit_log -where="logged_at < '2026-01-01'" -archive-table=archive.audit_log -max-duration=2h -apply
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Purge()
+}
@@ -0,0 +1,26 @@
+/*
+================================================================================
+REINDEX CONCURRENTLY ORCHESTRATION
+================================================================================
+
+Purpose: Rebuild a list of bloated indexes without blocking writes
+
+Runs REINDEX INDEX CONCURRENTLY over the given indexes a few at a time (one
+per table), cancelling rebuilds stuck on lock waits, checking for INVALID
+_ccnew/_ccold leftovers and starting nothing during the pause window. Reports
+the size before and after for each index.
+
+Usage:
+    go run ./cmd/reindex -table=public.events -table=public.orders
+    go run ./cmd/reindex -file=bloated.txt -parallel=3 -pause-hours=08:00-18:00 -apply
+    go run ./cmd/reindex -index=public.events_created_at_idx -max-wait=5m -drop-invalid -apply -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Reindex()
+}
@@ -0,0 +1,25 @@
+/*
+================================================================================
+REPLICATION LAG MONITOR
+================================================================================
+
+Purpose: Watch replication lag on a cluster and alert before reads go stale
+
+Polls pg_stat_replication on the primary and replay lag on each replica,
+serves Prometheus metrics, and alerts on byte or time thresholds.
+
+Usage:
+    go run ./cmd/replag -dsn=postgres://dbre@db1/postgres \
+        -replica-dsn=postgres://dbre@db2/postgres -replica-dsn=postgres://dbre@db3/postgres
+    go run ./cmd/replag -max-lag-bytes=512MB -max-lag=30s -alert-webhook=https://hooks.slack.com/services/...
+    go run ./cmd/replag -once                          # check and exit (status 2 over a threshold)
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Replag()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+SEQUENCE EXHAUSTION CHECK
+================================================================================
+
+Purpose: Catch serial/identity keys before they run out of values
+
+Reports each sequence's consumption against the narrowest of its own limit
+and the integer columns it feeds (int4 keys on bigint sequences included),
+with the consumption rate and projected exhaustion date. Nagios exit codes;
+read-only.
+
+Usage:
+    go run ./cmd/sequences                            # PG* environment
+    go run ./cmd/sequences -dsn=postgres://dbre@db1/avro -sample=1m
+    go run ./cmd/sequences -state-file=/var/tmp/sequences.db1.json -warning=40 -critical=70
+    go run ./cmd/sequences -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Sequences()
+}
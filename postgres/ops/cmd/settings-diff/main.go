@@ -0,0 +1,26 @@
+/*
+================================================================================
+CONFIGURATION DRIFT
+================================================================================
+
+Purpose: Find settings that differ between two snapshots or two clusters
+
+Compares settings and per-database/per-role overrides from snapshot files,
+the results database or live clusters, marking non-default values and
+settings waiting for a restart. Exit code 2 when there is drift.
+
+Usage:
+    go run ./cmd/settings-diff -from=now              # non-default settings
+    go run ./cmd/settings-diff -from=now -to=dsn:postgres://dbre@db2/avro
+    go run ./cmd/settings-diff -from=db1-2026-10-01.json -to=now -ignore=port
+    go run ./cmd/settings-diff -results-dsn=postgres://dbre@results/dbre -from=db:db1@20261001 -to=db:db1
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.SettingsDiff()
+}
@@ -0,0 +1,25 @@
+/*
+================================================================================
+CONFIGURATION SNAPSHOT
+================================================================================
+
+Purpose: Record a cluster's configuration for later drift checks
+
+Saves every pg_settings entry (value, unit, source, default, pending_restart)
+and the ALTER DATABASE/ROLE ... SET overrides to a JSON file and/or a table
+in a results database. Compare snapshots with settings-diff. Read-only.
+
+Usage:
+    go run ./cmd/settings-snapshot                    # PG* environment, JSON to stdout
+    go run ./cmd/settings-snapshot -out=db1-$(date +%F).json
+    go run ./cmd/settings-snapshot -results-dsn=postgres://dbre@results/dbre -label=db1
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.SettingsSnapshot()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+REPLICATION SLOT WATCHDOG
+================================================================================
+
+Purpose: Catch slots that retain WAL before pg_wal fills the disk
+
+Polls pg_replication_slots for retained WAL, inactive slots and wal_status,
+projects when the WAL volume fills, serves Prometheus metrics and alerts.
+Slots matching a drop policy are dropped only after operator approval.
+
+Usage:
+    go run ./cmd/slots -wal-dir=/var/lib/postgresql/16/main/pg_wal   # on the database host
+    go run ./cmd/slots -disk-size=500GB -max-retained=50GB -max-inactive=30m
+    go run ./cmd/slots -once                                          # check and exit (status 2 on alerts)
+    go run ./cmd/slots -once -drop-after=24h -drop-pattern='^debezium_test_'
+    go run ./cmd/slots -drop-after=24h -drop-pattern='^debezium_test_' -approve-file=/etc/dbre/drop-slots
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Slots()
+}
@@ -0,0 +1,26 @@
+/*
+================================================================================
+READ-AFTER-WRITE CONSISTENCY CHECK
+================================================================================
+
+Purpose: Measure how stale reads from replicas are right after a write
+
+Commits marker rows on the primary and reads each back from every replica
+at once, reporting the share of stale first reads, the staleness
+distribution and markers that never become visible.
+
+Usage:
+    go run ./cmd/stale-reads -dsn=postgres://dbre@db1/avro \
+        -replica-dsn=postgres://dbre@db2/avro -replica-dsn=postgres://dbre@db3/avro
+    go run ./cmd/stale-reads -replica-dsn=postgres://dbre@db2/avro -rate=50 -duration=10m -max-staleness=200ms
+    go run ./cmd/stale-reads -replica-dsn=postgres://dbre@db2/avro -format=json   # one line per interval
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.StaleReads()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+TOAST USAGE AND COMPRESSION ANALYZER
+================================================================================
+
+Purpose: Find wide columns that would be cheaper with lz4 or EXTERNAL storage
+
+Reports TOAST relation sizes and reads per table and, from a sample of rows,
+each variable-width column's stored and raw width, compression ratio and
+method, with the ALTER TABLE statements for the columns worth changing.
+Reads a sample of each table; changes nothing.
+
+Usage:
+    go run ./cmd/toast-audit                          # PG* environment
+    go run ./cmd/toast-audit -dsn=postgres://dbre@db1/avro -min-size=1GB
+    go run ./cmd/toast-audit -schema=public -sample-rows=20000
+    go run ./cmd/toast-audit -sample-rows=0 -format=json     # catalogs and pg_stats only
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.ToastAudit()
+}
@@ -0,0 +1,26 @@
+/*
+================================================================================
+PG_STAT_STATEMENTS TOP QUERIES WITH PERIOD DIFFS
+================================================================================
+
+Purpose: Replace the ad-hoc pg_stat_statements SQL each on-call shift reruns
+
+Stores snapshots of pg_stat_statements and diffs any two of them: new heavy
+hitters, regressed mean times and increased temp usage.
+
+Usage:
+    go run ./cmd/topqueries -mode=snapshot -dir=/var/lib/dbre/topqueries -keep=336   # hourly from cron
+    go run ./cmd/topqueries -mode=list -dir=/var/lib/dbre/topqueries
+    go run ./cmd/topqueries -mode=diff -dir=/var/lib/dbre/topqueries                 # two newest snapshots
+    go run ./cmd/topqueries -mode=diff -from=20261016T09 -to=now -regress=2
+    go run ./cmd/topqueries -mode=top -top=25 -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.TopQueries()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+PG_UPGRADE REHEARSAL HARNESS
+================================================================================
+
+Purpose: Know before the maintenance window how long pg_upgrade takes and
+which queries change plans or slow down on the new major version
+
+Clones the cluster (or restores a backup) into a scratch instance, replays a
+captured read workload on the current version, runs pg_upgrade --link to the
+target version, re-runs ANALYZE, replays the workload again, and diffs plan
+hashes and latencies per query fingerprint. Exit code 2 when the upgrade
+failed or a query regressed.
+
+Usage:
+    go run ./cmd/upgrade-drill -config=upgrade-drill.example.yaml
+    go run ./cmd/upgrade-drill -config=drill.yaml -regress=2 -format=json > drill-16-17.json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.UpgradeDrill()
+}
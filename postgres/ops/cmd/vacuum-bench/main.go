@@ -0,0 +1,25 @@
+/*
+================================================================================
+VACUUM STRATEGY BENCHMARK
+================================================================================
+
+Purpose: Choose between VACUUM, VACUUM (FREEZE), VACUUM FULL and pg_repack
+
+Copies a table, bloats each copy the same way and runs one remediation
+strategy per copy, reporting duration, locks taken, WAL generated, space
+reclaimed and how long reads were blocked. The source table is only read.
+
+Usage:
+    go run ./cmd/vacuum-bench -table=events
+    go run ./cmd/vacuum-bench -table=events -rows=5000000 -bloat=0.3 -bloat-mode=update
+    go run ./cmd/vacuum-bench -table=events -strategies=vacuum,full,repack -format=json
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.VacuumBench()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+WAL GENERATION RATE AND ARCHIVE HEALTH MONITOR
+================================================================================
+
+Purpose: Show how fast WAL is generated, whether archiving keeps up, and which
+workload run caused a spike
+
+Samples pg_current_wal_lsn() and pg_stat_archiver every interval: MB/min of
+WAL, archive failures and archive lag, tagged with the application_name
+(e.g. "bulk_loader run_id=7f3a") of the sessions active at the time. At the
+end it attributes WAL to each tag and run report.
+
+Usage:
+    go run ./cmd/waltrack -interval=30s
+    go run ./cmd/waltrack -duration=2h -runs='/var/log/stress/*.json'
+    go run ./cmd/waltrack -max-archive-lag=4GB -max-rate=2GB -metrics-addr=:9190
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Waltrack()
+}
@@ -0,0 +1,27 @@
+/*
+================================================================================
+XID WRAPAROUND AND FREEZE-AGE CHECK
+================================================================================
+
+Purpose: Know how far each database is from XID wraparound, and how soon
+
+Reports datfrozenxid/relfrozenxid ages, tables nearing
+autovacuum_freeze_max_age, what holds back the oldest XID, and the projected
+time to wraparound from the measured XID rate. Exits 0/1/2/3
+(OK/WARNING/CRITICAL/UNKNOWN) for cron and alerting.
+
+Usage:
+    go run ./cmd/wraparound
+    go run ./cmd/wraparound -state-file=/var/tmp/wraparound.db1.json   # rate since the last run
+    go run ./cmd/wraparound -warning=40 -critical=60 -critical-within=72h
+    go run ./cmd/wraparound -format=json -top=25
+================================================================================
+*/
+
+package main
+
+import "github.com/sjksingh/dbre-knowledge-base/postgres/ops/dbre"
+
+func main() {
+	dbre.Wraparound()
+}
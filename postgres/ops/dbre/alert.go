@@ -0,0 +1,102 @@
+package dbre
+
+// ============================================================================
+// ALERTS (-alert-webhook)
+// ============================================================================
+//
+// The daemons raise an alert when a check crosses its threshold and
+// resolve it when it's back under, instead of repeating it on every poll:
+//   2026-10-17 03:12:09 🔥 ALERT replay lag of db2 is 1.4 GiB (limit 1.0 GiB)
+//   2026-10-17 03:20:41 ✅ RESOLVED replay lag of db2 is 12 KiB
+// Alerts go to stderr and, with -alert-webhook, are POSTed as JSON:
+//   {"text": "...", "key": "replag:db2", "status": "firing"|"resolved"}
+// which is what a Slack or Mattermost incoming webhook expects (they read
+// "text"). An alert still firing is sent again every -alert-repeat.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// alerter tracks which alerts fire and sends their transitions.
+type alerter struct {
+	webhook string
+	repeat  time.Duration
+
+	mu     sync.Mutex
+	firing map[string]time.Time // Key → last sent
+}
+
+// registerAlertFlags adds -alert-webhook and -alert-repeat to a.
+func registerAlertFlags(a *alerter) {
+	flag.StringVar(&a.webhook, "alert-webhook", "", "POST alerts as JSON to this URL (Slack/Mattermost incoming webhook)")
+	flag.DurationVar(&a.repeat, "alert-repeat", 30*time.Minute, "Send a still-firing alert again after this long (0: never)")
+}
+
+// update raises or resolves the alert key; message says why.
+func (a *alerter) update(key string, firing bool, message string) {
+	a.mu.Lock()
+	if a.firing == nil {
+		a.firing = make(map[string]time.Time)
+	}
+	sent, was := a.firing[key]
+	status := ""
+	switch {
+	case firing && (!was || a.repeat > 0 && time.Since(sent) >= a.repeat):
+		status = "firing"
+		a.firing[key] = time.Now()
+	case !firing && was:
+		status = "resolved"
+		delete(a.firing, key)
+	}
+	a.mu.Unlock()
+	if status != "" {
+		a.send(key, status, message)
+	}
+}
+
+// active reports whether any alert is firing.
+func (a *alerter) active() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.firing) > 0
+}
+
+// send writes one transition to stderr and the webhook.
+func (a *alerter) send(key, status, message string) {
+	label := "🔥 ALERT"
+	if status == "resolved" {
+		label = "✅ RESOLVED"
+	}
+	text := fmt.Sprintf("%s %s", label, message)
+	fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format("2006-01-02 15:04:05"), text)
+	if a.webhook == "" {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]string{"text": text, "key": key, "status": status})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhook, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "      ⚠️  Alert webhook: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "      ⚠️  Alert webhook: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "      ⚠️  Alert webhook: %s\n", resp.Status)
+	}
+}
@@ -0,0 +1,443 @@
+package dbre
+
+// ============================================================================
+// AUTOVACUUM ACTIVITY TRACKER (cmd/autovac)
+// ============================================================================
+//
+// "Is autovacuum keeping up?" needs watching over time, not one query.
+// autovac samples every -interval for -duration (or until Ctrl-C):
+//   pg_stat_progress_vacuum   every running vacuum: table, phase, heap
+//                             blocks scanned, index passes, and whether it
+//                             is asleep in the cost delay (wait_event
+//                             VacuumDelay, PostgreSQL 14+)
+//   pg_stat_user_tables       dead tuples and vacuum counts per table,
+//                             against the table's autovacuum trigger point
+//                             (threshold + scale_factor * reltuples,
+//                             honouring per-table reloptions)
+// and then reports:
+//   vacuums       how long each took (≥ when it started before or ended
+//                 after the window), its heap scan rate, index passes and
+//                 the share of its samples spent in the cost delay
+//   falling behind tables over their trigger point that autovacuum didn't
+//                 finish during the window, or whose dead tuples grew
+//   bottleneck    "cost limit" when vacuums spend most samples in the cost
+//                 delay (raise autovacuum_vacuum_cost_limit or lower
+//                 autovacuum_vacuum_cost_delay), "workers" when all
+//                 autovacuum_max_workers are busy most of the time (raise
+//                 it, or per-table thresholds for the busy tables), and the
+//                 I/O budget the cost settings allow
+// -format=json writes the same for a dashboard or a ticket.
+//
+//   go run ./cmd/autovac -duration=30m -interval=10s
+//   go run ./cmd/autovac -duration=2h -schema=public -format=json > autovac.json
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// vacuumSettings are the server's autovacuum settings.
+type vacuumSettings struct {
+	MaxWorkers     int     `json:"autovacuum_max_workers"`
+	Threshold      float64 `json:"autovacuum_vacuum_threshold"`
+	ScaleFactor    float64 `json:"autovacuum_vacuum_scale_factor"`
+	CostLimit      int     `json:"cost_limit"`
+	CostDelayMS    float64 `json:"cost_delay_ms"`
+	PageDirtyCost  int     `json:"vacuum_cost_page_dirty"`
+	BlockSizeBytes int     `json:"block_size"`
+}
+
+// dirtyBudget is the most bytes per second all autovacuum workers together
+// may dirty under the cost limit.
+func (s vacuumSettings) dirtyBudget() float64 {
+	if s.CostDelayMS <= 0 || s.PageDirtyCost <= 0 {
+		return 0
+	}
+	pages := float64(s.CostLimit) / float64(s.PageDirtyCost) / (s.CostDelayMS / 1000)
+	return pages * float64(s.BlockSizeBytes)
+}
+
+// readVacuumSettings reads the settings, resolving the -1 defaults.
+func readVacuumSettings(ctx context.Context, pool *pgxpool.Pool) (vacuumSettings, error) {
+	var s vacuumSettings
+	err := pool.QueryRow(ctx, `
+		SELECT current_setting('autovacuum_max_workers')::int,
+		       current_setting('autovacuum_vacuum_threshold')::float8,
+		       current_setting('autovacuum_vacuum_scale_factor')::float8,
+		       CASE WHEN current_setting('autovacuum_vacuum_cost_limit')::int = -1
+		            THEN current_setting('vacuum_cost_limit')::int
+		            ELSE current_setting('autovacuum_vacuum_cost_limit')::int END,
+		       CASE WHEN (SELECT setting FROM pg_settings WHERE name = 'autovacuum_vacuum_cost_delay')::float8 = -1
+		            THEN (SELECT setting FROM pg_settings WHERE name = 'vacuum_cost_delay')::float8
+		            ELSE (SELECT setting FROM pg_settings WHERE name = 'autovacuum_vacuum_cost_delay')::float8 END,
+		       current_setting('vacuum_cost_page_dirty')::int,
+		       current_setting('block_size')::int
+	`).Scan(&s.MaxWorkers, &s.Threshold, &s.ScaleFactor, &s.CostLimit, &s.CostDelayMS, &s.PageDirtyCost, &s.BlockSizeBytes)
+	if err != nil {
+		return s, fmt.Errorf("failed to read autovacuum settings: %w", err)
+	}
+	return s, nil
+}
+
+// observedVacuum is one vacuum seen running during the window.
+type observedVacuum struct {
+	PID          int       `json:"pid"`
+	Table        string    `json:"table"`
+	Auto         bool      `json:"autovacuum"`
+	Wraparound   bool      `json:"wraparound"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	Finished     bool      `json:"finished"`
+	RunningFrom  bool      `json:"running_at_start"`
+	Phase        string    `json:"last_phase"`
+	HeapBlocks   int64     `json:"heap_blks_total"`
+	StartScanned int64     `json:"-"`
+	Scanned      int64     `json:"heap_blks_scanned"`
+	IndexPasses  int64     `json:"index_vacuum_count"`
+	Samples      int       `json:"samples"`
+	DelaySamples int       `json:"cost_delay_samples"`
+}
+
+// delayShare is the fraction of samples the vacuum slept in the cost
+// delay.
+func (v *observedVacuum) delayShare() float64 {
+	if v.Samples == 0 {
+		return 0
+	}
+	return float64(v.DelaySamples) / float64(v.Samples)
+}
+
+// scanRate is heap bytes scanned per second while observed.
+func (v *observedVacuum) scanRate(blockSize int) float64 {
+	d := v.LastSeen.Sub(v.FirstSeen).Seconds()
+	if d <= 0 {
+		return 0
+	}
+	return float64(v.Scanned-v.StartScanned) * float64(blockSize) / d
+}
+
+// tableVacuumState is a table's dead tuples against its trigger point.
+type tableVacuumState struct {
+	Table        string     `json:"table"`
+	Dead         int64      `json:"n_dead_tup"`
+	StartDead    int64      `json:"n_dead_tup_at_start"`
+	TriggerPoint float64    `json:"trigger_point"`
+	Vacuums      int64      `json:"autovacuums_in_window"`
+	LastVacuum   *time.Time `json:"last_autovacuum"`
+	Disabled     bool       `json:"autovacuum_disabled,omitempty"`
+
+	count int64
+}
+
+// over is dead tuples as a multiple of the trigger point.
+func (t *tableVacuumState) over() float64 {
+	return float64(t.Dead) / max(t.TriggerPoint, 1)
+}
+
+// readTableVacuumState reads dead tuples and trigger points of every table.
+func readTableVacuumState(ctx context.Context, pool *pgxpool.Pool, settings vacuumSettings, schema string) (map[string]*tableVacuumState, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT format('%I.%I', s.schemaname, s.relname), s.n_dead_tup, s.autovacuum_count, s.last_autovacuum,
+		       greatest(c.reltuples, 0)::float8, coalesce(c.reloptions, '{}')
+		FROM pg_stat_user_tables s
+		JOIN pg_class c ON c.oid = s.relid
+		WHERE $1 = '' OR s.schemaname = $1
+	`, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_stat_user_tables: %w", err)
+	}
+	tables := map[string]*tableVacuumState{}
+	var t tableVacuumState
+	var reltuples float64
+	var reloptions []string
+	_, err = pgx.ForEachRow(rows, []any{&t.Table, &t.Dead, &t.count, &t.LastVacuum, &reltuples, &reloptions}, func() error {
+		threshold, scale := settings.Threshold, settings.ScaleFactor
+		state := t
+		if t.LastVacuum != nil {
+			last := *t.LastVacuum
+			state.LastVacuum = &last
+		}
+		for _, opt := range reloptions {
+			name, value, _ := strings.Cut(opt, "=")
+			f, _ := strconv.ParseFloat(value, 64)
+			switch name {
+			case "autovacuum_vacuum_threshold":
+				threshold = f
+			case "autovacuum_vacuum_scale_factor":
+				scale = f
+			case "autovacuum_enabled":
+				state.Disabled = value == "false" || value == "off"
+			}
+		}
+		state.TriggerPoint = threshold + scale*reltuples
+		tables[state.Table] = &state
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_stat_user_tables: %w", err)
+	}
+	return tables, nil
+}
+
+// vacuumTrack is what autovac collects during the window.
+type vacuumTrack struct {
+	Settings       vacuumSettings      `json:"settings"`
+	Start          time.Time           `json:"start"`
+	End            time.Time           `json:"end"`
+	Samples        int                 `json:"samples"`
+	SaturatedShare float64             `json:"workers_saturated_share"`
+	PeakWorkers    int                 `json:"peak_autovacuum_workers"`
+	DelayShare     float64             `json:"cost_delay_share"`
+	Bottleneck     string              `json:"bottleneck"`
+	Vacuums        []*observedVacuum   `json:"vacuums"`
+	Behind         []*tableVacuumState `json:"falling_behind"`
+
+	running   map[string]*observedVacuum
+	saturated int
+	tables    map[string]*tableVacuumState
+}
+
+// sample records the running vacuums once.
+func (t *vacuumTrack) sample(ctx context.Context, pool *pgxpool.Pool) error {
+	rows, err := pool.Query(ctx, `
+		SELECT p.pid, format('%I.%I', n.nspname, c.relname), p.phase, p.heap_blks_total, p.heap_blks_scanned,
+		       p.index_vacuum_count, coalesce(a.query, '') LIKE 'autovacuum:%',
+		       coalesce(a.query, '') LIKE '%(to prevent wraparound)%',
+		       coalesce(a.wait_event, '') = 'VacuumDelay'
+		FROM pg_stat_progress_vacuum p
+		JOIN pg_class c ON c.oid = p.relid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_stat_activity a ON a.pid = p.pid
+		WHERE p.datname = current_database()
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to read pg_stat_progress_vacuum: %w", err)
+	}
+	now := time.Now()
+	seen := map[string]bool{}
+	workers := 0
+	var v observedVacuum
+	var delayed bool
+	_, err = pgx.ForEachRow(rows, []any{&v.PID, &v.Table, &v.Phase, &v.HeapBlocks, &v.Scanned, &v.IndexPasses,
+		&v.Auto, &v.Wraparound, &delayed}, func() error {
+		key := fmt.Sprintf("%d/%s", v.PID, v.Table)
+		seen[key] = true
+		run := t.running[key]
+		if run == nil {
+			run = &observedVacuum{PID: v.PID, Table: v.Table, Auto: v.Auto, Wraparound: v.Wraparound,
+				FirstSeen: now, StartScanned: v.Scanned, RunningFrom: t.Samples == 0}
+			t.running[key] = run
+			t.Vacuums = append(t.Vacuums, run)
+		}
+		run.LastSeen, run.Phase, run.HeapBlocks, run.Scanned, run.IndexPasses = now, v.Phase, v.HeapBlocks, v.Scanned, v.IndexPasses
+		run.Samples++
+		if delayed {
+			run.DelaySamples++
+		}
+		if v.Auto {
+			workers++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read pg_stat_progress_vacuum: %w", err)
+	}
+	for key, run := range t.running {
+		if !seen[key] {
+			run.Finished = true
+			delete(t.running, key)
+		}
+	}
+	t.Samples++
+	t.PeakWorkers = max(t.PeakWorkers, workers)
+	if workers >= t.Settings.MaxWorkers {
+		t.saturated++
+	}
+	return nil
+}
+
+// finish compares the tables with the start of the window and decides the
+// bottleneck.
+func (t *vacuumTrack) finish(end map[string]*tableVacuumState) {
+	t.End = time.Now()
+	if t.Samples > 0 {
+		t.SaturatedShare = float64(t.saturated) / float64(t.Samples)
+	}
+	samples, delayed := 0, 0
+	for _, v := range t.Vacuums {
+		if v.Auto {
+			samples += v.Samples
+			delayed += v.DelaySamples
+		}
+	}
+	if samples > 0 {
+		t.DelayShare = float64(delayed) / float64(samples)
+	}
+
+	for name, table := range end {
+		if start := t.tables[name]; start != nil {
+			table.StartDead, table.Vacuums = start.Dead, table.count-start.count
+		} else {
+			table.StartDead = table.Dead
+		}
+		vacuuming := slices.ContainsFunc(t.Vacuums, func(v *observedVacuum) bool { return v.Table == name && !v.Finished })
+		if table.over() >= 1 && (table.Vacuums == 0 || table.Dead > table.StartDead) && !vacuuming {
+			t.Behind = append(t.Behind, table)
+		}
+	}
+	slices.SortFunc(t.Behind, func(a, b *tableVacuumState) int { return cmp.Compare(b.over(), a.over()) })
+
+	switch {
+	case t.DelayShare >= 0.5:
+		t.Bottleneck = "cost limit"
+	case t.SaturatedShare >= 0.5:
+		t.Bottleneck = "workers"
+	case len(t.Behind) > 0:
+		t.Bottleneck = "none seen (tables behind without throttled or saturated workers: check thresholds and long transactions)"
+	default:
+		t.Bottleneck = "none"
+	}
+}
+
+// printVacuumTrack writes the report for a person.
+func printVacuumTrack(t *vacuumTrack) {
+	s := t.Settings
+	fmt.Printf("\n🧹 Autovacuum over %v (%d samples)\n", t.End.Sub(t.Start).Round(time.Second), t.Samples)
+	fmt.Printf("   autovacuum_max_workers=%d  cost_limit=%d  cost_delay=%gms  → at most %s/s dirtied by all workers together\n",
+		s.MaxWorkers, s.CostLimit, s.CostDelayMS, formatBytes(int64(s.dirtyBudget())))
+	fmt.Printf("   Peak workers %d/%d, all busy in %.0f%% of samples; vacuums asleep in the cost delay %.0f%% of the time\n",
+		t.PeakWorkers, s.MaxWorkers, 100*t.SaturatedShare, 100*t.DelayShare)
+
+	if len(t.Vacuums) == 0 {
+		fmt.Println("\nNo vacuums ran during the window")
+	} else {
+		fmt.Printf("\n%-40s %-6s %10s %9s %12s %6s %6s  %s\n", "VACUUM", "KIND", "DURATION", "HEAP", "SCAN RATE", "INDEX", "DELAY", "STATE")
+		for _, v := range t.Vacuums {
+			kind := "manual"
+			if v.Auto {
+				kind = "auto"
+			}
+			if v.Wraparound {
+				kind += "/wrap"
+			}
+			d := v.LastSeen.Sub(v.FirstSeen).Round(time.Second).String()
+			if v.RunningFrom || !v.Finished {
+				d = "≥" + d
+			}
+			state := "finished"
+			if !v.Finished {
+				state = "running: " + v.Phase
+			}
+			fmt.Printf("%-40s %-6s %10s %9s %10s/s %6d %5.0f%%  %s\n", v.Table, kind, d,
+				formatBytes(v.HeapBlocks*int64(s.BlockSizeBytes)), formatBytes(int64(v.scanRate(s.BlockSizeBytes))),
+				v.IndexPasses, 100*v.delayShare(), state)
+		}
+	}
+
+	if len(t.Behind) == 0 {
+		fmt.Println("\n✅ No table over its trigger point was left behind")
+	} else {
+		fmt.Printf("\n%-40s %12s %12s %8s %8s  %s\n", "FALLING BEHIND", "DEAD TUPLES", "TRIGGER AT", "×", "VACUUMS", "LAST AUTOVACUUM")
+		for _, b := range t.Behind {
+			last := "never"
+			if b.LastVacuum != nil {
+				last = b.LastVacuum.Format("2006-01-02 15:04")
+			}
+			if b.Disabled {
+				last += " (autovacuum_enabled=off)"
+			}
+			fmt.Printf("%-40s %12d %12.0f %8.1f %8d  %s\n", b.Table, b.Dead, b.TriggerPoint, b.over(), b.Vacuums, last)
+		}
+	}
+
+	fmt.Printf("\nBottleneck: %s\n", t.Bottleneck)
+	switch t.Bottleneck {
+	case "cost limit":
+		fmt.Println("   Raise autovacuum_vacuum_cost_limit (shared by all workers) or lower autovacuum_vacuum_cost_delay")
+	case "workers":
+		fmt.Println("   Raise autovacuum_max_workers together with the cost limit, or give the busiest tables their own thresholds")
+	}
+}
+
+// Autovac runs the autovac command line tool.
+func Autovac() {
+	var dsn, schema, format string
+	var interval, duration time.Duration
+	registerDSNFlag(&dsn)
+	flag.DurationVar(&interval, "interval", 10*time.Second, "Sample interval")
+	flag.DurationVar(&duration, "duration", 15*time.Minute, "How long to watch (Ctrl-C reports early)")
+	flag.StringVar(&schema, "schema", "", "Only report tables of this schema (default: all)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if interval <= 0 || duration <= 0 {
+		log.Fatal("-interval and -duration must be positive")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "autovac", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	track := &vacuumTrack{Start: time.Now(), running: map[string]*observedVacuum{}}
+	if track.Settings, err = readVacuumSettings(ctx, pool); err != nil {
+		log.Fatal(err)
+	}
+	if track.tables, err = readTableVacuumState(ctx, pool, track.Settings, schema); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "🧹 Watching vacuums on %s for %v (Ctrl-C to report early)\n", describeTarget(pool.Config()), duration)
+
+	deadline := time.After(duration)
+sampling:
+	for {
+		if err := track.sample(ctx, pool); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Fatal(err)
+		}
+		select {
+		case <-ctx.Done():
+			break sampling
+		case <-deadline:
+			break sampling
+		case <-time.After(interval):
+		}
+	}
+
+	stop()
+	end, err := readTableVacuumState(context.Background(), pool, track.Settings, schema)
+	if err != nil {
+		log.Fatal(err)
+	}
+	track.finish(end)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(track); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printVacuumTrack(track)
+}
@@ -0,0 +1,348 @@
+package dbre
+
+// ============================================================================
+// BACKUP RESTORE VERIFICATION (cmd/backup-verify)
+// ============================================================================
+//
+// A backup is only as good as its last restore. backup-verify restores one
+// into a scratch instance on this host and proves it usable, step by step:
+//   prepare   empty <scratch.dir>/data (only a directory a dbre tool
+//             created itself is ever wiped; see scratch.go)
+//   restore   restore.command (pgBackRest, wal-g, ... with {data_dir} and
+//             {target_time} filled in), or the latest base backup under
+//             restore.backup_dir: a plain pg_basebackup copy or its tar
+//             format (base.tar[.gz|.lz4|.zst] and pg_wal.tar)
+//   configure recovery.signal, restore.restore_command and
+//             restore.target_time; port, socket in scratch.dir, no
+//             archiving, no replication, no TCP
+//   recover   start the scratch server and replay WAL until it promotes
+//   checks    sanity queries from the config: each compares its first
+//             value to equals, min/max, or the same query on source_dsn
+//             (row counts, checksums of closed periods); max_data_age
+//             fails a restore whose last transaction is older than that
+//             before the target time (or now)
+//   stop      stop the scratch server and remove its data directory, unless
+//             scratch.keep or -keep; postgres.log and restore.log stay
+// Each step is timed; the report gives the restore and replay durations,
+// the WAL replayed and the time the data was recovered to. Exit code 0 is
+// a pass, 2 a failed verification. Run it as the OS user that owns the
+// backups (pg_ctl refuses root), with bin_dir holding the server's major
+// version. See backup-verify.example.yaml for a complete configuration.
+//
+//   go run ./cmd/backup-verify -config=backup-verify.example.yaml
+//   go run ./cmd/backup-verify -config=verify.yaml -target-time="2026-10-16 23:00:00+00" -keep
+//   go run ./cmd/backup-verify -config=verify.yaml -format=json > restore-drill.json
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gopkg.in/yaml.v3"
+)
+
+// backupVerifyConfig is the -config file.
+type backupVerifyConfig struct {
+	Restore    restoreSpec   `yaml:"restore"`
+	Scratch    scratchSpec   `yaml:"scratch"`
+	SourceDSN  string        `yaml:"source_dsn,omitempty"`   // For checks with compare_source
+	MaxDataAge time.Duration `yaml:"max_data_age,omitempty"` // 0: not checked
+	Checks     []backupCheck `yaml:"checks"`
+}
+
+// backupCheck is a sanity query; its first column of the first row is
+// compared as text (equals) or as a number (min, max).
+type backupCheck struct {
+	Name          string   `yaml:"name"`
+	Database      string   `yaml:"database"`
+	SQL           string   `yaml:"sql"`
+	Equals        *string  `yaml:"equals,omitempty"`
+	Min           *float64 `yaml:"min,omitempty"`
+	Max           *float64 `yaml:"max,omitempty"`
+	CompareSource bool     `yaml:"compare_source,omitempty"`
+}
+
+// checkResult is the outcome of one check.
+type checkResult struct {
+	Name     string  `json:"name"`
+	Database string  `json:"database,omitempty"`
+	Value    string  `json:"value"`
+	Expected string  `json:"expected"`
+	Seconds  float64 `json:"seconds"`
+	Pass     bool    `json:"pass"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// backupVerifyReport is the result of a run.
+type backupVerifyReport struct {
+	Backup        string        `json:"backup"`
+	TargetTime    string        `json:"target_time,omitempty"`
+	StartedAt     time.Time     `json:"started_at"`
+	Steps         []verifyStep  `json:"steps"`
+	RecoveredTo   *time.Time    `json:"recovered_to,omitempty"` // Last replayed transaction
+	ReplayedBytes int64         `json:"replayed_bytes"`
+	Checks        []checkResult `json:"checks"`
+	Seconds       float64       `json:"seconds"`
+	Pass          bool          `json:"pass"`
+}
+
+// loadBackupVerifyConfig reads path and fills in the defaults.
+func loadBackupVerifyConfig(path string) (*backupVerifyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &backupVerifyConfig{Scratch: defaultScratchSpec()}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Scratch.Dir == "" {
+		return nil, fmt.Errorf("%s: scratch.dir is required", path)
+	}
+	if err := cfg.Restore.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, c := range cfg.Checks {
+		if c.Name == "" || c.SQL == "" {
+			return nil, fmt.Errorf("%s: check %d needs a name and sql", path, i+1)
+		}
+		if c.Equals == nil && c.Min == nil && c.Max == nil && !c.CompareSource {
+			return nil, fmt.Errorf("%s: check %q has nothing to compare (equals, min, max or compare_source)", path, c.Name)
+		}
+		if c.CompareSource && cfg.SourceDSN == "" {
+			return nil, fmt.Errorf("%s: check %q compares to the source but source_dsn is not set", path, c.Name)
+		}
+	}
+	return cfg, nil
+}
+
+// backupVerifier runs the steps.
+type backupVerifier struct {
+	cfg    *backupVerifyConfig
+	srv    *scratchServer
+	report backupVerifyReport
+}
+
+// firstValue runs sql and returns the first column of its first row as
+// text. The simple protocol returns every type as text.
+func firstValue(ctx context.Context, pool *pgxpool.Pool, sql string) (string, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Release()
+	results, err := conn.Conn().PgConn().Exec(ctx, sql).ReadAll()
+	if err != nil {
+		return "", err
+	}
+	for i := len(results) - 1; i >= 0; i-- {
+		if rows := results[i].Rows; len(rows) > 0 && len(rows[0]) > 0 {
+			if rows[0][0] == nil {
+				return "NULL", nil
+			}
+			return string(rows[0][0]), nil
+		}
+	}
+	return "", fmt.Errorf("the query returned no rows")
+}
+
+// runChecks runs the sanity queries against the scratch server.
+func (v *backupVerifier) runChecks(ctx context.Context) (string, error) {
+	pools := map[string]*pgxpool.Pool{}
+	defer func() {
+		for _, p := range pools {
+			p.Close()
+		}
+	}()
+	open := func(key, dsn string) (*pgxpool.Pool, error) {
+		if p := pools[key]; p != nil {
+			return p, nil
+		}
+		p, err := connect(ctx, dsn, "backup-verify", 1)
+		if err == nil {
+			pools[key] = p
+		}
+		return p, err
+	}
+
+	failed := 0
+	for _, c := range v.cfg.Checks {
+		start := time.Now()
+		res := checkResult{Name: c.Name, Database: c.Database}
+		err := func() error {
+			pool, err := open("scratch/"+c.Database, v.srv.dsn(c.Database))
+			if err != nil {
+				return err
+			}
+			if res.Value, err = firstValue(ctx, pool, c.SQL); err != nil {
+				return err
+			}
+			var expected []string
+			res.Pass = true
+			if c.Equals != nil {
+				expected = append(expected, "= "+*c.Equals)
+				res.Pass = res.Pass && res.Value == *c.Equals
+			}
+			if c.Min != nil || c.Max != nil {
+				n, err := strconv.ParseFloat(res.Value, 64)
+				if err != nil {
+					return fmt.Errorf("min/max need a number, got %q", res.Value)
+				}
+				if c.Min != nil {
+					expected = append(expected, fmt.Sprintf(">= %g", *c.Min))
+					res.Pass = res.Pass && n >= *c.Min
+				}
+				if c.Max != nil {
+					expected = append(expected, fmt.Sprintf("<= %g", *c.Max))
+					res.Pass = res.Pass && n <= *c.Max
+				}
+			}
+			if c.CompareSource {
+				source, err := open("source/"+c.Database, withDatabase(v.cfg.SourceDSN, c.Database))
+				if err != nil {
+					return fmt.Errorf("source: %w", err)
+				}
+				want, err := firstValue(ctx, source, c.SQL)
+				if err != nil {
+					return fmt.Errorf("source: %w", err)
+				}
+				expected = append(expected, "= "+want+" (source)")
+				res.Pass = res.Pass && res.Value == want
+			}
+			res.Expected = strings.Join(expected, ", ")
+			return nil
+		}()
+		if err != nil {
+			res.Pass, res.Error = false, err.Error()
+		}
+		res.Seconds = time.Since(start).Seconds()
+		if !res.Pass {
+			failed++
+		}
+		v.report.Checks = append(v.report.Checks, res)
+	}
+
+	if age := v.cfg.MaxDataAge; age > 0 {
+		res := checkResult{Name: "recovered data age", Expected: "<= " + age.String(), Value: "unknown"}
+		reference := v.report.StartedAt
+		if target := parseLogTime(v.cfg.Restore.TargetTime); !target.IsZero() {
+			reference = target
+		}
+		if to := v.srv.recoveredTo; to != nil {
+			lag := reference.Sub(*to)
+			res.Value = formatAge(lag)
+			res.Pass = lag <= age
+		}
+		if !res.Pass {
+			failed++
+		}
+		v.report.Checks = append(v.report.Checks, res)
+	}
+
+	if failed > 0 {
+		return "", fmt.Errorf("%d of %d checks failed", failed, len(v.report.Checks))
+	}
+	return fmt.Sprintf("%d checks passed", len(v.report.Checks)), nil
+}
+
+// printBackupVerifyReport writes the report for a person.
+func printBackupVerifyReport(r *backupVerifyReport) {
+	fmt.Printf("\n🗄️  BACKUP RESTORE VERIFICATION: %s\n", r.Backup)
+	if r.TargetTime != "" {
+		fmt.Printf("   Target time: %s\n", r.TargetTime)
+	}
+	fmt.Println(strings.Repeat("=", 80))
+	printSteps(r.Steps)
+	if r.RecoveredTo != nil {
+		fmt.Printf("\n   Recovered to %s", r.RecoveredTo.Format("2006-01-02 15:04:05 MST"))
+		if r.ReplayedBytes > 0 {
+			fmt.Printf(", %s of WAL replayed", formatBytes(r.ReplayedBytes))
+		}
+		fmt.Println()
+	}
+	if len(r.Checks) > 0 {
+		fmt.Printf("\n   %-4s %-30s %-12s %-24s %s\n", "", "CHECK", "DATABASE", "VALUE", "EXPECTED")
+		for _, c := range r.Checks {
+			mark := "✅"
+			if !c.Pass {
+				mark = "❌"
+			}
+			value := oneLine(c.Value, 24)
+			if c.Error != "" {
+				value = "error: " + c.Error
+			}
+			fmt.Printf("   %-3s %-30s %-12s %-24s %s\n", mark, c.Name, c.Database, value, c.Expected)
+		}
+	}
+	fmt.Println(strings.Repeat("=", 80))
+	if r.Pass {
+		fmt.Printf("✅ PASS in %s\n", formatStepTime(r.Seconds))
+	} else {
+		fmt.Printf("❌ FAIL after %s\n", formatStepTime(r.Seconds))
+	}
+}
+
+// BackupVerify runs the backup-verify command line tool.
+func BackupVerify() {
+	var configPath, targetTime, format string
+	var keep bool
+	flag.StringVar(&configPath, "config", "", "Configuration file (see backup-verify.example.yaml)")
+	flag.StringVar(&targetTime, "target-time", "", "Recover to this time (overrides restore.target_time)")
+	flag.BoolVar(&keep, "keep", false, "Keep the scratch data directory (overrides scratch.keep)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if configPath == "" {
+		log.Fatal("-config is required")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	cfg, err := loadBackupVerifyConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if targetTime != "" {
+		cfg.Restore.TargetTime = targetTime
+	}
+	cfg.Scratch.Keep = cfg.Scratch.Keep || keep
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	v := &backupVerifier{cfg: cfg, srv: newScratchServer(cfg.Restore, cfg.Scratch)}
+	v.report.TargetTime = cfg.Restore.TargetTime
+	v.report.StartedAt = time.Now()
+	step := func(name string, fn func() (string, error)) bool { return runStep(&v.report.Steps, name, fn) }
+	v.report.Pass = step("prepare", v.srv.prepare) &&
+		step("restore", func() (string, error) { return v.srv.restoreData(ctx) }) &&
+		step("configure", v.srv.configure) &&
+		step("recover", func() (string, error) { return v.srv.recoverWAL(ctx) }) &&
+		step("checks", func() (string, error) { return v.runChecks(ctx) })
+	if !step("stop", v.srv.cleanup) {
+		v.report.Pass = false
+	}
+	v.report.Backup, v.report.RecoveredTo, v.report.ReplayedBytes = v.srv.backup, v.srv.recoveredTo, v.srv.replayedBytes
+	v.report.Seconds = time.Since(v.report.StartedAt).Seconds()
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&v.report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printBackupVerifyReport(&v.report)
+	}
+	if !v.report.Pass {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,647 @@
+package dbre
+
+// ============================================================================
+// LOGICAL DECODING CONSUMER (cmd/cdc)
+// ============================================================================
+//
+// How much change traffic can logical decoding carry? cdc is a minimal CDC
+// consumer: it creates a replication slot, streams the changes of -tables
+// through pgoutput or wal2json (see logrepl.go), and confirms each
+// transaction as soon as it's decoded (with -kafka-brokers: delivered, see
+// cdckafka.go). Run it while the bulk loader or the
+// read/write simulators generate traffic. Every -interval it prints:
+//   throughput  transactions, changes (insert/update/delete/truncate) and
+//               decoded plugin output per second
+//   lag         commit time to decoded, p50/p95/max over the transactions
+//               of the interval
+//   behind      WAL between the server's end of WAL and the last confirmed
+//               transaction: what the walsender still has to decode and send
+//   retained    WAL the slot holds back (pg_replication_slots restart_lsn);
+//               what a stalled consumer costs in pg_wal
+//
+// The summary gives the verdict for capacity planning: the consumer keeps
+// up when "behind" stays flat, and falls behind when it grows for the run
+// (its growth rate is how fast pg_wal fills while the load lasts). The
+// throughput of intervals that started with a backlog is the most this
+// consumer decoded: the capacity to plan against. Without a backlog the
+// capacity wasn't reached and the peak is only a lower bound.
+//
+// Commit times are the primary's clock and receive times this host's, so
+// lag includes the clock skew between them; run cdc on the database host,
+// or keep both on NTP and read lags under a few ms as noise.
+//
+// Requires wal_level=logical and the REPLICATION attribute. pgoutput reads
+// a publication: -publication is created FOR TABLE -tables (FOR ALL TABLES
+// without -tables) if it doesn't exist, and dropped at exit with the slot.
+// The slot is temporary unless -keep-slot, which creates it once and
+// resumes from its confirmed position on the next run; drop it when done
+// (SELECT pg_drop_replication_slot('dbre_cdc')), or it retains WAL forever.
+//
+//   go run ./cmd/cdc -tables=public.orders,public.order_items -duration=10m
+//   go run ./cmd/cdc -plugin=wal2json -tables=public.orders -interval=5s
+//   go run ./cmd/cdc -keep-slot -slot=cdc_capacity -format=json > cdc.ndjson
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cdcInterval is what was decoded between two reports.
+type cdcInterval struct {
+	Start         time.Time        `json:"start"`
+	End           time.Time        `json:"end"`
+	Transactions  int64            `json:"transactions"`
+	TxPerSec      float64          `json:"tx_per_sec"`
+	Changes       int64            `json:"changes"`
+	ChangesPerSec float64          `json:"changes_per_sec"`
+	Ops           map[string]int64 `json:"ops"`
+	Tables        map[string]int64 `json:"tables"`
+	Bytes         int64            `json:"decoded_bytes"`
+	BytesPerSec   float64          `json:"decoded_bytes_per_sec"`
+	LagP50        time.Duration    `json:"decode_lag_p50_ns"`
+	LagP95        time.Duration    `json:"decode_lag_p95_ns"`
+	LagMax        time.Duration    `json:"decode_lag_max_ns"`
+	BehindStart   int64            `json:"behind_start_bytes"`
+	Behind        int64            `json:"behind_bytes"`
+	RetainedBytes int64            `json:"slot_retained_bytes"`
+	Kafka         *kafkaInterval   `json:"kafka,omitempty"`
+	lags          []float64
+	backlogged    bool
+}
+
+// cdcTableStats is one table's changes over the run.
+type cdcTableStats struct {
+	Table   string           `json:"table"`
+	Changes int64            `json:"changes"`
+	Ops     map[string]int64 `json:"ops"`
+}
+
+// cdcSummary is the report for the whole run.
+type cdcSummary struct {
+	Plugin         string          `json:"plugin"`
+	Slot           string          `json:"slot"`
+	Start          time.Time       `json:"start"`
+	End            time.Time       `json:"end"`
+	StartLSN       string          `json:"start_lsn"`
+	ConfirmedLSN   string          `json:"confirmed_lsn"`
+	Transactions   int64           `json:"transactions"`
+	Changes        int64           `json:"changes"`
+	Bytes          int64           `json:"decoded_bytes"`
+	TxPerSec       float64         `json:"tx_per_sec"`
+	ChangesPerSec  float64         `json:"changes_per_sec"`
+	PeakChanges    float64         `json:"peak_changes_per_sec"`
+	LagP95Median   time.Duration   `json:"decode_lag_p95_median_ns"` // Median of the intervals' p95
+	LagMax         time.Duration   `json:"decode_lag_max_ns"`
+	MaxBehind      int64           `json:"max_behind_bytes"`
+	BehindGrowth   float64         `json:"behind_growth_bytes_per_sec"` // Slope over the run
+	MaxRetained    int64           `json:"max_slot_retained_bytes"`
+	Capacity       float64         `json:"capacity_changes_per_sec,omitempty"` // Throughput while backlogged
+	CapacityBytes  float64         `json:"capacity_decoded_bytes_per_sec,omitempty"`
+	FallingBehind  bool            `json:"falling_behind"`
+	Tables         []cdcTableStats `json:"tables"`
+	Kafka          *kafkaSummary   `json:"kafka,omitempty"`
+	intervalsCount int
+}
+
+// cdcBacklog is how far behind an interval must start to count as
+// backlogged: more than a few WAL pages in flight.
+const cdcBacklog = 1 << 20
+
+// cdcConsumer reads the stream and accumulates the intervals.
+type cdcConsumer struct {
+	rc        *replicationConn
+	decoder   changeDecoder
+	pool      *pgxpool.Pool
+	slot      string
+	decoded   uint64 // End of the last decoded transaction
+	serverEnd uint64 // Server's end of WAL, from the last message
+	cur       *cdcInterval
+	intervals []cdcInterval
+	tables    map[string]*cdcTableStats
+	sink      *kafkaSink // nil: decode only
+}
+
+func (c *cdcConsumer) behind() int64 {
+	if c.serverEnd > c.decoded && c.decoded > 0 {
+		return int64(c.serverEnd - c.decoded)
+	}
+	return 0
+}
+
+func (c *cdcConsumer) startInterval(now time.Time) {
+	c.cur = &cdcInterval{Start: now, Ops: map[string]int64{}, Tables: map[string]int64{}, BehindStart: c.behind()}
+	c.cur.backlogged = c.cur.BehindStart > cdcBacklog
+}
+
+// position is what may be confirmed to the slot: what was decoded, or
+// with a sink, what was delivered.
+func (c *cdcConsumer) position() (uint64, error) {
+	if c.sink == nil {
+		return c.decoded, nil
+	}
+	return c.sink.position(c.decoded)
+}
+
+// handle decodes one stream message, and hands a completed transaction to
+// the sink.
+func (c *cdcConsumer) handle(ctx context.Context, m *walMessage) error {
+	c.serverEnd = max(c.serverEnd, m.ServerEnd)
+	if m.Data == nil {
+		// A keepalive outside a transaction: everything up to the
+		// server's end was decoded (and filtered out), so it's confirmed.
+		if !c.decoder.pending() && m.ServerEnd > c.decoded {
+			c.decoded = m.ServerEnd
+		}
+		return nil
+	}
+	tx, done, err := c.decoder.decode(m.Data, m.Start)
+	if err != nil || !done {
+		return err
+	}
+	now := time.Now()
+	c.decoded = max(c.decoded, tx.EndLSN)
+	in := c.cur
+	in.Transactions++
+	in.Bytes += int64(tx.Bytes)
+	if !tx.CommitTime.IsZero() {
+		in.lags = append(in.lags, float64(max(0, now.Sub(tx.CommitTime))))
+	}
+	for _, ev := range tx.Changes {
+		name := ev.Schema + "." + ev.Table
+		in.Changes++
+		in.Ops[ev.Op]++
+		in.Tables[name]++
+		t := c.tables[name]
+		if t == nil {
+			t = &cdcTableStats{Table: name, Ops: map[string]int64{}}
+			c.tables[name] = t
+		}
+		t.Changes++
+		t.Ops[ev.Op]++
+	}
+	if c.sink != nil {
+		return c.sink.send(ctx, tx)
+	}
+	return nil
+}
+
+// endInterval closes the current interval with the slot's retained WAL.
+func (c *cdcConsumer) endInterval(ctx context.Context, now time.Time) *cdcInterval {
+	in := c.cur
+	in.End = now
+	in.Behind = c.behind()
+	err := c.pool.QueryRow(ctx, `
+		SELECT coalesce(pg_current_wal_lsn() - restart_lsn, 0)::bigint FROM pg_replication_slots WHERE slot_name = $1
+	`, c.slot).Scan(&in.RetainedBytes)
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Reading slot %s: %v\n", c.slot, err)
+	}
+	if d := in.End.Sub(in.Start).Seconds(); d > 0 {
+		in.TxPerSec = float64(in.Transactions) / d
+		in.ChangesPerSec = float64(in.Changes) / d
+		in.BytesPerSec = float64(in.Bytes) / d
+	}
+	if len(in.lags) > 0 {
+		sort.Float64s(in.lags)
+		in.LagP50 = time.Duration(percentile(in.lags, 0.5))
+		in.LagP95 = time.Duration(percentile(in.lags, 0.95))
+		in.LagMax = time.Duration(in.lags[len(in.lags)-1])
+	}
+	in.lags = nil
+	if c.sink != nil {
+		in.Kafka = c.sink.endInterval(c.decoded, in.End.Sub(in.Start).Seconds())
+	}
+	c.intervals = append(c.intervals, *in)
+	c.startInterval(now)
+	return &c.intervals[len(c.intervals)-1]
+}
+
+// run receives until ctx is done, confirming every statusInterval and
+// closing an interval every interval.
+func (c *cdcConsumer) run(ctx context.Context, interval, statusInterval time.Duration, report func(*cdcInterval)) error {
+	now := time.Now()
+	c.startInterval(now)
+	nextStatus, nextReport := now.Add(statusInterval), now.Add(interval)
+	for {
+		deadline := nextStatus
+		if nextReport.Before(deadline) {
+			deadline = nextReport
+		}
+		recvCtx, cancel := context.WithDeadline(ctx, deadline)
+		m, err := c.rc.receive(recvCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			if err := c.handle(ctx, m); err != nil {
+				return err
+			}
+		}
+		pos, err := c.position()
+		if err != nil {
+			return err
+		}
+		if c.sink != nil {
+			if err := c.sink.saveCheckpoint(pos, false); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		if (m != nil && m.ReplyRequested) || !now.Before(nextStatus) {
+			if err := c.rc.sendStatus(pos); err != nil {
+				return fmt.Errorf("failed to send status: %w", err)
+			}
+			nextStatus = now.Add(statusInterval)
+		}
+		if !now.Before(nextReport) {
+			report(c.endInterval(ctx, now))
+			nextReport = nextReport.Add(interval)
+			if nextReport.Before(now) {
+				nextReport = now.Add(interval)
+			}
+		}
+	}
+}
+
+// summarize totals the intervals and decides whether the consumer kept up.
+func (c *cdcConsumer) summarize(sum *cdcSummary) {
+	pos, _ := c.position()
+	sum.ConfirmedLSN = formatLSN(pos)
+	if c.sink != nil {
+		sum.Kafka = c.sink.summary()
+	}
+	sum.intervalsCount = len(c.intervals)
+	if len(c.intervals) == 0 {
+		return
+	}
+	sum.Start, sum.End = c.intervals[0].Start, c.intervals[len(c.intervals)-1].End
+	var p95s []float64
+	var backlogChanges, backlogBytes, backlogSecs float64
+	var n, sx, sy, sxy, sxx float64
+	for _, in := range c.intervals {
+		sum.Transactions += in.Transactions
+		sum.Changes += in.Changes
+		sum.Bytes += in.Bytes
+		sum.PeakChanges = max(sum.PeakChanges, in.ChangesPerSec)
+		sum.LagMax = max(sum.LagMax, in.LagMax)
+		sum.MaxBehind = max(sum.MaxBehind, in.Behind)
+		sum.MaxRetained = max(sum.MaxRetained, in.RetainedBytes)
+		if in.Transactions > 0 {
+			p95s = append(p95s, float64(in.LagP95))
+		}
+		if in.backlogged {
+			d := in.End.Sub(in.Start).Seconds()
+			backlogChanges += float64(in.Changes)
+			backlogBytes += float64(in.Bytes)
+			backlogSecs += d
+		}
+		// Least squares of behind over time.
+		x, y := in.End.Sub(sum.Start).Seconds(), float64(in.Behind)
+		n, sx, sy, sxy, sxx = n+1, sx+x, sy+y, sxy+x*y, sxx+x*x
+	}
+	if d := sum.End.Sub(sum.Start).Seconds(); d > 0 {
+		sum.TxPerSec = float64(sum.Transactions) / d
+		sum.ChangesPerSec = float64(sum.Changes) / d
+	}
+	if len(p95s) > 0 {
+		sort.Float64s(p95s)
+		sum.LagP95Median = time.Duration(percentile(p95s, 0.5))
+	}
+	if backlogSecs > 0 {
+		sum.Capacity = backlogChanges / backlogSecs
+		sum.CapacityBytes = backlogBytes / backlogSecs
+	}
+	if n >= 3 && n*sxx-sx*sx > 0 {
+		sum.BehindGrowth = (n*sxy - sx*sy) / (n*sxx - sx*sx)
+	}
+	// Falling behind: growing through the run and ending with a backlog.
+	last := c.intervals[len(c.intervals)-1]
+	sum.FallingBehind = sum.BehindGrowth > 0 && last.Behind > cdcBacklog && last.Behind > last.BehindStart/2
+	for _, t := range c.tables {
+		sum.Tables = append(sum.Tables, *t)
+	}
+	sort.Slice(sum.Tables, func(i, j int) bool { return sum.Tables[i].Changes > sum.Tables[j].Changes })
+}
+
+// printCDCInterval writes one interval as a line of text.
+func printCDCInterval(in *cdcInterval) {
+	line := fmt.Sprintf("   %s  %7.0f tx/s %8.0f chg/s (i %d u %d d %d)  %9s/s", in.End.Format("15:04:05"),
+		in.TxPerSec, in.ChangesPerSec, in.Ops["insert"], in.Ops["update"], in.Ops["delete"], formatBytes(int64(in.BytesPerSec)))
+	if in.Transactions > 0 {
+		line += fmt.Sprintf("  lag p50 %v p95 %v max %v", in.LagP50.Round(time.Millisecond), in.LagP95.Round(time.Millisecond), in.LagMax.Round(time.Millisecond))
+	}
+	line += fmt.Sprintf("  behind %s  retained %s", formatBytes(in.Behind), formatBytes(in.RetainedBytes))
+	if in.Kafka != nil {
+		line += kafkaIntervalText(in.Kafka)
+	}
+	fmt.Println(line)
+}
+
+// printCDCSummary writes the summary for a person.
+func printCDCSummary(sum *cdcSummary) {
+	fmt.Printf("\n📊 %s via slot %s", sum.Plugin, sum.Slot)
+	if sum.intervalsCount == 0 {
+		fmt.Println(": stopped before the first interval")
+		return
+	}
+	fmt.Printf(" from %s to %s (%s → %s)\n", sum.Start.Format("2006-01-02 15:04:05"), sum.End.Format("15:04:05"), sum.StartLSN, sum.ConfirmedLSN)
+	fmt.Printf("   Decoded:  %d transaction(s), %d change(s), %s of plugin output\n", sum.Transactions, sum.Changes, formatBytes(sum.Bytes))
+	fmt.Printf("   Rate:     %.0f tx/s, %.0f changes/s on average, peak %.0f changes/s\n", sum.TxPerSec, sum.ChangesPerSec, sum.PeakChanges)
+	if sum.Transactions > 0 {
+		fmt.Printf("   Lag:      p95 %v (median interval), max %v, commit to decoded\n", sum.LagP95Median.Round(time.Millisecond), sum.LagMax.Round(time.Millisecond))
+	}
+	fmt.Printf("   Behind:   at most %s, trend %s/s; slot retained at most %s\n",
+		formatBytes(sum.MaxBehind), formatSignedBytes(sum.BehindGrowth), formatBytes(sum.MaxRetained))
+	if sum.Kafka != nil {
+		printKafkaSummary(sum.Kafka)
+	}
+	if len(sum.Tables) > 0 {
+		fmt.Printf("\n   %-40s %10s %10s %10s %10s %9s\n", "TABLE", "CHANGES", "INSERT", "UPDATE", "DELETE", "TRUNCATE")
+		for _, t := range sum.Tables {
+			fmt.Printf("   %-40s %10d %10d %10d %10d %9d\n", t.Table, t.Changes, t.Ops["insert"], t.Ops["update"], t.Ops["delete"], t.Ops["truncate"])
+		}
+	}
+	fmt.Println()
+	switch {
+	case sum.FallingBehind:
+		fmt.Printf("🔴 Falling behind: the backlog grows by %s/s; pg_wal grows with it while this load lasts.\n", formatBytes(int64(sum.BehindGrowth)))
+		if sum.Capacity > 0 {
+			fmt.Printf("   Capacity: about %.0f changes/s (%s/s decoded) for this consumer; the load needs more,\n", sum.Capacity, formatBytes(int64(sum.CapacityBytes)))
+			fmt.Println("   or a faster sink, fewer tables per slot, or a smaller change volume.")
+		}
+	case sum.Capacity > 0:
+		fmt.Printf("🟡 Keeping up, with backlogs: capacity about %.0f changes/s (%s/s decoded) while catching up.\n", sum.Capacity, formatBytes(int64(sum.CapacityBytes)))
+	default:
+		fmt.Printf("🟢 Keeping up: no backlog, so capacity is above the peak of %.0f changes/s; raise the load to find it.\n", sum.PeakChanges)
+	}
+}
+
+// formatSignedBytes is formatBytes with a sign.
+func formatSignedBytes(b float64) string {
+	if b < 0 {
+		return "-" + formatBytes(int64(-b))
+	}
+	return "+" + formatBytes(int64(b))
+}
+
+// cdcSlotName is what CREATE_REPLICATION_SLOT accepts.
+var cdcSlotName = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+// resolveCDCTables returns -tables as schema-qualified names.
+func resolveCDCTables(ctx context.Context, pool *pgxpool.Pool, names []string) ([]pgx.Identifier, error) {
+	var tables []pgx.Identifier
+	for _, name := range names {
+		var schema, table string
+		err := pool.QueryRow(ctx, `
+			SELECT n.nspname, c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+			WHERE c.oid = to_regclass($1) AND c.relkind IN ('r', 'p')
+		`, name).Scan(&schema, &table)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("table %s not found", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, pgx.Identifier{schema, table})
+	}
+	return tables, nil
+}
+
+// ensurePublication creates the publication if it's missing; created is
+// true when it did.
+func ensurePublication(ctx context.Context, pool *pgxpool.Pool, name string, tables []pgx.Identifier) (created bool, err error) {
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT FROM pg_publication WHERE pubname = $1)`, name).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+	ddl := "CREATE PUBLICATION " + pgx.Identifier{name}.Sanitize() + " FOR ALL TABLES"
+	if len(tables) > 0 {
+		quoted := make([]string, len(tables))
+		for i, t := range tables {
+			quoted[i] = t.Sanitize()
+		}
+		ddl = "CREATE PUBLICATION " + pgx.Identifier{name}.Sanitize() + " FOR TABLE " + strings.Join(quoted, ", ")
+	}
+	if _, err := pool.Exec(ctx, ddl); err != nil {
+		return false, fmt.Errorf("failed to create publication: %w", err)
+	}
+	return true, nil
+}
+
+// CDC runs the cdc command line tool.
+func CDC() {
+	var dsn, plugin, slot, publication, format string
+	var brokers, registry, topicPrefix, checkpoint string
+	var tableFlags stringList
+	var keepSlot bool
+	var interval, statusInterval, duration, deliveryTimeout time.Duration
+	registerDSNFlag(&dsn)
+	flag.StringVar(&plugin, "plugin", "pgoutput", "Output plugin: pgoutput, or wal2json (must be installed on the server)")
+	flag.StringVar(&slot, "slot", "dbre_cdc", "Replication slot name")
+	flag.BoolVar(&keepSlot, "keep-slot", false, "Use a persistent slot: create it if missing, resume from it otherwise, keep it at exit")
+	flag.StringVar(&publication, "publication", "dbre_cdc", "Publication for pgoutput (created if missing)")
+	flag.Var(&tableFlags, "tables", "Tables to decode, comma separated or repeated (default: all)")
+	flag.DurationVar(&duration, "duration", 0, "Stop and summarize after this long (0: at Ctrl-C)")
+	flag.DurationVar(&interval, "interval", 10*time.Second, "Report interval")
+	flag.DurationVar(&statusInterval, "status-interval", 10*time.Second, "How often to confirm the decoded position to the server")
+	flag.StringVar(&format, "format", "text", "Output format: text, or json (one interval per line, then the summary)")
+	flag.StringVar(&brokers, "kafka-brokers", "", "Produce changes to these Kafka brokers, comma separated (empty: decode only)")
+	flag.StringVar(&registry, "schema-registry", "", "Confluent Schema Registry URL for the Avro schemas (required with -kafka-brokers)")
+	flag.StringVar(&topicPrefix, "kafka-topic-prefix", "dbre_cdc", "Topics are <prefix>.<schema>.<table>")
+	flag.StringVar(&checkpoint, "kafka-checkpoint", "", "File keeping the delivered LSN and partition offsets, to skip delivered transactions on restart")
+	flag.DurationVar(&deliveryTimeout, "kafka-delivery-timeout", 2*time.Minute, "Give up on a record (and stop) when it isn't delivered within this")
+	flag.Parse()
+
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	if interval <= 0 || statusInterval <= 0 {
+		log.Fatal("-interval and -status-interval must be positive")
+	}
+	if !cdcSlotName.MatchString(slot) {
+		log.Fatalf("invalid -slot %q (lower case letters, digits and underscores)", slot)
+	}
+	decoder, err := newChangeDecoder(plugin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if brokers != "" && registry == "" {
+		log.Fatal("-kafka-brokers needs -schema-registry")
+	}
+	if checkpoint != "" && !keepSlot {
+		fmt.Fprintln(os.Stderr, "⚠️  -kafka-checkpoint without -keep-slot: a temporary slot never resends, so the checkpoint only records the position")
+	}
+	var names []string
+	for _, v := range tableFlags {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "cdc", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	server := describeTarget(pool.Config())
+
+	var walLevel string
+	if err := pool.QueryRow(ctx, `SELECT current_setting('wal_level')`).Scan(&walLevel); err != nil {
+		log.Fatal(err)
+	}
+	if walLevel != "logical" {
+		log.Fatalf("wal_level is %s on %s; logical decoding needs wal_level=logical (restart required)", walLevel, server)
+	}
+	tables, err := resolveCDCTables(ctx, pool, names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tableNames := make([]string, len(tables))
+	for i, t := range tables {
+		tableNames[i] = t[0] + "." + t[1]
+	}
+	if plugin == "pgoutput" {
+		created, err := ensurePublication(ctx, pool, publication, tables)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if created && !keepSlot {
+			defer func() {
+				if _, err := pool.Exec(context.Background(), "DROP PUBLICATION IF EXISTS "+pgx.Identifier{publication}.Sanitize()); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Dropping publication %s: %v\n", publication, err)
+				}
+			}()
+		}
+	}
+
+	rc, err := connectReplication(ctx, dsn, "cdc")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rc.close()
+	sum := &cdcSummary{Plugin: plugin, Slot: slot}
+	var existing string
+	err = pool.QueryRow(ctx, `SELECT coalesce(plugin, 'physical') FROM pg_replication_slots WHERE slot_name = $1`, slot).Scan(&existing)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Fatal(err)
+	}
+	switch {
+	case existing != "" && !keepSlot:
+		log.Fatalf("slot %s already exists; use -keep-slot to resume from it, or another -slot", slot)
+	case existing != "" && existing != plugin:
+		log.Fatalf("slot %s uses %s, not %s", slot, existing, plugin)
+	case existing != "":
+		// Resumes from confirmed_flush_lsn.
+		sum.StartLSN = "(slot)"
+	default:
+		start, err := rc.createSlot(ctx, slot, plugin, !keepSlot)
+		if err != nil {
+			log.Fatalf("failed to create slot %s: %v", slot, err)
+		}
+		sum.StartLSN = formatLSN(start)
+	}
+	if err := rc.startReplication(ctx, slot, 0, decoder.options(tableNames, publication)); err != nil {
+		log.Fatalf("failed to start replication: %v", err)
+	}
+
+	if format == "text" {
+		scope := "all tables"
+		if len(tableNames) > 0 {
+			scope = strings.Join(tableNames, ", ")
+		}
+		fmt.Printf("📡 Decoding %s on %s with %s via slot %s from %s, every %v\n", scope, server, plugin, slot, sum.StartLSN, interval)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	runCtx := ctx
+	if duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	c := &cdcConsumer{rc: rc, decoder: decoder, pool: pool, slot: slot, tables: map[string]*cdcTableStats{}}
+	if brokers != "" {
+		if c.sink, err = newKafkaSink(brokers, registry, topicPrefix, checkpoint, slot, deliveryTimeout); err != nil {
+			log.Fatal(err)
+		}
+		defer c.sink.close()
+	}
+	runErr := c.run(runCtx, interval, statusInterval, func(in *cdcInterval) {
+		if format == "json" {
+			if err := enc.Encode(in); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		printCDCInterval(in)
+	})
+	if c.sink != nil {
+		// Wait for the records in flight, then fold their acknowledgements
+		// into the summary.
+		if err := c.sink.flush(30 * time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Kafka: records still in flight at exit: %v\n", err)
+		}
+		c.sink.endInterval(c.decoded, 0)
+	}
+	// Confirm what was decoded (or delivered) before leaving, even after a
+	// failure: a kept slot resumes there.
+	pos, err := c.position()
+	if runErr == nil {
+		runErr = err
+	}
+	if pos > 0 {
+		if c.sink != nil {
+			if err := c.sink.saveCheckpoint(pos, true); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+			}
+		}
+		if err := c.rc.sendStatus(pos); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Confirming %s: %v\n", formatLSN(pos), err)
+		}
+	}
+	if runErr != nil {
+		log.Fatalf("replication stream: %v", runErr)
+	}
+
+	c.summarize(sum)
+	if format == "json" {
+		if err := enc.Encode(sum); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printCDCSummary(sum)
+		if keepSlot {
+			fmt.Printf("\n   Slot %s is kept and retains WAL until the next run; drop it when done:\n", slot)
+			fmt.Printf("   SELECT pg_drop_replication_slot('%s');\n", slot)
+		}
+	}
+	if sum.FallingBehind {
+		rc.close()
+		pool.Close()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,685 @@
+package dbre
+
+// ============================================================================
+// CDC KAFKA SINK (cmd/cdc -kafka-brokers)
+// ============================================================================
+//
+// The rest of the Postgres→Kafka pipeline: with -kafka-brokers, cdc
+// produces every decoded change to Kafka and measures delivery next to
+// decoding. Per change:
+//   topic    <-kafka-topic-prefix>.<schema>.<table>, created by the broker
+//            (auto.create.topics.enable) or beforehand
+//   key      the primary key (replica identity) columns, so the changes of
+//            a row stay in order on one partition; none without a key
+//   value    an envelope of op, before, after, unchanged (columns whose
+//            TOAST value wasn't sent) and source (lsn, xid, commit_time,
+//            schema, table). Columns are nullable int, long, boolean,
+//            double or string, after their PostgreSQL type
+//   headers  lsn (end of the transaction) and xid
+// Key and value are Avro in the Confluent wire format (magic byte 0, schema
+// id, body); schemas are registered in -schema-registry under
+// <topic>-key and <topic>-value, again whenever a table's columns change,
+// so the registry's compatibility rules apply to schema changes.
+//
+// Delivery is "exactly once, ish": the producer is idempotent (no
+// duplicates from its own retries), and cdc confirms a transaction to the
+// slot only when every record of it, and of every transaction before it,
+// is acknowledged by all in-sync replicas. A crash never loses a change;
+// it can resend what was delivered after the last confirmation. To narrow
+// that, -kafka-checkpoint keeps the delivered LSN and the last offset of
+// every partition in a file, written every second; on restart with
+// -keep-slot, transactions at or before its LSN are skipped. What's left
+// are the transactions delivered in the last second before the crash:
+// consumers that need exactly once drop records whose lsn header isn't
+// above the last one they applied.
+//
+// Delivery metrics per interval: records produced, acknowledged and
+// failed, bytes, produce-to-acknowledged latency p50/p95/max, records in
+// flight, and the decoded WAL not delivered yet. A record that fails after
+// the client's retries (-kafka-delivery-timeout) stops cdc: later
+// transactions must not be confirmed past it.
+//
+//   go run ./cmd/cdc -tables=public.orders -kafka-brokers=kafka1:9092,kafka2:9092 \
+//       -schema-registry=http://registry:8081 -keep-slot -kafka-checkpoint=cdc.checkpoint.json
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// schemaRegistry registers Avro schemas with a Confluent Schema Registry.
+type schemaRegistry struct {
+	url        *url.URL
+	user, pass string
+	client     *http.Client
+	ids        map[string]int // subject + schema → id
+}
+
+func newSchemaRegistry(raw string) (*schemaRegistry, error) {
+	u, err := url.Parse(strings.TrimSuffix(raw, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid schema registry URL %q", raw)
+	}
+	r := &schemaRegistry{url: u, client: &http.Client{Timeout: 30 * time.Second}, ids: map[string]int{}}
+	if u.User != nil {
+		r.user = u.User.Username()
+		r.pass, _ = u.User.Password()
+		u.User = nil
+	}
+	return r, nil
+}
+
+// register returns the id of schema under subject, registering it if new.
+func (r *schemaRegistry) register(ctx context.Context, subject, schema string) (int, error) {
+	if id, ok := r.ids[subject+"\x00"+schema]; ok {
+		return id, nil
+	}
+	body, _ := json.Marshal(map[string]string{"schema": schema})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url.String()+"/subjects/"+url.PathEscape(subject)+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if r.user != "" {
+		req.SetBasicAuth(r.user, r.pass)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("schema registry: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var out struct {
+		ID      int    `json:"id"`
+		Code    int    `json:"error_code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil || resp.StatusCode != http.StatusOK {
+		if out.Message != "" {
+			return 0, fmt.Errorf("schema registry: registering %s: %s (%d)", subject, out.Message, out.Code)
+		}
+		return 0, fmt.Errorf("schema registry: registering %s: %s: %s", subject, resp.Status, oneLine(string(data), 200))
+	}
+	r.ids[subject+"\x00"+schema] = out.ID
+	return out.ID, nil
+}
+
+// avroType is the Avro type of a column, from its type OID (pgoutput) or
+// name (wal2json).
+func avroType(typ string) string {
+	switch typ {
+	case "16", "boolean", "bool":
+		return "boolean"
+	case "21", "23", "smallint", "integer", "int2", "int4":
+		return "int"
+	case "20", "bigint", "int8":
+		return "long"
+	case "700", "701", "real", "double precision", "float4", "float8":
+		return "double"
+	}
+	return "string"
+}
+
+// avroNative converts a column's text value for its Avro type.
+func avroNative(typ, v string) (any, error) {
+	switch typ {
+	case "boolean":
+		return strconv.ParseBool(v)
+	case "int":
+		n, err := strconv.ParseInt(v, 10, 32)
+		return int32(n), err
+	case "long":
+		return strconv.ParseInt(v, 10, 64)
+	case "double":
+		return strconv.ParseFloat(v, 64)
+	}
+	return v, nil
+}
+
+var avroInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// avroName makes s a valid Avro name.
+func avroName(s string) string {
+	s = avroInvalid.ReplaceAllString(s, "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "_" + s
+	}
+	return s
+}
+
+// cdcAvroTable is the schemas and codecs of one table for one column set.
+type cdcAvroTable struct {
+	topic     string
+	fields    []string // Avro field name of each column, in order
+	types     []string
+	columns   map[string]int // Column name → index
+	keys      []int
+	valueID   int
+	value     *goavro.Codec
+	rowName   string
+	keyID     int
+	key       *goavro.Codec
+	signature string
+}
+
+// cdcColumnsSignature identifies a column set: a change means new schemas.
+func cdcColumnsSignature(cols []changeColumn) string {
+	var b strings.Builder
+	for _, c := range cols {
+		fmt.Fprintf(&b, "%s:%s:%v,", c.Name, c.Type, c.Key)
+	}
+	return b.String()
+}
+
+// newCDCAvroTable builds and registers the schemas of a table.
+func newCDCAvroTable(ctx context.Context, reg *schemaRegistry, prefix string, ev changeEvent, cols []changeColumn) (*cdcAvroTable, error) {
+	t := &cdcAvroTable{
+		topic:     prefix + "." + ev.Schema + "." + ev.Table,
+		columns:   map[string]int{},
+		signature: cdcColumnsSignature(cols),
+	}
+	namespace := avroName(prefix) + "." + avroName(ev.Schema) + "." + avroName(ev.Table)
+	t.rowName = namespace + ".Row"
+	used := map[string]bool{}
+	var rowFields, keyFields []map[string]any
+	for i, c := range cols {
+		name := avroName(c.Name)
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", avroName(c.Name), n)
+		}
+		used[name] = true
+		t.fields = append(t.fields, name)
+		t.types = append(t.types, avroType(c.Type))
+		t.columns[c.Name] = i
+		field := map[string]any{"name": name, "type": []string{"null", avroType(c.Type)}, "default": nil}
+		rowFields = append(rowFields, field)
+		if c.Key {
+			t.keys = append(t.keys, i)
+			keyFields = append(keyFields, field)
+		}
+	}
+	value := map[string]any{
+		"type": "record", "name": "Value", "namespace": namespace,
+		"fields": []map[string]any{
+			{"name": "op", "type": "string"},
+			{"name": "before", "type": []any{"null", map[string]any{"type": "record", "name": "Row", "fields": rowFields}}, "default": nil},
+			{"name": "after", "type": []any{"null", "Row"}, "default": nil},
+			{"name": "unchanged", "type": map[string]any{"type": "array", "items": "string"}, "default": []string{}},
+			{"name": "source", "type": map[string]any{"type": "record", "name": "Source", "fields": []map[string]any{
+				{"name": "lsn", "type": "string"},
+				{"name": "xid", "type": "long"},
+				{"name": "commit_time", "type": map[string]any{"type": "long", "logicalType": "timestamp-micros"}},
+				{"name": "schema", "type": "string"},
+				{"name": "table", "type": "string"},
+			}}},
+		},
+	}
+	var err error
+	if t.value, t.valueID, err = registerAvro(ctx, reg, t.topic+"-value", value); err != nil {
+		return nil, err
+	}
+	if len(keyFields) > 0 {
+		key := map[string]any{"type": "record", "name": "Key", "namespace": namespace, "fields": keyFields}
+		if t.key, t.keyID, err = registerAvro(ctx, reg, t.topic+"-key", key); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// registerAvro compiles schema and registers it under subject.
+func registerAvro(ctx context.Context, reg *schemaRegistry, subject string, schema map[string]any) (*goavro.Codec, int, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, 0, err
+	}
+	codec, err := goavro.NewCodec(string(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("avro schema for %s: %w", subject, err)
+	}
+	id, err := reg.register(ctx, subject, codec.Schema())
+	return codec, id, err
+}
+
+// row is the Avro record of cols, or nil for none.
+func (t *cdcAvroTable) row(cols []changeColumn, only []int) (map[string]any, error) {
+	if len(cols) == 0 {
+		return nil, nil
+	}
+	row := map[string]any{}
+	for _, f := range t.fields {
+		row[f] = nil
+	}
+	for _, c := range cols {
+		i, ok := t.columns[c.Name]
+		if !ok || c.Value == nil || (only != nil && !containsInt(only, i)) {
+			continue
+		}
+		v, err := avroNative(t.types[i], *c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.Name, err)
+		}
+		row[t.fields[i]] = goavro.Union(t.types[i], v)
+	}
+	return row, nil
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// confluentAvro encodes native in the Confluent wire format.
+func confluentAvro(codec *goavro.Codec, id int, native any) ([]byte, error) {
+	buf := make([]byte, 5, 256)
+	binary.BigEndian.PutUint32(buf[1:], uint32(id))
+	return codec.BinaryFromNative(buf, native)
+}
+
+// record encodes one change of tx.
+func (t *cdcAvroTable) record(tx *changeTransaction, ev changeEvent) (*kgo.Record, error) {
+	before, err := t.row(ev.Old, nil)
+	if err != nil {
+		return nil, err
+	}
+	after, err := t.row(ev.Columns, nil)
+	if err != nil {
+		return nil, err
+	}
+	unchanged := []any{}
+	for _, c := range ev.Columns {
+		if c.Unchanged {
+			unchanged = append(unchanged, c.Name)
+		}
+	}
+	native := map[string]any{
+		"op": ev.Op, "before": nil, "after": nil, "unchanged": unchanged,
+		"source": map[string]any{
+			"lsn": formatLSN(tx.EndLSN), "xid": int64(tx.XID), "commit_time": tx.CommitTime.UTC(),
+			"schema": ev.Schema, "table": ev.Table,
+		},
+	}
+	if before != nil {
+		native["before"] = goavro.Union(t.rowName, before)
+	}
+	if after != nil {
+		native["after"] = goavro.Union(t.rowName, after)
+	}
+	rec := &kgo.Record{Topic: t.topic, Headers: []kgo.RecordHeader{
+		{Key: "lsn", Value: []byte(formatLSN(tx.EndLSN))},
+		{Key: "xid", Value: []byte(strconv.FormatUint(uint64(tx.XID), 10))},
+	}}
+	if rec.Value, err = confluentAvro(t.value, t.valueID, native); err != nil {
+		return nil, fmt.Errorf("%s: %w", t.topic, err)
+	}
+	if t.key != nil && ev.Op != "truncate" {
+		keyCols := ev.Columns
+		if len(keyCols) == 0 {
+			keyCols = ev.Old
+		}
+		key, err := t.row(keyCols, t.keys)
+		if err != nil {
+			return nil, err
+		}
+		fields := map[string]any{}
+		for _, i := range t.keys {
+			fields[t.fields[i]] = key[t.fields[i]]
+		}
+		if rec.Key, err = confluentAvro(t.key, t.keyID, fields); err != nil {
+			return nil, fmt.Errorf("%s key: %w", t.topic, err)
+		}
+	}
+	return rec, nil
+}
+
+// kafkaCheckpoint is the -kafka-checkpoint file.
+type kafkaCheckpoint struct {
+	Slot    string                     `json:"slot"`
+	LSN     string                     `json:"lsn"` // Delivered up to here
+	Updated time.Time                  `json:"updated"`
+	Offsets map[string]map[int32]int64 `json:"offsets"` // Topic → partition → last offset
+}
+
+// readKafkaCheckpoint reads path; a missing file is no checkpoint.
+func readKafkaCheckpoint(path, slot string) (uint64, map[string]map[int32]int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, map[string]map[int32]int64{}, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	var cp kafkaCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return 0, nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if cp.Slot != slot {
+		return 0, nil, fmt.Errorf("checkpoint %s is for slot %s, not %s", path, cp.Slot, slot)
+	}
+	lsn, err := parseLSN(cp.LSN)
+	if err != nil {
+		return 0, nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if cp.Offsets == nil {
+		cp.Offsets = map[string]map[int32]int64{}
+	}
+	return lsn, cp.Offsets, nil
+}
+
+// kafkaInterval is the delivery of one interval.
+type kafkaInterval struct {
+	Produced         int64         `json:"produced"`
+	Acked            int64         `json:"acked"`
+	Failed           int64         `json:"failed"`
+	Skipped          int64         `json:"skipped_transactions,omitempty"` // At or before the checkpoint
+	Bytes            int64         `json:"bytes"`
+	LatencyP50       time.Duration `json:"delivery_p50_ns"`
+	LatencyP95       time.Duration `json:"delivery_p95_ns"`
+	LatencyMax       time.Duration `json:"delivery_max_ns"`
+	InFlight         int64         `json:"in_flight"`
+	DeliveredLSN     string        `json:"delivered_lsn"`
+	UndeliveredBytes int64         `json:"undelivered_bytes"` // Decoded WAL not delivered yet
+}
+
+// kafkaSummary is the delivery of the whole run.
+type kafkaSummary struct {
+	Brokers        string        `json:"brokers"`
+	Produced       int64         `json:"produced"`
+	Acked          int64         `json:"acked"`
+	Failed         int64         `json:"failed"`
+	Skipped        int64         `json:"skipped_transactions"`
+	Bytes          int64         `json:"bytes"`
+	AckedPerSec    float64       `json:"acked_per_sec"`
+	LatencyP95     time.Duration `json:"delivery_p95_median_ns"` // Median of the intervals' p95
+	LatencyMax     time.Duration `json:"delivery_max_ns"`
+	MaxUndelivered int64         `json:"max_undelivered_bytes"`
+	Topics         []string      `json:"topics"`
+	Schemas        int           `json:"schemas_registered"`
+	DeliveredLSN   string        `json:"delivered_lsn"`
+	CheckpointLSN  string        `json:"checkpoint_lsn,omitempty"`
+	secs           float64
+	p95s           []float64
+}
+
+// kafkaTx is a transaction waiting for its records to be acknowledged.
+type kafkaTx struct {
+	endLSN  uint64
+	pending int
+}
+
+// kafkaSink produces change events and tracks what's delivered.
+type kafkaSink struct {
+	client     *kgo.Client
+	registry   *schemaRegistry
+	prefix     string
+	tables     map[string]*cdcAvroTable
+	checkpoint string // File; empty: none
+	slot       string
+	skipBelow  uint64 // Checkpoint LSN at start
+	lastSaved  time.Time
+	savedLSN   uint64
+
+	mu        sync.Mutex
+	inflight  []*kafkaTx
+	delivered uint64
+	offsets   map[string]map[int32]int64
+	err       error
+	cur       kafkaInterval
+	lats      []float64
+	sum       kafkaSummary
+}
+
+func newKafkaSink(brokers, registry, prefix, checkpoint, slot string, deliveryTimeout time.Duration) (*kafkaSink, error) {
+	reg, err := newSchemaRegistry(registry)
+	if err != nil {
+		return nil, err
+	}
+	s := &kafkaSink{registry: reg, prefix: prefix, tables: map[string]*cdcAvroTable{}, checkpoint: checkpoint, slot: slot,
+		offsets: map[string]map[int32]int64{}, sum: kafkaSummary{Brokers: brokers}}
+	if checkpoint != "" {
+		if s.skipBelow, s.offsets, err = readKafkaCheckpoint(checkpoint, slot); err != nil {
+			return nil, err
+		}
+		s.delivered, s.savedLSN = s.skipBelow, s.skipBelow
+	}
+	s.client, err = kgo.NewClient(
+		kgo.SeedBrokers(strings.Split(brokers, ",")...),
+		kgo.ClientID("dbre-cdc"),
+		kgo.RecordDeliveryTimeout(deliveryTimeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	return s, nil
+}
+
+// send produces the changes of tx; the promise of each record counts it
+// down, and the transaction is delivered once none is pending.
+func (s *kafkaSink) send(ctx context.Context, tx *changeTransaction) error {
+	if s.skipBelow > 0 && tx.EndLSN <= s.skipBelow {
+		s.mu.Lock()
+		s.cur.Skipped++
+		s.mu.Unlock()
+		return nil
+	}
+	var records []*kgo.Record
+	for _, ev := range tx.Changes {
+		cols := ev.Columns
+		if len(cols) == 0 {
+			cols = ev.Old
+		}
+		name := ev.Schema + "." + ev.Table
+		t := s.tables[name]
+		if t == nil || (len(cols) > 0 && t.signature != cdcColumnsSignature(cols) && len(cols) >= len(t.fields)) {
+			var err error
+			if t, err = newCDCAvroTable(ctx, s.registry, s.prefix, ev, cols); err != nil {
+				return err
+			}
+			s.tables[name] = t
+			s.sum.Schemas++
+		}
+		rec, err := t.record(tx, ev)
+		if err != nil {
+			return err
+		}
+		records = append(records, rec)
+	}
+
+	kt := &kafkaTx{endLSN: tx.EndLSN, pending: len(records)}
+	s.mu.Lock()
+	s.inflight = append(s.inflight, kt)
+	s.advance()
+	s.mu.Unlock()
+	for _, rec := range records {
+		sent := time.Now()
+		s.mu.Lock()
+		s.cur.Produced++
+		s.cur.InFlight++
+		s.mu.Unlock()
+		s.client.Produce(ctx, rec, func(r *kgo.Record, err error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.cur.InFlight--
+			if err != nil {
+				s.cur.Failed++
+				if s.err == nil {
+					s.err = fmt.Errorf("kafka: delivering to %s: %w", r.Topic, err)
+				}
+				return
+			}
+			s.cur.Acked++
+			s.cur.Bytes += int64(len(r.Key) + len(r.Value))
+			s.lats = append(s.lats, float64(time.Since(sent)))
+			if s.offsets[r.Topic] == nil {
+				s.offsets[r.Topic] = map[int32]int64{}
+			}
+			s.offsets[r.Topic][r.Partition] = r.Offset
+			kt.pending--
+			s.advance()
+		})
+	}
+	return nil
+}
+
+// advance moves the delivered position past the acknowledged transactions
+// at the head of the queue. The caller holds s.mu.
+func (s *kafkaSink) advance() {
+	for len(s.inflight) > 0 && s.inflight[0].pending == 0 {
+		s.delivered = max(s.delivered, s.inflight[0].endLSN)
+		s.inflight = s.inflight[1:]
+	}
+}
+
+// position is what may be confirmed to the slot: decoded, when nothing is
+// in flight, or the delivered position.
+func (s *kafkaSink) position(decoded uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.delivered, s.err
+	}
+	if len(s.inflight) == 0 {
+		s.delivered = max(s.delivered, decoded)
+	}
+	return s.delivered, nil
+}
+
+// saveCheckpoint writes the checkpoint file if lsn moved and it's been a
+// second (or force).
+func (s *kafkaSink) saveCheckpoint(lsn uint64, force bool) error {
+	if s.checkpoint == "" || lsn <= s.savedLSN || (!force && time.Since(s.lastSaved) < time.Second) {
+		return nil
+	}
+	s.mu.Lock()
+	data, err := json.MarshalIndent(kafkaCheckpoint{Slot: s.slot, LSN: formatLSN(lsn), Updated: time.Now(), Offsets: s.offsets}, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := s.checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, s.checkpoint); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	s.lastSaved, s.savedLSN = time.Now(), lsn
+	return nil
+}
+
+// endInterval returns the delivery since the last call.
+func (s *kafkaSink) endInterval(decoded uint64, secs float64) *kafkaInterval {
+	delivered, _ := s.position(decoded)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	in := s.cur
+	s.cur = kafkaInterval{InFlight: in.InFlight}
+	in.DeliveredLSN = formatLSN(delivered)
+	if decoded > delivered {
+		in.UndeliveredBytes = int64(decoded - delivered)
+	}
+	if len(s.lats) > 0 {
+		sort.Float64s(s.lats)
+		in.LatencyP50 = time.Duration(percentile(s.lats, 0.5))
+		in.LatencyP95 = time.Duration(percentile(s.lats, 0.95))
+		in.LatencyMax = time.Duration(s.lats[len(s.lats)-1])
+		s.sum.p95s = append(s.sum.p95s, float64(in.LatencyP95))
+		s.lats = s.lats[:0]
+	}
+	s.sum.Produced += in.Produced
+	s.sum.Acked += in.Acked
+	s.sum.Failed += in.Failed
+	s.sum.Skipped += in.Skipped
+	s.sum.Bytes += in.Bytes
+	s.sum.LatencyMax = max(s.sum.LatencyMax, in.LatencyMax)
+	s.sum.MaxUndelivered = max(s.sum.MaxUndelivered, in.UndeliveredBytes)
+	s.sum.secs += secs
+	return &in
+}
+
+// flush waits for the records in flight, up to timeout.
+func (s *kafkaSink) flush(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.client.Flush(ctx)
+}
+
+// summary totals the run; call it after the last endInterval.
+func (s *kafkaSink) summary() *kafkaSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := s.sum
+	if sum.secs > 0 {
+		sum.AckedPerSec = float64(sum.Acked) / sum.secs
+	}
+	if len(sum.p95s) > 0 {
+		sort.Float64s(sum.p95s)
+		sum.LatencyP95 = time.Duration(percentile(sum.p95s, 0.5))
+	}
+	for _, t := range s.tables {
+		sum.Topics = append(sum.Topics, t.topic)
+	}
+	sort.Strings(sum.Topics)
+	sum.DeliveredLSN = formatLSN(s.delivered)
+	if s.checkpoint != "" {
+		sum.CheckpointLSN = formatLSN(s.savedLSN)
+	}
+	return &sum
+}
+
+func (s *kafkaSink) close() { s.client.Close() }
+
+// kafkaIntervalText is the delivery of an interval, for its line.
+func kafkaIntervalText(k *kafkaInterval) string {
+	line := fmt.Sprintf("  kafka +%d acked", k.Acked)
+	if k.Failed > 0 {
+		line += fmt.Sprintf(" %d FAILED", k.Failed)
+	}
+	if k.Acked > 0 {
+		line += fmt.Sprintf(" p95 %v", k.LatencyP95.Round(time.Millisecond))
+	}
+	return line + fmt.Sprintf(" in flight %d undelivered %s", k.InFlight, formatBytes(k.UndeliveredBytes))
+}
+
+// printKafkaSummary writes the delivery summary for a person.
+func printKafkaSummary(k *kafkaSummary) {
+	fmt.Printf("\n📨 Kafka (%s): %d record(s) acknowledged, %.0f/s, %s; %d failed",
+		k.Brokers, k.Acked, k.AckedPerSec, formatBytes(k.Bytes), k.Failed)
+	if k.Skipped > 0 {
+		fmt.Printf(", %d transaction(s) skipped as already delivered", k.Skipped)
+	}
+	fmt.Println()
+	if k.Acked > 0 {
+		fmt.Printf("   Delivery: p95 %v (median interval), max %v, produce to acknowledged by all in-sync replicas\n",
+			k.LatencyP95.Round(time.Millisecond), k.LatencyMax.Round(time.Millisecond))
+	}
+	fmt.Printf("   Position: delivered %s", k.DeliveredLSN)
+	if k.CheckpointLSN != "" {
+		fmt.Printf(", checkpoint %s", k.CheckpointLSN)
+	}
+	fmt.Printf("; at most %s decoded but not delivered\n", formatBytes(k.MaxUndelivered))
+	if len(k.Topics) > 0 {
+		fmt.Printf("   Topics:   %s (%d schema version(s) registered)\n", strings.Join(k.Topics, ", "), k.Schemas)
+	}
+}
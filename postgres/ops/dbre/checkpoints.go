@@ -0,0 +1,303 @@
+package dbre
+
+// ============================================================================
+// CHECKPOINT AND BGWRITER HEALTH (cmd/checkpoints)
+// ============================================================================
+//
+// Checkpoints that come too often write the same hot pages over and over
+// and flood WAL with full-page images; backends that write their own dirty
+// buffers stall queries on I/O. checkpoints reads pg_stat_bgwriter (and
+// pg_stat_checkpointer and pg_stat_io on PostgreSQL 17+) twice, -duration
+// apart, or once with -duration=0 for everything since the statistics
+// reset, and reports for the window:
+//   frequency      checkpoints per hour and the mean interval
+//   requested      the share of checkpoints forced by WAL volume
+//                  (max_wal_size) instead of checkpoint_timeout
+//   buffers        who wrote dirty buffers: checkpointer, bgwriter or the
+//                  backends themselves, and how often the bgwriter stopped
+//                  at bgwriter_lru_maxpages
+//   write/sync     time per checkpoint
+// and suggests settings:
+//   max_wal_size   large enough for the WAL one checkpoint_timeout
+//                  generates at the measured rate, with completion target
+//                  headroom, when more than 10% of checkpoints are requested
+//   checkpoint_completion_target  0.9, to spread the writes
+//   checkpoint_timeout  longer when checkpoints are timed and frequent
+//   bgwriter       bgwriter_lru_maxpages / bgwriter_delay when backends do
+//                  more than 10% of the writes or the bgwriter keeps
+//                  hitting its limit
+// Suggestions are starting points; weigh crash recovery time (longer with
+// more WAL between checkpoints) before applying them.
+//
+//   go run ./cmd/checkpoints -duration=30m
+//   go run ./cmd/checkpoints -duration=0 -format=json
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// checkpointCounters is one reading of the cumulative counters.
+type checkpointCounters struct {
+	Time         time.Time
+	StatsReset   time.Time
+	Timed        int64
+	Requested    int64
+	WriteMS      float64
+	SyncMS       float64
+	Checkpointer int64 // Buffers written by checkpoints
+	Clean        int64 // Buffers written by the bgwriter
+	MaxWritten   int64 // Times the bgwriter stopped at bgwriter_lru_maxpages
+	Backend      int64 // Buffers written by backends
+	BackendFsync int64
+	Alloc        int64
+	WALLSN       string
+}
+
+// readCheckpointCounters reads the counters for the server's version.
+func readCheckpointCounters(ctx context.Context, pool *pgxpool.Pool, version int) (checkpointCounters, error) {
+	c := checkpointCounters{Time: time.Now()}
+	var err error
+	if version >= 170000 {
+		err = pool.QueryRow(ctx, `
+			SELECT coalesce(c.stats_reset, pg_postmaster_start_time()), c.num_timed, c.num_requested, c.write_time, c.sync_time, c.buffers_written,
+			       b.buffers_clean, b.maxwritten_clean, b.buffers_alloc,
+			       coalesce((SELECT sum(writes) FROM pg_stat_io
+			                 WHERE backend_type IN ('client backend', 'background worker') AND object = 'relation'), 0)::bigint,
+			       coalesce((SELECT sum(fsyncs) FROM pg_stat_io
+			                 WHERE backend_type IN ('client backend', 'background worker') AND object = 'relation'), 0)::bigint,
+			       pg_current_wal_lsn()::text
+			FROM pg_stat_checkpointer c, pg_stat_bgwriter b
+		`).Scan(&c.StatsReset, &c.Timed, &c.Requested, &c.WriteMS, &c.SyncMS, &c.Checkpointer,
+			&c.Clean, &c.MaxWritten, &c.Alloc, &c.Backend, &c.BackendFsync, &c.WALLSN)
+	} else {
+		err = pool.QueryRow(ctx, `
+			SELECT coalesce(stats_reset, pg_postmaster_start_time()), checkpoints_timed, checkpoints_req, checkpoint_write_time, checkpoint_sync_time,
+			       buffers_checkpoint, buffers_clean, maxwritten_clean, buffers_alloc, buffers_backend,
+			       buffers_backend_fsync, pg_current_wal_lsn()::text
+			FROM pg_stat_bgwriter
+		`).Scan(&c.StatsReset, &c.Timed, &c.Requested, &c.WriteMS, &c.SyncMS, &c.Checkpointer,
+			&c.Clean, &c.MaxWritten, &c.Alloc, &c.Backend, &c.BackendFsync, &c.WALLSN)
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read checkpoint statistics: %w", err)
+	}
+	return c, nil
+}
+
+// checkpointSettings are the settings the suggestions are about.
+type checkpointSettings struct {
+	Timeout          time.Duration `json:"checkpoint_timeout"`
+	CompletionTarget float64       `json:"checkpoint_completion_target"`
+	MaxWALSize       int64         `json:"max_wal_size"`
+	LRUMaxPages      int64         `json:"bgwriter_lru_maxpages"`
+	BgwriterDelay    time.Duration `json:"bgwriter_delay"`
+	BlockSize        int64         `json:"block_size"`
+}
+
+func readCheckpointSettings(ctx context.Context, pool *pgxpool.Pool) (checkpointSettings, error) {
+	var s checkpointSettings
+	var timeoutS, delayMS, maxWALMB int64
+	err := pool.QueryRow(ctx, `
+		SELECT (SELECT setting FROM pg_settings WHERE name = 'checkpoint_timeout')::bigint,
+		       current_setting('checkpoint_completion_target')::float8,
+		       (SELECT setting FROM pg_settings WHERE name = 'max_wal_size')::bigint,
+		       current_setting('bgwriter_lru_maxpages')::bigint,
+		       (SELECT setting FROM pg_settings WHERE name = 'bgwriter_delay')::bigint,
+		       current_setting('block_size')::bigint
+	`).Scan(&timeoutS, &s.CompletionTarget, &maxWALMB, &s.LRUMaxPages, &delayMS, &s.BlockSize)
+	if err != nil {
+		return s, fmt.Errorf("failed to read checkpoint settings: %w", err)
+	}
+	s.Timeout, s.BgwriterDelay = time.Duration(timeoutS)*time.Second, time.Duration(delayMS)*time.Millisecond
+	s.MaxWALSize = maxWALMB << 20
+	return s, nil
+}
+
+// checkpointHealth is the report for one window.
+type checkpointHealth struct {
+	Settings       checkpointSettings `json:"settings"`
+	Window         time.Duration      `json:"window_ns"`
+	Timed          int64              `json:"checkpoints_timed"`
+	Requested      int64              `json:"checkpoints_requested"`
+	PerHour        float64            `json:"checkpoints_per_hour"`
+	RequestedShare float64            `json:"requested_share"`
+	WritePerCkpt   float64            `json:"write_seconds_per_checkpoint"`
+	SyncPerCkpt    float64            `json:"sync_seconds_per_checkpoint"`
+	Checkpointer   int64              `json:"buffers_checkpointer"`
+	Clean          int64              `json:"buffers_bgwriter"`
+	Backend        int64              `json:"buffers_backend"`
+	BackendShare   float64            `json:"backend_write_share"`
+	MaxWritten     int64              `json:"bgwriter_maxwritten"`
+	BackendFsync   int64              `json:"backend_fsyncs"`
+	WALPerSec      float64            `json:"wal_bytes_per_second"`
+	Suggestions    []string           `json:"suggestions"`
+}
+
+// assessCheckpoints compares two readings; from is zero-valued for
+// "since the statistics reset".
+func assessCheckpoints(from, to checkpointCounters, walBytes float64, s checkpointSettings) *checkpointHealth {
+	h := &checkpointHealth{Settings: s, Window: to.Time.Sub(from.Time)}
+	if from.Time.IsZero() {
+		h.Window = to.Time.Sub(to.StatsReset)
+	}
+	h.Timed, h.Requested = to.Timed-from.Timed, to.Requested-from.Requested
+	h.Checkpointer, h.Clean, h.Backend = to.Checkpointer-from.Checkpointer, to.Clean-from.Clean, to.Backend-from.Backend
+	h.MaxWritten, h.BackendFsync = to.MaxWritten-from.MaxWritten, to.BackendFsync-from.BackendFsync
+	if walBytes > 0 && h.Window > 0 {
+		h.WALPerSec = walBytes / h.Window.Seconds()
+	}
+
+	total := h.Timed + h.Requested
+	if h.Window > 0 {
+		h.PerHour = float64(total) / h.Window.Hours()
+	}
+	if total > 0 {
+		h.RequestedShare = float64(h.Requested) / float64(total)
+		h.WritePerCkpt = (to.WriteMS - from.WriteMS) / 1000 / float64(total)
+		h.SyncPerCkpt = (to.SyncMS - from.SyncMS) / 1000 / float64(total)
+	}
+	if written := h.Checkpointer + h.Clean + h.Backend; written > 0 {
+		h.BackendShare = float64(h.Backend) / float64(written)
+	}
+
+	suggest := func(format string, args ...any) {
+		h.Suggestions = append(h.Suggestions, fmt.Sprintf(format, args...))
+	}
+	if h.RequestedShare > 0.1 {
+		if h.WALPerSec > 0 {
+			// A checkpoint is requested once the WAL since the last one
+			// reaches about max_wal_size / (1 + completion target).
+			need := h.WALPerSec * s.Timeout.Seconds() * (1 + s.CompletionTarget)
+			gb := math.Ceil(need / (1 << 30))
+			suggest("%.0f%% of checkpoints were requested by WAL volume: raise max_wal_size from %s to at least %.0fGB "+
+				"(%s of WAL per checkpoint_timeout of %v)", 100*h.RequestedShare, formatBytes(s.MaxWALSize), gb,
+				formatBytes(int64(h.WALPerSec*s.Timeout.Seconds())), s.Timeout)
+		} else {
+			suggest("%.0f%% of checkpoints were requested by WAL volume: raise max_wal_size (now %s)",
+				100*h.RequestedShare, formatBytes(s.MaxWALSize))
+		}
+	}
+	if s.CompletionTarget < 0.9 {
+		suggest("Set checkpoint_completion_target = 0.9 (now %g) to spread checkpoint writes over the interval", s.CompletionTarget)
+	}
+	if h.RequestedShare <= 0.1 && s.Timeout < 15*time.Minute && h.PerHour > 6 {
+		suggest("Checkpoints are timed every %v: checkpoint_timeout = 15min would cut full-page writes (recovery takes longer)", s.Timeout)
+	}
+	if h.BackendShare > 0.1 {
+		suggest("Backends wrote %.0f%% of dirty buffers themselves: raise bgwriter_lru_maxpages (now %d) or lower bgwriter_delay (now %v); "+
+			"persistently, shared_buffers may be too small", 100*h.BackendShare, s.LRUMaxPages, s.BgwriterDelay)
+	} else if h.Window > 0 && float64(h.MaxWritten)/h.Window.Hours() > 60 {
+		suggest("The bgwriter stopped at bgwriter_lru_maxpages %d times: raise it from %d", h.MaxWritten, s.LRUMaxPages)
+	}
+	if h.BackendFsync > 0 {
+		suggest("Backends had to fsync %d times themselves: the checkpointer's fsync request queue filled up (storage too slow for the write rate)", h.BackendFsync)
+	}
+	if h.SyncPerCkpt > 10 {
+		suggest("Checkpoint sync takes %.0fs on average: the storage can't absorb the writes; check its latency", h.SyncPerCkpt)
+	}
+	return h
+}
+
+// printCheckpointHealth writes the report for a person.
+func printCheckpointHealth(h *checkpointHealth) {
+	s := h.Settings
+	fmt.Printf("🧭 Checkpoints over %s\n", formatAge(h.Window))
+	fmt.Printf("   checkpoint_timeout=%v  max_wal_size=%s  checkpoint_completion_target=%g  bgwriter_lru_maxpages=%d  bgwriter_delay=%v\n",
+		s.Timeout, formatBytes(s.MaxWALSize), s.CompletionTarget, s.LRUMaxPages, s.BgwriterDelay)
+	total := h.Timed + h.Requested
+	interval := "-"
+	if total > 0 {
+		interval = (h.Window / time.Duration(total)).Round(time.Second).String()
+	}
+	fmt.Printf("\nCheckpoints:   %d (%d timed, %d requested = %.0f%%), %.1f/hour, one every %s\n",
+		total, h.Timed, h.Requested, 100*h.RequestedShare, h.PerHour, interval)
+	fmt.Printf("Per checkpoint: %.1fs writing, %.2fs syncing\n", h.WritePerCkpt, h.SyncPerCkpt)
+	bs := s.BlockSize
+	fmt.Printf("Buffers written: checkpointer %s, bgwriter %s, backends %s (%.0f%%); bgwriter hit its limit %d times\n",
+		formatBytes(h.Checkpointer*bs), formatBytes(h.Clean*bs), formatBytes(h.Backend*bs), 100*h.BackendShare, h.MaxWritten)
+	if h.WALPerSec > 0 {
+		fmt.Printf("WAL:           %s/min\n", formatBytes(int64(h.WALPerSec*60)))
+	}
+	if len(h.Suggestions) == 0 {
+		fmt.Println("\n✅ Checkpoints and background writes look healthy")
+		return
+	}
+	fmt.Println("\nSuggestions:")
+	for _, sg := range h.Suggestions {
+		fmt.Printf("   💡 %s\n", sg)
+	}
+}
+
+// Checkpoints runs the checkpoints command line tool.
+func Checkpoints() {
+	var dsn, format string
+	var duration time.Duration
+	registerDSNFlag(&dsn)
+	flag.DurationVar(&duration, "duration", 15*time.Minute, "Measure over this long (0: since the statistics reset, without the WAL rate)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "checkpoints", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	var version int
+	if err := pool.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		log.Fatal(err)
+	}
+	settings, err := readCheckpointSettings(ctx, pool)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var from checkpointCounters
+	if duration > 0 {
+		if from, err = readCheckpointCounters(ctx, pool, version); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "🧭 Measuring checkpoints on %s for %v (Ctrl-C to report early)\n", describeTarget(pool.Config()), duration)
+		select {
+		case <-ctx.Done():
+		case <-time.After(duration):
+		}
+		stop()
+	}
+	to, err := readCheckpointCounters(context.Background(), pool, version)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var walBytes float64
+	if duration > 0 {
+		if err := pool.QueryRow(context.Background(), "SELECT pg_wal_lsn_diff($1, $2)::float8", to.WALLSN, from.WALLSN).Scan(&walBytes); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	health := assessCheckpoints(from, to, walBytes, settings)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(health); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printCheckpointHealth(health)
+}
@@ -0,0 +1,337 @@
+package dbre
+
+// ============================================================================
+// TLS AND AUTHENTICATION OVERHEAD (cmd/conn-bench)
+// ============================================================================
+//
+// "Just turn on TLS" always comes with "what does it cost?". conn-bench
+// times connection establishment for every -variant (a name and a DSN:
+// roles whose pg_hba.conf line asks for scram-sha-256 or md5, a PgBouncer
+// in front, ...) under every -sslmodes value, -connects times each:
+//   tcp        TCP connect to the server (DNS included)
+//   connect    TCP, SSLRequest, TLS handshake, authentication and
+//              startup: what a new connection costs the application
+//   handshake  connect minus tcp: the TLS and authentication share
+//   first      connect plus the first query
+// The query of the first round trip reads pg_stat_ssl, so the report shows
+// whether TLS was used and which version: sslmode=prefer silently falls
+// back to plaintext when the server has ssl=off. Through a pooler it
+// describes the pooler's server connection, not the client's.
+//
+// Two more rows put the handshake in proportion:
+//   pooled     the same query on a connection kept open, as a pool does:
+//              the handshake is paid once, not per request
+//   transfer   with -transfer, reading that many bytes in one result,
+//              MB/s: the cost of encrypting the data itself
+// The summary gives each case's connect p50 against the sslmode=disable
+// case of the same variant (the TLS cost) and against the first variant
+// at the same sslmode (the authentication method's cost).
+//
+// sslmode=verify-ca and verify-full need sslrootcert in the DSN (or
+// ~/.postgresql/root.crt); a failing mode is reported, not fatal.
+//
+//   go run ./cmd/conn-bench -variant=scram=postgres://app_scram@db1/avro -variant=md5=postgres://app_md5@db1/avro
+//   go run ./cmd/conn-bench -dsn=postgres://dbre@db1/avro -sslmodes=disable,require,verify-full -connects=500
+//   go run ./cmd/conn-bench -variant=direct=postgres://app@db1:5432/avro -variant=pgbouncer=postgres://app@db1:6432/avro -transfer=8MB
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// connBenchCase is one variant under one sslmode.
+type connBenchCase struct {
+	Variant        string        `json:"variant"`
+	SSLMode        string        `json:"sslmode"`
+	Connects       int           `json:"connects"`
+	Errors         int           `json:"errors"`
+	Error          string        `json:"error,omitempty"` // Last error
+	TLS            bool          `json:"tls"`
+	TLSVersion     string        `json:"tls_version,omitempty"`
+	TCPP50         time.Duration `json:"tcp_p50_ns"`
+	ConnectP50     time.Duration `json:"connect_p50_ns"`
+	ConnectP99     time.Duration `json:"connect_p99_ns"`
+	HandshakeP50   time.Duration `json:"handshake_p50_ns"`
+	FirstP50       time.Duration `json:"first_query_p50_ns"`
+	PooledP50      time.Duration `json:"pooled_query_p50_ns"`
+	TransferMBps   float64       `json:"transfer_mb_per_sec,omitempty"`
+	VsPlaintext    time.Duration `json:"connect_vs_disable_ns,omitempty"`       // Connect p50 minus sslmode=disable's
+	VsFirstVariant time.Duration `json:"connect_vs_first_variant_ns,omitempty"` // Connect p50 minus the first variant's
+}
+
+// connBenchVariant is a -variant flag.
+type connBenchVariant struct {
+	name, dsn string
+}
+
+// withSSLMode returns dsn with sslmode set to mode, in either DSN form.
+func withSSLMode(dsn, mode string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set("sslmode", mode)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	return strings.TrimSpace(dsn + " sslmode=" + mode), nil
+}
+
+// measureConnCase times -connects new connections of v under mode, then the
+// pooled query and the transfer on one kept connection.
+func measureConnCase(ctx context.Context, v connBenchVariant, mode string, connects int, transfer int64) connBenchCase {
+	c := connBenchCase{Variant: v.name, SSLMode: mode, Connects: connects}
+	dsn, err := withSSLMode(v.dsn, mode)
+	if err == nil {
+		var cfg *pgx.ConnConfig
+		if cfg, err = pgx.ParseConfig(dsn); err == nil {
+			err = c.run(ctx, cfg, transfer)
+		}
+	}
+	if err != nil {
+		c.Error = err.Error()
+		if c.ConnectP50 == 0 {
+			c.Errors = connects
+		}
+	}
+	return c
+}
+
+// run does the measurements of c with cfg.
+func (c *connBenchCase) run(ctx context.Context, cfg *pgx.ConnConfig, transfer int64) error {
+	cfg.RuntimeParams["application_name"] = "dbre-conn-bench"
+	var tcp time.Duration
+	dialer := &net.Dialer{KeepAlive: 5 * time.Minute}
+	cfg.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, network, addr)
+		tcp = time.Since(start)
+		return conn, err
+	}
+	var tcps, connectLats, handshakes, firsts []float64
+	for i := 0; i < c.Connects && ctx.Err() == nil; i++ {
+		start := time.Now()
+		conn, err := pgx.ConnectConfig(ctx, cfg)
+		if err != nil {
+			c.Errors++
+			c.Error = err.Error()
+			continue
+		}
+		connected := time.Since(start)
+		var version *string
+		err = conn.QueryRow(ctx, "SELECT ssl, version FROM pg_stat_ssl WHERE pid = pg_backend_pid()").Scan(&c.TLS, &version)
+		first := time.Since(start)
+		conn.Close(context.Background())
+		if err != nil {
+			c.Errors++
+			c.Error = err.Error()
+			continue
+		}
+		if version != nil {
+			c.TLSVersion = *version
+		}
+		tcps = append(tcps, float64(tcp))
+		connectLats = append(connectLats, float64(connected))
+		handshakes = append(handshakes, float64(connected-tcp))
+		firsts = append(firsts, float64(first))
+	}
+	if len(connectLats) == 0 {
+		if c.Error == "" {
+			return ctx.Err()
+		}
+		return nil
+	}
+	for _, l := range [][]float64{tcps, connectLats, handshakes, firsts} {
+		sort.Float64s(l)
+	}
+	c.TCPP50 = time.Duration(percentile(tcps, 0.5))
+	c.ConnectP50 = time.Duration(percentile(connectLats, 0.5))
+	c.ConnectP99 = time.Duration(percentile(connectLats, 0.99))
+	c.HandshakeP50 = time.Duration(percentile(handshakes, 0.5))
+	c.FirstP50 = time.Duration(percentile(firsts, 0.5))
+
+	conn, err := pgx.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	var pooled []float64
+	for i := 0; i < c.Connects && ctx.Err() == nil; i++ {
+		start := time.Now()
+		if _, err := conn.Exec(ctx, "SELECT 1"); err != nil {
+			return err
+		}
+		pooled = append(pooled, float64(time.Since(start)))
+	}
+	sort.Float64s(pooled)
+	c.PooledP50 = time.Duration(percentile(pooled, 0.5))
+
+	if transfer > 0 {
+		// Rows of 8 KiB, all read by the client.
+		rows := max(1, transfer/8192)
+		start := time.Now()
+		res, err := conn.Query(ctx, "SELECT repeat('x', 8192) FROM generate_series(1, $1)", rows)
+		if err != nil {
+			return err
+		}
+		var got int64
+		for res.Next() {
+			got += int64(len(res.RawValues()[0]))
+		}
+		if err := res.Err(); err != nil {
+			return err
+		}
+		if secs := time.Since(start).Seconds(); secs > 0 {
+			c.TransferMBps = float64(got) / (1 << 20) / secs
+		}
+	}
+	return nil
+}
+
+// compareConnCases fills in the differences to plaintext and to the first
+// variant.
+func compareConnCases(cases []connBenchCase, firstVariant string) {
+	byKey := map[[2]string]connBenchCase{}
+	for _, c := range cases {
+		byKey[[2]string{c.Variant, c.SSLMode}] = c
+	}
+	for i := range cases {
+		c := &cases[i]
+		if c.ConnectP50 == 0 {
+			continue
+		}
+		if plain, ok := byKey[[2]string{c.Variant, "disable"}]; ok && plain.ConnectP50 > 0 && c.SSLMode != "disable" {
+			c.VsPlaintext = c.ConnectP50 - plain.ConnectP50
+		}
+		if first, ok := byKey[[2]string{firstVariant, c.SSLMode}]; ok && first.ConnectP50 > 0 && c.Variant != firstVariant {
+			c.VsFirstVariant = c.ConnectP50 - first.ConnectP50
+		}
+	}
+}
+
+// printConnBench prints the comparison table.
+func printConnBench(cases []connBenchCase) {
+	us := func(d time.Duration) string {
+		if d == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f", float64(d)/float64(time.Microsecond))
+	}
+	signed := func(d time.Duration) string {
+		if d == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%+.0f", float64(d)/float64(time.Microsecond))
+	}
+	fmt.Printf("\n📋 Connection establishment (µs, p50 unless noted)\n\n")
+	fmt.Printf("   %-14s %-12s %-9s %7s %9s %9s %9s %9s %7s %10s %10s %9s\n", "variant", "sslmode", "tls",
+		"tcp", "handshake", "connect", "p99", "first", "pooled", "vs disable", "vs first", "MB/s")
+	for _, c := range cases {
+		tls := "no"
+		if c.TLS {
+			tls = c.TLSVersion
+		}
+		if c.ConnectP50 == 0 {
+			fmt.Printf("   %-14s %-12s ❌ %s\n", c.Variant, c.SSLMode, oneLine(c.Error, 100))
+			continue
+		}
+		mbps := "-"
+		if c.TransferMBps > 0 {
+			mbps = fmt.Sprintf("%.0f", c.TransferMBps)
+		}
+		fmt.Printf("   %-14s %-12s %-9s %7s %9s %9s %9s %9s %7s %10s %10s %9s", c.Variant, c.SSLMode, tls,
+			us(c.TCPP50), us(c.HandshakeP50), us(c.ConnectP50), us(c.ConnectP99), us(c.FirstP50), us(c.PooledP50),
+			signed(c.VsPlaintext), signed(c.VsFirstVariant), mbps)
+		if c.Errors > 0 {
+			fmt.Printf("  ⚠️  %d/%d failed", c.Errors, c.Connects)
+		}
+		fmt.Println()
+	}
+	fmt.Println()
+}
+
+// ConnBench runs the conn-bench command line tool.
+func ConnBench() {
+	var dsn, sslmodes, transfer, format string
+	var variantFlags stringList
+	var connects int
+	registerDSNFlag(&dsn)
+	flag.Var(&variantFlags, "variant", "name=dsn to measure (repeatable; default: -dsn as \"default\")")
+	flag.StringVar(&sslmodes, "sslmodes", "disable,prefer,require", "sslmode values to compare, comma separated")
+	flag.IntVar(&connects, "connects", 200, "Connections (and pooled queries) per case")
+	flag.StringVar(&transfer, "transfer", "0", "Also read a result this large per case, e.g. 8MB (0: off)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	var variants []connBenchVariant
+	for _, v := range variantFlags {
+		name, d, ok := strings.Cut(v, "=")
+		if !ok || name == "" || strings.Contains(name, "://") {
+			log.Fatalf("invalid -variant %q (use name=dsn)", v)
+		}
+		variants = append(variants, connBenchVariant{name: name, dsn: d})
+	}
+	if len(variants) == 0 {
+		variants = []connBenchVariant{{name: "default", dsn: dsn}}
+	}
+	var modes []string
+	for _, m := range strings.Split(sslmodes, ",") {
+		m = strings.TrimSpace(m)
+		switch m {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+			modes = append(modes, m)
+		default:
+			log.Fatalf("invalid sslmode %q in -sslmodes", m)
+		}
+	}
+	transferBytes, err := parseByteSize(transfer)
+	if err != nil {
+		log.Fatalf("-transfer: %v", err)
+	}
+	if connects < 1 {
+		log.Fatal("-connects must be at least 1")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var cases []connBenchCase
+	for _, v := range variants {
+		for _, m := range modes {
+			if ctx.Err() != nil {
+				break
+			}
+			if format == "text" {
+				fmt.Printf("🔐 %s, sslmode=%s: %d connections\n", v.name, m, connects)
+			}
+			cases = append(cases, measureConnCase(ctx, v, m, connects, transferBytes))
+		}
+	}
+	compareConnCases(cases, variants[0].name)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cases); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printConnBench(cases)
+}
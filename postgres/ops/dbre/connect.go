@@ -0,0 +1,110 @@
+// Package dbre holds the day-2 operations tools for PostgreSQL: audits,
+// monitors and incident helpers that run against a live cluster. Each tool
+// is one entry point here with a thin wrapper under cmd/, the same layout as
+// the bulk loader (postgres/bulk-loading).
+package dbre
+
+// ============================================================================
+// CONNECTION SETTINGS (-dsn, PG* env vars)
+// ============================================================================
+//
+// Shared by every tool:
+//   -dsn="postgres://user@host:5432/avro"   URL or key=value form
+//   DBRE_DSN=...                           the same, for every tool in a shell
+//   (neither)                              libpq environment: PGHOST, PGPORT,
+//                                          PGDATABASE, PGUSER, PGPASSWORD,
+//                                          PGSSLMODE, ~/.pgpass, ...
+// The tools only read catalogs and statistics views unless a flag says
+// otherwise; a role with pg_monitor is enough for them.
+//
+//   go run ./cmd/index-audit -dsn="postgres://dbre@db1/avro"
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// registerDSNFlag adds -dsn, stored in dsn.
+func registerDSNFlag(dsn *string) {
+	flag.StringVar(dsn, "dsn", os.Getenv("DBRE_DSN"), "Connection string (default: DBRE_DSN, then PG* environment variables)")
+}
+
+// connect opens a small pool for tool, shown as application_name, and
+// checks the server answers.
+func connect(ctx context.Context, dsn, tool string, maxConns int32) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string: %w", err)
+	}
+	cfg.MaxConns = maxConns
+	cfg.ConnConfig.RuntimeParams["application_name"] = "dbre-" + tool
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", describeTarget(cfg), err)
+	}
+	return pool, nil
+}
+
+// describeTarget names the server a pool talks to, without the password.
+func describeTarget(cfg *pgxpool.Config) string {
+	c := cfg.ConnConfig
+	return fmt.Sprintf("%s@%s:%d/%s", c.User, c.Host, c.Port, c.Database)
+}
+
+// formatBytes renders b with binary units, e.g. "1.5 GiB".
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// parseByteSize parses sizes like 64MB, 1.5GiB, 2TB or 1048576 (bytes).
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		mult   float64
+	}{
+		{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+	mult := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s, mult = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * mult), nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return fmt.Sprint(*l) }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
@@ -0,0 +1,596 @@
+package dbre
+
+// ============================================================================
+// CONNECTION SATURATION AND PER-ROLE CONNECTIONS (cmd/conns)
+// ============================================================================
+//
+// "FATAL: sorry, too many clients already" is the outage; the slow climb to
+// it is visible hours earlier. conns samples pg_stat_activity every
+// -interval and counts client connections by state, role, application_name
+// and client address against the connections clients may use:
+// max_connections minus superuser_reserved_connections (and
+// reserved_connections, PostgreSQL 16+), and each role's and database's
+// CONNECTION LIMIT. Every interval prints one line:
+//   15:04:05  412/497 (83%)  active 31  idle 344  idle in transaction 37  full in ~1h40m
+// and when conns stops (-duration, or Ctrl-C) it reports:
+//   breakdown   current and peak connections per state, role, application
+//               and client address (-top of each)
+//   leaks       app/role/client groups holding at least -leak-min
+//               connections idle for longer than -leak-idle (idle in
+//               transaction that long is worse: it holds locks and the
+//               xmin horizon), and apps whose connections only ever grew
+//   projection  the least-squares trend of the total over the last -trend
+//               and when it reaches the limit
+// An alert (see alert.go) fires when usage passes -max-pct, when the
+// projection reaches the limit within -within, when a role or database is
+// at 90% of its CONNECTION LIMIT, and on leaks.
+//
+// -once prints the breakdown now and exits with status 2 if an alert fires.
+//
+//   go run ./cmd/conns -interval=30s -leak-idle=1h
+//   go run ./cmd/conns -once -top=20
+//   go run ./cmd/conns -max-pct=80 -within=2h -metrics-addr=:9191 -alert-webhook=https://hooks.slack.com/services/...
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// connLimits are the limits client connections count against.
+type connLimits struct {
+	MaxConnections int            `json:"max_connections"`
+	Reserved       int            `json:"reserved"`
+	Usable         int            `json:"usable"`
+	Roles          map[string]int `json:"role_limits,omitempty"`
+	Databases      map[string]int `json:"database_limits,omitempty"`
+}
+
+func readConnLimits(ctx context.Context, pool *pgxpool.Pool) (connLimits, error) {
+	l := connLimits{Roles: map[string]int{}, Databases: map[string]int{}}
+	err := pool.QueryRow(ctx, `
+		SELECT current_setting('max_connections')::int,
+		       current_setting('superuser_reserved_connections')::int
+		       + coalesce((SELECT setting::int FROM pg_settings WHERE name = 'reserved_connections'), 0)
+	`).Scan(&l.MaxConnections, &l.Reserved)
+	if err != nil {
+		return l, fmt.Errorf("failed to read connection limits: %w", err)
+	}
+	l.Usable = l.MaxConnections - l.Reserved
+	rows, _ := pool.Query(ctx, `
+		SELECT 'role', rolname, rolconnlimit FROM pg_roles WHERE rolcanlogin AND rolconnlimit >= 0
+		UNION ALL
+		SELECT 'database', datname, datconnlimit FROM pg_database WHERE datallowconn AND datconnlimit >= 0
+	`)
+	var kind, name string
+	var limit int
+	_, err = pgx.ForEachRow(rows, []any{&kind, &name, &limit}, func() error {
+		if kind == "role" {
+			l.Roles[name] = limit
+		} else {
+			l.Databases[name] = limit
+		}
+		return nil
+	})
+	if err != nil {
+		return l, fmt.Errorf("failed to read role and database connection limits: %w", err)
+	}
+	return l, nil
+}
+
+// clientConn is one client backend.
+type clientConn struct {
+	Role     string
+	App      string
+	Client   string
+	Database string
+	State    string
+	IdleFor  time.Duration // Since the last state change, when idle
+}
+
+func readClientConns(ctx context.Context, pool *pgxpool.Pool) ([]clientConn, error) {
+	rows, _ := pool.Query(ctx, `
+		SELECT coalesce(usename, ''), coalesce(application_name, ''),
+		       coalesce(host(client_addr), 'local'), coalesce(datname, ''), coalesce(state, 'unknown'),
+		       CASE WHEN state LIKE 'idle%' THEN extract(epoch FROM now() - state_change) ELSE 0 END::float8
+		FROM pg_stat_activity
+		WHERE backend_type = 'client backend'
+	`)
+	var c clientConn
+	var idle float64
+	var conns []clientConn
+	_, err := pgx.ForEachRow(rows, []any{&c.Role, &c.App, &c.Client, &c.Database, &c.State, &idle}, func() error {
+		c.IdleFor = seconds(idle)
+		conns = append(conns, c)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_stat_activity: %w", err)
+	}
+	return conns, nil
+}
+
+// connCount is the current and peak count of one state, role, app or client.
+type connCount struct {
+	Name  string `json:"name"`
+	Now   int    `json:"now"`
+	Peak  int    `json:"peak"`
+	Limit int    `json:"limit,omitempty"` // CONNECTION LIMIT of a role or database
+}
+
+// connLeak is a group of connections that look leaked.
+type connLeak struct {
+	App      string        `json:"application_name"`
+	Role     string        `json:"role"`
+	Client   string        `json:"client"`
+	State    string        `json:"state"`
+	Count    int           `json:"count"`
+	Oldest   time.Duration `json:"oldest_idle_ns,omitempty"`
+	Growth   int           `json:"growth,omitempty"` // For "only grew": last - first
+	Sentence string        `json:"reason"`
+}
+
+// connPoint is the total at one sample, for the trend.
+type connPoint struct {
+	Time  time.Time
+	Total int
+}
+
+// connReport is what conns reports.
+type connReport struct {
+	Server    string        `json:"server"`
+	Limits    connLimits    `json:"limits"`
+	Total     int           `json:"total"`
+	Peak      int           `json:"peak"`
+	Usage     float64       `json:"usage"`
+	States    []connCount   `json:"states"`
+	Roles     []connCount   `json:"roles"`
+	Databases []connCount   `json:"databases"`
+	Apps      []connCount   `json:"applications"`
+	Clients   []connCount   `json:"clients"`
+	Leaks     []connLeak    `json:"leaks"`
+	Growth    float64       `json:"growth_per_hour"`
+	FullIn    time.Duration `json:"full_in_ns,omitempty"` // 0: not growing towards the limit
+}
+
+type connOptions struct {
+	leakIdle time.Duration
+	leakMin  int
+	trend    time.Duration
+	top      int
+}
+
+// connTrack accumulates samples.
+type connTrack struct {
+	opts   connOptions
+	limits connLimits
+	last   []clientConn
+	peak   int
+	points []connPoint               // Within -trend
+	peaks  map[string]map[string]int // Dimension → name → peak
+	apps   map[string][]int          // App → count per point, for "only grew"
+}
+
+// connDimensions names what conns breaks connections down by.
+var connDimensions = []string{"state", "role", "database", "application", "client"}
+
+func (c clientConn) dimension(d string) string {
+	switch d {
+	case "state":
+		return c.State
+	case "role":
+		return c.Role
+	case "database":
+		return c.Database
+	case "application":
+		return c.App
+	}
+	return c.Client
+}
+
+// countConns breaks conns down by dimension d.
+func countConns(conns []clientConn, d string) map[string]int {
+	counts := map[string]int{}
+	for _, c := range conns {
+		counts[c.dimension(d)]++
+	}
+	return counts
+}
+
+// add records one sample.
+func (t *connTrack) add(now time.Time, conns []clientConn) {
+	t.last = conns
+	t.peak = max(t.peak, len(conns))
+	t.points = append(t.points, connPoint{now, len(conns)})
+	drop := 0
+	for drop < len(t.points)-1 && now.Sub(t.points[drop].Time) > t.opts.trend {
+		drop++
+	}
+	t.points = t.points[drop:]
+	if t.peaks == nil {
+		t.peaks = map[string]map[string]int{}
+		t.apps = map[string][]int{}
+	}
+	for _, d := range connDimensions {
+		if t.peaks[d] == nil {
+			t.peaks[d] = map[string]int{}
+		}
+		for name, n := range countConns(conns, d) {
+			t.peaks[d][name] = max(t.peaks[d][name], n)
+		}
+	}
+	counts := countConns(conns, "application")
+	for app := range counts {
+		if _, ok := t.apps[app]; !ok {
+			// Zero for the samples before the app appeared.
+			t.apps[app] = make([]int, drop+len(t.points)-1)
+		}
+	}
+	for app, series := range t.apps {
+		if series = append(series[drop:], counts[app]); slices.Max(series) == 0 {
+			delete(t.apps, app)
+			continue
+		}
+		t.apps[app] = series
+	}
+}
+
+// trend fits the total over the last -trend: growth per second and when
+// the total reaches the usable limit.
+func (t *connTrack) trend() (perSecond float64, fullIn time.Duration) {
+	if len(t.points) < 3 {
+		return 0, 0
+	}
+	last := t.points[len(t.points)-1]
+	pts := t.points
+	if len(pts) < 3 || last.Time.Sub(pts[0].Time) < time.Minute {
+		return 0, 0
+	}
+	var sx, sy, sxx, sxy float64
+	n := float64(len(pts))
+	for _, p := range pts {
+		x, y := p.Time.Sub(pts[0].Time).Seconds(), float64(p.Total)
+		sx, sy, sxx, sxy = sx+x, sy+y, sxx+x*x, sxy+x*y
+	}
+	if den := n*sxx - sx*sx; den != 0 {
+		perSecond = (n*sxy - sx*sy) / den
+	}
+	if perSecond > 0 && last.Total < t.limits.Usable {
+		fullIn = seconds(float64(t.limits.Usable-last.Total) / perSecond)
+	}
+	return perSecond, fullIn
+}
+
+// leaks finds groups idle past -leak-idle and apps that only grew.
+func (t *connTrack) leaks() []connLeak {
+	type key struct{ app, role, client, state string }
+	groups := map[key]*connLeak{}
+	for _, c := range t.last {
+		if !strings.HasPrefix(c.State, "idle") || c.IdleFor < t.opts.leakIdle {
+			continue
+		}
+		k := key{c.App, c.Role, c.Client, c.State}
+		g := groups[k]
+		if g == nil {
+			g = &connLeak{App: c.App, Role: c.Role, Client: c.Client, State: c.State}
+			groups[k] = g
+		}
+		g.Count++
+		g.Oldest = max(g.Oldest, c.IdleFor)
+	}
+	var leaks []connLeak
+	for _, g := range groups {
+		if g.Count < t.opts.leakMin && g.State == "idle" {
+			continue
+		}
+		g.Sentence = fmt.Sprintf("%d connection(s) %s for over %s", g.Count, g.State, formatAge(t.opts.leakIdle))
+		leaks = append(leaks, *g)
+	}
+	for app, series := range t.apps {
+		if len(series) < 3 || series[len(series)-1]-series[0] < t.opts.leakMin {
+			continue
+		}
+		if slices.IsSorted(series) {
+			growth := series[len(series)-1] - series[0]
+			leaks = append(leaks, connLeak{App: app, Count: series[len(series)-1], Growth: growth,
+				Sentence: fmt.Sprintf("grew by %d connections without ever closing any", growth)})
+		}
+	}
+	slices.SortFunc(leaks, func(a, b connLeak) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.App, b.App), cmp.Compare(a.State, b.State))
+	})
+	return leaks
+}
+
+// report builds the report from the samples so far.
+func (t *connTrack) report(server string) *connReport {
+	r := &connReport{Server: server, Limits: t.limits, Total: len(t.last), Peak: t.peak}
+	if t.limits.Usable > 0 {
+		r.Usage = float64(r.Total) / float64(t.limits.Usable)
+	}
+	for _, d := range connDimensions {
+		now := countConns(t.last, d)
+		var counts []connCount
+		for name, peak := range t.peaks[d] {
+			c := connCount{Name: name, Now: now[name], Peak: peak}
+			switch d {
+			case "role":
+				c.Limit = t.limits.Roles[name]
+			case "database":
+				c.Limit = t.limits.Databases[name]
+			}
+			counts = append(counts, c)
+		}
+		slices.SortFunc(counts, func(a, b connCount) int {
+			return cmp.Or(cmp.Compare(b.Now, a.Now), cmp.Compare(b.Peak, a.Peak), cmp.Compare(a.Name, b.Name))
+		})
+		if d != "state" && t.opts.top > 0 && len(counts) > t.opts.top {
+			counts = counts[:t.opts.top]
+		}
+		switch d {
+		case "state":
+			r.States = counts
+		case "role":
+			r.Roles = counts
+		case "database":
+			r.Databases = counts
+		case "application":
+			r.Apps = counts
+		default:
+			r.Clients = counts
+		}
+	}
+	r.Leaks = t.leaks()
+	perSecond, fullIn := t.trend()
+	r.Growth, r.FullIn = perSecond*3600, fullIn
+	return r
+}
+
+// printConnLine writes the one-line summary of a sample.
+func printConnLine(r *connReport) {
+	line := fmt.Sprintf("%s  %d/%d (%.0f%%)", time.Now().Format("15:04:05"), r.Total, r.Limits.Usable, 100*r.Usage)
+	for _, s := range r.States {
+		if s.Now > 0 {
+			line += fmt.Sprintf("  %s %d", s.Name, s.Now)
+		}
+	}
+	if r.FullIn > 0 {
+		line += fmt.Sprintf("  full in ~%s", formatAge(r.FullIn))
+	}
+	fmt.Println("   " + line)
+}
+
+// printConnReport writes the breakdown for a person.
+func printConnReport(r *connReport) {
+	fmt.Printf("\n🔌 Connections on %s: %d of %d usable (%.0f%%), peak %d\n", r.Server, r.Total, r.Limits.Usable, 100*r.Usage, r.Peak)
+	fmt.Printf("   max_connections=%d, %d reserved (superuser_reserved_connections, reserved_connections)\n", r.Limits.MaxConnections, r.Limits.Reserved)
+	table := func(title string, counts []connCount) {
+		if len(counts) == 0 {
+			return
+		}
+		fmt.Printf("\n   %-40s %6s %6s %7s\n", strings.ToUpper(title), "NOW", "PEAK", "LIMIT")
+		for _, c := range counts {
+			name, limit := c.Name, "-"
+			if name == "" {
+				name = "(none)"
+			}
+			if c.Limit > 0 {
+				limit = fmt.Sprint(c.Limit)
+				if c.Now*10 >= c.Limit*9 {
+					limit += " ⚠️"
+				}
+			}
+			fmt.Printf("   %-40s %6d %6d %7s\n", name, c.Now, c.Peak, limit)
+		}
+	}
+	table("state", r.States)
+	table("role", r.Roles)
+	table("database", r.Databases)
+	table("application_name", r.Apps)
+	table("client", r.Clients)
+
+	if len(r.Leaks) > 0 {
+		fmt.Println("\n🚰 Possible leaks:")
+		for _, l := range r.Leaks {
+			app := l.App
+			if app == "" {
+				app = "(no application_name)"
+			}
+			who := app
+			if l.Role != "" {
+				who += fmt.Sprintf(" as %s from %s", l.Role, l.Client)
+			}
+			oldest := ""
+			if l.Oldest > 0 {
+				oldest = fmt.Sprintf(", oldest %s", formatAge(l.Oldest))
+			}
+			fmt.Printf("   %s: %s%s\n", who, l.Sentence, oldest)
+		}
+	}
+	switch {
+	case r.FullIn > 0:
+		fmt.Printf("\n📈 Growing by %.1f connections/hour: the limit is reached in ~%s\n", r.Growth, formatAge(r.FullIn))
+	case len(r.Leaks) == 0 && r.Growth <= 0:
+		fmt.Println("\n✅ No leaks, and connections aren't growing")
+	}
+}
+
+// connMetrics are the gauges conns serves.
+type connMetrics struct {
+	byState, byRole, byApp *prometheus.GaugeVec
+	usable, fullIn         *prometheus.GaugeVec
+}
+
+func newConnMetrics() *connMetrics {
+	return &connMetrics{
+		byState: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_conns_connections", Help: "Client connections by state"}, []string{"server", "state"}),
+		byRole:  prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_conns_role_connections", Help: "Client connections by role"}, []string{"server", "role"}),
+		byApp:   prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_conns_application_connections", Help: "Client connections by application_name"}, []string{"server", "application"}),
+		usable:  prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_conns_usable", Help: "max_connections minus the reserved connections"}, []string{"server"}),
+		fullIn:  prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_conns_full_in_seconds", Help: "Projected time until the usable connections run out (0: not growing)"}, []string{"server"}),
+	}
+}
+
+func (m *connMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.byState, m.byRole, m.byApp, m.usable, m.fullIn}
+}
+
+func (m *connMetrics) set(r *connReport) {
+	m.byState.Reset()
+	m.byRole.Reset()
+	m.byApp.Reset()
+	for _, c := range r.States {
+		m.byState.WithLabelValues(r.Server, c.Name).Set(float64(c.Now))
+	}
+	for _, c := range r.Roles {
+		m.byRole.WithLabelValues(r.Server, c.Name).Set(float64(c.Now))
+	}
+	for _, c := range r.Apps {
+		m.byApp.WithLabelValues(r.Server, c.Name).Set(float64(c.Now))
+	}
+	m.usable.WithLabelValues(r.Server).Set(float64(r.Limits.Usable))
+	m.fullIn.WithLabelValues(r.Server).Set(r.FullIn.Seconds())
+}
+
+// checkConns raises or resolves the alerts for a report.
+func checkConns(alerts *alerter, r *connReport, maxPct float64, within time.Duration) {
+	if maxPct > 0 {
+		alerts.update("conns:usage:"+r.Server, 100*r.Usage > maxPct,
+			fmt.Sprintf("%s uses %d of %d connections (%.0f%%, limit %g%%)", r.Server, r.Total, r.Limits.Usable, 100*r.Usage, maxPct))
+	}
+	if within > 0 {
+		alerts.update("conns:projection:"+r.Server, r.FullIn > 0 && r.FullIn <= within,
+			fmt.Sprintf("%s runs out of connections in ~%s at +%.1f/hour", r.Server, formatAge(r.FullIn), r.Growth))
+	}
+	for _, counts := range [][]connCount{r.Roles, r.Databases} {
+		for _, c := range counts {
+			if c.Limit > 0 {
+				alerts.update("conns:limit:"+r.Server+":"+c.Name, c.Now*10 >= c.Limit*9,
+					fmt.Sprintf("%s on %s has %d of its %d connections", c.Name, r.Server, c.Now, c.Limit))
+			}
+		}
+	}
+	alerts.update("conns:leaks:"+r.Server, len(r.Leaks) > 0,
+		fmt.Sprintf("%s has %d possible connection leak(s)", r.Server, len(r.Leaks)))
+}
+
+// Conns runs the conns command line tool.
+func Conns() {
+	var dsn, format, metricsAddr string
+	var interval, duration, within time.Duration
+	var maxPct float64
+	var once bool
+	var opts connOptions
+	alerts := &alerter{}
+	registerDSNFlag(&dsn)
+	flag.DurationVar(&interval, "interval", 30*time.Second, "Sample interval")
+	flag.DurationVar(&duration, "duration", 0, "Stop and report after this long (0: at Ctrl-C)")
+	flag.DurationVar(&opts.leakIdle, "leak-idle", 30*time.Minute, "Connections idle longer than this may be leaked")
+	flag.IntVar(&opts.leakMin, "leak-min", 5, "Report idle groups and growing apps from this many connections (idle in transaction: any)")
+	flag.DurationVar(&opts.trend, "trend", time.Hour, "Project the limit from the trend over this long")
+	flag.IntVar(&opts.top, "top", 15, "Show this many roles, databases, applications and clients")
+	flag.Float64Var(&maxPct, "max-pct", 80, "Alert above this percentage of the usable connections (0: off)")
+	flag.DurationVar(&within, "within", time.Hour, "Alert when the projection reaches the limit within this long (0: off)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics here, e.g. :9191 (empty: off)")
+	flag.BoolVar(&once, "once", false, "Print the breakdown once and exit, with status 2 if an alert fires")
+	registerAlertFlags(alerts)
+	flag.Parse()
+	if interval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "conns", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	server := describeTarget(pool.Config())
+	t := &connTrack{opts: opts}
+	if t.limits, err = readConnLimits(ctx, pool); err != nil {
+		log.Fatal(err)
+	}
+
+	output := func(r *connReport) {
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(r); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		printConnReport(r)
+	}
+
+	if once {
+		conns, err := readClientConns(ctx, pool)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t.add(time.Now(), conns)
+		r := t.report(server)
+		output(r)
+		checkConns(alerts, r, maxPct, 0)
+		if alerts.active() {
+			stop()
+			os.Exit(2)
+		}
+		return
+	}
+
+	metrics := newConnMetrics()
+	if metricsAddr != "" {
+		serveMetrics(metricsAddr, metrics.collectors()...)
+	}
+	fmt.Fprintf(os.Stderr, "🔌 Watching connections on %s every %v (Ctrl-C to report)\n", server, interval)
+	var deadline <-chan time.Time
+	if duration > 0 {
+		deadline = time.After(duration)
+	}
+sampling:
+	for {
+		conns, err := readClientConns(ctx, pool)
+		if ctx.Err() != nil {
+			break
+		}
+		alerts.update("conns:up:"+server, err != nil, pollMessage("server", server, err))
+		if err == nil {
+			t.add(time.Now(), conns)
+			r := t.report(server)
+			metrics.set(r)
+			if format == "text" {
+				printConnLine(r)
+			}
+			checkConns(alerts, r, maxPct, within)
+		}
+		select {
+		case <-ctx.Done():
+			break sampling
+		case <-deadline:
+			break sampling
+		case <-time.After(interval):
+		}
+	}
+	if t.peaks != nil {
+		output(t.report(server))
+	}
+}
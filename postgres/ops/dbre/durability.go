@@ -0,0 +1,516 @@
+package dbre
+
+// ============================================================================
+// DURABILITY VS LATENCY (cmd/durability)
+// ============================================================================
+//
+// What does each synchronous_commit level cost in commit latency, and what
+// does the cheaper one lose? durability runs the same write workload once
+// per -levels entry: -sessions connections, each SET to the level, insert
+// one row per transaction into -table for -duration. Levels:
+//   off            commit returns before the WAL is flushed; a crash loses
+//                  up to about 3 x wal_writer_delay of acknowledged commits
+//   local          WAL flushed on the primary
+//   remote_write   ... and written (not flushed) by the synchronous standbys
+//   remote_apply   ... and replayed by them: read-your-writes on the standby
+// remote_write and remote_apply are skipped (they wait for nothing more
+// than local) when the primary has no synchronous standby in
+// pg_stat_replication.
+//
+// With -crash-command each level also gets a crash trial: the workload
+// runs for -crash-after, the command crashes and restarts the server under
+// load (e.g. "pg_ctl -D /data stop -m immediate && pg_ctl -D /data start",
+// or "docker restart -t 0 pg1"), and once -dsn answers again the rows that
+// survived are compared with the commits the sessions had been told about:
+//   lost      acknowledged commits missing after the restart
+//   window    from the first lost commit's acknowledgement to the last
+//             acknowledgement: how much acknowledged work a crash erased
+//   recovery  crash command start to -dsn answering again
+// Only use it against a server you can afford to crash. Exit code 2 when a
+// level other than off lost an acknowledged commit, which is a durability
+// bug (fsync off, a lying disk cache, ...), not a trade-off.
+//
+// Rows go to -table (created if missing, the run's rows deleted at exit
+// unless -keep). The report is a table of commit latency percentiles and
+// throughput per level, relative to local.
+//
+//   go run ./cmd/durability -dsn=postgres://dbre@db1/avro -duration=1m -sessions=16
+//   go run ./cmd/durability -levels=off,local -crash-command="docker restart -t 0 pg-scratch" -crash-after=20s
+//   go run ./cmd/durability -format=json > durability.json
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// durabilityLevels are the synchronous_commit values, weakest first.
+var durabilityLevels = []string{"off", "local", "remote_write", "remote_apply"}
+
+// durabilityOptions are the command line settings.
+type durabilityOptions struct {
+	levels               []string
+	sessions, payload    int
+	duration, crashAfter time.Duration
+	recoveryTimeout      time.Duration
+	crashCommand, table  string
+	keep                 bool
+}
+
+// durabilityCrash is the outcome of a crash trial.
+type durabilityCrash struct {
+	Acked      int64         `json:"acked"`
+	Lost       int64         `json:"lost"`
+	LossWindow time.Duration `json:"loss_window_ns"`
+	Recovery   time.Duration `json:"recovery_ns"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// durabilityLevel is the result of one synchronous_commit level.
+type durabilityLevel struct {
+	Level      string           `json:"level"`
+	Commits    int64            `json:"commits"`
+	Errors     int64            `json:"errors"`
+	TPS        float64          `json:"commits_per_sec"`
+	P50        time.Duration    `json:"commit_p50_ns"`
+	P95        time.Duration    `json:"commit_p95_ns"`
+	P99        time.Duration    `json:"commit_p99_ns"`
+	P999       time.Duration    `json:"commit_p999_ns"`
+	Max        time.Duration    `json:"commit_max_ns"`
+	VsLocalP50 float64          `json:"p50_vs_local,omitempty"` // P50 / local's P50
+	VsLocalTPS float64          `json:"tps_vs_local,omitempty"`
+	Crash      *durabilityCrash `json:"crash,omitempty"`
+}
+
+// durabilityReport is the comparison.
+type durabilityReport struct {
+	Primary      string            `json:"primary"`
+	RunID        string            `json:"run_id"`
+	Sessions     int               `json:"sessions"`
+	Duration     time.Duration     `json:"duration_ns"`
+	SyncStandbys []string          `json:"sync_standbys"`
+	Levels       []durabilityLevel `json:"levels"`
+	Skipped      []string          `json:"skipped,omitempty"`
+	Failed       bool              `json:"failed"`
+	Reasons      []string          `json:"reasons,omitempty"`
+}
+
+// durabilityTrial is what the sessions of one trial recorded.
+type durabilityTrial struct {
+	mu     sync.Mutex
+	lats   []float64     // ns
+	acked  [][]time.Time // Per session, acknowledgement time of seq i+1
+	errors int64
+}
+
+// durabilityBench runs the trials.
+type durabilityBench struct {
+	opts    durabilityOptions
+	pool    *pgxpool.Pool
+	table   string // Sanitized
+	runID   string
+	payload string
+	verbose bool
+}
+
+// setup creates the table if it doesn't exist.
+func (b *durabilityBench) setup(ctx context.Context) error {
+	var exists bool
+	if err := b.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", b.opts.table).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	_, err := b.pool.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE %s (
+			run_id  text NOT NULL,
+			trial   text NOT NULL,
+			session int NOT NULL,
+			seq     bigint NOT NULL,
+			payload text,
+			PRIMARY KEY (run_id, trial, session, seq)
+		)`, b.table))
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", b.table, err)
+	}
+	return nil
+}
+
+// syncStandbys lists the standbys a remote_* commit waits for.
+func (b *durabilityBench) syncStandbys(ctx context.Context) ([]string, error) {
+	rows, err := b.pool.Query(ctx, `
+		SELECT coalesce(nullif(application_name, ''), client_addr::text, 'pid ' || pid)
+		FROM pg_stat_replication
+		WHERE sync_state IN ('sync', 'quorum')
+		ORDER BY 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// session inserts rows at level until ctx ends or, with stopOnError, the
+// first failure.
+func (b *durabilityBench) session(ctx context.Context, id int, level, trial string, stopOnError bool, t *durabilityTrial) {
+	conn, err := b.pool.Acquire(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			t.mu.Lock()
+			t.errors++
+			t.mu.Unlock()
+		}
+		return
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, "SELECT set_config('synchronous_commit', $1, false)", level); err != nil {
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Session %d: synchronous_commit=%s: %v\n", id, level, err)
+		}
+		return
+	}
+	sql := "INSERT INTO " + b.table + " (run_id, trial, session, seq, payload) VALUES ($1, $2, $3, $4, $5)"
+	var acked []time.Time
+	var lats []float64
+	defer func() {
+		t.mu.Lock()
+		t.acked[id] = acked
+		t.lats = append(t.lats, lats...)
+		t.mu.Unlock()
+	}()
+	for seq := int64(1); ctx.Err() == nil; {
+		start := time.Now()
+		_, err := conn.Exec(ctx, sql, b.runID, trial, id, seq, b.payload)
+		end := time.Now()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			t.mu.Lock()
+			t.errors++
+			t.mu.Unlock()
+			if stopOnError || conn.Conn().IsClosed() {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		acked = append(acked, end)
+		lats = append(lats, float64(end.Sub(start)))
+		seq++
+	}
+}
+
+// trial runs the sessions at level for d; with crash, it runs the crash
+// command after -crash-after and stops each session at its first error.
+func (b *durabilityBench) trial(ctx context.Context, level, trial string, d time.Duration, crash bool) (*durabilityTrial, *durabilityCrash) {
+	t := &durabilityTrial{acked: make([][]time.Time, b.opts.sessions)}
+	runCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < b.opts.sessions; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			b.session(runCtx, id, level, trial, crash, t)
+		}(i)
+	}
+	if !crash {
+		wg.Wait()
+		return t, nil
+	}
+
+	c := &durabilityCrash{}
+	var problems []string
+	defer func() { c.Error = strings.Join(problems, "; ") }()
+	select {
+	case <-ctx.Done():
+		cancel()
+		wg.Wait()
+		return t, nil
+	case <-time.After(b.opts.crashAfter):
+	}
+	if b.verbose {
+		fmt.Printf("💥 %s: running the crash command\n", level)
+	}
+	crashStart := time.Now()
+	out, err := exec.CommandContext(ctx, "sh", "-c", b.opts.crashCommand).CombinedOutput()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("crash command: %v: %s", err, lastLines(string(out), 3)))
+	}
+	// Sessions the crash didn't reach (a pooler in between, a failed
+	// command) stop here.
+	cancel()
+	wg.Wait()
+	if err := b.waitRecovery(ctx); err != nil {
+		problems = append(problems, err.Error())
+		return t, c
+	}
+	c.Recovery = time.Since(crashStart)
+	if err := b.countLost(ctx, trial, t, c); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return t, c
+}
+
+// waitRecovery waits until -dsn answers again.
+func (b *durabilityBench) waitRecovery(ctx context.Context) error {
+	deadline := time.Now().Add(b.opts.recoveryTimeout)
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := b.pool.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || time.Now().After(deadline) {
+			return fmt.Errorf("server not back after %v: %w", b.opts.recoveryTimeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// countLost compares the acknowledged commits with the surviving rows. A
+// session commits in sequence, so its survivors are 1..max(seq).
+func (b *durabilityBench) countLost(ctx context.Context, trial string, t *durabilityTrial, c *durabilityCrash) error {
+	rows, err := b.pool.Query(ctx, "SELECT session, max(seq) FROM "+b.table+" WHERE run_id = $1 AND trial = $2 GROUP BY session",
+		b.runID, trial)
+	if err != nil {
+		return fmt.Errorf("counting survivors: %w", err)
+	}
+	survived := map[int]int64{}
+	var session int
+	var seq int64
+	if _, err := pgx.ForEachRow(rows, []any{&session, &seq}, func() error {
+		survived[session] = seq
+		return nil
+	}); err != nil {
+		return fmt.Errorf("counting survivors: %w", err)
+	}
+	var firstLost, lastAck time.Time
+	for id, acked := range t.acked {
+		c.Acked += int64(len(acked))
+		if n := len(acked); n > 0 && acked[n-1].After(lastAck) {
+			lastAck = acked[n-1]
+		}
+		kept := min(survived[id], int64(len(acked)))
+		if lost := int64(len(acked)) - kept; lost > 0 {
+			c.Lost += lost
+			if at := acked[kept]; firstLost.IsZero() || at.Before(firstLost) {
+				firstLost = at
+			}
+		}
+	}
+	if c.Lost > 0 {
+		c.LossWindow = lastAck.Sub(firstLost)
+	}
+	return nil
+}
+
+// runLevel measures one level, then crashes it when asked to.
+func (b *durabilityBench) runLevel(ctx context.Context, level string) durabilityLevel {
+	r := durabilityLevel{Level: level}
+	if b.verbose {
+		fmt.Printf("⏱️  synchronous_commit=%s: %d sessions for %v\n", level, b.opts.sessions, b.opts.duration)
+	}
+	start := time.Now()
+	t, _ := b.trial(ctx, level, level, b.opts.duration, false)
+	elapsed := time.Since(start).Seconds()
+	r.Commits, r.Errors = int64(len(t.lats)), t.errors
+	if elapsed > 0 {
+		r.TPS = float64(r.Commits) / elapsed
+	}
+	if n := len(t.lats); n > 0 {
+		sort.Float64s(t.lats)
+		r.P50 = time.Duration(percentile(t.lats, 0.5))
+		r.P95 = time.Duration(percentile(t.lats, 0.95))
+		r.P99 = time.Duration(percentile(t.lats, 0.99))
+		r.P999 = time.Duration(percentile(t.lats, 0.999))
+		r.Max = time.Duration(t.lats[n-1])
+	}
+	if b.opts.crashCommand != "" && ctx.Err() == nil {
+		// Long enough for the crash command and the sessions to notice.
+		_, r.Crash = b.trial(ctx, level, level+" crash", b.opts.crashAfter+b.opts.recoveryTimeout, true)
+	}
+	return r
+}
+
+// cleanup deletes the run's rows.
+func (b *durabilityBench) cleanup(ctx context.Context) {
+	if _, err := b.pool.Exec(ctx, "DELETE FROM "+b.table+" WHERE run_id = $1", b.runID); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Deleting the rows of run %s: %v\n", b.runID, err)
+	}
+}
+
+// compare fills in the ratios to local and the verdict.
+func (r *durabilityReport) compare() {
+	var local *durabilityLevel
+	for i := range r.Levels {
+		if r.Levels[i].Level == "local" {
+			local = &r.Levels[i]
+		}
+	}
+	for i := range r.Levels {
+		l := &r.Levels[i]
+		if local != nil && local.P50 > 0 && local.TPS > 0 {
+			l.VsLocalP50 = float64(l.P50) / float64(local.P50)
+			l.VsLocalTPS = l.TPS / local.TPS
+		}
+		if l.Crash == nil {
+			continue
+		}
+		if l.Crash.Error != "" {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("%s crash trial: %s", l.Level, l.Crash.Error))
+		} else if l.Crash.Lost > 0 && l.Level != "off" {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("synchronous_commit=%s lost %d acknowledged commit(s) in a crash",
+				l.Level, l.Crash.Lost))
+		}
+	}
+	r.Failed = len(r.Reasons) > 0
+}
+
+// printDurabilityReport prints the comparison table.
+func printDurabilityReport(r *durabilityReport) {
+	fmt.Printf("\n📋 Durability vs latency on %s (%d sessions, %v per level)\n", r.Primary, r.Sessions, r.Duration)
+	if len(r.SyncStandbys) > 0 {
+		fmt.Printf("   Synchronous standbys: %s\n", strings.Join(r.SyncStandbys, ", "))
+	}
+	ms := func(d time.Duration) string { return fmt.Sprintf("%.2f", float64(d)/float64(time.Millisecond)) }
+	fmt.Printf("\n   %-13s %9s %9s %8s %8s %8s %8s %8s %9s %9s\n",
+		"level", "commits", "tps", "p50 ms", "p95 ms", "p99 ms", "p99.9 ms", "max ms", "p50/local", "tps/local")
+	for _, l := range r.Levels {
+		fmt.Printf("   %-13s %9d %9.0f %8s %8s %8s %8s %8s", l.Level, l.Commits, l.TPS,
+			ms(l.P50), ms(l.P95), ms(l.P99), ms(l.P999), ms(l.Max))
+		if l.VsLocalP50 > 0 {
+			fmt.Printf(" %8.2fx %8.2fx", l.VsLocalP50, l.VsLocalTPS)
+		}
+		if l.Errors > 0 {
+			fmt.Printf("  ⚠️  %d errors", l.Errors)
+		}
+		fmt.Println()
+	}
+	if slices.ContainsFunc(r.Levels, func(l durabilityLevel) bool { return l.Crash != nil }) {
+		fmt.Printf("\n   %-13s %9s %9s %12s %10s\n", "crash trial", "acked", "lost", "window", "recovery")
+		for _, l := range r.Levels {
+			if c := l.Crash; c != nil {
+				fmt.Printf("   %-13s %9d %9d %12v %10v", l.Level, c.Acked, c.Lost,
+					c.LossWindow.Round(time.Millisecond), c.Recovery.Round(100*time.Millisecond))
+				if c.Error != "" {
+					fmt.Printf("  ⚠️  %s", c.Error)
+				}
+				fmt.Println()
+			}
+		}
+	}
+	for _, s := range r.Skipped {
+		fmt.Printf("   ⏭️  %s\n", s)
+	}
+	fmt.Println()
+	for _, reason := range r.Reasons {
+		fmt.Printf("❌ %s\n", reason)
+	}
+}
+
+// Durability runs the durability command line tool.
+func Durability() {
+	var dsn, levels, format string
+	var opts durabilityOptions
+	registerDSNFlag(&dsn)
+	flag.StringVar(&levels, "levels", strings.Join(durabilityLevels, ","), "synchronous_commit levels to compare, comma separated")
+	flag.IntVar(&opts.sessions, "sessions", 8, "Concurrent writing sessions")
+	flag.DurationVar(&opts.duration, "duration", time.Minute, "Workload time per level")
+	flag.IntVar(&opts.payload, "payload", 256, "Bytes of payload per row")
+	flag.StringVar(&opts.table, "table", "dbre_durability", "Table written to (created if missing)")
+	flag.BoolVar(&opts.keep, "keep", false, "Keep the run's rows")
+	flag.StringVar(&opts.crashCommand, "crash-command", "", "Shell command that crashes and restarts the server, for a crash trial per level (empty: no crash trials)")
+	flag.DurationVar(&opts.crashAfter, "crash-after", 15*time.Second, "Workload time before the crash command")
+	flag.DurationVar(&opts.recoveryTimeout, "recovery-timeout", 2*time.Minute, "Give up when the server doesn't answer this long after a crash")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	for _, l := range strings.Split(levels, ",") {
+		l = strings.TrimSpace(l)
+		if !slices.Contains(durabilityLevels, l) {
+			log.Fatalf("invalid level %q in -levels (use %s)", l, strings.Join(durabilityLevels, ", "))
+		}
+		opts.levels = append(opts.levels, l)
+	}
+	if opts.sessions < 1 || opts.duration <= 0 || opts.payload < 0 {
+		log.Fatal("-sessions and -duration must be positive, -payload not negative")
+	}
+	if opts.crashCommand != "" && (opts.crashAfter <= 0 || opts.recoveryTimeout <= 0) {
+		log.Fatal("-crash-after and -recovery-timeout must be positive")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "durability", int32(opts.sessions+1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	b := &durabilityBench{
+		opts:    opts,
+		pool:    pool,
+		table:   pgx.Identifier(strings.Split(opts.table, ".")).Sanitize(),
+		runID:   fmt.Sprintf("%s-%d", time.Now().Format("20060102T150405"), os.Getpid()),
+		payload: strings.Repeat("x", opts.payload),
+		verbose: format == "text",
+	}
+	if err := b.setup(ctx); err != nil {
+		log.Fatal(err)
+	}
+	report := durabilityReport{Primary: describeTarget(pool.Config()), RunID: b.runID, Sessions: opts.sessions, Duration: opts.duration}
+	if report.SyncStandbys, err = b.syncStandbys(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if opts.crashCommand != "" && b.verbose {
+		fmt.Printf("⚠️  Crash trials will run %q %d time(s)\n", opts.crashCommand, len(opts.levels))
+	}
+
+	for _, level := range opts.levels {
+		if strings.HasPrefix(level, "remote_") && len(report.SyncStandbys) == 0 {
+			report.Skipped = append(report.Skipped, level+": no synchronous standby, it would wait no longer than local")
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		report.Levels = append(report.Levels, b.runLevel(ctx, level))
+	}
+	if !opts.keep {
+		b.cleanup(context.Background())
+	}
+	report.compare()
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printDurabilityReport(&report)
+	}
+	if report.Failed {
+		pool.Close()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,509 @@
+package dbre
+
+// ============================================================================
+// AUTO_EXPLAIN LOG PARSER AND PLAN REGRESSIONS (cmd/explainlog)
+// ============================================================================
+//
+// auto_explain logs the plan of every statement slower than
+// auto_explain.log_min_duration, but a week of server log is too much to
+// read. explainlog parses those entries from log files (stderr format
+// with any log_line_prefix, or jsonlog; .gz files too) in text or JSON
+// log_format, and groups them:
+//   by query      the fingerprint of the query text (package
+//                 sqlfingerprint: the same topqueries reports)
+//   by plan       the structure hash of the plan (package planhash: the
+//                 same the stress tool's plan monitor records), so a query
+//                 that switched plans shows two or more hashes
+// and reports for the window (-since, -until):
+//   plan changes  queries logged with more than one plan: each plan's
+//                 count, mean and max duration and when it was first and
+//                 last seen; REGRESSED when a plan's mean is -regress times
+//                 that of the query's first plan
+//   slowest       the -top queries by their slowest execution, with that
+//                 execution's plan
+// Timestamps come from the log line (%m or %t in log_line_prefix), the
+// user and database from "user@db" or "user=..,db=.." in it when present.
+// No database connection is needed.
+//
+//   go run ./cmd/explainlog /var/log/postgresql/postgresql-*.log
+//   go run ./cmd/explainlog -since=24h -regress=3 -db=avro postgresql.log.1.gz
+//   go run ./cmd/explainlog -format=json postgresql.json > plans.json
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/planhash"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/sqlfingerprint"
+)
+
+// explainEntry is one auto_explain entry.
+type explainEntry struct {
+	Time        time.Time `json:"time"`
+	Source      string    `json:"source"` // file:line
+	User        string    `json:"user,omitempty"`
+	Database    string    `json:"database,omitempty"`
+	DurationMS  float64   `json:"duration_ms"`
+	Query       string    `json:"query"`
+	Plan        string    `json:"plan"`
+	Fingerprint string    `json:"fingerprint"`
+	PlanHash    string    `json:"plan_hash"`
+}
+
+var (
+	autoExplainRe = regexp.MustCompile(`(?s)duration: ([0-9.]+) ms\s+plan:\s*(.*)`)
+	planLineRe    = regexp.MustCompile(`\s\((cost=[0-9]|actual |never executed)`)
+	logTimeRe     = regexp.MustCompile(`(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:\.\d+)?)(?: ?([A-Z]{2,5}|[+-]\d{2}(?::?\d{2})?))?`)
+	userAtDBRe    = regexp.MustCompile(`\s([\w.-]+)@([\w.-]+)\s`)
+	userRe        = regexp.MustCompile(`user=([^,\s]+)`)
+	dbRe          = regexp.MustCompile(`(?:db|database)=([^,\s]+)`)
+)
+
+// parseAutoExplain reads an auto_explain message ("duration: 12.3 ms
+// plan: ..." without the log line prefix) into e. ok is false for other
+// messages; an error means an auto_explain entry that couldn't be read
+// (YAML or XML log_format, or a plan cut off).
+func parseAutoExplain(message string, e *explainEntry) (ok bool, err error) {
+	m := autoExplainRe.FindStringSubmatch(message)
+	if m == nil {
+		return false, nil
+	}
+	if e.DurationMS, err = strconv.ParseFloat(m[1], 64); err != nil {
+		return true, err
+	}
+	body := strings.TrimSpace(m[2])
+
+	if strings.HasPrefix(body, "{") {
+		var doc struct {
+			Query string          `json:"Query Text"`
+			Plan  json.RawMessage `json:"Plan"`
+		}
+		if err := json.Unmarshal([]byte(body), &doc); err != nil {
+			return true, fmt.Errorf("JSON plan: %w", err)
+		}
+		e.Query = doc.Query
+		if e.Plan, err = planhash.TextFromJSON(doc.Plan); err != nil {
+			return true, err
+		}
+	} else {
+		var query, plan []string
+		inPlan := false
+		for _, line := range strings.Split(body, "\n") {
+			switch {
+			case inPlan:
+				plan = append(plan, line)
+			case planLineRe.MatchString(line):
+				inPlan = true
+				plan = append(plan, line)
+			case strings.HasPrefix(line, "Query Text: "):
+				query = append(query, strings.TrimPrefix(line, "Query Text: "))
+			case strings.HasPrefix(line, "Query Parameters: "):
+			case len(query) > 0:
+				query = append(query, line)
+			default:
+				return true, fmt.Errorf("unsupported auto_explain.log_format (text and json are)")
+			}
+		}
+		if len(plan) == 0 {
+			return true, fmt.Errorf("no plan in the entry")
+		}
+		e.Query, e.Plan = strings.Join(query, "\n"), strings.Join(plan, "\n")
+	}
+	e.Fingerprint = sqlfingerprint.Fingerprint(e.Query)
+	e.PlanHash = planhash.Hash(e.Plan)
+	return true, nil
+}
+
+// parseLogTime reads the timestamp of a log line prefix.
+func parseLogTime(prefix string) time.Time {
+	m := logTimeRe.FindStringSubmatch(prefix)
+	if m == nil {
+		return time.Time{}
+	}
+	loc := time.Local
+	switch zone := m[2]; {
+	case zone == "UTC" || zone == "GMT":
+		loc = time.UTC
+	case strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-"):
+		digits := strings.ReplaceAll(zone[1:], ":", "")
+		hours, _ := strconv.Atoi(digits[:2])
+		minutes := 0
+		if len(digits) == 4 {
+			minutes, _ = strconv.Atoi(digits[2:])
+		}
+		offset := hours*3600 + minutes*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone(zone, offset)
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", strings.Replace(m[1], "T", " ", 1), loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// explainLogStats counts what scanning the logs found.
+type explainLogStats struct {
+	Lines    int `json:"lines"`
+	Entries  int `json:"entries"`
+	Skipped  int `json:"skipped"` // Entries that couldn't be read
+	Filtered int `json:"filtered"`
+}
+
+// scanExplainLog calls fn for every auto_explain entry in r, a stderr or
+// jsonlog server log.
+func scanExplainLog(r io.Reader, name string, stats *explainLogStats, fn func(*explainEntry)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 1<<20), 64<<20)
+	var header string
+	var body []string
+	var start int
+
+	flush := func() {
+		if header == "" {
+			return
+		}
+		_, message, found := strings.Cut(header, "LOG:  ")
+		if !found {
+			return
+		}
+		e := &explainEntry{Source: fmt.Sprintf("%s:%d", name, start)}
+		if len(body) > 0 {
+			message += "\n" + strings.Join(body, "\n")
+		}
+		ok, err := parseAutoExplain(message, e)
+		if !ok {
+			return
+		}
+		stats.Entries++
+		if err != nil {
+			stats.Skipped++
+			fmt.Fprintf(os.Stderr, "⚠️  %s: %v\n", e.Source, err)
+			return
+		}
+		prefix := header[:strings.Index(header, "LOG:  ")]
+		e.Time = parseLogTime(prefix)
+		if m := userAtDBRe.FindStringSubmatch(" " + prefix + " "); m != nil {
+			e.User, e.Database = m[1], m[2]
+		}
+		if m := userRe.FindStringSubmatch(prefix); m != nil {
+			e.User = m[1]
+		}
+		if m := dbRe.FindStringSubmatch(prefix); m != nil {
+			e.Database = m[1]
+		}
+		fn(e)
+	}
+
+	for sc.Scan() {
+		stats.Lines++
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			// Continuation of a multi-line message.
+			body = append(body, line[1:])
+		case strings.HasPrefix(line, "{"):
+			flush()
+			header, body = "", nil
+			var rec struct {
+				Timestamp string `json:"timestamp"`
+				User      string `json:"user"`
+				Database  string `json:"dbname"`
+				Severity  string `json:"error_severity"`
+				Message   string `json:"message"`
+			}
+			if json.Unmarshal([]byte(line), &rec) != nil || rec.Severity != "LOG" {
+				continue
+			}
+			e := &explainEntry{Source: fmt.Sprintf("%s:%d", name, stats.Lines), User: rec.User, Database: rec.Database}
+			ok, err := parseAutoExplain(rec.Message, e)
+			if !ok {
+				continue
+			}
+			stats.Entries++
+			if err != nil {
+				stats.Skipped++
+				fmt.Fprintf(os.Stderr, "⚠️  %s: %v\n", e.Source, err)
+				continue
+			}
+			e.Time = parseLogTime(rec.Timestamp)
+			fn(e)
+		default:
+			flush()
+			header, body, start = line, nil, stats.Lines
+		}
+	}
+	flush()
+	return sc.Err()
+}
+
+// planVariant is one plan of a query.
+type planVariant struct {
+	Hash      string        `json:"plan_hash"`
+	Count     int           `json:"count"`
+	MeanMS    float64       `json:"mean_ms"`
+	MaxMS     float64       `json:"max_ms"`
+	First     time.Time     `json:"first_seen"`
+	Last      time.Time     `json:"last_seen"`
+	Regressed bool          `json:"regressed"`
+	Slowest   *explainEntry `json:"slowest"`
+	totalMS   float64
+}
+
+// queryPlans is everything logged for one fingerprint.
+type queryPlans struct {
+	Fingerprint string         `json:"fingerprint"`
+	Query       string         `json:"query"`
+	Database    string         `json:"database,omitempty"`
+	Count       int            `json:"count"`
+	TotalMS     float64        `json:"total_ms"`
+	MaxMS       float64        `json:"max_ms"`
+	Plans       []*planVariant `json:"plans"` // In the order first seen
+	Slowest     *explainEntry  `json:"slowest"`
+}
+
+// add counts e.
+func (q *queryPlans) add(e *explainEntry) {
+	q.Count++
+	q.TotalMS += e.DurationMS
+	if e.DurationMS > q.MaxMS || q.Slowest == nil {
+		q.MaxMS, q.Slowest = e.DurationMS, e
+	}
+	var p *planVariant
+	for _, v := range q.Plans {
+		if v.Hash == e.PlanHash {
+			p = v
+		}
+	}
+	if p == nil {
+		p = &planVariant{Hash: e.PlanHash, First: e.Time}
+		q.Plans = append(q.Plans, p)
+	}
+	p.Count++
+	p.totalMS += e.DurationMS
+	p.MeanMS = p.totalMS / float64(p.Count)
+	if e.DurationMS > p.MaxMS || p.Slowest == nil {
+		p.MaxMS, p.Slowest = e.DurationMS, e
+	}
+	if e.Time.Before(p.First) {
+		p.First = e.Time
+	}
+	if e.Time.After(p.Last) {
+		p.Last = e.Time
+	}
+}
+
+// explainReport is what explainlog reports.
+type explainReport struct {
+	Stats   explainLogStats `json:"stats"`
+	From    time.Time       `json:"from"`
+	To      time.Time       `json:"to"`
+	Queries int             `json:"queries"`
+	Changes []*queryPlans   `json:"plan_changes"`
+	Slowest []*queryPlans   `json:"slowest"`
+}
+
+// buildExplainReport groups the entries by fingerprint and plan.
+func buildExplainReport(entries []*explainEntry, stats explainLogStats, top int, regress float64) *explainReport {
+	r := &explainReport{Stats: stats}
+	byQuery := map[string]*queryPlans{}
+	var queries []*queryPlans
+	// Oldest first, so each query's plans are in the order they appeared.
+	slices.SortStableFunc(entries, func(a, b *explainEntry) int { return a.Time.Compare(b.Time) })
+	for _, e := range entries {
+		key := e.Database + "/" + e.Fingerprint
+		q := byQuery[key]
+		if q == nil {
+			q = &queryPlans{Fingerprint: e.Fingerprint, Query: e.Query, Database: e.Database}
+			byQuery[key] = q
+			queries = append(queries, q)
+		}
+		q.add(e)
+		if r.From.IsZero() || e.Time.Before(r.From) {
+			r.From = e.Time
+		}
+		if e.Time.After(r.To) {
+			r.To = e.Time
+		}
+	}
+	r.Queries = len(queries)
+
+	for _, q := range queries {
+		if len(q.Plans) < 2 {
+			continue
+		}
+		for _, p := range q.Plans[1:] {
+			p.Regressed = regress > 0 && p.MeanMS >= regress*q.Plans[0].MeanMS
+		}
+		r.Changes = append(r.Changes, q)
+	}
+	slices.SortFunc(r.Changes, func(a, b *queryPlans) int {
+		return cmp.Or(cmp.Compare(b.TotalMS, a.TotalMS), cmp.Compare(a.Fingerprint, b.Fingerprint))
+	})
+	r.Slowest = slices.Clone(queries)
+	slices.SortFunc(r.Slowest, func(a, b *queryPlans) int {
+		return cmp.Or(cmp.Compare(b.MaxMS, a.MaxMS), cmp.Compare(a.Fingerprint, b.Fingerprint))
+	})
+	r.Slowest = r.Slowest[:min(len(r.Slowest), top)]
+	return r
+}
+
+// printExplainReport writes the report for a person.
+func printExplainReport(r *explainReport) {
+	fmt.Printf("🔬 %d auto_explain entries (%d unreadable, %d outside the window) in %d log lines",
+		r.Stats.Entries, r.Stats.Skipped, r.Stats.Filtered, r.Stats.Lines)
+	if !r.From.IsZero() {
+		fmt.Printf(", %s to %s", r.From.Format("2006-01-02 15:04:05"), r.To.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf(": %d queries\n", r.Queries)
+
+	if len(r.Changes) == 0 {
+		fmt.Println("\n✅ No query was logged with more than one plan")
+	} else {
+		fmt.Printf("\nPLAN CHANGES\n")
+		for _, q := range r.Changes {
+			fmt.Printf("\n   %s %s: %s\n", q.Fingerprint, q.Database, oneLine(q.Query, 100))
+			fmt.Printf("   %-10s %8s %12s %12s  %-19s  %-19s\n", "PLAN", "COUNT", "MEAN ms", "MAX ms", "FIRST SEEN", "LAST SEEN")
+			for _, p := range q.Plans {
+				mark := ""
+				if p.Regressed {
+					mark = fmt.Sprintf("  🐢 REGRESSED %.1fx", p.MeanMS/q.Plans[0].MeanMS)
+				}
+				fmt.Printf("   %-10.8s %8d %12.1f %12.1f  %-19s  %-19s%s\n", p.Hash, p.Count, p.MeanMS, p.MaxMS,
+					p.First.Format("2006-01-02 15:04:05"), p.Last.Format("2006-01-02 15:04:05"), mark)
+			}
+			for _, p := range q.Plans {
+				fmt.Printf("      %.8s: %s\n", p.Hash, strings.Join(planhash.Structure(p.Slowest.Plan), " | "))
+			}
+		}
+	}
+
+	if len(r.Slowest) > 0 {
+		fmt.Printf("\nSLOWEST\n")
+	}
+	for _, q := range r.Slowest {
+		fmt.Printf("\n   %.1f ms  %s %s (%d logged, plan %.8s, %s)\n   %s\n", q.MaxMS, q.Fingerprint, q.Database,
+			q.Count, q.Slowest.PlanHash, q.Slowest.Source, oneLine(q.Query, 100))
+		for _, line := range strings.Split(strings.TrimRight(q.Slowest.Plan, "\n"), "\n") {
+			fmt.Printf("      %s\n", line)
+		}
+	}
+}
+
+// parseSince reads -since and -until: a time, or a duration before now.
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use e.g. 24h, 2026-10-17 09:00 or RFC 3339)", s)
+}
+
+// openLog opens a log file, "-" for stdin, decompressing .gz.
+func openLog(name string) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+// ExplainLog runs the explainlog command line tool.
+func ExplainLog() {
+	var sinceFlag, untilFlag, database, format string
+	var top int
+	var regress float64
+	flag.StringVar(&sinceFlag, "since", "", "Only entries from this time, or this long ago (e.g. 24h)")
+	flag.StringVar(&untilFlag, "until", "", "Only entries before this time, or this long ago")
+	flag.StringVar(&database, "db", "", "Only entries of this database")
+	flag.IntVar(&top, "top", 10, "Show this many slowest queries, with their plans")
+	flag.Float64Var(&regress, "regress", 2, "A plan is REGRESSED when its mean is this many times the first plan's (0: off)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: explainlog [flags] LOGFILE... (- for stdin)\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	since, err := parseSince(sinceFlag)
+	if err != nil {
+		log.Fatalf("-since: %v", err)
+	}
+	until, err := parseSince(untilFlag)
+	if err != nil {
+		log.Fatalf("-until: %v", err)
+	}
+
+	var stats explainLogStats
+	var entries []*explainEntry
+	for _, name := range flag.Args() {
+		f, err := openLog(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = scanExplainLog(f, name, &stats, func(e *explainEntry) {
+			if database != "" && e.Database != database ||
+				!since.IsZero() && e.Time.Before(since) || !until.IsZero() && !e.Time.Before(until) {
+				stats.Filtered++
+				return
+			}
+			entries = append(entries, e)
+		})
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	report := buildExplainReport(entries, stats, top, regress)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printExplainReport(report)
+}
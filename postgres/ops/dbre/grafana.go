@@ -0,0 +1,459 @@
+package dbre
+
+// ============================================================================
+// GRAFANA DASHBOARD GENERATOR (cmd/grafana-dashboard)
+// ============================================================================
+//
+// Hand-built dashboards drift: one cluster gets the WAL panel, the next one
+// forgets the lag in seconds. grafana-dashboard writes an importable
+// dashboard for the metrics this repository serves, one row per source:
+//   simulator    stress_* (postgres/stress -metrics-addr): p50/p95/p99
+//                latency, throughput and errors per query, pool connections
+//                and acquire waits
+//   loader       bulk_loader_* (postgres/bulk-loading -metrics-addr): rows
+//                per second, failed rows, per-worker throughput, pool
+//                connections and acquire waits, WAL and table growth,
+//                phase and time since the last commit
+//   waltrack     WAL rate, archive backlog and archiver failures
+//   replag       lag per standby and stage in bytes and seconds, replicas'
+//                own replay lag
+//   slots        WAL retained per slot, safe_wal_size, WAL volume free space
+//   conns        connections by state against the usable limit, by role and
+//                application, projected time to full
+//   logscan      latency quantiles of the logged statements, slow queries
+//                per database, errors by SQLSTATE, lock waits, connections
+// Panels filter on the $server, $query, $replica and $table variables and
+// read the Prometheus data source chosen at import, so one JSON fits every
+// cluster.
+//
+// With -from (repeatable) the /metrics endpoints are read first: panels of
+// metrics that aren't served are left out, and metric families the
+// catalog doesn't know get a generic panel in an "Other metrics" row, so a
+// new gauge shows up without editing this file.
+//
+//   go run ./cmd/grafana-dashboard > dbre.json
+//   go run ./cmd/grafana-dashboard -from=http://db1:9108/metrics -from=http://mon1:9187/metrics -out=db1.json
+//   go run ./cmd/grafana-dashboard -sections=conns,replag -title="avro primary" -uid=avro-db
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dashTarget is one query of a panel.
+type dashTarget struct {
+	Expr, Legend string
+}
+
+// dashPanel is one panel of the catalog.
+type dashPanel struct {
+	Title   string
+	Unit    string
+	Stat    bool     // A single-value stat panel instead of a time series
+	Stacked bool     // Stack the series
+	Metrics []string // Families the queries read; the panel is kept if any is served
+	Targets []dashTarget
+}
+
+// dashSection is one row: the metrics of one source.
+type dashSection struct {
+	Name, Title string
+	Panels      []dashPanel
+}
+
+// server, query and table filter on the dashboard variables.
+const (
+	onServer = `{server=~"$server"}`
+	onQuery  = `{query=~"$query"}`
+	onTable  = `{table=~"$table"}`
+)
+
+// queryQuantile is the q quantile of the simulator's latency, per query.
+func queryQuantile(q string) dashTarget {
+	return dashTarget{"histogram_quantile(" + q + ", sum by (query, le) (rate(stress_query_duration_seconds_bucket" + onQuery + "[$__rate_interval])))", "{{query}}"}
+}
+
+// dashCatalog is every metric this repository serves, as panels.
+var dashCatalog = []dashSection{
+	{"simulator", "Workload simulator", []dashPanel{
+		{Title: "p50 latency by query", Unit: "s", Metrics: []string{"stress_query_duration_seconds"}, Targets: []dashTarget{queryQuantile("0.5")}},
+		{Title: "p95 latency by query", Unit: "s", Metrics: []string{"stress_query_duration_seconds"}, Targets: []dashTarget{queryQuantile("0.95")}},
+		{Title: "p99 latency by query", Unit: "s", Metrics: []string{"stress_query_duration_seconds"}, Targets: []dashTarget{queryQuantile("0.99")}},
+		{Title: "Queries per second", Unit: "reqps", Stacked: true, Metrics: []string{"stress_query_duration_seconds"}, Targets: []dashTarget{
+			{"sum by (query) (rate(stress_query_duration_seconds_count" + onQuery + "[$__rate_interval]))", "{{query}}"},
+		}},
+		{Title: "Errors per second by query", Unit: "reqps", Metrics: []string{"stress_query_errors_total"}, Targets: []dashTarget{
+			{"sum by (query) (rate(stress_query_errors_total" + onQuery + "[$__rate_interval]))", "{{query}}"},
+		}},
+		{Title: "Pool connections", Unit: "short", Stacked: true, Metrics: []string{"stress_pool_connections", "stress_pool_max_connections"}, Targets: []dashTarget{
+			{"stress_pool_connections", "{{state}}"},
+			{"stress_pool_max_connections", "max"},
+		}},
+		{Title: "Pool acquire wait", Unit: "percentunit", Metrics: []string{"stress_pool_acquire_wait_seconds_total"}, Targets: []dashTarget{
+			{"rate(stress_pool_acquire_wait_seconds_total[$__rate_interval])", "waiting for a connection"},
+		}},
+	}},
+	{"loader", "Bulk loader", []dashPanel{
+		{Title: "Rows per second", Unit: "rowsps", Metrics: []string{"bulk_loader_rows_per_second", "bulk_loader_rows_total"}, Targets: []dashTarget{
+			{"bulk_loader_rows_per_second" + onTable, "{{table}} smoothed"},
+			{"rate(bulk_loader_rows_total" + onTable + "[$__rate_interval])", "{{table}} committed"},
+		}},
+		{Title: "Failed rows per second", Unit: "rowsps", Metrics: []string{"bulk_loader_failed_rows_total"}, Targets: []dashTarget{
+			{"rate(bulk_loader_failed_rows_total" + onTable + "[$__rate_interval])", "{{table}}"},
+		}},
+		{Title: "Rows per second by worker", Unit: "rowsps", Stacked: true, Metrics: []string{"bulk_loader_goroutine_rows_total"}, Targets: []dashTarget{
+			{"rate(bulk_loader_goroutine_rows_total" + onTable + "[$__rate_interval])", "worker {{goroutine}}"},
+		}},
+		{Title: "Pool connections", Unit: "short", Stacked: true, Metrics: []string{"bulk_loader_pool_connections", "bulk_loader_pool_max_connections"}, Targets: []dashTarget{
+			{"bulk_loader_pool_connections" + onTable, "{{state}}"},
+			{"bulk_loader_pool_max_connections" + onTable, "max"},
+		}},
+		{Title: "Pool acquire wait", Unit: "percentunit", Metrics: []string{"bulk_loader_pool_acquire_wait_seconds_total"}, Targets: []dashTarget{
+			{"rate(bulk_loader_pool_acquire_wait_seconds_total" + onTable + "[$__rate_interval])", "{{table}} waiting for a connection"},
+		}},
+		{Title: "WAL generated per second", Unit: "Bps", Metrics: []string{"bulk_loader_wal_bytes"}, Targets: []dashTarget{
+			{"deriv(bulk_loader_wal_bytes" + onTable + "[$__rate_interval])", "{{table}}"},
+		}},
+		{Title: "Table size", Unit: "bytes", Metrics: []string{"bulk_loader_table_bytes"}, Targets: []dashTarget{
+			{"bulk_loader_table_bytes" + onTable, "{{table}}"},
+		}},
+		{Title: "Since last commit", Unit: "s", Stat: true, Metrics: []string{"bulk_loader_last_commit_timestamp_seconds"}, Targets: []dashTarget{
+			{"time() - bulk_loader_last_commit_timestamp_seconds" + onTable, "{{table}}"},
+		}},
+		{Title: "Phase", Unit: "none", Stat: true, Metrics: []string{"bulk_loader_phase"}, Targets: []dashTarget{
+			{"bulk_loader_phase" + onTable + " == 1", "{{phase}}"},
+		}},
+		{Title: "Finished phase durations", Unit: "s", Stat: true, Metrics: []string{"bulk_loader_phase_duration_seconds"}, Targets: []dashTarget{
+			{"bulk_loader_phase_duration_seconds" + onTable, "{{phase}}"},
+		}},
+	}},
+	{"waltrack", "WAL and archiving (waltrack)", []dashPanel{
+		{Title: "WAL rate", Unit: "Bps", Metrics: []string{"dbre_waltrack_wal_bytes_per_second"}, Targets: []dashTarget{
+			{"dbre_waltrack_wal_bytes_per_second" + onServer, "{{server}}"},
+		}},
+		{Title: "Archive backlog", Unit: "bytes", Metrics: []string{"dbre_waltrack_archive_pending_bytes"}, Targets: []dashTarget{
+			{"dbre_waltrack_archive_pending_bytes" + onServer, "{{server}}"},
+		}},
+		{Title: "Oldest unarchived segment waiting", Unit: "s", Metrics: []string{"dbre_waltrack_archive_pending_seconds"}, Targets: []dashTarget{
+			{"dbre_waltrack_archive_pending_seconds" + onServer, "{{server}}"},
+		}},
+		{Title: "Archived and failed segments", Unit: "short", Metrics: []string{"dbre_waltrack_archived_count", "dbre_waltrack_archive_failed_count"}, Targets: []dashTarget{
+			{"increase(dbre_waltrack_archived_count" + onServer + "[$__rate_interval])", "{{server}} archived"},
+			{"increase(dbre_waltrack_archive_failed_count" + onServer + "[$__rate_interval])", "{{server}} failed"},
+		}},
+	}},
+	{"replag", "Replication lag (replag)", []dashPanel{
+		{Title: "Lag in bytes", Unit: "bytes", Metrics: []string{"dbre_replag_lag_bytes"}, Targets: []dashTarget{
+			{`dbre_replag_lag_bytes{replica=~"$replica"}`, "{{replica}} {{stage}}"},
+		}},
+		{Title: "Lag in seconds", Unit: "s", Metrics: []string{"dbre_replag_lag_seconds"}, Targets: []dashTarget{
+			{`dbre_replag_lag_seconds{replica=~"$replica"}`, "{{replica}} {{stage}}"},
+		}},
+		{Title: "Replica replay lag", Unit: "s", Metrics: []string{"dbre_replag_replica_replay_lag_seconds", "dbre_replag_replica_replay_lag_bytes"}, Targets: []dashTarget{
+			{`dbre_replag_replica_replay_lag_seconds{replica=~"$replica"}`, "{{replica}}"},
+		}},
+		{Title: "Standbys connected", Unit: "short", Stat: true, Metrics: []string{"dbre_replag_connected"}, Targets: []dashTarget{
+			{`dbre_replag_connected{replica=~"$replica"}`, "{{replica}}"},
+		}},
+	}},
+	{"slots", "Replication slots (slots)", []dashPanel{
+		{Title: "WAL retained per slot", Unit: "bytes", Metrics: []string{"dbre_slots_retained_bytes"}, Targets: []dashTarget{
+			{"dbre_slots_retained_bytes", "{{slot}} ({{type}})"},
+		}},
+		{Title: "WAL left before a slot is lost", Unit: "bytes", Metrics: []string{"dbre_slots_safe_wal_bytes"}, Targets: []dashTarget{
+			{"dbre_slots_safe_wal_bytes", "{{slot}}"},
+		}},
+		{Title: "Inactive slots", Unit: "s", Metrics: []string{"dbre_slots_inactive_seconds", "dbre_slots_active"}, Targets: []dashTarget{
+			{"dbre_slots_inactive_seconds > 0", "{{slot}} inactive for"},
+		}},
+		{Title: "WAL volume", Unit: "bytes", Metrics: []string{"dbre_slots_disk_free_bytes", "dbre_slots_disk_fill_seconds"}, Targets: []dashTarget{
+			{"dbre_slots_disk_free_bytes", "free"},
+		}},
+	}},
+	{"conns", "Connections (conns)", []dashPanel{
+		{Title: "Connections by state", Unit: "short", Stacked: true, Metrics: []string{"dbre_conns_connections", "dbre_conns_usable"}, Targets: []dashTarget{
+			{"sum by (state) (dbre_conns_connections" + onServer + ")", "{{state}}"},
+			{"dbre_conns_usable" + onServer, "usable ({{server}})"},
+		}},
+		{Title: "Time until full", Unit: "s", Stat: true, Metrics: []string{"dbre_conns_full_in_seconds"}, Targets: []dashTarget{
+			{"dbre_conns_full_in_seconds" + onServer + " > 0", "{{server}}"},
+		}},
+		{Title: "Connections by role", Unit: "short", Metrics: []string{"dbre_conns_role_connections"}, Targets: []dashTarget{
+			{"topk(10, dbre_conns_role_connections" + onServer + ")", "{{role}}"},
+		}},
+		{Title: "Connections by application", Unit: "short", Metrics: []string{"dbre_conns_application_connections"}, Targets: []dashTarget{
+			{"topk(10, dbre_conns_application_connections" + onServer + ")", "{{application}}"},
+		}},
+	}},
+	{"logscan", "Server log (logscan)", []dashPanel{
+		{Title: "Logged statement latency", Unit: "s", Metrics: []string{"dbre_logscan_query_duration_seconds"}, Targets: []dashTarget{
+			{"histogram_quantile(0.5, sum by (le) (rate(dbre_logscan_query_duration_seconds_bucket" + onServer + "[$__rate_interval])))", "p50"},
+			{"histogram_quantile(0.95, sum by (le) (rate(dbre_logscan_query_duration_seconds_bucket" + onServer + "[$__rate_interval])))", "p95"},
+			{"histogram_quantile(0.99, sum by (le) (rate(dbre_logscan_query_duration_seconds_bucket" + onServer + "[$__rate_interval])))", "p99"},
+		}},
+		{Title: "Slow queries per second", Unit: "reqps", Metrics: []string{"dbre_logscan_slow_queries_total"}, Targets: []dashTarget{
+			{"sum by (database) (rate(dbre_logscan_slow_queries_total" + onServer + "[$__rate_interval]))", "{{database}}"},
+		}},
+		{Title: "Errors per second", Unit: "reqps", Stacked: true, Metrics: []string{"dbre_logscan_errors_total"}, Targets: []dashTarget{
+			{"sum by (severity, sqlstate) (rate(dbre_logscan_errors_total" + onServer + "[$__rate_interval]))", "{{severity}} {{sqlstate}}"},
+		}},
+		{Title: "Lock waits per second", Unit: "reqps", Metrics: []string{"dbre_logscan_lock_waits_total"}, Targets: []dashTarget{
+			{"sum by (mode) (rate(dbre_logscan_lock_waits_total" + onServer + "[$__rate_interval]))", "{{mode}}"},
+		}},
+		{Title: "New connections per second", Unit: "reqps", Metrics: []string{"dbre_logscan_connections_total"}, Targets: []dashTarget{
+			{"topk(10, sum by (user, database) (rate(dbre_logscan_connections_total" + onServer + "[$__rate_interval])))", "{{user}}@{{database}}"},
+		}},
+		{Title: "Session length", Unit: "s", Metrics: []string{"dbre_logscan_session_seconds"}, Targets: []dashTarget{
+			{"histogram_quantile(0.5, sum by (le) (rate(dbre_logscan_session_seconds_bucket" + onServer + "[$__rate_interval])))", "p50"},
+			{"histogram_quantile(0.95, sum by (le) (rate(dbre_logscan_session_seconds_bucket" + onServer + "[$__rate_interval])))", "p95"},
+		}},
+	}},
+}
+
+// scrapeFamilies reads the metric families an endpoint serves from its
+// # TYPE lines.
+func scrapeFamilies(ctx context.Context, url string, families map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 4 && fields[0] == "#" && fields[1] == "TYPE" {
+			families[fields[2]] = fields[3]
+		}
+	}
+	return sc.Err()
+}
+
+// Grafana dashboard JSON, as much of the model as the panels use.
+type (
+	grafanaDashboard struct {
+		UID           string            `json:"uid"`
+		Title         string            `json:"title"`
+		Tags          []string          `json:"tags"`
+		Timezone      string            `json:"timezone"`
+		Editable      bool              `json:"editable"`
+		SchemaVersion int               `json:"schemaVersion"`
+		Refresh       string            `json:"refresh"`
+		Time          map[string]string `json:"time"`
+		Templating    struct {
+			List []grafanaVariable `json:"list"`
+		} `json:"templating"`
+		Panels []grafanaPanel `json:"panels"`
+	}
+	grafanaVariable struct {
+		Name       string         `json:"name"`
+		Label      string         `json:"label,omitempty"`
+		Type       string         `json:"type"`
+		Query      string         `json:"query"`
+		Datasource *grafanaSource `json:"datasource,omitempty"`
+		Refresh    int            `json:"refresh,omitempty"`
+		IncludeAll bool           `json:"includeAll"`
+		Multi      bool           `json:"multi"`
+		AllValue   string         `json:"allValue,omitempty"`
+	}
+	grafanaSource struct {
+		Type string `json:"type"`
+		UID  string `json:"uid"`
+	}
+	grafanaPanel struct {
+		ID          int             `json:"id"`
+		Type        string          `json:"type"`
+		Title       string          `json:"title"`
+		GridPos     grafanaGridPos  `json:"gridPos"`
+		Datasource  *grafanaSource  `json:"datasource,omitempty"`
+		Collapsed   *bool           `json:"collapsed,omitempty"`
+		Panels      []grafanaPanel  `json:"panels,omitempty"`
+		FieldConfig *grafanaFields  `json:"fieldConfig,omitempty"`
+		Options     map[string]any  `json:"options,omitempty"`
+		Targets     []grafanaTarget `json:"targets,omitempty"`
+	}
+	grafanaGridPos struct {
+		H int `json:"h"`
+		W int `json:"w"`
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+	grafanaFields struct {
+		Defaults struct {
+			Unit   string         `json:"unit"`
+			Custom map[string]any `json:"custom,omitempty"`
+		} `json:"defaults"`
+		Overrides []any `json:"overrides"`
+	}
+	grafanaTarget struct {
+		RefID        string `json:"refId"`
+		Expr         string `json:"expr"`
+		LegendFormat string `json:"legendFormat"`
+	}
+)
+
+// promSource is the data source variable every panel reads.
+var promSource = &grafanaSource{Type: "prometheus", UID: "${datasource}"}
+
+// genericPanel graphs a family the catalog doesn't know.
+func genericPanel(name, kind string) dashPanel {
+	p := dashPanel{Title: name, Unit: "short", Metrics: []string{name}}
+	switch kind {
+	case "counter":
+		p.Title += " (per second)"
+		p.Targets = []dashTarget{{"rate(" + name + "[$__rate_interval])", ""}}
+	case "histogram":
+		p.Title += " (p95)"
+		p.Targets = []dashTarget{{"histogram_quantile(0.95, sum by (le) (rate(" + name + "_bucket[$__rate_interval])))", "p95"}}
+	case "summary":
+		p.Targets = []dashTarget{{name + `{quantile="0.95"}`, "p95"}}
+	default:
+		p.Targets = []dashTarget{{name, ""}}
+	}
+	return p
+}
+
+// buildDashboard lays the sections out as rows of two panels. families is
+// nil to keep every panel.
+func buildDashboard(title, uid string, sections []dashSection, families map[string]string) *grafanaDashboard {
+	d := &grafanaDashboard{
+		UID: uid, Title: title, Tags: []string{"dbre", "postgres"}, Timezone: "browser", Editable: true,
+		SchemaVersion: 39, Refresh: "30s", Time: map[string]string{"from": "now-6h", "to": "now"},
+	}
+	label := func(name, query string) grafanaVariable {
+		return grafanaVariable{Name: name, Type: "query", Query: query, Datasource: promSource,
+			Refresh: 2, IncludeAll: true, Multi: true, AllValue: ".*"}
+	}
+	d.Templating.List = []grafanaVariable{
+		{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+		label("server", "label_values(server)"),
+		label("query", "label_values(stress_query_duration_seconds_count, query)"),
+		label("replica", "label_values(dbre_replag_lag_bytes, replica)"),
+		label("table", "label_values(bulk_loader_rows_total, table)"),
+	}
+
+	id, y := 0, 0
+	for _, s := range sections {
+		var panels []dashPanel
+		for _, p := range s.Panels {
+			if families == nil || slices.ContainsFunc(p.Metrics, func(m string) bool { return families[m] != "" }) {
+				panels = append(panels, p)
+			}
+		}
+		if len(panels) == 0 {
+			continue
+		}
+		id++
+		collapsed := false
+		d.Panels = append(d.Panels, grafanaPanel{ID: id, Type: "row", Title: s.Title, Collapsed: &collapsed,
+			GridPos: grafanaGridPos{H: 1, W: 24, Y: y}})
+		y++
+		for i, p := range panels {
+			id++
+			gp := grafanaPanel{ID: id, Type: "timeseries", Title: p.Title, Datasource: promSource,
+				GridPos: grafanaGridPos{H: 8, W: 12, X: 12 * (i % 2), Y: y + 8*(i/2)}, FieldConfig: &grafanaFields{}}
+			gp.FieldConfig.Defaults.Unit = p.Unit
+			if p.Stat {
+				gp.Type = "stat"
+				gp.Options = map[string]any{"reduceOptions": map[string]any{"calcs": []string{"lastNotNull"}}, "textMode": "value_and_name"}
+			} else if p.Stacked {
+				gp.FieldConfig.Defaults.Custom = map[string]any{"stacking": map[string]any{"mode": "normal"}, "fillOpacity": 20}
+			}
+			for j, t := range p.Targets {
+				gp.Targets = append(gp.Targets, grafanaTarget{RefID: string(rune('A' + j)), Expr: t.Expr, LegendFormat: t.Legend})
+			}
+			d.Panels = append(d.Panels, gp)
+		}
+		y += 8 * ((len(panels) + 1) / 2)
+	}
+	return d
+}
+
+// GrafanaDashboard runs the grafana-dashboard command line tool.
+func GrafanaDashboard() {
+	var from stringList
+	var sections, title, uid, out string
+	flag.Var(&from, "from", "Only graph the metrics this /metrics URL serves, and add the ones the catalog lacks (repeatable)")
+	flag.StringVar(&sections, "sections", "", "Comma-separated rows to include (default: all of simulator, loader, waltrack, replag, slots, conns, logscan)")
+	flag.StringVar(&title, "title", "PostgreSQL (dbre)", "Dashboard title")
+	flag.StringVar(&uid, "uid", "dbre-postgres", "Dashboard uid; importing again with the same uid replaces the dashboard")
+	flag.StringVar(&out, "out", "", "Write the dashboard to this file (default: stdout)")
+	flag.Parse()
+
+	chosen := dashCatalog
+	if sections != "" {
+		chosen = nil
+		for _, name := range strings.Split(sections, ",") {
+			name = strings.TrimSpace(name)
+			i := slices.IndexFunc(dashCatalog, func(s dashSection) bool { return s.Name == name })
+			if i < 0 {
+				log.Fatalf("unknown section %q in -sections", name)
+			}
+			chosen = append(chosen, dashCatalog[i])
+		}
+	}
+
+	var families map[string]string
+	if len(from) > 0 {
+		families = make(map[string]string)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		for _, url := range from {
+			if err := scrapeFamilies(ctx, url, families); err != nil {
+				log.Fatalf("failed to read %s: %v", url, err)
+			}
+		}
+		cancel()
+		known := make(map[string]bool)
+		for _, s := range dashCatalog {
+			for _, p := range s.Panels {
+				for _, m := range p.Metrics {
+					known[m] = true
+				}
+			}
+		}
+		other := dashSection{Name: "other", Title: "Other metrics"}
+		for name, kind := range families {
+			// Client library internals (go_*, process_*, promhttp_*) aren't
+			// about the database.
+			if !known[name] && !strings.HasPrefix(name, "go_") && !strings.HasPrefix(name, "process_") && !strings.HasPrefix(name, "promhttp_") {
+				other.Panels = append(other.Panels, genericPanel(name, kind))
+			}
+		}
+		slices.SortFunc(other.Panels, func(a, b dashPanel) int { return strings.Compare(a.Title, b.Title) })
+		chosen = append(slices.Clone(chosen), other)
+	}
+
+	d := buildDashboard(title, uid, chosen, families)
+	if len(d.Panels) == 0 {
+		log.Fatal("none of the metrics are served by the -from endpoints")
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	data = append(data, '\n')
+	if out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "✅ Wrote %s: %d panels\n", out, len(d.Panels))
+}
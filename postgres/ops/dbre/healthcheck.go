@@ -0,0 +1,586 @@
+package dbre
+
+// ============================================================================
+// ONE-SHOT CLUSTER HEALTH CHECK (cmd/healthcheck)
+// ============================================================================
+//
+// The first five minutes on an unfamiliar cluster, or the check before a
+// maintenance window, go to the same handful of queries. healthcheck runs
+// them once and grades what it finds:
+//   bloat         tables of at least -min-size whose dead tuples are
+//                 -bloat-warning/-bloat-critical percent of their rows
+//   indexes       invalid indexes (failed CREATE INDEX CONCURRENTLY or
+//                 REINDEX CONCURRENTLY), and unused, duplicate and redundant
+//                 ones of at least -min-size, as index-audit finds them
+//   transactions  transactions open longer than -xact-warning/-xact-critical,
+//                 idle in transaction ones included, and old prepared
+//                 transactions
+//   replication   standby replay lag against -lag-warning/-lag-critical (a
+//                 replica's own lag when connected to one) and inactive
+//                 slots retaining more than -slot-retained of WAL
+//   wraparound    the oldest database's XID age against -xid-warning and
+//                 -xid-critical percent of the way to wraparound
+//   connections   client connections against the usable max_connections,
+//                 -conn-warning/-conn-critical percent, and roles or
+//                 databases near their CONNECTION LIMIT
+//   settings      settings that lose data or stall vacuum (fsync,
+//                 full_page_writes, autovacuum, track_counts off), the
+//                 built-in shared_buffers, settings waiting for a restart
+//                 and a few that are usually forgotten
+// Each finding has a severity: info, warning or critical. A check scores
+// 100 less 25 per critical, 10 per warning and 2 per info finding (at
+// least 0); the cluster score is the mean of the checks that ran. A check
+// that can't run (missing privilege, timeout) is UNKNOWN and left out of
+// the score.
+//
+// Exit status follows the Nagios convention, like wraparound: 0 OK,
+// 1 WARNING, 2 CRITICAL, 3 UNKNOWN (a check or the connection failed and
+// nothing is worse).
+//
+//   go run ./cmd/healthcheck
+//   go run ./cmd/healthcheck -checks=bloat,indexes -min-size=1GB
+//   go run ./cmd/healthcheck -skip=settings -conn-warning=70 -format=json
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Finding severities, from least to most severe.
+const (
+	sevOK       = "ok"
+	sevInfo     = "info"
+	sevWarning  = "warning"
+	sevUnknown  = "unknown"
+	sevCritical = "critical"
+)
+
+var severityRank = map[string]int{sevOK: 0, sevInfo: 1, sevWarning: 2, sevUnknown: 3, sevCritical: 4}
+
+// severityPenalty is what a finding takes off its check's score.
+var severityPenalty = map[string]int{sevInfo: 2, sevWarning: 10, sevCritical: 25}
+
+// healthFinding is one thing a check found.
+type healthFinding struct {
+	Severity string `json:"severity"`
+	Object   string `json:"object,omitempty"`
+	Message  string `json:"message"`
+}
+
+// healthCheck is the outcome of one check.
+type healthCheck struct {
+	Name     string          `json:"name"`
+	Severity string          `json:"severity"`
+	Score    int             `json:"score"`
+	Error    string          `json:"error,omitempty"`
+	Findings []healthFinding `json:"findings"`
+	Took     float64         `json:"seconds"`
+}
+
+// add records a finding.
+func (c *healthCheck) add(severity, object, format string, args ...any) {
+	c.Findings = append(c.Findings, healthFinding{Severity: severity, Object: object, Message: fmt.Sprintf(format, args...)})
+}
+
+// grade sets the check's severity and score from its findings.
+func (c *healthCheck) grade() {
+	if c.Error != "" {
+		c.Severity, c.Score = sevUnknown, 0
+		return
+	}
+	c.Severity, c.Score = sevOK, 100
+	for _, f := range c.Findings {
+		if severityRank[f.Severity] > severityRank[c.Severity] {
+			c.Severity = f.Severity
+		}
+		c.Score -= severityPenalty[f.Severity]
+	}
+	c.Score = max(c.Score, 0)
+}
+
+// healthReport is what healthcheck prints.
+type healthReport struct {
+	Server  string         `json:"server"`
+	Version string         `json:"server_version"`
+	Replica bool           `json:"replica"`
+	Checked time.Time      `json:"checked"`
+	Score   int            `json:"score"`
+	Status  string         `json:"status"`
+	Checks  []*healthCheck `json:"checks"`
+}
+
+// healthOptions are the thresholds of healthcheck.
+type healthOptions struct {
+	minSize, slotRetained       int64
+	bloatWarning, bloatCritical float64
+	xactWarning, xactCritical   time.Duration
+	lagWarning, lagCritical     time.Duration
+	xidWarning, xidCritical     float64
+	connWarning, connCritical   float64
+	minStatsAge                 time.Duration
+}
+
+// healthChecker runs the checks against one server.
+type healthChecker struct {
+	pool    *pgxpool.Pool
+	opts    healthOptions
+	replica bool
+}
+
+// healthChecks are the checks in report order.
+var healthChecks = []struct {
+	name string
+	run  func(*healthChecker, context.Context, *healthCheck) error
+}{
+	{"bloat", (*healthChecker).checkBloat},
+	{"indexes", (*healthChecker).checkIndexes},
+	{"transactions", (*healthChecker).checkTransactions},
+	{"replication", (*healthChecker).checkReplication},
+	{"wraparound", (*healthChecker).checkWraparound},
+	{"connections", (*healthChecker).checkConnections},
+	{"settings", (*healthChecker).checkSettings},
+}
+
+// checkBloat grades tables by their share of dead tuples.
+func (h *healthChecker) checkBloat(ctx context.Context, c *healthCheck) error {
+	rows, err := h.pool.Query(ctx, `
+		SELECT format('%I.%I', schemaname, relname), n_live_tup, n_dead_tup, pg_table_size(relid),
+		       coalesce(to_char(greatest(last_autovacuum, last_vacuum), 'YYYY-MM-DD HH24:MI'), 'never')
+		FROM pg_stat_user_tables
+		WHERE n_dead_tup > 0 AND pg_table_size(relid) >= $1
+		ORDER BY n_dead_tup::float8 / (n_live_tup + n_dead_tup) DESC
+		LIMIT 20
+	`, h.opts.minSize)
+	if err != nil {
+		return err
+	}
+	var name, vacuumed string
+	var live, dead, size int64
+	_, err = pgx.ForEachRow(rows, []any{&name, &live, &dead, &size, &vacuumed}, func() error {
+		pct := 100 * float64(dead) / float64(live+dead)
+		severity := sevOK
+		switch {
+		case pct >= h.opts.bloatCritical:
+			severity = sevCritical
+		case pct >= h.opts.bloatWarning:
+			severity = sevWarning
+		}
+		if severity != sevOK {
+			c.add(severity, name, "%.0f%% dead tuples (%d of %d), ~%s of %s, last vacuum %s",
+				pct, dead, live+dead, formatBytes(int64(float64(size)*pct/100)), formatBytes(size), vacuumed)
+		}
+		return nil
+	})
+	return err
+}
+
+// checkIndexes reports invalid indexes and the ones worth dropping.
+func (h *healthChecker) checkIndexes(ctx context.Context, c *healthCheck) error {
+	audit, err := auditIndexes(ctx, h.pool, indexAuditOptions{minStatsAge: h.opts.minStatsAge})
+	if err != nil {
+		return err
+	}
+	for _, f := range audit.Findings {
+		ix := f.Index
+		switch {
+		case f.Kind == "invalid":
+			// Any size: an invalid index is usually a build that still needs
+			// redoing.
+			c.add(sevCritical, ix.qualified(), "invalid (%s), %s: %s", f.Reason, formatBytes(ix.Bytes), f.Drop)
+		case ix.Bytes >= h.opts.minSize:
+			c.add(sevWarning, ix.qualified(), "%s (%s), %s: %s", f.Kind, f.Reason, formatBytes(ix.Bytes), f.Drop)
+		}
+	}
+	if audit.UnusedHidden {
+		c.add(sevInfo, "", "statistics reset %s ago: unused indexes not checked (-min-stats-age=%v)",
+			formatAge(time.Since(audit.StatsSince)), h.opts.minStatsAge)
+	}
+	return nil
+}
+
+// checkTransactions reports long open and prepared transactions.
+func (h *healthChecker) checkTransactions(ctx context.Context, c *healthCheck) error {
+	rows, err := h.pool.Query(ctx, `
+		SELECT format('pid %s %s@%s', pid, coalesce(usename, ''), coalesce(nullif(application_name, ''), backend_type)),
+		       coalesce(state, ''), extract(epoch FROM now() - xact_start)::float8,
+		       left(regexp_replace(coalesce(query, ''), '\s+', ' ', 'g'), 80)
+		FROM pg_stat_activity
+		WHERE xact_start IS NOT NULL AND pid <> pg_backend_pid()
+		  AND now() - xact_start > make_interval(secs => $1)
+		UNION ALL
+		SELECT format('prepared %s', gid), 'prepared', extract(epoch FROM now() - prepared)::float8, ''
+		FROM pg_prepared_xacts
+		WHERE now() - prepared > make_interval(secs => $1)
+		ORDER BY 3 DESC
+		LIMIT 20
+	`, h.opts.xactWarning.Seconds())
+	if err != nil {
+		return err
+	}
+	var name, state, query string
+	var age float64
+	_, err = pgx.ForEachRow(rows, []any{&name, &state, &age, &query}, func() error {
+		open := seconds(age)
+		severity := sevWarning
+		if open >= h.opts.xactCritical {
+			severity = sevCritical
+		}
+		msg := fmt.Sprintf("%s open %s", state, formatAge(open))
+		if query != "" {
+			msg += ": " + query
+		}
+		c.add(severity, name, "%s", msg)
+		return nil
+	})
+	return err
+}
+
+// checkReplication grades standby lag and inactive slots; on a replica,
+// its own replay lag.
+func (h *healthChecker) checkReplication(ctx context.Context, c *healthCheck) error {
+	lagSeverity := func(lag time.Duration) string {
+		switch {
+		case lag >= h.opts.lagCritical:
+			return sevCritical
+		case lag >= h.opts.lagWarning:
+			return sevWarning
+		}
+		return sevOK
+	}
+	if h.replica {
+		r, err := readReplica(ctx, h.pool)
+		if err != nil {
+			return err
+		}
+		lag := seconds(r.seconds)
+		if s := lagSeverity(lag); s != sevOK {
+			c.add(s, "this replica", "replaying %v behind, %s received but not replayed", lag.Round(time.Second), formatBytes(int64(r.bytes)))
+		}
+		return nil
+	}
+
+	standbys, err := readStandbys(ctx, h.pool)
+	if err != nil {
+		return err
+	}
+	for _, s := range standbys {
+		lag := seconds(s.replayLag)
+		if sev := lagSeverity(lag); sev != sevOK {
+			c.add(sev, s.name, "%s %s standby replaying %v behind (%s of WAL)", s.syncState, s.state, lag.Round(time.Second), formatBytes(int64(s.replay)))
+		}
+		if s.state != "streaming" {
+			c.add(sevWarning, s.name, "standby is %s, not streaming", s.state)
+		}
+	}
+
+	rows, err := h.pool.Query(ctx, `
+		SELECT slot_name::text, slot_type, coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint
+		FROM pg_replication_slots
+		WHERE NOT active
+		ORDER BY 3 DESC
+	`)
+	if err != nil {
+		return err
+	}
+	var name, kind string
+	var retained int64
+	_, err = pgx.ForEachRow(rows, []any{&name, &kind, &retained}, func() error {
+		severity := sevInfo
+		if retained >= h.opts.slotRetained {
+			severity = sevWarning
+		}
+		c.add(severity, name, "inactive %s slot retaining %s of WAL", kind, formatBytes(retained))
+		return nil
+	})
+	return err
+}
+
+// checkWraparound grades the oldest database's XID age.
+func (h *healthChecker) checkWraparound(ctx context.Context, c *healthCheck) error {
+	r, err := readWraparound(ctx, h.pool, 5)
+	if err != nil {
+		return err
+	}
+	r.assess(wraparoundOptions{warning: h.opts.xidWarning, critical: h.opts.xidCritical})
+	if len(r.Databases) > 0 {
+		db := r.Databases[0]
+		switch r.Status {
+		case "CRITICAL":
+			c.add(sevCritical, db.Name, "XID age %d, %.0f%% of the way to wraparound", db.Age, r.PctUsed)
+		case "WARNING":
+			c.add(sevWarning, db.Name, "XID age %d, %.0f%% of the way to wraparound", db.Age, r.PctUsed)
+		}
+	}
+	for _, t := range r.Tables {
+		if t.Age > t.FreezeMax {
+			c.add(sevInfo, t.Name, "XID age %d past its freeze max age %d: an anti-wraparound vacuum is due", t.Age, t.FreezeMax)
+		}
+	}
+	if len(r.Holders) > 0 && r.Holders[0].Age > r.FreezeMaxAge {
+		hold := r.Holders[0]
+		c.add(sevWarning, hold.Name, "%s holds the xmin horizon %d XIDs back", hold.Kind, hold.Age)
+	}
+	return nil
+}
+
+// checkConnections grades client connections against the limits.
+func (h *healthChecker) checkConnections(ctx context.Context, c *healthCheck) error {
+	limits, err := readConnLimits(ctx, h.pool)
+	if err != nil {
+		return err
+	}
+	conns, err := readClientConns(ctx, h.pool)
+	if err != nil {
+		return err
+	}
+	pct := 100 * float64(len(conns)) / float64(max(limits.Usable, 1))
+	switch {
+	case pct >= h.opts.connCritical:
+		c.add(sevCritical, "max_connections", "%d of %d usable connections (%.0f%%)", len(conns), limits.Usable, pct)
+	case pct >= h.opts.connWarning:
+		c.add(sevWarning, "max_connections", "%d of %d usable connections (%.0f%%)", len(conns), limits.Usable, pct)
+	}
+	for _, d := range []struct {
+		kind   string
+		limits map[string]int
+	}{{"role", limits.Roles}, {"database", limits.Databases}} {
+		for name, used := range countConns(conns, d.kind) {
+			if limit, ok := d.limits[name]; ok && limit > 0 && float64(used) >= 0.9*float64(limit) {
+				c.add(sevWarning, d.kind+" "+name, "%d of its CONNECTION LIMIT %d", used, limit)
+			}
+		}
+	}
+	slices.SortFunc(c.Findings, func(a, b healthFinding) int { return strings.Compare(a.Object, b.Object) })
+	return nil
+}
+
+// checkSettings flags settings that are dangerous or usually forgotten.
+func (h *healthChecker) checkSettings(ctx context.Context, c *healthCheck) error {
+	rows, err := h.pool.Query(ctx, `
+		SELECT name, setting, coalesce(unit, ''), source, coalesce(boot_val, ''), pending_restart
+		FROM pg_settings
+	`)
+	if err != nil {
+		return err
+	}
+	settings, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (pgSetting, error) {
+		var s pgSetting
+		err := row.Scan(&s.Name, &s.Value, &s.Unit, &s.Source, &s.BootValue, &s.PendingRestart)
+		return s, err
+	})
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]pgSetting, len(settings))
+	for _, s := range settings {
+		byName[s.Name] = s
+		if s.PendingRestart {
+			c.add(sevWarning, s.Name, "changed in the configuration, waiting for a restart")
+		}
+	}
+	is := func(name, value string) bool {
+		s, ok := byName[name]
+		return ok && s.Value == value
+	}
+	for _, r := range []struct {
+		name, value, severity, why string
+	}{
+		{"fsync", "off", sevCritical, "a crash can corrupt the cluster"},
+		{"full_page_writes", "off", sevCritical, "torn pages after a crash can't be repaired"},
+		{"autovacuum", "off", sevCritical, "nothing vacuums or freezes tables: bloat and wraparound"},
+		{"track_counts", "off", sevCritical, "autovacuum can't see which tables need it"},
+		{"synchronous_commit", "off", sevInfo, "a crash loses the last acknowledged commits"},
+		{"idle_in_transaction_session_timeout", "0", sevInfo, "forgotten transactions stay open and hold the xmin horizon"},
+		{"log_min_duration_statement", "-1", sevInfo, "slow queries are not logged"},
+		{"data_checksums", "off", sevInfo, "storage corruption goes undetected"},
+	} {
+		if is(r.name, r.value) {
+			c.add(r.severity, r.name, "%s: %s", r.value, r.why)
+		}
+	}
+	if s, ok := byName["shared_buffers"]; ok && !s.nonDefault() {
+		c.add(sevWarning, s.Name, "the built-in %s, sized for a laptop", s.display())
+	}
+	if s, ok := byName["max_connections"]; ok {
+		var n int
+		if _, err := fmt.Sscan(s.Value, &n); err == nil && n > 500 {
+			c.add(sevInfo, s.Name, "%d: every backend costs memory and snapshot time, consider a pooler", n)
+		}
+	}
+	return nil
+}
+
+// run runs the selected checks and grades the cluster.
+func (h *healthChecker) run(ctx context.Context, selected func(string) bool, timeout time.Duration) *healthReport {
+	report := &healthReport{Server: describeTarget(h.pool.Config()), Replica: h.replica, Checked: time.Now().UTC().Truncate(time.Second)}
+	if err := h.pool.QueryRow(ctx, "SELECT current_setting('server_version')").Scan(&report.Version); err != nil {
+		report.Version = "unknown"
+	}
+	total, ran := 0, 0
+	report.Status = sevOK
+	for _, check := range healthChecks {
+		if !selected(check.name) {
+			continue
+		}
+		c := &healthCheck{Name: check.name, Findings: []healthFinding{}}
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		if err := check.run(h, checkCtx, c); err != nil {
+			c.Error = err.Error()
+		}
+		cancel()
+		c.Took = math.Round(time.Since(start).Seconds()*1000) / 1000
+		c.grade()
+		report.Checks = append(report.Checks, c)
+		if severityRank[c.Severity] > severityRank[report.Status] {
+			report.Status = c.Severity
+		}
+		if c.Severity != sevUnknown {
+			total += c.Score
+			ran++
+		}
+	}
+	if ran > 0 {
+		report.Score = int(math.Round(float64(total) / float64(ran)))
+	}
+	return report
+}
+
+// exitCode maps the worst severity to the Nagios exit status.
+func (r *healthReport) exitCode() int {
+	switch r.Status {
+	case sevCritical:
+		return exitCritical
+	case sevWarning:
+		return exitWarning
+	case sevUnknown:
+		return exitUnknown
+	}
+	return exitOK
+}
+
+// printHealthReport writes the report for a person.
+func printHealthReport(r *healthReport) {
+	marks := map[string]string{sevOK: "✅", sevInfo: "ℹ️ ", sevWarning: "⚠️ ", sevUnknown: "❓", sevCritical: "❌"}
+	role := "primary"
+	if r.Replica {
+		role = "replica"
+	}
+	fmt.Printf("\n🩺 Health of %s (PostgreSQL %s, %s)\n\n", r.Server, r.Version, role)
+	for _, c := range r.Checks {
+		score := fmt.Sprintf("%3d", c.Score)
+		if c.Severity == sevUnknown {
+			score = "  -"
+		}
+		fmt.Printf("%s %-13s %s  %s\n", marks[c.Severity], c.Name, score, strings.ToUpper(c.Severity))
+		if c.Error != "" {
+			fmt.Printf("      could not check: %s\n", c.Error)
+		}
+		for _, f := range c.Findings {
+			object := ""
+			if f.Object != "" {
+				object = f.Object + ": "
+			}
+			fmt.Printf("   %s %s%s\n", marks[f.Severity], object, f.Message)
+		}
+	}
+	fmt.Printf("\nScore %d/100, %s\n", r.Score, strings.ToUpper(r.Status))
+}
+
+// Healthcheck runs the healthcheck command line tool and exits with the
+// Nagios status.
+func Healthcheck() {
+	var dsn, checks, skip, minSize, slotRetained, format string
+	var timeout time.Duration
+	var opts healthOptions
+	registerDSNFlag(&dsn)
+	flag.StringVar(&checks, "checks", "", "Comma-separated checks to run (default: all of bloat, indexes, transactions, replication, wraparound, connections, settings)")
+	flag.StringVar(&skip, "skip", "", "Comma-separated checks to leave out")
+	flag.StringVar(&minSize, "min-size", "100MB", "Ignore tables and indexes smaller than this for bloat and droppable indexes")
+	flag.Float64Var(&opts.bloatWarning, "bloat-warning", 20, "WARNING when dead tuples are this percentage of a table's rows")
+	flag.Float64Var(&opts.bloatCritical, "bloat-critical", 50, "CRITICAL when dead tuples are this percentage of a table's rows")
+	flag.DurationVar(&opts.minStatsAge, "min-stats-age", 7*24*time.Hour, "Only report unused indexes when the statistics cover this long")
+	flag.DurationVar(&opts.xactWarning, "xact-warning", 5*time.Minute, "WARNING for transactions open this long")
+	flag.DurationVar(&opts.xactCritical, "xact-critical", time.Hour, "CRITICAL for transactions open this long")
+	flag.DurationVar(&opts.lagWarning, "lag-warning", 30*time.Second, "WARNING for standby replay lag this long")
+	flag.DurationVar(&opts.lagCritical, "lag-critical", 5*time.Minute, "CRITICAL for standby replay lag this long")
+	flag.StringVar(&slotRetained, "slot-retained", "10GB", "WARNING for inactive slots retaining this much WAL")
+	flag.Float64Var(&opts.xidWarning, "xid-warning", 50, "WARNING past this percentage of the way to wraparound")
+	flag.Float64Var(&opts.xidCritical, "xid-critical", 75, "CRITICAL past this percentage of the way to wraparound")
+	flag.Float64Var(&opts.connWarning, "conn-warning", 80, "WARNING past this percentage of usable connections")
+	flag.Float64Var(&opts.connCritical, "conn-critical", 95, "CRITICAL past this percentage of usable connections")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "Give up on a check after this long")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+
+	unknown := func(err error) {
+		fmt.Printf("UNKNOWN: %v\n", err)
+		os.Exit(exitUnknown)
+	}
+	if format != "text" && format != "json" {
+		unknown(fmt.Errorf("invalid -format %q (use text or json)", format))
+	}
+	var err error
+	if opts.minSize, err = parseByteSize(minSize); err != nil {
+		unknown(fmt.Errorf("-min-size: %w", err))
+	}
+	if opts.slotRetained, err = parseByteSize(slotRetained); err != nil {
+		unknown(fmt.Errorf("-slot-retained: %w", err))
+	}
+	known := make(map[string]bool)
+	for _, c := range healthChecks {
+		known[c.name] = true
+	}
+	parse := func(flagName, list string) map[string]bool {
+		set := make(map[string]bool)
+		for _, name := range strings.Split(list, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if !known[name] {
+				unknown(fmt.Errorf("unknown check %q in -%s", name, flagName))
+			}
+			set[name] = true
+		}
+		return set
+	}
+	only, skipped := parse("checks", checks), parse("skip", skip)
+	selected := func(name string) bool {
+		return (len(only) == 0 || only[name]) && !skipped[name]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(len(healthChecks)+1)*timeout)
+	defer cancel()
+	pool, err := connect(ctx, dsn, "healthcheck", 2)
+	if err != nil {
+		unknown(err)
+	}
+	defer pool.Close()
+	h := &healthChecker{pool: pool, opts: opts}
+	if err := pool.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&h.replica); err != nil {
+		unknown(err)
+	}
+	report := h.run(ctx, selected, timeout)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			unknown(err)
+		}
+	} else {
+		printHealthReport(report)
+	}
+	pool.Close()
+	os.Exit(report.exitCode())
+}
@@ -0,0 +1,693 @@
+package dbre
+
+// ============================================================================
+// HOT UPDATE RATIO AND FILLFACTOR ADVISOR (cmd/hot-advisor)
+// ============================================================================
+//
+// An UPDATE is HOT (heap-only tuple) when the new row version fits on the
+// same page and no indexed column changed: no index gets a new entry, and
+// the old version is pruned without VACUUM. A non-HOT update writes one
+// entry into every index of the table. Updates miss HOT for two reasons,
+// and the cure differs:
+//   index-blocked  the statement sets a column some index references (key,
+//                  INCLUDE, expression or predicate): drop or narrow the
+//                  index, or stop updating the column
+//   page-full      no room left on the page: lower the fillfactor so pages
+//                  keep free space for new versions
+// hot-advisor reads n_tup_upd and n_tup_hot_upd per table, the columns
+// every index references, and the columns the workload's UPDATE statements
+// set (also INSERT ... ON CONFLICT DO UPDATE SET):
+//   -workload=updates.sql   statements separated by ";" at the end of a line,
+//                           each counted once
+//   (default)               pg_stat_statements of this database, weighted by
+//                           calls; unqualified table names resolve with this
+//                           session's search_path
+// Updates of a partitioned table count for each of its partitions.
+//
+// The share of workload updates that touch no indexed column is the best
+// HOT ratio the table can reach; the gap between it and the observed ratio
+// is page-full. From PostgreSQL 16 n_tup_newpage_upd measures page-full
+// updates directly and is used when there is no workload for a table. BRIN
+// indexes don't block HOT from PostgreSQL 16 on.
+//
+// Recommendations:
+//   fillfactor  when page-full updates are at least -min-gap of all
+//               updates: 90, 80 below a 20 point gap, 70 below 40 (never
+//               above the current setting, never below 50). New pages only:
+//               existing pages need a rewrite (pg_repack, VACUUM FULL)
+//   drop index  an index that blocks workload updates, enforces nothing
+//               and has at most -max-scans scans (with the replicas' scans
+//               from -replica-dsn), with the share of updates it would make
+//               HOT-eligible
+// Nothing is changed; the report ends with the statements to run.
+//
+//   go run ./cmd/hot-advisor -dsn=postgres://dbre@db1/avro
+//   go run ./cmd/hot-advisor -workload=updates.sql -min-updates=10000 -format=json
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/sqlfingerprint"
+)
+
+// updateStatement is one UPDATE of the workload.
+type updateStatement struct {
+	Table   string   `json:"table"`   // As written, normalized
+	Columns []string `json:"columns"` // Columns it sets
+	Weight  float64  `json:"weight"`  // Calls, or 1 per statement of a file
+	Query   string   `json:"query"`
+}
+
+// sqlWords splits a normalized statement (sqlfingerprint.Normalize: no
+// comments or literals left) into identifiers, "quoted identifiers",
+// punctuation and operators.
+func sqlWords(norm string) []string {
+	var words []string
+	for i := 0; i < len(norm); {
+		c := norm[i]
+		switch {
+		case c == ' ':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(norm) && (norm[j] != '"' || j+1 < len(norm) && norm[j+1] == '"') {
+				if norm[j] == '"' {
+					j++ // "" inside a quoted identifier
+				}
+				j++
+			}
+			j = min(j+1, len(norm))
+			words = append(words, norm[i:j])
+			i = j
+		case strings.IndexByte("()[],;.", c) >= 0:
+			words = append(words, norm[i:i+1])
+			i++
+		default:
+			j := i
+			word := c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c >= 0x80
+			for j < len(norm) && norm[j] != ' ' && norm[j] != '"' && strings.IndexByte("()[],;.", norm[j]) < 0 {
+				cj := norm[j]
+				isWord := cj == '_' || cj == '$' || cj >= 'a' && cj <= 'z' || cj >= '0' && cj <= '9' || cj >= 0x80
+				if isWord != word {
+					break
+				}
+				j++
+			}
+			words = append(words, norm[i:j])
+			i = j
+		}
+	}
+	return words
+}
+
+// identName is the catalog name of an identifier word.
+func identName(w string) string {
+	if strings.HasPrefix(w, `"`) {
+		return strings.ReplaceAll(strings.Trim(w, `"`), `""`, `"`)
+	}
+	return w
+}
+
+// parseUpdate finds the table an UPDATE (or INSERT ... ON CONFLICT DO
+// UPDATE) writes and the columns it sets; ok is false for other statements.
+func parseUpdate(sql string) (table string, columns []string, ok bool) {
+	w := sqlWords(sqlfingerprint.Normalize(sql))
+	at := func(i int) string {
+		if i >= 0 && i < len(w) {
+			return w[i]
+		}
+		return ""
+	}
+	// name reads a possibly qualified name at i.
+	name := func(i int) (string, int) {
+		n := at(i)
+		if at(i+1) == "." && at(i+2) != "" {
+			return n + "." + at(i+2), i + 3
+		}
+		return n, i + 1
+	}
+
+	// UPDATE may come after a WITH, or inside one: any depth counts.
+	insertTarget := ""
+	for i := 0; i < len(w); i++ {
+		if w[i] == "insert" && at(i+1) == "into" {
+			insertTarget, _ = name(i + 2)
+			continue
+		}
+		if w[i] != "update" {
+			continue
+		}
+		j := i + 1
+		switch at(i - 1) {
+		case "for", "key":
+			continue // SELECT ... FOR [NO KEY] UPDATE
+		case "do":
+			if insertTarget == "" {
+				continue
+			}
+			table = insertTarget
+		default:
+			if at(j) == "only" {
+				j++
+			}
+			table, j = name(j)
+			if at(j) == "*" {
+				j++
+			}
+			if at(j) == "as" {
+				j += 2
+			} else if at(j) != "set" {
+				j++ // alias
+			}
+		}
+		if at(j) != "set" || table == "" {
+			return "", nil, false
+		}
+		return table, setColumns(w, j+1), true
+	}
+	return "", nil, false
+}
+
+// setColumns reads the SET list starting at w[i]: col = expr,
+// col.field = expr, col[n] = expr and (a, b) = (...).
+func setColumns(w []string, i int) []string {
+	var columns []string
+list:
+	for i < len(w) {
+		if w[i] == "(" {
+			for i++; i < len(w) && w[i] != ")"; i++ {
+				if w[i] != "," {
+					columns = append(columns, identName(w[i]))
+				}
+			}
+		} else {
+			columns = append(columns, identName(w[i]))
+		}
+		// Skip to the next assignment or the end of the list.
+		depth := 0
+		for i++; i < len(w); i++ {
+			switch w[i] {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth--
+			}
+			if depth < 0 {
+				break list // end of a CTE body
+			}
+			if depth == 0 && (w[i] == "," || w[i] == "from" || w[i] == "where" || w[i] == "returning" || w[i] == ";") {
+				break
+			}
+		}
+		if i >= len(w) || w[i] != "," {
+			break
+		}
+		i++
+	}
+	slices.Sort(columns)
+	return slices.Compact(columns)
+}
+
+// readUpdatesFile reads the UPDATE statements of a file, weight 1 each.
+func readUpdatesFile(path string) ([]*updateStatement, error) {
+	var updates []*updateStatement
+	err := readSQLFile(path, func(stmt string) {
+		if table, columns, ok := parseUpdate(stmt); ok {
+			updates = append(updates, &updateStatement{Table: table, Columns: columns, Weight: 1, Query: oneLine(stmt, 200)})
+		}
+	})
+	return updates, err
+}
+
+// readUpdatesStatements reads the UPDATE statements of this database from
+// pg_stat_statements, weighted by calls.
+func readUpdatesStatements(ctx context.Context, pool *pgxpool.Pool) ([]*updateStatement, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT s.query, sum(s.calls)::float8
+		FROM pg_stat_statements s
+		JOIN pg_database d ON d.oid = s.dbid
+		WHERE d.datname = current_database() AND s.query ~* '\mupdate\M'
+		GROUP BY s.query
+	`)
+	if err != nil {
+		return nil, statementsError(err)
+	}
+	var updates []*updateStatement
+	var query string
+	var calls float64
+	if _, err := pgx.ForEachRow(rows, []any{&query, &calls}, func() error {
+		if table, columns, ok := parseUpdate(query); ok {
+			updates = append(updates, &updateStatement{Table: table, Columns: columns, Weight: calls, Query: oneLine(query, 200)})
+		}
+		return nil
+	}); err != nil {
+		return nil, statementsError(err)
+	}
+	return updates, nil
+}
+
+// hotIndex is an index of an advised table.
+type hotIndex struct {
+	Index   *auditedIndex `json:"index"`
+	Columns []string      `json:"columns"` // Every column it references
+	// Blocks is the workload weight of the updates that set one of its
+	// columns; Sole the part no other index blocks too.
+	Blocks float64 `json:"blocked_updates"`
+	Sole   float64 `json:"only_blocker_updates"`
+	relid  uint32
+}
+
+// hotAdvice is one recommendation.
+type hotAdvice struct {
+	Kind   string `json:"kind"` // fillfactor or drop-index
+	Reason string `json:"reason"`
+	SQL    string `json:"sql"`
+}
+
+// hotTable is one table with its update statistics and the advice for it.
+type hotTable struct {
+	Schema         string             `json:"schema"`
+	Table          string             `json:"table"`
+	Bytes          int64              `json:"bytes"`
+	Fillfactor     int                `json:"fillfactor"`
+	Updates        int64              `json:"updates"`
+	HotUpdates     int64              `json:"hot_updates"`
+	NewPageUpdates *int64             `json:"newpage_updates,omitempty"` // PostgreSQL 16+
+	HotPct         float64            `json:"hot_pct"`
+	Statements     int                `json:"workload_statements"`
+	WorkloadWeight float64            `json:"workload_updates"`
+	EligiblePct    *float64           `json:"hot_eligible_pct,omitempty"` // Workload updates that set no indexed column
+	PageFullPct    *float64           `json:"page_full_pct,omitempty"`
+	ColumnUpdates  map[string]float64 `json:"column_updates,omitempty"` // Workload weight per column set
+	Indexes        []*hotIndex        `json:"indexes"`
+	Advice         []hotAdvice        `json:"advice"`
+
+	relid   uint32
+	updates []*updateStatement
+}
+
+// qualified is the table name as ALTER TABLE takes it.
+func (t *hotTable) qualified() string {
+	return pgx.Identifier{t.Schema, t.Table}.Sanitize()
+}
+
+// hotReport is the result of adviseHOT.
+type hotReport struct {
+	Database   string             `json:"database"`
+	StatsSince time.Time          `json:"stats_since"`
+	Source     string             `json:"workload_source"`
+	Statements int                `json:"workload_statements"`
+	Unresolved []*updateStatement `json:"unresolved_statements,omitempty"` // Tables not found
+	Tables     []*hotTable        `json:"tables"`
+}
+
+// hotOptions are the flags of hot-advisor.
+type hotOptions struct {
+	schema     string
+	minUpdates int64
+	minGap     float64
+	maxScans   int64
+	top        int
+	replicas   []*pgxpool.Pool
+}
+
+// adviseHOT reads the update statistics and indexes of the busiest tables
+// and matches them with the workload's updates.
+func adviseHOT(ctx context.Context, pool *pgxpool.Pool, updates []*updateStatement, opts hotOptions) (*hotReport, error) {
+	report := &hotReport{Statements: len(updates)}
+	var version int
+	if err := pool.QueryRow(ctx, `
+		SELECT current_database()::text, coalesce(stats_reset, pg_postmaster_start_time()),
+		       current_setting('server_version_num')::int
+		FROM pg_stat_database WHERE datname = current_database()
+	`).Scan(&report.Database, &report.StatsSince, &version); err != nil {
+		return nil, fmt.Errorf("failed to read statistics age: %w", err)
+	}
+
+	newpage := "NULL::bigint"
+	if version >= 160000 {
+		newpage = "s.n_tup_newpage_upd"
+	}
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT s.relid::int8, s.schemaname::text, s.relname::text, pg_table_size(s.relid),
+		       coalesce((SELECT o.option_value::int FROM pg_options_to_table(c.reloptions) o
+		                 WHERE o.option_name = 'fillfactor'), 100),
+		       s.n_tup_upd, s.n_tup_hot_upd, %s
+		FROM pg_stat_user_tables s
+		JOIN pg_class c ON c.oid = s.relid
+		WHERE s.n_tup_upd >= $1 AND ($2 = '' OR s.schemaname = $2)
+		ORDER BY s.n_tup_upd - s.n_tup_hot_upd DESC
+	`, newpage), opts.minUpdates, opts.schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	tables, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*hotTable, error) {
+		t := &hotTable{ColumnUpdates: map[string]float64{}}
+		var relid int64
+		err := row.Scan(&relid, &t.Schema, &t.Table, &t.Bytes, &t.Fillfactor,
+			&t.Updates, &t.HotUpdates, &t.NewPageUpdates)
+		t.relid = uint32(relid)
+		return t, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	byRelid := map[uint32]*hotTable{}
+	relids := make([]int64, 0, len(tables))
+	for _, t := range tables {
+		byRelid[t.relid] = t
+		relids = append(relids, int64(t.relid))
+	}
+
+	// Resolve the workload's tables, partitions included.
+	resolved := map[string][]int64{}
+	for _, u := range updates {
+		leaves, ok := resolved[u.Table]
+		if !ok {
+			err := pool.QueryRow(ctx, `
+				SELECT coalesce(array_agg(p.relid::int8), '{}')
+				FROM pg_partition_tree(to_regclass($1)) p
+				WHERE p.isleaf
+			`, u.Table).Scan(&leaves)
+			if err != nil {
+				leaves = nil
+			}
+			resolved[u.Table] = leaves
+		}
+		if len(leaves) == 0 {
+			report.Unresolved = append(report.Unresolved, u)
+			continue
+		}
+		for _, relid := range leaves {
+			if t := byRelid[uint32(relid)]; t != nil {
+				t.updates = append(t.updates, u)
+			}
+		}
+	}
+
+	if err := readHOTIndexes(ctx, pool, relids, version, byRelid, opts.replicas); err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		t.advise(opts)
+	}
+
+	// Tables with advice first, then by non-HOT updates.
+	slices.SortStableFunc(tables, func(a, b *hotTable) int {
+		if (len(a.Advice) > 0) != (len(b.Advice) > 0) {
+			if len(a.Advice) > 0 {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(b.Updates-b.HotUpdates, a.Updates-a.HotUpdates)
+	})
+	if opts.top > 0 && len(tables) > opts.top {
+		tables = tables[:opts.top]
+	}
+	report.Tables = tables
+	return report, nil
+}
+
+// readHOTIndexes attaches to each table its indexes and the columns they
+// reference: keys, INCLUDE columns, and the columns of expressions and
+// predicates (through pg_depend).
+func readHOTIndexes(ctx context.Context, pool *pgxpool.Pool, relids []int64, version int, byRelid map[uint32]*hotTable, replicas []*pgxpool.Pool) error {
+	rows, err := pool.Query(ctx, `
+		SELECT x.indrelid::int8, n.nspname::text, t.relname::text, c.relname::text,
+		       pg_get_indexdef(x.indexrelid), pg_relation_size(x.indexrelid), coalesce(s.idx_scan, 0),
+		       x.indisunique, x.indisprimary, x.indisvalid,
+		       EXISTS (SELECT 1 FROM pg_constraint k WHERE k.conindid = x.indexrelid),
+		       am.amname::text,
+		       ARRAY(SELECT a.attname::text FROM pg_attribute a
+		             WHERE a.attrelid = x.indrelid AND a.attnum > 0
+		               AND (a.attnum = ANY (x.indkey::int2[])
+		                    OR EXISTS (SELECT 1 FROM pg_depend d
+		                               WHERE d.classid = 'pg_class'::regclass AND d.objid = x.indexrelid
+		                                 AND d.refclassid = 'pg_class'::regclass AND d.refobjid = x.indrelid
+		                                 AND d.refobjsubid = a.attnum))
+		             ORDER BY a.attnum)
+		FROM pg_index x
+		JOIN pg_class c ON c.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_am am ON am.oid = c.relam
+		LEFT JOIN pg_stat_user_indexes s ON s.indexrelid = x.indexrelid
+		WHERE x.indrelid = ANY ($1) AND x.indisready
+		ORDER BY 1, 4
+	`, relids)
+	if err != nil {
+		return fmt.Errorf("failed to read indexes: %w", err)
+	}
+	var audited []*auditedIndex
+	_, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (struct{}, error) {
+		var relid int64
+		ix := &auditedIndex{}
+		h := &hotIndex{Index: ix}
+		err := row.Scan(&relid, &ix.Schema, &ix.Table, &ix.Name, &ix.Definition, &ix.Bytes, &ix.Scans,
+			&ix.unique, &ix.primary, &ix.valid, &ix.constraint, &ix.method, &h.Columns)
+		if err != nil {
+			return struct{}{}, err
+		}
+		// Summarizing indexes are updated without breaking HOT.
+		if ix.method == "brin" && version >= 160000 {
+			return struct{}{}, nil
+		}
+		h.relid = uint32(relid)
+		byRelid[h.relid].Indexes = append(byRelid[h.relid].Indexes, h)
+		audited = append(audited, ix)
+		return struct{}{}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read indexes: %w", err)
+	}
+	for _, replica := range replicas {
+		if _, err := addReplicaScans(ctx, replica, audited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advise splits the table's updates into HOT-eligible and index-blocked
+// ones and derives the recommendations.
+func (t *hotTable) advise(opts hotOptions) {
+	if t.Updates > 0 {
+		t.HotPct = float64(t.HotUpdates) / float64(t.Updates) * 100
+	}
+	if t.NewPageUpdates != nil && t.Updates > 0 {
+		pct := float64(*t.NewPageUpdates) / float64(t.Updates) * 100
+		t.PageFullPct = &pct
+	}
+
+	var eligible float64
+	for _, u := range t.updates {
+		t.Statements++
+		t.WorkloadWeight += u.Weight
+		var blockers []*hotIndex
+		for _, col := range u.Columns {
+			t.ColumnUpdates[col] += u.Weight
+		}
+		for _, ix := range t.Indexes {
+			if slices.ContainsFunc(u.Columns, func(c string) bool { return slices.Contains(ix.Columns, c) }) {
+				ix.Blocks += u.Weight
+				blockers = append(blockers, ix)
+			}
+		}
+		switch len(blockers) {
+		case 0:
+			eligible += u.Weight
+		case 1:
+			blockers[0].Sole += u.Weight
+		}
+	}
+	if t.WorkloadWeight > 0 {
+		pct := eligible / t.WorkloadWeight * 100
+		t.EligiblePct = &pct
+		// The observed ratio can't beat the eligible share; what's missing
+		// is page-full.
+		gap := max(pct-t.HotPct, 0)
+		t.PageFullPct = &gap
+	}
+
+	if t.PageFullPct != nil && *t.PageFullPct >= opts.minGap {
+		gap := *t.PageFullPct
+		ff := 90
+		switch {
+		case gap >= 40:
+			ff = 70
+		case gap >= 20:
+			ff = 80
+		}
+		if ff >= t.Fillfactor {
+			ff = t.Fillfactor - 10
+		}
+		if ff >= 50 {
+			t.Advice = append(t.Advice, hotAdvice{
+				Kind: "fillfactor",
+				Reason: fmt.Sprintf("%.0f%% of updates found no room on their page (fillfactor %d)",
+					gap, t.Fillfactor),
+				SQL: fmt.Sprintf("ALTER TABLE %s SET (fillfactor = %d);  -- new pages only; pg_repack to rewrite",
+					t.qualified(), ff),
+			})
+		}
+	}
+
+	for _, ix := range t.Indexes {
+		if ix.Blocks == 0 || ix.Index.enforces() || ix.Index.Scans > opts.maxScans {
+			continue
+		}
+		reason := fmt.Sprintf("%d scans; blocks HOT for %.0f%% of workload updates", ix.Index.Scans,
+			ix.Blocks/t.WorkloadWeight*100)
+		if ix.Sole > 0 {
+			reason += fmt.Sprintf(", dropping it makes %.0f%% HOT-eligible", ix.Sole/t.WorkloadWeight*100)
+		} else {
+			reason += " (other indexes block the same updates)"
+		}
+		t.Advice = append(t.Advice, hotAdvice{
+			Kind:   "drop-index",
+			Reason: reason,
+			SQL:    fmt.Sprintf("DROP INDEX CONCURRENTLY %s;", ix.Index.qualified()),
+		})
+	}
+}
+
+// printHOTReport writes the report for a person.
+func printHOTReport(r *hotReport) {
+	age := time.Since(r.StatsSince)
+	fmt.Printf("🔥 HOT updates in %s: %d tables (statistics since %s, %s), workload: %d UPDATE statements from %s\n",
+		r.Database, len(r.Tables), r.StatsSince.Format("2006-01-02 15:04"), formatAge(age), r.Statements, r.Source)
+	if len(r.Unresolved) > 0 {
+		fmt.Printf("⚠️  %d statements update tables not found here:", len(r.Unresolved))
+		for _, u := range r.Unresolved[:min(len(r.Unresolved), 5)] {
+			fmt.Printf(" %s", u.Table)
+		}
+		fmt.Println()
+	}
+	if len(r.Tables) == 0 {
+		fmt.Println("✅ No table with enough updates (-min-updates)")
+		return
+	}
+
+	var advice []string
+	for _, t := range r.Tables {
+		fmt.Printf("\n%s  %s, fillfactor %d\n", t.Schema+"."+t.Table, formatBytes(t.Bytes), t.Fillfactor)
+		line := fmt.Sprintf("   HOT %.1f%% of %d updates", t.HotPct, t.Updates)
+		if t.NewPageUpdates != nil {
+			line += fmt.Sprintf(", %d to a new page", *t.NewPageUpdates)
+		}
+		fmt.Println(line)
+		if t.EligiblePct != nil {
+			fmt.Printf("   workload: %d statements, %.0f updates, %.1f%% set no indexed column\n",
+				t.Statements, t.WorkloadWeight, *t.EligiblePct)
+			cols := make([]string, 0, len(t.ColumnUpdates))
+			for c := range t.ColumnUpdates {
+				cols = append(cols, c)
+			}
+			slices.SortFunc(cols, func(a, b string) int { return cmp.Compare(t.ColumnUpdates[b], t.ColumnUpdates[a]) })
+			for _, c := range cols {
+				var by []string
+				for _, ix := range t.Indexes {
+					if slices.Contains(ix.Columns, c) {
+						by = append(by, fmt.Sprintf("%s (%d scans)", ix.Index.Name, ix.Index.Scans))
+					}
+				}
+				status := "not indexed"
+				if len(by) > 0 {
+					status = "indexed by " + strings.Join(by, ", ")
+				}
+				fmt.Printf("      %-30s %5.1f%% of updates, %s\n", c, t.ColumnUpdates[c]/t.WorkloadWeight*100, status)
+			}
+		} else {
+			fmt.Println("   workload: no UPDATE statements for this table")
+		}
+		for _, a := range t.Advice {
+			fmt.Printf("   → %s: %s\n", a.Kind, a.Reason)
+			advice = append(advice, a.SQL)
+		}
+	}
+
+	if len(advice) == 0 {
+		fmt.Println("\n✅ No fillfactor or index changes to recommend")
+		return
+	}
+	fmt.Println("\nTo apply (index drops one at a time, outside a transaction):")
+	for _, sql := range advice {
+		fmt.Printf("   %s\n", sql)
+	}
+}
+
+// HOTAdvisor runs the hot-advisor command line tool.
+func HOTAdvisor() {
+	var dsn, workload, format string
+	var replicaDSNs stringList
+	opts := hotOptions{}
+	registerDSNFlag(&dsn)
+	flag.Var(&replicaDSNs, "replica-dsn", "Replica whose index scans count too (repeatable)")
+	flag.StringVar(&workload, "workload", "", "File of UPDATE statements (default: pg_stat_statements)")
+	flag.StringVar(&opts.schema, "schema", "", "Only advise on this schema (default: all)")
+	flag.Int64Var(&opts.minUpdates, "min-updates", 1000, "Leave out tables with fewer updates")
+	flag.Float64Var(&opts.minGap, "min-gap", 10, "Recommend a fillfactor when at least this % of updates are page-full")
+	flag.Int64Var(&opts.maxScans, "max-scans", 100, "Recommend dropping blocking indexes with at most this many scans")
+	flag.IntVar(&opts.top, "top", 20, "Tables to report (0: all)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx := context.Background()
+	pool, err := connect(ctx, dsn, "hot-advisor", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	for _, r := range replicaDSNs {
+		replica, err := connect(ctx, r, "hot-advisor", 1)
+		if err != nil {
+			log.Fatalf("-replica-dsn: %v", err)
+		}
+		defer replica.Close()
+		opts.replicas = append(opts.replicas, replica)
+	}
+
+	var updates []*updateStatement
+	source := "pg_stat_statements"
+	if workload != "" {
+		source = workload
+		updates, err = readUpdatesFile(workload)
+	} else {
+		updates, err = readUpdatesStatements(ctx, pool)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	report, err := adviseHOT(ctx, pool, updates, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report.Source = source
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printHOTReport(report)
+}
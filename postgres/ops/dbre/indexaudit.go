@@ -0,0 +1,431 @@
+package dbre
+
+// ============================================================================
+// UNUSED AND REDUNDANT INDEXES (cmd/index-audit)
+// ============================================================================
+//
+// Every index costs an entry on each INSERT and non-HOT UPDATE of its
+// table, plus WAL, vacuum time and cache. index-audit combines the usage
+// counters of pg_stat_user_indexes with the definitions in pg_index and
+// reports four kinds of indexes worth dropping:
+//   invalid     left behind by a failed CREATE INDEX CONCURRENTLY: never
+//               used by queries, still maintained on every write once ready
+//   duplicate   same columns, operator classes, collations, ordering,
+//               expressions and predicate as another index of the table
+//   redundant   a btree whose key columns are a leading prefix of another
+//               btree with the same predicate, e.g. (account_id) next to
+//               (account_id, created_at)
+//   unused      no scans since the statistics were reset
+// Indexes behind a primary key, unique or exclusion constraint, or
+// referenced by a foreign key, and unique indexes are never reported as
+// unused or redundant: they enforce something even when nothing reads
+// them. Indexes of partitioned tables are left out (they are dropped on the
+// parent).
+//
+// For each finding the reclaimable space is the index size, and the write
+// amplification saved is the index entries the table's inserts and
+// non-HOT updates added to it since the statistics reset. The report ends
+// with the DROP INDEX CONCURRENTLY statements; nothing is dropped.
+//
+// Scan counters are per server, so an index idle on the primary may serve
+// the replicas: give each one with -replica-dsn and their scans are added.
+// Right after a stats reset (or on a new replica) every index looks unused,
+// so unused indexes are only reported once all counters cover
+// -min-stats-age.
+//
+//   go run ./cmd/index-audit -dsn=postgres://dbre@db1/avro -replica-dsn=postgres://dbre@db2/avro
+//   go run ./cmd/index-audit -schema=public -min-size=10MB -format=json
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// auditedIndex is one index with its definition and usage.
+type auditedIndex struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Name       string `json:"index"`
+	Definition string `json:"definition"`
+	Bytes      int64  `json:"bytes"`
+	Scans      int64  `json:"scans"`
+	// Writes are the table's inserts plus non-HOT updates since the
+	// statistics reset, one index entry each.
+	Writes int64 `json:"writes"`
+
+	unique, primary, valid, ready, constraint bool
+	method                                    string
+	keyCount                                  int
+	columns, classes, collations, options     []string
+	expressions, predicate                    string
+}
+
+// qualified is the index name as DROP INDEX takes it.
+func (ix *auditedIndex) qualified() string {
+	return pgx.Identifier{ix.Schema, ix.Name}.Sanitize()
+}
+
+// enforces reports whether dropping the index would drop a guarantee.
+func (ix *auditedIndex) enforces() bool {
+	return ix.unique || ix.primary || ix.constraint
+}
+
+// sameDefinition reports whether ix and other index the same thing.
+func (ix *auditedIndex) sameDefinition(other *auditedIndex) bool {
+	return ix.method == other.method && ix.keyCount == other.keyCount &&
+		slices.Equal(ix.columns, other.columns) && slices.Equal(ix.classes, other.classes) &&
+		slices.Equal(ix.collations, other.collations) && slices.Equal(ix.options, other.options) &&
+		ix.expressions == other.expressions && ix.predicate == other.predicate
+}
+
+// coveredBy reports whether other serves every lookup ix serves: ix's key
+// columns lead other's, and other holds any INCLUDE columns ix has.
+func (ix *auditedIndex) coveredBy(other *auditedIndex) bool {
+	if ix.method != "btree" || other.method != "btree" || ix.expressions != "" || other.expressions != "" ||
+		ix.predicate != other.predicate || ix.keyCount > other.keyCount {
+		return false
+	}
+	k := ix.keyCount
+	if !slices.Equal(ix.columns[:k], other.columns[:k]) || !slices.Equal(ix.classes[:k], other.classes[:k]) ||
+		!slices.Equal(ix.collations[:k], other.collations[:k]) || !slices.Equal(ix.options[:k], other.options[:k]) {
+		return false
+	}
+	for _, col := range ix.columns[k:] {
+		if !slices.Contains(other.columns, col) {
+			return false
+		}
+	}
+	// Equal keys and INCLUDE lists would cover each other: only the index
+	// with fewer columns is redundant.
+	return ix.keyCount < other.keyCount || len(ix.columns) < len(other.columns)
+}
+
+// indexFinding is an index worth dropping.
+type indexFinding struct {
+	Kind   string        `json:"kind"`
+	Reason string        `json:"reason"`
+	Index  *auditedIndex `json:"index"`
+	Drop   string        `json:"drop"`
+}
+
+// indexAudit is the result of auditIndexes.
+type indexAudit struct {
+	Database     string         `json:"database"`
+	StatsSince   time.Time      `json:"stats_since"`
+	Indexes      int            `json:"indexes"`
+	IndexBytes   int64          `json:"index_bytes"`
+	Findings     []indexFinding `json:"findings"`
+	Reclaimable  int64          `json:"reclaimable_bytes"`
+	SavedWrites  int64          `json:"saved_index_writes"`
+	UnusedHidden bool           `json:"unused_skipped,omitempty"`
+}
+
+// indexAuditOptions are the flags of index-audit.
+type indexAuditOptions struct {
+	schema      string
+	minSize     int64
+	minStatsAge time.Duration
+	replicas    []*pgxpool.Pool
+}
+
+// auditIndexes reads every index of the database and classifies the ones
+// worth dropping.
+func auditIndexes(ctx context.Context, pool *pgxpool.Pool, opts indexAuditOptions) (*indexAudit, error) {
+	audit := &indexAudit{}
+	if err := pool.QueryRow(ctx, `
+		SELECT current_database()::text, coalesce(stats_reset, pg_postmaster_start_time())
+		FROM pg_stat_database WHERE datname = current_database()
+	`).Scan(&audit.Database, &audit.StatsSince); err != nil {
+		return nil, fmt.Errorf("failed to read statistics age: %w", err)
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT n.nspname::text, t.relname::text, c.relname::text, pg_get_indexdef(x.indexrelid),
+		       pg_relation_size(x.indexrelid), coalesce(s.idx_scan, 0),
+		       coalesce(st.n_tup_ins + st.n_tup_upd - st.n_tup_hot_upd, 0),
+		       x.indisunique, x.indisprimary, x.indisvalid, x.indisready,
+		       EXISTS (SELECT 1 FROM pg_constraint k WHERE k.conindid = x.indexrelid),
+		       am.amname::text, x.indnkeyatts, x.indkey::text, x.indclass::text,
+		       x.indcollation::text, x.indoption::text,
+		       coalesce(pg_get_expr(x.indexprs, x.indrelid), ''),
+		       coalesce(pg_get_expr(x.indpred, x.indrelid), '')
+		FROM pg_index x
+		JOIN pg_class c ON c.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_am am ON am.oid = c.relam
+		LEFT JOIN pg_stat_user_indexes s ON s.indexrelid = x.indexrelid
+		LEFT JOIN pg_stat_user_tables st ON st.relid = x.indrelid
+		WHERE n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg\_toast%'
+		  AND c.relkind = 'i' AND t.relkind IN ('r', 'm')
+		  AND NOT EXISTS (SELECT 1 FROM pg_inherits i WHERE i.inhrelid = x.indexrelid)
+		  AND ($1 = '' OR n.nspname = $1)
+		ORDER BY 1, 2, 3
+	`, opts.schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	indexes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*auditedIndex, error) {
+		var ix auditedIndex
+		var columns, classes, collations, options string
+		err := row.Scan(&ix.Schema, &ix.Table, &ix.Name, &ix.Definition, &ix.Bytes, &ix.Scans, &ix.Writes,
+			&ix.unique, &ix.primary, &ix.valid, &ix.ready, &ix.constraint,
+			&ix.method, &ix.keyCount, &columns, &classes, &collations, &options,
+			&ix.expressions, &ix.predicate)
+		ix.columns, ix.classes = strings.Fields(columns), strings.Fields(classes)
+		ix.collations, ix.options = strings.Fields(collations), strings.Fields(options)
+		if !ix.ready {
+			ix.Writes = 0
+		}
+		return &ix, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	for _, replica := range opts.replicas {
+		since, err := addReplicaScans(ctx, replica, indexes)
+		if err != nil {
+			return nil, err
+		}
+		if since.After(audit.StatsSince) {
+			audit.StatsSince = since
+		}
+	}
+
+	flagged := map[*auditedIndex]bool{}
+	add := func(kind, reason string, ix *auditedIndex) {
+		flagged[ix] = true
+		audit.Findings = append(audit.Findings, indexFinding{
+			Kind: kind, Reason: reason, Index: ix,
+			Drop: fmt.Sprintf("DROP INDEX CONCURRENTLY %s;", ix.qualified()),
+		})
+	}
+
+	for _, ix := range indexes {
+		audit.Indexes++
+		audit.IndexBytes += ix.Bytes
+		if !ix.valid {
+			reason := "failed build, not used by queries"
+			if ix.ready {
+				reason += ", still maintained on writes"
+			}
+			add("invalid", reason, ix)
+		}
+	}
+
+	byTable := map[string][]*auditedIndex{}
+	for _, ix := range indexes {
+		if ix.valid {
+			key := ix.Schema + "." + ix.Table
+			byTable[key] = append(byTable[key], ix)
+		}
+	}
+	tables := make([]string, 0, len(byTable))
+	for t := range byTable {
+		tables = append(tables, t)
+	}
+	slices.Sort(tables)
+
+	for _, t := range tables {
+		// Keep the index that enforces something, then the busiest one.
+		group := slices.Clone(byTable[t])
+		slices.SortStableFunc(group, func(a, b *auditedIndex) int {
+			if a.enforces() != b.enforces() {
+				if a.enforces() {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Compare(b.Scans, a.Scans)
+		})
+		for i, ix := range group {
+			if flagged[ix] || ix.primary || ix.constraint {
+				continue
+			}
+			for _, keep := range group[:i] {
+				if !flagged[keep] && (keep.unique || !ix.unique) && ix.sameDefinition(keep) {
+					add("duplicate", "same definition as "+keep.Name, ix)
+					break
+				}
+			}
+		}
+		for _, ix := range byTable[t] {
+			if flagged[ix] || ix.enforces() {
+				continue
+			}
+			for _, other := range byTable[t] {
+				if other != ix && !flagged[other] && ix.coveredBy(other) {
+					add("redundant", "leading columns of "+other.Name, ix)
+					break
+				}
+			}
+		}
+	}
+
+	if age := time.Since(audit.StatsSince); age < opts.minStatsAge {
+		audit.UnusedHidden = true
+	} else {
+		for _, ix := range indexes {
+			if ix.valid && ix.Scans == 0 && !flagged[ix] && !ix.enforces() {
+				add("unused", fmt.Sprintf("no scans in %s", formatAge(age)), ix)
+			}
+		}
+	}
+
+	audit.Findings = slices.DeleteFunc(audit.Findings, func(f indexFinding) bool {
+		return f.Index.Bytes < opts.minSize
+	})
+	for _, f := range audit.Findings {
+		audit.Reclaimable += f.Index.Bytes
+		audit.SavedWrites += f.Index.Writes
+	}
+	return audit, nil
+}
+
+// addReplicaScans adds a replica's index scans to indexes and returns when
+// its counters start.
+func addReplicaScans(ctx context.Context, replica *pgxpool.Pool, indexes []*auditedIndex) (time.Time, error) {
+	var since time.Time
+	if err := replica.QueryRow(ctx, `
+		SELECT coalesce(stats_reset, pg_postmaster_start_time())
+		FROM pg_stat_database WHERE datname = current_database()
+	`).Scan(&since); err != nil {
+		return since, fmt.Errorf("replica %s: %w", describeTarget(replica.Config()), err)
+	}
+	rows, err := replica.Query(ctx, `SELECT schemaname::text, indexrelname::text, idx_scan FROM pg_stat_user_indexes`)
+	if err != nil {
+		return since, fmt.Errorf("replica %s: %w", describeTarget(replica.Config()), err)
+	}
+	scans := map[string]int64{}
+	var schema, name string
+	var n int64
+	if _, err := pgx.ForEachRow(rows, []any{&schema, &name, &n}, func() error {
+		scans[schema+"."+name] = n
+		return nil
+	}); err != nil {
+		return since, fmt.Errorf("replica %s: %w", describeTarget(replica.Config()), err)
+	}
+	for _, ix := range indexes {
+		ix.Scans += scans[ix.Schema+"."+ix.Name]
+	}
+	return since, nil
+}
+
+// formatAge renders a duration in days, hours below two days, or minutes
+// below two hours.
+func formatAge(d time.Duration) string {
+	if d < 2*time.Hour {
+		return fmt.Sprintf("%.0fm", d.Minutes())
+	}
+	if d < 48*time.Hour {
+		return fmt.Sprintf("%.0fh", d.Hours())
+	}
+	return fmt.Sprintf("%.0fd", d.Hours()/24)
+}
+
+// printIndexAudit writes the report for a person.
+func printIndexAudit(audit *indexAudit) {
+	age := time.Since(audit.StatsSince)
+	fmt.Printf("🔎 Index audit of %s: %d indexes, %s (statistics since %s, %s)\n",
+		audit.Database, audit.Indexes, formatBytes(audit.IndexBytes),
+		audit.StatsSince.Format("2006-01-02 15:04"), formatAge(age))
+	if audit.UnusedHidden {
+		fmt.Printf("⚠️  Statistics cover only %s: unused indexes not reported (-min-stats-age)\n", formatAge(age))
+	}
+	if len(audit.Findings) == 0 {
+		fmt.Println("✅ No invalid, duplicate, redundant or unused indexes")
+		return
+	}
+
+	for _, kind := range []string{"invalid", "duplicate", "redundant", "unused"} {
+		header := false
+		for _, f := range audit.Findings {
+			if f.Kind != kind {
+				continue
+			}
+			if !header {
+				fmt.Printf("\n%s\n", strings.ToUpper(kind))
+				header = true
+			}
+			ix := f.Index
+			fmt.Printf("   %-45s %10s %14d writes  %s\n",
+				ix.Schema+"."+ix.Table+" "+ix.Name, formatBytes(ix.Bytes), ix.Writes, f.Reason)
+			fmt.Printf("      %s\n", ix.Definition)
+		}
+	}
+
+	fmt.Printf("\n%d index(es), %s reclaimable, %d index entry writes saved", len(audit.Findings),
+		formatBytes(audit.Reclaimable), audit.SavedWrites)
+	if days := age.Hours() / 24; days >= 1 {
+		fmt.Printf(" (%.0f/day)", float64(audit.SavedWrites)/days)
+	}
+	fmt.Println()
+	fmt.Println("\nTo drop them (one at a time, outside a transaction):")
+	for _, f := range audit.Findings {
+		fmt.Printf("   %s\n", f.Drop)
+	}
+}
+
+// IndexAudit runs the index-audit command line tool.
+func IndexAudit() {
+	var dsn, schema, minSize, format string
+	var replicaDSNs stringList
+	var minStatsAge time.Duration
+	registerDSNFlag(&dsn)
+	flag.Var(&replicaDSNs, "replica-dsn", "Replica whose index scans count too (repeatable)")
+	flag.StringVar(&schema, "schema", "", "Only audit this schema (default: all)")
+	flag.StringVar(&minSize, "min-size", "0", "Leave out indexes smaller than this, e.g. 10MB")
+	flag.DurationVar(&minStatsAge, "min-stats-age", 7*24*time.Hour, "Statistics must cover this long before unused indexes are reported")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+
+	opts := indexAuditOptions{schema: schema, minStatsAge: minStatsAge}
+	var err error
+	if opts.minSize, err = parseByteSize(minSize); err != nil {
+		log.Fatalf("-min-size: %v", err)
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx := context.Background()
+	pool, err := connect(ctx, dsn, "index-audit", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	for _, r := range replicaDSNs {
+		replica, err := connect(ctx, r, "index-audit", 1)
+		if err != nil {
+			log.Fatalf("-replica-dsn: %v", err)
+		}
+		defer replica.Close()
+		opts.replicas = append(opts.replicas, replica)
+	}
+
+	audit, err := auditIndexes(ctx, pool, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(audit); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printIndexAudit(audit)
+}
@@ -0,0 +1,357 @@
+package dbre
+
+// ============================================================================
+// LOCK AND BLOCKING TREES (cmd/locks)
+// ============================================================================
+//
+// When sessions pile up behind a lock, the question is who is at the root.
+// locks samples pg_stat_activity with pg_blocking_pids() and the
+// ungranted rows of pg_locks, and prints every blocker→blocked tree: for
+// each session its user, application, state, how long it has waited and
+// for which lock, its transaction age and query text. A root is a session
+// blocking others without waiting itself; often an idle-in-transaction
+// session or a long report in front of a DDL statement, with the whole
+// application queued behind the DDL.
+//   -interval=5s         sample repeatedly instead of once
+//   -format=json         one JSON object per sample, trees nested, for
+//                        piping into jq or an incident channel
+//   -min-wait=10s        only trees in which someone waited this long
+//
+// During an incident, -cancel-after=2m cancels (pg_cancel_backend) every
+// root blocker with a session waiting behind it for longer than that.
+// Cancelling ends a running statement but not an idle transaction, which
+// still holds its locks; -terminate uses pg_terminate_backend instead, for
+// those too. Only client backends are touched, never users listed with
+// -protect-user, and -dry-run prints what would be done. Every action is
+// printed with the session's query.
+//
+//   go run ./cmd/locks
+//   go run ./cmd/locks -interval=5s -min-wait=10s -format=json >> locks.ndjson
+//   go run ./cmd/locks -interval=5s -cancel-after=2m -terminate -protect-user=replicator
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lockSession is a backend taking part in a blocking tree.
+type lockSession struct {
+	PID         int            `json:"pid"`
+	User        string         `json:"user"`
+	Application string         `json:"application"`
+	Client      string         `json:"client,omitempty"`
+	BackendType string         `json:"backend_type"`
+	State       string         `json:"state"`
+	WaitingFor  string         `json:"waiting_for,omitempty"`
+	Waited      time.Duration  `json:"waited_ns,omitempty"`
+	XactAge     time.Duration  `json:"xact_age_ns,omitempty"`
+	Query       string         `json:"query"`
+	Blocks      []*lockSession `json:"blocks,omitempty"`
+
+	blockedBy []int
+}
+
+// maxWait is the longest wait in the tree below s.
+func (s *lockSession) maxWait() time.Duration {
+	longest := time.Duration(0)
+	for _, b := range s.Blocks {
+		longest = max(longest, b.Waited, b.maxWait())
+	}
+	return longest
+}
+
+// size counts the sessions waiting below s.
+func (s *lockSession) size() int {
+	n := 0
+	for _, b := range s.Blocks {
+		n += 1 + b.size()
+	}
+	return n
+}
+
+// lockSample is one look at the blocking trees.
+type lockSample struct {
+	Time    time.Time      `json:"time"`
+	Waiting int            `json:"waiting"`
+	Trees   []*lockSession `json:"trees"`
+	Actions []string       `json:"actions,omitempty"`
+}
+
+// sampleLocks builds the blocking trees, longest wait first.
+func sampleLocks(ctx context.Context, pool *pgxpool.Pool) (*lockSample, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT a.pid, pg_blocking_pids(a.pid), coalesce(a.usename::text, ''), a.application_name,
+		       coalesce(a.client_addr::text, ''), a.backend_type, coalesce(a.state, ''),
+		       coalesce(extract(epoch FROM now() - a.state_change), 0)::float8,
+		       coalesce(extract(epoch FROM now() - a.xact_start), 0)::float8,
+		       coalesce(a.query, ''),
+		       coalesce((SELECT string_agg(l.mode || ' on ' ||
+		                   CASE WHEN l.relation IS NOT NULL AND l.database = d.oid THEN l.relation::regclass::text
+		                        ELSE l.locktype END, ', ')
+		                 FROM pg_locks l WHERE l.pid = a.pid AND NOT l.granted), '')
+		FROM pg_stat_activity a, pg_database d
+		WHERE d.datname = current_database() AND a.pid <> pg_backend_pid()
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample pg_stat_activity: %w", err)
+	}
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*lockSession, error) {
+		var s lockSession
+		var stateAge, xactAge float64
+		err := row.Scan(&s.PID, &s.blockedBy, &s.User, &s.Application, &s.Client, &s.BackendType, &s.State,
+			&stateAge, &xactAge, &s.Query, &s.WaitingFor)
+		s.XactAge = seconds(xactAge)
+		if len(s.blockedBy) > 0 {
+			// A waiting session's state changed to active when its
+			// statement started, so this is at most the statement age.
+			s.Waited = seconds(stateAge)
+		}
+		return &s, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample pg_stat_activity: %w", err)
+	}
+
+	byPID := map[int]*lockSession{}
+	for _, s := range sessions {
+		byPID[s.PID] = s
+	}
+	sample := &lockSample{Time: time.Now()}
+	blocking := map[int]bool{}
+	for _, s := range sessions {
+		if len(s.blockedBy) == 0 {
+			continue
+		}
+		sample.Waiting++
+		for _, pid := range s.blockedBy {
+			blocking[pid] = true
+			// A waiter hangs under its first blocker still known; the
+			// others are listed in waiting_for.
+			if b := byPID[pid]; b != nil && !slices.Contains(b.Blocks, s) && !hasParent(sessions, s) {
+				b.Blocks = append(b.Blocks, s)
+			}
+		}
+	}
+	for _, s := range sessions {
+		if blocking[s.PID] && len(s.blockedBy) == 0 {
+			sample.Trees = append(sample.Trees, s)
+		}
+	}
+	// Waiters blocking each other with no root outside the cycle: the
+	// deadlock detector will break it, but show it until then, cut open
+	// at its first member.
+	for _, s := range sessions {
+		if len(s.blockedBy) > 0 && !inTrees(sample.Trees, s) {
+			for _, p := range sessions {
+				p.Blocks = slices.DeleteFunc(p.Blocks, func(b *lockSession) bool { return b == s })
+			}
+			sample.Trees = append(sample.Trees, s)
+		}
+	}
+	slices.SortFunc(sample.Trees, func(a, b *lockSession) int {
+		return cmp.Compare(b.maxWait(), a.maxWait())
+	})
+	return sample, nil
+}
+
+// hasParent reports whether s already hangs under a session.
+func hasParent(sessions []*lockSession, s *lockSession) bool {
+	for _, p := range sessions {
+		if slices.Contains(p.Blocks, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// inTrees reports whether s is somewhere in trees.
+func inTrees(trees []*lockSession, s *lockSession) bool {
+	var walk func(*lockSession) bool
+	walk = func(n *lockSession) bool {
+		return n == s || slices.ContainsFunc(n.Blocks, walk)
+	}
+	return slices.ContainsFunc(trees, walk)
+}
+
+// seconds converts an epoch interval from SQL.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// lockOptions are the flags of locks.
+type lockOptions struct {
+	minWait, cancelAfter time.Duration
+	terminate, dryRun    bool
+	protectUsers         []string
+}
+
+// cancelBlockers cancels or terminates the root blockers that kept a
+// session waiting longer than opts.cancelAfter.
+func cancelBlockers(ctx context.Context, pool *pgxpool.Pool, sample *lockSample, opts lockOptions) {
+	for _, root := range sample.Trees {
+		if len(root.blockedBy) > 0 || root.maxWait() < opts.cancelAfter {
+			continue
+		}
+		what := fmt.Sprintf("pid %d (%s, %s, blocking %d for %v): %s", root.PID, root.User, root.State,
+			root.size(), root.maxWait().Round(time.Second), oneLine(root.Query, 120))
+		idle := strings.HasPrefix(root.State, "idle in transaction")
+		var action, fn string
+		switch {
+		case root.BackendType != "client backend":
+			action = "not touched, " + root.BackendType
+		case slices.Contains(opts.protectUsers, root.User):
+			action = "not touched, protected user"
+		case opts.terminate:
+			action, fn = "terminated", "pg_terminate_backend"
+		case idle:
+			action = "not touched, cancel can't end an idle transaction (use -terminate)"
+		default:
+			action, fn = "cancelled", "pg_cancel_backend"
+		}
+		if fn != "" && opts.dryRun {
+			action = "would be " + action + " (-dry-run)"
+		} else if fn != "" {
+			var ok bool
+			if err := pool.QueryRow(ctx, "SELECT "+fn+"($1)", root.PID).Scan(&ok); err != nil || !ok {
+				action = fmt.Sprintf("%s failed: %v", fn, err)
+				if err == nil {
+					action = fn + " failed: backend gone or not permitted"
+				}
+			}
+		}
+		sample.Actions = append(sample.Actions, what+" → "+action)
+	}
+}
+
+// oneLine squeezes whitespace out of a query and shortens it to n bytes.
+func oneLine(query string, n int) string {
+	q := strings.Join(strings.Fields(query), " ")
+	if len(q) > n {
+		q = q[:n] + "…"
+	}
+	return q
+}
+
+// printLockSample writes the trees for a person.
+func printLockSample(sample *lockSample) {
+	if len(sample.Trees) == 0 {
+		fmt.Printf("%s ✅ No blocked sessions\n", sample.Time.Format("15:04:05"))
+		return
+	}
+	fmt.Printf("%s 🔒 %d blocking tree(s), %d session(s) waiting\n",
+		sample.Time.Format("15:04:05"), len(sample.Trees), sample.Waiting)
+	var walk func(s *lockSession, indent string)
+	walk = func(s *lockSession, indent string) {
+		fmt.Printf("%spid %d %s@%s %s", indent, s.PID, s.User, s.Application, s.State)
+		if s.WaitingFor != "" {
+			fmt.Printf(", waits %v for %s", s.Waited.Round(time.Second), s.WaitingFor)
+		}
+		if s.XactAge > 0 {
+			fmt.Printf(", xact %v", s.XactAge.Round(time.Second))
+		}
+		fmt.Printf("\n%s    %s\n", indent, oneLine(s.Query, 160))
+		for _, b := range s.Blocks {
+			walk(b, indent+"  └─ ")
+		}
+	}
+	for _, root := range sample.Trees {
+		fmt.Println()
+		walk(root, "   ")
+	}
+	for _, a := range sample.Actions {
+		fmt.Printf("   ⛔ %s\n", a)
+	}
+}
+
+// Locks runs the locks command line tool.
+func Locks() {
+	var dsn, format string
+	var interval time.Duration
+	var protect stringList
+	var opts lockOptions
+	registerDSNFlag(&dsn)
+	flag.DurationVar(&interval, "interval", 0, "Sample repeatedly at this interval (default: once)")
+	flag.DurationVar(&opts.minWait, "min-wait", 0, "Only show trees in which a session waited at least this long")
+	flag.StringVar(&format, "format", "text", "Output format: text or json (one object per sample)")
+	flag.DurationVar(&opts.cancelAfter, "cancel-after", 0, "Cancel root blockers once a session waited this long behind them (default: never)")
+	flag.BoolVar(&opts.terminate, "terminate", false, "With -cancel-after: terminate instead of cancel, ending idle transactions too")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "With -cancel-after: print what would be cancelled")
+	flag.Var(&protect, "protect-user", "Never cancel sessions of this user (repeatable)")
+	flag.Parse()
+	opts.protectUsers = protect
+
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	if opts.cancelAfter < 0 || opts.minWait < 0 || interval < 0 {
+		log.Fatal("-interval, -min-wait and -cancel-after can't be negative")
+	}
+	if (opts.terminate || opts.dryRun) && opts.cancelAfter == 0 {
+		log.Fatal("-terminate and -dry-run need -cancel-after")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "locks", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	if opts.cancelAfter > 0 {
+		mode := "cancel"
+		if opts.terminate {
+			mode = "terminate"
+		}
+		if opts.dryRun {
+			mode += " (dry run)"
+		}
+		fmt.Fprintf(os.Stderr, "⛔ Root blockers holding sessions for over %v: %s\n", opts.cancelAfter, mode)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		sample, err := sampleLocks(ctx, pool)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Fatal(err)
+		}
+		if opts.cancelAfter > 0 {
+			cancelBlockers(ctx, pool, sample, opts)
+		}
+		// -min-wait only trims the output: it runs after cancelBlockers, and
+		// trees past -cancel-after stay shown next to their action.
+		sample.Trees = slices.DeleteFunc(sample.Trees, func(t *lockSession) bool {
+			return t.maxWait() < opts.minWait && (opts.cancelAfter == 0 || t.maxWait() < opts.cancelAfter)
+		})
+		if format == "json" {
+			if err := enc.Encode(sample); err != nil {
+				log.Fatal(err)
+			}
+		} else if len(sample.Trees) > 0 || interval == 0 {
+			printLockSample(sample)
+		}
+		if interval == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,468 @@
+package dbre
+
+// ============================================================================
+// LOGICAL REPLICATION PROTOCOL (shared by cdc)
+// ============================================================================
+//
+// A walsender connection (replication=database) and the two output plugins
+// the cdc tool reads, decoded into one change event type:
+//   walsender  CREATE_REPLICATION_SLOT and START_REPLICATION, then the
+//              CopyBoth stream: XLogData ('w') and keepalives ('k') from
+//              the server, standby status updates ('r') back. Only the
+//              flushed position matters to the server: WAL up to it is
+//              released by the slot and decoding restarts there
+//   pgoutput   the built-in plugin (publication based, protocol version 1):
+//              Relation messages describe a table once, Insert/Update/Delete
+//              carry tuples in text format
+//   wal2json   format-version 2: one JSON object per change, with B and C
+//              objects around each transaction
+// See https://www.postgresql.org/docs/current/protocol-replication.html and
+// protocol-logicalrep-message-formats.html.
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// pgEpoch is the origin of the protocol's timestamps (microseconds).
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func pgTime(us int64) time.Time { return pgEpoch.Add(time.Duration(us) * time.Microsecond) }
+
+// formatLSN renders an LSN the way PostgreSQL does (16/B374D848).
+func formatLSN(lsn uint64) string { return fmt.Sprintf("%X/%X", lsn>>32, uint32(lsn)) }
+
+// replicationConn is a walsender connection.
+type replicationConn struct {
+	conn *pgconn.PgConn
+}
+
+// connectReplication opens a logical replication connection for tool.
+func connectReplication(ctx context.Context, dsn, tool string) (*replicationConn, error) {
+	cfg, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string: %w", err)
+	}
+	cfg.RuntimeParams["replication"] = "database"
+	cfg.RuntimeParams["application_name"] = "dbre-" + tool
+	conn, err := pgconn.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("replication connection to %s@%s:%d/%s: %w", cfg.User, cfg.Host, cfg.Port, cfg.Database, err)
+	}
+	return &replicationConn{conn: conn}, nil
+}
+
+func (rc *replicationConn) close() { rc.conn.Close(context.Background()) }
+
+// command runs a replication command and returns its first row as text.
+func (rc *replicationConn) command(ctx context.Context, sql string) ([]string, error) {
+	results, err := rc.conn.Exec(ctx, sql).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0].Rows) == 0 {
+		return nil, nil
+	}
+	row := make([]string, len(results[0].Rows[0]))
+	for i, v := range results[0].Rows[0] {
+		row[i] = string(v)
+	}
+	return row, nil
+}
+
+// createSlot creates a logical slot and returns its consistent point.
+func (rc *replicationConn) createSlot(ctx context.Context, slot, plugin string, temporary bool) (uint64, error) {
+	temp := ""
+	if temporary {
+		temp = " TEMPORARY"
+	}
+	row, err := rc.command(ctx, fmt.Sprintf("CREATE_REPLICATION_SLOT %s%s LOGICAL %s NOEXPORT_SNAPSHOT", slot, temp, plugin))
+	if err != nil {
+		return 0, err
+	}
+	if len(row) < 2 {
+		return 0, errors.New("CREATE_REPLICATION_SLOT returned no consistent point")
+	}
+	return parseLSN(row[1])
+}
+
+// startReplication starts streaming from slot at start (0: where the slot
+// left off) with the plugin's options, and waits for the CopyBoth response.
+func (rc *replicationConn) startReplication(ctx context.Context, slot string, start uint64, options []string) error {
+	sql := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s", slot, formatLSN(start))
+	if len(options) > 0 {
+		sql += " (" + strings.Join(options, ", ") + ")"
+	}
+	rc.conn.Frontend().SendQuery(&pgproto3.Query{String: sql})
+	if err := rc.conn.Frontend().Flush(); err != nil {
+		return err
+	}
+	for {
+		msg, err := rc.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+		switch m := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(m)
+		case *pgproto3.NoticeResponse, *pgproto3.ParameterStatus:
+		default:
+			return fmt.Errorf("unexpected %T starting replication", msg)
+		}
+	}
+}
+
+// walMessage is one message of the stream: data from the slot, or a
+// keepalive (Data nil).
+type walMessage struct {
+	Start, ServerEnd uint64
+	ServerTime       time.Time
+	Data             []byte // Plugin output; a copy, safe to keep
+	ReplyRequested   bool
+}
+
+// receive waits for the next stream message until ctx is done; a nil
+// message with a nil error means ctx expired first.
+func (rc *replicationConn) receive(ctx context.Context) (*walMessage, error) {
+	msg, err := rc.conn.ReceiveMessage(ctx)
+	if err != nil {
+		if pgconn.Timeout(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	switch m := msg.(type) {
+	case *pgproto3.CopyData:
+		d := m.Data
+		switch {
+		case len(d) >= 25 && d[0] == 'w':
+			return &walMessage{
+				Start:      binary.BigEndian.Uint64(d[1:]),
+				ServerEnd:  binary.BigEndian.Uint64(d[9:]),
+				ServerTime: pgTime(int64(binary.BigEndian.Uint64(d[17:]))),
+				Data:       append([]byte(nil), d[25:]...),
+			}, nil
+		case len(d) >= 18 && d[0] == 'k':
+			return &walMessage{
+				ServerEnd:      binary.BigEndian.Uint64(d[1:]),
+				ServerTime:     pgTime(int64(binary.BigEndian.Uint64(d[9:]))),
+				ReplyRequested: d[17] == 1,
+			}, nil
+		}
+		return nil, fmt.Errorf("unexpected replication message %q", d[:min(len(d), 1)])
+	case *pgproto3.ErrorResponse:
+		return nil, pgconn.ErrorResponseToPgError(m)
+	case *pgproto3.CopyDone:
+		return nil, errors.New("server ended replication")
+	}
+	return &walMessage{}, nil
+}
+
+// sendStatus reports flushed as written, flushed and applied.
+func (rc *replicationConn) sendStatus(flushed uint64) error {
+	buf := make([]byte, 34)
+	buf[0] = 'r'
+	binary.BigEndian.PutUint64(buf[1:], flushed)
+	binary.BigEndian.PutUint64(buf[9:], flushed)
+	binary.BigEndian.PutUint64(buf[17:], flushed)
+	binary.BigEndian.PutUint64(buf[25:], uint64(time.Since(pgEpoch).Microseconds()))
+	rc.conn.Frontend().Send(&pgproto3.CopyData{Data: buf})
+	return rc.conn.Frontend().Flush()
+}
+
+// changeColumn is one column of a changed row. Value is the text form;
+// nil for NULL or an unchanged TOAST value (Unchanged).
+type changeColumn struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"` // Type OID (pgoutput) or name (wal2json)
+	Key       bool    `json:"key,omitempty"`
+	Value     *string `json:"value"`
+	Unchanged bool    `json:"unchanged,omitempty"`
+}
+
+// changeEvent is one row change, or a truncate.
+type changeEvent struct {
+	Op      string         `json:"op"` // insert, update, delete or truncate
+	Schema  string         `json:"schema"`
+	Table   string         `json:"table"`
+	Columns []changeColumn `json:"columns,omitempty"` // New row (insert, update)
+	Old     []changeColumn `json:"old,omitempty"`     // Old key or row (update, delete), as the replica identity allows
+}
+
+// changeTransaction is a committed transaction.
+type changeTransaction struct {
+	XID        uint32        `json:"xid"`
+	CommitLSN  uint64        `json:"commit_lsn"`
+	EndLSN     uint64        `json:"end_lsn"` // Confirm this once the transaction is handled
+	CommitTime time.Time     `json:"commit_time"`
+	Changes    []changeEvent `json:"changes"`
+	Bytes      int           `json:"bytes"` // Plugin output decoded
+}
+
+// changeDecoder turns plugin output into transactions; done is true when
+// data completed one, and pending while one is open.
+type changeDecoder interface {
+	options(tables []string, publication string) []string
+	decode(data []byte, start uint64) (tx *changeTransaction, done bool, err error)
+	pending() bool
+}
+
+func newChangeDecoder(plugin string) (changeDecoder, error) {
+	switch plugin {
+	case "pgoutput":
+		return &pgoutputDecoder{relations: map[uint32]*pgoutputRelation{}}, nil
+	case "wal2json":
+		return &wal2jsonDecoder{}, nil
+	}
+	return nil, fmt.Errorf("unsupported plugin %q (use pgoutput or wal2json)", plugin)
+}
+
+// pgoutputRelation is a table as described by a Relation message.
+type pgoutputRelation struct {
+	schema, table string
+	columns       []changeColumn
+}
+
+type pgoutputDecoder struct {
+	relations map[uint32]*pgoutputRelation
+	tx        *changeTransaction
+}
+
+func (d *pgoutputDecoder) pending() bool { return d.tx != nil }
+
+func (d *pgoutputDecoder) options(_ []string, publication string) []string {
+	return []string{"proto_version '1'", fmt.Sprintf("publication_names '%s'", strings.ReplaceAll(publication, "'", "''"))}
+}
+
+// pgoutputReader reads the message fields in order; the first error sticks.
+type pgoutputReader struct {
+	buf []byte
+	err error
+}
+
+func (r *pgoutputReader) take(n int) []byte {
+	if r.err != nil || len(r.buf) < n {
+		r.err = errors.New("truncated pgoutput message")
+		return make([]byte, n)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *pgoutputReader) byte() byte     { return r.take(1)[0] }
+func (r *pgoutputReader) int16() int     { return int(binary.BigEndian.Uint16(r.take(2))) }
+func (r *pgoutputReader) uint32() uint32 { return binary.BigEndian.Uint32(r.take(4)) }
+func (r *pgoutputReader) uint64() uint64 { return binary.BigEndian.Uint64(r.take(8)) }
+
+func (r *pgoutputReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	i := strings.IndexByte(string(r.buf), 0)
+	if i < 0 {
+		r.err = errors.New("truncated pgoutput message")
+		return ""
+	}
+	s := string(r.buf[:i])
+	r.buf = r.buf[i+1:]
+	return s
+}
+
+// tuple reads TupleData against the relation's columns.
+func (r *pgoutputReader) tuple(rel *pgoutputRelation) []changeColumn {
+	n := r.int16()
+	cols := make([]changeColumn, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		c := changeColumn{Name: fmt.Sprintf("col%d", i+1)}
+		if i < len(rel.columns) {
+			c = rel.columns[i]
+		}
+		switch r.byte() {
+		case 'n':
+		case 'u':
+			c.Unchanged = true
+		case 't', 'b':
+			v := string(r.take(int(r.uint32())))
+			c.Value = &v
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+func (d *pgoutputDecoder) relation(r *pgoutputReader) *pgoutputRelation {
+	rel := d.relations[r.uint32()]
+	if rel == nil {
+		rel = &pgoutputRelation{schema: "?", table: "?"}
+	}
+	return rel
+}
+
+func (d *pgoutputDecoder) decode(data []byte, _ uint64) (*changeTransaction, bool, error) {
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+	r := &pgoutputReader{buf: data[1:]}
+	switch data[0] {
+	case 'B':
+		d.tx = &changeTransaction{}
+		r.uint64() // Final LSN
+		d.tx.CommitTime = pgTime(int64(r.uint64()))
+		d.tx.XID = r.uint32()
+	case 'C':
+		r.byte() // Flags
+		tx := d.tx
+		if tx == nil {
+			tx = &changeTransaction{}
+		}
+		tx.CommitLSN = r.uint64()
+		tx.EndLSN = r.uint64()
+		tx.CommitTime = pgTime(int64(r.uint64()))
+		tx.Bytes += len(data)
+		d.tx = nil
+		return tx, r.err == nil, r.err
+	case 'R':
+		id := r.uint32()
+		rel := &pgoutputRelation{schema: r.string(), table: r.string()}
+		r.byte() // Replica identity
+		for n := r.int16(); n > 0 && r.err == nil; n-- {
+			flags := r.byte()
+			c := changeColumn{Name: r.string(), Key: flags&1 == 1}
+			c.Type = fmt.Sprint(r.uint32())
+			r.uint32() // Type modifier
+			rel.columns = append(rel.columns, c)
+		}
+		d.relations[id] = rel
+	case 'I', 'U', 'D':
+		rel := d.relation(r)
+		ev := changeEvent{Op: map[byte]string{'I': "insert", 'U': "update", 'D': "delete"}[data[0]], Schema: rel.schema, Table: rel.table}
+		for r.err == nil && len(r.buf) > 0 {
+			switch r.byte() {
+			case 'K', 'O':
+				ev.Old = r.tuple(rel)
+			case 'N':
+				ev.Columns = r.tuple(rel)
+			default:
+				r.err = fmt.Errorf("unexpected tuple type in %c message", data[0])
+			}
+		}
+		d.addChange(ev, len(data))
+	case 'T':
+		n := int(r.uint32())
+		r.byte() // Options
+		for i := 0; i < n && r.err == nil; i++ {
+			rel := d.relation(r)
+			d.addChange(changeEvent{Op: "truncate", Schema: rel.schema, Table: rel.table}, len(data)/n)
+		}
+	}
+	return nil, false, r.err
+}
+
+func (d *pgoutputDecoder) addChange(ev changeEvent, bytes int) {
+	if d.tx == nil {
+		d.tx = &changeTransaction{}
+	}
+	d.tx.Changes = append(d.tx.Changes, ev)
+	d.tx.Bytes += bytes
+}
+
+type wal2jsonDecoder struct {
+	tx *changeTransaction
+}
+
+func (d *wal2jsonDecoder) pending() bool { return d.tx != nil }
+
+func (d *wal2jsonDecoder) options(tables []string, _ string) []string {
+	opts := []string{"\"format-version\" '2'", "\"include-timestamp\" '1'", "\"include-lsn\" '1'", "\"include-xids\" '1'", "\"include-pk\" '1'"}
+	if len(tables) > 0 {
+		opts = append(opts, fmt.Sprintf("\"add-tables\" '%s'", strings.ReplaceAll(strings.Join(tables, ","), "'", "''")))
+	}
+	return opts
+}
+
+// wal2jsonChange is one format-version 2 object.
+type wal2jsonChange struct {
+	Action    string `json:"action"`
+	XID       uint32 `json:"xid"`
+	LSN       string `json:"lsn"`
+	NextLSN   string `json:"nextlsn"`
+	Timestamp string `json:"timestamp"`
+	Schema    string `json:"schema"`
+	Table     string `json:"table"`
+	Columns   []struct {
+		Name  string          `json:"name"`
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	} `json:"columns"`
+	Identity []struct {
+		Name  string          `json:"name"`
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	} `json:"identity"`
+	PK []struct {
+		Name string `json:"name"`
+	} `json:"pk"`
+}
+
+// wal2jsonValue is the text form of a JSON value: strings unquoted, null nil.
+func wal2jsonValue(raw json.RawMessage) *string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var s string
+	if raw[0] != '"' || json.Unmarshal(raw, &s) != nil {
+		s = string(raw)
+	}
+	return &s
+}
+
+func (d *wal2jsonDecoder) decode(data []byte, start uint64) (*changeTransaction, bool, error) {
+	var c wal2jsonChange
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, false, fmt.Errorf("wal2json: %w", err)
+	}
+	if d.tx == nil || c.Action == "B" {
+		d.tx = &changeTransaction{XID: c.XID}
+	}
+	d.tx.Bytes += len(data)
+	switch c.Action {
+	case "C":
+		tx := d.tx
+		d.tx = nil
+		tx.CommitLSN, _ = parseLSN(c.LSN)
+		tx.EndLSN, _ = parseLSN(c.NextLSN)
+		if tx.EndLSN == 0 {
+			tx.EndLSN = max(tx.CommitLSN, start)
+		}
+		// 2026-10-17 09:30:00.123456+00
+		if t, err := time.Parse("2006-01-02 15:04:05.999999-07", c.Timestamp); err == nil {
+			tx.CommitTime = t
+		}
+		return tx, true, nil
+	case "I", "U", "D", "T":
+		ev := changeEvent{Op: map[string]string{"I": "insert", "U": "update", "D": "delete", "T": "truncate"}[c.Action], Schema: c.Schema, Table: c.Table}
+		pk := map[string]bool{}
+		for _, col := range c.PK {
+			pk[col.Name] = true
+		}
+		for _, col := range c.Columns {
+			ev.Columns = append(ev.Columns, changeColumn{Name: col.Name, Type: col.Type, Key: pk[col.Name], Value: wal2jsonValue(col.Value)})
+		}
+		for _, col := range c.Identity {
+			ev.Old = append(ev.Old, changeColumn{Name: col.Name, Type: col.Type, Key: true, Value: wal2jsonValue(col.Value)})
+		}
+		d.tx.Changes = append(d.tx.Changes, ev)
+	}
+	return nil, false, nil
+}
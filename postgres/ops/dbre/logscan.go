@@ -0,0 +1,640 @@
+package dbre
+
+// ============================================================================
+// CSVLOG INGESTER (cmd/logscan)
+// ============================================================================
+//
+// pgBadger-lite: logscan reads csvlog files (log_destination = 'csvlog';
+// every column layout from PostgreSQL 12 to 17) and extracts:
+//   errors        ERROR, FATAL and PANIC by SQLSTATE, with the condition
+//                 name and an example message
+//   slow queries  log_min_duration_statement and auto_explain entries over
+//                 -slow, by query fingerprint (package sqlfingerprint)
+//   lock waits    log_lock_waits ("still waiting for ShareLock ...") by
+//                 lock mode, the longest wait, and deadlocks (40P01)
+//   connections   log_connections / log_disconnections: connections per
+//                 minute by user, database and application, session
+//                 lengths, and the share of sessions shorter than a second
+//                 (churn a pooler would absorb)
+// Batch mode (files as arguments, .gz too) prints a summary. -follow tails
+// the newest file matching a glob, moves on when the server rotates to a
+// new file, and serves the counts as Prometheus metrics on -metrics-addr:
+//   dbre_logscan_lines_total{server}
+//   dbre_logscan_errors_total{server,severity,sqlstate}
+//   dbre_logscan_slow_queries_total{server,database}
+//   dbre_logscan_query_duration_seconds{server}          histogram
+//   dbre_logscan_lock_waits_total{server,mode}
+//   dbre_logscan_connections_total{server,user,database}
+//   dbre_logscan_session_seconds{server}                 histogram
+// Ctrl-C prints the summary of what it followed.
+//
+//   go run ./cmd/logscan /var/log/postgresql/postgresql-2026-10-1*.csv
+//   go run ./cmd/logscan -slow=500ms -top=20 postgresql.csv.gz
+//   go run ./cmd/logscan -follow='/var/log/postgresql/*.csv' -metrics-addr=:9192
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/sqlfingerprint"
+)
+
+// logRecord is one csvlog line.
+type logRecord struct {
+	Time     time.Time
+	User     string
+	Database string
+	Client   string
+	Severity string
+	SQLState string
+	Message  string
+	Detail   string
+	Query    string
+	App      string
+}
+
+// parseCSVLogRecord reads the csvlog columns; the layout only ever grew
+// columns at the end (backend_type in 13, leader_pid and query_id in 14).
+func parseCSVLogRecord(fields []string) (logRecord, bool) {
+	if len(fields) < 23 {
+		return logRecord{}, false
+	}
+	return logRecord{
+		Time:     parseLogTime(fields[0]),
+		User:     fields[1],
+		Database: fields[2],
+		Client:   fields[4],
+		Severity: fields[11],
+		SQLState: fields[12],
+		Message:  fields[13],
+		Detail:   fields[14],
+		Query:    fields[19],
+		App:      fields[22],
+	}, true
+}
+
+// sqlStateNames are the conditions (errcodes.txt) logscan names.
+var sqlStateNames = map[string]string{
+	"08006": "connection_failure", "08P01": "protocol_violation", "0A000": "feature_not_supported",
+	"21000": "cardinality_violation", "22001": "string_data_right_truncation", "22003": "numeric_value_out_of_range",
+	"22P02": "invalid_text_representation", "23502": "not_null_violation", "23503": "foreign_key_violation",
+	"23505": "unique_violation", "23514": "check_violation", "25P02": "in_failed_sql_transaction",
+	"25P03": "idle_in_transaction_session_timeout", "28000": "invalid_authorization_specification",
+	"28P01": "invalid_password", "3D000": "invalid_catalog_name", "40001": "serialization_failure",
+	"40P01": "deadlock_detected", "42501": "insufficient_privilege", "42601": "syntax_error",
+	"42703": "undefined_column", "42P01": "undefined_table", "42883": "undefined_function",
+	"53100": "disk_full", "53200": "out_of_memory", "53300": "too_many_connections",
+	"54000": "program_limit_exceeded", "55P03": "lock_not_available", "57014": "query_canceled",
+	"57P01": "admin_shutdown", "57P05": "idle_session_timeout", "58P01": "undefined_file", "XX000": "internal_error",
+}
+
+var (
+	slowQueryRe  = regexp.MustCompile(`(?s)^duration: ([0-9.]+) ms(?:  (?:statement|(?:execute|bind|parse) [^:]*): (.*))?$`)
+	lockWaitRe   = regexp.MustCompile(`^process \d+ (still waiting for|acquired|avoided deadlock for|detected deadlock while waiting for) (\w+) on .+ after ([0-9.]+) ms`)
+	authorizedRe = regexp.MustCompile(`^connection authorized: user=(\S+)(?: database=(\S+))?(?: application_name=(\S+))?`)
+	disconnectRe = regexp.MustCompile(`^disconnection: session time: (\d+):(\d+):([0-9.]+) user=(\S+) database=(\S+)`)
+)
+
+// sqlStateCount is one SQLSTATE's errors.
+type sqlStateCount struct {
+	SQLState string `json:"sqlstate"`
+	Name     string `json:"name,omitempty"`
+	Severity string `json:"severity"`
+	Count    int    `json:"count"`
+	Example  string `json:"example"`
+}
+
+// slowQuery is one fingerprint's slow executions.
+type slowQuery struct {
+	Fingerprint string  `json:"fingerprint"`
+	Query       string  `json:"query"`
+	Database    string  `json:"database"`
+	Count       int     `json:"count"`
+	TotalMS     float64 `json:"total_ms"`
+	MaxMS       float64 `json:"max_ms"`
+}
+
+// logScanReport is the summary.
+type logScanReport struct {
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Lines       int              `json:"lines"`
+	Severities  map[string]int   `json:"severities"`
+	Errors      []*sqlStateCount `json:"errors"`
+	Slow        int              `json:"slow_queries"`
+	SlowP50MS   float64          `json:"slow_p50_ms"`
+	SlowP95MS   float64          `json:"slow_p95_ms"`
+	SlowMaxMS   float64          `json:"slow_max_ms"`
+	SlowQueries []*slowQuery     `json:"slowest_fingerprints"`
+	LockWaits   map[string]int   `json:"lock_waits"` // Mode → waits
+	MaxWaitMS   float64          `json:"max_lock_wait_ms"`
+	Deadlocks   int              `json:"deadlocks"`
+	Connections int              `json:"connections"`
+	PeakMinute  int              `json:"peak_connections_per_minute"`
+	ConnsBy     []sourceCount    `json:"connections_by"`
+	Sessions    int              `json:"sessions"`
+	MedianSess  float64          `json:"median_session_seconds"`
+	ShortShare  float64          `json:"short_session_share"`
+}
+
+// sourceCount is the connections of one user/database/application.
+type sourceCount struct {
+	Source string `json:"source"`
+	Count  int    `json:"count"`
+}
+
+// logScan aggregates records.
+type logScan struct {
+	slowMS   float64
+	top      int
+	metrics  *logScanMetrics // nil in batch mode
+	server   string
+	report   logScanReport
+	errors   map[string]*sqlStateCount
+	slow     map[string]*slowQuery
+	slowMSs  []float64
+	perMin   map[int64]int
+	conns    map[string]int
+	sessions []float64
+}
+
+func newLogScan(slow time.Duration, top int) *logScan {
+	return &logScan{
+		slowMS: float64(slow) / float64(time.Millisecond),
+		top:    top,
+		report: logScanReport{Severities: map[string]int{}, LockWaits: map[string]int{}},
+		errors: map[string]*sqlStateCount{},
+		slow:   map[string]*slowQuery{},
+		perMin: map[int64]int{},
+		conns:  map[string]int{},
+	}
+}
+
+// add counts one record.
+func (s *logScan) add(r *logRecord) {
+	rep := &s.report
+	rep.Lines++
+	if !r.Time.IsZero() {
+		if rep.From.IsZero() || r.Time.Before(rep.From) {
+			rep.From = r.Time
+		}
+		if r.Time.After(rep.To) {
+			rep.To = r.Time
+		}
+	}
+	rep.Severities[r.Severity]++
+	if s.metrics != nil {
+		s.metrics.lines.WithLabelValues(s.server).Inc()
+	}
+
+	switch r.Severity {
+	case "ERROR", "FATAL", "PANIC":
+		key := r.Severity + "/" + r.SQLState
+		e := s.errors[key]
+		if e == nil {
+			e = &sqlStateCount{SQLState: r.SQLState, Name: sqlStateNames[r.SQLState], Severity: r.Severity, Example: oneLine(r.Message, 120)}
+			s.errors[key] = e
+		}
+		e.Count++
+		if r.SQLState == "40P01" {
+			rep.Deadlocks++
+		}
+		if s.metrics != nil {
+			s.metrics.errors.WithLabelValues(s.server, r.Severity, r.SQLState).Inc()
+		}
+		return
+	case "LOG":
+	default:
+		return
+	}
+
+	if m := slowQueryRe.FindStringSubmatch(r.Message); m != nil {
+		ms, _ := strconv.ParseFloat(m[1], 64)
+		s.addSlow(r, ms, m[2])
+		return
+	}
+	var explained explainEntry
+	if ok, _ := parseAutoExplain(r.Message, &explained); ok {
+		// An unreadable plan still has its duration.
+		s.addSlow(r, explained.DurationMS, explained.Query)
+		return
+	}
+	if m := lockWaitRe.FindStringSubmatch(r.Message); m != nil {
+		ms, _ := strconv.ParseFloat(m[3], 64)
+		rep.MaxWaitMS = max(rep.MaxWaitMS, ms)
+		if m[1] == "still waiting for" {
+			rep.LockWaits[m[2]]++
+			if s.metrics != nil {
+				s.metrics.lockWaits.WithLabelValues(s.server, m[2]).Inc()
+			}
+		}
+		return
+	}
+	if m := authorizedRe.FindStringSubmatch(r.Message); m != nil {
+		rep.Connections++
+		app := m[3]
+		if app == "" {
+			app = r.App
+		}
+		s.conns[m[1]+"/"+m[2]+"/"+app]++
+		if !r.Time.IsZero() {
+			s.perMin[r.Time.Unix()/60]++
+		}
+		if s.metrics != nil {
+			s.metrics.connections.WithLabelValues(s.server, m[1], m[2]).Inc()
+		}
+		return
+	}
+	if m := disconnectRe.FindStringSubmatch(r.Message); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		mins, _ := strconv.Atoi(m[2])
+		secs, _ := strconv.ParseFloat(m[3], 64)
+		length := float64(h*3600+mins*60) + secs
+		s.sessions = append(s.sessions, length)
+		if s.metrics != nil {
+			s.metrics.sessions.WithLabelValues(s.server).Observe(length)
+		}
+	}
+}
+
+// addSlow counts a logged duration; query may be empty (log_duration).
+func (s *logScan) addSlow(r *logRecord, ms float64, query string) {
+	if ms < s.slowMS {
+		return
+	}
+	if query == "" {
+		query = r.Query
+	}
+	s.slowMSs = append(s.slowMSs, ms)
+	fp := sqlfingerprint.Fingerprint(query)
+	key := r.Database + "/" + fp
+	q := s.slow[key]
+	if q == nil {
+		q = &slowQuery{Fingerprint: fp, Query: query, Database: r.Database}
+		s.slow[key] = q
+	}
+	q.Count++
+	q.TotalMS += ms
+	q.MaxMS = max(q.MaxMS, ms)
+	if s.metrics != nil {
+		s.metrics.slow.WithLabelValues(s.server, r.Database).Inc()
+		s.metrics.durations.WithLabelValues(s.server).Observe(ms / 1000)
+	}
+}
+
+// percentile of sorted values, p in [0,1].
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(len(sorted)-1, int(p*float64(len(sorted))))]
+}
+
+// finish completes the report.
+func (s *logScan) finish() *logScanReport {
+	rep := s.report
+	rep.Errors = nil
+	for _, e := range s.errors {
+		rep.Errors = append(rep.Errors, e)
+	}
+	slices.SortFunc(rep.Errors, func(a, b *sqlStateCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.SQLState, b.SQLState))
+	})
+
+	durations := slices.Sorted(slices.Values(s.slowMSs))
+	rep.Slow = len(durations)
+	rep.SlowP50MS, rep.SlowP95MS = percentile(durations, 0.5), percentile(durations, 0.95)
+	if len(durations) > 0 {
+		rep.SlowMaxMS = durations[len(durations)-1]
+	}
+	rep.SlowQueries = nil
+	for _, q := range s.slow {
+		rep.SlowQueries = append(rep.SlowQueries, q)
+	}
+	slices.SortFunc(rep.SlowQueries, func(a, b *slowQuery) int {
+		return cmp.Or(cmp.Compare(b.TotalMS, a.TotalMS), cmp.Compare(a.Fingerprint, b.Fingerprint))
+	})
+	rep.SlowQueries = rep.SlowQueries[:min(len(rep.SlowQueries), s.top)]
+
+	for _, n := range s.perMin {
+		rep.PeakMinute = max(rep.PeakMinute, n)
+	}
+	rep.ConnsBy = nil
+	for key, n := range s.conns {
+		rep.ConnsBy = append(rep.ConnsBy, sourceCount{Source: key, Count: n})
+	}
+	slices.SortFunc(rep.ConnsBy, func(a, b sourceCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Source, b.Source))
+	})
+	rep.ConnsBy = rep.ConnsBy[:min(len(rep.ConnsBy), s.top)]
+
+	sessions := slices.Sorted(slices.Values(s.sessions))
+	rep.Sessions = len(sessions)
+	rep.MedianSess = percentile(sessions, 0.5)
+	if len(sessions) > 0 {
+		short, _ := slices.BinarySearch(sessions, 1)
+		rep.ShortShare = float64(short) / float64(len(sessions))
+	}
+	return &rep
+}
+
+// printLogScanReport writes the summary for a person.
+func printLogScanReport(r *logScanReport) {
+	fmt.Printf("📜 %d log lines", r.Lines)
+	if !r.From.IsZero() {
+		fmt.Printf(" from %s to %s", r.From.Format("2006-01-02 15:04:05"), r.To.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println()
+	var severities []string
+	for sev, n := range r.Severities {
+		severities = append(severities, fmt.Sprintf("%s %d", sev, n))
+	}
+	slices.Sort(severities)
+	fmt.Printf("   %s\n", strings.Join(severities, ", "))
+	hours := r.To.Sub(r.From).Hours()
+
+	if len(r.Errors) > 0 {
+		fmt.Printf("\nERRORS BY SQLSTATE\n")
+		fmt.Printf("   %-6s %-7s %-36s %8s %9s  %s\n", "STATE", "LEVEL", "CONDITION", "COUNT", "PER HOUR", "EXAMPLE")
+		for _, e := range r.Errors {
+			rate := "-"
+			if hours > 0 {
+				rate = fmt.Sprintf("%.1f", float64(e.Count)/hours)
+			}
+			fmt.Printf("   %-6s %-7s %-36s %8d %9s  %s\n", e.SQLState, e.Severity, e.Name, e.Count, rate, e.Example)
+		}
+	}
+
+	fmt.Printf("\nSLOW QUERIES: %d", r.Slow)
+	if r.Slow > 0 {
+		fmt.Printf(" (p50 %.0f ms, p95 %.0f ms, max %.0f ms)\n", r.SlowP50MS, r.SlowP95MS, r.SlowMaxMS)
+		fmt.Printf("   %-16s %-12s %8s %12s %10s  %s\n", "FINGERPRINT", "DATABASE", "COUNT", "TOTAL s", "MAX ms", "QUERY")
+		for _, q := range r.SlowQueries {
+			fmt.Printf("   %-16s %-12s %8d %12.1f %10.0f  %s\n", q.Fingerprint, q.Database, q.Count, q.TotalMS/1000, q.MaxMS, oneLine(q.Query, 80))
+		}
+	} else {
+		fmt.Println()
+	}
+
+	var waits []string
+	total := 0
+	for mode, n := range r.LockWaits {
+		waits = append(waits, fmt.Sprintf("%s %d", mode, n))
+		total += n
+	}
+	slices.Sort(waits)
+	fmt.Printf("\nLOCK WAITS: %d", total)
+	if total > 0 {
+		fmt.Printf(" (%s), longest %.0f ms", strings.Join(waits, ", "), r.MaxWaitMS)
+	}
+	fmt.Printf("; %d deadlock(s)\n", r.Deadlocks)
+
+	fmt.Printf("\nCONNECTIONS: %d", r.Connections)
+	if r.Connections > 0 && hours > 0 {
+		fmt.Printf(" (%.1f/min on average, peak %d in one minute)", float64(r.Connections)/hours/60, r.PeakMinute)
+	}
+	fmt.Println()
+	for _, c := range r.ConnsBy {
+		fmt.Printf("   %8d  %s\n", c.Count, c.Source)
+	}
+	if r.Sessions > 0 {
+		fmt.Printf("   %d sessions ended, median %.1fs, %.0f%% shorter than a second", r.Sessions, r.MedianSess, 100*r.ShortShare)
+		if r.ShortShare > 0.5 {
+			fmt.Print(" ⚠️  connection churn: put a pooler in front")
+		}
+		fmt.Println()
+	}
+	if r.Connections == 0 && r.Sessions == 0 {
+		fmt.Println("   (log_connections and log_disconnections are off, or nothing connected)")
+	}
+}
+
+// logScanMetrics are the counters of -follow.
+type logScanMetrics struct {
+	lines, errors, slow, lockWaits, connections *prometheus.CounterVec
+	durations, sessions                         *prometheus.HistogramVec
+}
+
+func newLogScanMetrics() *logScanMetrics {
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dbre_logscan_" + name, Help: help}, append([]string{"server"}, labels...))
+	}
+	return &logScanMetrics{
+		lines:       counter("lines_total", "csvlog lines read"),
+		errors:      counter("errors_total", "ERROR, FATAL and PANIC lines", "severity", "sqlstate"),
+		slow:        counter("slow_queries_total", "Logged statements over -slow", "database"),
+		lockWaits:   counter("lock_waits_total", "log_lock_waits waits", "mode"),
+		connections: counter("connections_total", "Authorized connections", "user", "database"),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "dbre_logscan_query_duration_seconds", Help: "Durations of the logged slow statements",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"server"}),
+		sessions: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "dbre_logscan_session_seconds", Help: "Session lengths from log_disconnections",
+			Buckets: []float64{0.1, 0.5, 1, 5, 30, 60, 300, 1800, 3600, 4 * 3600, 24 * 3600},
+		}, []string{"server"}),
+	}
+}
+
+func (m *logScanMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.lines, m.errors, m.slow, m.lockWaits, m.connections, m.durations, m.sessions}
+}
+
+// readCSVLog feeds every record of r to s.
+func readCSVLog(r io.Reader, name string, s *logScan) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if rec, ok := parseCSVLogRecord(fields); ok {
+			s.add(&rec)
+		}
+	}
+}
+
+// newestLog returns the newest file matching pattern.
+func newestLog(pattern string) (string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	var newestTime time.Time
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = p, info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// followReader reads a growing log file: at its end it waits for more,
+// and ends once a newer file matches the pattern (the server rotated) or
+// ctx is done.
+type followReader struct {
+	ctx     context.Context
+	f       *os.File
+	name    string
+	pattern string
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		if newest, _ := newestLog(r.pattern); newest != "" && newest != r.name {
+			// Read what was written before the switch, then end.
+			if n, err = r.f.Read(p); n > 0 {
+				return n, nil
+			}
+			return 0, io.EOF
+		}
+		pos, err := r.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		if info, err := r.f.Stat(); err == nil && info.Size() < pos {
+			// Truncated (copytruncate rotation): start over.
+			if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		select {
+		case <-r.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// followLogs tails the newest file matching pattern until ctx is done.
+func followLogs(ctx context.Context, pattern string, fromStart bool, s *logScan) error {
+	first := true
+	for ctx.Err() == nil {
+		name, err := newestLog(pattern)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		if first && !fromStart {
+			// Start at the end. The server writes whole records, so the
+			// end is a record boundary.
+			if _, err := f.Seek(0, io.SeekEnd); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		first = false
+		fmt.Fprintf(os.Stderr, "📜 Following %s\n", name)
+		err = readCSVLog(&followReader{ctx: ctx, f: f, name: name, pattern: pattern}, name, s)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+		}
+	}
+	return nil
+}
+
+// LogScan runs the logscan command line tool.
+func LogScan() {
+	var follow, metricsAddr, server, format string
+	var slow time.Duration
+	var top int
+	var fromStart bool
+	host, _ := os.Hostname()
+	flag.StringVar(&follow, "follow", "", "Tail the newest csvlog file matching this glob and serve metrics")
+	flag.BoolVar(&fromStart, "from-start", false, "With -follow: read the current file from its start")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":9192", "With -follow: serve Prometheus metrics here (empty: off)")
+	flag.StringVar(&server, "server", host, "Server label of the metrics")
+	flag.DurationVar(&slow, "slow", time.Second, "Count logged statements from this duration as slow")
+	flag.IntVar(&top, "top", 10, "Show this many slow fingerprints and connection sources")
+	flag.StringVar(&format, "format", "text", "Output format of the summary: text or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: logscan [flags] CSVLOG... | logscan -follow=GLOB [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if (follow == "") == (flag.NArg() == 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	s := newLogScan(slow, top)
+	if follow != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		s.metrics, s.server = newLogScanMetrics(), server
+		if metricsAddr != "" {
+			serveMetrics(metricsAddr, s.metrics.collectors()...)
+		}
+		if err := followLogs(ctx, follow, fromStart, s); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, name := range flag.Args() {
+			f, err := openLog(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = readCSVLog(f, name, s)
+			f.Close()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	report := s.finish()
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printLogScanReport(report)
+}
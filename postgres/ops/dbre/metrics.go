@@ -0,0 +1,44 @@
+package dbre
+
+// ============================================================================
+// PROMETHEUS METRICS (-metrics-addr)
+// ============================================================================
+//
+// The daemons serve /metrics on -metrics-addr. Every metric is named
+// dbre_<tool>_..., e.g. dbre_replag_replay_lag_bytes, and carries the
+// monitored server in a label, so one Prometheus can scrape several
+// daemons and one daemon can watch several servers.
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveMetrics serves the collectors on addr in the background.
+func serveMetrics(addr string, collectors ...prometheus.Collector) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors...)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Metrics server stopped: %v", err)
+		}
+	}()
+	fmt.Printf("📡 Prometheus metrics on http://%s/metrics\n", addr)
+}
+
+// boolGauge is 1 for true.
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
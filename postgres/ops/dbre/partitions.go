@@ -0,0 +1,544 @@
+package dbre
+
+// ============================================================================
+// PARTITION LIFECYCLE (cmd/partitions)
+// ============================================================================
+//
+// pg_partman-style maintenance of time-range partitioned tables, without
+// the extension, driven by a YAML policy per table (see
+// partitions.example.yaml). Each run, table by table:
+//   premake    create the partitions of the current and the next premake
+//              intervals (daily, weekly from Monday, monthly, yearly; UTC)
+//              that don't exist yet, named <table>_p<start>. Inserts past
+//              the last partition fail, or land in the DEFAULT partition,
+//              from which they have to be moved by hand
+//   retention  partitions entirely older than retention (a PostgreSQL
+//              interval, '13 months') are detached and, with
+//              retention_action: drop, dropped. DETACH ... CONCURRENTLY on
+//              PG14+ when the table has no DEFAULT partition
+//   move       partitions entirely older than move_after are moved, with
+//              their indexes, to move_tablespace. This rewrites them under
+//              an ACCESS EXCLUSIVE lock on the partition: queries that
+//              can't prune it wait for the copy
+// Partitions made by hand with other intervals age out by the same cutoffs;
+// one that overlaps a partition to create is reported and the partition is
+// not created. DEFAULT and MINVALUE/MAXVALUE partitions are never touched.
+//
+// Nothing changes without -apply: the default is a dry run listing the
+// planned actions. DDL runs with lock_timeout (policy lock_timeout, 5s) so
+// a long query on the table fails the action rather than queueing every
+// other session behind the lock; the next run retries. Exit code 2 when an
+// action failed, or, in a dry run, when a table is missing partitions for
+// the current interval.
+//
+//   go run ./cmd/partitions -config=partitions.example.yaml
+//   go run ./cmd/partitions -config=partitions.yaml -apply
+//   15 3 * * * partitions -dsn=... -config=/etc/dbre/partitions.yaml -apply || page-oncall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gopkg.in/yaml.v3"
+)
+
+// partitionPolicy is the lifecycle of one partitioned table.
+type partitionPolicy struct {
+	Table           string `yaml:"table"`                      // [schema.]table, range-partitioned on a date or timestamp column
+	Interval        string `yaml:"interval"`                   // daily, weekly, monthly or yearly
+	Premake         int    `yaml:"premake"`                    // Future partitions to keep ahead of now
+	Tablespace      string `yaml:"tablespace,omitempty"`       // For new partitions; empty: the parent's default
+	Retention       string `yaml:"retention,omitempty"`        // PostgreSQL interval; empty: keep everything
+	RetentionAction string `yaml:"retention_action,omitempty"` // drop (default) or detach
+	MoveAfter       string `yaml:"move_after,omitempty"`       // PostgreSQL interval
+	MoveTablespace  string `yaml:"move_tablespace,omitempty"`
+}
+
+// partitionsConfig is the -config file.
+type partitionsConfig struct {
+	LockTimeout time.Duration     `yaml:"lock_timeout"`
+	Tables      []partitionPolicy `yaml:"tables"`
+}
+
+// loadPartitionsConfig reads path and fills in the defaults.
+func loadPartitionsConfig(path string) (*partitionsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &partitionsConfig{LockTimeout: 5 * time.Second}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(cfg.Tables) == 0 {
+		return nil, fmt.Errorf("%s: no tables", path)
+	}
+	for i := range cfg.Tables {
+		p := &cfg.Tables[i]
+		switch {
+		case p.Table == "":
+			return nil, fmt.Errorf("%s: table %d has no name", path, i+1)
+		case intervalStart(time.Now(), p.Interval).IsZero():
+			return nil, fmt.Errorf("%s: %s: invalid interval %q (use daily, weekly, monthly or yearly)", path, p.Table, p.Interval)
+		case p.Premake < 0:
+			return nil, fmt.Errorf("%s: %s: premake must not be negative", path, p.Table)
+		case p.RetentionAction != "" && p.RetentionAction != "drop" && p.RetentionAction != "detach":
+			return nil, fmt.Errorf("%s: %s: invalid retention_action %q (use drop or detach)", path, p.Table, p.RetentionAction)
+		case (p.MoveAfter == "") != (p.MoveTablespace == ""):
+			return nil, fmt.Errorf("%s: %s: move_after and move_tablespace go together", path, p.Table)
+		}
+		if p.Premake == 0 {
+			p.Premake = 4
+		}
+		if p.RetentionAction == "" {
+			p.RetentionAction = "drop"
+		}
+	}
+	return cfg, nil
+}
+
+// intervalStart truncates t (in UTC) to the start of its interval; zero
+// for an unknown interval.
+func intervalStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "daily":
+		return day
+	case "weekly":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "monthly":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "yearly":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// nextInterval is the start of the interval after the one starting at t.
+func nextInterval(t time.Time, interval string) time.Time {
+	switch interval {
+	case "daily":
+		return t.AddDate(0, 0, 1)
+	case "weekly":
+		return t.AddDate(0, 0, 7)
+	case "monthly":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(1, 0, 0)
+}
+
+// partitionName is the name of the partition of parent starting at t.
+func partitionName(parent string, t time.Time, interval string) string {
+	switch interval {
+	case "monthly":
+		return parent + t.Format("_p200601")
+	case "yearly":
+		return parent + t.Format("_p2006")
+	}
+	return parent + t.Format("_p20060102")
+}
+
+// partition is an existing partition.
+type partition struct {
+	Name       string    `json:"name"` // As regclass prints it: qualified unless on the search_path
+	From       time.Time `json:"from,omitzero"`
+	To         time.Time `json:"to,omitzero"`
+	Tablespace string    `json:"tablespace,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	Default    bool      `json:"default,omitempty"`
+}
+
+// partitionedTable is a policy's table as found in the catalog.
+type partitionedTable struct {
+	Schema, Name string
+	Key, KeyType string
+	Partitions   []partition
+	HasDefault   bool
+}
+
+func (t *partitionedTable) qualified() string {
+	return pgx.Identifier{t.Schema, t.Name}.Sanitize()
+}
+
+// readPartitionedTable looks up table and its partitions. Bounds are read as
+// UTC for date and timestamp keys.
+func readPartitionedTable(ctx context.Context, pool *pgxpool.Pool, table string) (*partitionedTable, error) {
+	t := &partitionedTable{}
+	var strategy string
+	var keys int
+	err := pool.QueryRow(ctx, `
+		SELECT n.nspname, c.relname, coalesce(a.attname::text, ''),
+		       coalesce(format_type(a.atttypid, a.atttypmod), ''), pt.partstrat::text, pt.partnatts
+		FROM pg_partitioned_table pt
+		JOIN pg_class c ON c.oid = pt.partrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = pt.partattrs[0]
+		WHERE c.oid = to_regclass($1)
+	`, table).Scan(&t.Schema, &t.Name, &t.Key, &t.KeyType, &strategy, &keys)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.New("not a partitioned table (or not visible to this role)")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strategy != "r" || keys != 1:
+		return nil, errors.New("only tables range-partitioned on one column are managed")
+	case t.Key == "":
+		return nil, errors.New("partitioned on an expression: only a plain column key is managed")
+	case t.KeyType != "date" && !strings.HasPrefix(t.KeyType, "timestamp"):
+		return nil, fmt.Errorf("partition key %s is %s: only date and timestamp keys are managed", t.Key, t.KeyType)
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT c.oid::regclass::text, coalesce(ts.spcname::text, ''), pg_total_relation_size(c.oid),
+		       pg_get_expr(c.relpartbound, c.oid) = 'DEFAULT',
+		       CASE WHEN $2 THEN b[1]::timestamptz ELSE b[1]::timestamp AT TIME ZONE 'UTC' END,
+		       CASE WHEN $2 THEN b[2]::timestamptz ELSE b[2]::timestamp AT TIME ZONE 'UTC' END
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		LEFT JOIN pg_tablespace ts ON ts.oid = c.reltablespace
+		CROSS JOIN LATERAL regexp_match(pg_get_expr(c.relpartbound, c.oid),
+		                                'FROM \(''([^'']+)''\) TO \(''([^'']+)''\)') b
+		WHERE i.inhparent = to_regclass($1)
+		ORDER BY 5 NULLS FIRST
+	`, t.qualified(), t.KeyType == "timestamp with time zone")
+	if err != nil {
+		return nil, err
+	}
+	t.Partitions, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (partition, error) {
+		var p partition
+		var from, to *time.Time
+		err := row.Scan(&p.Name, &p.Tablespace, &p.Bytes, &p.Default, &from, &to)
+		if from != nil && to != nil {
+			p.From, p.To = from.UTC(), to.UTC()
+		}
+		t.HasDefault = t.HasDefault || p.Default
+		return p, err
+	})
+	return t, err
+}
+
+// partitionAction is one planned or executed change.
+type partitionAction struct {
+	Action    string    `json:"action"` // create, detach, drop or move
+	Partition string    `json:"partition"`
+	From      time.Time `json:"from,omitzero"`
+	To        time.Time `json:"to,omitzero"`
+	Bytes     int64     `json:"bytes,omitempty"`
+	Reason    string    `json:"reason"`
+	SQL       []string  `json:"sql"`
+	Done      bool      `json:"done"`
+	Seconds   float64   `json:"seconds,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// tableLifecycle is the report for one policy.
+type tableLifecycle struct {
+	Table      string            `json:"table"`
+	Key        string            `json:"key,omitempty"`
+	Interval   string            `json:"interval"`
+	Partitions int               `json:"partitions"`
+	HasDefault bool              `json:"has_default,omitempty"`
+	Covered    time.Time         `json:"covered_until,omitzero"` // End of the last partition
+	Missing    bool              `json:"missing_current"`        // No partition for now
+	Actions    []partitionAction `json:"actions"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// planLifecycle works out the actions a policy calls for.
+func planLifecycle(ctx context.Context, pool *pgxpool.Pool, p partitionPolicy, concurrent bool) (*tableLifecycle, error) {
+	lc := &tableLifecycle{Table: p.Table, Interval: p.Interval, Actions: []partitionAction{}}
+	t, err := readPartitionedTable(ctx, pool, p.Table)
+	if err != nil {
+		return lc, err
+	}
+	lc.Table, lc.Key, lc.HasDefault = t.qualified(), t.Key, t.HasDefault
+	var ranged []partition
+	for _, part := range t.Partitions {
+		if !part.From.IsZero() {
+			ranged = append(ranged, part)
+			lc.Covered = part.To
+		}
+	}
+	lc.Partitions = len(t.Partitions)
+
+	now := time.Now().UTC()
+	start := intervalStart(now, p.Interval)
+	for i := 0; i <= p.Premake; i++ {
+		from, to := start, nextInterval(start, p.Interval)
+		start = to
+		name := partitionName(t.Name, from, p.Interval)
+		var covered bool
+		var overlap []string
+		for _, part := range ranged {
+			if part.From.Before(to) && part.To.After(from) {
+				overlap = append(overlap, part.Name)
+				covered = covered || !part.From.After(from) && !part.To.Before(to)
+			}
+		}
+		if covered {
+			continue
+		}
+		if i == 0 {
+			lc.Missing = true
+		}
+		a := partitionAction{Action: "create", Partition: pgx.Identifier{t.Schema, name}.Sanitize(), From: from, To: to, Reason: fmt.Sprintf("premake %d", p.Premake)}
+		if i == 0 {
+			a.Reason = "current interval"
+		}
+		switch {
+		case len(name) > 63:
+			a.Error = fmt.Sprintf("partition name %s is longer than 63 bytes", name)
+		case len(overlap) > 0:
+			a.Error = "overlaps " + strings.Join(overlap, ", ") + ": create it by hand"
+		default:
+			ddl := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+				a.Partition, lc.Table, from.Format("2006-01-02 15:04:05+00"), to.Format("2006-01-02 15:04:05+00"))
+			if p.Tablespace != "" {
+				ddl += " TABLESPACE " + pgx.Identifier{p.Tablespace}.Sanitize()
+			}
+			a.SQL = []string{ddl}
+			if t.HasDefault {
+				a.Reason += "; the DEFAULT partition is scanned for rows in range"
+			}
+		}
+		lc.Actions = append(lc.Actions, a)
+	}
+
+	cutoff := func(interval string) (time.Time, error) {
+		var c time.Time
+		err := pool.QueryRow(ctx, "SELECT now() - $1::interval", interval).Scan(&c)
+		return c.UTC(), err
+	}
+	retained := map[string]bool{}
+	if p.Retention != "" {
+		c, err := cutoff(p.Retention)
+		if err != nil {
+			return lc, fmt.Errorf("retention %q: %w", p.Retention, err)
+		}
+		detach := fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %%s", lc.Table)
+		if concurrent && !t.HasDefault {
+			detach += " CONCURRENTLY"
+		}
+		for _, part := range ranged {
+			if part.To.After(c) {
+				continue
+			}
+			retained[part.Name] = true
+			a := partitionAction{Action: p.RetentionAction, Partition: part.Name, From: part.From, To: part.To, Bytes: part.Bytes,
+				Reason: fmt.Sprintf("older than %s (before %s)", p.Retention, c.Format(time.DateOnly)),
+				SQL:    []string{fmt.Sprintf(detach, part.Name)}}
+			if p.RetentionAction == "drop" {
+				a.SQL = append(a.SQL, "DROP TABLE "+part.Name)
+			}
+			lc.Actions = append(lc.Actions, a)
+		}
+	}
+
+	if p.MoveAfter != "" {
+		c, err := cutoff(p.MoveAfter)
+		if err != nil {
+			return lc, fmt.Errorf("move_after %q: %w", p.MoveAfter, err)
+		}
+		for _, part := range ranged {
+			if retained[part.Name] || part.To.After(c) || part.Tablespace == p.MoveTablespace {
+				continue
+			}
+			a := partitionAction{Action: "move", Partition: part.Name, From: part.From, To: part.To, Bytes: part.Bytes,
+				Reason: fmt.Sprintf("older than %s: to tablespace %s", p.MoveAfter, p.MoveTablespace)}
+			ts := pgx.Identifier{p.MoveTablespace}.Sanitize()
+			a.SQL = []string{fmt.Sprintf("ALTER TABLE %s SET TABLESPACE %s", part.Name, ts)}
+			indexes, err := pool.Query(ctx, `
+				SELECT indexrelid::regclass::text FROM pg_index WHERE indrelid = to_regclass($1) ORDER BY 1
+			`, part.Name)
+			if err != nil {
+				return lc, err
+			}
+			names, err := pgx.CollectRows(indexes, pgx.RowTo[string])
+			if err != nil {
+				return lc, err
+			}
+			for _, idx := range names {
+				a.SQL = append(a.SQL, fmt.Sprintf("ALTER INDEX %s SET TABLESPACE %s", idx, ts))
+			}
+			lc.Actions = append(lc.Actions, a)
+		}
+	}
+	return lc, nil
+}
+
+// applyLifecycle runs the planned actions on conn, in order, stopping a
+// partition's statements at the first error.
+func applyLifecycle(ctx context.Context, conn *pgxpool.Conn, lc *tableLifecycle) {
+	for i := range lc.Actions {
+		a := &lc.Actions[i]
+		if a.Error != "" {
+			continue
+		}
+		started := time.Now()
+		for _, sql := range a.SQL {
+			if _, err := conn.Exec(ctx, sql); err != nil {
+				a.Error = err.Error()
+				if strings.Contains(sql, "CONCURRENTLY") {
+					a.Error += fmt.Sprintf(" (if the detach is pending, finish it with ALTER TABLE %s DETACH PARTITION %s FINALIZE)", lc.Table, a.Partition)
+				}
+				break
+			}
+		}
+		a.Seconds = time.Since(started).Seconds()
+		a.Done = a.Error == ""
+		if a.Action == "create" && a.Done && a.To.After(lc.Covered) {
+			lc.Covered = a.To
+		}
+	}
+}
+
+// printLifecycle writes the report for a person.
+func printLifecycle(server string, apply bool, tables []*tableLifecycle) {
+	mode := "dry run, -apply to execute"
+	if apply {
+		mode = "applied"
+	}
+	fmt.Printf("🗂️  Partition lifecycle on %s (%s)\n", server, mode)
+	icons := map[string]string{"create": "➕", "detach": "✂️ ", "drop": "🗑️ ", "move": "📦"}
+	for _, lc := range tables {
+		fmt.Printf("\n%s", lc.Table)
+		if lc.Error != "" {
+			fmt.Printf("\n   ❌ %s\n", lc.Error)
+			continue
+		}
+		fmt.Printf(" (%s on %s, %d partitions", lc.Interval, lc.Key, lc.Partitions)
+		if lc.HasDefault {
+			fmt.Print(", DEFAULT partition")
+		}
+		if !lc.Covered.IsZero() {
+			fmt.Printf(", covered until %s", lc.Covered.Format(time.DateOnly))
+		}
+		fmt.Println(")")
+		if lc.Missing && !apply {
+			fmt.Println("   ⚠️  No partition for the current interval")
+		}
+		if len(lc.Actions) == 0 {
+			fmt.Println("   ✅ Nothing to do")
+			continue
+		}
+		for _, a := range lc.Actions {
+			status := "planned"
+			switch {
+			case a.Error != "":
+				status = "❌ " + a.Error
+			case a.Done:
+				status = fmt.Sprintf("✅ %.1fs", a.Seconds)
+			}
+			size := ""
+			if a.Bytes > 0 {
+				size = formatBytes(a.Bytes)
+			}
+			fmt.Printf("   %s %-6s %-40s [%s, %s) %10s  %s\n      %s\n", icons[a.Action], a.Action, oneLine(a.Partition, 40),
+				a.From.Format(time.DateOnly), a.To.Format(time.DateOnly), size, a.Reason, status)
+			if !apply {
+				for _, sql := range a.SQL {
+					fmt.Printf("      %s;\n", sql)
+				}
+			}
+		}
+	}
+}
+
+// Partitions runs the partitions command line tool.
+func Partitions() {
+	var dsn, configPath, only, format string
+	var apply bool
+	registerDSNFlag(&dsn)
+	flag.StringVar(&configPath, "config", "", "Retention policy file (see partitions.example.yaml)")
+	flag.StringVar(&only, "table", "", "Only this table of the policy file")
+	flag.BoolVar(&apply, "apply", false, "Execute the actions (default: dry run)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if configPath == "" {
+		log.Fatal("-config is required")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	cfg, err := loadPartitionsConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	pool, err := connect(ctx, dsn, "partitions", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	var version int
+	if err := pool.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		log.Fatal(err)
+	}
+
+	var tables []*tableLifecycle
+	failed := false
+	for _, p := range cfg.Tables {
+		if only != "" && p.Table != only {
+			continue
+		}
+		lc, err := planLifecycle(ctx, pool, p, version >= 140000)
+		if err != nil {
+			lc.Error = err.Error()
+			failed = true
+		}
+		tables = append(tables, lc)
+	}
+	if len(tables) == 0 {
+		log.Fatalf("-table %s is not in %s", only, configPath)
+	}
+
+	if apply {
+		// Every table is planned before the first change.
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET lock_timeout = %d", cfg.LockTimeout.Milliseconds())); err != nil {
+			log.Fatal(err)
+		}
+		for _, lc := range tables {
+			if lc.Error == "" {
+				applyLifecycle(ctx, conn, lc)
+			}
+		}
+		conn.Release()
+	}
+	for _, lc := range tables {
+		for _, a := range lc.Actions {
+			failed = failed || a.Error != ""
+		}
+		failed = failed || lc.Missing && !apply
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(tables); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printLifecycle(describeTarget(pool.Config()), apply, tables)
+	}
+	if failed {
+		pool.Close()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,465 @@
+package dbre
+
+// ============================================================================
+// CONNECTION POOLER COMPARISON (cmd/pooler-bench)
+// ============================================================================
+//
+// Which pooler, in which mode, and what does it cost? pooler-bench runs the
+// same workload against each -target, a name and a DSN, typically Postgres
+// directly, PgBouncer in session and in transaction mode, and pgcat:
+//   connect   -connects sequential connections: time to an authenticated
+//             session, and to the answer of its first query (a pooler may
+//             only then pick a server connection)
+//   ramp      for each -clients count, that many clients, each with its own
+//             connection, run the -query transaction back to back for
+//             -step-duration: throughput, latency p50/p99 and errors
+//             (connections refused once max_connections or the pooler's
+//             max_client_conn is reached count as errors)
+//   backends  with -dsn, the server's client backends are sampled during
+//             each step: how many server connections the target needed
+// The summary compares every target with the first: connection cost,
+// latency at the lowest client count, and the throughput ceiling (the best
+// step) with the client count it was reached at.
+//
+// Statements run with the extended protocol but unnamed (pgx's exec mode),
+// which every pooler mode supports; -simple-protocol avoids the extended
+// protocol altogether. Use the same database, role and queries on every
+// target, and run it from the application's side of the network.
+//
+//   go run ./cmd/pooler-bench -dsn=postgres://dbre@db1:5432/avro \
+//     -target=direct=postgres://app@db1:5432/avro -target=pgbouncer-tx=postgres://app@db1:6432/avro \
+//     -target=pgbouncer-session=postgres://app@db1:6433/avro -target=pgcat=postgres://app@db1:6434/avro
+//   go run ./cmd/pooler-bench -target=direct=... -target=pgbouncer-tx=... -clients=50,200,800 \
+//     -query="SELECT * FROM orders WHERE id = 42" -format=json
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// poolerTarget is one way to reach the database.
+type poolerTarget struct {
+	name string
+	cfg  *pgx.ConnConfig
+}
+
+// poolerOptions are the command line settings.
+type poolerOptions struct {
+	targets        []poolerTarget
+	clients        []int
+	queries        []string
+	connects       int
+	stepDuration   time.Duration
+	simpleProtocol bool
+}
+
+// poolerConnect is the cost of a new connection through a target.
+type poolerConnect struct {
+	Connects   int           `json:"connects"`
+	Errors     int           `json:"errors"`
+	ConnectP50 time.Duration `json:"connect_p50_ns"`
+	ConnectP99 time.Duration `json:"connect_p99_ns"`
+	FirstP50   time.Duration `json:"first_query_p50_ns"` // Connect to first answer
+	FirstP99   time.Duration `json:"first_query_p99_ns"`
+	Error      string        `json:"error,omitempty"` // Last connect error
+}
+
+// poolerStep is one client count of the ramp.
+type poolerStep struct {
+	Clients        int           `json:"clients"`
+	Connected      int           `json:"connected"`
+	Transactions   int64         `json:"transactions"`
+	Errors         int64         `json:"errors"`
+	TPS            float64       `json:"tps"`
+	P50            time.Duration `json:"p50_ns"`
+	P99            time.Duration `json:"p99_ns"`
+	ServerBackends int           `json:"server_backends_max,omitempty"`
+	Error          string        `json:"error,omitempty"` // First error seen
+}
+
+// poolerResult is everything measured through one target.
+type poolerResult struct {
+	Target   string        `json:"target"`
+	Server   string        `json:"server"`
+	Connect  poolerConnect `json:"connect"`
+	Steps    []poolerStep  `json:"steps"`
+	Ceiling  float64       `json:"ceiling_tps"`
+	AtClient int           `json:"ceiling_clients"`
+	// Relative to the first target
+	ConnectVsFirst float64 `json:"connect_p50_vs_first,omitempty"`
+	LatencyVsFirst float64 `json:"p50_vs_first,omitempty"` // At the lowest client count
+	CeilingVsFirst float64 `json:"ceiling_vs_first,omitempty"`
+}
+
+// poolerBench runs the comparison.
+type poolerBench struct {
+	opts    poolerOptions
+	server  *pgxpool.Pool // -dsn, to count backends; nil without
+	verbose bool
+}
+
+// measureConnect opens and closes -connects connections one after the
+// other.
+func (b *poolerBench) measureConnect(ctx context.Context, t poolerTarget) poolerConnect {
+	c := poolerConnect{Connects: b.opts.connects}
+	var connects, firsts []float64
+	for i := 0; i < b.opts.connects && ctx.Err() == nil; i++ {
+		start := time.Now()
+		conn, err := pgx.ConnectConfig(ctx, t.cfg)
+		if err != nil {
+			c.Errors++
+			c.Error = err.Error()
+			continue
+		}
+		connected := time.Now()
+		_, err = conn.Exec(ctx, "SELECT 1")
+		answered := time.Now()
+		conn.Close(context.Background())
+		if err != nil {
+			c.Errors++
+			c.Error = err.Error()
+			continue
+		}
+		connects = append(connects, float64(connected.Sub(start)))
+		firsts = append(firsts, float64(answered.Sub(start)))
+	}
+	if len(connects) > 0 {
+		sort.Float64s(connects)
+		sort.Float64s(firsts)
+		c.ConnectP50 = time.Duration(percentile(connects, 0.5))
+		c.ConnectP99 = time.Duration(percentile(connects, 0.99))
+		c.FirstP50 = time.Duration(percentile(firsts, 0.5))
+		c.FirstP99 = time.Duration(percentile(firsts, 0.99))
+	}
+	return c
+}
+
+// transaction runs the -query statements once, in a transaction when
+// there are several.
+func (b *poolerBench) transaction(ctx context.Context, conn *pgx.Conn) error {
+	if len(b.opts.queries) == 1 {
+		_, err := conn.Exec(ctx, b.opts.queries[0])
+		return err
+	}
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+	for _, q := range b.opts.queries {
+		if _, err := tx.Exec(ctx, q); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// step runs clients clients through t for -step-duration.
+func (b *poolerBench) step(ctx context.Context, t poolerTarget, clients int) poolerStep {
+	s := poolerStep{Clients: clients}
+	var mu sync.Mutex
+	var lats []float64
+	fail := func(err error) {
+		mu.Lock()
+		s.Errors++
+		if s.Error == "" {
+			s.Error = err.Error()
+		}
+		mu.Unlock()
+	}
+
+	// Connect everyone first: the step measures the workload, not the
+	// connection storm.
+	conns := make([]*pgx.Conn, clients)
+	var wg sync.WaitGroup
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := pgx.ConnectConfig(ctx, t.cfg)
+			if err != nil {
+				if ctx.Err() == nil {
+					fail(err)
+				}
+				return
+			}
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close(context.Background())
+			}
+		}
+	}()
+
+	stepCtx, cancel := context.WithTimeout(ctx, b.opts.stepDuration)
+	defer cancel()
+	backends := make(chan int, 1)
+	if b.server != nil {
+		go func() { backends <- b.sampleBackends(stepCtx) }()
+	}
+	start := time.Now()
+	for _, conn := range conns {
+		if conn == nil {
+			continue
+		}
+		s.Connected++
+		wg.Add(1)
+		go func(conn *pgx.Conn) {
+			defer wg.Done()
+			var mine []float64
+			for stepCtx.Err() == nil {
+				t0 := time.Now()
+				if err := b.transaction(stepCtx, conn); err != nil {
+					if stepCtx.Err() != nil {
+						break
+					}
+					fail(err)
+					if conn.IsClosed() {
+						break
+					}
+					continue
+				}
+				mine = append(mine, float64(time.Since(t0)))
+			}
+			mu.Lock()
+			lats = append(lats, mine...)
+			mu.Unlock()
+		}(conn)
+	}
+	wg.Wait()
+	elapsed := time.Since(start).Seconds()
+	cancel()
+	if b.server != nil {
+		s.ServerBackends = <-backends
+	}
+	s.Transactions = int64(len(lats))
+	if elapsed > 0 {
+		s.TPS = float64(s.Transactions) / elapsed
+	}
+	if len(lats) > 0 {
+		sort.Float64s(lats)
+		s.P50 = time.Duration(percentile(lats, 0.5))
+		s.P99 = time.Duration(percentile(lats, 0.99))
+	}
+	return s
+}
+
+// sampleBackends returns the most client backends seen on -dsn until ctx
+// ends, not counting its own.
+func (b *poolerBench) sampleBackends(ctx context.Context) int {
+	most := 0
+	for {
+		var n int
+		err := b.server.QueryRow(ctx, `
+			SELECT count(*) FROM pg_stat_activity
+			WHERE backend_type = 'client backend' AND pid <> pg_backend_pid()
+		`).Scan(&n)
+		if err == nil {
+			most = max(most, n)
+		}
+		select {
+		case <-ctx.Done():
+			return most
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// run measures one target.
+func (b *poolerBench) run(ctx context.Context, t poolerTarget) poolerResult {
+	r := poolerResult{Target: t.name, Server: fmt.Sprintf("%s@%s:%d/%s", t.cfg.User, t.cfg.Host, t.cfg.Port, t.cfg.Database)}
+	if b.verbose {
+		fmt.Printf("\n🔌 %s (%s)\n", r.Target, r.Server)
+	}
+	r.Connect = b.measureConnect(ctx, t)
+	if b.verbose {
+		fmt.Printf("   connect p50 %v p99 %v, to first answer p50 %v", r.Connect.ConnectP50.Round(time.Microsecond),
+			r.Connect.ConnectP99.Round(time.Microsecond), r.Connect.FirstP50.Round(time.Microsecond))
+		if r.Connect.Errors > 0 {
+			fmt.Printf("  ⚠️  %d failed: %s", r.Connect.Errors, r.Connect.Error)
+		}
+		fmt.Println()
+	}
+	for _, clients := range b.opts.clients {
+		if ctx.Err() != nil {
+			break
+		}
+		s := b.step(ctx, t, clients)
+		r.Steps = append(r.Steps, s)
+		if s.TPS > r.Ceiling {
+			r.Ceiling, r.AtClient = s.TPS, clients
+		}
+		if b.verbose {
+			printPoolerStep(s)
+		}
+	}
+	return r
+}
+
+// comparePoolers fills in the ratios to the first target.
+func comparePoolers(results []poolerResult) {
+	if len(results) == 0 {
+		return
+	}
+	first := results[0]
+	for i := range results[1:] {
+		r := &results[i+1]
+		if first.Connect.ConnectP50 > 0 {
+			r.ConnectVsFirst = float64(r.Connect.ConnectP50) / float64(first.Connect.ConnectP50)
+		}
+		if len(first.Steps) > 0 && len(r.Steps) > 0 && first.Steps[0].P50 > 0 {
+			r.LatencyVsFirst = float64(r.Steps[0].P50) / float64(first.Steps[0].P50)
+		}
+		if first.Ceiling > 0 {
+			r.CeilingVsFirst = r.Ceiling / first.Ceiling
+		}
+	}
+}
+
+// printPoolerStep prints one ramp step.
+func printPoolerStep(s poolerStep) {
+	fmt.Printf("   %5d clients: %9.0f tps  p50 %-9v p99 %-9v", s.Clients, s.TPS,
+		s.P50.Round(time.Microsecond), s.P99.Round(time.Microsecond))
+	if s.ServerBackends > 0 {
+		fmt.Printf("  %d server backends", s.ServerBackends)
+	}
+	if s.Connected < s.Clients {
+		fmt.Printf("  ⚠️  only %d connected", s.Connected)
+	}
+	if s.Errors > 0 {
+		fmt.Printf("  ⚠️  %d errors: %s", s.Errors, oneLine(s.Error, 80))
+	}
+	fmt.Println()
+}
+
+// printPoolerSummary prints the comparison table.
+func printPoolerSummary(results []poolerResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Printf("\n📋 Pooler comparison (relative to %s)\n\n", results[0].Target)
+	fmt.Printf("   %-20s %12s %12s %12s %12s %10s\n", "target", "connect p50", "first p50", "p50 (low)", "ceiling tps", "at clients")
+	for i, r := range results {
+		low := time.Duration(0)
+		if len(r.Steps) > 0 {
+			low = r.Steps[0].P50
+		}
+		fmt.Printf("   %-20s %12v %12v %12v %12.0f %10d\n", r.Target, r.Connect.ConnectP50.Round(time.Microsecond),
+			r.Connect.FirstP50.Round(time.Microsecond), low.Round(time.Microsecond), r.Ceiling, r.AtClient)
+		if i > 0 && r.CeilingVsFirst > 0 {
+			fmt.Printf("   %-20s %11.2fx %12s %11.2fx %11.2fx\n", "", r.ConnectVsFirst, "", r.LatencyVsFirst, r.CeilingVsFirst)
+		}
+	}
+	fmt.Println()
+}
+
+// parsePoolerTarget parses name=dsn.
+func parsePoolerTarget(s string, simple bool) (poolerTarget, error) {
+	name, dsn, ok := strings.Cut(s, "=")
+	if !ok || name == "" || strings.Contains(name, "://") {
+		return poolerTarget{}, fmt.Errorf("invalid -target %q (use name=dsn)", s)
+	}
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return poolerTarget{}, fmt.Errorf("-target %s: invalid connection string: %w", name, err)
+	}
+	cfg.RuntimeParams["application_name"] = "dbre-pooler-bench"
+	cfg.DefaultQueryExecMode = pgx.QueryExecModeExec
+	if simple {
+		cfg.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	}
+	return poolerTarget{name: name, cfg: cfg}, nil
+}
+
+// PoolerBench runs the pooler-bench command line tool.
+func PoolerBench() {
+	var dsn, clients, format string
+	var targets, queries stringList
+	var opts poolerOptions
+	registerDSNFlag(&dsn)
+	flag.Var(&targets, "target", "name=dsn to benchmark (repeatable; the first is the baseline)")
+	flag.Var(&queries, "query", "Statement of the workload transaction (repeatable; default SELECT 1)")
+	flag.StringVar(&clients, "clients", "16,64,256", "Client counts of the ramp, comma separated")
+	flag.IntVar(&opts.connects, "connects", 200, "Sequential connections timed per target")
+	flag.DurationVar(&opts.stepDuration, "step-duration", 30*time.Second, "Workload time per client count")
+	flag.BoolVar(&opts.simpleProtocol, "simple-protocol", false, "Use the simple query protocol")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if len(targets) == 0 {
+		log.Fatal("at least one -target is required")
+	}
+	for _, t := range targets {
+		target, err := parsePoolerTarget(t, opts.simpleProtocol)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.targets = append(opts.targets, target)
+	}
+	for _, c := range strings.Split(clients, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(c))
+		if err != nil || n < 1 {
+			log.Fatalf("invalid client count %q in -clients", c)
+		}
+		opts.clients = append(opts.clients, n)
+	}
+	sort.Ints(opts.clients)
+	opts.queries = queries
+	if len(opts.queries) == 0 {
+		opts.queries = []string{"SELECT 1"}
+	}
+	if opts.connects < 1 || opts.stepDuration <= 0 {
+		log.Fatal("-connects and -step-duration must be positive")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	b := &poolerBench{opts: opts, verbose: format == "text"}
+	if dsn != "" {
+		pool, err := connect(ctx, dsn, "pooler-bench", 1)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer pool.Close()
+		b.server = pool
+	}
+
+	var results []poolerResult
+	for _, t := range opts.targets {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, b.run(ctx, t))
+	}
+	comparePoolers(results)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printPoolerSummary(results)
+}
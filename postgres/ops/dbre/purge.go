@@ -0,0 +1,437 @@
+package dbre
+
+// ============================================================================
+// BATCHED DELETE AND ARCHIVAL (cmd/purge)
+// ============================================================================
+//
+// One DELETE of millions of rows holds its locks for the whole run, makes
+// replicas fall behind by the WAL it generates at once, and leaves the
+// dead tuples for one huge vacuum. purge removes the rows matching -where
+// from -table in small transactions instead:
+//   batches   walk the table in -key order (the primary key by default;
+//             it needs an index), -batch rows at a time, each batch its own
+//             statement and transaction, with -sleep between batches
+//   archive   with -archive-table, each batch's rows are inserted there by
+//             the same statement that deletes them, so a row is never lost
+//             or copied twice. The archive table is created LIKE -table if
+//             it does not exist; an existing one needs the same columns in
+//             the same order
+//   lag       before each batch, replay lag of the replicas
+//             (pg_stat_replication) is checked; above -max-lag the run
+//             pauses until they catch up
+//   vacuum    every -vacuum-every rows, and at the end, VACUUM (ANALYZE)
+//             the table so the space is reusable and the next batches don't
+//             wade through dead tuples (needs table ownership; skipped with
+//             a warning otherwise)
+// -max-rows and -max-duration bound a run to a maintenance window; Ctrl-C
+// stops after the current batch. The report gives rows removed, rate, WAL
+// generated, peak replica lag and time paused for it.
+//
+// Without -apply nothing is deleted: the dry run checks the condition,
+// estimates the rows it matches and prints the batch statement. Exit code 2
+// when the run failed.
+//
+//   go run ./cmd/purge -table=events -where="created_at < now() - interval '90 days'"
+//   go run ./cmd/purge -table=events -where="created_at < now() - interval '90 days'" -apply
+//   go run ./cmd/purge -table=audit_log -where="logged_at < '2026-01-01'" -archive-table=archive.audit_log -batch=2000 -max-lag=5s -max-duration=2h -apply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// purgeOptions are the command line settings.
+type purgeOptions struct {
+	table, where, key, archive string
+	batch                      int
+	sleep, maxLag, maxDuration time.Duration
+	maxRows, vacuumEvery       int64
+	apply                      bool
+}
+
+// purgeReport is the outcome of a run.
+type purgeReport struct {
+	Table          string  `json:"table"`
+	Key            string  `json:"key"`
+	Where          string  `json:"where"`
+	Archive        string  `json:"archive_table,omitempty"`
+	Estimated      int64   `json:"estimated_rows"` // Planner estimate at the start
+	Applied        bool    `json:"applied"`
+	Batches        int64   `json:"batches"`
+	Rows           int64   `json:"rows"`
+	Seconds        float64 `json:"seconds"`
+	RowsPerSec     float64 `json:"rows_per_sec"`
+	WALBytes       int64   `json:"wal_bytes"`
+	PeakLagSeconds float64 `json:"peak_replay_lag_seconds"`
+	PeakLagBytes   int64   `json:"peak_replay_lag_bytes"`
+	Pauses         int64   `json:"lag_pauses"`
+	PausedSeconds  float64 `json:"paused_seconds"`
+	Vacuums        int     `json:"vacuums"`
+	VacuumSeconds  float64 `json:"vacuum_seconds"`
+	Finished       bool    `json:"finished"`             // No matching rows left
+	StoppedBy      string  `json:"stopped_by,omitempty"` // max-rows, max-duration, interrupt or error
+	Error          string  `json:"error,omitempty"`
+	SQL            string  `json:"sql"`
+}
+
+// purger runs the batches.
+type purger struct {
+	pool           *pgxpool.Pool
+	opts           purgeOptions
+	table, key     string // Quoted
+	keyType        string
+	report         purgeReport
+	vacuumDisabled bool
+}
+
+// resolve finds the table, its batching key and the archive table.
+func (p *purger) resolve(ctx context.Context) error {
+	var schema, name string
+	err := p.pool.QueryRow(ctx, `
+		SELECT n.nspname, c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = to_regclass($1) AND c.relkind IN ('r', 'p')
+	`, p.opts.table).Scan(&schema, &name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("table %s not found", p.opts.table)
+	}
+	if err != nil {
+		return err
+	}
+	p.table = pgx.Identifier{schema, name}.Sanitize()
+	p.report.Table = p.table
+
+	// The key: the one-column primary key, or -key, with an index leading
+	// on it so each batch starts where the last one ended.
+	rows, err := p.pool.Query(ctx, `
+		SELECT a.attname, format_type(a.atttypid, a.atttypmod),
+		       EXISTS (SELECT FROM pg_index x WHERE x.indrelid = a.attrelid AND x.indkey[0] = a.attnum AND x.indpred IS NULL)
+		FROM pg_attribute a
+		WHERE a.attrelid = to_regclass($1) AND a.attnum > 0 AND NOT a.attisdropped
+		  AND CASE WHEN $2 = '' THEN a.attnum = ANY (SELECT unnest(indkey) FROM pg_index WHERE indrelid = a.attrelid AND indisprimary)
+		           ELSE a.attname = $2 END
+	`, p.table, p.opts.key)
+	if err != nil {
+		return err
+	}
+	type keyColumn struct {
+		name, typ string
+		indexed   bool
+	}
+	keys, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (keyColumn, error) {
+		var k keyColumn
+		err := row.Scan(&k.name, &k.typ, &k.indexed)
+		return k, err
+	})
+	switch {
+	case err != nil:
+		return err
+	case len(keys) == 0 && p.opts.key != "":
+		return fmt.Errorf("%s has no column %s", p.table, p.opts.key)
+	case len(keys) != 1:
+		return fmt.Errorf("%s has no one-column primary key: choose a -key", p.table)
+	case !keys[0].indexed:
+		return fmt.Errorf("no index on %s.%s: every batch would scan the table; choose an indexed -key", p.table, keys[0].name)
+	}
+	p.key, p.keyType = pgx.Identifier{keys[0].name}.Sanitize(), keys[0].typ
+	p.report.Key = keys[0].name
+
+	// Check the condition and estimate what it matches.
+	var plan []struct {
+		Plan struct {
+			Rows int64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	var planJSON []byte
+	if err := p.pool.QueryRow(ctx, fmt.Sprintf("EXPLAIN (FORMAT JSON) SELECT 1 FROM %s WHERE %s", p.table, p.opts.where)).Scan(&planJSON); err != nil {
+		return fmt.Errorf("-where: %w", err)
+	}
+	if err := json.Unmarshal(planJSON, &plan); err == nil && len(plan) > 0 {
+		p.report.Estimated = plan[0].Plan.Rows
+	}
+
+	if p.opts.archive != "" {
+		var archive *string
+		if err := p.pool.QueryRow(ctx, "SELECT to_regclass($1)::text", p.opts.archive).Scan(&archive); err != nil {
+			return fmt.Errorf("-archive-table: %w", err)
+		}
+		if archive == nil {
+			p.report.Archive = pgx.Identifier(strings.Split(p.opts.archive, ".")).Sanitize()
+			if p.opts.apply {
+				if _, err := p.pool.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (LIKE %s)", p.report.Archive, p.table)); err != nil {
+					return fmt.Errorf("-archive-table: %w", err)
+				}
+			}
+		} else {
+			p.report.Archive = *archive
+		}
+	}
+	return nil
+}
+
+// batchSQL is the statement for one batch: $1 is the batch size, $2 the
+// last key of the previous batch (after is false for the first batch).
+// It returns the rows deleted and the last key looked at.
+func (p *purger) batchSQL(after bool) string {
+	lower := ""
+	if after {
+		lower = fmt.Sprintf("%s > $2::text::%s AND ", p.key, p.keyType)
+	}
+	archive := ""
+	if p.report.Archive != "" {
+		archive = fmt.Sprintf(",\narchived AS (INSERT INTO %s SELECT * FROM deleted)", p.report.Archive)
+	}
+	return fmt.Sprintf(`WITH batch AS (
+  SELECT %[1]s FROM %[2]s WHERE %[3]s(%[4]s) ORDER BY %[1]s LIMIT $1
+),
+deleted AS (
+  DELETE FROM %[2]s WHERE %[1]s IN (SELECT %[1]s FROM batch) AND (%[4]s) RETURNING *
+)%[5]s
+SELECT (SELECT count(*) FROM deleted), (SELECT %[1]s::text FROM batch ORDER BY %[1]s DESC LIMIT 1)`,
+		p.key, p.table, lower, p.opts.where, archive)
+}
+
+// replicaLag is the largest replay lag of the replicas.
+func (p *purger) replicaLag(ctx context.Context) (float64, int64, error) {
+	var seconds float64
+	var bytes int64
+	err := p.pool.QueryRow(ctx, `
+		SELECT coalesce(max(extract(epoch FROM replay_lag)), 0)::float8,
+		       coalesce(max(pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)), 0)::bigint
+		FROM pg_stat_replication
+	`).Scan(&seconds, &bytes)
+	if err == nil {
+		p.report.PeakLagSeconds = max(p.report.PeakLagSeconds, seconds)
+		p.report.PeakLagBytes = max(p.report.PeakLagBytes, bytes)
+	}
+	return seconds, bytes, err
+}
+
+// waitForReplicas pauses while replay lag is over -max-lag.
+func (p *purger) waitForReplicas(ctx context.Context, progress bool) error {
+	seconds, _, err := p.replicaLag(ctx)
+	if err != nil || p.opts.maxLag == 0 || seconds <= p.opts.maxLag.Seconds() {
+		return err
+	}
+	p.report.Pauses++
+	started := time.Now()
+	if progress {
+		fmt.Printf("⏸️  Replay lag %.1fs over %v: waiting for the replicas\n", seconds, p.opts.maxLag)
+	}
+	for seconds > p.opts.maxLag.Seconds() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+		if seconds, _, err = p.replicaLag(ctx); err != nil {
+			return err
+		}
+	}
+	p.report.PausedSeconds += time.Since(started).Seconds()
+	return nil
+}
+
+// vacuum runs VACUUM (ANALYZE) on the table unless it failed before.
+func (p *purger) vacuum(ctx context.Context) {
+	if p.vacuumDisabled {
+		return
+	}
+	started := time.Now()
+	if _, err := p.pool.Exec(ctx, "VACUUM (ANALYZE) "+p.table); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  VACUUM %s: %v (no more vacuums this run)\n", p.table, err)
+		p.vacuumDisabled = true
+		return
+	}
+	p.report.Vacuums++
+	p.report.VacuumSeconds += time.Since(started).Seconds()
+}
+
+// run deletes batches until no row matches or a limit is reached.
+func (p *purger) run(ctx context.Context, progress bool) error {
+	var startLSN, endLSN float64
+	walSQL := "SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0')::float8"
+	if err := p.pool.QueryRow(ctx, walSQL).Scan(&startLSN); err != nil {
+		return fmt.Errorf("not a primary: %w", err)
+	}
+	defer func() {
+		if p.pool.QueryRow(context.Background(), walSQL).Scan(&endLSN) == nil {
+			p.report.WALBytes = int64(endLSN - startLSN)
+		}
+	}()
+
+	started := time.Now()
+	lastReport := started
+	var last *string
+	var sinceVacuum int64
+	for {
+		switch {
+		case ctx.Err() != nil:
+			p.report.StoppedBy = "interrupt"
+			return nil
+		case p.opts.maxRows > 0 && p.report.Rows >= p.opts.maxRows:
+			p.report.StoppedBy = "max-rows"
+			return nil
+		case p.opts.maxDuration > 0 && time.Since(started) >= p.opts.maxDuration:
+			p.report.StoppedBy = "max-duration"
+			return nil
+		}
+		if err := p.waitForReplicas(ctx, progress); err != nil {
+			if ctx.Err() != nil {
+				p.report.StoppedBy = "interrupt"
+				return nil
+			}
+			return fmt.Errorf("replica lag: %w", err)
+		}
+
+		size := int64(p.opts.batch)
+		if p.opts.maxRows > 0 {
+			size = min(size, p.opts.maxRows-p.report.Rows)
+		}
+		var deleted int64
+		var err error
+		// The batch runs to completion even when interrupted.
+		if last == nil {
+			err = p.pool.QueryRow(context.Background(), p.batchSQL(false), size).Scan(&deleted, &last)
+		} else {
+			err = p.pool.QueryRow(context.Background(), p.batchSQL(true), size, *last).Scan(&deleted, &last)
+		}
+		if err != nil {
+			return fmt.Errorf("batch %d: %w", p.report.Batches+1, err)
+		}
+		p.report.Batches++
+		p.report.Rows += deleted
+		p.report.Seconds = time.Since(started).Seconds()
+		if last == nil {
+			p.report.Finished = true
+			return nil
+		}
+
+		sinceVacuum += deleted
+		if p.opts.vacuumEvery > 0 && sinceVacuum >= p.opts.vacuumEvery {
+			p.vacuum(ctx)
+			sinceVacuum = 0
+		}
+		if progress && time.Since(lastReport) >= 10*time.Second {
+			lastReport = time.Now()
+			fmt.Printf("[%s] %d rows in %d batches (%.0f/s) | replay lag peak %.1fs\n", lastReport.Format("15:04:05"),
+				p.report.Rows, p.report.Batches, float64(p.report.Rows)/p.report.Seconds, p.report.PeakLagSeconds)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.opts.sleep):
+		}
+	}
+}
+
+// printPurgeReport writes the report for a person.
+func printPurgeReport(r *purgeReport) {
+	fmt.Printf("\n🧹 %s WHERE %s (batches on %s)\n", r.Table, r.Where, r.Key)
+	if r.Archive != "" {
+		fmt.Printf("   Archive:          %s\n", r.Archive)
+	}
+	fmt.Printf("   Estimated rows:   %d (planner estimate at the start)\n", r.Estimated)
+	if !r.Applied {
+		fmt.Printf("\nDry run, -apply to delete. Each batch runs:\n\n%s\n", r.SQL)
+		return
+	}
+	fmt.Printf("   Rows removed:     %d in %d batches, %.1fs (%.0f rows/s)\n", r.Rows, r.Batches, r.Seconds, r.RowsPerSec)
+	fmt.Printf("   WAL generated:    %s\n", formatBytes(r.WALBytes))
+	fmt.Printf("   Peak replay lag:  %.1fs, %s\n", r.PeakLagSeconds, formatBytes(r.PeakLagBytes))
+	if r.Pauses > 0 {
+		fmt.Printf("   Paused for lag:   %d times, %.0fs\n", r.Pauses, r.PausedSeconds)
+	}
+	fmt.Printf("   Vacuums:          %d, %.1fs\n", r.Vacuums, r.VacuumSeconds)
+	switch {
+	case r.Error != "":
+		fmt.Printf("❌ %s\n", r.Error)
+	case r.Finished:
+		fmt.Println("✅ No matching rows left")
+	default:
+		fmt.Printf("⏹️  Stopped by %s: rerun to continue\n", r.StoppedBy)
+	}
+}
+
+// Purge runs the purge command line tool.
+func Purge() {
+	var dsn, format string
+	var opts purgeOptions
+	registerDSNFlag(&dsn)
+	flag.StringVar(&opts.table, "table", "", "Table to delete from")
+	flag.StringVar(&opts.where, "where", "", "SQL condition of the rows to delete")
+	flag.StringVar(&opts.key, "key", "", "Indexed column to batch on (default: the one-column primary key)")
+	flag.StringVar(&opts.archive, "archive-table", "", "Copy the rows here in the same statement (created LIKE -table if missing)")
+	flag.IntVar(&opts.batch, "batch", 5000, "Rows per batch")
+	flag.DurationVar(&opts.sleep, "sleep", 100*time.Millisecond, "Pause between batches")
+	flag.DurationVar(&opts.maxLag, "max-lag", 10*time.Second, "Pause while replica replay lag is above this (0: don't wait)")
+	flag.Int64Var(&opts.vacuumEvery, "vacuum-every", 1_000_000, "VACUUM (ANALYZE) the table after this many rows (0: only at the end)")
+	flag.Int64Var(&opts.maxRows, "max-rows", 0, "Stop after this many rows (0: no limit)")
+	flag.DurationVar(&opts.maxDuration, "max-duration", 0, "Stop after this long (0: no limit)")
+	flag.BoolVar(&opts.apply, "apply", false, "Delete (default: dry run)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if opts.table == "" || opts.where == "" {
+		log.Fatal("-table and -where are required")
+	}
+	if opts.batch < 1 {
+		log.Fatal("-batch must be at least 1")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "purge", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	p := &purger{pool: pool, opts: opts, report: purgeReport{Where: opts.where, Applied: opts.apply}}
+	if err := p.resolve(ctx); err != nil {
+		log.Fatal(err)
+	}
+	p.report.SQL = p.batchSQL(true)
+
+	if opts.apply {
+		if format == "text" {
+			fmt.Printf("🧹 Deleting from %s in batches of %d (about %d rows)\n", p.table, opts.batch, p.report.Estimated)
+		}
+		if err := p.run(ctx, format == "text"); err != nil {
+			p.report.Error = err.Error()
+			p.report.StoppedBy = "error"
+		}
+		if p.report.Rows > 0 {
+			p.vacuum(context.Background())
+		}
+		if p.report.Seconds > 0 {
+			p.report.RowsPerSec = float64(p.report.Rows) / p.report.Seconds
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&p.report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printPurgeReport(&p.report)
+	}
+	if p.report.Error != "" {
+		pool.Close()
+		os.Exit(2)
+	}
+}
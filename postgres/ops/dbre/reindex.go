@@ -0,0 +1,637 @@
+package dbre
+
+// ============================================================================
+// REINDEX CONCURRENTLY ORCHESTRATION (cmd/reindex)
+// ============================================================================
+//
+// Rebuilding bloated indexes one psql session at a time means someone
+// watching each REINDEX CONCURRENTLY for lock waits and cleaning up after
+// the ones that fail. reindex takes the list (-index, repeatable, -table
+// for all indexes of a table, -file with one name per line) and rebuilds
+// -parallel indexes at a time, at most one per table (REINDEX CONCURRENTLY
+// takes a SHARE UPDATE EXCLUSIVE lock on the table, so two on the same
+// table would queue behind each other):
+//   waits     every 2s each rebuild's backend is checked in
+//             pg_stat_activity and pg_stat_progress_create_index: time
+//             spent waiting on locks or for old transactions, and the pids
+//             blocking it. A rebuild waiting longer than -max-wait in one
+//             stretch is cancelled rather than left queueing.
+//   leftovers a failed or cancelled REINDEX CONCURRENTLY leaves an INVALID
+//             <index>_ccnew (or _ccold) behind that is maintained on every
+//             write and never used. After each rebuild the table is checked
+//             for them; -drop-invalid drops them with DROP INDEX
+//             CONCURRENTLY.
+//   hours     with -pause-hours (e.g. 08:00-18:00, local time, on
+//             -pause-days), no rebuild starts inside the window: the run
+//             waits for it to end. Rebuilds already running finish.
+// Indexes REINDEX CONCURRENTLY can't rebuild (exclusion constraints,
+// system catalogs) are skipped with the reason. The report gives, per
+// index, duration, size before and after, lock wait and outcome. Without
+// -apply nothing is rebuilt: the dry run lists the indexes, their sizes and
+// the order they would run in. Exit code 2 when a rebuild failed or an
+// INVALID leftover remains. Needs PostgreSQL 12+ and ownership of the
+// tables.
+//
+//   go run ./cmd/reindex -table=public.events -table=public.orders
+//   go run ./cmd/reindex -file=bloated.txt -parallel=3 -pause-hours=08:00-18:00 -apply
+//   go run ./cmd/reindex -index=public.events_created_at_idx -max-wait=5m -drop-invalid -apply -format=json
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reindexOptions are the command line settings.
+type reindexOptions struct {
+	indexes, tables    []string
+	parallel           int
+	maxWait            time.Duration
+	pause              *pauseWindow
+	dropInvalid, apply bool
+}
+
+// pauseWindow is a daily time range in which no rebuild starts.
+type pauseWindow struct {
+	start, end time.Duration // Since midnight; end before start spans midnight
+	days       []time.Weekday
+	text       string
+}
+
+// parsePauseWindow parses -pause-hours (HH:MM-HH:MM) and -pause-days
+// (mon,tue,... or empty for every day).
+func parsePauseWindow(hours, days string) (*pauseWindow, error) {
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid -pause-hours %q (want HH:MM-HH:MM)", hours)
+	}
+	w := &pauseWindow{text: hours}
+	for i, s := range []string{from, to} {
+		t, err := time.Parse("15:04", strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -pause-hours %q (want HH:MM-HH:MM)", hours)
+		}
+		d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		if i == 0 {
+			w.start = d
+		} else {
+			w.end = d
+		}
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("-pause-hours %q is empty", hours)
+	}
+	names := []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+	for _, day := range strings.Split(days, ",") {
+		if day = strings.ToLower(strings.TrimSpace(day)); day == "" {
+			continue
+		}
+		i := slices.Index(names, day)
+		if i < 0 {
+			return nil, fmt.Errorf("invalid -pause-days entry %q (use mon, tue, ...)", day)
+		}
+		w.days = append(w.days, time.Weekday(i))
+	}
+	if len(w.days) > 0 {
+		w.text += " on " + days
+	}
+	return w, nil
+}
+
+// contains reports whether t is inside the window. A window spanning
+// midnight belongs to the day it starts on.
+func (w *pauseWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	of := t.Sub(midnight)
+	day := t.Weekday()
+	inside := of >= w.start && of < w.end
+	if w.end < w.start {
+		inside = of >= w.start || of < w.end
+		if of < w.end {
+			day = midnight.AddDate(0, 0, -1).Weekday()
+		}
+	}
+	return inside && (len(w.days) == 0 || slices.Contains(w.days, day))
+}
+
+// reindexTarget is one index to rebuild.
+type reindexTarget struct {
+	Index       string        `json:"index"`
+	Table       string        `json:"table"`
+	SizeBefore  int64         `json:"size_before_bytes"`
+	SizeAfter   int64         `json:"size_after_bytes,omitempty"`
+	Seconds     float64       `json:"seconds,omitempty"`
+	LockWait    time.Duration `json:"lock_wait_ns,omitempty"`
+	BlockedBy   []int32       `json:"blocked_by,omitempty"` // pids seen blocking it
+	Status      string        `json:"status"`               // planned, rebuilt, failed, cancelled, skipped
+	Reason      string        `json:"reason,omitempty"`
+	Leftovers   []string      `json:"invalid_leftovers,omitempty"`
+	Dropped     []string      `json:"dropped_leftovers,omitempty"`
+	tableOID    uint32
+	exclusion   bool
+	systemTable bool
+}
+
+// reindexReport is the outcome of a run.
+type reindexReport struct {
+	Applied   bool             `json:"applied"`
+	Parallel  int              `json:"parallel"`
+	PauseFor  string           `json:"pause_hours,omitempty"`
+	Paused    time.Duration    `json:"paused_ns,omitempty"`
+	Targets   []*reindexTarget `json:"indexes"`
+	Failed    bool             `json:"failed"`
+	StoppedBy string           `json:"stopped_by,omitempty"`
+}
+
+// reindexer runs the rebuilds.
+type reindexer struct {
+	pool    *pgxpool.Pool
+	opts    reindexOptions
+	verbose bool
+	report  reindexReport
+	mu      sync.Mutex
+	busy    map[uint32]bool // Tables with a rebuild running
+}
+
+// resolve looks up the indexes of -index and -table.
+func (r *reindexer) resolve(ctx context.Context) error {
+	seen := make(map[string]bool)
+	add := func(rows pgx.Rows) error {
+		targets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*reindexTarget, error) {
+			t := &reindexTarget{Status: "planned"}
+			err := row.Scan(&t.Index, &t.Table, &t.tableOID, &t.SizeBefore, &t.exclusion, &t.systemTable)
+			return t, err
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range targets {
+			if seen[t.Index] {
+				continue
+			}
+			seen[t.Index] = true
+			switch {
+			case t.exclusion:
+				t.Status, t.Reason = "skipped", "exclusion constraint indexes can't be rebuilt concurrently"
+			case t.systemTable:
+				t.Status, t.Reason = "skipped", "system catalog indexes can't be rebuilt concurrently"
+			}
+			r.report.Targets = append(r.report.Targets, t)
+		}
+		return nil
+	}
+	const indexSQL = `
+		SELECT i.indexrelid::regclass::text, i.indrelid::regclass::text, i.indrelid,
+		       pg_relation_size(i.indexrelid),
+		       EXISTS (SELECT FROM pg_constraint c WHERE c.conindid = i.indexrelid AND c.contype = 'x'),
+		       n.nspname IN ('pg_catalog', 'pg_toast', 'information_schema')
+		FROM pg_index i
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+	`
+	exists := func(kind, name string) error {
+		var found bool
+		if err := r.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&found); err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%s %s not found", kind, name)
+		}
+		return nil
+	}
+	for _, name := range r.opts.indexes {
+		if err := exists("index", name); err != nil {
+			return err
+		}
+		rows, err := r.pool.Query(ctx, indexSQL+" WHERE i.indexrelid = to_regclass($1)", name)
+		if err != nil {
+			return err
+		}
+		if err := add(rows); err != nil {
+			return err
+		}
+	}
+	for _, name := range r.opts.tables {
+		if err := exists("table", name); err != nil {
+			return err
+		}
+		rows, err := r.pool.Query(ctx, indexSQL+" WHERE i.indrelid = to_regclass($1) ORDER BY pg_relation_size(i.indexrelid) DESC", name)
+		if err != nil {
+			return err
+		}
+		if err := add(rows); err != nil {
+			return err
+		}
+	}
+	if len(r.report.Targets) == 0 {
+		return errors.New("no indexes to rebuild")
+	}
+	// Largest first, so the long rebuilds don't end up alone at the tail.
+	slices.SortStableFunc(r.report.Targets, func(a, b *reindexTarget) int { return cmp.Compare(b.SizeBefore, a.SizeBefore) })
+	return nil
+}
+
+// next claims the next planned index whose table is free, or returns nil
+// when none is left to start; done reports whether nothing is planned.
+func (r *reindexer) next() (t *reindexTarget, done bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	done = true
+	for _, t := range r.report.Targets {
+		if t.Status != "planned" {
+			continue
+		}
+		done = false
+		if !r.busy[t.tableOID] {
+			t.Status = "running"
+			r.busy[t.tableOID] = true
+			return t, false
+		}
+	}
+	return nil, done
+}
+
+// waitOutsideWindow blocks while now is inside -pause-hours.
+func (r *reindexer) waitOutsideWindow(ctx context.Context) error {
+	w := r.opts.pause
+	if w == nil || !w.contains(time.Now()) {
+		return nil
+	}
+	started := time.Now()
+	if r.verbose {
+		fmt.Fprintf(os.Stderr, "⏸️  Inside the pause window %s: waiting to start the next rebuild\n", w.text)
+	}
+	for w.contains(time.Now()) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(30 * time.Second):
+		}
+	}
+	r.mu.Lock()
+	r.report.Paused += time.Since(started)
+	r.mu.Unlock()
+	if r.verbose {
+		fmt.Fprintln(os.Stderr, "▶️  Pause window over: resuming")
+	}
+	return nil
+}
+
+// worker rebuilds indexes until none is left.
+func (r *reindexer) worker(ctx context.Context) {
+	for {
+		if err := r.waitOutsideWindow(ctx); err != nil {
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		t, done := r.next()
+		if done {
+			return
+		}
+		if t == nil {
+			// Every remaining index is on a table being rebuilt.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		r.rebuild(ctx, t)
+		r.mu.Lock()
+		delete(r.busy, t.tableOID)
+		r.mu.Unlock()
+	}
+}
+
+// rebuild runs REINDEX INDEX CONCURRENTLY on a connection of its own,
+// watching it for waits.
+func (r *reindexer) rebuild(ctx context.Context, t *reindexTarget) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		r.finish(t, "failed", err.Error())
+		return
+	}
+	defer conn.Release()
+	pid := conn.Conn().PgConn().PID()
+	if r.verbose {
+		fmt.Fprintf(os.Stderr, "⏱️  REINDEX INDEX CONCURRENTLY %s (%s)...\n", t.Index, formatBytes(t.SizeBefore))
+	}
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	cancelled := make(chan struct{}, 1)
+	watched := make(chan struct{})
+	go func() {
+		r.watch(watchCtx, t, pid, cancelled)
+		close(watched)
+	}()
+	start := time.Now()
+	// The rebuild isn't interrupted by Ctrl-C: cancelling it midway leaves
+	// an INVALID index behind.
+	_, err = conn.Exec(context.Background(), "REINDEX INDEX CONCURRENTLY "+t.Index)
+	t.Seconds = time.Since(start).Seconds()
+	stopWatch()
+	<-watched
+
+	switch {
+	case err != nil && len(cancelled) > 0:
+		r.finish(t, "cancelled", fmt.Sprintf("waited over -max-wait=%v", r.opts.maxWait))
+	case err != nil:
+		r.finish(t, "failed", err.Error())
+	default:
+		if err := r.pool.QueryRow(context.Background(), "SELECT pg_relation_size(to_regclass($1))", t.Index).Scan(&t.SizeAfter); err != nil {
+			t.Reason = err.Error()
+		}
+		r.finish(t, "rebuilt", t.Reason)
+	}
+	r.leftovers(context.Background(), t)
+}
+
+// watch polls the rebuild's backend until ctx ends, adding up its waits
+// and cancelling it after -max-wait in one stretch.
+func (r *reindexer) watch(ctx context.Context, t *reindexTarget, pid uint32, cancelled chan<- struct{}) {
+	const every = 2 * time.Second
+	var stretch time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(every):
+		}
+		var waiting bool
+		var blockers []int32
+		err := r.pool.QueryRow(ctx, `
+			SELECT coalesce(a.wait_event_type = 'Lock', false)
+			       OR coalesce(p.phase LIKE 'waiting for%', false),
+			       pg_blocking_pids(a.pid)
+			FROM pg_stat_activity a
+			LEFT JOIN pg_stat_progress_create_index p ON p.pid = a.pid
+			WHERE a.pid = $1
+		`, int32(pid)).Scan(&waiting, &blockers)
+		if err != nil {
+			continue
+		}
+		if !waiting {
+			stretch = 0
+			continue
+		}
+		stretch += every
+		r.mu.Lock()
+		t.LockWait += every
+		for _, b := range blockers {
+			if !slices.Contains(t.BlockedBy, b) {
+				t.BlockedBy = append(t.BlockedBy, b)
+			}
+		}
+		r.mu.Unlock()
+		if r.opts.maxWait > 0 && stretch > r.opts.maxWait {
+			cancelled <- struct{}{}
+			if _, err := r.pool.Exec(ctx, "SELECT pg_cancel_backend($1)", int32(pid)); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Cancelling the rebuild of %s: %v\n", t.Index, err)
+			}
+			return
+		}
+	}
+}
+
+// finish records a rebuild's outcome.
+func (r *reindexer) finish(t *reindexTarget, status, reason string) {
+	r.mu.Lock()
+	t.Status, t.Reason = status, reason
+	if status == "failed" || status == "cancelled" {
+		r.report.Failed = true
+	}
+	r.mu.Unlock()
+	if !r.verbose {
+		return
+	}
+	switch status {
+	case "rebuilt":
+		fmt.Fprintf(os.Stderr, "✅ %s: %.1fs, %s → %s\n", t.Index, t.Seconds, formatBytes(t.SizeBefore), formatBytes(t.SizeAfter))
+	default:
+		fmt.Fprintf(os.Stderr, "❌ %s %s after %.1fs: %s\n", t.Index, status, t.Seconds, reason)
+	}
+}
+
+// leftovers finds the INVALID _ccnew/_ccold indexes of t's table and drops
+// them with -drop-invalid.
+func (r *reindexer) leftovers(ctx context.Context, t *reindexTarget) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT i.indexrelid::regclass::text FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+		WHERE i.indrelid = $1 AND NOT i.indisvalid AND c.relname ~ '_cc(new|old)[0-9]*$'
+		ORDER BY 1
+	`, t.tableOID)
+	if err != nil {
+		return
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		if r.opts.dropInvalid {
+			if _, err := r.pool.Exec(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+name); err == nil {
+				r.mu.Lock()
+				t.Dropped = append(t.Dropped, name)
+				r.mu.Unlock()
+				continue
+			}
+		}
+		r.mu.Lock()
+		t.Leftovers = append(t.Leftovers, name)
+		r.report.Failed = true
+		r.mu.Unlock()
+	}
+}
+
+// run rebuilds every planned index with -parallel workers.
+func (r *reindexer) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.worker(ctx)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		r.report.StoppedBy = "interrupt"
+	}
+}
+
+// printReindexReport writes the report for a person.
+func printReindexReport(rep *reindexReport) {
+	var before, after int64
+	fmt.Printf("\n🔁 REINDEX CONCURRENTLY, %d at a time", rep.Parallel)
+	if rep.PauseFor != "" {
+		fmt.Printf(", paused %s", rep.PauseFor)
+	}
+	fmt.Println()
+	fmt.Printf("\n   %-48s %11s %11s %9s %9s  %s\n", "Index", "Before", "After", "Time", "Lock wait", "Status")
+	for _, t := range rep.Targets {
+		sizeAfter, took, wait := "", "", ""
+		if t.Status == "rebuilt" {
+			sizeAfter = formatBytes(t.SizeAfter)
+			before += t.SizeBefore
+			after += t.SizeAfter
+		}
+		if t.Seconds > 0 {
+			took = fmt.Sprintf("%.1fs", t.Seconds)
+		}
+		if t.LockWait > 0 {
+			wait = t.LockWait.String()
+		}
+		status := t.Status
+		if t.Reason != "" && t.Status != "rebuilt" {
+			status += ": " + t.Reason
+		}
+		fmt.Printf("   %-48s %11s %11s %9s %9s  %s\n", t.Index, formatBytes(t.SizeBefore), sizeAfter, took, wait, status)
+		if len(t.BlockedBy) > 0 {
+			fmt.Printf("   %-48s blocked by pids %v\n", "", t.BlockedBy)
+		}
+		for _, l := range t.Dropped {
+			fmt.Printf("   %-48s dropped INVALID leftover %s\n", "", l)
+		}
+		for _, l := range t.Leftovers {
+			fmt.Printf("   ⚠️  INVALID leftover %s: DROP INDEX CONCURRENTLY %s;\n", l, l)
+		}
+	}
+	if !rep.Applied {
+		fmt.Println("\nDry run, -apply to rebuild in this order.")
+		return
+	}
+	if before > 0 {
+		fmt.Printf("\n   Rebuilt: %s → %s (%s reclaimed)\n", formatBytes(before), formatBytes(after), formatBytes(before-after))
+	}
+	if rep.Paused > 0 {
+		fmt.Printf("   Paused for the window: %v\n", rep.Paused.Round(time.Second))
+	}
+	switch {
+	case rep.StoppedBy != "":
+		fmt.Printf("⏹️  Stopped by %s: rerun for the indexes still planned\n", rep.StoppedBy)
+	case rep.Failed:
+		fmt.Println("❌ Some rebuilds failed or left INVALID indexes behind")
+	default:
+		fmt.Println("✅ All rebuilds done")
+	}
+}
+
+// readIndexFile reads index names, one per line; # starts a comment.
+func readIndexFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var names []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, sc.Err()
+}
+
+// Reindex runs the reindex command line tool.
+func Reindex() {
+	var dsn, file, pauseHours, pauseDays, format string
+	var indexes, tables stringList
+	var opts reindexOptions
+	registerDSNFlag(&dsn)
+	flag.Var(&indexes, "index", "Index to rebuild (repeatable)")
+	flag.Var(&tables, "table", "Rebuild every index of this table (repeatable)")
+	flag.StringVar(&file, "file", "", "File with index names, one per line")
+	flag.IntVar(&opts.parallel, "parallel", 2, "Rebuilds at a time (at most one per table)")
+	flag.DurationVar(&opts.maxWait, "max-wait", 10*time.Minute, "Cancel a rebuild waiting on locks or old transactions this long (0: never)")
+	flag.StringVar(&pauseHours, "pause-hours", "", "Start no rebuild in this local time window, e.g. 08:00-18:00")
+	flag.StringVar(&pauseDays, "pause-days", "mon,tue,wed,thu,fri", "Days -pause-hours applies to (empty: every day)")
+	flag.BoolVar(&opts.dropInvalid, "drop-invalid", false, "Drop INVALID _ccnew/_ccold leftovers of failed rebuilds")
+	flag.BoolVar(&opts.apply, "apply", false, "Rebuild (default: dry run)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	opts.indexes, opts.tables = indexes, tables
+	if file != "" {
+		names, err := readIndexFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.indexes = append(opts.indexes, names...)
+	}
+	if len(opts.indexes) == 0 && len(opts.tables) == 0 {
+		log.Fatal("give the indexes with -index, -table or -file")
+	}
+	if opts.parallel < 1 {
+		log.Fatal("-parallel must be at least 1")
+	}
+	if pauseHours != "" {
+		w, err := parsePauseWindow(pauseHours, pauseDays)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.pause = w
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "reindex", int32(opts.parallel)*2+1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	var version int
+	if err := pool.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		log.Fatal(err)
+	}
+	if version < 120000 {
+		log.Fatal("REINDEX CONCURRENTLY needs PostgreSQL 12 or later")
+	}
+
+	r := &reindexer{pool: pool, opts: opts, verbose: format == "text", busy: make(map[uint32]bool),
+		report: reindexReport{Applied: opts.apply, Parallel: opts.parallel}}
+	if opts.pause != nil {
+		r.report.PauseFor = opts.pause.text
+	}
+	if err := r.resolve(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if opts.apply {
+		r.run(ctx)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&r.report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printReindexReport(&r.report)
+	}
+	if r.report.Failed {
+		pool.Close()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,303 @@
+package dbre
+
+// ============================================================================
+// REPLICATION LAG DAEMON (cmd/replag)
+// ============================================================================
+//
+// Replaces the per-cluster bash loops around pg_stat_replication. Every
+// -interval replag polls:
+//   the primary (-dsn)         pg_stat_replication: for each standby the
+//                              bytes between the current WAL position and
+//                              what it was sent, wrote, flushed and
+//                              replayed, and write/flush/replay_lag
+//   each replica (-replica-dsn) received but not yet replayed WAL, and
+//                              how far behind the last replayed commit is
+//                              (0 while it has replayed everything: an idle
+//                              primary isn't lag)
+// and serves them on -metrics-addr:
+//   dbre_replag_lag_bytes{replica,stage}      stage: sent, write, flush, replay
+//   dbre_replag_lag_seconds{replica,stage}    stage: write, flush, replay
+//   dbre_replag_connected{replica}            0 once a standby seen earlier
+//                                             is gone from pg_stat_replication
+//   dbre_replag_replica_replay_lag_bytes{replica}
+//   dbre_replag_replica_replay_lag_seconds{replica}
+//   dbre_replag_up{server}                    1 if the last poll worked
+// An alert (see alert.go) fires when a standby's replay lag passes
+// -max-lag-bytes or -max-lag, when it disconnects, when a replica can't be
+// reached or is no longer in recovery (promoted), and resolves when that
+// ends. Standbys are named by application_name (primary_conninfo), else
+// their address.
+//
+// -once prints the current lag and exits with status 2 if a threshold is
+// crossed, for cron or a pre-maintenance check.
+//
+//   go run ./cmd/replag -dsn=postgres://dbre@db1/postgres -replica-dsn=postgres://dbre@db2/postgres \
+//     -max-lag-bytes=1GB -max-lag=30s -alert-webhook=https://hooks.slack.com/services/...
+//   go run ./cmd/replag -once
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// standbyLag is one row of pg_stat_replication.
+type standbyLag struct {
+	name, state, syncState        string
+	sent, write, flush, replay    float64 // Bytes behind the primary
+	writeLag, flushLag, replayLag float64 // Seconds
+}
+
+// replicaLag is what a replica reports about itself.
+type replicaLag struct {
+	inRecovery bool
+	bytes      float64
+	seconds    float64
+}
+
+// replagMetrics are the gauges replag serves.
+type replagMetrics struct {
+	lagBytes, lagSeconds, connected *prometheus.GaugeVec
+	replicaBytes, replicaSeconds    *prometheus.GaugeVec
+	up                              *prometheus.GaugeVec
+}
+
+func newReplagMetrics() *replagMetrics {
+	gauge := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_replag_" + name, Help: help}, labels)
+	}
+	return &replagMetrics{
+		lagBytes:       gauge("lag_bytes", "WAL bytes a standby is behind the primary, per stage.", "replica", "stage"),
+		lagSeconds:     gauge("lag_seconds", "Seconds a standby is behind the primary, per stage.", "replica", "stage"),
+		connected:      gauge("connected", "1 while the standby is in pg_stat_replication.", "replica"),
+		replicaBytes:   gauge("replica_replay_lag_bytes", "WAL received by the replica but not yet replayed.", "replica"),
+		replicaSeconds: gauge("replica_replay_lag_seconds", "Age of the last replayed commit while WAL is pending.", "replica"),
+		up:             gauge("up", "1 if the last poll of the server worked.", "server"),
+	}
+}
+
+func (m *replagMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.lagBytes, m.lagSeconds, m.connected, m.replicaBytes, m.replicaSeconds, m.up}
+}
+
+// readStandbys reads pg_stat_replication on the primary.
+func readStandbys(ctx context.Context, pool *pgxpool.Pool) ([]standbyLag, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT coalesce(nullif(application_name, ''), client_addr::text, 'pid ' || pid), coalesce(state, ''),
+		       coalesce(sync_state, ''),
+		       coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), sent_lsn), 0)::float8,
+		       coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), write_lsn), 0)::float8,
+		       coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), flush_lsn), 0)::float8,
+		       coalesce(pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn), 0)::float8,
+		       -- NULL once the standby caught up and the primary is idle
+		       coalesce(extract(epoch FROM write_lag), 0)::float8,
+		       coalesce(extract(epoch FROM flush_lag), 0)::float8,
+		       coalesce(extract(epoch FROM replay_lag), 0)::float8
+		FROM pg_stat_replication
+		ORDER BY 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (standbyLag, error) {
+		var s standbyLag
+		err := row.Scan(&s.name, &s.state, &s.syncState, &s.sent, &s.write, &s.flush, &s.replay,
+			&s.writeLag, &s.flushLag, &s.replayLag)
+		return s, err
+	})
+}
+
+// readReplica reads a replica's own view of its replay lag.
+func readReplica(ctx context.Context, pool *pgxpool.Pool) (replicaLag, error) {
+	var r replicaLag
+	err := pool.QueryRow(ctx, `
+		SELECT pg_is_in_recovery(),
+		       coalesce(pg_wal_lsn_diff(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn()), 0)::float8,
+		       CASE WHEN pg_last_wal_receive_lsn() IS DISTINCT FROM pg_last_wal_replay_lsn()
+		            THEN coalesce(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+		            ELSE 0 END::float8
+	`).Scan(&r.inRecovery, &r.bytes, &r.seconds)
+	return r, err
+}
+
+// replagOptions are the flags of replag.
+type replagOptions struct {
+	maxBytes int64
+	maxLag   time.Duration
+}
+
+// replagPoller keeps the state between polls.
+type replagPoller struct {
+	opts     replagOptions
+	primary  *pgxpool.Pool
+	replicas map[string]*pgxpool.Pool
+	metrics  *replagMetrics
+	alerts   *alerter
+	seen     map[string]bool // Standbys seen in pg_stat_replication
+	verbose  bool
+}
+
+// poll reads the primary and every replica once and updates metrics and
+// alerts.
+func (p *replagPoller) poll(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	primary := describeTarget(p.primary.Config())
+	standbys, err := readStandbys(ctx, p.primary)
+	p.metrics.up.WithLabelValues(primary).Set(boolGauge(err == nil))
+	p.alerts.update("replag:primary", err != nil, pollMessage("primary", primary, err))
+	if err == nil {
+		present := map[string]bool{}
+		for _, s := range standbys {
+			present[s.name] = true
+			p.seen[s.name] = true
+			p.report(s)
+		}
+		for name := range p.seen {
+			p.metrics.connected.WithLabelValues(name).Set(boolGauge(present[name]))
+			p.alerts.update("replag:disconnected:"+name, !present[name],
+				fmt.Sprintf("standby %s is not connected to %s", name, primary))
+		}
+		if p.verbose && len(standbys) == 0 {
+			fmt.Printf("%s has no standbys connected\n", primary)
+		}
+	}
+
+	for name, pool := range p.replicas {
+		r, err := readReplica(ctx, pool)
+		p.metrics.up.WithLabelValues(name).Set(boolGauge(err == nil))
+		p.alerts.update("replag:unreachable:"+name, err != nil, pollMessage("replica", name, err))
+		if err != nil {
+			continue
+		}
+		p.alerts.update("replag:promoted:"+name, !r.inRecovery, fmt.Sprintf("replica %s is not in recovery (promoted?)", name))
+		p.metrics.replicaBytes.WithLabelValues(name).Set(r.bytes)
+		p.metrics.replicaSeconds.WithLabelValues(name).Set(r.seconds)
+		p.check("replag:replica:"+name, "replay lag of replica "+name, r.bytes, r.seconds)
+		if p.verbose {
+			fmt.Printf("   %-30s replica view: %10s unreplayed, %6.1fs behind, in recovery: %t\n",
+				name, formatBytes(int64(r.bytes)), r.seconds, r.inRecovery)
+		}
+	}
+}
+
+// report sets a standby's metrics and checks its replay lag.
+func (p *replagPoller) report(s standbyLag) {
+	for stage, v := range map[string]float64{"sent": s.sent, "write": s.write, "flush": s.flush, "replay": s.replay} {
+		p.metrics.lagBytes.WithLabelValues(s.name, stage).Set(v)
+	}
+	for stage, v := range map[string]float64{"write": s.writeLag, "flush": s.flushLag, "replay": s.replayLag} {
+		p.metrics.lagSeconds.WithLabelValues(s.name, stage).Set(v)
+	}
+	p.check("replag:"+s.name, "replay lag of "+s.name, s.replay, s.replayLag)
+	if p.verbose {
+		fmt.Printf("   %-30s %-10s %-6s sent %10s  flushed %10s  replayed %10s behind, replay lag %.1fs\n",
+			s.name, s.state, s.syncState, formatBytes(int64(s.sent)), formatBytes(int64(s.flush)),
+			formatBytes(int64(s.replay)), s.replayLag)
+	}
+}
+
+// check raises the lag alert key if bytes or seconds are over the limits.
+func (p *replagPoller) check(key, what string, bytes, seconds float64) {
+	overBytes := p.opts.maxBytes > 0 && bytes > float64(p.opts.maxBytes)
+	overTime := p.opts.maxLag > 0 && seconds > p.opts.maxLag.Seconds()
+	msg := fmt.Sprintf("%s is %s, %.1fs", what, formatBytes(int64(bytes)), seconds)
+	if overBytes || overTime {
+		msg += fmt.Sprintf(" (limits %s, %v)", formatBytes(p.opts.maxBytes), p.opts.maxLag)
+	}
+	p.alerts.update(key, overBytes || overTime, msg)
+}
+
+// pollMessage describes a failed poll, or its recovery.
+func pollMessage(role, server string, err error) string {
+	if err != nil {
+		return fmt.Sprintf("%s %s: %v", role, server, err)
+	}
+	return fmt.Sprintf("%s %s answers again", role, server)
+}
+
+// Replag runs the replag command line tool.
+func Replag() {
+	var dsn, maxBytes, metricsAddr string
+	var replicaDSNs stringList
+	var interval time.Duration
+	var once bool
+	var opts replagOptions
+	alerts := &alerter{}
+	registerDSNFlag(&dsn)
+	flag.Var(&replicaDSNs, "replica-dsn", "Replica to poll for its own replay lag (repeatable)")
+	flag.DurationVar(&interval, "interval", 10*time.Second, "Poll interval")
+	flag.StringVar(&maxBytes, "max-lag-bytes", "1GB", "Alert when replay lag exceeds this many bytes (0: off)")
+	flag.DurationVar(&opts.maxLag, "max-lag", 60*time.Second, "Alert when replay lag exceeds this long (0: off)")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":9188", "Serve Prometheus metrics here (empty: off)")
+	flag.BoolVar(&once, "once", false, "Print the lag once and exit, with status 2 over a threshold")
+	registerAlertFlags(alerts)
+	flag.Parse()
+
+	var err error
+	if opts.maxBytes, err = parseByteSize(maxBytes); err != nil {
+		log.Fatalf("-max-lag-bytes: %v", err)
+	}
+	if interval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	primary, err := connect(ctx, dsn, "replag", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer primary.Close()
+	p := &replagPoller{
+		opts:     opts,
+		primary:  primary,
+		replicas: map[string]*pgxpool.Pool{},
+		metrics:  newReplagMetrics(),
+		alerts:   alerts,
+		seen:     map[string]bool{},
+		verbose:  once,
+	}
+	for _, r := range replicaDSNs {
+		pool, err := connect(ctx, r, "replag", 1)
+		if err != nil {
+			log.Fatalf("-replica-dsn: %v", err)
+		}
+		defer pool.Close()
+		p.replicas[describeTarget(pool.Config())] = pool
+	}
+
+	if once {
+		fmt.Printf("Replication lag on %s:\n", describeTarget(primary.Config()))
+		p.poll(ctx)
+		if alerts.active() {
+			stop()
+			os.Exit(2)
+		}
+		return
+	}
+
+	if metricsAddr != "" {
+		serveMetrics(metricsAddr, p.metrics.collectors()...)
+	}
+	fmt.Printf("📈 Watching replication from %s and %d replica(s) every %v\n",
+		describeTarget(primary.Config()), len(p.replicas), interval)
+	for {
+		p.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
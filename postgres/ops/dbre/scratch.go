@@ -0,0 +1,534 @@
+package dbre
+
+// ============================================================================
+// SCRATCH INSTANCES (backup-verify, upgrade-drill)
+// ============================================================================
+//
+// A scratch server is a throwaway PostgreSQL instance on this host, in a
+// directory the tool owns:
+//   <dir>/.dbre-scratch   marker: only a directory holding it is ever wiped
+//   <dir>/data            the restored data directory (upgrade-drill adds
+//                         data-<major> for the upgraded cluster)
+//   <dir>/restore.log     output of the restore, pg_ctl, pg_upgrade, ...
+//   <dir>/postgres.log    the server log
+// Its data comes from restore.command (pgBackRest, wal-g, ... with
+// {data_dir} and {target_time} filled in), the latest base backup under
+// restore.backup_dir (a plain pg_basebackup copy or its tar format), or a
+// pg_basebackup clone of restore.clone_dsn. It listens only on a socket
+// in <dir>, doesn't archive or replicate, replays WAL with
+// restore.restore_command up to restore.target_time, and promotes.
+//
+// Every step of a drill is timed (runStep) for the tool's report.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// restoreSpec says where a scratch server's data comes from.
+type restoreSpec struct {
+	BackupDir      string `yaml:"backup_dir,omitempty"`      // Base backups (pg_basebackup -D or -Ft)
+	Command        string `yaml:"command,omitempty"`         // Or a restore command, run with sh -c
+	CloneDSN       string `yaml:"clone_dsn,omitempty"`       // Or clone a running cluster with pg_basebackup
+	RestoreCommand string `yaml:"restore_command,omitempty"` // WAL fetch during recovery, e.g. cp /archive/%f %p
+	TargetTime     string `yaml:"target_time,omitempty"`     // recovery_target_time; empty: all WAL there is
+}
+
+// validate checks exactly one source is set.
+func (r restoreSpec) validate() error {
+	sources := 0
+	for _, s := range []string{r.BackupDir, r.Command, r.CloneDSN} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("set one of restore.backup_dir, restore.command and restore.clone_dsn")
+	}
+	return nil
+}
+
+// scratchSpec is where and how a scratch server runs.
+type scratchSpec struct {
+	Dir      string            `yaml:"dir"`
+	Port     int               `yaml:"port"`
+	BinDir   string            `yaml:"bin_dir,omitempty"` // Empty: pg_ctl from PATH
+	User     string            `yaml:"user"`              // Database role to connect as
+	Timeout  time.Duration     `yaml:"timeout"`           // Start and WAL replay
+	Keep     bool              `yaml:"keep"`
+	Settings map[string]string `yaml:"settings,omitempty"` // Extra postgresql.conf settings
+}
+
+// defaultScratchSpec is scratchSpec before the configuration file.
+func defaultScratchSpec() scratchSpec {
+	return scratchSpec{Port: 55432, User: "postgres", Timeout: time.Hour}
+}
+
+// verifyStep is one timed step of a drill.
+type verifyStep struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	OK      bool    `json:"ok"`
+	Detail  string  `json:"detail,omitempty"`
+}
+
+// runStep runs fn as the step name, appends it to steps and reports
+// progress on stderr; false when it failed.
+func runStep(steps *[]verifyStep, name string, fn func() (string, error)) bool {
+	fmt.Fprintf(os.Stderr, "⏱️  %s...\n", name)
+	start := time.Now()
+	detail, err := fn()
+	s := verifyStep{Name: name, Seconds: time.Since(start).Seconds(), OK: err == nil, Detail: detail}
+	if err != nil {
+		s.Detail = err.Error()
+		fmt.Fprintf(os.Stderr, "❌ %s failed after %s: %v\n", name, formatStepTime(s.Seconds), err)
+	} else {
+		fmt.Fprintf(os.Stderr, "✅ %s: %s %s\n", name, formatStepTime(s.Seconds), detail)
+	}
+	*steps = append(*steps, s)
+	return err == nil
+}
+
+// formatStepTime renders a step's duration, e.g. "12m3.4s".
+func formatStepTime(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(100 * time.Millisecond).String()
+}
+
+// printSteps writes the steps of a drill for a person.
+func printSteps(steps []verifyStep) {
+	for _, s := range steps {
+		mark := "✅"
+		if !s.OK {
+			mark = "❌"
+		}
+		fmt.Printf("   %s %-14s %10s  %s\n", mark, s.Name, formatStepTime(s.Seconds), s.Detail)
+	}
+}
+
+// scratchServer is one scratch instance.
+type scratchServer struct {
+	restore  restoreSpec
+	spec     scratchSpec
+	binDir   string   // Binaries of the cluster in dataDir
+	dataDir  string   // The cluster pg_ctl runs
+	dirs     []string // Data directories to remove at the end
+	prepared bool     // spec.Dir is ours to wipe
+	running  bool
+	startLSN uint64
+
+	backup        string     // What was restored
+	recoveredTo   *time.Time // Last replayed transaction
+	replayedBytes int64
+}
+
+func newScratchServer(restore restoreSpec, spec scratchSpec) *scratchServer {
+	data := filepath.Join(spec.Dir, "data")
+	return &scratchServer{restore: restore, spec: spec, binDir: spec.BinDir, dataDir: data, dirs: []string{data}}
+}
+
+// logPath is the log of the commands run for the server.
+func (s *scratchServer) logPath() string { return filepath.Join(s.spec.Dir, "restore.log") }
+
+// serverLog is the server's own log.
+func (s *scratchServer) serverLog() string { return filepath.Join(s.spec.Dir, "postgres.log") }
+
+// bin returns the path of a PostgreSQL program of the running version.
+func (s *scratchServer) bin(name string) string {
+	if s.binDir != "" {
+		return filepath.Join(s.binDir, name)
+	}
+	return name
+}
+
+// prepare empties the scratch directory.
+func (s *scratchServer) prepare() (string, error) {
+	dir := s.spec.Dir
+	marker := filepath.Join(dir, ".dbre-scratch")
+	entries, err := os.ReadDir(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", err
+	case len(entries) > 0:
+		if _, err := os.Stat(marker); err != nil {
+			return "", fmt.Errorf("%s is not empty and is not a scratch directory; refusing to wipe it", dir)
+		}
+	}
+	pids, _ := filepath.Glob(filepath.Join(dir, "data*", "postmaster.pid"))
+	if len(pids) > 0 {
+		data := filepath.Dir(pids[0])
+		return "", fmt.Errorf("%s has a postmaster.pid: stop that server (pg_ctl -D %s stop) first", data, data)
+	}
+	if err := os.WriteFile(marker, nil, 0o600); err != nil {
+		return "", err
+	}
+	s.prepared = true
+	old, _ := filepath.Glob(filepath.Join(dir, "data*"))
+	for _, d := range old {
+		if err := os.RemoveAll(d); err != nil {
+			return "", err
+		}
+	}
+	for _, f := range []string{s.logPath(), s.serverLog()} {
+		os.Remove(f)
+	}
+	return s.dataDir, os.Mkdir(s.dataDir, 0o700)
+}
+
+// latestBaseBackup returns dir if it is a base backup, else its newest
+// subdirectory that is one.
+func latestBaseBackup(dir string) (string, error) {
+	isBackup := func(d string) bool {
+		if _, err := os.Stat(filepath.Join(d, "backup_label")); err == nil {
+			return true
+		}
+		matches, _ := filepath.Glob(filepath.Join(d, "base.tar*"))
+		return len(matches) > 0
+	}
+	if isBackup(dir) {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	var newestTime time.Time
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		info, err := e.Info()
+		if err != nil || !e.IsDir() || !isBackup(path) {
+			continue
+		}
+		if newest == "" || info.ModTime().After(newestTime) {
+			newest, newestTime = path, info.ModTime()
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no base backup (backup_label or base.tar) in %s", dir)
+	}
+	return newest, nil
+}
+
+// runLogged runs cmd, appending its output to logPath.
+func runLogged(cmd *exec.Cmd, logPath string) error {
+	out, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	fmt.Fprintf(out, "\n$ %s\n", strings.Join(redactArgs(cmd.Args), " "))
+	var tail bytes.Buffer
+	cmd.Stdout = io.MultiWriter(out, &tail)
+	cmd.Stderr = io.MultiWriter(out, &tail)
+	name := filepath.Base(cmd.Args[0])
+	if err := cmd.Run(); err != nil {
+		if tail.Len() == 0 {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return fmt.Errorf("%s: %w: %s (see %s)", name, err, lastLines(tail.String(), 3), logPath)
+	}
+	return nil
+}
+
+// redactArgs hides connection strings, which may hold a password.
+func redactArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "--dbname=") {
+			arg = "--dbname=…"
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// lastLines returns the last n lines of s on one line.
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.Join(lines[max(0, len(lines)-n):], " | ")
+}
+
+// lastLogLines returns the end of a server log.
+func lastLogLines(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "no server log"
+	}
+	return lastLines(string(data), 3)
+}
+
+// restoreData fills the data directory.
+func (s *scratchServer) restoreData(ctx context.Context) (string, error) {
+	r := s.restore
+	switch {
+	case r.Command != "":
+		command := strings.NewReplacer("{data_dir}", s.dataDir, "{target_time}", r.TargetTime).Replace(r.Command)
+		s.backup = command
+		return "", runLogged(exec.CommandContext(ctx, "sh", "-c", command), s.logPath())
+	case r.CloneDSN != "":
+		s.backup = "pg_basebackup of " + redactDSN(r.CloneDSN)
+		return s.backup, runLogged(exec.CommandContext(ctx, s.bin("pg_basebackup"), "-D", s.dataDir,
+			"-X", "stream", "-c", "fast", "--no-sync", "--dbname="+r.CloneDSN), s.logPath())
+	}
+
+	backup, err := latestBaseBackup(r.BackupDir)
+	if err != nil {
+		return "", err
+	}
+	s.backup = backup
+	tars, _ := filepath.Glob(filepath.Join(backup, "base.tar*"))
+	if len(tars) == 0 {
+		return backup, runLogged(exec.CommandContext(ctx, "cp", "-a", backup+"/.", s.dataDir), s.logPath())
+	}
+	if err := runLogged(exec.CommandContext(ctx, "tar", "-xf", tars[0], "-C", s.dataDir), s.logPath()); err != nil {
+		return "", err
+	}
+	if wal, _ := filepath.Glob(filepath.Join(backup, "pg_wal.tar*")); len(wal) > 0 {
+		walDir := filepath.Join(s.dataDir, "pg_wal")
+		if err := os.MkdirAll(walDir, 0o700); err != nil {
+			return "", err
+		}
+		if err := runLogged(exec.CommandContext(ctx, "tar", "-xf", wal[0], "-C", walDir), s.logPath()); err != nil {
+			return "", err
+		}
+	}
+	return backup, nil
+}
+
+// redactDSN drops the password of a connection string.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		u.User = url.User(u.User.Username())
+		return u.String()
+	}
+	return dsnPasswordRe.ReplaceAllString(dsn, "password=…")
+}
+
+var (
+	dsnPasswordRe = regexp.MustCompile(`password=('(?:[^'\\]|\\.)*'|\S+)`)
+	backupStartRe = regexp.MustCompile(`(?m)^START WAL LOCATION: ([0-9A-F]+/[0-9A-F]+)`)
+)
+
+// quoteSetting quotes a postgresql.conf value.
+func quoteSetting(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// writeSettings appends the scratch settings and extra to the
+// postgresql.auto.conf of dataDir.
+func (s *scratchServer) writeSettings(dataDir string, extra ...[2]string) error {
+	settings := [][2]string{
+		{"port", strconv.Itoa(s.spec.Port)},
+		{"listen_addresses", ""},
+		{"unix_socket_directories", s.spec.Dir},
+		{"logging_collector", "off"},
+		{"archive_mode", "off"},
+	}
+	settings = append(settings, extra...)
+	for name, value := range s.spec.Settings {
+		settings = append(settings, [2]string{name, value})
+	}
+	var b strings.Builder
+	b.WriteString("\n# dbre scratch instance\n")
+	for _, kv := range settings {
+		fmt.Fprintf(&b, "%s = %s\n", kv[0], quoteSetting(kv[1]))
+	}
+	f, err := os.OpenFile(filepath.Join(dataDir, "postgresql.auto.conf"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// configure sets the restored data directory up to recover and promote.
+func (s *scratchServer) configure() (string, error) {
+	for _, dir := range []string{"pg_wal", "pg_wal/archive_status"} {
+		if err := os.MkdirAll(filepath.Join(s.dataDir, dir), 0o700); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Chmod(s.dataDir, 0o700); err != nil {
+		return "", err
+	}
+	// The restore may leave standby.signal (a backup of a replica); the
+	// scratch server must promote, so it only gets recovery.signal.
+	os.Remove(filepath.Join(s.dataDir, "standby.signal"))
+	if err := os.WriteFile(filepath.Join(s.dataDir, "recovery.signal"), nil, 0o600); err != nil {
+		return "", err
+	}
+	if label, err := os.ReadFile(filepath.Join(s.dataDir, "backup_label")); err == nil {
+		if m := backupStartRe.FindSubmatch(label); m != nil {
+			s.startLSN, _ = parseLSN(string(m[1]))
+		}
+	}
+
+	recovery := [][2]string{
+		{"primary_conninfo", ""},
+		{"primary_slot_name", ""},
+		{"hot_standby", "on"},
+		{"recovery_target_action", "promote"},
+	}
+	if r := s.restore; r.RestoreCommand != "" {
+		recovery = append(recovery, [2]string{"restore_command", r.RestoreCommand})
+	}
+	if t := s.restore.TargetTime; t != "" {
+		recovery = append(recovery, [2]string{"recovery_target_time", t})
+	}
+	if err := s.writeSettings(s.dataDir, recovery...); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("port %d, socket in %s", s.spec.Port, s.spec.Dir), nil
+}
+
+// start starts the server on dataDir; -w returns once it accepts
+// connections (in recovery: at a consistent state).
+func (s *scratchServer) start(ctx context.Context) error {
+	err := runLogged(exec.CommandContext(ctx, s.bin("pg_ctl"), "start", "-D", s.dataDir, "-l", s.serverLog(),
+		"-w", "-t", strconv.Itoa(int(s.spec.Timeout.Seconds()))), s.logPath())
+	if _, statErr := os.Stat(filepath.Join(s.dataDir, "postmaster.pid")); statErr == nil {
+		s.running = true
+	}
+	if err != nil {
+		if _, statErr := os.Stat(s.serverLog()); statErr != nil {
+			return err
+		}
+		return fmt.Errorf("server did not start: %s (see %s)", lastLogLines(s.serverLog()), s.serverLog())
+	}
+	return nil
+}
+
+// stop stops the server.
+func (s *scratchServer) stop() error {
+	if !s.running {
+		return nil
+	}
+	err := runLogged(exec.Command(s.bin("pg_ctl"), "stop", "-D", s.dataDir, "-m", "fast", "-w"), s.logPath())
+	if err == nil {
+		s.running = false
+	}
+	return err
+}
+
+// recoverWAL starts the server and waits until it promotes.
+func (s *scratchServer) recoverWAL(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.spec.Timeout)
+	defer cancel()
+	if err := s.start(ctx); err != nil {
+		return "", err
+	}
+	pool, err := connect(ctx, s.dsn(""), "scratch", 1)
+	if err != nil {
+		return "", err
+	}
+	defer pool.Close()
+	timedOut := fmt.Errorf("still replaying WAL after %s (scratch.timeout)", s.spec.Timeout)
+	for {
+		var inRecovery bool
+		var replayed *time.Time
+		err := pool.QueryRow(ctx, `SELECT pg_is_in_recovery(), pg_last_xact_replay_timestamp()`).Scan(&inRecovery, &replayed)
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return "", timedOut
+			}
+			return "", fmt.Errorf("%w: %s (see %s)", err, lastLogLines(s.serverLog()), s.serverLog())
+		}
+		if replayed != nil {
+			s.recoveredTo = replayed
+		}
+		if !inRecovery {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return "", timedOut
+			}
+			return "", ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	var lsn string
+	if err := pool.QueryRow(ctx, `SELECT pg_current_wal_lsn()::text`).Scan(&lsn); err == nil && s.startLSN > 0 {
+		if end, err := parseLSN(lsn); err == nil && end > s.startLSN {
+			s.replayedBytes = int64(end - s.startLSN)
+		}
+	}
+	detail := "promoted"
+	if s.recoveredTo != nil {
+		detail += ", recovered to " + s.recoveredTo.Format(time.RFC3339)
+	}
+	if s.replayedBytes > 0 {
+		detail += ", " + formatBytes(s.replayedBytes) + " of WAL"
+	}
+	return detail, nil
+}
+
+// cleanup stops the server and removes the data directories.
+func (s *scratchServer) cleanup() (string, error) {
+	if !s.prepared {
+		return "nothing to clean up", nil
+	}
+	if err := s.stop(); err != nil {
+		return "", err
+	}
+	if s.spec.Keep {
+		return "kept " + strings.Join(s.dirs, ", "), nil
+	}
+	for _, d := range s.dirs {
+		if err := os.RemoveAll(d); err != nil {
+			return "", err
+		}
+	}
+	return "removed " + strings.Join(s.dirs, ", "), nil
+}
+
+// dsn connects to database on the scratch server, with extra
+// key=value parameters.
+func (s *scratchServer) dsn(database string, params ...string) string {
+	if database == "" {
+		database = "postgres"
+	}
+	dsn := fmt.Sprintf("host=%s port=%d user=%s dbname=%s", quoteDSNValue(s.spec.Dir), s.spec.Port,
+		quoteDSNValue(s.spec.User), quoteDSNValue(database))
+	return strings.Join(append([]string{dsn}, params...), " ")
+}
+
+// quoteDSNValue quotes a value of a key=value connection string.
+func quoteDSNValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// withDatabase points a connection string at another database.
+func withDatabase(dsn, database string) string {
+	if database == "" {
+		return dsn
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			u.Path = "/" + database
+			return u.String()
+		}
+	}
+	// The last dbname in key=value form wins.
+	return dsn + " dbname=" + quoteDSNValue(database)
+}
@@ -0,0 +1,381 @@
+package dbre
+
+// ============================================================================
+// SEQUENCE EXHAUSTION (cmd/sequences)
+// ============================================================================
+//
+// A serial primary key stops accepting inserts when its sequence reaches
+// the sequence's maximum, or earlier, when the column is narrower than the
+// sequence: the classic is an integer id fed by a bigint sequence, which
+// fails at 2,147,483,647 whatever the sequence allows. sequences checks
+// every sequence of the connected database:
+//   limit       the sequence's max_value (min_value when it counts down),
+//               capped by the range of every integer column it feeds:
+//               owned columns (serial, identity) and columns whose DEFAULT
+//               calls nextval() on it
+//   consumed    how far last_value has gone from start_value to the limit
+//   projection  the consumption rate and the time and date it runs out
+// The rate is measured from last_value (read without calling nextval) over
+// -sample, or, with -state-file, since the previous run, as wraparound does.
+// Values are handed out in blocks of the sequence's CACHE, so short
+// samples of slow sequences read 0 or a burst. CYCLE sequences don't run
+// out and are not alerted on; sequences never called (or not readable by
+// this role) have no last_value and are listed as unused.
+//
+// Exit status follows the Nagios convention: 0 OK, 1 WARNING, 2 CRITICAL,
+// 3 UNKNOWN (could not check). WARNING when a sequence is past -warning
+// percent consumed or projected to run out within -warning-within;
+// CRITICAL likewise with -critical and -critical-within. Widening a column
+// to bigint rewrites the table, so the defaults leave months to plan it.
+//
+//   go run ./cmd/sequences
+//   go run ./cmd/sequences -state-file=/var/tmp/sequences.db1.json -warning-within=2160h
+//   0 * * * * sequences -dsn=... -state-file=... || page-oncall
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// integerRange is the largest value of each integer column type.
+var integerRange = map[string]int64{"smallint": math.MaxInt16, "integer": math.MaxInt32, "bigint": math.MaxInt64}
+
+// sequenceColumn is a column a sequence feeds.
+type sequenceColumn struct {
+	Name  string `json:"column"` // schema.table.column
+	Type  string `json:"type"`
+	Owned bool   `json:"owned"` // serial or identity, rather than a DEFAULT nextval()
+}
+
+// sequenceUsage is one sequence and how close it is to running out.
+type sequenceUsage struct {
+	Name      string           `json:"sequence"`
+	Type      string           `json:"type"`
+	Start     int64            `json:"start_value"`
+	Increment int64            `json:"increment_by"`
+	Cycle     bool             `json:"cycle"`
+	LastValue *int64           `json:"last_value"`
+	Limit     int64            `json:"limit"`
+	LimitBy   string           `json:"limited_by"` // The sequence, or the narrowest column
+	Columns   []sequenceColumn `json:"columns,omitempty"`
+	PctUsed   float64          `json:"pct_consumed"`
+	Remaining int64            `json:"remaining"` // Values left, in increments
+	PerSecond float64          `json:"values_per_second"`
+	ToEmpty   float64          `json:"seconds_to_exhaustion,omitempty"`
+	EmptyAt   *time.Time       `json:"exhaustion_date,omitempty"`
+	Status    string           `json:"status"`
+
+	minValue, maxValue int64
+}
+
+// sequenceReport is what the check found.
+type sequenceReport struct {
+	Database  string           `json:"database"`
+	Sampled   float64          `json:"rate_over_seconds"`
+	Sequences []*sequenceUsage `json:"sequences"`
+	Unused    []string         `json:"unused,omitempty"`
+	Status    string           `json:"status"`
+}
+
+// sequenceState is what -state-file keeps between runs.
+type sequenceState struct {
+	Time   time.Time        `json:"time"`
+	Values map[string]int64 `json:"last_values"`
+}
+
+// readSequences reads every sequence with the columns it feeds.
+func readSequences(ctx context.Context, pool *pgxpool.Pool) (string, []*sequenceUsage, error) {
+	var database string
+	if err := pool.QueryRow(ctx, "SELECT current_database()::text").Scan(&database); err != nil {
+		return "", nil, err
+	}
+	rows, err := pool.Query(ctx, `
+		SELECT format('%I.%I', s.schemaname, s.sequencename), s.data_type::text, s.start_value,
+		       s.min_value, s.max_value, s.increment_by, s.cycle, s.last_value,
+		       CASE WHEN a.attname IS NOT NULL THEN format('%I.%I.%I', n.nspname, c.relname, a.attname) END,
+		       format_type(a.atttypid, NULL),
+		       coalesce(d.deptype IN ('a', 'i'), false)
+		FROM pg_sequences s
+		CROSS JOIN LATERAL (SELECT format('%I.%I', s.schemaname, s.sequencename)::regclass AS oid) q
+		LEFT JOIN LATERAL (
+			-- Owned: serial (auto) and identity (internal) dependencies.
+			SELECT d.refobjid, d.refobjsubid, d.deptype
+			FROM pg_depend d
+			WHERE d.classid = 'pg_class'::regclass AND d.objid = q.oid
+			  AND d.refclassid = 'pg_class'::regclass AND d.refobjsubid > 0 AND d.deptype IN ('a', 'i')
+			UNION
+			-- DEFAULT nextval('seq') on any column.
+			SELECT ad.adrelid, ad.adnum, 'n'
+			FROM pg_depend d
+			JOIN pg_attrdef ad ON ad.oid = d.objid
+			WHERE d.classid = 'pg_attrdef'::regclass AND d.refclassid = 'pg_class'::regclass AND d.refobjid = q.oid
+		) d ON true
+		LEFT JOIN pg_class c ON c.oid = d.refobjid
+		LEFT JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		ORDER BY 1, 9
+	`)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read sequences: %w", err)
+	}
+	var sequences []*sequenceUsage
+	var seq sequenceUsage
+	var lastValue *int64
+	var column, columnType *string
+	var owned bool
+	_, err = pgx.ForEachRow(rows, []any{&seq.Name, &seq.Type, &seq.Start, &seq.minValue, &seq.maxValue,
+		&seq.Increment, &seq.Cycle, &lastValue, &column, &columnType, &owned}, func() error {
+		if len(sequences) == 0 || sequences[len(sequences)-1].Name != seq.Name {
+			s := seq
+			if lastValue != nil {
+				v := *lastValue
+				s.LastValue = &v
+			}
+			sequences = append(sequences, &s)
+		}
+		if column != nil && columnType != nil {
+			s := sequences[len(sequences)-1]
+			s.Columns = append(s.Columns, sequenceColumn{Name: *column, Type: *columnType, Owned: owned})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read sequences: %w", err)
+	}
+	for _, s := range sequences {
+		s.limit()
+	}
+	return database, sequences, nil
+}
+
+// limit sets the value the sequence can't go past and what sets it.
+func (s *sequenceUsage) limit() {
+	up := s.Increment > 0
+	if up {
+		s.Limit, s.LimitBy = s.maxValue, "sequence max_value"
+	} else {
+		s.Limit, s.LimitBy = s.minValue, "sequence min_value"
+	}
+	for _, c := range s.Columns {
+		r, ok := integerRange[c.Type]
+		if !ok {
+			continue
+		}
+		if up && r < s.Limit {
+			s.Limit, s.LimitBy = r, fmt.Sprintf("%s %s", c.Name, c.Type)
+		}
+		if !up && -r-1 > s.Limit {
+			s.Limit, s.LimitBy = -r-1, fmt.Sprintf("%s %s", c.Name, c.Type)
+		}
+	}
+}
+
+// sequenceOptions are the thresholds of sequences.
+type sequenceOptions struct {
+	warning, critical             float64
+	warningWithin, criticalWithin time.Duration
+}
+
+// assess computes consumption and projection for each sequence from the
+// previous readings and sets the statuses; it returns the exit code.
+func (r *sequenceReport) assess(prev map[string]int64, elapsed time.Duration, opts sequenceOptions) int {
+	now := time.Now()
+	worst := exitOK
+	r.Sampled = elapsed.Seconds()
+	used := r.Sequences[:0]
+	for _, s := range r.Sequences {
+		if s.LastValue == nil {
+			r.Unused = append(r.Unused, s.Name)
+			continue
+		}
+		last := *s.LastValue
+		span := float64(s.Limit) - float64(s.Start)
+		s.Remaining = int64((float64(s.Limit) - float64(last)) / float64(s.Increment))
+		if span != 0 {
+			s.PctUsed = 100 * (float64(last) - float64(s.Start)) / span
+		}
+		if p, ok := prev[s.Name]; ok && elapsed > 0 && (last-p)/s.Increment >= 0 {
+			s.PerSecond = float64((last-p)/s.Increment) / elapsed.Seconds()
+		}
+		if s.PerSecond > 0 {
+			s.ToEmpty = float64(s.Remaining) / s.PerSecond
+			at := now.Add(time.Duration(min(s.ToEmpty, float64(math.MaxInt64/2)/1e9) * float64(time.Second))).Truncate(time.Hour)
+			s.EmptyAt = &at
+		}
+
+		within := func(d time.Duration) bool { return d > 0 && s.PerSecond > 0 && s.ToEmpty < d.Seconds() }
+		status := exitOK
+		switch {
+		case s.Cycle:
+		case s.Remaining <= 0 || s.PctUsed >= opts.critical || within(opts.criticalWithin):
+			status = exitCritical
+		case s.PctUsed >= opts.warning || within(opts.warningWithin):
+			status = exitWarning
+		}
+		s.Status = []string{"OK", "WARNING", "CRITICAL"}[status]
+		worst = max(worst, status)
+		used = append(used, s)
+	}
+	r.Sequences = used
+	slices.SortStableFunc(r.Sequences, func(a, b *sequenceUsage) int { return cmp.Compare(b.PctUsed, a.PctUsed) })
+	r.Status = []string{"OK", "WARNING", "CRITICAL"}[worst]
+	return worst
+}
+
+// readSequenceState loads the previous readings for -state-file.
+func readSequenceState(stateFile string) sequenceState {
+	var prev sequenceState
+	if stateFile == "" {
+		return prev
+	}
+	data, err := os.ReadFile(stateFile)
+	if err == nil {
+		err = json.Unmarshal(data, &prev)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "⚠️  -state-file: %v\n", err)
+	}
+	return prev
+}
+
+// lastValues maps each sequence to its last_value.
+func lastValues(sequences []*sequenceUsage) map[string]int64 {
+	values := map[string]int64{}
+	for _, s := range sequences {
+		if s.LastValue != nil {
+			values[s.Name] = *s.LastValue
+		}
+	}
+	return values
+}
+
+// printSequences writes the report for a person.
+func printSequences(r *sequenceReport, top int) {
+	alerting := 0
+	for _, s := range r.Sequences {
+		if s.Status != "OK" {
+			alerting++
+		}
+	}
+	fmt.Printf("%s: %d sequences in %s, %d past a threshold\n", r.Status, len(r.Sequences), r.Database, alerting)
+	fmt.Printf("\n%-44s %7s %20s %20s %12s %14s  %s\n", "SEQUENCE", "USED", "LAST VALUE", "LIMIT", "RATE/DAY", "RUNS OUT", "LIMITED BY")
+	for i, s := range r.Sequences {
+		if i >= top && s.Status == "OK" {
+			break
+		}
+		mark := ""
+		switch s.Status {
+		case "CRITICAL":
+			mark = "🔥 "
+		case "WARNING":
+			mark = "⚠️  "
+		}
+		runsOut := "-"
+		if s.Cycle {
+			runsOut = "cycles"
+		} else if s.Remaining <= 0 {
+			runsOut = "EXHAUSTED"
+		} else if s.EmptyAt != nil {
+			runsOut = s.EmptyAt.Format("2006-01-02")
+		}
+		fmt.Printf("%-44s %6.1f%% %20d %20d %12.0f %14s  %s%s\n", oneLine(s.Name, 44), s.PctUsed, *s.LastValue, s.Limit,
+			s.PerSecond*86400, runsOut, mark, s.LimitBy)
+		if s.ToEmpty > 0 {
+			fmt.Printf("%-44s %s left at the current rate\n", "", formatSeconds(s.ToEmpty))
+		}
+	}
+	if len(r.Unused) > 0 {
+		fmt.Printf("\nNever called or not readable (%d): %s\n", len(r.Unused), strings.Join(r.Unused[:min(len(r.Unused), 10)], ", "))
+	}
+	fmt.Printf("\nRates measured over %v\n", time.Duration(r.Sampled*float64(time.Second)).Round(time.Second))
+}
+
+// Sequences runs the sequences command line tool and exits with the
+// Nagios status.
+func Sequences() {
+	var dsn, stateFile, format string
+	var top int
+	var sample time.Duration
+	var opts sequenceOptions
+	registerDSNFlag(&dsn)
+	flag.IntVar(&top, "top", 20, "Show this many of the most consumed sequences (and every one past a threshold)")
+	flag.DurationVar(&sample, "sample", 30*time.Second, "Measure consumption rates over this long (without a usable -state-file)")
+	flag.StringVar(&stateFile, "state-file", "", "Keep the last values here and measure rates since the previous run")
+	flag.Float64Var(&opts.warning, "warning", 50, "WARNING past this percentage consumed")
+	flag.Float64Var(&opts.critical, "critical", 80, "CRITICAL past this percentage consumed")
+	flag.DurationVar(&opts.warningWithin, "warning-within", 180*24*time.Hour, "WARNING when exhaustion is projected within this long (0: off)")
+	flag.DurationVar(&opts.criticalWithin, "critical-within", 30*24*time.Hour, "CRITICAL when exhaustion is projected within this long (0: off)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+
+	unknown := func(err error) {
+		fmt.Printf("UNKNOWN: %v\n", err)
+		os.Exit(exitUnknown)
+	}
+	if format != "text" && format != "json" {
+		unknown(fmt.Errorf("invalid -format %q (use text or json)", format))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sample+time.Minute)
+	defer cancel()
+	pool, err := connect(ctx, dsn, "sequences", 1)
+	if err != nil {
+		unknown(err)
+	}
+	defer pool.Close()
+
+	prev := readSequenceState(stateFile)
+	database, sequences, err := readSequences(ctx, pool)
+	if err != nil {
+		unknown(err)
+	}
+	now := time.Now()
+	elapsed := now.Sub(prev.Time)
+	if prev.Time.IsZero() || elapsed < time.Second {
+		// No usable earlier reading: take one now and read again.
+		prev = sequenceState{Time: now, Values: lastValues(sequences)}
+		select {
+		case <-ctx.Done():
+			unknown(ctx.Err())
+		case <-time.After(sample):
+		}
+		if _, sequences, err = readSequences(ctx, pool); err != nil {
+			unknown(err)
+		}
+		now = time.Now()
+		elapsed = now.Sub(prev.Time)
+	}
+	if stateFile != "" {
+		data, _ := json.Marshal(sequenceState{Time: now, Values: lastValues(sequences)})
+		if err := os.WriteFile(stateFile, data, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  -state-file: %v\n", err)
+		}
+	}
+
+	report := &sequenceReport{Database: database, Sequences: sequences}
+	status := report.assess(prev.Values, elapsed, opts)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			unknown(err)
+		}
+	} else {
+		printSequences(report, top)
+	}
+	pool.Close()
+	os.Exit(status)
+}
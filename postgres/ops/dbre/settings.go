@@ -0,0 +1,555 @@
+package dbre
+
+// ============================================================================
+// CONFIGURATION SNAPSHOTS AND DRIFT (cmd/settings-snapshot, cmd/settings-diff)
+// ============================================================================
+//
+// Replicas that should be identical, staging vs production, before vs after
+// a maintenance window: configuration drifts one ALTER SYSTEM at a time.
+// settings-snapshot records a cluster's configuration:
+//   settings    every pg_settings entry with its value, unit, source
+//               (default, configuration file, ALTER SYSTEM, ...) and
+//               pending_restart. Values this session changed (client,
+//               session, database and role sources) are replaced with the
+//               server's own: the configuration file's, else the default
+//   overrides   ALTER DATABASE/ROLE ... SET entries of pg_db_role_setting,
+//               per database, role, or role in database
+// into a JSON file (-out) and/or a table in a results database
+// (-results-dsn, -results-table, under -label, by default host:port).
+//
+// settings-diff compares two of them, each given as
+//   now                  the -dsn cluster, read now
+//   dsn:<conn string>    another cluster, read now
+//   db:<label>[@<id>]    a snapshot in the results database: the newest of
+//                        the label, or the one whose ID (UTC time,
+//                        20261017T093000Z) starts with <id>
+//   <path>               a snapshot file
+// and reports the settings and overrides that differ, only exist on one
+// side (another major version), or wait for a restart. Values that are not
+// the server default are marked *. Settings that differ by design
+// (data_directory, cluster_name, primary_conninfo, ...) are skipped; add
+// more with -ignore. With only -from it lists that side's non-default
+// settings and overrides. Exit code 2 when there is drift.
+//
+//   go run ./cmd/settings-snapshot -out=db1-$(date +%F).json
+//   go run ./cmd/settings-snapshot -results-dsn=postgres://dbre@results/dbre -label=db1
+//   go run ./cmd/settings-diff -from=now -to=dsn:postgres://dbre@db2/avro
+//   go run ./cmd/settings-diff -results-dsn=postgres://dbre@results/dbre -from=db:db1@20261001 -to=db:db1
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pgSetting is one pg_settings entry.
+type pgSetting struct {
+	Name           string `json:"name"`
+	Value          string `json:"value"`
+	Unit           string `json:"unit,omitempty"`
+	Source         string `json:"source"`
+	BootValue      string `json:"boot_value"`
+	Context        string `json:"context"`
+	PendingRestart bool   `json:"pending_restart,omitempty"`
+}
+
+// nonDefault reports whether the setting was changed from the server's
+// built-in default.
+func (s pgSetting) nonDefault() bool {
+	return s.Source != "default" && s.Source != "override" && s.Value != s.BootValue
+}
+
+// display is the value with its unit, e.g. "16384 8kB".
+func (s pgSetting) display() string {
+	if s.Unit == "" {
+		return s.Value
+	}
+	return s.Value + " " + s.Unit
+}
+
+// settingOverride is an ALTER DATABASE/ROLE ... SET entry.
+type settingOverride struct {
+	Database string `json:"database,omitempty"` // Empty: every database
+	Role     string `json:"role,omitempty"`     // Empty: every role
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+}
+
+// scope describes where the override applies.
+func (o settingOverride) scope() string {
+	switch {
+	case o.Database != "" && o.Role != "":
+		return fmt.Sprintf("role %s in database %s", o.Role, o.Database)
+	case o.Database != "":
+		return "database " + o.Database
+	default:
+		return "role " + o.Role
+	}
+}
+
+func (o settingOverride) key() string { return o.Database + "\x00" + o.Role + "\x00" + o.Name }
+
+// settingsSnapshot is a cluster's configuration at one moment.
+type settingsSnapshot struct {
+	ID        string            `json:"id"`
+	Label     string            `json:"label"`
+	Taken     time.Time         `json:"taken"`
+	Server    string            `json:"server"`
+	Version   string            `json:"server_version"`
+	Settings  []pgSetting       `json:"settings"`
+	Overrides []settingOverride `json:"overrides"`
+}
+
+// readSettings takes a snapshot of the cluster pool is connected to.
+func readSettings(ctx context.Context, pool *pgxpool.Pool, label string) (*settingsSnapshot, error) {
+	snap := &settingsSnapshot{Taken: time.Now().UTC().Truncate(time.Second), Server: describeTarget(pool.Config()), Label: label}
+	snap.ID = snap.Taken.Format(snapshotIDFormat)
+	if snap.Label == "" {
+		c := pool.Config().ConnConfig
+		snap.Label = fmt.Sprintf("%s:%d", c.Host, c.Port)
+	}
+	if err := pool.QueryRow(ctx, "SELECT current_setting('server_version')").Scan(&snap.Version); err != nil {
+		return nil, err
+	}
+
+	// Sources that belong to this session fall back to the configuration
+	// file's last applied entry, else the default.
+	rows, err := pool.Query(ctx, `
+		SELECT s.name,
+		       coalesce(CASE WHEN s.source IN ('client', 'session', 'database', 'user', 'database user')
+		                     THEN coalesce(f.setting, s.boot_val) ELSE s.setting END, ''),
+		       coalesce(s.unit, ''),
+		       CASE WHEN s.source IN ('client', 'session', 'database', 'user', 'database user')
+		            THEN CASE WHEN f.name IS NULL THEN 'default' ELSE 'configuration file' END
+		            ELSE s.source END,
+		       coalesce(s.boot_val, ''), s.context, s.pending_restart
+		FROM pg_settings s
+		LEFT JOIN LATERAL (
+			SELECT fs.name, fs.setting FROM pg_file_settings fs
+			WHERE fs.name = s.name AND fs.applied AND s.source IN ('client', 'session', 'database', 'user', 'database user')
+			ORDER BY fs.seqno DESC LIMIT 1
+		) f ON true
+		ORDER BY s.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_settings: %w", err)
+	}
+	if snap.Settings, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (pgSetting, error) {
+		var s pgSetting
+		err := row.Scan(&s.Name, &s.Value, &s.Unit, &s.Source, &s.BootValue, &s.Context, &s.PendingRestart)
+		return s, err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read pg_settings: %w", err)
+	}
+
+	rows, err = pool.Query(ctx, `
+		SELECT coalesce(d.datname::text, ''), coalesce(r.rolname::text, ''), c.config
+		FROM pg_db_role_setting s
+		LEFT JOIN pg_database d ON d.oid = s.setdatabase
+		LEFT JOIN pg_roles r ON r.oid = s.setrole
+		CROSS JOIN LATERAL unnest(s.setconfig) c(config)
+		ORDER BY 1, 2, 3
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_db_role_setting: %w", err)
+	}
+	if snap.Overrides, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (settingOverride, error) {
+		var o settingOverride
+		var config string
+		err := row.Scan(&o.Database, &o.Role, &config)
+		o.Name, o.Value, _ = strings.Cut(config, "=")
+		return o, err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read pg_db_role_setting: %w", err)
+	}
+	return snap, nil
+}
+
+// settingsStore is the snapshot table of a results database.
+type settingsStore struct {
+	pool  *pgxpool.Pool
+	table string
+}
+
+func (st *settingsStore) tableName() string {
+	return pgx.Identifier(strings.Split(st.table, ".")).Sanitize()
+}
+
+func (st *settingsStore) save(ctx context.Context, snap *settingsSnapshot) error {
+	_, err := st.pool.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			label     text        NOT NULL,
+			taken     timestamptz NOT NULL,
+			server    text        NOT NULL,
+			snapshot  jsonb       NOT NULL,
+			PRIMARY KEY (label, taken)
+		)`, st.tableName()))
+	if err == nil {
+		_, err = st.pool.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %s (label, taken, server, snapshot) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (label, taken) DO UPDATE SET server = excluded.server, snapshot = excluded.snapshot
+		`, st.tableName()), snap.Label, snap.Taken, snap.Server, snap)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store the snapshot in %s: %w", st.table, err)
+	}
+	return nil
+}
+
+// load reads the newest snapshot of label, or the one whose ID starts
+// with prefix.
+func (st *settingsStore) load(ctx context.Context, label, prefix string) (*settingsSnapshot, error) {
+	rows, err := st.pool.Query(ctx, fmt.Sprintf(`
+		SELECT snapshot FROM %s
+		WHERE label = $1 AND to_char(taken AT TIME ZONE 'UTC', 'YYYYMMDD"T"HH24MISS"Z"') LIKE $2 || '%%'
+		ORDER BY taken DESC
+		LIMIT 2
+	`, st.tableName()), label, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots from %s: %w", st.table, err)
+	}
+	snaps, err := pgx.CollectRows(rows, pgx.RowTo[settingsSnapshot])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots from %s: %w", st.table, err)
+	}
+	switch {
+	case len(snaps) == 0:
+		return nil, fmt.Errorf("no snapshot %q of %s in %s", prefix, label, st.table)
+	case len(snaps) > 1 && prefix != "":
+		return nil, fmt.Errorf("snapshot %q of %s is ambiguous: %s, %s, ...", prefix, label, snaps[0].ID, snaps[1].ID)
+	}
+	return &snaps[0], nil
+}
+
+// settingChange is a setting that differs between two snapshots.
+type settingChange struct {
+	Name           string     `json:"name"`
+	From           *pgSetting `json:"from,omitempty"` // Nil: only in the later snapshot
+	To             *pgSetting `json:"to,omitempty"`   // Nil: only in the earlier snapshot
+	PendingRestart bool       `json:"pending_restart,omitempty"`
+}
+
+// overrideChange is an override that differs between two snapshots.
+type overrideChange struct {
+	Scope string  `json:"scope"`
+	Name  string  `json:"name"`
+	From  *string `json:"from"`
+	To    *string `json:"to"`
+}
+
+// settingsDrift compares two snapshots.
+type settingsDrift struct {
+	From      string           `json:"from"`
+	To        string           `json:"to"`
+	Settings  []settingChange  `json:"settings"`
+	Overrides []overrideChange `json:"overrides"`
+}
+
+// driftIgnored are settings expected to differ between clusters.
+var driftIgnored = []string{
+	"application_name", "cluster_name", "config_file", "data_directory", "external_pid_file",
+	"hba_file", "ident_file", "primary_conninfo", "primary_slot_name", "transaction_read_only",
+	"in_hot_standby",
+}
+
+// diffSettings compares from and to, skipping the ignored settings.
+func diffSettings(from, to *settingsSnapshot, ignore []string) *settingsDrift {
+	d := &settingsDrift{
+		From:      fmt.Sprintf("%s %s (%s, %s)", from.Label, from.ID, from.Server, from.Version),
+		To:        fmt.Sprintf("%s %s (%s, %s)", to.Label, to.ID, to.Server, to.Version),
+		Settings:  []settingChange{},
+		Overrides: []overrideChange{},
+	}
+	before := map[string]*pgSetting{}
+	for i := range from.Settings {
+		before[from.Settings[i].Name] = &from.Settings[i]
+	}
+	after := map[string]*pgSetting{}
+	for i := range to.Settings {
+		after[to.Settings[i].Name] = &to.Settings[i]
+	}
+	names := map[string]bool{}
+	for n := range before {
+		names[n] = true
+	}
+	for n := range after {
+		names[n] = true
+	}
+	for n := range names {
+		if slices.Contains(ignore, n) {
+			continue
+		}
+		b, a := before[n], after[n]
+		pending := a != nil && a.PendingRestart
+		if b != nil && a != nil && b.Value == a.Value && b.Unit == a.Unit && !pending {
+			continue
+		}
+		d.Settings = append(d.Settings, settingChange{Name: n, From: b, To: a, PendingRestart: pending})
+	}
+	slices.SortFunc(d.Settings, func(x, y settingChange) int { return cmp.Compare(x.Name, y.Name) })
+
+	overrides := map[string]*overrideChange{}
+	for _, side := range []struct {
+		list []settingOverride
+		from bool
+	}{{from.Overrides, true}, {to.Overrides, false}} {
+		for _, o := range side.list {
+			c := overrides[o.key()]
+			if c == nil {
+				c = &overrideChange{Scope: o.scope(), Name: o.Name}
+				overrides[o.key()] = c
+			}
+			v := o.Value
+			if side.from {
+				c.From = &v
+			} else {
+				c.To = &v
+			}
+		}
+	}
+	for _, c := range overrides {
+		if c.From != nil && c.To != nil && *c.From == *c.To {
+			continue
+		}
+		d.Overrides = append(d.Overrides, *c)
+	}
+	slices.SortFunc(d.Overrides, func(x, y overrideChange) int {
+		return cmp.Or(cmp.Compare(x.Scope, y.Scope), cmp.Compare(x.Name, y.Name))
+	})
+	return d
+}
+
+// printSettingsDrift writes the comparison for a person.
+func printSettingsDrift(d *settingsDrift) {
+	fmt.Printf("🔧 Configuration drift\n   from %s\n   to   %s\n", d.From, d.To)
+	if len(d.Settings) == 0 && len(d.Overrides) == 0 {
+		fmt.Println("\n✅ No drift")
+		return
+	}
+	side := func(s *pgSetting) string {
+		if s == nil {
+			return "(absent)"
+		}
+		v := s.display()
+		if s.nonDefault() {
+			v += " *"
+		}
+		return fmt.Sprintf("%s [%s]", v, s.Source)
+	}
+	if len(d.Settings) > 0 {
+		fmt.Printf("\n%-40s %-40s %s\n", "SETTING", "FROM", "TO")
+		for _, c := range d.Settings {
+			note := ""
+			if c.PendingRestart {
+				note = "  ⏳ pending restart"
+			}
+			fmt.Printf("%-40s %-40s %s%s\n", c.Name, oneLine(side(c.From), 40), side(c.To), note)
+		}
+	}
+	if len(d.Overrides) > 0 {
+		value := func(v *string) string {
+			if v == nil {
+				return "(not set)"
+			}
+			return *v
+		}
+		fmt.Printf("\n%-40s %-30s %-25s %s\n", "OVERRIDE", "SETTING", "FROM", "TO")
+		for _, c := range d.Overrides {
+			fmt.Printf("%-40s %-30s %-25s %s\n", oneLine(c.Scope, 40), c.Name, oneLine(value(c.From), 25), value(c.To))
+		}
+	}
+	fmt.Println("\n* not the server default")
+}
+
+// printNonDefault lists a snapshot's non-default settings and overrides.
+func printNonDefault(snap *settingsSnapshot, ignore []string) {
+	fmt.Printf("🔧 %s %s (%s, %s): non-default settings\n\n", snap.Label, snap.ID, snap.Server, snap.Version)
+	fmt.Printf("%-40s %-30s %-20s %s\n", "SETTING", "VALUE", "SOURCE", "DEFAULT")
+	for _, s := range snap.Settings {
+		if !s.nonDefault() || slices.Contains(ignore, s.Name) {
+			continue
+		}
+		note := ""
+		if s.PendingRestart {
+			note = "  ⏳ pending restart"
+		}
+		fmt.Printf("%-40s %-30s %-20s %s%s\n", s.Name, oneLine(s.display(), 30), s.Source, s.BootValue, note)
+	}
+	if len(snap.Overrides) > 0 {
+		fmt.Printf("\n%-40s %-30s %s\n", "OVERRIDE", "SETTING", "VALUE")
+		for _, o := range snap.Overrides {
+			fmt.Printf("%-40s %-30s %s\n", oneLine(o.scope(), 40), o.Name, o.Value)
+		}
+	}
+}
+
+// SettingsSnapshot runs the settings-snapshot command line tool.
+func SettingsSnapshot() {
+	var dsn, out, resultsDSN, table, label string
+	registerDSNFlag(&dsn)
+	flag.StringVar(&out, "out", "", "Write the snapshot to this JSON file (- for stdout; default: stdout unless -results-dsn)")
+	flag.StringVar(&resultsDSN, "results-dsn", "", "Store the snapshot in this results database")
+	flag.StringVar(&table, "results-table", "dbre_settings_snapshots", "Snapshot table in the results database")
+	flag.StringVar(&label, "label", "", "Name of the cluster in the results database (default: host:port)")
+	flag.Parse()
+
+	ctx := context.Background()
+	pool, err := connect(ctx, dsn, "settings-snapshot", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	snap, err := readSettings(ctx, pool, label)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if resultsDSN != "" {
+		results, err := connect(ctx, resultsDSN, "settings-snapshot", 1)
+		if err != nil {
+			log.Fatalf("-results-dsn: %v", err)
+		}
+		defer results.Close()
+		store := &settingsStore{pool: results, table: table}
+		if err := store.save(ctx, snap); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "📸 Snapshot %s of %s: %d settings, %d overrides stored in %s\n",
+			snap.ID, snap.Label, len(snap.Settings), len(snap.Overrides), table)
+	}
+	if out == "" && resultsDSN != "" {
+		return
+	}
+
+	w := os.Stdout
+	if out != "" && out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(snap); err != nil {
+		log.Fatal(err)
+	}
+	if w != os.Stdout {
+		if err := w.Close(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "📸 Snapshot %s of %s: %d settings, %d overrides written to %s\n",
+			snap.ID, snap.Label, len(snap.Settings), len(snap.Overrides), out)
+	}
+}
+
+// SettingsDiff runs the settings-diff command line tool.
+func SettingsDiff() {
+	var dsn, from, to, resultsDSN, table, format string
+	var ignore stringList
+	registerDSNFlag(&dsn)
+	flag.StringVar(&from, "from", "", "Earlier side: now, dsn:<conn string>, db:<label>[@<id>] or a snapshot file")
+	flag.StringVar(&to, "to", "", "Later side, as -from (empty: list -from's non-default settings)")
+	flag.StringVar(&resultsDSN, "results-dsn", "", "Results database for db: sides")
+	flag.StringVar(&table, "results-table", "dbre_settings_snapshots", "Snapshot table in the results database")
+	flag.Var(&ignore, "ignore", "Also skip this setting (repeatable)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if from == "" {
+		log.Fatal("-from is required")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	ignore = append(ignore, driftIgnored...)
+
+	ctx := context.Background()
+	var store *settingsStore
+	load := func(spec string) *settingsSnapshot {
+		snap, err := func() (*settingsSnapshot, error) {
+			switch {
+			case spec == "now" || strings.HasPrefix(spec, "dsn:"):
+				target := dsn
+				if spec != "now" {
+					target = strings.TrimPrefix(spec, "dsn:")
+				}
+				pool, err := connect(ctx, target, "settings-diff", 1)
+				if err != nil {
+					return nil, err
+				}
+				defer pool.Close()
+				return readSettings(ctx, pool, "")
+			case strings.HasPrefix(spec, "db:"):
+				if resultsDSN == "" {
+					return nil, errors.New("db: needs -results-dsn")
+				}
+				if store == nil {
+					results, err := connect(ctx, resultsDSN, "settings-diff", 1)
+					if err != nil {
+						return nil, fmt.Errorf("-results-dsn: %w", err)
+					}
+					store = &settingsStore{pool: results, table: table}
+				}
+				label, id, _ := strings.Cut(strings.TrimPrefix(spec, "db:"), "@")
+				return store.load(ctx, label, id)
+			default:
+				data, err := os.ReadFile(spec)
+				if err != nil {
+					return nil, err
+				}
+				var snap settingsSnapshot
+				if err := json.Unmarshal(data, &snap); err != nil {
+					return nil, fmt.Errorf("%s: %w", spec, err)
+				}
+				return &snap, nil
+			}
+		}()
+		if err != nil {
+			log.Fatalf("%s: %v", spec, err)
+		}
+		return snap
+	}
+
+	older := load(from)
+	if to == "" {
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(older); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		printNonDefault(older, ignore)
+		return
+	}
+	newer := load(to)
+	if store != nil {
+		store.pool.Close()
+	}
+
+	drift := diffSettings(older, newer, ignore)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(drift); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printSettingsDrift(drift)
+	}
+	if len(drift.Settings) > 0 || len(drift.Overrides) > 0 {
+		os.Exit(2)
+	}
+}
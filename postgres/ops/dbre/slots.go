@@ -0,0 +1,412 @@
+package dbre
+
+// ============================================================================
+// REPLICATION SLOT WATCHDOG (cmd/slots)
+// ============================================================================
+//
+// A replication slot keeps every WAL segment from its restart_lsn on until
+// its consumer confirms it. A CDC connector that stopped, a decommissioned
+// replica or a forgotten test subscription makes pg_wal grow until the
+// disk is full and the primary stops. slots polls pg_replication_slots and
+// alerts (see alert.go) on:
+//   retained WAL     bytes behind each slot's restart_lsn above
+//                    -max-retained
+//   disk fill        retained WAL above -max-disk-pct of the WAL volume, or
+//                    the volume projected to fill within -fill-warning at
+//                    the growth rate seen between polls
+//   inactive slots   no consumer connected for -max-inactive
+//   wal_status       "unreserved" (about to lose WAL past
+//                    max_slot_wal_keep_size) or "lost" (the consumer can't
+//                    resume: rebuild it, then drop the slot)
+// The WAL volume is measured with statfs on -wal-dir when running on the
+// database host, or given as -disk-size (the retained WAL is then counted
+// against it, ignoring max_wal_size and everything else on the volume).
+//
+// Metrics on -metrics-addr:
+//   dbre_slots_retained_bytes{slot,type,database}
+//   dbre_slots_active{slot}                1 while a consumer is connected
+//   dbre_slots_inactive_seconds{slot}
+//   dbre_slots_safe_wal_bytes{slot}        WAL left before "lost" (safe_wal_size)
+//   dbre_slots_wal_status{slot,status}     1 for the current wal_status
+//   dbre_slots_disk_free_bytes / dbre_slots_disk_fill_seconds
+//   dbre_slots_up
+//
+// Dropping a slot loses its consumer's position, so slots never does it on
+// its own. A drop policy makes slots eligible: inactive for -drop-after and
+// named like -drop-pattern (both required). An eligible slot is dropped
+// only after approval: -once asks on the terminal (type the slot's name);
+// the daemon drops it once its name is a line of -approve-file, which the
+// operator writes after reading the alert. Before PostgreSQL 17 the server
+// doesn't record since when a slot is inactive, so the time counts from the
+// first poll that saw it inactive: only the daemon can apply -drop-after
+// and -max-inactive there.
+//
+//   go run ./cmd/slots -dsn=postgres://dbre@db1/postgres -wal-dir=/var/lib/postgresql/16/main/pg_wal
+//   go run ./cmd/slots -disk-size=500GB -max-retained=50GB -alert-webhook=https://hooks.slack.com/services/...
+//   go run ./cmd/slots -once -drop-after=24h -drop-pattern='^debezium_test_'
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// walStatuses are the values of pg_replication_slots.wal_status.
+var walStatuses = []string{"reserved", "extended", "unreserved", "lost"}
+
+// replicationSlot is one row of pg_replication_slots.
+type replicationSlot struct {
+	name, slotType, plugin, database string
+	active                           bool
+	walStatus                        string // Empty before PostgreSQL 13
+	retained                         int64  // Bytes from restart_lsn to the current WAL position
+	safeWAL                          *int64 // Bytes left before "lost", if max_slot_wal_keep_size is set
+	inactiveSince                    time.Time
+}
+
+// readSlots reads the slots; inactive_since comes from the server on
+// PostgreSQL 17 and from firstInactive before.
+func readSlots(ctx context.Context, pool *pgxpool.Pool, version int) ([]replicationSlot, error) {
+	walStatus, safeWAL, inactiveSince := "''", "NULL::bigint", "NULL::timestamptz"
+	if version >= 130000 {
+		walStatus, safeWAL = "coalesce(wal_status, '')", "safe_wal_size"
+	}
+	if version >= 170000 {
+		inactiveSince = "inactive_since"
+	}
+	// Slots on a standby (logical decoding there needs PostgreSQL 16)
+	// retain WAL behind what it received.
+	lsn := "CASE WHEN pg_is_in_recovery() THEN pg_last_wal_receive_lsn() ELSE pg_current_wal_lsn() END"
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT slot_name::text, slot_type, coalesce(plugin::text, ''), coalesce(database::text, ''), active,
+		       %s, coalesce(pg_wal_lsn_diff(%s, restart_lsn), 0)::bigint, %s, %s
+		FROM pg_replication_slots
+		ORDER BY 1
+	`, walStatus, lsn, safeWAL, inactiveSince))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pg_replication_slots: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (replicationSlot, error) {
+		var s replicationSlot
+		var since *time.Time
+		err := row.Scan(&s.name, &s.slotType, &s.plugin, &s.database, &s.active, &s.walStatus, &s.retained, &s.safeWAL, &since)
+		if since != nil {
+			s.inactiveSince = *since
+		}
+		return s, err
+	})
+}
+
+// slotOptions are the flags of slots.
+type slotOptions struct {
+	maxRetained, diskSize int64
+	maxDiskPct            float64
+	fillWarning           time.Duration
+	maxInactive           time.Duration
+	walDir                string
+	dropAfter             time.Duration
+	dropPattern           *regexp.Regexp
+	approveFile           string
+}
+
+// slotMetrics are the gauges slots serves.
+type slotMetrics struct {
+	retained, active, inactive, safeWAL, walStatus *prometheus.GaugeVec
+	diskFree, fillSeconds, up                      prometheus.Gauge
+}
+
+func newSlotMetrics() *slotMetrics {
+	gauge := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_slots_" + name, Help: help}, labels)
+	}
+	single := func(name, help string) prometheus.Gauge {
+		return prometheus.NewGauge(prometheus.GaugeOpts{Name: "dbre_slots_" + name, Help: help})
+	}
+	return &slotMetrics{
+		retained:    gauge("retained_bytes", "WAL bytes retained by the slot.", "slot", "type", "database"),
+		active:      gauge("active", "1 while a consumer is connected to the slot.", "slot"),
+		inactive:    gauge("inactive_seconds", "Seconds since the slot's consumer disconnected.", "slot"),
+		safeWAL:     gauge("safe_wal_bytes", "WAL that can still be written before the slot is lost.", "slot"),
+		walStatus:   gauge("wal_status", "1 for the slot's current wal_status.", "slot", "status"),
+		diskFree:    single("disk_free_bytes", "Free space on the WAL volume."),
+		fillSeconds: single("disk_fill_seconds", "Projected seconds until the WAL volume is full (0 while retention is not growing)."),
+		up:          single("up", "1 if the last poll worked."),
+	}
+}
+
+func (m *slotMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.retained, m.active, m.inactive, m.safeWAL, m.walStatus, m.diskFree, m.fillSeconds, m.up}
+}
+
+// slotWatchdog keeps the state between polls.
+type slotWatchdog struct {
+	opts    slotOptions
+	pool    *pgxpool.Pool
+	version int
+	metrics *slotMetrics
+	alerts  *alerter
+
+	firstInactive map[string]time.Time // Before PostgreSQL 17
+	lastRetained  int64
+	lastPoll      time.Time
+}
+
+// poll reads the slots once, updates metrics and alerts, and returns the
+// slots the drop policy makes eligible.
+func (w *slotWatchdog) poll(ctx context.Context, verbose bool) []replicationSlot {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	slots, err := readSlots(ctx, w.pool, w.version)
+	w.metrics.up.Set(boolGauge(err == nil))
+	w.alerts.update("slots:poll", err != nil, pollMessage("server", describeTarget(w.pool.Config()), err))
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	var maxRetained int64
+	var eligible []replicationSlot
+	for _, vec := range []*prometheus.GaugeVec{w.metrics.retained, w.metrics.active, w.metrics.inactive, w.metrics.safeWAL, w.metrics.walStatus} {
+		vec.Reset()
+	}
+	for i := range slots {
+		s := &slots[i]
+		maxRetained = max(maxRetained, s.retained)
+		if s.active {
+			delete(w.firstInactive, s.name)
+			s.inactiveSince = time.Time{}
+		} else if s.inactiveSince.IsZero() {
+			if _, ok := w.firstInactive[s.name]; !ok {
+				w.firstInactive[s.name] = now
+			}
+			s.inactiveSince = w.firstInactive[s.name]
+		}
+		var inactiveFor time.Duration
+		if !s.active {
+			inactiveFor = now.Sub(s.inactiveSince)
+		}
+
+		w.metrics.retained.WithLabelValues(s.name, s.slotType, s.database).Set(float64(s.retained))
+		w.metrics.active.WithLabelValues(s.name).Set(boolGauge(s.active))
+		w.metrics.inactive.WithLabelValues(s.name).Set(inactiveFor.Seconds())
+		if s.safeWAL != nil {
+			w.metrics.safeWAL.WithLabelValues(s.name).Set(float64(*s.safeWAL))
+		}
+		for _, status := range walStatuses {
+			if s.walStatus == status {
+				w.metrics.walStatus.WithLabelValues(s.name, status).Set(1)
+			}
+		}
+
+		w.alerts.update("slots:retained:"+s.name, w.opts.maxRetained > 0 && s.retained > w.opts.maxRetained,
+			fmt.Sprintf("slot %s retains %s of WAL (limit %s)", s.name, formatBytes(s.retained), formatBytes(w.opts.maxRetained)))
+		w.alerts.update("slots:inactive:"+s.name, w.opts.maxInactive > 0 && inactiveFor > w.opts.maxInactive,
+			fmt.Sprintf("slot %s (%s) has had no consumer for %v, retaining %s", s.name, s.slotType,
+				inactiveFor.Round(time.Minute), formatBytes(s.retained)))
+		w.alerts.update("slots:wal_status:"+s.name, s.walStatus == "unreserved" || s.walStatus == "lost",
+			fmt.Sprintf("slot %s wal_status is %s", s.name, s.walStatus))
+
+		if !s.active && w.opts.dropPattern != nil && inactiveFor >= w.opts.dropAfter && w.opts.dropPattern.MatchString(s.name) {
+			eligible = append(eligible, *s)
+		} else {
+			w.alerts.update("slots:eligible:"+s.name, false, fmt.Sprintf("slot %s no longer matches the drop policy", s.name))
+		}
+		if verbose {
+			state := "active"
+			if !s.active {
+				state = fmt.Sprintf("inactive %v", inactiveFor.Round(time.Second))
+			}
+			fmt.Printf("   %-32s %-9s %-10s %-12s %10s retained  %-10s %s\n", s.name, s.slotType, s.database,
+				s.plugin, formatBytes(s.retained), s.walStatus, state)
+		}
+	}
+	for name := range w.firstInactive {
+		if !slices.ContainsFunc(slots, func(s replicationSlot) bool { return s.name == name }) {
+			delete(w.firstInactive, name)
+		}
+	}
+	w.checkDisk(now, maxRetained, verbose)
+	return eligible
+}
+
+// checkDisk measures the WAL volume, projects when it fills and alerts.
+func (w *slotWatchdog) checkDisk(now time.Time, maxRetained int64, verbose bool) {
+	var free, size int64
+	switch {
+	case w.opts.walDir != "":
+		var err error
+		free, size, err = diskSpace(w.opts.walDir)
+		w.alerts.update("slots:disk", err != nil, fmt.Sprintf("-wal-dir %s: %v", w.opts.walDir, err))
+		if err != nil {
+			return
+		}
+	case w.opts.diskSize > 0:
+		size, free = w.opts.diskSize, max(w.opts.diskSize-maxRetained, 0)
+	default:
+		return
+	}
+	w.metrics.diskFree.Set(float64(free))
+
+	var fill time.Duration
+	if !w.lastPoll.IsZero() && maxRetained > w.lastRetained {
+		rate := float64(maxRetained-w.lastRetained) / now.Sub(w.lastPoll).Seconds()
+		fill = time.Duration(float64(free) / rate * float64(time.Second))
+		w.metrics.fillSeconds.Set(fill.Seconds())
+	} else {
+		w.metrics.fillSeconds.Set(0)
+	}
+	w.lastRetained, w.lastPoll = maxRetained, now
+
+	pct := 100 * float64(maxRetained) / float64(size)
+	w.alerts.update("slots:disk:pct", w.opts.maxDiskPct > 0 && pct > w.opts.maxDiskPct,
+		fmt.Sprintf("slots retain %s, %.0f%% of the %s WAL volume (limit %.0f%%), %s free",
+			formatBytes(maxRetained), pct, formatBytes(size), w.opts.maxDiskPct, formatBytes(free)))
+	filling := fill > 0 && fill < w.opts.fillWarning
+	msg := fmt.Sprintf("WAL volume projected to fill in %v at the current retention growth (%s free)",
+		fill.Round(time.Minute), formatBytes(free))
+	if !filling {
+		msg = fmt.Sprintf("WAL volume no longer projected to fill within %v (%s free)", w.opts.fillWarning, formatBytes(free))
+	}
+	w.alerts.update("slots:disk:fill", filling, msg)
+	if verbose {
+		fmt.Printf("   WAL volume: %s free of %s, slots retain up to %s (%.0f%%)\n",
+			formatBytes(free), formatBytes(size), formatBytes(maxRetained), pct)
+	}
+}
+
+// dropApproved drops the eligible slots the operator approved.
+func (w *slotWatchdog) dropApproved(ctx context.Context, eligible []replicationSlot, interactive bool) {
+	if len(eligible) == 0 {
+		return
+	}
+	var approved []string
+	if !interactive {
+		data, err := os.ReadFile(w.opts.approveFile)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "      ⚠️  -approve-file: %v\n", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			approved = append(approved, strings.TrimSpace(line))
+		}
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	for _, s := range eligible {
+		what := fmt.Sprintf("slot %s (%s, %s, retaining %s, inactive since %s)", s.name, s.slotType, s.plugin,
+			formatBytes(s.retained), s.inactiveSince.Format("2006-01-02 15:04"))
+		if interactive {
+			fmt.Printf("🗑️  Drop %s?\n   Its consumer can't resume after this. Type the slot name to drop it: ", what)
+			answer, _ := stdin.ReadString('\n')
+			if strings.TrimSpace(answer) != s.name {
+				fmt.Println("   Kept")
+				continue
+			}
+		} else if !slices.Contains(approved, s.name) {
+			w.alerts.update("slots:eligible:"+s.name, true,
+				fmt.Sprintf("%s matches the drop policy; add it to %s to drop it", what, w.opts.approveFile))
+			continue
+		}
+		if _, err := w.pool.Exec(ctx, "SELECT pg_drop_replication_slot($1)", s.name); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to drop slot %s: %v\n", s.name, err)
+			continue
+		}
+		w.alerts.update("slots:eligible:"+s.name, false, fmt.Sprintf("slot %s dropped", s.name))
+		fmt.Fprintf(os.Stderr, "%s 🗑️  Dropped %s\n", time.Now().Format("2006-01-02 15:04:05"), what)
+	}
+}
+
+// Slots runs the slots command line tool.
+func Slots() {
+	var dsn, maxRetained, diskSize, dropPattern, metricsAddr string
+	var interval time.Duration
+	var once bool
+	var opts slotOptions
+	alerts := &alerter{}
+	registerDSNFlag(&dsn)
+	flag.DurationVar(&interval, "interval", 30*time.Second, "Poll interval")
+	flag.StringVar(&maxRetained, "max-retained", "0", "Alert when a slot retains more WAL than this, e.g. 50GB (0: off)")
+	flag.StringVar(&opts.walDir, "wal-dir", "", "pg_wal directory, to measure its volume (on the database host)")
+	flag.StringVar(&diskSize, "disk-size", "0", "Size of the WAL volume when -wal-dir can't be used, e.g. 500GB")
+	flag.Float64Var(&opts.maxDiskPct, "max-disk-pct", 50, "Alert when retained WAL exceeds this percentage of the WAL volume")
+	flag.DurationVar(&opts.fillWarning, "fill-warning", 6*time.Hour, "Alert when the WAL volume is projected to fill within this long")
+	flag.DurationVar(&opts.maxInactive, "max-inactive", time.Hour, "Alert when a slot has had no consumer this long (0: off)")
+	flag.DurationVar(&opts.dropAfter, "drop-after", 0, "Drop policy: inactive at least this long")
+	flag.StringVar(&dropPattern, "drop-pattern", "", "Drop policy: slot name matches this regular expression")
+	flag.StringVar(&opts.approveFile, "approve-file", "", "Daemon: drop an eligible slot once its name is a line of this file")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":9189", "Serve Prometheus metrics here (empty: off)")
+	flag.BoolVar(&once, "once", false, "Print the slots once and exit, with status 2 if an alert fires")
+	registerAlertFlags(alerts)
+	flag.Parse()
+
+	var err error
+	if opts.maxRetained, err = parseByteSize(maxRetained); err != nil {
+		log.Fatalf("-max-retained: %v", err)
+	}
+	if opts.diskSize, err = parseByteSize(diskSize); err != nil {
+		log.Fatalf("-disk-size: %v", err)
+	}
+	if interval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+	if (dropPattern == "") != (opts.dropAfter == 0) {
+		log.Fatal("the drop policy needs both -drop-after and -drop-pattern")
+	}
+	if dropPattern != "" {
+		if opts.dropPattern, err = regexp.Compile(dropPattern); err != nil {
+			log.Fatalf("-drop-pattern: %v", err)
+		}
+		if !once && opts.approveFile == "" {
+			log.Fatal("the drop policy needs -approve-file unless -once")
+		}
+		if fi, err := os.Stdin.Stat(); once && (err != nil || fi.Mode()&os.ModeCharDevice == 0) {
+			log.Fatal("-once with a drop policy asks for approval on a terminal")
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "slots", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	w := &slotWatchdog{opts: opts, pool: pool, metrics: newSlotMetrics(), alerts: alerts, firstInactive: map[string]time.Time{}}
+	if err := pool.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&w.version); err != nil {
+		log.Fatal(err)
+	}
+
+	if once {
+		fmt.Printf("Replication slots on %s:\n", describeTarget(pool.Config()))
+		w.dropApproved(ctx, w.poll(ctx, true), true)
+		if alerts.active() {
+			stop()
+			os.Exit(2)
+		}
+		return
+	}
+
+	if metricsAddr != "" {
+		serveMetrics(metricsAddr, w.metrics.collectors()...)
+	}
+	fmt.Printf("🎰 Watching replication slots on %s every %v\n", describeTarget(pool.Config()), interval)
+	for {
+		w.dropApproved(ctx, w.poll(ctx, false), false)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package dbre
+
+import "errors"
+
+// diskSpace can't measure volumes here: use -disk-size.
+func diskSpace(dir string) (free, size int64, err error) {
+	return 0, 0, errors.New("not supported on this platform, use -disk-size")
+}
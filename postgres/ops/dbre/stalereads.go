@@ -0,0 +1,539 @@
+package dbre
+
+// ============================================================================
+// READ-AFTER-WRITE CONSISTENCY CHECK (cmd/stale-reads)
+// ============================================================================
+//
+// An application that sends its reads to replicas reads its own writes
+// only once the replica has replayed them. stale-reads measures how often
+// and for how long that fails: -rate times a second it commits a marker
+// row on the primary (-dsn) and, as soon as the commit returns, looks for
+// it on every -replica-dsn, polling every -poll until it shows up:
+//   stale first read   the read right after the commit missed the row:
+//                      what a read-your-writes request would have seen
+//   staleness          commit acknowledged to the first read that saw the
+//                      row (0 when the first read did), p50/p95/p99/max
+//   behind             WAL between the marker and the replica's replay
+//                      position at a stale first read
+//   unconverged        the row still wasn't there after -converge-timeout:
+//                      a replica that stopped replaying, or a replica DSN
+//                      that doesn't lead to a standby of this primary
+// Every -interval it prints these per replica for the markers resolved in
+// the interval, and at the end for the run. Exit code 2 when a marker
+// never converged, or the p99 staleness of a replica is over
+// -max-staleness.
+//
+// Run it alone to see the baseline of an idle cluster, or next to the
+// read/write simulator (postgres/stress, e.g. with -outbox-writers) or the
+// bulk loader to see how far a replica falls behind under that load.
+// Marker rows go to -table (created if missing, its rows deleted at exit
+// unless -keep); the role needs to create it or INSERT and DELETE on it.
+// With synchronous_commit=remote_apply on the primary and the replicas in
+// synchronous_standby_names there should be no stale reads at all.
+//
+//   go run ./cmd/stale-reads -dsn=postgres://dbre@db1/avro -replica-dsn=postgres://dbre@db2/avro -duration=5m
+//   go run ./cmd/stale-reads -replica-dsn=postgres://dbre@db2/avro -replica-dsn=postgres://dbre@db3/avro -rate=50 -max-staleness=200ms
+//   go run ./cmd/stale-reads -replica-dsn=postgres://dbre@db2/avro -format=json > stale.ndjson
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// staleOptions are the command line settings.
+type staleOptions struct {
+	rate                   float64
+	poll, converge, maxLag time.Duration
+	duration, interval     time.Duration
+	table                  string
+	keep                   bool
+}
+
+// staleMarker is one committed marker row.
+type staleMarker struct {
+	seq       int64
+	lsn       string // WAL insert position after the INSERT
+	committed time.Time
+}
+
+// staleCounts are the outcomes of the markers checked on one replica.
+type staleCounts struct {
+	checked, staleFirst, unconverged, errors int64
+	maxBehind                                int64
+	staleness                                []float64 // ns, converged markers
+}
+
+// add folds o into c.
+func (c *staleCounts) add(o *staleCounts) {
+	c.checked += o.checked
+	c.staleFirst += o.staleFirst
+	c.unconverged += o.unconverged
+	c.errors += o.errors
+	c.maxBehind = max(c.maxBehind, o.maxBehind)
+	c.staleness = append(c.staleness, o.staleness...)
+}
+
+// staleReplicaReport is one replica's outcomes, for an interval or the run.
+type staleReplicaReport struct {
+	Replica     string        `json:"replica"`
+	Checked     int64         `json:"checked"`
+	StaleFirst  int64         `json:"stale_first_reads"`
+	StalePct    float64       `json:"stale_first_read_pct"`
+	Unconverged int64         `json:"unconverged"`
+	Errors      int64         `json:"errors"`
+	P50         time.Duration `json:"staleness_p50_ns"`
+	P95         time.Duration `json:"staleness_p95_ns"`
+	P99         time.Duration `json:"staleness_p99_ns"`
+	Max         time.Duration `json:"staleness_max_ns"`
+	MaxBehind   int64         `json:"max_behind_bytes"`
+}
+
+// report summarizes c; it sorts c.staleness.
+func (c *staleCounts) report(replica string) staleReplicaReport {
+	r := staleReplicaReport{
+		Replica:     replica,
+		Checked:     c.checked,
+		StaleFirst:  c.staleFirst,
+		Unconverged: c.unconverged,
+		Errors:      c.errors,
+		MaxBehind:   c.maxBehind,
+	}
+	if c.checked > 0 {
+		r.StalePct = 100 * float64(c.staleFirst) / float64(c.checked)
+	}
+	if n := len(c.staleness); n > 0 {
+		sort.Float64s(c.staleness)
+		r.P50 = time.Duration(percentile(c.staleness, 0.5))
+		r.P95 = time.Duration(percentile(c.staleness, 0.95))
+		r.P99 = time.Duration(percentile(c.staleness, 0.99))
+		r.Max = time.Duration(c.staleness[n-1])
+	}
+	return r
+}
+
+// staleReplica reads markers back from one replica.
+type staleReplica struct {
+	name string
+	pool *pgxpool.Pool
+	mu   sync.Mutex
+	in   staleCounts // Since the last interval
+	run  staleCounts
+}
+
+// staleInterval is what was resolved between two reports.
+type staleInterval struct {
+	Start      time.Time            `json:"start"`
+	End        time.Time            `json:"end"`
+	Written    int64                `json:"written"`
+	CommitP50  time.Duration        `json:"commit_p50_ns"`
+	CommitMax  time.Duration        `json:"commit_max_ns"`
+	Replicas   []staleReplicaReport `json:"replicas"`
+	commitLats []float64
+}
+
+// staleSummary is the report for the whole run.
+type staleSummary struct {
+	Primary   string               `json:"primary"`
+	Table     string               `json:"table"`
+	RunID     string               `json:"run_id"`
+	Start     time.Time            `json:"start"`
+	End       time.Time            `json:"end"`
+	Rate      float64              `json:"rate_per_sec"`
+	Written   int64                `json:"written"`
+	CommitP50 time.Duration        `json:"commit_p50_ns"`
+	CommitP99 time.Duration        `json:"commit_p99_ns"`
+	Replicas  []staleReplicaReport `json:"replicas"`
+	Failed    bool                 `json:"failed"`
+	Reasons   []string             `json:"reasons,omitempty"`
+}
+
+// staleChecker writes the markers and follows them on the replicas.
+type staleChecker struct {
+	opts     staleOptions
+	primary  *pgxpool.Pool
+	replicas []*staleReplica
+	table    string // Sanitized
+	runID    string
+	seq      int64
+	checks   sync.WaitGroup
+	verbose  bool
+
+	mu         sync.Mutex // Guards the commit latencies
+	commitLats []float64
+	runCommits []float64
+}
+
+// setup creates the marker table if it doesn't exist.
+func (s *staleChecker) setup(ctx context.Context) error {
+	var exists bool
+	if err := s.primary.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", s.opts.table).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil // No CREATE privilege needed
+	}
+	_, err := s.primary.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			run_id     text NOT NULL,
+			seq        bigint NOT NULL,
+			written_at timestamptz NOT NULL DEFAULT clock_timestamp(),
+			PRIMARY KEY (run_id, seq)
+		)`, s.table))
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// checkReplicas warns about replica DSNs that don't lead to a standby.
+func (s *staleChecker) checkReplicas(ctx context.Context) {
+	for _, r := range s.replicas {
+		var inRecovery bool
+		if err := r.pool.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %s: %v\n", r.name, err)
+		} else if !inRecovery {
+			fmt.Fprintf(os.Stderr, "⚠️  %s is not in recovery: it isn't a replica (promoted, or the primary itself?)\n", r.name)
+		}
+	}
+}
+
+// write commits the next marker.
+func (s *staleChecker) write(ctx context.Context) (staleMarker, error) {
+	s.seq++
+	m := staleMarker{seq: s.seq}
+	start := time.Now()
+	err := s.primary.QueryRow(ctx,
+		"INSERT INTO "+s.table+" (run_id, seq) VALUES ($1, $2) RETURNING pg_current_wal_insert_lsn()::text",
+		s.runID, m.seq).Scan(&m.lsn)
+	m.committed = time.Now()
+	if err != nil {
+		return m, err
+	}
+	lat := float64(m.committed.Sub(start))
+	s.mu.Lock()
+	s.commitLats = append(s.commitLats, lat)
+	s.runCommits = append(s.runCommits, lat)
+	s.mu.Unlock()
+	return m, nil
+}
+
+// follow reads m back from r until it's visible or -converge-timeout has
+// passed.
+func (s *staleChecker) follow(ctx context.Context, r *staleReplica, m staleMarker) {
+	defer s.checks.Done()
+	var c staleCounts
+	c.checked = 1
+	deadline := m.committed.Add(s.opts.converge)
+	for first := true; ; first = false {
+		seen, behind, readAt, err := s.read(ctx, r, m)
+		if err != nil {
+			if ctx.Err() != nil {
+				return // Interrupted: neither stale nor fresh
+			}
+			c.errors++
+			if s.verbose {
+				fmt.Fprintf(os.Stderr, "⚠️  %s: reading marker %d: %v\n", r.name, m.seq, err)
+			}
+			break
+		}
+		if seen {
+			staleness := time.Duration(0)
+			if !first {
+				staleness = readAt.Sub(m.committed)
+			}
+			c.staleness = append(c.staleness, float64(staleness))
+			break
+		}
+		if first {
+			c.staleFirst++
+			c.maxBehind = behind
+		}
+		if !time.Now().Before(deadline) {
+			c.unconverged++
+			fmt.Fprintf(os.Stderr, "❌ %s: marker %d (LSN %s) not visible after %v\n", r.name, m.seq, m.lsn, s.opts.converge)
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.opts.poll):
+		}
+	}
+	r.mu.Lock()
+	r.in.add(&c)
+	r.mu.Unlock()
+}
+
+// read looks for m on r once, with how far the replica's replay is behind
+// the marker's WAL position.
+func (s *staleChecker) read(ctx context.Context, r *staleReplica, m staleMarker) (bool, int64, time.Time, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	defer conn.Release()
+	// Timed after the acquire: waiting for a connection isn't staleness.
+	readAt := time.Now()
+	var seen bool
+	var behind int64
+	err = conn.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM `+s.table+` WHERE run_id = $1 AND seq = $2),
+		       greatest(coalesce(pg_wal_lsn_diff($3::pg_lsn, pg_last_wal_replay_lsn()), 0), 0)::bigint
+	`, s.runID, m.seq, m.lsn).Scan(&seen, &behind)
+	return seen, behind, readAt, err
+}
+
+// endInterval collects what was resolved since the last call.
+func (s *staleChecker) endInterval(start time.Time, written int64) staleInterval {
+	in := staleInterval{Start: start, End: time.Now(), Written: written}
+	s.mu.Lock()
+	in.commitLats, s.commitLats = s.commitLats, nil
+	s.mu.Unlock()
+	if n := len(in.commitLats); n > 0 {
+		sort.Float64s(in.commitLats)
+		in.CommitP50 = time.Duration(percentile(in.commitLats, 0.5))
+		in.CommitMax = time.Duration(in.commitLats[n-1])
+	}
+	for _, r := range s.replicas {
+		r.mu.Lock()
+		c := r.in
+		r.in = staleCounts{}
+		r.mu.Unlock()
+		r.run.add(&c)
+		in.Replicas = append(in.Replicas, c.report(r.name))
+	}
+	return in
+}
+
+// run writes markers at -rate until ctx ends, reporting every -interval,
+// then waits for the markers still being followed. It returns how many
+// markers were committed.
+func (s *staleChecker) run(ctx, followCtx context.Context, emit func(staleInterval)) int64 {
+	tick := time.NewTicker(time.Duration(float64(time.Second) / s.opts.rate))
+	defer tick.Stop()
+	report := time.NewTicker(s.opts.interval)
+	defer report.Stop()
+	start, written, total := time.Now(), int64(0), int64(0)
+	for {
+		select {
+		case <-ctx.Done():
+			s.checks.Wait()
+			if written > 0 || time.Since(start) > time.Second {
+				emit(s.endInterval(start, written))
+			}
+			return total
+		case <-report.C:
+			emit(s.endInterval(start, written))
+			start, written = time.Now(), 0
+		case <-tick.C:
+			m, err := s.write(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Writing marker %d: %v\n", m.seq, err)
+				}
+				continue
+			}
+			written++
+			total++
+			for _, r := range s.replicas {
+				s.checks.Add(1)
+				go s.follow(followCtx, r, m)
+			}
+		}
+	}
+}
+
+// summarize builds the run report, with the verdict.
+func (s *staleChecker) summarize(start time.Time, written int64) staleSummary {
+	sum := staleSummary{
+		Primary: describeTarget(s.primary.Config()),
+		Table:   s.table,
+		RunID:   s.runID,
+		Start:   start,
+		End:     time.Now(),
+		Rate:    s.opts.rate,
+		Written: written,
+	}
+	if n := len(s.runCommits); n > 0 {
+		sort.Float64s(s.runCommits)
+		sum.CommitP50 = time.Duration(percentile(s.runCommits, 0.5))
+		sum.CommitP99 = time.Duration(percentile(s.runCommits, 0.99))
+	}
+	for _, r := range s.replicas {
+		rep := r.run.report(r.name)
+		sum.Replicas = append(sum.Replicas, rep)
+		if rep.Unconverged > 0 {
+			sum.Reasons = append(sum.Reasons, fmt.Sprintf("%s: %d marker(s) never became visible", r.name, rep.Unconverged))
+		}
+		if s.opts.maxLag > 0 && rep.P99 > s.opts.maxLag {
+			sum.Reasons = append(sum.Reasons, fmt.Sprintf("%s: p99 staleness %v over -max-staleness %v",
+				r.name, rep.P99.Round(time.Millisecond), s.opts.maxLag))
+		}
+	}
+	sum.Failed = len(sum.Reasons) > 0
+	return sum
+}
+
+// cleanup deletes the run's markers.
+func (s *staleChecker) cleanup(ctx context.Context) {
+	if _, err := s.primary.Exec(ctx, "DELETE FROM "+s.table+" WHERE run_id = $1", s.runID); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Deleting the markers of run %s: %v\n", s.runID, err)
+	}
+}
+
+// printStaleInterval prints one interval line per replica.
+func printStaleInterval(in staleInterval) {
+	fmt.Printf("%s  %d written, commit p50 %v max %v\n", in.End.Format("15:04:05"), in.Written,
+		in.CommitP50.Round(10*time.Microsecond), in.CommitMax.Round(10*time.Microsecond))
+	for _, r := range in.Replicas {
+		fmt.Printf("   %-30s %5d checked  stale first %5.1f%%  staleness p50 %-8v p99 %-8v max %-8v behind %s",
+			r.Replica, r.Checked, r.StalePct, r.P50.Round(time.Millisecond), r.P99.Round(time.Millisecond),
+			r.Max.Round(time.Millisecond), formatBytes(r.MaxBehind))
+		if r.Unconverged > 0 {
+			fmt.Printf("  ❌ %d unconverged", r.Unconverged)
+		}
+		if r.Errors > 0 {
+			fmt.Printf("  ⚠️  %d errors", r.Errors)
+		}
+		fmt.Println()
+	}
+}
+
+// printStaleSummary prints the run report.
+func printStaleSummary(sum staleSummary) {
+	fmt.Printf("\n📋 Read-after-write consistency: %s, run %s\n", sum.Primary, sum.RunID)
+	fmt.Printf("   Markers:  %d in %v (%.1f/s target), commit p50 %v p99 %v\n", sum.Written,
+		sum.End.Sub(sum.Start).Round(time.Second), sum.Rate, sum.CommitP50.Round(10*time.Microsecond),
+		sum.CommitP99.Round(10*time.Microsecond))
+	for _, r := range sum.Replicas {
+		fmt.Printf("\n   %s\n", r.Replica)
+		fmt.Printf("      Stale first reads: %d of %d (%.1f%%), up to %s behind\n", r.StaleFirst, r.Checked, r.StalePct, formatBytes(r.MaxBehind))
+		fmt.Printf("      Staleness:         p50 %v  p95 %v  p99 %v  max %v\n", r.P50.Round(time.Millisecond),
+			r.P95.Round(time.Millisecond), r.P99.Round(time.Millisecond), r.Max.Round(time.Millisecond))
+		if r.Unconverged > 0 || r.Errors > 0 {
+			fmt.Printf("      Unconverged:       %d   Read errors: %d\n", r.Unconverged, r.Errors)
+		}
+	}
+	fmt.Println()
+	if sum.Failed {
+		for _, r := range sum.Reasons {
+			fmt.Printf("❌ %s\n", r)
+		}
+		return
+	}
+	fmt.Println("✅ Every marker became visible on every replica")
+}
+
+// StaleReads runs the stale-reads command line tool.
+func StaleReads() {
+	var dsn, format string
+	var replicaDSNs stringList
+	var opts staleOptions
+	var readers int
+	registerDSNFlag(&dsn)
+	flag.Var(&replicaDSNs, "replica-dsn", "Replica to read the markers back from (repeatable, at least one)")
+	flag.Float64Var(&opts.rate, "rate", 10, "Markers written per second")
+	flag.DurationVar(&opts.poll, "poll", 5*time.Millisecond, "Pause between reads of a marker not visible yet")
+	flag.DurationVar(&opts.converge, "converge-timeout", 30*time.Second, "Count a marker as never converged when it isn't visible after this")
+	flag.DurationVar(&opts.maxLag, "max-staleness", 0, "Fail when a replica's p99 staleness is over this (0: off)")
+	flag.DurationVar(&opts.duration, "duration", time.Minute, "How long to write markers (0: until interrupted)")
+	flag.DurationVar(&opts.interval, "interval", 10*time.Second, "Report interval")
+	flag.IntVar(&readers, "readers", 4, "Connections per replica for the reads")
+	flag.StringVar(&opts.table, "table", "dbre_stale_reads", "Marker table (created if missing)")
+	flag.BoolVar(&opts.keep, "keep", false, "Keep the run's marker rows")
+	flag.StringVar(&format, "format", "text", "Output format: text, or json (one interval per line, then the summary)")
+	flag.Parse()
+	if len(replicaDSNs) == 0 {
+		log.Fatal("at least one -replica-dsn is required")
+	}
+	if opts.rate <= 0 || opts.poll <= 0 || opts.converge <= 0 || opts.interval <= 0 || opts.duration < 0 {
+		log.Fatal("-rate, -poll, -converge-timeout and -interval must be positive")
+	}
+	if readers < 1 {
+		log.Fatal("-readers must be at least 1")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	primary, err := connect(sigCtx, dsn, "stale-reads", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer primary.Close()
+	s := &staleChecker{
+		opts:    opts,
+		primary: primary,
+		table:   pgx.Identifier(strings.Split(opts.table, ".")).Sanitize(),
+		runID:   fmt.Sprintf("%s-%d", time.Now().Format("20060102T150405"), os.Getpid()),
+		verbose: format == "text",
+	}
+	for _, d := range replicaDSNs {
+		pool, err := connect(sigCtx, d, "stale-reads", int32(readers))
+		if err != nil {
+			log.Fatalf("-replica-dsn: %v", err)
+		}
+		defer pool.Close()
+		s.replicas = append(s.replicas, &staleReplica{name: describeTarget(pool.Config()), pool: pool})
+	}
+	if err := s.setup(sigCtx); err != nil {
+		log.Fatal(err)
+	}
+	s.checkReplicas(sigCtx)
+
+	enc := json.NewEncoder(os.Stdout)
+	emit := func(in staleInterval) {
+		if format == "json" {
+			if err := enc.Encode(in); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		printStaleInterval(in)
+	}
+	if format == "text" {
+		fmt.Printf("🔁 Writing %.1f markers/s to %s on %s, reading them back from %d replica(s)\n",
+			opts.rate, s.table, describeTarget(primary.Config()), len(s.replicas))
+	}
+
+	// The markers stop at -duration; the reads of the last ones go on
+	// until they converge, unless interrupted.
+	ctx, cancel := sigCtx, context.CancelFunc(func() {})
+	if opts.duration > 0 {
+		ctx, cancel = context.WithTimeout(sigCtx, opts.duration)
+	}
+	defer cancel()
+	start := time.Now()
+	written := s.run(ctx, sigCtx, emit)
+	if !opts.keep {
+		s.cleanup(context.Background())
+	}
+
+	sum := s.summarize(start, written)
+	if format == "json" {
+		if err := enc.Encode(sum); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printStaleSummary(sum)
+	}
+	if sum.Failed {
+		primary.Close()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,387 @@
+package dbre
+
+// ============================================================================
+// TOAST USAGE AND COMPRESSION (cmd/toast-audit)
+// ============================================================================
+//
+// Values over ~2 kB are compressed and, if still too big, moved out of line
+// into the table's TOAST relation in ~2 kB chunks. For wide tables most of
+// the bytes, and often most of the reads, are in TOAST. toast-audit lists
+// the tables whose TOAST relation is at least -min-size with:
+//   table      heap, TOAST and TOAST index sizes, chunk count, and the
+//              share of the table's blocks read that were TOAST blocks
+//   columns    every variable-width column: storage (plain, main,
+//              external, extended), compression method (PostgreSQL 14+)
+//              and, from a sample of -sample-rows rows (TABLESAMPLE
+//              SYSTEM), the average stored and raw widths, the
+//              compression ratio and the share of values compressed with
+//              pglz and lz4. Raw widths are octet_length, of the text form
+//              for types without one (jsonb, arrays, ...)
+// With -sample-rows=0 nothing is read from the tables and the widths come
+// from pg_stats (stored width only). Sampling needs SELECT on the tables.
+//
+// Recommendations (for columns averaging at least -min-width raw):
+//   lz4        values compressed with pglz at least a fifth of the time,
+//              when the server has lz4: about as small, several times
+//              faster to compress and decompress
+//   external   values large enough to compress that barely shrink
+//              (ratio above 0.9: already compressed images, archives,
+//              random tokens): skip the wasted compression, and
+//              substring() reads only the chunks it needs
+// Both only apply to values written afterwards; existing rows keep their
+// format until they are rewritten (UPDATE, pg_repack, VACUUM FULL).
+// Nothing is changed; the report ends with the ALTER TABLE statements.
+//
+//   go run ./cmd/toast-audit -dsn=postgres://dbre@db1/avro
+//   go run ./cmd/toast-audit -schema=public -min-size=1GB -sample-rows=20000 -format=json
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// storageNames are the attstorage codes.
+var storageNames = map[string]string{"p": "plain", "m": "main", "e": "external", "x": "extended"}
+
+// toastColumn is one variable-width column of a TOASTed table.
+type toastColumn struct {
+	Name        string `json:"column"`
+	Type        string `json:"type"`
+	Storage     string `json:"storage"`
+	Compression string `json:"compression,omitempty"` // Column setting; empty: default_toast_compression
+	// From the sample (stored width from pg_stats without one).
+	AvgStored float64  `json:"avg_stored_bytes"`
+	AvgRaw    *float64 `json:"avg_raw_bytes,omitempty"`
+	Ratio     *float64 `json:"compression_ratio,omitempty"` // Stored / raw
+	PglzPct   *float64 `json:"pglz_pct,omitempty"`          // Values compressed with pglz
+	LZ4Pct    *float64 `json:"lz4_pct,omitempty"`
+
+	hasOctetLength bool
+}
+
+// toastTable is a table with a TOAST relation worth looking at.
+type toastTable struct {
+	Schema       string         `json:"schema"`
+	Table        string         `json:"table"`
+	Rows         int64          `json:"rows"`
+	HeapBytes    int64          `json:"heap_bytes"`
+	ToastBytes   int64          `json:"toast_bytes"`
+	ToastIndex   int64          `json:"toast_index_bytes"`
+	Chunks       int64          `json:"toast_chunks"`
+	ToastReadPct float64        `json:"toast_read_pct"` // TOAST blocks among the table's blocks read (hit or not)
+	Sampled      int64          `json:"sampled_rows"`
+	Columns      []*toastColumn `json:"columns"`
+	Advice       []toastAdvice  `json:"advice,omitempty"`
+}
+
+// qualified is the table name as ALTER TABLE takes it.
+func (t *toastTable) qualified() string {
+	return pgx.Identifier{t.Schema, t.Table}.Sanitize()
+}
+
+// toastAdvice is one recommended column change.
+type toastAdvice struct {
+	Column string `json:"column"`
+	Kind   string `json:"kind"` // lz4 or external
+	Reason string `json:"reason"`
+	SQL    string `json:"sql"`
+}
+
+// toastAudit is the result of auditToast.
+type toastAudit struct {
+	Database           string        `json:"database"`
+	DefaultCompression string        `json:"default_toast_compression,omitempty"`
+	LZ4                bool          `json:"lz4_available"`
+	Tables             []*toastTable `json:"tables"`
+}
+
+// toastOptions are the flags of toast-audit.
+type toastOptions struct {
+	schema     string
+	minSize    int64
+	minWidth   float64
+	sampleRows int64
+	top        int
+}
+
+// octetLengthTypes have an octet_length that reports the raw size
+// without detoasting.
+var octetLengthTypes = map[string]bool{"text": true, "character varying": true, "character": true, "bytea": true}
+
+// auditToast reads the TOASTed tables and their columns.
+func auditToast(ctx context.Context, pool *pgxpool.Pool, opts toastOptions) (*toastAudit, error) {
+	audit := &toastAudit{}
+	var version int
+	if err := pool.QueryRow(ctx, `SELECT current_database()::text, current_setting('server_version_num')::int`).
+		Scan(&audit.Database, &version); err != nil {
+		return nil, err
+	}
+	if version >= 140000 {
+		if err := pool.QueryRow(ctx, `
+			SELECT setting, 'lz4' = ANY (enumvals) FROM pg_settings WHERE name = 'default_toast_compression'
+		`).Scan(&audit.DefaultCompression, &audit.LZ4); err != nil {
+			return nil, fmt.Errorf("failed to read default_toast_compression: %w", err)
+		}
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT n.nspname::text, c.relname::text, greatest(c.reltuples, 0)::int8,
+		       pg_relation_size(c.oid), pg_relation_size(c.reltoastrelid),
+		       pg_indexes_size(c.reltoastrelid), greatest(tc.reltuples, 0)::int8,
+		       coalesce(100.0 * (s.toast_blks_read + s.toast_blks_hit)
+		                / nullif(s.heap_blks_read + s.heap_blks_hit + s.toast_blks_read + s.toast_blks_hit, 0), 0)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class tc ON tc.oid = c.reltoastrelid
+		LEFT JOIN pg_statio_all_tables s ON s.relid = c.oid
+		WHERE c.relkind IN ('r', 'm') AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		  AND pg_relation_size(c.reltoastrelid) >= $1 AND ($2 = '' OR n.nspname = $2)
+		ORDER BY pg_relation_size(c.reltoastrelid) DESC
+		LIMIT nullif($3, 0)
+	`, opts.minSize, opts.schema, opts.top)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TOAST tables: %w", err)
+	}
+	audit.Tables, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*toastTable, error) {
+		t := &toastTable{}
+		err := row.Scan(&t.Schema, &t.Table, &t.Rows, &t.HeapBytes, &t.ToastBytes, &t.ToastIndex, &t.Chunks, &t.ToastReadPct)
+		return t, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TOAST tables: %w", err)
+	}
+
+	compression := "''"
+	if version >= 140000 {
+		compression = "a.attcompression::text"
+	}
+	for _, t := range audit.Tables {
+		rows, err := pool.Query(ctx, fmt.Sprintf(`
+			SELECT a.attname::text, format_type(a.atttypid, NULL), a.attstorage::text, %s,
+			       coalesce(s.avg_width, 0)::float8
+			FROM pg_attribute a
+			LEFT JOIN pg_stats s ON s.schemaname = $1 AND s.tablename = $2 AND s.attname = a.attname
+			WHERE a.attrelid = to_regclass($3) AND a.attnum > 0 AND NOT a.attisdropped AND a.attlen = -1
+			ORDER BY a.attnum
+		`, compression), t.Schema, t.Table, t.qualified())
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read columns: %w", t.qualified(), err)
+		}
+		t.Columns, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*toastColumn, error) {
+			c := &toastColumn{}
+			var storage, method string
+			err := row.Scan(&c.Name, &c.Type, &storage, &method, &c.AvgStored)
+			c.Storage = storageNames[storage]
+			c.Compression = map[string]string{"p": "pglz", "l": "lz4"}[method]
+			c.hasOctetLength = octetLengthTypes[c.Type]
+			return c, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read columns: %w", t.qualified(), err)
+		}
+		if opts.sampleRows > 0 && len(t.Columns) > 0 {
+			if err := sampleToastColumns(ctx, pool, t, opts.sampleRows, version >= 140000); err != nil {
+				return nil, err
+			}
+		}
+		t.advise(audit, opts)
+	}
+	return audit, nil
+}
+
+// sampleToastColumns measures the stored and raw widths of t's columns on
+// a TABLESAMPLE SYSTEM sample of about n rows.
+func sampleToastColumns(ctx context.Context, pool *pgxpool.Pool, t *toastTable, n int64, compression bool) error {
+	pct := 100.0
+	if t.Rows > n {
+		pct = max(float64(n)*100/float64(t.Rows), 0.0001)
+	}
+	exprs := []string{"count(*)"}
+	for _, c := range t.Columns {
+		col := pgx.Identifier{c.Name}.Sanitize()
+		raw := "octet_length(" + col + ")"
+		if !c.hasOctetLength {
+			raw = "octet_length(" + col + "::text)"
+		}
+		exprs = append(exprs, "coalesce(avg(pg_column_size("+col+")), 0)::float8", "coalesce(avg("+raw+"), 0)::float8")
+		if compression {
+			exprs = append(exprs,
+				"count(*) FILTER (WHERE pg_column_compression("+col+") = 'pglz')",
+				"count(*) FILTER (WHERE pg_column_compression("+col+") = 'lz4')",
+				"count("+col+")")
+		}
+	}
+	sql := fmt.Sprintf("SELECT %s FROM (SELECT * FROM %s TABLESAMPLE SYSTEM (%g) LIMIT %d) s",
+		strings.Join(exprs, ", "), t.qualified(), pct, n)
+
+	type colSample struct {
+		stored, raw      float64
+		pglz, lz4, total int64
+	}
+	samples := make([]colSample, len(t.Columns))
+	dest := []any{&t.Sampled}
+	for i := range samples {
+		dest = append(dest, &samples[i].stored, &samples[i].raw)
+		if compression {
+			dest = append(dest, &samples[i].pglz, &samples[i].lz4, &samples[i].total)
+		}
+	}
+	if err := pool.QueryRow(ctx, sql).Scan(dest...); err != nil {
+		return fmt.Errorf("%s: failed to sample rows: %w", t.qualified(), err)
+	}
+	if t.Sampled == 0 {
+		return nil
+	}
+	for i, c := range t.Columns {
+		s := samples[i]
+		c.AvgStored = s.stored
+		raw := s.raw
+		c.AvgRaw = &raw
+		if raw > 0 {
+			ratio := s.stored / raw
+			c.Ratio = &ratio
+		}
+		if compression && s.total > 0 {
+			pglz, lz4 := float64(s.pglz)/float64(s.total)*100, float64(s.lz4)/float64(s.total)*100
+			c.PglzPct, c.LZ4Pct = &pglz, &lz4
+		}
+	}
+	return nil
+}
+
+// advise derives the column recommendations of t.
+func (t *toastTable) advise(audit *toastAudit, opts toastOptions) {
+	for _, c := range t.Columns {
+		if c.AvgRaw == nil || *c.AvgRaw < opts.minWidth || c.Storage == "plain" {
+			continue
+		}
+		col := pgx.Identifier{c.Name}.Sanitize()
+		switch {
+		case c.Ratio != nil && *c.Ratio > 0.9 && c.Storage == "extended":
+			t.Advice = append(t.Advice, toastAdvice{
+				Column: c.Name, Kind: "external",
+				Reason: fmt.Sprintf("average %s raw, compresses only to %.0f%%", formatBytes(int64(*c.AvgRaw)), *c.Ratio*100),
+				SQL:    fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET STORAGE EXTERNAL;", t.qualified(), col),
+			})
+		case audit.LZ4 && c.PglzPct != nil && *c.PglzPct >= 20 && c.Compression != "lz4":
+			t.Advice = append(t.Advice, toastAdvice{
+				Column: c.Name, Kind: "lz4",
+				Reason: fmt.Sprintf("%.0f%% of values compressed with pglz, average %s raw", *c.PglzPct, formatBytes(int64(*c.AvgRaw))),
+				SQL:    fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET COMPRESSION lz4;", t.qualified(), col),
+			})
+		}
+	}
+}
+
+// printToastAudit writes the report for a person.
+func printToastAudit(audit *toastAudit) {
+	fmt.Printf("🧱 TOAST in %s: %d tables", audit.Database, len(audit.Tables))
+	if audit.DefaultCompression != "" {
+		fmt.Printf(", default_toast_compression=%s, lz4 %s", audit.DefaultCompression,
+			map[bool]string{true: "available", false: "not built in"}[audit.LZ4])
+	}
+	fmt.Println()
+	if len(audit.Tables) == 0 {
+		fmt.Println("✅ No TOAST relation over -min-size")
+		return
+	}
+
+	var advice []string
+	for _, t := range audit.Tables {
+		fmt.Printf("\n%s  heap %s, TOAST %s (+%s index), %d chunks, %.0f%% of block reads in TOAST\n",
+			t.Schema+"."+t.Table, formatBytes(t.HeapBytes), formatBytes(t.ToastBytes), formatBytes(t.ToastIndex),
+			t.Chunks, t.ToastReadPct)
+		if t.Sampled > 0 {
+			fmt.Printf("   %-28s %-22s %-9s %-6s %10s %10s %6s %6s %6s\n",
+				"Column", "Type", "Storage", "Method", "Stored", "Raw", "Ratio", "pglz", "lz4")
+		} else {
+			fmt.Printf("   %-28s %-22s %-9s %-6s %10s   (pg_stats, no sample)\n", "Column", "Type", "Storage", "Method", "Stored")
+		}
+		for _, c := range t.Columns {
+			method := c.Compression
+			if method == "" {
+				method = "-"
+			}
+			line := fmt.Sprintf("   %-28s %-22s %-9s %-6s %10s", oneLine(c.Name, 28), oneLine(c.Type, 22), c.Storage, method,
+				formatBytes(int64(c.AvgStored)))
+			if c.AvgRaw != nil {
+				line += fmt.Sprintf(" %10s %6s %6s %6s", formatBytes(int64(*c.AvgRaw)), optionalPct(c.Ratio, 100),
+					optionalPct(c.PglzPct, 1), optionalPct(c.LZ4Pct, 1))
+			}
+			fmt.Println(line)
+		}
+		for _, a := range t.Advice {
+			fmt.Printf("   → %s %s: %s\n", a.Column, a.Kind, a.Reason)
+			advice = append(advice, a.SQL)
+		}
+	}
+
+	if len(advice) == 0 {
+		fmt.Println("\n✅ No compression or storage changes to recommend")
+		return
+	}
+	fmt.Println("\nTo apply (affects values written afterwards):")
+	for _, sql := range advice {
+		fmt.Printf("   %s\n", sql)
+	}
+}
+
+// optionalPct renders *v times scale as a percentage, or "-".
+func optionalPct(v *float64, scale float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", *v*scale)
+}
+
+// ToastAudit runs the toast-audit command line tool.
+func ToastAudit() {
+	var dsn, minSize, format string
+	opts := toastOptions{}
+	registerDSNFlag(&dsn)
+	flag.StringVar(&opts.schema, "schema", "", "Only audit this schema (default: all)")
+	flag.StringVar(&minSize, "min-size", "64MB", "Leave out tables whose TOAST relation is smaller")
+	flag.Float64Var(&opts.minWidth, "min-width", 2048, "Only advise on columns averaging at least this many raw bytes")
+	flag.Int64Var(&opts.sampleRows, "sample-rows", 10000, "Rows sampled per table (0: no sampling, pg_stats widths)")
+	flag.IntVar(&opts.top, "top", 20, "Tables to report, largest TOAST first (0: all)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+
+	var err error
+	if opts.minSize, err = parseByteSize(minSize); err != nil {
+		log.Fatalf("-min-size: %v", err)
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx := context.Background()
+	pool, err := connect(ctx, dsn, "toast-audit", 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	audit, err := auditToast(ctx, pool, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(audit); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printToastAudit(audit)
+}
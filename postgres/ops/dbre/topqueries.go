@@ -0,0 +1,527 @@
+package dbre
+
+// ============================================================================
+// TOP QUERIES WITH PERIOD DIFFS (cmd/topqueries)
+// ============================================================================
+//
+// pg_stat_statements counters are cumulative since the last reset, so
+// "what got worse since yesterday" needs two readings. topqueries stores
+// snapshots of pg_stat_statements (gzipped JSON, one file per snapshot in
+// -dir) and compares any two of them:
+//   -mode=snapshot   take a snapshot; -keep=N prunes all but the newest N
+//                    (run it from cron, e.g. hourly)
+//   -mode=list       the stored snapshots
+//   -mode=diff       what ran between -from and -to (snapshot IDs, unique
+//                    prefixes of them, or "now" for a live reading; default
+//                    the two newest snapshots):
+//                      heavy hitters   most execution time in the period,
+//                                      NEW when the statement wasn't in the
+//                                      earlier snapshot
+//                      regressed       mean time in the period at least
+//                                      -regress times its mean before, over
+//                                      at least -min-calls calls
+//                      temp usage      most temp blocks written in the
+//                                      period, and per call before and after
+//   -mode=top        the cumulative top statements right now
+// -format=json exports the diff or top for tickets and dashboards.
+//
+// A counter reset between the two snapshots (pg_stat_statements_reset(),
+// or a statement evicted and seen again) is detected and the later values
+// are used as the period's. The extension must be installed in the database
+// -dsn points at; it reports statements of every database.
+//
+// Statements are matched by their fingerprint (package sqlfingerprint), not
+// by queryid: the entries of one query with IN lists of different lengths
+// count as one, and snapshots of another server or major version compare.
+//
+//   go run ./cmd/topqueries -mode=snapshot -dir=/var/lib/dbre/topqueries -keep=336
+//   go run ./cmd/topqueries -mode=diff -dir=/var/lib/dbre/topqueries -from=20261016T0900 -to=now
+
+import (
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/sqlfingerprint"
+)
+
+// snapshotIDFormat names snapshots by their UTC time.
+const snapshotIDFormat = "20060102T150405Z"
+
+// statementStat is one pg_stat_statements entry.
+type statementStat struct {
+	QueryID     int64   `json:"queryid"`
+	Fingerprint string  `json:"fingerprint"`
+	UserID      int64   `json:"userid"`
+	DBID        int64   `json:"dbid"`
+	TopLevel    bool    `json:"toplevel"`
+	User        string  `json:"user"`
+	Database    string  `json:"database"`
+	Query       string  `json:"query"`
+	Calls       int64   `json:"calls"`
+	TotalMS     float64 `json:"total_exec_time_ms"`
+	Rows        int64   `json:"rows"`
+	SharedHit   int64   `json:"shared_blks_hit"`
+	SharedRead  int64   `json:"shared_blks_read"`
+	TempWritten int64   `json:"temp_blks_written"`
+	WALBytes    int64   `json:"wal_bytes"`
+}
+
+// key identifies the statement across snapshots. It uses the fingerprint,
+// not queryid: queryid differs between servers and major versions, and for
+// every length of an IN list.
+func (s *statementStat) key() string {
+	return fmt.Sprintf("%d/%d/%s/%t", s.DBID, s.UserID, s.Fingerprint, s.TopLevel)
+}
+
+// mergeStatements sums the entries with the same key; the merged entry
+// keeps the queryid and text of its most called entry.
+func mergeStatements(statements []statementStat) []statementStat {
+	merged := make([]statementStat, 0, len(statements))
+	index := map[string]int{}
+	for _, s := range statements {
+		if s.Fingerprint == "" {
+			s.Fingerprint = sqlfingerprint.Fingerprint(s.Query)
+		}
+		i, ok := index[s.key()]
+		if !ok {
+			index[s.key()] = len(merged)
+			merged = append(merged, s)
+			continue
+		}
+		m := &merged[i]
+		if s.Calls > m.Calls {
+			m.QueryID, m.Query = s.QueryID, s.Query
+		}
+		m.Calls += s.Calls
+		m.TotalMS += s.TotalMS
+		m.Rows += s.Rows
+		m.SharedHit += s.SharedHit
+		m.SharedRead += s.SharedRead
+		m.TempWritten += s.TempWritten
+		m.WALBytes += s.WALBytes
+	}
+	return merged
+}
+
+// meanMS is the mean execution time, in milliseconds.
+func (s *statementStat) meanMS() float64 {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.TotalMS / float64(s.Calls)
+}
+
+// statementSnapshot is pg_stat_statements at one moment.
+type statementSnapshot struct {
+	ID         string          `json:"id"`
+	Taken      time.Time       `json:"taken"`
+	Server     string          `json:"server"`
+	StatsReset *time.Time      `json:"stats_reset,omitempty"`
+	Statements []statementStat `json:"statements"`
+}
+
+// readStatements takes a snapshot of pg_stat_statements.
+func readStatements(ctx context.Context, pool *pgxpool.Pool) (*statementSnapshot, error) {
+	var version int
+	if err := pool.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return nil, err
+	}
+	total, wal, toplevel := "s.total_time", "0", "true"
+	if version >= 130000 {
+		total, wal = "s.total_exec_time", "s.wal_bytes"
+	}
+	if version >= 140000 {
+		toplevel = "s.toplevel"
+	}
+	snap := &statementSnapshot{Taken: time.Now().UTC().Truncate(time.Second), Server: describeTarget(pool.Config())}
+	snap.ID = snap.Taken.Format(snapshotIDFormat)
+	if version >= 140000 {
+		if err := pool.QueryRow(ctx, "SELECT stats_reset FROM pg_stat_statements_info").Scan(&snap.StatsReset); err != nil {
+			return nil, statementsError(err)
+		}
+	}
+
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT coalesce(s.queryid, 0), s.userid::bigint, s.dbid::bigint, %s,
+		       coalesce(r.rolname::text, ''), coalesce(d.datname::text, ''), coalesce(s.query, ''),
+		       s.calls, %s, s.rows, s.shared_blks_hit, s.shared_blks_read, s.temp_blks_written, %s::bigint
+		FROM pg_stat_statements s
+		LEFT JOIN pg_roles r ON r.oid = s.userid
+		LEFT JOIN pg_database d ON d.oid = s.dbid
+	`, toplevel, total, wal))
+	if err != nil {
+		return nil, statementsError(err)
+	}
+	snap.Statements, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (statementStat, error) {
+		var s statementStat
+		err := row.Scan(&s.QueryID, &s.UserID, &s.DBID, &s.TopLevel, &s.User, &s.Database, &s.Query,
+			&s.Calls, &s.TotalMS, &s.Rows, &s.SharedHit, &s.SharedRead, &s.TempWritten, &s.WALBytes)
+		s.Fingerprint = sqlfingerprint.Fingerprint(s.Query)
+		return s, err
+	})
+	if err != nil {
+		return nil, statementsError(err)
+	}
+	return snap, nil
+}
+
+// statementsError explains the usual failure.
+func statementsError(err error) error {
+	return fmt.Errorf("failed to read pg_stat_statements (is the extension created in this database and in shared_preload_libraries?): %w", err)
+}
+
+// saveSnapshot writes snap to dir and prunes all but the newest keep.
+func saveSnapshot(dir string, snap *statementSnapshot, keep int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, snap.ID+".json.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(snap)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	if keep > 0 {
+		ids, err := listSnapshots(dir)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids[:max(len(ids)-keep, 0)] {
+			os.Remove(filepath.Join(dir, id+".json.gz"))
+		}
+	}
+	return nil
+}
+
+// listSnapshots returns the stored snapshot IDs, oldest first.
+func listSnapshots(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json.gz"))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, p := range paths {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(p), ".json.gz"))
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// loadSnapshot reads the snapshot whose ID starts with prefix.
+func loadSnapshot(dir, prefix string) (*statementSnapshot, error) {
+	ids, err := listSnapshots(dir)
+	if err != nil {
+		return nil, err
+	}
+	var match []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, prefix) {
+			match = append(match, id)
+		}
+	}
+	switch {
+	case len(match) == 0:
+		return nil, fmt.Errorf("no snapshot %q in %s", prefix, dir)
+	case len(match) > 1:
+		return nil, fmt.Errorf("snapshot %q is ambiguous: %s", prefix, strings.Join(match, ", "))
+	}
+
+	f, err := os.Open(filepath.Join(dir, match[0]+".json.gz"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", match[0], err)
+	}
+	var snap statementSnapshot
+	if err := json.NewDecoder(zr).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", match[0], err)
+	}
+	return &snap, nil
+}
+
+// statementDelta is what a statement did between two snapshots.
+type statementDelta struct {
+	statementStat
+	New        bool    `json:"new"`
+	BeforeMean float64 `json:"mean_ms_before"`
+	PeriodMean float64 `json:"mean_ms_period"`
+	TempBefore float64 `json:"temp_blks_per_call_before"`
+	TempPeriod float64 `json:"temp_blks_per_call_period"`
+}
+
+// statementDiff compares two snapshots.
+type statementDiff struct {
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Period    string            `json:"period"`
+	Reset     bool              `json:"counters_reset"`
+	TotalMS   float64           `json:"total_exec_time_ms"`
+	Calls     int64             `json:"calls"`
+	Heavy     []*statementDelta `json:"heavy_hitters"`
+	Regressed []*statementDelta `json:"regressed"`
+	Temp      []*statementDelta `json:"temp_usage"`
+}
+
+// diffOptions are the thresholds of -mode=diff.
+type diffOptions struct {
+	top      int
+	regress  float64
+	minCalls int64
+}
+
+// diffStatements computes what ran between from and to.
+func diffStatements(from, to *statementSnapshot, opts diffOptions) *statementDiff {
+	d := &statementDiff{From: from.ID, To: to.ID, Period: formatAge(to.Taken.Sub(from.Taken))}
+	d.Reset = to.StatsReset != nil && (from.StatsReset == nil || to.StatsReset.After(*from.StatsReset))
+	before := map[string]*statementStat{}
+	if !d.Reset {
+		earlier := mergeStatements(from.Statements)
+		for i := range earlier {
+			before[earlier[i].key()] = &earlier[i]
+		}
+	}
+
+	var deltas []*statementDelta
+	for _, s := range mergeStatements(to.Statements) {
+		delta := &statementDelta{statementStat: s}
+		prev := before[s.key()]
+		switch {
+		case prev == nil:
+			delta.New = true
+		case s.Calls >= prev.Calls:
+			delta.Calls -= prev.Calls
+			delta.TotalMS -= prev.TotalMS
+			delta.Rows -= prev.Rows
+			delta.SharedHit -= prev.SharedHit
+			delta.SharedRead -= prev.SharedRead
+			delta.TempWritten -= prev.TempWritten
+			delta.WALBytes -= prev.WALBytes
+			delta.BeforeMean = prev.meanMS()
+			if prev.Calls > 0 {
+				delta.TempBefore = float64(prev.TempWritten) / float64(prev.Calls)
+			}
+		default:
+			// Fewer calls than before: evicted and seen again, the
+			// entry started over within the period.
+		}
+		if delta.Calls == 0 {
+			continue
+		}
+		delta.PeriodMean = delta.meanMS()
+		delta.TempPeriod = float64(delta.TempWritten) / float64(delta.Calls)
+		d.TotalMS += delta.TotalMS
+		d.Calls += delta.Calls
+		deltas = append(deltas, delta)
+	}
+
+	topBy := func(keep func(*statementDelta) bool, by func(*statementDelta) float64) []*statementDelta {
+		list := slices.DeleteFunc(slices.Clone(deltas), func(x *statementDelta) bool { return !keep(x) })
+		slices.SortFunc(list, func(a, b *statementDelta) int { return cmp.Compare(by(b), by(a)) })
+		return list[:min(len(list), opts.top)]
+	}
+	d.Heavy = topBy(func(*statementDelta) bool { return true }, func(x *statementDelta) float64 { return x.TotalMS })
+	d.Regressed = topBy(func(x *statementDelta) bool {
+		return !x.New && x.Calls >= opts.minCalls && x.BeforeMean > 0 && x.PeriodMean >= opts.regress*x.BeforeMean
+	}, func(x *statementDelta) float64 { return (x.PeriodMean - x.BeforeMean) * float64(x.Calls) })
+	d.Temp = topBy(func(x *statementDelta) bool { return x.TempWritten > 0 },
+		func(x *statementDelta) float64 { return float64(x.TempWritten) })
+	return d
+}
+
+// printStatementDiff writes the diff for a person.
+func printStatementDiff(d *statementDiff, blockSize int64) {
+	fmt.Printf("📊 pg_stat_statements from %s to %s (%s): %d calls, %.1fs execution time\n",
+		d.From, d.To, d.Period, d.Calls, d.TotalMS/1000)
+	if d.Reset {
+		fmt.Println("   ⚠️  Counters were reset in between: the period starts at the reset")
+	}
+
+	fmt.Printf("\nHEAVY HITTERS\n")
+	fmt.Printf("   %10s %6s %12s %10s %10s  %s\n", "TIME (s)", "SHARE", "CALLS", "MEAN ms", "BEFORE", "QUERY")
+	for _, x := range d.Heavy {
+		before := fmt.Sprintf("%.2f", x.BeforeMean)
+		switch {
+		case x.New:
+			before = "NEW"
+		case x.BeforeMean == 0:
+			before = "-"
+		}
+		fmt.Printf("   %10.1f %5.1f%% %12d %10.2f %10s  %s\n", x.TotalMS/1000, 100*x.TotalMS/max(d.TotalMS, 1),
+			x.Calls, x.PeriodMean, before, statementLabel(x))
+	}
+
+	if len(d.Regressed) > 0 {
+		fmt.Printf("\nREGRESSED (mean time)\n")
+		fmt.Printf("   %10s %10s %7s %12s  %s\n", "BEFORE ms", "NOW ms", "×", "CALLS", "QUERY")
+		for _, x := range d.Regressed {
+			fmt.Printf("   %10.2f %10.2f %6.1fx %12d  %s\n", x.BeforeMean, x.PeriodMean, x.PeriodMean/x.BeforeMean,
+				x.Calls, statementLabel(x))
+		}
+	}
+
+	if len(d.Temp) > 0 {
+		fmt.Printf("\nTEMP USAGE\n")
+		fmt.Printf("   %10s %12s %12s  %s\n", "WRITTEN", "PER CALL", "BEFORE", "QUERY")
+		for _, x := range d.Temp {
+			fmt.Printf("   %10s %12s %12s  %s\n", formatBytes(x.TempWritten*blockSize),
+				formatBytes(int64(x.TempPeriod*float64(blockSize))), formatBytes(int64(x.TempBefore*float64(blockSize))),
+				statementLabel(x))
+		}
+	}
+}
+
+// statementLabel is a statement's database, user, fingerprint and text on
+// one line.
+func statementLabel(x *statementDelta) string {
+	return fmt.Sprintf("%s/%s %s: %s", x.Database, x.User, x.Fingerprint, oneLine(x.Query, 100))
+}
+
+// emptySnapshot is the starting point for the cumulative top.
+func emptySnapshot() *statementSnapshot {
+	return &statementSnapshot{ID: "reset"}
+}
+
+// TopQueries runs the topqueries command line tool.
+func TopQueries() {
+	var dsn, mode, dir, from, to, format string
+	var keep int
+	var opts diffOptions
+	registerDSNFlag(&dsn)
+	flag.StringVar(&mode, "mode", "diff", "snapshot, list, diff or top")
+	flag.StringVar(&dir, "dir", "topqueries", "Directory of the stored snapshots")
+	flag.IntVar(&keep, "keep", 0, "With -mode=snapshot: keep only the newest N snapshots (0: all)")
+	flag.StringVar(&from, "from", "", "Earlier snapshot (ID or unique prefix; default: second newest)")
+	flag.StringVar(&to, "to", "", "Later snapshot (ID, unique prefix or now; default: newest)")
+	flag.IntVar(&opts.top, "top", 15, "Statements per section")
+	flag.Float64Var(&opts.regress, "regress", 1.5, "Report statements whose mean time grew by this factor")
+	flag.Int64Var(&opts.minCalls, "min-calls", 20, "Only judge regressions over at least this many calls")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx := context.Background()
+	var pool *pgxpool.Pool
+	live := func() *statementSnapshot {
+		var err error
+		if pool == nil {
+			if pool, err = connect(ctx, dsn, "topqueries", 1); err != nil {
+				log.Fatal(err)
+			}
+		}
+		snap, err := readStatements(ctx, pool)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return snap
+	}
+	blockSize := int64(8192)
+
+	var diff *statementDiff
+	switch mode {
+	case "snapshot":
+		snap := live()
+		if err := saveSnapshot(dir, snap, keep); err != nil {
+			log.Fatalf("failed to store the snapshot: %v", err)
+		}
+		fmt.Printf("📸 Snapshot %s: %d statements from %s\n", snap.ID, len(snap.Statements), snap.Server)
+		return
+	case "list":
+		ids, err := listSnapshots(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return
+	case "top":
+		diff = diffStatements(emptySnapshot(), live(), opts)
+		diff.Period = "since reset"
+		for _, x := range diff.Heavy {
+			x.New = false
+		}
+	case "diff":
+		ids, err := listSnapshots(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if from == "" || to == "" {
+			n := len(ids)
+			if to == "now" {
+				n++
+			}
+			if n < 2 {
+				log.Fatalf("need two snapshots in %s, or -from and -to", dir)
+			}
+			if to == "" {
+				to = ids[len(ids)-1]
+			}
+			if from == "" {
+				from = ids[len(ids)-1]
+				if to != "now" {
+					from = ids[len(ids)-2]
+				}
+			}
+		}
+		load := func(id string) *statementSnapshot {
+			if id == "now" {
+				return live()
+			}
+			snap, err := loadSnapshot(dir, id)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return snap
+		}
+		older, newer := load(from), load(to)
+		if newer.Taken.Before(older.Taken) {
+			older, newer = newer, older
+		}
+		diff = diffStatements(older, newer, opts)
+	default:
+		log.Fatalf("invalid -mode %q (use snapshot, list, diff or top)", mode)
+	}
+	if pool != nil {
+		pool.QueryRow(ctx, "SELECT current_setting('block_size')::bigint").Scan(&blockSize)
+		pool.Close()
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diff); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printStatementDiff(diff, blockSize)
+}
@@ -0,0 +1,763 @@
+package dbre
+
+// ============================================================================
+// PG_UPGRADE REHEARSAL (cmd/upgrade-drill)
+// ============================================================================
+//
+// Rehearses a major version upgrade on a scratch copy of the cluster and
+// measures what changes for the workload, old and new version on the same
+// data and the same host:
+//   prepare, restore, configure, recover
+//             clone the cluster (restore.clone_dsn, pg_basebackup) or
+//             restore a backup, as backup-verify does (scratch.go), and
+//             start it with the current binaries (scratch.bin_dir)
+//   baseline  replay the captured read workload on the old version: each
+//             statement's plan (EXPLAIN, hashed with planhash) and its
+//             median latency over workload.repeat runs after a warm-up
+//   initdb    a new cluster with upgrade.bin_dir, matching the encoding,
+//             locale, data checksums and WAL segment size of the old one
+//   check     pg_upgrade --check
+//   upgrade   pg_upgrade --link (upgrade.mode: copy or clone instead); its
+//             duration is the downtime of the real upgrade, before ANALYZE
+//   start     the upgraded cluster
+//   analyze   vacuumdb --all --analyze-only (or --analyze-in-stages)
+//   replay    the same workload on the new version
+//   stop      stop and remove the scratch clusters, unless -keep
+// The workload comes from the server log or a file:
+//   workload.csvlog     csvlog globs; statements logged with their duration
+//                       (log_min_duration_statement, 0 to capture everything),
+//                       bind parameters filled in from the DETAIL line
+//   workload.sql_file   statements separated by ";" at the end of a line,
+//                       run in workload.database
+// Only SELECT, WITH, TABLE and VALUES statements are replayed, in read-only
+// transactions with workload.statement_timeout. Statements are grouped by
+// fingerprint (package sqlfingerprint); the workload.max_queries most
+// frequent are replayed, workload.samples statements each. A query
+// REGRESSED when its median got -regress times slower (and at least 1 ms);
+// the report marks plan changes next to it. Exit code 2 when the upgrade
+// failed or a query regressed. See upgrade-drill.example.yaml.
+//
+//   go run ./cmd/upgrade-drill -config=upgrade-drill.example.yaml
+//   go run ./cmd/upgrade-drill -config=drill.yaml -regress=2 -format=json > drill-16-17.json
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/planhash"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/sqlfingerprint"
+	"gopkg.in/yaml.v3"
+)
+
+// upgradeDrillConfig is the -config file.
+type upgradeDrillConfig struct {
+	Restore  restoreSpec  `yaml:"restore"`
+	Scratch  scratchSpec  `yaml:"scratch"` // bin_dir: the current major version
+	Upgrade  upgradeSpec  `yaml:"upgrade"`
+	Workload workloadSpec `yaml:"workload"`
+	Regress  float64      `yaml:"regress"`
+}
+
+type upgradeSpec struct {
+	BinDir          string `yaml:"bin_dir"` // The target major version
+	Mode            string `yaml:"mode"`    // link, copy or clone
+	Jobs            int    `yaml:"jobs"`
+	AnalyzeInStages bool   `yaml:"analyze_in_stages"`
+}
+
+type workloadSpec struct {
+	CSVLog           []string      `yaml:"csvlog,omitempty"`
+	SQLFile          string        `yaml:"sql_file,omitempty"`
+	Database         string        `yaml:"database,omitempty"` // For sql_file; filters csvlog
+	MaxQueries       int           `yaml:"max_queries"`
+	Samples          int           `yaml:"samples"`
+	Repeat           int           `yaml:"repeat"`
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+}
+
+// loadUpgradeDrillConfig reads path and fills in the defaults.
+func loadUpgradeDrillConfig(path string) (*upgradeDrillConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &upgradeDrillConfig{
+		Scratch:  defaultScratchSpec(),
+		Upgrade:  upgradeSpec{Mode: "link", Jobs: 4},
+		Workload: workloadSpec{MaxQueries: 200, Samples: 3, Repeat: 5, StatementTimeout: 30 * time.Second},
+		Regress:  1.5,
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	switch {
+	case cfg.Scratch.Dir == "":
+		return nil, fmt.Errorf("%s: scratch.dir is required", path)
+	case cfg.Scratch.BinDir == "" || cfg.Upgrade.BinDir == "":
+		return nil, fmt.Errorf("%s: scratch.bin_dir (current version) and upgrade.bin_dir (target) are required", path)
+	case cfg.Upgrade.Mode != "link" && cfg.Upgrade.Mode != "copy" && cfg.Upgrade.Mode != "clone":
+		return nil, fmt.Errorf("%s: invalid upgrade.mode %q (use link, copy or clone)", path, cfg.Upgrade.Mode)
+	case len(cfg.Workload.CSVLog) == 0 && cfg.Workload.SQLFile == "":
+		return nil, fmt.Errorf("%s: set workload.csvlog or workload.sql_file", path)
+	case cfg.Workload.SQLFile != "" && cfg.Workload.Database == "":
+		return nil, fmt.Errorf("%s: workload.sql_file needs workload.database", path)
+	}
+	if err := cfg.Restore.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// workloadQuery is one fingerprint of the captured workload.
+type workloadQuery struct {
+	Fingerprint string
+	Database    string
+	Count       int      // Statements captured
+	Samples     []string // The statements replayed
+}
+
+var (
+	bindParamRe   = regexp.MustCompile(`\$(\d+) = ('(?:[^']|'')*'|NULL)`)
+	placeholderRe = regexp.MustCompile(`\$(\d+)\b`)
+	versionRe     = regexp.MustCompile(`(\d+)(?:\.\d+)?`)
+)
+
+// bindParams fills the $n of a logged extended-protocol statement with
+// the values of its "parameters: $1 = '42', ..." DETAIL; ok is false when
+// one is missing.
+func bindParams(query, detail string) (string, bool) {
+	values := map[string]string{}
+	for _, m := range bindParamRe.FindAllStringSubmatch(detail, -1) {
+		values[m[1]] = m[2]
+	}
+	ok := true
+	bound := placeholderRe.ReplaceAllStringFunc(query, func(p string) string {
+		v, found := values[p[1:]]
+		ok = ok && found
+		return v
+	})
+	return bound, ok
+}
+
+// readOnlyStatement reports whether q is a statement the drill replays.
+func readOnlyStatement(q string) bool {
+	first, _, _ := strings.Cut(sqlfingerprint.Normalize(q), " ")
+	switch first {
+	case "select", "with", "table", "values":
+		return true
+	}
+	return false
+}
+
+// capturedWorkload collects statements by database and fingerprint.
+type capturedWorkload struct {
+	samples int
+	queries map[string]*workloadQuery
+}
+
+func (w *capturedWorkload) add(database, query string) {
+	query = strings.TrimSpace(query)
+	if query == "" || !readOnlyStatement(query) {
+		return
+	}
+	fp := sqlfingerprint.Fingerprint(query)
+	q := w.queries[database+"/"+fp]
+	if q == nil {
+		q = &workloadQuery{Fingerprint: fp, Database: database}
+		w.queries[database+"/"+fp] = q
+	}
+	q.Count++
+	if len(q.Samples) < w.samples && !slices.Contains(q.Samples, query) {
+		q.Samples = append(q.Samples, query)
+	}
+}
+
+// readWorkloadCSVLog adds the logged statements of one csvlog.
+func (w *capturedWorkload) readWorkloadCSVLog(r io.Reader, name, database string) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		rec, ok := parseCSVLogRecord(fields)
+		if !ok || rec.Severity != "LOG" || (database != "" && rec.Database != database) {
+			continue
+		}
+		m := slowQueryRe.FindStringSubmatch(rec.Message)
+		if m == nil || m[2] == "" {
+			continue
+		}
+		query := m[2]
+		if placeholderRe.MatchString(query) {
+			if query, ok = bindParams(query, rec.Detail); !ok {
+				continue
+			}
+		}
+		w.add(rec.Database, query)
+	}
+}
+
+// readWorkloadSQLFile adds the statements of a file.
+func (w *capturedWorkload) readWorkloadSQLFile(path, database string) error {
+	return readSQLFile(path, func(stmt string) { w.add(database, stmt) })
+}
+
+// readSQLFile calls fn with each statement of a file: statements end with
+// a ";" at the end of a line, and lines starting with -- are skipped.
+func readSQLFile(path string, fn func(stmt string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var stmt strings.Builder
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1<<20), 1<<26)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		stmt.WriteString(line + "\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			fn(strings.TrimSuffix(strings.TrimSpace(stmt.String()), ";"))
+			stmt.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(stmt.String()); rest != "" {
+		fn(rest)
+	}
+	return sc.Err()
+}
+
+// loadWorkload returns the most frequent fingerprints of the workload.
+func loadWorkload(spec workloadSpec) ([]*workloadQuery, error) {
+	w := &capturedWorkload{samples: spec.Samples, queries: map[string]*workloadQuery{}}
+	for _, pattern := range spec.CSVLog {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			f, err := openLog(path)
+			if err != nil {
+				return nil, err
+			}
+			err = w.readWorkloadCSVLog(f, path, spec.Database)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if spec.SQLFile != "" {
+		if err := w.readWorkloadSQLFile(spec.SQLFile, spec.Database); err != nil {
+			return nil, err
+		}
+	}
+	var queries []*workloadQuery
+	for _, q := range w.queries {
+		queries = append(queries, q)
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no replayable statements in the workload (are durations logged with their statements?)")
+	}
+	slices.SortFunc(queries, func(a, b *workloadQuery) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Fingerprint, b.Fingerprint))
+	})
+	return queries[:min(len(queries), spec.MaxQueries)], nil
+}
+
+// replayResult is one fingerprint on one version.
+type replayResult struct {
+	PlanHashes []string // Per sample
+	MedianMS   float64
+	Error      string
+}
+
+// simpleExec runs sql with the simple protocol and returns its results.
+func simpleExec(ctx context.Context, pool *pgxpool.Pool, sql string) ([]*pgconn.Result, error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+	return conn.Conn().PgConn().Exec(ctx, sql).ReadAll()
+}
+
+// replayWorkload plans and times every sample on the scratch server.
+func replayWorkload(ctx context.Context, srv *scratchServer, queries []*workloadQuery, spec workloadSpec) (map[string]*replayResult, error) {
+	pools := map[string]*pgxpool.Pool{}
+	defer func() {
+		for _, p := range pools {
+			p.Close()
+		}
+	}()
+	results := map[string]*replayResult{}
+	for i, q := range queries {
+		pool := pools[q.Database]
+		if pool == nil {
+			var err error
+			pool, err = connect(ctx, srv.dsn(q.Database, "default_transaction_read_only=on",
+				fmt.Sprintf("statement_timeout=%d", spec.StatementTimeout.Milliseconds())), "upgrade-drill", 1)
+			if err != nil {
+				return nil, err
+			}
+			pools[q.Database] = pool
+		}
+		res := &replayResult{}
+		results[q.Database+"/"+q.Fingerprint] = res
+		var timings []float64
+		for _, sample := range q.Samples {
+			plan, err := simpleExec(ctx, pool, "EXPLAIN "+sample)
+			if err != nil {
+				res.Error = err.Error()
+				break
+			}
+			var lines []string
+			for _, r := range plan {
+				for _, row := range r.Rows {
+					lines = append(lines, string(row[0]))
+				}
+			}
+			res.PlanHashes = append(res.PlanHashes, planhash.Hash(strings.Join(lines, "\n")))
+			for run := 0; run <= spec.Repeat && err == nil; run++ {
+				start := time.Now()
+				_, err = simpleExec(ctx, pool, sample)
+				if run > 0 { // The first run warms the cache
+					timings = append(timings, float64(time.Since(start))/float64(time.Millisecond))
+				}
+			}
+			if err != nil {
+				res.Error = err.Error()
+				break
+			}
+		}
+		slices.Sort(timings)
+		res.MedianMS = percentile(timings, 0.5)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if (i+1)%25 == 0 {
+			fmt.Fprintf(os.Stderr, "   %d/%d queries\n", i+1, len(queries))
+		}
+	}
+	return results, nil
+}
+
+// queryDiff compares one fingerprint before and after the upgrade.
+type queryDiff struct {
+	Fingerprint string  `json:"fingerprint"`
+	Database    string  `json:"database"`
+	Query       string  `json:"query"`
+	Count       int     `json:"captured"`
+	PrePlan     string  `json:"pre_plan_hash"`
+	PostPlan    string  `json:"post_plan_hash"`
+	PlanChanged bool    `json:"plan_changed"`
+	PreMS       float64 `json:"pre_median_ms"`
+	PostMS      float64 `json:"post_median_ms"`
+	Ratio       float64 `json:"ratio"`  // Post / pre
+	Status      string  `json:"status"` // regressed, improved, unchanged, error
+	Error       string  `json:"error,omitempty"`
+}
+
+// diffReplays compares the two replays.
+func diffReplays(queries []*workloadQuery, pre, post map[string]*replayResult, regress float64) []queryDiff {
+	var diffs []queryDiff
+	for _, q := range queries {
+		key := q.Database + "/" + q.Fingerprint
+		d := queryDiff{Fingerprint: q.Fingerprint, Database: q.Database, Query: q.Samples[0], Count: q.Count, Status: "unchanged"}
+		a, b := pre[key], post[key]
+		if a == nil || b == nil {
+			continue
+		}
+		if len(a.PlanHashes) > 0 && len(b.PlanHashes) > 0 {
+			d.PrePlan, d.PostPlan = a.PlanHashes[0], b.PlanHashes[0]
+		}
+		d.PlanChanged = !slices.Equal(a.PlanHashes, b.PlanHashes)
+		d.PreMS, d.PostMS = a.MedianMS, b.MedianMS
+		if d.PreMS > 0 {
+			d.Ratio = d.PostMS / d.PreMS
+		}
+		switch {
+		case a.Error != "" || b.Error != "":
+			d.Status, d.Error = "error", b.Error
+			if a.Error != "" {
+				d.Error = "before the upgrade: " + a.Error
+			}
+		case d.Ratio >= regress && d.PostMS-d.PreMS >= 1:
+			d.Status = "regressed"
+		case d.Ratio > 0 && d.Ratio <= 1/regress && d.PreMS-d.PostMS >= 1:
+			d.Status = "improved"
+		}
+		diffs = append(diffs, d)
+	}
+	rank := map[string]int{"regressed": 0, "error": 1, "improved": 2, "unchanged": 3}
+	slices.SortStableFunc(diffs, func(a, b queryDiff) int {
+		return cmp.Or(cmp.Compare(rank[a.Status], rank[b.Status]), -compareBool(a.PlanChanged, b.PlanChanged),
+			cmp.Compare(b.Ratio, a.Ratio))
+	})
+	return diffs
+}
+
+// compareBool orders false before true.
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
+
+// clusterFacts are what initdb must match for pg_upgrade.
+type clusterFacts struct {
+	Version      string
+	Encoding     string
+	Collate      string
+	CType        string
+	Provider     string // c, i or b
+	Locale       string // ICU or builtin locale
+	Checksums    bool
+	WALSegmentMB int
+	Preload      string
+}
+
+// inspectCluster reads the facts of the old cluster.
+func inspectCluster(ctx context.Context, srv *scratchServer) (*clusterFacts, error) {
+	pool, err := connect(ctx, srv.dsn(""), "upgrade-drill", 1)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Close()
+	var f clusterFacts
+	var versionNum int
+	var segmentBytes int64
+	err = pool.QueryRow(ctx, `
+		SELECT current_setting('server_version'), current_setting('server_version_num')::int,
+		       current_setting('data_checksums') = 'on',
+		       pg_size_bytes(current_setting('wal_segment_size')),
+		       current_setting('shared_preload_libraries'),
+		       pg_encoding_to_char(encoding), datcollate, datctype
+		FROM pg_database WHERE datname = 'template0'`).
+		Scan(&f.Version, &versionNum, &f.Checksums, &segmentBytes, &f.Preload, &f.Encoding, &f.Collate, &f.CType)
+	if err != nil {
+		return nil, err
+	}
+	f.WALSegmentMB = int(segmentBytes >> 20)
+	f.Provider = "c"
+	switch {
+	case versionNum >= 170000:
+		err = pool.QueryRow(ctx, `SELECT datlocprovider::text, coalesce(datlocale, '') FROM pg_database WHERE datname = 'template0'`).
+			Scan(&f.Provider, &f.Locale)
+	case versionNum >= 150000:
+		err = pool.QueryRow(ctx, `SELECT datlocprovider::text, coalesce(daticulocale, '') FROM pg_database WHERE datname = 'template0'`).
+			Scan(&f.Provider, &f.Locale)
+	}
+	return &f, err
+}
+
+// binMajor returns the major version of the binaries in binDir.
+func binMajor(binDir string) (int, error) {
+	out, err := exec.Command(filepath.Join(binDir, "pg_ctl"), "--version").Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s/pg_ctl --version: %w", binDir, err)
+	}
+	m := versionRe.FindStringSubmatch(string(out))
+	if m == nil {
+		return 0, fmt.Errorf("unexpected pg_ctl --version output %q", strings.TrimSpace(string(out)))
+	}
+	return strconv.Atoi(m[1])
+}
+
+// upgradeDrillReport is the result of a drill.
+type upgradeDrillReport struct {
+	Source      string       `json:"source"`
+	OldVersion  string       `json:"old_version"`
+	NewVersion  string       `json:"new_version"`
+	Mode        string       `json:"mode"`
+	StartedAt   time.Time    `json:"started_at"`
+	Steps       []verifyStep `json:"steps"`
+	Queries     []queryDiff  `json:"queries"`
+	Regressed   int          `json:"regressed"`
+	Improved    int          `json:"improved"`
+	PlanChanges int          `json:"plan_changes"`
+	Errors      int          `json:"errors"`
+	Notes       []string     `json:"notes,omitempty"`
+	Seconds     float64      `json:"seconds"`
+	Pass        bool         `json:"pass"`
+}
+
+// upgradeDriller runs the steps.
+type upgradeDriller struct {
+	cfg      *upgradeDrillConfig
+	srv      *scratchServer
+	queries  []*workloadQuery
+	facts    *clusterFacts
+	newMajor int
+	newData  string
+	pre      map[string]*replayResult
+	post     map[string]*replayResult
+	report   upgradeDrillReport
+}
+
+// initNew creates the target cluster.
+func (d *upgradeDriller) initNew(ctx context.Context) (string, error) {
+	var err error
+	if d.newMajor, err = binMajor(d.cfg.Upgrade.BinDir); err != nil {
+		return "", err
+	}
+	if err := d.srv.stop(); err != nil {
+		return "", err
+	}
+	d.newData = filepath.Join(d.cfg.Scratch.Dir, fmt.Sprintf("data-%d", d.newMajor))
+	d.srv.dirs = append(d.srv.dirs, d.newData)
+	f := d.facts
+	args := []string{"-D", d.newData, "-U", d.cfg.Scratch.User, "--encoding=" + f.Encoding,
+		"--lc-collate=" + f.Collate, "--lc-ctype=" + f.CType, fmt.Sprintf("--wal-segsize=%d", f.WALSegmentMB)}
+	switch f.Provider {
+	case "i":
+		args = append(args, "--locale-provider=icu", "--icu-locale="+f.Locale)
+	case "b":
+		args = append(args, "--locale-provider=builtin", "--builtin-locale="+f.Locale)
+	}
+	switch {
+	case f.Checksums:
+		args = append(args, "--data-checksums")
+	case d.newMajor >= 18: // initdb enables them by default from 18
+		args = append(args, "--no-data-checksums")
+	}
+	if err := runLogged(exec.CommandContext(ctx, filepath.Join(d.cfg.Upgrade.BinDir, "initdb"), args...), d.srv.logPath()); err != nil {
+		return "", err
+	}
+	if err := d.srv.writeSettings(d.newData, [2]string{"shared_preload_libraries", f.Preload}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s, %s/%s, checksums %t", d.newData, f.Encoding, f.Collate, f.Checksums), nil
+}
+
+// pgUpgrade runs pg_upgrade, with --check or for real.
+func (d *upgradeDriller) pgUpgrade(ctx context.Context, check bool) (string, error) {
+	s := d.cfg.Scratch
+	args := []string{"-b", s.BinDir, "-B", d.cfg.Upgrade.BinDir, "-d", d.srv.dataDir, "-D", d.newData,
+		"-U", s.User, "-p", strconv.Itoa(s.Port), "-P", strconv.Itoa(s.Port), "-s", s.Dir,
+		"-j", strconv.Itoa(d.cfg.Upgrade.Jobs), "--" + d.cfg.Upgrade.Mode}
+	if check {
+		args = append(args, "--check")
+	} else {
+		for _, f := range []string{"update_extensions.sql", "delete_old_cluster.sh"} {
+			os.Remove(filepath.Join(s.Dir, f))
+		}
+	}
+	cmd := exec.CommandContext(ctx, filepath.Join(d.cfg.Upgrade.BinDir, "pg_upgrade"), args...)
+	cmd.Dir = s.Dir // pg_upgrade writes its scripts in the working directory
+	if err := runLogged(cmd, d.srv.logPath()); err != nil {
+		return "", err
+	}
+	if check {
+		return "clusters are compatible", nil
+	}
+	d.srv.dataDir, d.srv.binDir = d.newData, d.cfg.Upgrade.BinDir
+	if _, err := os.Stat(filepath.Join(s.Dir, "update_extensions.sql")); err == nil {
+		d.report.Notes = append(d.report.Notes, fmt.Sprintf("extensions need ALTER EXTENSION ... UPDATE after the upgrade: see %s",
+			filepath.Join(s.Dir, "update_extensions.sql")))
+	}
+	return "--" + d.cfg.Upgrade.Mode, nil
+}
+
+// analyze collects statistics on the upgraded cluster.
+func (d *upgradeDriller) analyze(ctx context.Context) (string, error) {
+	s := d.cfg.Scratch
+	how := "--analyze-only"
+	if d.cfg.Upgrade.AnalyzeInStages {
+		how = "--analyze-in-stages"
+	}
+	cmd := exec.CommandContext(ctx, filepath.Join(d.cfg.Upgrade.BinDir, "vacuumdb"), "--all", how,
+		"-j", strconv.Itoa(d.cfg.Upgrade.Jobs), "-h", s.Dir, "-p", strconv.Itoa(s.Port), "-U", s.User)
+	return how, runLogged(cmd, d.srv.logPath())
+}
+
+// printUpgradeDrillReport writes the report for a person.
+func printUpgradeDrillReport(r *upgradeDrillReport, regress float64) {
+	fmt.Printf("\n🚀 UPGRADE DRILL: PostgreSQL %s → %s (pg_upgrade --%s)\n", cmp.Or(r.OldVersion, "?"), cmp.Or(r.NewVersion, "?"), r.Mode)
+	fmt.Printf("   Source: %s\n", r.Source)
+	fmt.Println(strings.Repeat("=", 100))
+	printSteps(r.Steps)
+	var downtime []string
+	for _, s := range r.Steps {
+		if s.Name == "upgrade" && s.OK {
+			downtime = append(downtime, "pg_upgrade "+formatStepTime(s.Seconds))
+		}
+		if s.Name == "analyze" && s.OK {
+			downtime = append(downtime, "then "+formatStepTime(s.Seconds)+" of ANALYZE with plans on partial statistics")
+		}
+	}
+	if len(downtime) > 0 {
+		fmt.Printf("\n   Downtime estimate: %s\n", strings.Join(downtime, ", "))
+	}
+	for _, n := range r.Notes {
+		fmt.Printf("   ⚠️  %s\n", n)
+	}
+
+	if len(r.Queries) > 0 {
+		fmt.Printf("\nQUERIES: %d regressed (≥ %.1fx), %d improved, %d plan changes, %d errors of %d\n",
+			r.Regressed, regress, r.Improved, r.PlanChanges, r.Errors, len(r.Queries))
+		fmt.Printf("   %-10s %-16s %-10s %10s %10s %7s %-5s  %s\n", "STATUS", "FINGERPRINT", "DATABASE", "PRE ms", "POST ms", "RATIO", "PLAN", "QUERY")
+		for _, q := range r.Queries {
+			plan := "same"
+			if q.PlanChanged {
+				plan = "NEW"
+			}
+			status := q.Status
+			if status == "regressed" {
+				status = "REGRESSED"
+			}
+			detail := oneLine(q.Query, 60)
+			if q.Error != "" {
+				detail = q.Error
+			}
+			fmt.Printf("   %-10s %-16s %-10s %10.2f %10.2f %6.2fx %-5s  %s\n", status, q.Fingerprint, q.Database,
+				q.PreMS, q.PostMS, q.Ratio, plan, detail)
+		}
+	}
+	fmt.Println(strings.Repeat("=", 100))
+	if r.Pass {
+		fmt.Printf("✅ PASS in %s\n", formatStepTime(r.Seconds))
+	} else {
+		fmt.Printf("❌ FAIL after %s\n", formatStepTime(r.Seconds))
+	}
+}
+
+// UpgradeDrill runs the upgrade-drill command line tool.
+func UpgradeDrill() {
+	var configPath, format string
+	var regress float64
+	var keep bool
+	flag.StringVar(&configPath, "config", "", "Configuration file (see upgrade-drill.example.yaml)")
+	flag.Float64Var(&regress, "regress", 0, "Flag queries this many times slower after the upgrade (overrides regress)")
+	flag.BoolVar(&keep, "keep", false, "Keep the scratch clusters (overrides scratch.keep)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if configPath == "" {
+		log.Fatal("-config is required")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	cfg, err := loadUpgradeDrillConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if regress > 0 {
+		cfg.Regress = regress
+	}
+	cfg.Scratch.Keep = cfg.Scratch.Keep || keep
+
+	queries, err := loadWorkload(cfg.Workload)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "📋 Workload: %d query fingerprints\n", len(queries))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	d := &upgradeDriller{cfg: cfg, srv: newScratchServer(cfg.Restore, cfg.Scratch), queries: queries}
+	d.report.Mode = cfg.Upgrade.Mode
+	d.report.StartedAt = time.Now()
+	step := func(name string, fn func() (string, error)) bool { return runStep(&d.report.Steps, name, fn) }
+	d.report.Pass = step("prepare", d.srv.prepare) &&
+		step("restore", func() (string, error) { return d.srv.restoreData(ctx) }) &&
+		step("configure", d.srv.configure) &&
+		step("recover", func() (string, error) { return d.srv.recoverWAL(ctx) }) &&
+		step("baseline", func() (string, error) {
+			if d.facts, err = inspectCluster(ctx, d.srv); err != nil {
+				return "", err
+			}
+			d.report.OldVersion = d.facts.Version
+			d.pre, err = replayWorkload(ctx, d.srv, queries, cfg.Workload)
+			return fmt.Sprintf("PostgreSQL %s, %d queries", d.facts.Version, len(queries)), err
+		}) &&
+		step("initdb", func() (string, error) { return d.initNew(ctx) }) &&
+		step("check", func() (string, error) { return d.pgUpgrade(ctx, true) }) &&
+		step("upgrade", func() (string, error) { return d.pgUpgrade(ctx, false) }) &&
+		step("start", func() (string, error) {
+			if err := d.srv.start(ctx); err != nil {
+				return "", err
+			}
+			pool, err := connect(ctx, d.srv.dsn(""), "upgrade-drill", 1)
+			if err != nil {
+				return "", err
+			}
+			defer pool.Close()
+			err = pool.QueryRow(ctx, `SELECT current_setting('server_version')`).Scan(&d.report.NewVersion)
+			return "PostgreSQL " + d.report.NewVersion, err
+		}) &&
+		step("analyze", func() (string, error) { return d.analyze(ctx) }) &&
+		step("replay", func() (string, error) {
+			d.post, err = replayWorkload(ctx, d.srv, queries, cfg.Workload)
+			return fmt.Sprintf("%d queries", len(queries)), err
+		})
+	if !step("stop", d.srv.cleanup) {
+		d.report.Pass = false
+	}
+	d.report.Source = d.srv.backup
+
+	if d.pre != nil && d.post != nil {
+		d.report.Queries = diffReplays(queries, d.pre, d.post, cfg.Regress)
+		for _, q := range d.report.Queries {
+			switch q.Status {
+			case "regressed":
+				d.report.Regressed++
+			case "improved":
+				d.report.Improved++
+			case "error":
+				d.report.Errors++
+			}
+			if q.PlanChanged {
+				d.report.PlanChanges++
+			}
+		}
+		d.report.Pass = d.report.Pass && d.report.Regressed == 0
+	}
+	d.report.Seconds = time.Since(d.report.StartedAt).Seconds()
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&d.report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printUpgradeDrillReport(&d.report, cfg.Regress)
+	}
+	if !d.report.Pass {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,587 @@
+package dbre
+
+// ============================================================================
+// VACUUM STRATEGY BENCHMARK (cmd/vacuum-bench)
+// ============================================================================
+//
+// Which remediation should a bloated table get? vacuum-bench answers it for
+// one table on this hardware without touching the table: it copies up to
+// -rows rows of -table into a base table, then for each -strategies entry
+// builds a fresh copy of the base (LIKE -table INCLUDING ALL, autovacuum
+// off), VACUUMs it so the copy starts clean, bloats it the same way every
+// time and runs the strategy:
+//   vacuum   VACUUM: dead tuples become reusable space; the file only
+//            shrinks by empty pages at its end
+//   freeze   VACUUM (FREEZE): the same, and every tuple frozen
+//   full     VACUUM FULL: rewrites the table and its indexes, holding an
+//            ACCESS EXCLUSIVE lock throughout
+//   repack   pg_repack: rewrites online, ACCESS EXCLUSIVE only briefly at
+//            the start and the swap (needs the pg_repack binary, the
+//            extension in the database and a primary key on -table)
+// Bloat is -bloat of the rows, chosen with a fixed random seed so every
+// strategy gets the same dead tuples: deleted (-bloat-mode=delete) or
+// updated once in place (update; SET <key> = <key>, which leaves a dead
+// version behind each).
+//
+// While a strategy runs, pg_locks is polled for the locks held on the copy
+// by anyone else than the tool's monitor, and a probe session reads one
+// row every 100ms: its slowest read is how long a query would have waited.
+// Per strategy the report gives duration, WAL generated (cluster-wide, so
+// keep other writers off the server for exact numbers), total size before
+// and after, space returned to the file system, the strongest lock seen
+// and the longest read stall. The copies are dropped at the end unless
+// -keep. Exit code 2 when a strategy failed.
+//
+//   go run ./cmd/vacuum-bench -dsn=postgres://dbre@db1/avro -table=events
+//   go run ./cmd/vacuum-bench -table=events -rows=5000000 -bloat=0.3 -bloat-mode=update -strategies=vacuum,full,repack
+//   go run ./cmd/vacuum-bench -table=events -format=json > vacuum-bench.json
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// vacuumStrategies are the strategies vacuum-bench knows, cheapest first.
+var vacuumStrategies = []string{"vacuum", "freeze", "full", "repack"}
+
+// lockModes are the table lock modes, weakest first.
+var lockModes = []string{
+	"AccessShareLock", "RowShareLock", "RowExclusiveLock", "ShareUpdateExclusiveLock",
+	"ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock",
+}
+
+// vacuumBenchOptions are the command line settings.
+type vacuumBenchOptions struct {
+	table, bloatMode, pgRepack string
+	strategies                 []string
+	rows                       int64
+	bloat                      float64
+	keep                       bool
+}
+
+// vacuumBenchResult is one strategy on one copy.
+type vacuumBenchResult struct {
+	Strategy      string        `json:"strategy"`
+	Table         string        `json:"table"` // The copy
+	Seconds       float64       `json:"seconds"`
+	WALBytes      int64         `json:"wal_bytes"`
+	SizeBefore    int64         `json:"size_before_bytes"` // Table, indexes and TOAST
+	SizeAfter     int64         `json:"size_after_bytes"`
+	Reclaimed     int64         `json:"reclaimed_bytes"`
+	Locks         []string      `json:"locks"` // Modes others held on the copy, weakest first
+	StrongestLock string        `json:"strongest_lock,omitempty"`
+	LongestStall  time.Duration `json:"longest_read_stall_ns"`
+	FrozenXIDAge  int64         `json:"relfrozenxid_age"` // After the strategy
+	Skipped       string        `json:"skipped,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// vacuumBenchReport is the comparison.
+type vacuumBenchReport struct {
+	Source     string              `json:"source"`
+	Rows       int64               `json:"rows"`
+	Bloat      float64             `json:"bloat"`
+	BloatMode  string              `json:"bloat_mode"`
+	BloatRows  int64               `json:"bloat_rows"`
+	CleanSize  int64               `json:"clean_size_bytes"` // A copy before bloating
+	Strategies []vacuumBenchResult `json:"strategies"`
+	Failed     bool                `json:"failed"`
+}
+
+// vacuumBench builds the copies and runs the strategies.
+type vacuumBench struct {
+	opts    vacuumBenchOptions
+	dsn     string
+	pool    *pgxpool.Pool
+	source  string // Sanitized
+	schema  string
+	name    string // Unqualified source name, the copies' prefix
+	key     string // Sanitized primary key column, "" without one
+	columns string // Sanitized non-generated columns
+	base    string
+	created []string
+	verbose bool
+	report  vacuumBenchReport
+}
+
+// copyName is a scratch table next to the source.
+func (b *vacuumBench) copyName(suffix string) string {
+	return pgx.Identifier{b.schema, b.name + "_vacbench_" + suffix}.Sanitize()
+}
+
+// resolve finds the source, its key and its insertable columns, and checks
+// no copy is left over from an earlier run.
+func (b *vacuumBench) resolve(ctx context.Context) error {
+	err := b.pool.QueryRow(ctx, `
+		SELECT n.nspname, c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = to_regclass($1) AND c.relkind = 'r'
+	`, b.opts.table).Scan(&b.schema, &b.name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("table %s not found", b.opts.table)
+	}
+	if err != nil {
+		return err
+	}
+	b.source = pgx.Identifier{b.schema, b.name}.Sanitize()
+	b.report.Source = b.source
+
+	var key *string
+	err = b.pool.QueryRow(ctx, `
+		SELECT a.attname FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+		WHERE i.indrelid = $1::regclass AND i.indisprimary
+	`, b.source).Scan(&key)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	if key != nil {
+		b.key = pgx.Identifier{*key}.Sanitize()
+	}
+	if b.opts.bloatMode == "update" && b.key == "" {
+		return fmt.Errorf("%s has no primary key: -bloat-mode=update needs one", b.source)
+	}
+
+	rows, err := b.pool.Query(ctx, `
+		SELECT attname FROM pg_attribute
+		WHERE attrelid = $1::regclass AND attnum > 0 AND NOT attisdropped AND attgenerated = ''
+		ORDER BY attnum
+	`, b.source)
+	if err != nil {
+		return err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = pgx.Identifier{n}.Sanitize()
+	}
+	b.columns = strings.Join(quoted, ", ")
+
+	for _, suffix := range append([]string{"base"}, b.opts.strategies...) {
+		var exists bool
+		if err := b.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", b.copyName(suffix)).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%s exists, left over from an earlier run: drop it first", b.copyName(suffix))
+		}
+	}
+	return nil
+}
+
+// createCopy creates table LIKE the source and fills it from from.
+func (b *vacuumBench) createCopy(ctx context.Context, table, from string, limit int64) error {
+	if _, err := b.pool.Exec(ctx, fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL) WITH (autovacuum_enabled = off)", table, b.source)); err != nil {
+		return err
+	}
+	b.created = append(b.created, table)
+	insert := fmt.Sprintf("INSERT INTO %s (%s) OVERRIDING SYSTEM VALUE SELECT %s FROM %s", table, b.columns, b.columns, from)
+	if limit > 0 {
+		insert += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	// Copies of the base come out in the same physical order, so the
+	// seeded bloat hits the same rows in each.
+	tx, err := b.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SET LOCAL synchronize_seqscans = off"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, insert); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	_, err = b.pool.Exec(ctx, "VACUUM (ANALYZE) "+table)
+	return err
+}
+
+// bloatCopy deletes or updates -bloat of table's rows, the same ones every
+// time.
+func (b *vacuumBench) bloatCopy(ctx context.Context, table string) (int64, error) {
+	tx, err := b.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	for _, sql := range []string{"SET LOCAL synchronize_seqscans = off", "SELECT setseed(0.42)"} {
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return 0, err
+		}
+	}
+	sql := fmt.Sprintf("DELETE FROM %s WHERE random() < %g", table, b.opts.bloat)
+	if b.opts.bloatMode == "update" {
+		sql = fmt.Sprintf("UPDATE %s SET %s = %s WHERE random() < %g", table, b.key, b.key, b.opts.bloat)
+	}
+	tag, err := tx.Exec(ctx, sql)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+// tableSize is the size of table with its indexes and TOAST.
+func (b *vacuumBench) tableSize(ctx context.Context, table string) (int64, error) {
+	var size int64
+	err := b.pool.QueryRow(ctx, "SELECT pg_total_relation_size($1::regclass)", table).Scan(&size)
+	return size, err
+}
+
+// walPosition is the current WAL position in bytes.
+func (b *vacuumBench) walPosition(ctx context.Context) (int64, error) {
+	var lsn float64
+	err := b.pool.QueryRow(ctx, "SELECT pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0')::float8").Scan(&lsn)
+	return int64(lsn), err
+}
+
+// watch polls the locks others hold on table and the latency of a one-row
+// read until ctx ends.
+func (b *vacuumBench) watch(ctx context.Context, table string, r *vacuumBenchResult) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			rows, err := b.pool.Query(ctx, `
+				SELECT DISTINCT mode FROM pg_locks
+				WHERE relation = $1::regclass AND granted AND pid <> pg_backend_pid()
+			`, table)
+			if err == nil {
+				modes, _ := pgx.CollectRows(rows, pgx.RowTo[string])
+				mu.Lock()
+				for _, m := range modes {
+					seen[m] = true
+				}
+				mu.Unlock()
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		sql := "SELECT 1 FROM " + table + " LIMIT 1"
+		for ctx.Err() == nil {
+			start := time.Now()
+			// A read stuck behind an ACCESS EXCLUSIVE lock is only let go
+			// when the lock is released or the strategy ends.
+			_, err := b.pool.Exec(ctx, sql)
+			if stall := time.Since(start); err == nil || ctx.Err() != nil {
+				mu.Lock()
+				r.LongestStall = max(r.LongestStall, stall)
+				mu.Unlock()
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}()
+	wg.Wait()
+
+	// Our own probe's ACCESS SHARE lock is held by another pool session.
+	delete(seen, "AccessShareLock")
+	for _, m := range lockModes {
+		if seen[m] {
+			r.Locks = append(r.Locks, m)
+			r.StrongestLock = m
+		}
+	}
+}
+
+// runStrategy runs one strategy on table.
+func (b *vacuumBench) runStrategy(ctx context.Context, strategy, table string) error {
+	switch strategy {
+	case "vacuum":
+		_, err := b.pool.Exec(ctx, "VACUUM "+table)
+		return err
+	case "freeze":
+		_, err := b.pool.Exec(ctx, "VACUUM (FREEZE) "+table)
+		return err
+	case "full":
+		_, err := b.pool.Exec(ctx, "VACUUM FULL "+table)
+		return err
+	}
+	args := []string{"--table=" + table, "--no-order"}
+	if b.dsn != "" {
+		args = append(args, "--dbname="+b.dsn)
+	}
+	out, err := exec.CommandContext(ctx, b.opts.pgRepack, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// repackSkipped says why pg_repack can't run, or "".
+func (b *vacuumBench) repackSkipped(ctx context.Context) string {
+	if _, err := exec.LookPath(b.opts.pgRepack); err != nil {
+		return fmt.Sprintf("%s not found", b.opts.pgRepack)
+	}
+	var installed bool
+	if err := b.pool.QueryRow(ctx, "SELECT EXISTS (SELECT FROM pg_extension WHERE extname = 'pg_repack')").Scan(&installed); err != nil || !installed {
+		return "the pg_repack extension is not installed in this database"
+	}
+	if b.key == "" {
+		return fmt.Sprintf("%s has no primary key", b.source)
+	}
+	return ""
+}
+
+// strategy builds a bloated copy and measures one strategy on it.
+func (b *vacuumBench) strategy(ctx context.Context, strategy string) vacuumBenchResult {
+	table := b.copyName(strategy)
+	r := vacuumBenchResult{Strategy: strategy, Table: table}
+	if strategy == "repack" {
+		if r.Skipped = b.repackSkipped(ctx); r.Skipped != "" {
+			return r
+		}
+	}
+	fail := func(err error) vacuumBenchResult {
+		r.Error = err.Error()
+		b.report.Failed = true
+		return r
+	}
+
+	if err := b.createCopy(ctx, table, b.base, 0); err != nil {
+		return fail(fmt.Errorf("copying %s: %w", b.base, err))
+	}
+	if b.report.CleanSize == 0 {
+		b.report.CleanSize, _ = b.tableSize(ctx, table)
+	}
+	bloated, err := b.bloatCopy(ctx, table)
+	if err != nil {
+		return fail(fmt.Errorf("bloating %s: %w", table, err))
+	}
+	b.report.BloatRows = bloated
+	if r.SizeBefore, err = b.tableSize(ctx, table); err != nil {
+		return fail(err)
+	}
+	startWAL, err := b.walPosition(ctx)
+	if err != nil {
+		return fail(fmt.Errorf("not a primary: %w", err))
+	}
+
+	if b.verbose {
+		fmt.Fprintf(os.Stderr, "⏱️  %s on %s...\n", strategy, table)
+	}
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	watched := make(chan struct{})
+	go func() {
+		b.watch(watchCtx, table, &r)
+		close(watched)
+	}()
+	start := time.Now()
+	err = b.runStrategy(ctx, strategy, table)
+	r.Seconds = time.Since(start).Seconds()
+	stopWatch()
+	<-watched
+	if err != nil {
+		return fail(err)
+	}
+
+	if endWAL, err := b.walPosition(ctx); err == nil {
+		r.WALBytes = endWAL - startWAL
+	}
+	if r.SizeAfter, err = b.tableSize(ctx, table); err != nil {
+		return fail(err)
+	}
+	r.Reclaimed = r.SizeBefore - r.SizeAfter
+	if err := b.pool.QueryRow(ctx, "SELECT age(relfrozenxid) FROM pg_class WHERE oid = $1::regclass", table).Scan(&r.FrozenXIDAge); err != nil {
+		return fail(err)
+	}
+	if b.verbose {
+		fmt.Fprintf(os.Stderr, "✅ %s: %.1fs, %s reclaimed\n", strategy, r.Seconds, formatBytes(r.Reclaimed))
+	}
+	return r
+}
+
+// run copies the source and measures every strategy.
+func (b *vacuumBench) run(ctx context.Context) error {
+	b.base = b.copyName("base")
+	if b.verbose {
+		fmt.Fprintf(os.Stderr, "⏱️  Copying %s into %s...\n", b.source, b.base)
+	}
+	if err := b.createCopy(ctx, b.base, b.source, b.opts.rows); err != nil {
+		return fmt.Errorf("copying %s: %w", b.source, err)
+	}
+	if err := b.pool.QueryRow(ctx, "SELECT count(*) FROM "+b.base).Scan(&b.report.Rows); err != nil {
+		return err
+	}
+	if b.report.Rows == 0 {
+		return fmt.Errorf("%s is empty", b.source)
+	}
+	for _, s := range b.opts.strategies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.report.Strategies = append(b.report.Strategies, b.strategy(ctx, s))
+	}
+	return nil
+}
+
+// cleanup drops the copies unless -keep.
+func (b *vacuumBench) cleanup() {
+	if b.opts.keep {
+		if len(b.created) > 0 && b.verbose {
+			fmt.Fprintf(os.Stderr, "Kept %s\n", strings.Join(b.created, ", "))
+		}
+		return
+	}
+	for _, t := range b.created {
+		if _, err := b.pool.Exec(context.Background(), "DROP TABLE IF EXISTS "+t); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Dropping %s: %v\n", t, err)
+		}
+	}
+}
+
+// printVacuumBenchReport writes the comparison for a person.
+func printVacuumBenchReport(r *vacuumBenchReport) {
+	fmt.Printf("\n🧽 VACUUM strategies on copies of %s: %d rows, %d %sd (%.0f%%), clean copy %s\n",
+		r.Source, r.Rows, r.BloatRows, r.BloatMode, r.Bloat*100, formatBytes(r.CleanSize))
+	fmt.Printf("\n   %-8s %10s %11s %11s %11s %11s  %-26s %12s\n",
+		"Strategy", "Time", "WAL", "Before", "After", "Reclaimed", "Strongest lock", "Read stall")
+	for _, s := range r.Strategies {
+		switch {
+		case s.Skipped != "":
+			fmt.Printf("   %-8s skipped: %s\n", s.Strategy, s.Skipped)
+		case s.Error != "":
+			fmt.Printf("   %-8s ❌ %s\n", s.Strategy, s.Error)
+		default:
+			lock := s.StrongestLock
+			if lock == "" {
+				lock = "-"
+			}
+			fmt.Printf("   %-8s %9.1fs %11s %11s %11s %11s  %-26s %12v\n", s.Strategy, s.Seconds,
+				formatBytes(s.WALBytes), formatBytes(s.SizeBefore), formatBytes(s.SizeAfter), formatBytes(max(s.Reclaimed, 0)),
+				lock, s.LongestStall.Round(time.Millisecond))
+		}
+	}
+
+	var fastest, smallest *vacuumBenchResult
+	for i := range r.Strategies {
+		s := &r.Strategies[i]
+		if s.Skipped != "" || s.Error != "" {
+			continue
+		}
+		if fastest == nil || s.Seconds < fastest.Seconds {
+			fastest = s
+		}
+		if smallest == nil || s.SizeAfter < smallest.SizeAfter {
+			smallest = s
+		}
+	}
+	if fastest == nil {
+		return
+	}
+	fmt.Printf("\n   Fastest: %s (%.1fs). Most space returned: %s (%s, %s over the clean copy).\n", fastest.Strategy, fastest.Seconds,
+		smallest.Strategy, formatBytes(max(smallest.Reclaimed, 0)), formatBytes(smallest.SizeAfter-r.CleanSize))
+	for _, s := range r.Strategies {
+		if s.StrongestLock == "AccessExclusiveLock" && s.Skipped == "" && s.Error == "" {
+			fmt.Printf("   %s blocked reads for up to %v: schedule it in a maintenance window.\n",
+				s.Strategy, s.LongestStall.Round(time.Millisecond))
+		}
+	}
+}
+
+// VacuumBench runs the vacuum-bench command line tool.
+func VacuumBench() {
+	var dsn, format, strategies string
+	var opts vacuumBenchOptions
+	registerDSNFlag(&dsn)
+	flag.StringVar(&opts.table, "table", "", "Table to copy and bloat (it is only read)")
+	flag.Int64Var(&opts.rows, "rows", 1_000_000, "Rows copied from -table (0: all)")
+	flag.Float64Var(&opts.bloat, "bloat", 0.5, "Share of the copied rows turned into dead tuples")
+	flag.StringVar(&opts.bloatMode, "bloat-mode", "delete", "How: delete, or update (one dead version per row)")
+	flag.StringVar(&strategies, "strategies", strings.Join(vacuumStrategies, ","), "Strategies to compare: "+strings.Join(vacuumStrategies, ", "))
+	flag.StringVar(&opts.pgRepack, "pg-repack", "pg_repack", "pg_repack binary")
+	flag.BoolVar(&opts.keep, "keep", false, "Keep the copies")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+	if opts.table == "" {
+		log.Fatal("-table is required")
+	}
+	if opts.rows < 0 {
+		log.Fatal("-rows must not be negative")
+	}
+	if opts.bloat <= 0 || opts.bloat >= 1 {
+		log.Fatal("-bloat must be between 0 and 1")
+	}
+	if opts.bloatMode != "delete" && opts.bloatMode != "update" {
+		log.Fatalf("invalid -bloat-mode %q (use delete or update)", opts.bloatMode)
+	}
+	for _, s := range strings.Split(strategies, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !slices.Contains(vacuumStrategies, s) {
+			log.Fatalf("unknown strategy %q (use %s)", s, strings.Join(vacuumStrategies, ", "))
+		}
+		opts.strategies = append(opts.strategies, s)
+	}
+	if len(opts.strategies) == 0 {
+		log.Fatal("-strategies is empty")
+	}
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := connect(ctx, dsn, "vacuum-bench", 4)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	b := &vacuumBench{opts: opts, dsn: dsn, pool: pool, verbose: format == "text",
+		report: vacuumBenchReport{Bloat: opts.bloat, BloatMode: opts.bloatMode}}
+	if err := b.resolve(ctx); err != nil {
+		log.Fatal(err)
+	}
+	err = b.run(ctx)
+	b.cleanup()
+	if err != nil {
+		pool.Close()
+		log.Fatal(err)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(&b.report); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		printVacuumBenchReport(&b.report)
+	}
+	if b.report.Failed {
+		pool.Close()
+		os.Exit(2)
+	}
+}
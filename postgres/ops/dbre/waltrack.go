@@ -0,0 +1,534 @@
+package dbre
+
+// ============================================================================
+// WAL GENERATION AND ARCHIVE HEALTH (cmd/waltrack)
+// ============================================================================
+//
+// Every -interval waltrack reads pg_current_wal_lsn() and pg_stat_archiver
+// on the primary and prints, per interval:
+//   rate        WAL generated, in MB/min
+//   archived    segments archive_command shipped, and how many attempts
+//               failed
+//   pending     WAL not archived yet: bytes from the end of the last
+//               archived segment to the current position, and how long
+//               ago the archiver last succeeded
+//   tags        the workloads that were active: application_name of the
+//               client sessions that were busy at some point in the interval
+// Workloads tag a run by putting its id into application_name, e.g.
+// PGAPPNAME="bulk_loader run_id=7f3a" or "read_workload_simulator
+// run_id=<uuid>", so each run shows up as its own tag.
+//
+// An interval is a spike when its rate is -spike times the median of the
+// intervals before it; the spike is printed with the tags active in it. An
+// alert (see alert.go) fires on archive failures, on pending WAL past
+// -max-archive-lag, and on a rate over -max-rate.
+//
+// When waltrack stops (-duration, or Ctrl-C) it correlates: for every tag,
+// the WAL generated while it was active and its rate against the baseline
+// of intervals with no tagged workload at all. -runs adds the runs of JSON
+// reports (run_id, start_time, end_time; the stress tool's -report-json)
+// matching a glob, read at the end so reports written meanwhile count.
+//
+//   go run ./cmd/waltrack -interval=30s -runs='/var/log/stress/*.json'
+//   go run ./cmd/waltrack -duration=2h -max-archive-lag=4GB -alert-webhook=https://hooks.slack.com/services/...
+//   go run ./cmd/waltrack -format=json -duration=10m > wal.ndjson
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// walSample is one reading.
+type walSample struct {
+	time             time.Time
+	lsn              uint64
+	archived         int64
+	failed           int64
+	lastArchivedWAL  string
+	lastArchivedTime *time.Time
+	lastFailedWAL    string
+	lastFailedTime   *time.Time
+	tags             []string
+}
+
+// walInterval is what happened between two samples.
+type walInterval struct {
+	Start        time.Time     `json:"start"`
+	End          time.Time     `json:"end"`
+	Bytes        int64         `json:"wal_bytes"`
+	PerMinute    float64       `json:"wal_bytes_per_minute"`
+	Archived     int64         `json:"archived"`
+	Failed       int64         `json:"archive_failed"`
+	PendingBytes int64         `json:"archive_pending_bytes"`
+	PendingFor   time.Duration `json:"archive_pending_ns,omitempty"`
+	Spike        bool          `json:"spike,omitempty"`
+	Tags         []string      `json:"tags"`
+}
+
+// parseLSN parses a pg_lsn such as 16/B374D848.
+func parseLSN(s string) (uint64, error) {
+	hi, lo, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	h, err := strconv.ParseUint(hi, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	l, err := strconv.ParseUint(lo, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	return h<<32 | l, nil
+}
+
+// walSegmentNumber returns the segment number of a WAL file name
+// (timeline, log, segment: 8 hex digits each); ok is false for history
+// files. Backup labels and .partial files count as their segment.
+func walSegmentNumber(name string, segmentSize int64) (uint64, bool) {
+	if len(name) < 24 {
+		return 0, false
+	}
+	logID, err1 := strconv.ParseUint(name[8:16], 16, 32)
+	seg, err2 := strconv.ParseUint(name[16:24], 16, 32)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return logID*(0x100000000/uint64(segmentSize)) + seg, true
+}
+
+// walTrack accumulates the intervals.
+type walTrack struct {
+	segmentSize int64
+	archiving   bool
+	window      time.Duration
+	prev        *walSample
+	intervals   []walInterval
+}
+
+// sample reads the current position, the archiver and the active tags.
+func (t *walTrack) sample(ctx context.Context, pool *pgxpool.Pool) (*walSample, error) {
+	s := &walSample{time: time.Now()}
+	var lsn string
+	var lastArchived, lastFailed *string
+	err := pool.QueryRow(ctx, `
+		SELECT pg_current_wal_lsn()::text, a.archived_count, a.last_archived_wal, a.last_archived_time,
+		       a.failed_count, a.last_failed_wal, a.last_failed_time,
+		       coalesce((SELECT array_agg(DISTINCT application_name ORDER BY application_name) FROM pg_stat_activity
+		                 WHERE backend_type = 'client backend' AND pid <> pg_backend_pid() AND application_name <> ''
+		                   AND (state <> 'idle' OR state_change > now() - make_interval(secs => $1))), '{}')
+		FROM pg_stat_archiver a
+	`, t.window.Seconds()).Scan(&lsn, &s.archived, &lastArchived, &s.lastArchivedTime,
+		&s.failed, &lastFailed, &s.lastFailedTime, &s.tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample WAL: %w", err)
+	}
+	if s.lsn, err = parseLSN(lsn); err != nil {
+		return nil, err
+	}
+	if lastArchived != nil {
+		s.lastArchivedWAL = *lastArchived
+	}
+	if lastFailed != nil {
+		s.lastFailedWAL = *lastFailed
+	}
+	return s, nil
+}
+
+// add records s; it returns the interval since the previous sample, nil
+// for the first.
+func (t *walTrack) add(s *walSample, spike float64) *walInterval {
+	prev := t.prev
+	t.prev = s
+	if prev == nil {
+		return nil
+	}
+	in := walInterval{
+		Start:    prev.time,
+		End:      s.time,
+		Bytes:    int64(s.lsn - prev.lsn),
+		Archived: s.archived - prev.archived,
+		Failed:   s.failed - prev.failed,
+		Tags:     s.tags,
+	}
+	if s.lsn < prev.lsn {
+		in.Bytes = 0
+	}
+	if d := in.End.Sub(in.Start); d > 0 {
+		in.PerMinute = float64(in.Bytes) / d.Minutes()
+	}
+	if t.archiving {
+		if seg, ok := walSegmentNumber(s.lastArchivedWAL, t.segmentSize); ok {
+			if archivedTo := (seg + 1) * uint64(t.segmentSize); s.lsn > archivedTo {
+				in.PendingBytes = int64(s.lsn - archivedTo)
+			}
+		}
+		// A segment is archivable only once it's full.
+		if in.PendingBytes >= t.segmentSize && s.lastArchivedTime != nil {
+			in.PendingFor = s.time.Sub(*s.lastArchivedTime)
+		}
+	}
+
+	// Spike: against the median of up to the last 60 intervals.
+	if n := len(t.intervals); n >= 5 && spike > 0 {
+		rates := make([]float64, 0, 60)
+		for _, p := range t.intervals[max(0, n-60):] {
+			rates = append(rates, p.PerMinute)
+		}
+		sort.Float64s(rates)
+		median := rates[len(rates)/2]
+		in.Spike = in.PerMinute >= 1<<20 && in.PerMinute > spike*median
+	}
+	t.intervals = append(t.intervals, in)
+	return &t.intervals[len(t.intervals)-1]
+}
+
+// printWALInterval writes one interval as a line of text.
+func printWALInterval(in *walInterval, archiving bool) {
+	line := fmt.Sprintf("%s  WAL %10s/min", in.End.Format("15:04:05"), formatBytes(int64(in.PerMinute)))
+	if archiving {
+		line += fmt.Sprintf("  archived +%-3d failed +%-3d pending %9s", in.Archived, in.Failed, formatBytes(in.PendingBytes))
+		if in.PendingFor > 0 {
+			line += fmt.Sprintf(" (last archived %v ago)", in.PendingFor.Round(time.Second))
+		}
+	}
+	if len(in.Tags) > 0 {
+		line += "  [" + strings.Join(in.Tags, ", ") + "]"
+	}
+	if in.Spike {
+		line = "⚡ " + line + "  ← spike"
+	} else {
+		line = "   " + line
+	}
+	fmt.Println(line)
+}
+
+// walRun is a run from a -runs report.
+type walRun struct {
+	RunID string    `json:"run_id"`
+	Start time.Time `json:"start_time"`
+	End   time.Time `json:"end_time"`
+}
+
+// readWALRuns reads the run reports matching pattern.
+func readWALRuns(pattern string) ([]walRun, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("-runs: %w", err)
+	}
+	var runs []walRun
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var r walRun
+		if err := json.Unmarshal(data, &r); err != nil || r.RunID == "" || r.Start.IsZero() || r.End.IsZero() {
+			fmt.Fprintf(os.Stderr, "⚠️  Skipping %s: not a run report\n", f)
+			continue
+		}
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
+
+// walCorrelation is the WAL generated while one tag was active.
+type walCorrelation struct {
+	Tag       string        `json:"tag"`
+	Active    time.Duration `json:"active_ns"`
+	Bytes     int64         `json:"wal_bytes"`
+	Share     float64       `json:"share"`
+	PerMinute float64       `json:"wal_bytes_per_minute"`
+	Baseline  float64       `json:"vs_baseline,omitempty"` // PerMinute / baseline rate
+	Spikes    int           `json:"spikes"`
+}
+
+// walSummary is the report for the whole window.
+type walSummary struct {
+	Start             time.Time        `json:"start"`
+	End               time.Time        `json:"end"`
+	Bytes             int64            `json:"wal_bytes"`
+	PerMinute         float64          `json:"wal_bytes_per_minute"`
+	PeakPerMinute     float64          `json:"peak_wal_bytes_per_minute"`
+	BaselinePerMinute float64          `json:"baseline_wal_bytes_per_minute"`
+	Archived          int64            `json:"archived"`
+	Failed            int64            `json:"archive_failed"`
+	MaxPending        int64            `json:"max_archive_pending_bytes"`
+	Spikes            int              `json:"spikes"`
+	Tags              []walCorrelation `json:"tags"`
+}
+
+// summarize correlates the intervals with their tags and with runs.
+func (t *walTrack) summarize(runs []walRun) *walSummary {
+	sum := &walSummary{}
+	if len(t.intervals) == 0 {
+		return sum
+	}
+	sum.Start, sum.End = t.intervals[0].Start, t.intervals[len(t.intervals)-1].End
+	byTag := map[string]*walCorrelation{}
+	var baseBytes int64
+	var baseTime time.Duration
+	for _, in := range t.intervals {
+		d := in.End.Sub(in.Start)
+		sum.Bytes += in.Bytes
+		sum.Archived += in.Archived
+		sum.Failed += in.Failed
+		sum.PeakPerMinute = max(sum.PeakPerMinute, in.PerMinute)
+		sum.MaxPending = max(sum.MaxPending, in.PendingBytes)
+		tags := in.Tags
+		for _, r := range runs {
+			if r.Start.Before(in.End) && r.End.After(in.Start) {
+				tags = append(tags[:len(tags):len(tags)], "run_id="+r.RunID)
+			}
+		}
+		if in.Spike {
+			sum.Spikes++
+		}
+		if len(tags) == 0 {
+			baseBytes += in.Bytes
+			baseTime += d
+		}
+		for _, tag := range tags {
+			c := byTag[tag]
+			if c == nil {
+				c = &walCorrelation{Tag: tag}
+				byTag[tag] = c
+			}
+			c.Active += d
+			c.Bytes += in.Bytes
+			if in.Spike {
+				c.Spikes++
+			}
+		}
+	}
+	if d := sum.End.Sub(sum.Start); d > 0 {
+		sum.PerMinute = float64(sum.Bytes) / d.Minutes()
+	}
+	if baseTime > 0 {
+		sum.BaselinePerMinute = float64(baseBytes) / baseTime.Minutes()
+	}
+	for _, c := range byTag {
+		if sum.Bytes > 0 {
+			c.Share = float64(c.Bytes) / float64(sum.Bytes)
+		}
+		if c.Active > 0 {
+			c.PerMinute = float64(c.Bytes) / c.Active.Minutes()
+		}
+		if sum.BaselinePerMinute > 0 {
+			c.Baseline = c.PerMinute / sum.BaselinePerMinute
+		}
+		sum.Tags = append(sum.Tags, *c)
+	}
+	sort.Slice(sum.Tags, func(i, j int) bool { return sum.Tags[i].Bytes > sum.Tags[j].Bytes })
+	return sum
+}
+
+// printWALSummary writes the summary for a person.
+func printWALSummary(sum *walSummary, archiving bool) {
+	fmt.Printf("\n📊 WAL from %s to %s\n", sum.Start.Format("2006-01-02 15:04:05"), sum.End.Format("15:04:05"))
+	fmt.Printf("   Generated: %s, %s/min on average, peak %s/min, %d spike(s)\n",
+		formatBytes(sum.Bytes), formatBytes(int64(sum.PerMinute)), formatBytes(int64(sum.PeakPerMinute)), sum.Spikes)
+	if sum.BaselinePerMinute > 0 {
+		fmt.Printf("   Baseline:  %s/min with no tagged workload active\n", formatBytes(int64(sum.BaselinePerMinute)))
+	}
+	if archiving {
+		fmt.Printf("   Archive:   %d segment(s) archived, %d failure(s), at most %s pending\n",
+			sum.Archived, sum.Failed, formatBytes(sum.MaxPending))
+	} else {
+		fmt.Println("   Archive:   archive_mode is off")
+	}
+	if len(sum.Tags) == 0 {
+		return
+	}
+	fmt.Printf("\n   %-40s %9s %10s %6s %12s %8s %6s\n", "WORKLOAD", "ACTIVE", "WAL", "SHARE", "RATE/MIN", "×BASE", "SPIKES")
+	for _, c := range sum.Tags {
+		base := "-"
+		if c.Baseline > 0 {
+			base = fmt.Sprintf("%.1f×", c.Baseline)
+		}
+		fmt.Printf("   %-40s %9v %10s %5.0f%% %12s %8s %6d\n", c.Tag, c.Active.Round(time.Second), formatBytes(c.Bytes),
+			100*c.Share, formatBytes(int64(c.PerMinute)), base, c.Spikes)
+	}
+	fmt.Println("\n   Tags overlap: an interval counts for every workload active in it.")
+}
+
+// waltrackMetrics are the gauges waltrack serves.
+type waltrackMetrics struct {
+	rate, pending, pendingFor, archived, failed, up *prometheus.GaugeVec
+}
+
+func newWaltrackMetrics() *waltrackMetrics {
+	gauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "dbre_waltrack_" + name, Help: help}, []string{"server"})
+	}
+	return &waltrackMetrics{
+		rate:       gauge("wal_bytes_per_second", "WAL generated over the last interval"),
+		pending:    gauge("archive_pending_bytes", "WAL not archived yet"),
+		pendingFor: gauge("archive_pending_seconds", "Time since the last archived segment while a full segment waits"),
+		archived:   gauge("archived_count", "pg_stat_archiver.archived_count"),
+		failed:     gauge("archive_failed_count", "pg_stat_archiver.failed_count"),
+		up:         gauge("up", "1 if the last sample worked"),
+	}
+}
+
+func (m *waltrackMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.rate, m.pending, m.pendingFor, m.archived, m.failed, m.up}
+}
+
+// Waltrack runs the waltrack command line tool.
+func Waltrack() {
+	var dsn, format, runsPattern, maxPending, maxRate, metricsAddr string
+	var interval, duration time.Duration
+	var spike float64
+	alerts := &alerter{}
+	registerDSNFlag(&dsn)
+	flag.DurationVar(&interval, "interval", 30*time.Second, "Sample interval")
+	flag.DurationVar(&duration, "duration", 0, "Stop and summarize after this long (0: at Ctrl-C)")
+	flag.Float64Var(&spike, "spike", 3, "An interval over this many times the median rate is a spike (0: off)")
+	flag.StringVar(&maxPending, "max-archive-lag", "1GB", "Alert when more WAL than this waits for archiving (0: off)")
+	flag.StringVar(&maxRate, "max-rate", "0", "Alert when WAL generation per minute exceeds this, e.g. 2GB (0: off)")
+	flag.StringVar(&runsPattern, "runs", "", "Glob of JSON run reports (run_id, start_time, end_time) to correlate")
+	flag.StringVar(&format, "format", "text", "Output format: text, or json (one interval per line, then the summary)")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics here, e.g. :9190 (empty: off)")
+	registerAlertFlags(alerts)
+	flag.Parse()
+
+	if format != "text" && format != "json" {
+		log.Fatalf("invalid -format %q (use text or json)", format)
+	}
+	if interval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+	pendingLimit, err := parseByteSize(maxPending)
+	if err != nil {
+		log.Fatalf("-max-archive-lag: %v", err)
+	}
+	rateLimit, err := parseByteSize(maxRate)
+	if err != nil {
+		log.Fatalf("-max-rate: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+	pool, err := connect(ctx, dsn, "waltrack", 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	server := describeTarget(pool.Config())
+
+	t := &walTrack{window: interval}
+	var archiveMode string
+	err = pool.QueryRow(ctx, `
+		SELECT current_setting('archive_mode'),
+		       (SELECT setting::bigint * CASE unit WHEN '8kB' THEN 8192 WHEN 'MB' THEN 1048576 ELSE 1 END
+		        FROM pg_settings WHERE name = 'wal_segment_size')
+	`).Scan(&archiveMode, &t.segmentSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	t.archiving = archiveMode != "off"
+
+	metrics := newWaltrackMetrics()
+	if metricsAddr != "" {
+		serveMetrics(metricsAddr, metrics.collectors()...)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	if format == "text" {
+		fmt.Printf("📼 Tracking WAL on %s every %v (archive_mode=%s, %s segments)\n",
+			server, interval, archiveMode, formatBytes(t.segmentSize))
+	}
+
+	for {
+		s, err := t.sample(ctx, pool)
+		if ctx.Err() != nil {
+			break
+		}
+		alerts.update("waltrack:up:"+server, err != nil, pollMessage("server", server, err))
+		metrics.up.WithLabelValues(server).Set(boolGauge(err == nil))
+		if err == nil {
+			metrics.archived.WithLabelValues(server).Set(float64(s.archived))
+			metrics.failed.WithLabelValues(server).Set(float64(s.failed))
+			if in := t.add(s, spike); in != nil {
+				metrics.rate.WithLabelValues(server).Set(in.PerMinute / 60)
+				metrics.pending.WithLabelValues(server).Set(float64(in.PendingBytes))
+				metrics.pendingFor.WithLabelValues(server).Set(in.PendingFor.Seconds())
+				if format == "json" {
+					if err := enc.Encode(in); err != nil {
+						log.Fatal(err)
+					}
+				} else {
+					printWALInterval(in, t.archiving)
+				}
+				checkWALInterval(alerts, server, s, in, t.archiving, pendingLimit, rateLimit)
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(interval):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	var runs []walRun
+	if runsPattern != "" {
+		if runs, err = readWALRuns(runsPattern); err != nil {
+			log.Fatal(err)
+		}
+	}
+	sum := t.summarize(runs)
+	if format == "json" {
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sum); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printWALSummary(sum, t.archiving)
+}
+
+// checkWALInterval raises or resolves the archive and rate alerts.
+func checkWALInterval(alerts *alerter, server string, s *walSample, in *walInterval, archiving bool, pendingLimit, rateLimit int64) {
+	if archiving {
+		// Failing until an archive succeeds after the last failure.
+		failing := in.Failed > 0 || s.lastFailedTime != nil &&
+			(s.lastArchivedTime == nil || s.lastFailedTime.After(*s.lastArchivedTime))
+		msg := fmt.Sprintf("archiving on %s works again", server)
+		if failing {
+			msg = fmt.Sprintf("archive_command on %s is failing: %d failure(s) in the last interval, last on %s", server, in.Failed, s.lastFailedWAL)
+		}
+		alerts.update("waltrack:archive-failing:"+server, failing, msg)
+		if pendingLimit > 0 {
+			alerts.update("waltrack:archive-lag:"+server, in.PendingBytes > pendingLimit,
+				fmt.Sprintf("%s of WAL on %s waits for archiving (limit %s)", formatBytes(in.PendingBytes), server, formatBytes(pendingLimit)))
+		}
+	}
+	if rateLimit > 0 {
+		msg := fmt.Sprintf("%s generates %s of WAL per minute (limit %s)", server, formatBytes(int64(in.PerMinute)), formatBytes(rateLimit))
+		if len(in.Tags) > 0 {
+			msg += "; active: " + strings.Join(in.Tags, ", ")
+		}
+		alerts.update("waltrack:rate:"+server, in.PerMinute > float64(rateLimit), msg)
+	}
+}
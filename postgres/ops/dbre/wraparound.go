@@ -0,0 +1,365 @@
+package dbre
+
+// ============================================================================
+// XID WRAPAROUND AND FREEZE AGE (cmd/wraparound)
+// ============================================================================
+//
+// PostgreSQL stops assigning transaction IDs shortly before 2^31 of them
+// separate the oldest unfrozen row from the newest transaction. wraparound
+// is a check for cron and alerting that reports:
+//   databases   age(datfrozenxid) and mxid_age(datminmxid) of each database
+//   tables      the oldest tables of the connected database (table or its
+//               TOAST table), against autovacuum_freeze_max_age (a table's
+//               own reloption counts), where autovacuum forces an
+//               anti-wraparound vacuum
+//   holders     what keeps the oldest XID from advancing: old snapshots
+//               (sessions, hot_standby_feedback from replicas), prepared
+//               transactions and replication slots' xmin/catalog_xmin
+//   projection  the XID consumption rate and the time left until the
+//               forced vacuums and until wraparound
+// The rate is measured from the next XID to be assigned (read without
+// assigning one) over -sample, or, with -state-file, since the previous run,
+// so a cron job needs no wait.
+//
+// Exit status follows the Nagios convention: 0 OK, 1 WARNING, 2 CRITICAL,
+// 3 UNKNOWN (could not check). WARNING when the oldest database is past
+// -warning percent of the way to wraparound or it is projected within
+// -warning-within; CRITICAL likewise with -critical and -critical-within.
+//
+//   go run ./cmd/wraparound
+//   go run ./cmd/wraparound -state-file=/var/tmp/wraparound.db1.json -warning=40 -critical=60
+//   */10 * * * * wraparound -dsn=... -state-file=... || page-oncall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// wraparoundLimit is how old the oldest XID can get: 2^31 minus the
+// 3 million the server keeps back before refusing new XIDs.
+const wraparoundLimit = 1<<31 - 3_000_000
+
+// Nagios exit codes.
+const (
+	exitOK = iota
+	exitWarning
+	exitCritical
+	exitUnknown
+)
+
+// xidAge is an object's distance from the next XID.
+type xidAge struct {
+	Name      string `json:"name"`
+	Age       int64  `json:"age"`
+	MXIDAge   int64  `json:"mxid_age,omitempty"`
+	FreezeMax int64  `json:"freeze_max_age,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+}
+
+// xminHolder keeps the oldest XID from advancing.
+type xminHolder struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Age  int64  `json:"age"`
+}
+
+// wraparoundReport is what the check found.
+type wraparoundReport struct {
+	FreezeMaxAge int64        `json:"autovacuum_freeze_max_age"`
+	Databases    []xidAge     `json:"databases"`
+	Tables       []xidAge     `json:"tables"`
+	Holders      []xminHolder `json:"holders"`
+	NextXID      int64        `json:"next_xid"`
+	RatePerSec   float64      `json:"xids_per_second"`
+	ToForced     float64      `json:"seconds_to_forced_vacuum,omitempty"`
+	ToWraparound float64      `json:"seconds_to_wraparound,omitempty"`
+	PctUsed      float64      `json:"pct_to_wraparound"`
+	Status       string       `json:"status"`
+}
+
+// wraparoundState is what -state-file keeps between runs.
+type wraparoundState struct {
+	Time    time.Time `json:"time"`
+	NextXID int64     `json:"next_xid"`
+}
+
+// nextXID reads the next XID to be assigned, epoch included, without
+// assigning one.
+func nextXID(ctx context.Context, pool *pgxpool.Pool) (int64, error) {
+	var xid int64
+	err := pool.QueryRow(ctx, "SELECT txid_snapshot_xmax(txid_current_snapshot())").Scan(&xid)
+	return xid, err
+}
+
+// readWraparound reads ages and holders; the rate is left to the caller.
+func readWraparound(ctx context.Context, pool *pgxpool.Pool, top int) (*wraparoundReport, error) {
+	r := &wraparoundReport{}
+	if err := pool.QueryRow(ctx, "SELECT current_setting('autovacuum_freeze_max_age')::bigint").Scan(&r.FreezeMaxAge); err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT datname::text, age(datfrozenxid)::bigint, mxid_age(datminmxid)::bigint
+		FROM pg_database
+		ORDER BY 2 DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database ages: %w", err)
+	}
+	if r.Databases, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (xidAge, error) {
+		var a xidAge
+		err := row.Scan(&a.Name, &a.Age, &a.MXIDAge)
+		return a, err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read database ages: %w", err)
+	}
+
+	rows, err = pool.Query(ctx, `
+		SELECT format('%I.%I', n.nspname, c.relname),
+		       greatest(age(c.relfrozenxid), coalesce(age(t.relfrozenxid), 0))::bigint,
+		       greatest(mxid_age(c.relminmxid), coalesce(mxid_age(t.relminmxid), 0))::bigint,
+		       coalesce((SELECT split_part(o, '=', 2)::bigint FROM unnest(c.reloptions) o
+		                 WHERE o LIKE 'autovacuum_freeze_max_age=%'),
+		                current_setting('autovacuum_freeze_max_age')::bigint),
+		       pg_total_relation_size(c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_class t ON t.oid = c.reltoastrelid
+		WHERE c.relkind IN ('r', 'm')
+		ORDER BY 2 DESC
+		LIMIT $1
+	`, top)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table ages: %w", err)
+	}
+	if r.Tables, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (xidAge, error) {
+		var a xidAge
+		err := row.Scan(&a.Name, &a.Age, &a.MXIDAge, &a.FreezeMax, &a.Bytes)
+		return a, err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read table ages: %w", err)
+	}
+
+	rows, err = pool.Query(ctx, `
+		SELECT * FROM (
+			SELECT 'snapshot', format('pid %s %s@%s %s', pid, usename, coalesce(nullif(application_name, ''), backend_type), coalesce(state, '')),
+			       age(backend_xmin)::bigint
+			FROM pg_stat_activity WHERE backend_xmin IS NOT NULL
+			UNION ALL
+			SELECT 'transaction', format('pid %s %s@%s %s', pid, usename, coalesce(nullif(application_name, ''), backend_type), coalesce(state, '')),
+			       age(backend_xid)::bigint
+			FROM pg_stat_activity WHERE backend_xid IS NOT NULL
+			UNION ALL
+			SELECT 'prepared', format('%s (prepared %s)', gid, prepared), age(transaction)::bigint
+			FROM pg_prepared_xacts
+			UNION ALL
+			SELECT 'slot xmin', slot_name::text, age(xmin)::bigint
+			FROM pg_replication_slots WHERE xmin IS NOT NULL
+			UNION ALL
+			SELECT 'slot catalog_xmin', slot_name::text, age(catalog_xmin)::bigint
+			FROM pg_replication_slots WHERE catalog_xmin IS NOT NULL
+		) h
+		ORDER BY 3 DESC
+		LIMIT 5
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xmin holders: %w", err)
+	}
+	if r.Holders, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (xminHolder, error) {
+		var h xminHolder
+		err := row.Scan(&h.Kind, &h.Name, &h.Age)
+		return h, err
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read xmin holders: %w", err)
+	}
+	return r, nil
+}
+
+// wraparoundOptions are the thresholds of wraparound.
+type wraparoundOptions struct {
+	warning, critical             float64
+	warningWithin, criticalWithin time.Duration
+}
+
+// assess projects the time left at rate and sets the status.
+func (r *wraparoundReport) assess(opts wraparoundOptions) int {
+	oldest := int64(0)
+	if len(r.Databases) > 0 {
+		oldest = r.Databases[0].Age
+	}
+	r.PctUsed = 100 * float64(oldest) / wraparoundLimit
+	if r.RatePerSec > 0 {
+		r.ToWraparound = float64(wraparoundLimit-oldest) / r.RatePerSec
+		if len(r.Tables) > 0 {
+			t := r.Tables[0]
+			r.ToForced = max(float64(t.FreezeMax-t.Age), 0) / r.RatePerSec
+		}
+	}
+	within := func(d time.Duration) bool {
+		return d > 0 && r.RatePerSec > 0 && r.ToWraparound < d.Seconds()
+	}
+	switch {
+	case r.PctUsed >= opts.critical || within(opts.criticalWithin):
+		r.Status = "CRITICAL"
+		return exitCritical
+	case r.PctUsed >= opts.warning || within(opts.warningWithin):
+		r.Status = "WARNING"
+		return exitWarning
+	}
+	r.Status = "OK"
+	return exitOK
+}
+
+// formatSeconds renders a projection in days or hours.
+func formatSeconds(s float64) string {
+	if s <= 0 || math.IsInf(s, 0) {
+		return "never at this rate"
+	}
+	return formatAge(time.Duration(s * float64(time.Second)))
+}
+
+// printWraparound writes the report for a person.
+func printWraparound(r *wraparoundReport) {
+	fmt.Printf("%s: oldest database is %.1f%% of the way to wraparound\n", r.Status, r.PctUsed)
+	fmt.Printf("\n%-30s %14s %14s\n", "DATABASE", "XID AGE", "MXID AGE")
+	for _, d := range r.Databases {
+		fmt.Printf("%-30s %14d %14d\n", d.Name, d.Age, d.MXIDAge)
+	}
+	fmt.Printf("\n%-50s %14s %8s %14s %10s\n", "TABLE", "XID AGE", "FREEZE%", "MXID AGE", "SIZE")
+	for _, t := range r.Tables {
+		mark := ""
+		if t.Age >= t.FreezeMax {
+			mark = "  ⚠️  past autovacuum_freeze_max_age"
+		}
+		fmt.Printf("%-50s %14d %7.0f%% %14d %10s%s\n", t.Name, t.Age, 100*float64(t.Age)/float64(t.FreezeMax),
+			t.MXIDAge, formatBytes(t.Bytes), mark)
+	}
+	if len(r.Holders) > 0 {
+		fmt.Printf("\n%-18s %-60s %14s\n", "HOLDING XMIN", "", "AGE")
+		for _, h := range r.Holders {
+			fmt.Printf("%-18s %-60s %14d\n", h.Kind, h.Name, h.Age)
+		}
+	}
+	fmt.Println()
+	if r.RatePerSec <= 0 {
+		fmt.Println("XID rate: not measured (no XIDs assigned during the sample)")
+		return
+	}
+	fmt.Printf("XID rate: %.0f/s (%.1fM/day)\n", r.RatePerSec, r.RatePerSec*86400/1e6)
+	if len(r.Tables) > 0 {
+		fmt.Printf("Forced anti-wraparound vacuum of %s in: %s\n", r.Tables[0].Name, formatSeconds(r.ToForced))
+	}
+	fmt.Printf("Wraparound in: %s\n", formatSeconds(r.ToWraparound))
+}
+
+// measureXIDRate returns XIDs per second, from -state-file when it holds
+// an earlier reading of the same server, else by waiting sample.
+func measureXIDRate(ctx context.Context, pool *pgxpool.Pool, stateFile string, sample time.Duration) (int64, float64, error) {
+	var prev wraparoundState
+	if stateFile != "" {
+		data, err := os.ReadFile(stateFile)
+		if err == nil {
+			err = json.Unmarshal(data, &prev)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "⚠️  -state-file: %v\n", err)
+		}
+	}
+	next, err := nextXID(ctx, pool)
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now()
+	save := func() {
+		if stateFile == "" {
+			return
+		}
+		data, _ := json.Marshal(wraparoundState{Time: now, NextXID: next})
+		if err := os.WriteFile(stateFile, data, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  -state-file: %v\n", err)
+		}
+	}
+
+	// A reading from another server, or one after a restore, runs ahead.
+	if !prev.Time.IsZero() && prev.NextXID <= next && now.Sub(prev.Time) >= time.Second {
+		save()
+		return next, float64(next-prev.NextXID) / now.Sub(prev.Time).Seconds(), nil
+	}
+	select {
+	case <-ctx.Done():
+		return 0, 0, ctx.Err()
+	case <-time.After(sample):
+	}
+	start, startXID := now, next
+	if next, err = nextXID(ctx, pool); err != nil {
+		return 0, 0, err
+	}
+	now = time.Now()
+	save()
+	return next, float64(next-startXID) / now.Sub(start).Seconds(), nil
+}
+
+// Wraparound runs the wraparound command line tool and exits with the
+// Nagios status.
+func Wraparound() {
+	var dsn, stateFile, format string
+	var top int
+	var sample time.Duration
+	var opts wraparoundOptions
+	registerDSNFlag(&dsn)
+	flag.IntVar(&top, "top", 10, "Show this many of the oldest tables")
+	flag.DurationVar(&sample, "sample", 10*time.Second, "Measure the XID rate over this long (without a usable -state-file)")
+	flag.StringVar(&stateFile, "state-file", "", "Keep the last XID reading here and measure the rate since the previous run")
+	flag.Float64Var(&opts.warning, "warning", 50, "WARNING past this percentage of the way to wraparound")
+	flag.Float64Var(&opts.critical, "critical", 75, "CRITICAL past this percentage of the way to wraparound")
+	flag.DurationVar(&opts.warningWithin, "warning-within", 30*24*time.Hour, "WARNING when wraparound is projected within this long (0: off)")
+	flag.DurationVar(&opts.criticalWithin, "critical-within", 7*24*time.Hour, "CRITICAL when wraparound is projected within this long (0: off)")
+	flag.StringVar(&format, "format", "text", "Output format: text or json")
+	flag.Parse()
+
+	unknown := func(err error) {
+		fmt.Printf("UNKNOWN: %v\n", err)
+		os.Exit(exitUnknown)
+	}
+	if format != "text" && format != "json" {
+		unknown(fmt.Errorf("invalid -format %q (use text or json)", format))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sample+time.Minute)
+	defer cancel()
+	pool, err := connect(ctx, dsn, "wraparound", 1)
+	if err != nil {
+		unknown(err)
+	}
+	defer pool.Close()
+
+	report, err := readWraparound(ctx, pool, top)
+	if err != nil {
+		unknown(err)
+	}
+	if report.NextXID, report.RatePerSec, err = measureXIDRate(ctx, pool, stateFile, sample); err != nil {
+		unknown(err)
+	}
+	status := report.assess(opts)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			unknown(err)
+		}
+	} else {
+		printWraparound(report)
+	}
+	pool.Close()
+	os.Exit(status)
+}
@@ -0,0 +1,173 @@
+package planhash
+
+// ============================================================================
+// JSON PLANS (EXPLAIN (FORMAT JSON), auto_explain.log_format = json)
+// ============================================================================
+//
+// TextFromJSON writes the node lines of a JSON plan the way EXPLAIN's text
+// format names them (explain.c), e.g. "->  Parallel Index Scan Backward
+// using orders_pkey on orders o", "Hash Left Join", "Partial
+// HashAggregate", plus the Sort Key and Join Filter lines. That is all
+// Hash looks at; other details are left out.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// planNode is the part of a JSON plan node TextFromJSON reads.
+type planNode struct {
+	NodeType      string     `json:"Node Type"`
+	Strategy      string     `json:"Strategy"`
+	PartialMode   string     `json:"Partial Mode"`
+	Operation     string     `json:"Operation"`
+	JoinType      string     `json:"Join Type"`
+	ParallelAware bool       `json:"Parallel Aware"`
+	AsyncCapable  bool       `json:"Async Capable"`
+	CustomName    string     `json:"Custom Plan Provider"`
+	Direction     string     `json:"Scan Direction"`
+	IndexName     string     `json:"Index Name"`
+	Relation      string     `json:"Relation Name"`
+	Function      string     `json:"Function Name"`
+	TableFunction string     `json:"Table Function Name"`
+	CTE           string     `json:"CTE Name"`
+	Tuplestore    string     `json:"Tuplestore Name"`
+	Alias         string     `json:"Alias"`
+	SortKey       []string   `json:"Sort Key"`
+	JoinFilter    string     `json:"Join Filter"`
+	Plans         []planNode `json:"Plans"`
+}
+
+// TextFromJSON renders a JSON plan as text for Hash. It accepts the array
+// EXPLAIN prints, the {"Plan": ...} object auto_explain logs, or a plan
+// node itself.
+func TextFromJSON(data []byte) (string, error) {
+	var root struct {
+		Plan *planNode `json:"Plan"`
+	}
+	trimmed := strings.TrimSpace(string(data))
+	var err error
+	switch {
+	case strings.HasPrefix(trimmed, "["):
+		var list []struct {
+			Plan *planNode `json:"Plan"`
+		}
+		if err = json.Unmarshal([]byte(trimmed), &list); err == nil && len(list) > 0 {
+			root.Plan = list[0].Plan
+		}
+	default:
+		if err = json.Unmarshal([]byte(trimmed), &root); err == nil && root.Plan == nil {
+			root.Plan = &planNode{}
+			err = json.Unmarshal([]byte(trimmed), root.Plan)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON plan: %w", err)
+	}
+	if root.Plan == nil || root.Plan.NodeType == "" {
+		return "", fmt.Errorf("invalid JSON plan: no plan node")
+	}
+	var b strings.Builder
+	writeNode(&b, root.Plan, 0)
+	return b.String(), nil
+}
+
+// writeNode writes n and its children, indented like EXPLAIN.
+func writeNode(b *strings.Builder, n *planNode, depth int) {
+	indent := strings.Repeat("      ", depth)
+	arrow := ""
+	if depth > 0 {
+		arrow = "->  "
+	}
+	fmt.Fprintf(b, "%s%s%s\n", indent, arrow, nodeLabel(n))
+	if len(n.SortKey) > 0 {
+		fmt.Fprintf(b, "%s      Sort Key: %s\n", indent, strings.Join(n.SortKey, ", "))
+	}
+	if n.JoinFilter != "" {
+		fmt.Fprintf(b, "%s      Join Filter: %s\n", indent, n.JoinFilter)
+	}
+	for i := range n.Plans {
+		writeNode(b, &n.Plans[i], depth+1)
+	}
+}
+
+// nodeLabel is the node's name line in text format.
+func nodeLabel(n *planNode) string {
+	name := n.NodeType
+	switch n.NodeType {
+	case "Aggregate":
+		switch n.Strategy {
+		case "Sorted":
+			name = "GroupAggregate"
+		case "Hashed":
+			name = "HashAggregate"
+		case "Mixed":
+			name = "MixedAggregate"
+		}
+		if n.PartialMode == "Partial" || n.PartialMode == "Finalize" {
+			name = n.PartialMode + " " + name
+		}
+	case "SetOp":
+		if n.Strategy == "Hashed" {
+			name = "HashSetOp"
+		}
+	case "ModifyTable":
+		name = n.Operation
+	case "Custom Scan":
+		name = fmt.Sprintf("Custom Scan (%s)", n.CustomName)
+	case "Nested Loop", "Merge Join", "Hash Join":
+		if n.JoinType != "" && n.JoinType != "Inner" {
+			name = strings.TrimSuffix(n.NodeType, " Join") + " " + n.JoinType + " Join"
+		}
+	}
+	if n.ParallelAware {
+		name = "Parallel " + name
+	}
+	if n.AsyncCapable {
+		name = "Async " + name
+	}
+
+	switch n.NodeType {
+	case "Index Scan", "Index Only Scan":
+		if n.Direction == "Backward" {
+			name += " Backward"
+		}
+		name += " using " + quoteIdent(n.IndexName)
+	case "Bitmap Index Scan":
+		return name + " on " + quoteIdent(n.IndexName)
+	}
+
+	object := n.Relation
+	for _, o := range []string{n.Function, n.TableFunction, n.CTE, n.Tuplestore} {
+		if object == "" {
+			object = o
+		}
+	}
+	if object == "" && n.Alias == "" {
+		return name
+	}
+	name += " on"
+	if object != "" {
+		name += " " + quoteIdent(object)
+	}
+	if n.Alias != "" && n.Alias != object {
+		name += " " + quoteIdent(n.Alias)
+	}
+	return name
+}
+
+// quoteIdent quotes a name the way EXPLAIN does when it needs quotes.
+func quoteIdent(s string) string {
+	plain := s != "" && !(s[0] >= '0' && s[0] <= '9')
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			plain = false
+			break
+		}
+	}
+	if plain {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,59 @@
+// Package planhash hashes the structure of a PostgreSQL plan: its scan,
+// join, aggregate and sort nodes, without costs, row counts or timings.
+// Two executions that took the same plan hash alike; a plan change is a
+// new hash. The stress tool's plan monitor and explainlog (auto_explain
+// entries in the server log) use it, so their hashes compare.
+//
+//	planhash.Hash(explainText)       // EXPLAIN (FORMAT TEXT) output
+//	text, err := planhash.TextFromJSON(explainJSON)
+//	planhash.Hash(text)              // the same hash for the same plan
+package planhash
+
+// ============================================================================
+// PLAN STRUCTURE HASH
+// ============================================================================
+//
+// The structure of a text plan is its lines naming a Scan, Join,
+// Aggregate or Sort (node lines, Sort Key, Join Filter), cut before
+// "(cost=" and "(actual", trimmed. Lines that only exist with ANALYZE
+// (Sort Method, Rows Removed by Join Filter, per-worker lines) are left
+// out, so a plan logged with log_analyze hashes like the plain EXPLAIN.
+// The hash is the MD5 of those lines joined with "|", in hex.
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+)
+
+// runtimeLines start the lines that only EXPLAIN ANALYZE prints.
+var runtimeLines = []string{"Sort Method:", "Rows Removed by ", "Worker ", "Buffers:", "Planning", "Execution"}
+
+// Structure returns the lines of planText that Hash hashes.
+func Structure(planText string) []string {
+	var structure []string
+	for _, line := range strings.Split(planText, "\n") {
+		if !strings.Contains(line, "Scan") && !strings.Contains(line, "Join") &&
+			!strings.Contains(line, "Aggregate") && !strings.Contains(line, "Sort") {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		runtime := false
+		for _, prefix := range runtimeLines {
+			runtime = runtime || strings.HasPrefix(trimmed, prefix)
+		}
+		if runtime {
+			continue
+		}
+		cleaned, _, _ := strings.Cut(line, "(cost=")
+		cleaned, _, _ = strings.Cut(cleaned, "(actual")
+		structure = append(structure, strings.TrimSpace(cleaned))
+	}
+	return structure
+}
+
+// Hash returns the structure hash of a text plan.
+func Hash(planText string) string {
+	sum := md5.Sum([]byte(strings.Join(Structure(planText), "|")))
+	return hex.EncodeToString(sum[:])
+}
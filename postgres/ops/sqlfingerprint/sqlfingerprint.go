@@ -0,0 +1,462 @@
+// Package sqlfingerprint normalizes SQL text and fingerprints it, so that
+// tools looking at the same query from different sides agree that it is
+// the same query: a statement with literals from a server log, the
+// $1-parameterized text of pg_stat_statements, a plan captured by the
+// stress tool and an auto_explain entry all get one fingerprint.
+//
+//	sqlfingerprint.Normalize("SELECT * FROM t WHERE id IN (1, 2, 3) -- hot")
+//	// select * from t where id in (...)
+//	sqlfingerprint.Fingerprint("select * from T where ID in ($1,$2)")
+//	// the same 16 hex digits as above
+//
+// Normalization works on tokens, not on a parse tree: it doesn't need the
+// server, works for any statement and any PostgreSQL version, and accepts
+// fragments and statements cut off by track_activity_query_size.
+package sqlfingerprint
+
+// ============================================================================
+// NORMALIZATION
+// ============================================================================
+//
+// Normalize rewrites a statement as:
+//   literals       strings (also E'', B'', X'', U&'' and dollar-quoted),
+//                  numbers (with their sign) and parameters ($1, ?) → ?
+//   lists          IN (...), ARRAY[...] and the rows of VALUES (...) when
+//                  they hold only literals, so batch sizes don't matter
+//   comments       removed, and with them application tags like /* app */
+//   identifiers    unquoted names and keywords lowercased, as PostgreSQL
+//                  folds them; "Quoted" names kept as written
+//   whitespace     one space between tokens, none inside parentheses,
+//                  before commas or around . and ::
+// and drops a trailing semicolon.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Fingerprint is the first 8 bytes of the SHA-256 of the normalized
+// statement, in hex.
+func Fingerprint(sql string) string {
+	sum := sha256.Sum256([]byte(Normalize(sql)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Normalize returns the normalized statement.
+func Normalize(sql string) string {
+	tokens := foldSigns(lex(sql))
+	tokens = collapseLists(tokens)
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return render(tokens)
+}
+
+// tokenKind classifies a token.
+type tokenKind int
+
+const (
+	wordToken     tokenKind = iota // Unquoted identifier or keyword, lowercased
+	quotedToken                    // "Quoted identifier"
+	literalToken                   // ?
+	operatorToken                  // +, <=, ::, ...
+	punctToken                     // ( ) [ ] , ; .
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// placeholder is the text every literal becomes.
+const placeholder = "?"
+
+// keywords are the words after which a - is a sign, not a minus, and
+// which are followed by a space before a parenthesis.
+var keywords = map[string]bool{
+	"all": true, "and": true, "any": true, "as": true, "between": true, "by": true, "case": true,
+	"else": true, "except": true, "exists": true, "from": true, "having": true, "ilike": true,
+	"in": true, "intersect": true, "is": true, "join": true, "like": true, "limit": true, "not": true,
+	"offset": true, "on": true, "or": true, "over": true, "returning": true, "select": true, "set": true,
+	"similar": true, "some": true, "then": true, "union": true, "using": true, "values": true,
+	"when": true, "where": true, "with": true,
+}
+
+// lex splits sql into tokens, dropping comments and turning literals into
+// placeholders.
+func lex(sql string) []token {
+	var tokens []token
+	emit := func(kind tokenKind, text string) { tokens = append(tokens, token{kind, text}) }
+	n := len(sql)
+	for i := 0; i < n; {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			i++
+
+		case c == '-' && i+1 < n && sql[i+1] == '-':
+			for i < n && sql[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < n && sql[i+1] == '*':
+			// Block comments nest in PostgreSQL.
+			depth := 0
+			for i < n {
+				if strings.HasPrefix(sql[i:], "/*") {
+					depth, i = depth+1, i+2
+				} else if strings.HasPrefix(sql[i:], "*/") {
+					depth, i = depth-1, i+2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+
+		case c == '\'':
+			i = skipString(sql, i, false)
+			emit(literalToken, placeholder)
+
+		case c == '"':
+			j := i + 1
+			for j < n {
+				if sql[j] == '"' {
+					if j+1 < n && sql[j+1] == '"' {
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+			emit(quotedToken, sql[i:j])
+			i = j
+
+		case c == '$':
+			j := i + 1
+			for j < n && isDigit(sql[j]) {
+				j++
+			}
+			if j > i+1 {
+				emit(literalToken, placeholder) // $1
+				i = j
+				break
+			}
+			if end, ok := skipDollarQuote(sql, i); ok {
+				emit(literalToken, placeholder)
+				i = end
+				break
+			}
+			emit(operatorToken, "$")
+			i++
+
+		case isDigit(c) || c == '.' && i+1 < n && isDigit(sql[i+1]):
+			i = skipNumber(sql, i)
+			emit(literalToken, placeholder)
+
+		case isWordStart(c):
+			j := i
+			for j < n && isWordPart(sql[j]) {
+				j++
+			}
+			word := strings.ToLower(sql[i:j])
+			// String prefixes: E'..', B'..', X'..', N'..', U&'..'.
+			if j < n && sql[j] == '\'' && (word == "e" || word == "b" || word == "x" || word == "n") {
+				i = skipString(sql, j, word == "e")
+				emit(literalToken, placeholder)
+				break
+			}
+			if word == "u" && j+1 < n && sql[j] == '&' && sql[j+1] == '\'' {
+				i = skipString(sql, j+1, false)
+				emit(literalToken, placeholder)
+				break
+			}
+			emit(wordToken, word)
+			i = j
+
+		case c == ':' && i+1 < n && sql[i+1] == ':':
+			emit(operatorToken, "::")
+			i += 2
+
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',' || c == ';' || c == '.':
+			emit(punctToken, string(c))
+			i++
+
+		case c == '?' && (i+1 == n || !isOperatorChar(sql[i+1])) && placeholderContext(tokens):
+			// A client-side placeholder (JDBC, database/sql drivers), not
+			// the jsonb ? operator.
+			emit(literalToken, placeholder)
+			i++
+
+		case isOperatorChar(c):
+			j := i
+			for j < n && isOperatorChar(sql[j]) {
+				if j > i && (strings.HasPrefix(sql[j:], "--") || strings.HasPrefix(sql[j:], "/*")) {
+					break
+				}
+				j++
+			}
+			emit(operatorToken, sql[i:j])
+			i = j
+
+		default:
+			emit(operatorToken, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// placeholderContext reports whether a ? here stands where a value goes:
+// after an operator, a keyword, an opening parenthesis or a comma.
+func placeholderContext(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	prev := tokens[len(tokens)-1]
+	switch prev.kind {
+	case operatorToken:
+		return true
+	case punctToken:
+		return prev.text == "(" || prev.text == "[" || prev.text == ","
+	case wordToken:
+		return keywords[prev.text]
+	}
+	return false
+}
+
+// skipString returns the index after the string literal opening at i;
+// backslash escapes count with escapes (E strings).
+func skipString(sql string, i int, escapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch sql[j] {
+		case '\\':
+			if escapes {
+				j++
+			}
+		case '\'':
+			if j+1 < len(sql) && sql[j+1] == '\'' {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+// skipDollarQuote returns the index after the $tag$...$tag$ string opening
+// at i, if one does.
+func skipDollarQuote(sql string, i int) (int, bool) {
+	j := i + 1
+	for j < len(sql) && sql[j] != '$' {
+		if !isWordPart(sql[j]) || isDigit(sql[j]) && j == i+1 {
+			return 0, false
+		}
+		j++
+	}
+	if j >= len(sql) {
+		return 0, false
+	}
+	tag := sql[i : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return len(sql), true
+	}
+	return j + 1 + end + len(tag), true
+}
+
+// skipNumber returns the index after the numeric literal starting at i:
+// integers, decimals, exponents, 0x/0o/0b and _ separators.
+func skipNumber(sql string, i int) int {
+	n := len(sql)
+	if sql[i] == '0' && i+1 < n && strings.ContainsRune("xXoObB", rune(sql[i+1])) {
+		j := i + 2
+		for j < n && (isHexDigit(sql[j]) || sql[j] == '_') {
+			j++
+		}
+		return j
+	}
+	j := i
+	for j < n && (isDigit(sql[j]) || sql[j] == '_') {
+		j++
+	}
+	if j < n && sql[j] == '.' && !(j+1 < n && sql[j+1] == '.') {
+		j++
+		for j < n && (isDigit(sql[j]) || sql[j] == '_') {
+			j++
+		}
+	}
+	if j < n && (sql[j] == 'e' || sql[j] == 'E') {
+		k := j + 1
+		if k < n && (sql[k] == '+' || sql[k] == '-') {
+			k++
+		}
+		if k < n && isDigit(sql[k]) {
+			for k < n && isDigit(sql[k]) {
+				k++
+			}
+			j = k
+		}
+	}
+	return j
+}
+
+// foldSigns merges a - or + in front of a literal into it, where it is a
+// sign: id = -1 and id = 1 are the same query.
+func foldSigns(tokens []token) []token {
+	out := tokens[:0:0]
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind == operatorToken && (t.text == "-" || t.text == "+") &&
+			i+1 < len(tokens) && tokens[i+1].kind == literalToken && placeholderContext(out) {
+			continue
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// collapseLists replaces lists of literals with (...) and [...].
+func collapseLists(tokens []token) []token {
+	var out []token
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind == punctToken && (t.text == "(" || t.text == "[") {
+			closing := ")"
+			if t.text == "[" {
+				closing = "]"
+			}
+			if end, ok := literalList(tokens, i+1, closing); ok && listContext(out, t.text) {
+				out = append(out, token{punctToken, t.text}, token{operatorToken, "..."}, token{punctToken, closing})
+				i = end
+				// VALUES (...), (...), (...) is one row.
+				if isValuesRow(out) {
+					for i+1 < len(tokens) && tokens[i+1].text == "," && i+2 < len(tokens) && tokens[i+2].text == "(" {
+						next, ok := literalList(tokens, i+3, ")")
+						if !ok {
+							break
+						}
+						i = next
+					}
+				}
+				continue
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// literalList reports whether tokens from i are literals (optionally with
+// a cast each) or rows of them, separated by commas up to closing; end is
+// its index.
+func literalList(tokens []token, i int, closing string) (end int, ok bool) {
+	expectItem := true
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case expectItem && t.kind == literalToken:
+			expectItem = false
+			// ?::type, ?::type[], ?::schema.type
+			for i+2 < len(tokens) && tokens[i+1].text == "::" && tokens[i+2].kind == wordToken {
+				i += 2
+				for i+2 < len(tokens) && tokens[i+1].text == "." && tokens[i+2].kind != punctToken {
+					i += 2
+				}
+				for i+2 < len(tokens) && tokens[i+1].text == "[" && tokens[i+2].text == "]" {
+					i += 2
+				}
+			}
+		case expectItem && t.text == "(":
+			// A row: (a, b) IN ((1, 2), (3, 4)).
+			if i, ok = literalList(tokens, i+1, ")"); !ok {
+				return 0, false
+			}
+			expectItem = false
+		case !expectItem && t.text == ",":
+			expectItem = true
+		case !expectItem && t.kind == punctToken && t.text == closing:
+			return i, true
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// listContext reports whether the parenthesis or bracket just about to be
+// added to out opens a list: after IN, ARRAY or VALUES (or a row of it).
+func listContext(out []token, open string) bool {
+	if len(out) == 0 {
+		return false
+	}
+	prev := out[len(out)-1]
+	if open == "[" {
+		return prev.kind == wordToken && prev.text == "array"
+	}
+	return prev.kind == wordToken && (prev.text == "in" || prev.text == "values") || isValuesRow(out) && prev.text == ","
+}
+
+// isValuesRow reports whether out ends inside VALUES (...), (...).
+func isValuesRow(out []token) bool {
+	depth := 0
+	for i := len(out) - 1; i >= 0; i-- {
+		switch out[i].text {
+		case ")":
+			depth++
+		case "(":
+			depth--
+			if depth < 0 {
+				return false
+			}
+		case ",":
+		default:
+			if depth == 0 && out[i].kind != operatorToken {
+				return out[i].kind == wordToken && out[i].text == "values"
+			}
+		}
+	}
+	return false
+}
+
+// render joins the tokens with the spacing Normalize promises.
+func render(tokens []token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && needSpace(tokens[i-1], t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+func needSpace(prev, t token) bool {
+	switch {
+	case prev.text == "(" || prev.text == "[" || prev.text == "." || prev.text == "::":
+		return false
+	case t.text == ")" || t.text == "]" || t.text == "," || t.text == ";" || t.text == "." || t.text == "::":
+		return false
+	case t.text == "...":
+		return false
+	case t.text == "(" || t.text == "[":
+		// f(x) and a[1], but IN (...) and VALUES (...).
+		return prev.kind != wordToken && prev.kind != quotedToken && prev.text != ")" && prev.text != "]" || keywords[prev.text]
+	}
+	return true
+}
+
+func isDigit(c byte) bool    { return c >= '0' && c <= '9' }
+func isHexDigit(c byte) bool { return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F' }
+func isWordStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= 0x80
+}
+func isWordPart(c byte) bool { return isWordStart(c) || isDigit(c) || c == '$' }
+
+// isOperatorChar reports whether c can be part of a PostgreSQL operator.
+func isOperatorChar(c byte) bool { return strings.IndexByte("+-*/<>=~!@#%^&|`?", c) >= 0 }
@@ -0,0 +1,356 @@
+package main
+
+// ============================================================================
+// CHAOS: RANDOM BACKEND TERMINATION (-chaos-interval=30s)
+// ============================================================================
+//
+// Does the application survive its database connections being killed? A
+// failover, a pooler restart or a DBA's pg_terminate_backend all look the
+// same to the client: the next read on the socket returns FATAL 57P01 or
+// EOF. Every chaos.interval the injector terminates a random pooled
+// simulator session (or chaos.terminate_pct of them) and the workers
+// behave like a resilient client would:
+//   classify  terminated (57P01 admin_shutdown) and connection_lost (closed
+//             socket, EOF) are retryable; anything else is not, retrying a
+//             syntax error or a timeout only doubles the load
+//   retry     up to chaos.retries times with exponential backoff starting at
+//             chaos.retry_backoff; pgxpool discards the dead connection, so
+//             the retry runs on a fresh one. Only reads are retried: a write
+//             whose connection died after COMMIT may already be applied, so
+//             without an idempotency key its error is surfaced instead
+// The report counts errors per class, retries, queries that recovered (and
+// the latency the caller saw including backoff) and queries whose error
+// still reached the caller. Per round, recovery time is from the
+// termination to the first successful query after the last connection
+// error it caused; a round without errors means the killed sessions were
+// idle and replaced before anyone used them.
+//
+// Only pooled sessions (application_name read_workload_simulator) are
+// targeted, never the injector's own. Terminating backends of the same
+// role needs no privileges; others need pg_signal_backend.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	chaosTerminated     = "terminated"
+	chaosConnectionLost = "connection_lost"
+	chaosOther          = "other"
+)
+
+// ChaosRound is one termination and the errors that followed it.
+type ChaosRound struct {
+	OffsetSec  float64 `json:"offset_sec"`
+	Sessions   int64   `json:"sessions"`   // Simulator sessions at the time
+	Terminated int64   `json:"terminated"` // pg_terminate_backend returned true
+	Errors     int64   `json:"errors"`     // Connection errors until the next round
+	RecoveryMs float64 `json:"recovery_ms,omitempty"`
+
+	at          time.Time
+	lastErr     time.Time
+	recoveredAt time.Time
+}
+
+type ChaosInjector struct {
+	start       time.Time
+	rounds      []*ChaosRound
+	failures    int64 // Rounds where the terminate query itself failed
+	errors      map[string]int64
+	retries     int64
+	recovered   int64
+	surfaced    int64 // Retryable errors that reached the caller, failed writes included
+	recoveredAt []time.Duration
+	mu          sync.Mutex
+}
+
+var chaos *ChaosInjector
+
+func newChaosInjector() *ChaosInjector {
+	return &ChaosInjector{
+		start:  time.Now(),
+		errors: make(map[string]int64),
+	}
+}
+
+// classifyChaosError sorts a query error into a retry class.
+func classifyChaosError(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgErr.Code == "57P01" {
+			return chaosTerminated
+		}
+		return chaosOther
+	}
+	var netErr net.Error
+	switch {
+	case errors.Is(err, pgconn.ErrConnClosed),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.As(err, &netErr) && !netErr.Timeout():
+		return chaosConnectionLost
+	}
+	return chaosOther
+}
+
+// runChaos terminates sessions every chaos.interval until the run ends.
+func runChaos(ctx context.Context, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(config.ChaosInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			chaos.terminate(ctx, pool)
+		}
+	}
+}
+
+func (c *ChaosInjector) terminate(ctx context.Context, pool *pgxpool.Pool) {
+	round := &ChaosRound{}
+	err := pool.QueryRow(ctx, `
+		WITH s AS (
+			SELECT pid FROM pg_stat_activity
+			WHERE application_name = 'read_workload_simulator'
+			  AND datname = current_database()
+			  AND backend_type = 'client backend'
+			  AND pid <> pg_backend_pid()
+		), pick AS (
+			SELECT pid FROM s ORDER BY random()
+			LIMIT greatest(1, round($1::float8 * (SELECT count(*) FROM s)))::bigint
+		)
+		SELECT (SELECT count(*) FROM s), count(*) FILTER (WHERE pg_terminate_backend(pid))
+		FROM pick
+	`, config.ChaosTerminatePct).Scan(&round.Sessions, &round.Terminated)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Chaos: terminate failed: %v", err)
+			c.mu.Lock()
+			c.failures++
+			c.mu.Unlock()
+		}
+		return
+	}
+
+	round.at = time.Now()
+	round.OffsetSec = round.at.Sub(c.start).Seconds()
+	log.Printf("🪓 Chaos: terminated %d of %d simulator sessions", round.Terminated, round.Sessions)
+
+	c.mu.Lock()
+	c.rounds = append(c.rounds, round)
+	c.mu.Unlock()
+}
+
+// Record sees every query outcome, after retries, and closes the current
+// round's recovery window on the first success after its last error.
+func (c *ChaosInjector) Record(err error) {
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.rounds); n > 0 {
+		r := c.rounds[n-1]
+		if !r.lastErr.IsZero() && r.recoveredAt.IsZero() {
+			r.recoveredAt = time.Now()
+		}
+	}
+}
+
+// retry handles a failed query the way a resilient client would: retryable
+// errors are retried with exponential backoff, the rest are returned as is.
+// The returned duration is what the caller waited, backoff included.
+func (c *ChaosInjector) retry(ctx context.Context, d time.Duration, err error, run func() (time.Duration, error)) (time.Duration, error) {
+	total := d
+	for attempt := 1; ; attempt++ {
+		if ctx.Err() != nil {
+			return total, err
+		}
+		class := c.recordError(err)
+		if class == chaosOther {
+			return total, err
+		}
+		if attempt > config.ChaosRetries {
+			c.mu.Lock()
+			c.surfaced++
+			c.mu.Unlock()
+			return total, err
+		}
+
+		backoff := config.ChaosRetryBackoff << (attempt - 1)
+		select {
+		case <-ctx.Done():
+			return total, err
+		case <-time.After(backoff):
+		}
+		d, err = run()
+		total += backoff + d
+
+		c.mu.Lock()
+		c.retries++
+		if err == nil {
+			c.recovered++
+			c.recoveredAt = append(c.recoveredAt, total)
+		}
+		c.mu.Unlock()
+		if err == nil {
+			return total, nil
+		}
+	}
+}
+
+// surface records a failed write, which is never retried: a retryable
+// error on it reaches the caller as is.
+func (c *ChaosInjector) surface(err error) {
+	if c.recordError(err) != chaosOther {
+		c.mu.Lock()
+		c.surfaced++
+		c.mu.Unlock()
+	}
+}
+
+func (c *ChaosInjector) recordError(err error) string {
+	class := classifyChaosError(err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errors[class]++
+	if class != chaosOther {
+		if n := len(c.rounds); n > 0 {
+			r := c.rounds[n-1]
+			r.Errors++
+			r.lastErr = time.Now()
+			r.recoveredAt = time.Time{}
+		}
+	}
+	return class
+}
+
+type ChaosReport struct {
+	IntervalSec      float64          `json:"interval_sec"`
+	TerminatePct     float64          `json:"terminate_pct"` // 0: one session per round
+	MaxRetries       int              `json:"max_retries"`
+	Rounds           int              `json:"rounds"`
+	RoundFailures    int64            `json:"round_failures"`
+	Terminated       int64            `json:"terminated"`
+	Errors           map[string]int64 `json:"errors"`
+	Retries          int64            `json:"retries"`
+	Recovered        int64            `json:"recovered"`
+	Surfaced         int64            `json:"surfaced"`
+	RecoveredP50Ms   float64          `json:"recovered_p50_ms"`
+	RecoveredP99Ms   float64          `json:"recovered_p99_ms"`
+	RecoveredMaxMs   float64          `json:"recovered_max_ms"`
+	RoundsWithErrors int              `json:"rounds_with_errors"`
+	RecoveryP50Ms    float64          `json:"recovery_p50_ms"`
+	RecoveryMaxMs    float64          `json:"recovery_max_ms"`
+	Unrecovered      int              `json:"unrecovered"` // Rounds still failing when the run ended
+	History          []ChaosRound     `json:"history"`
+}
+
+func (c *ChaosInjector) Report() *ChaosReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := &ChaosReport{
+		IntervalSec:   config.ChaosInterval.Seconds(),
+		TerminatePct:  config.ChaosTerminatePct,
+		MaxRetries:    config.ChaosRetries,
+		Rounds:        len(c.rounds),
+		RoundFailures: c.failures,
+		Errors:        make(map[string]int64, len(c.errors)),
+		Retries:       c.retries,
+		Recovered:     c.recovered,
+		Surfaced:      c.surfaced,
+	}
+	for class, n := range c.errors {
+		r.Errors[class] = n
+	}
+
+	if len(c.recoveredAt) > 0 {
+		latencies := make([]time.Duration, len(c.recoveredAt))
+		copy(latencies, c.recoveredAt)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		r.RecoveredP50Ms = durationMs(latencies[len(latencies)*50/100])
+		r.RecoveredP99Ms = durationMs(latencies[len(latencies)*99/100])
+		r.RecoveredMaxMs = durationMs(latencies[len(latencies)-1])
+	}
+
+	var recoveries []time.Duration
+	for _, round := range c.rounds {
+		rr := *round
+		r.Terminated += rr.Terminated
+		if rr.Errors > 0 {
+			r.RoundsWithErrors++
+			if rr.recoveredAt.IsZero() {
+				r.Unrecovered++
+			} else {
+				d := rr.recoveredAt.Sub(rr.at)
+				rr.RecoveryMs = durationMs(d)
+				recoveries = append(recoveries, d)
+			}
+		}
+		r.History = append(r.History, rr)
+	}
+	if len(recoveries) > 0 {
+		sort.Slice(recoveries, func(i, j int) bool { return recoveries[i] < recoveries[j] })
+		r.RecoveryP50Ms = durationMs(recoveries[len(recoveries)*50/100])
+		r.RecoveryMaxMs = durationMs(recoveries[len(recoveries)-1])
+	}
+	return r
+}
+
+func (c *ChaosInjector) PrintReport() {
+	r := c.Report()
+
+	target := "1 session"
+	if r.TerminatePct > 0 {
+		target = fmt.Sprintf("%.0f%% of sessions", r.TerminatePct*100)
+	}
+	fmt.Printf("\n🪓 Chaos: Backend Termination (%s every %v, up to %d retries from %v):\n",
+		target, config.ChaosInterval, r.MaxRetries, config.ChaosRetryBackoff)
+	fmt.Printf("   Rounds:       %d (%d sessions terminated, %d rounds failed to run)\n",
+		r.Rounds, r.Terminated, r.RoundFailures)
+	fmt.Printf("   Errors:       %d terminated (57P01), %d connection lost, %d other (not retried)\n",
+		r.Errors[chaosTerminated], r.Errors[chaosConnectionLost], r.Errors[chaosOther])
+	fmt.Printf("   Retries:      %d  recovered %d  surfaced to the caller %d\n", r.Retries, r.Recovered, r.Surfaced)
+	if r.Recovered > 0 {
+		fmt.Printf("   Recovered:    caller waited p50 %.2fms  p99 %.2fms  max %.2fms (backoff included)\n",
+			r.RecoveredP50Ms, r.RecoveredP99Ms, r.RecoveredMaxMs)
+	}
+	if r.RoundsWithErrors > 0 {
+		fmt.Printf("   Recovery:     %d of %d rounds caused errors; recovered in p50 %.0fms  max %.0fms\n",
+			r.RoundsWithErrors, r.Rounds, r.RecoveryP50Ms, r.RecoveryMaxMs)
+	}
+
+	switch {
+	case r.Rounds == 0:
+		fmt.Println("   ⚠️  No termination ran; check the log (pg_signal_backend needed for other roles' sessions).")
+	case r.Surfaced > 0 && r.MaxRetries == 0:
+		fmt.Printf("   ⚠️  %d queries failed on a killed connection and reached the caller. pgxpool drops the dead\n", r.Surfaced)
+		fmt.Println("      connection, so a single retry runs on a fresh one: try -chaos-retries=2.")
+	case r.Surfaced > 0:
+		fmt.Printf("   ⚠️  %d queries still failed after %d retries: the pool could not hand out a working connection\n",
+			r.Surfaced, r.MaxRetries)
+		fmt.Println("      in time. Raise the backoff, or keep MinConns warm so reconnects are not on the request path.")
+	case r.Recovered > 0:
+		fmt.Println("   ✅ Every query hit by a termination recovered on retry; no error reached the caller.")
+	case r.RoundsWithErrors == 0:
+		fmt.Println("   ✅ No client-visible errors: the killed sessions were idle and replaced before use.")
+	}
+	if r.Unrecovered > 0 {
+		fmt.Printf("   ⚠️  %d round(s) were still failing when the run ended.\n", r.Unrecovered)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+// ============================================================================
+// CONNECTION CHURN MODE (-churn=0.25)
+// ============================================================================
+//
+// A fraction of the workers bypass the pool and open a brand-new connection
+// for every query, the way serverless/Lambda clients behave. We measure
+// client-side connection establishment latency and, on PG14+, the number of
+// backend sessions the server had to fork (pg_stat_database.sessions).
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ChurnStats struct {
+	Connects       int64
+	ConnectErrors  int64
+	ConnectLatency []time.Duration
+	mu             sync.Mutex
+
+	// Server-side view, sampled at start and end of the run
+	sessionsStart int64
+	sessionsEnd   int64
+	peakBackends  int64
+	serverStatsOK bool
+}
+
+var churnStats = &ChurnStats{}
+
+// churnWorkerCount is how many of the regular sessions run in churn mode.
+func churnWorkerCount() int {
+	if config.ChurnFraction <= 0 {
+		return 0
+	}
+	return int(math.Round(config.ChurnFraction * float64(config.SessionCount)))
+}
+
+func (cs *ChurnStats) recordConnect(d time.Duration, err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err != nil {
+		cs.ConnectErrors++
+		return
+	}
+	cs.Connects++
+	cs.ConnectLatency = append(cs.ConnectLatency, d)
+}
+
+func runChurnWorker(ctx context.Context, workerID int, connConfig *pgx.ConnConfig, metrics *Metrics, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+			query := selectQuery(config.WorkloadType)
+
+			start := time.Now()
+			conn, err := pgx.ConnectConfig(ctx, connConfig)
+			churnStats.recordConnect(time.Since(start), err)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Churn worker %d: connect failed: %v", workerID, err)
+					time.Sleep(100 * time.Millisecond)
+				}
+				continue
+			}
+
+			_ = loadHintPlan(ctx, conn)
+			executeQuery(ctx, conn, query, metrics)
+			conn.Close(context.Background())
+
+			// Think time: 0-10ms
+			time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
+		}
+	}
+}
+
+func churnConnConfig() (*pgx.ConnConfig, error) {
+	connConfig, err := pgx.ParseConfig(config.DBConnString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	connConfig.RuntimeParams = sessionRuntimeParams()
+	connConfig.RuntimeParams["application_name"] = "read_workload_simulator_churn"
+	if netProxy != nil {
+		netProxy.route(&connConfig.Config)
+	}
+	if toxiScenario != nil {
+		toxiScenario.route(&connConfig.Config)
+	}
+	return connConfig, nil
+}
+
+// sampleServerSessions reads the cumulative session counter (PG14+) for the
+// current database. Older servers simply don't get the server-side view.
+func (cs *ChurnStats) sampleServerSessions(ctx context.Context, pool *pgxpool.Pool, start bool) {
+	var sessions int64
+	err := pool.QueryRow(ctx, `
+		SELECT sessions FROM pg_stat_database WHERE datname = current_database()
+	`).Scan(&sessions)
+	if err != nil {
+		return
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if start {
+		cs.sessionsStart = sessions
+	} else {
+		cs.sessionsEnd = sessions
+		cs.serverStatsOK = true
+	}
+}
+
+func (cs *ChurnStats) sampleBackends(ctx context.Context, pool *pgxpool.Pool) {
+	var backends int64
+	err := pool.QueryRow(ctx, `
+		SELECT count(*) FROM pg_stat_activity WHERE backend_type = 'client backend'
+	`).Scan(&backends)
+	if err != nil {
+		return
+	}
+
+	cs.mu.Lock()
+	if backends > cs.peakBackends {
+		cs.peakBackends = backends
+	}
+	cs.mu.Unlock()
+}
+
+type ChurnReport struct {
+	Workers        int     `json:"workers"`
+	Connects       int64   `json:"connects"`
+	ConnectErrors  int64   `json:"connect_errors"`
+	ConnectsPerSec float64 `json:"connects_per_sec"`
+	ConnectP50Ms   float64 `json:"connect_p50_ms"`
+	ConnectP95Ms   float64 `json:"connect_p95_ms"`
+	ConnectP99Ms   float64 `json:"connect_p99_ms"`
+	ConnectMaxMs   float64 `json:"connect_max_ms"`
+	BackendsForked int64   `json:"backends_forked,omitempty"` // PG14+ only
+	PeakBackends   int64   `json:"peak_client_backends,omitempty"`
+}
+
+func (cs *ChurnStats) Report(elapsed time.Duration) *ChurnReport {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	r := &ChurnReport{
+		Workers:        churnWorkerCount(),
+		Connects:       cs.Connects,
+		ConnectErrors:  cs.ConnectErrors,
+		ConnectsPerSec: float64(cs.Connects) / elapsed.Seconds(),
+		PeakBackends:   cs.peakBackends,
+	}
+	if cs.serverStatsOK {
+		r.BackendsForked = cs.sessionsEnd - cs.sessionsStart
+	}
+
+	if len(cs.ConnectLatency) > 0 {
+		latencies := make([]time.Duration, len(cs.ConnectLatency))
+		copy(latencies, cs.ConnectLatency)
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		r.ConnectP50Ms = durationMs(latencies[len(latencies)*50/100])
+		r.ConnectP95Ms = durationMs(latencies[len(latencies)*95/100])
+		r.ConnectP99Ms = durationMs(latencies[len(latencies)*99/100])
+		r.ConnectMaxMs = durationMs(latencies[len(latencies)-1])
+	}
+	return r
+}
+
+func (cs *ChurnStats) PrintReport(elapsed time.Duration) {
+	r := cs.Report(elapsed)
+
+	fmt.Printf("\n🔁 Connection Churn (%d workers connect-per-query):\n", r.Workers)
+	fmt.Printf("   Connections Opened:   %d (%.1f/sec)\n", r.Connects, r.ConnectsPerSec)
+	fmt.Printf("   Connect Errors:       %d\n", r.ConnectErrors)
+	if r.Connects > 0 {
+		fmt.Printf("   Connect Latency:      p50=%.2fms p95=%.2fms p99=%.2fms max=%.2fms\n",
+			r.ConnectP50Ms, r.ConnectP95Ms, r.ConnectP99Ms, r.ConnectMaxMs)
+	}
+	if r.BackendsForked > 0 {
+		fmt.Printf("   Backends Forked:      %d (%.1f/sec, pg_stat_database.sessions)\n",
+			r.BackendsForked, float64(r.BackendsForked)/elapsed.Seconds())
+	}
+	if r.PeakBackends > 0 {
+		fmt.Printf("   Peak Client Backends: %d\n", r.PeakBackends)
+	}
+}
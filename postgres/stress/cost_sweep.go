@@ -0,0 +1,466 @@
+package main
+
+// ============================================================================
+// PLANNER COST SWEEP (-cost-rpc=1.1,2,4 -cost-ecs=4GB,16GB,48GB)
+// ============================================================================
+//
+// random_page_cost and effective_cache_size describe the hardware to the
+// planner; the defaults (4 and 4GB) describe spinning disks and a small
+// box. A dedicated session walks the grid of cost_sweep.random_page_cost ×
+// cost_sweep.effective_cache_size (SET per session) and, at every point,
+// EXPLAINs and runs each read-only query of the workload, cost_sweep.repeats
+// times. An axis left empty stays at the server's setting. The server's own
+// settings are measured in every round too, as the reference; rounds visit
+// the points in the same order so warming and background load spread evenly.
+//
+// Plans are compared by structure hash (planhash, like the plan monitor).
+// The report has, per point, the total of the per-query median latencies,
+// the queries whose plan differs from the reference, and every flip: the
+// pair of neighbouring values on one axis where a query's plan changes.
+// A point is stable when each query kept one plan over all repeats and has
+// the same plan at the neighbouring points, so a small error in the
+// estimate of the hardware doesn't flip anything. The recommendation is the
+// fastest stable point.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/planhash"
+)
+
+// costPoint is one grid point; an empty value is the server's setting.
+type costPoint struct {
+	rpc, ecs string
+}
+
+// costCell is one query at one point.
+type costCell struct {
+	latency *QueryMetrics
+	plans   map[string]int // Plan hash -> times chosen
+}
+
+// dominant is the plan chosen most often; ties go to the smaller hash so
+// the report is deterministic.
+func (c *costCell) dominant() string {
+	var best string
+	for h, n := range c.plans {
+		if best == "" || n > c.plans[best] || (n == c.plans[best] && h < best) {
+			best = h
+		}
+	}
+	return best
+}
+
+type CostSweep struct {
+	rpcs      []string // Ascending; {""} when not swept
+	ecss      []string // Ascending; {""} when not swept
+	queries   []Query
+	cells     map[costPoint]map[string]*costCell
+	outlines  map[string]string // Plan hash -> node outline
+	serverRPC string
+	serverECS string
+	rounds    int
+	mu        sync.Mutex
+}
+
+var costSweep *CostSweep
+
+// costReference is the point measured at the server's settings.
+var costReference = costPoint{}
+
+func newCostSweep(rpcs, ecss []string) (*CostSweep, error) {
+	cs := &CostSweep{
+		cells:    make(map[costPoint]map[string]*costCell),
+		outlines: make(map[string]string),
+	}
+	rpcValues := make(map[string]float64)
+	for _, v := range rpcs {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("cost_sweep.random_page_cost: %q must be a number > 0", v)
+		}
+		rpcValues[v] = f
+		cs.rpcs = append(cs.rpcs, v)
+	}
+	sort.SliceStable(cs.rpcs, func(i, j int) bool { return rpcValues[cs.rpcs[i]] < rpcValues[cs.rpcs[j]] })
+	ecsBytes := make(map[string]int64)
+	for _, v := range ecss {
+		b, err := parseByteSize(v)
+		if err != nil {
+			return nil, fmt.Errorf("cost_sweep.effective_cache_size: %q: %w", v, err)
+		}
+		ecsBytes[v] = b
+		cs.ecss = append(cs.ecss, v)
+	}
+	sort.SliceStable(cs.ecss, func(i, j int) bool { return ecsBytes[cs.ecss[i]] < ecsBytes[cs.ecss[j]] })
+	if len(cs.rpcs) == 0 {
+		cs.rpcs = []string{""}
+	}
+	if len(cs.ecss) == 0 {
+		cs.ecss = []string{""}
+	}
+
+	for _, q := range queries {
+		if q.Weight > 0 && q.ExplainSQL != "" && isReadOnlyQuery(q) {
+			cs.queries = append(cs.queries, q)
+		}
+	}
+	if len(cs.queries) == 0 {
+		return nil, fmt.Errorf("cost_sweep: the workload has no read-only queries to sweep")
+	}
+	for _, p := range append([]costPoint{costReference}, cs.grid()...) {
+		cs.cells[p] = make(map[string]*costCell)
+		for _, q := range cs.queries {
+			cs.cells[p][q.Name] = &costCell{latency: &QueryMetrics{Name: q.Name}, plans: make(map[string]int)}
+		}
+	}
+	return cs, nil
+}
+
+// grid lists the swept points, random_page_cost varying fastest.
+func (cs *CostSweep) grid() []costPoint {
+	var points []costPoint
+	for _, ecs := range cs.ecss {
+		for _, rpc := range cs.rpcs {
+			points = append(points, costPoint{rpc: rpc, ecs: ecs})
+		}
+	}
+	return points
+}
+
+// values fills in the server's settings for the axes that aren't swept.
+func (cs *CostSweep) values(p costPoint) (rpc, ecs string) {
+	rpc, ecs = p.rpc, p.ecs
+	if rpc == "" {
+		rpc = cs.serverRPC
+	}
+	if ecs == "" {
+		ecs = cs.serverECS
+	}
+	return rpc, ecs
+}
+
+// costConnConfig is the churn config under the sweep's own
+// application_name.
+func costConnConfig() (*pgx.ConnConfig, error) {
+	connConfig, err := churnConnConfig()
+	if err != nil {
+		return nil, err
+	}
+	connConfig.RuntimeParams["application_name"] = "read_workload_simulator_costs"
+	return connConfig, nil
+}
+
+// runCostSweep reads the server's settings, warms the cache with one
+// unrecorded pass at them, then runs the rounds until they are done or the
+// run ends.
+func runCostSweep(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	cs := costSweep
+
+	connConfig, err := costConnConfig()
+	if err != nil {
+		log.Printf("Cost sweep: %v", err)
+		return
+	}
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Cost sweep: connect failed: %v", err)
+		}
+		return
+	}
+	defer conn.Close(context.Background())
+
+	var rpc, ecs string
+	if err := conn.QueryRow(ctx, `SELECT current_setting('random_page_cost'), current_setting('effective_cache_size')`).Scan(&rpc, &ecs); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Cost sweep: reading the server's settings: %v", err)
+		}
+		return
+	}
+	cs.mu.Lock()
+	cs.serverRPC, cs.serverECS = rpc, ecs
+	cs.mu.Unlock()
+
+	points := append([]costPoint{costReference}, cs.grid()...)
+	for round := 0; round <= config.CostRepeats; round++ {
+		for i, p := range points {
+			if round == 0 && i > 0 {
+				break // Warm-up, not recorded
+			}
+			rpc, ecs := cs.values(p)
+			if _, err := conn.Exec(ctx, `SELECT set_config('random_page_cost', $1, false), set_config('effective_cache_size', $2, false)`, rpc, ecs); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Cost sweep: SET random_page_cost = %s, effective_cache_size = %s: %v", rpc, ecs, err)
+				}
+				return
+			}
+			for _, q := range cs.queries {
+				if ctx.Err() != nil {
+					return
+				}
+				params := generateQueryParams(q)
+				planText, _, ok := capturePlan(ctx, conn, q.ExplainSQL, params)
+				d, err := runQuery(ctx, conn, q.SQL, params)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Printf("Cost sweep: %s at random_page_cost %s, effective_cache_size %s: %v", q.Name, rpc, ecs, err)
+				}
+				if round > 0 {
+					cs.record(p, q.Name, planText, ok, d, err)
+				}
+			}
+		}
+		if round > 0 {
+			cs.mu.Lock()
+			cs.rounds = round
+			cs.mu.Unlock()
+			fmt.Printf("\n🧭 Cost sweep: round %d/%d done\n", round, config.CostRepeats)
+		}
+	}
+}
+
+func (cs *CostSweep) record(p costPoint, queryName, planText string, planned bool, d time.Duration, err error) {
+	c := cs.cells[p][queryName]
+	recordLatency(c.latency, d, err)
+	if !planned {
+		return
+	}
+	h := hashPlanStructure(planText)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c.plans[h]++
+	if _, ok := cs.outlines[h]; !ok {
+		cs.outlines[h] = planOutline(planText)
+	}
+}
+
+// planOutline names a plan's nodes top-down on one line.
+func planOutline(planText string) string {
+	var nodes []string
+	for _, line := range planhash.Structure(planText) {
+		if strings.HasPrefix(line, "Sort Key") || strings.HasPrefix(line, "Join Filter") {
+			continue
+		}
+		nodes = append(nodes, strings.TrimSpace(strings.TrimPrefix(line, "->")))
+	}
+	return strings.Join(nodes, " > ")
+}
+
+// CostQueryCell is one query at one point.
+type CostQueryCell struct {
+	Query   string  `json:"query"`
+	Plan    string  `json:"plan"`    // Chosen most often
+	Plans   int     `json:"plans"`   // Distinct plans over the repeats
+	Flipped bool    `json:"flipped"` // Differs from the plan at the server's settings
+	P50Ms   float64 `json:"p50_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	Errors  int64   `json:"errors,omitempty"`
+}
+
+// CostPointStats is the workload at one point.
+type CostPointStats struct {
+	RandomPageCost     string          `json:"random_page_cost"`
+	EffectiveCacheSize string          `json:"effective_cache_size"`
+	Reference          bool            `json:"reference,omitempty"` // The server's settings
+	TotalP50Ms         float64         `json:"total_p50_ms"`        // Sum of the per-query medians
+	DeltaPct           float64         `json:"delta_pct"`           // Against the reference
+	Flipped            int             `json:"flipped"`             // Queries on another plan than the reference
+	Unstable           int             `json:"unstable"`            // Queries with more than one plan over the repeats
+	Stable             bool            `json:"stable"`              // No unstable query, same plans as the neighbours
+	Complete           bool            `json:"complete"`            // Every query has a successful run
+	Queries            []CostQueryCell `json:"queries"`
+}
+
+// CostFlip is a plan change between neighbouring values of one setting.
+type CostFlip struct {
+	Query    string  `json:"query"`
+	Setting  string  `json:"setting"` // random_page_cost or effective_cache_size
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	At       string  `json:"at"` // Value of the other setting
+	FromPlan string  `json:"from_plan"`
+	ToPlan   string  `json:"to_plan"`
+	FromP50  float64 `json:"from_p50_ms"`
+	ToP50    float64 `json:"to_p50_ms"`
+}
+
+type CostSweepReport struct {
+	Rounds      int               `json:"rounds"`
+	ServerRPC   string            `json:"server_random_page_cost"`
+	ServerECS   string            `json:"server_effective_cache_size"`
+	Points      []CostPointStats  `json:"points"` // Reference first, then the grid
+	Flips       []CostFlip        `json:"flips,omitempty"`
+	Recommended *CostPointStats   `json:"recommended,omitempty"`
+	Plans       map[string]string `json:"plans"` // Plan hash -> node outline
+}
+
+func (cs *CostSweep) Report() *CostSweepReport {
+	cs.mu.Lock()
+	r := &CostSweepReport{Rounds: cs.rounds, ServerRPC: cs.serverRPC, ServerECS: cs.serverECS, Plans: make(map[string]string)}
+	plans := make(map[costPoint]map[string]CostQueryCell)
+	for p, cells := range cs.cells {
+		plans[p] = make(map[string]CostQueryCell)
+		for name, c := range cells {
+			plans[p][name] = CostQueryCell{Query: name, Plan: c.dominant(), Plans: len(c.plans)}
+		}
+	}
+	for h, o := range cs.outlines {
+		r.Plans[h] = o
+	}
+	cs.mu.Unlock()
+
+	stats := make(map[costPoint]*CostPointStats)
+	points := append([]costPoint{costReference}, cs.grid()...)
+	for i, p := range points {
+		rpc, ecs := cs.values(p)
+		s := &CostPointStats{RandomPageCost: rpc, EffectiveCacheSize: ecs, Reference: i == 0, Complete: true, Stable: true}
+		for _, q := range cs.queries {
+			cell := plans[p][q.Name]
+			qs := cs.cells[p][q.Name].latency.Summary()
+			cell.Errors = qs.Errors
+			if qs.Count > qs.Errors {
+				cell.P50Ms, cell.P95Ms = durationMs(qs.P50), durationMs(qs.P95)
+				s.TotalP50Ms += cell.P50Ms
+			} else {
+				s.Complete = false
+			}
+			if ref := plans[costReference][q.Name].Plan; ref != "" && cell.Plan != "" && cell.Plan != ref {
+				cell.Flipped = true
+				s.Flipped++
+			}
+			if cell.Plans > 1 {
+				s.Unstable++
+				s.Stable = false
+			}
+			plans[p][q.Name] = cell
+			s.Queries = append(s.Queries, cell)
+		}
+		stats[p] = s
+	}
+	ref := stats[costReference]
+	for _, p := range points[1:] {
+		if ref.Complete && stats[p].Complete {
+			stats[p].DeltaPct = pctDelta(ref.TotalP50Ms, stats[p].TotalP50Ms)
+		}
+	}
+
+	// Flips between neighbours on each axis; both ends lose stability.
+	flip := func(a, b costPoint, setting, from, to, at string) {
+		for _, q := range cs.queries {
+			ca, cb := plans[a][q.Name], plans[b][q.Name]
+			if ca.Plan == "" || cb.Plan == "" || ca.Plan == cb.Plan {
+				continue
+			}
+			r.Flips = append(r.Flips, CostFlip{
+				Query: q.Name, Setting: setting, From: from, To: to, At: at,
+				FromPlan: ca.Plan, ToPlan: cb.Plan, FromP50: ca.P50Ms, ToP50: cb.P50Ms,
+			})
+			stats[a].Stable, stats[b].Stable = false, false
+		}
+	}
+	for _, ecs := range cs.ecss {
+		for i := 1; i < len(cs.rpcs); i++ {
+			a, b := costPoint{cs.rpcs[i-1], ecs}, costPoint{cs.rpcs[i], ecs}
+			_, at := cs.values(a)
+			flip(a, b, "random_page_cost", cs.rpcs[i-1], cs.rpcs[i], at)
+		}
+	}
+	for _, rpc := range cs.rpcs {
+		for i := 1; i < len(cs.ecss); i++ {
+			a, b := costPoint{rpc, cs.ecss[i-1]}, costPoint{rpc, cs.ecss[i]}
+			at, _ := cs.values(a)
+			flip(a, b, "effective_cache_size", cs.ecss[i-1], cs.ecss[i], at)
+		}
+	}
+
+	for _, p := range points {
+		r.Points = append(r.Points, *stats[p])
+	}
+	for i := 1; i < len(r.Points); i++ {
+		s := &r.Points[i]
+		if !s.Stable || !s.Complete || r.Rounds == 0 {
+			continue
+		}
+		if r.Recommended == nil || s.TotalP50Ms < r.Recommended.TotalP50Ms {
+			r.Recommended = s
+		}
+	}
+	return r
+}
+
+func (cs *CostSweep) PrintReport() {
+	r := cs.Report()
+
+	fmt.Printf("\n🧭 Planner Cost Sweep (%d queries, %d of %d rounds; server random_page_cost %s, effective_cache_size %s):\n",
+		len(cs.queries), r.Rounds, config.CostRepeats, r.ServerRPC, r.ServerECS)
+	if r.Rounds == 0 {
+		fmt.Println("   No complete round; lengthen the run or sweep fewer values")
+		return
+	}
+
+	fmt.Printf("   %-16s %-20s %12s %9s %8s %9s\n", "random_page_cost", "effective_cache_size", "Total p50", "Δ", "Flipped", "Unstable")
+	for _, s := range r.Points {
+		marker := "  "
+		switch {
+		case s.Reference:
+			marker = "📍"
+		case r.Recommended != nil && s.RandomPageCost == r.Recommended.RandomPageCost &&
+			s.EffectiveCacheSize == r.Recommended.EffectiveCacheSize:
+			marker = "👉"
+		case !s.Stable:
+			marker = "〰"
+		}
+		total := "-"
+		if s.Complete {
+			total = fmt.Sprintf("%.2fms", s.TotalP50Ms)
+		}
+		fmt.Printf("   %s%-14s %-20s %12s %+8.1f%% %8d %9d\n",
+			marker, s.RandomPageCost, s.EffectiveCacheSize, total, s.DeltaPct, s.Flipped, s.Unstable)
+	}
+	fmt.Println("   📍 server settings   👉 recommended   〰 plans flip at or next to this point")
+
+	if len(r.Flips) > 0 {
+		fmt.Printf("\n   Plan flips:\n")
+		for _, f := range r.Flips {
+			other := "effective_cache_size"
+			if f.Setting == "effective_cache_size" {
+				other = "random_page_cost"
+			}
+			fmt.Printf("   🔀 %-24s %s %s → %s (%s %s): p50 %.2fms → %.2fms\n",
+				f.Query, f.Setting, f.From, f.To, other, f.At, f.FromP50, f.ToP50)
+			fmt.Printf("      %s  %s\n", shortHash(f.FromPlan), r.Plans[f.FromPlan])
+			fmt.Printf("      %s  %s\n", shortHash(f.ToPlan), r.Plans[f.ToPlan])
+		}
+	} else {
+		fmt.Println("\n   ✅ No plan flips anywhere in the grid")
+	}
+
+	if r.Recommended == nil {
+		fmt.Println("\n   ⚠️  No stable point: every point has a query with more than one plan or a neighbour on another plan; widen the grid")
+		return
+	}
+	rec := r.Recommended
+	fmt.Printf("\n   👉 Recommended: random_page_cost = %s, effective_cache_size = %s (fastest stable point, %+.1f%% vs the server's settings",
+		rec.RandomPageCost, rec.EffectiveCacheSize, rec.DeltaPct)
+	if rec.Flipped > 0 {
+		fmt.Printf(", %d plan(s) differ from today's", rec.Flipped)
+	}
+	fmt.Println(")")
+	for _, q := range rec.Queries {
+		if q.Flipped {
+			fmt.Printf("      %-24s %s  %s\n", q.Query, shortHash(q.Plan), r.Plans[q.Plan])
+		}
+	}
+}
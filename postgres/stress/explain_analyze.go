@@ -0,0 +1,126 @@
+package main
+
+// ============================================================================
+// EXPLAIN ANALYZE SAMPLING (plan_check.explain_analyze / -explain-analyze)
+// ============================================================================
+//
+// Plain EXPLAIN (used by the plan monitor) only shows what the planner
+// intends. Runtime behaviour - sorts spilling to disk, hash batching,
+// parallel workers that never launched - is only visible in EXPLAIN ANALYZE.
+// On every plan-check tick we run each read-only query once with
+// EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) and hand the parsed plan to the
+// collectors that care about it.
+//
+// Write queries (profiles with UPDATE/INSERT) are skipped: EXPLAIN ANALYZE
+// executes the statement.
+//
+// Collectors: spillTracker (spill.go), parallelTracker (parallel.go).
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PlanNode is one node of an EXPLAIN (FORMAT JSON) plan tree. Only the keys
+// we look at are decoded.
+type PlanNode struct {
+	NodeType          string     `json:"Node Type"`
+	Strategy          string     `json:"Strategy"`
+	SortMethod        string     `json:"Sort Method"`
+	SortSpaceUsedKB   int64      `json:"Sort Space Used"`
+	SortSpaceType     string     `json:"Sort Space Type"`
+	HashBatches       int64      `json:"Hash Batches"`
+	PeakMemoryKB      int64      `json:"Peak Memory Usage"`
+	HashAggBatches    int64      `json:"HashAgg Batches"`
+	DiskUsageKB       int64      `json:"Disk Usage"`
+	StorageType       string     `json:"Storage"`
+	MaxStorageKB      int64      `json:"Maximum Storage"`
+	TempWrittenBlocks int64      `json:"Temp Written Blocks"`
+	WorkersPlanned    int64      `json:"Workers Planned"`
+	WorkersLaunched   int64      `json:"Workers Launched"`
+	SharedHitBlocks   int64      `json:"Shared Hit Blocks"`
+	SharedReadBlocks  int64      `json:"Shared Read Blocks"`
+	PlanRows          float64    `json:"Plan Rows"`
+	ActualRows        float64    `json:"Actual Rows"` // Per loop
+	ActualLoops       float64    `json:"Actual Loops"`
+	Plans             []PlanNode `json:"Plans"`
+}
+
+type ExplainResult struct {
+	Plan          PlanNode `json:"Plan"`
+	ExecutionTime float64  `json:"Execution Time"`
+}
+
+// walk visits every node in the tree, depth first.
+func (n *PlanNode) walk(fn func(*PlanNode)) {
+	fn(n)
+	for i := range n.Plans {
+		n.Plans[i].walk(fn)
+	}
+}
+
+func isReadOnlyQuery(q Query) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(q.SQL)), "SELECT")
+}
+
+func explainAnalyze(ctx context.Context, pool *pgxpool.Pool, query Query) (*ExplainResult, error) {
+	var raw string
+	err := pool.QueryRow(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+query.SQL,
+		generateQueryParams(query)...).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	return parseExplainJSON(raw)
+}
+
+// explainAnalyzeNoTiming runs sql once under EXPLAIN ANALYZE without
+// per-node timing, which is most of EXPLAIN ANALYZE's overhead; execution
+// time, row counts and buffers are still there.
+func explainAnalyzeNoTiming(ctx context.Context, conn *pgx.Conn, sql string, params []interface{}) (*ExplainResult, error) {
+	var raw string
+	err := conn.QueryRow(ctx, "EXPLAIN (ANALYZE, TIMING OFF, BUFFERS, FORMAT JSON) "+sql, params...).Scan(&raw)
+	if err != nil {
+		return nil, err
+	}
+	result, err := parseExplainJSON(raw)
+	if err == nil && result == nil {
+		err = fmt.Errorf("EXPLAIN returned no plan")
+	}
+	return result, err
+}
+
+// parseExplainJSON decodes EXPLAIN (FORMAT JSON) output; nil if it has no
+// plan.
+func parseExplainJSON(raw string) (*ExplainResult, error) {
+	var results []ExplainResult
+	if err := json.Unmarshal([]byte(raw), &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return &results[0], nil
+}
+
+// sampleExecutionStats runs one EXPLAIN ANALYZE per read-only query and feeds
+// the result to the runtime collectors.
+func sampleExecutionStats(ctx context.Context, pool *pgxpool.Pool) {
+	for _, query := range queries {
+		if query.Weight == 0 || !isReadOnlyQuery(query) {
+			continue
+		}
+
+		result, err := explainAnalyze(ctx, pool, query)
+		if err != nil || result == nil {
+			continue
+		}
+
+		spillTracker.Record(query.Name, result)
+		parallelTracker.Record(query.Name, result)
+	}
+}
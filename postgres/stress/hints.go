@@ -0,0 +1,198 @@
+package main
+
+// ============================================================================
+// PG_HINT_PLAN EXPERIMENT MODE (-hints)
+// ============================================================================
+//
+// Queries can carry a pg_hint_plan hint. With -hints enabled, each execution
+// of a hinted query runs the pinned variant with probability hint_ratio and
+// the optimizer's own choice otherwise, so both plans see the same load in
+// the same run. Hinted executions are recorded as "<query>[hinted]" and the
+// report compares the two latency distributions side by side.
+//
+// pg_hint_plan must be installed; we LOAD it in every session (works when
+// the library is in $libdir/plugins or already in shared_preload_libraries).
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// defaultHints pin the plans we usually argue about for the built-in
+// financial_transactions queries. Override per query in the config file.
+var defaultHints = map[string]string{
+	"customer_recent":      "IndexScan(financial_transactions idx_txn_customer)",
+	"high_value_recent":    "IndexScan(financial_transactions idx_txn_amount)",
+	"daily_volume":         "Parallel(financial_transactions 4 hard)",
+	"regional_performance": "Set(max_parallel_workers_per_gather 0)",
+}
+
+const hintedSuffix = "[hinted]"
+
+func hintedName(queryName string) string {
+	return queryName + hintedSuffix
+}
+
+// applyQueryHints attaches default and configured hints to the active query
+// set. Profile queries only get hints from the config file.
+func applyQueryHints() error {
+	for i := range queries {
+		if hint, ok := defaultHints[queries[i].Name]; ok && queries[i].Hint == "" {
+			queries[i].Hint = hint
+		}
+	}
+	for name, hint := range config.QueryHints {
+		found := false
+		for i := range queries {
+			if queries[i].Name == name {
+				queries[i].Hint = hint
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("hint defined for unknown query %q", name)
+		}
+	}
+	return nil
+}
+
+// hintComment renders a hint as the leading comment pg_hint_plan parses.
+func hintComment(hint string) string {
+	return "/*+ " + strings.TrimSpace(hint) + " */ "
+}
+
+// pickVariant decides whether this execution uses the pinned plan and
+// returns the SQL to run and the metrics bucket to record it under.
+func pickVariant(query Query) (sql, metricName string) {
+	if !config.HintsEnabled || query.Hint == "" || rand.Float64() >= config.HintRatio {
+		return query.SQL, query.Name
+	}
+	return hintComment(query.Hint) + query.SQL, hintedName(query.Name)
+}
+
+// loadHintPlan is run on every new session when hints are enabled.
+func loadHintPlan(ctx context.Context, conn *pgx.Conn) error {
+	if config.HintsEnabled {
+		// A failure here is fine: the library may already be preloaded.
+		// checkHintPlan reports whether hints are actually active.
+		_, _ = conn.Exec(ctx, "LOAD 'pg_hint_plan'")
+	}
+	return nil
+}
+
+// checkHintPlan verifies hints will actually be honoured; otherwise the A/B
+// comparison silently measures the same plan twice.
+func checkHintPlan(ctx context.Context, pool *pgxpool.Pool) error {
+	var enabled *string
+	err := pool.QueryRow(ctx, `SELECT current_setting('pg_hint_plan.enable_hint', true)`).Scan(&enabled)
+	if err != nil {
+		return err
+	}
+	if enabled == nil || *enabled != "on" {
+		return fmt.Errorf("pg_hint_plan is not active in this session (install it or add it to shared_preload_libraries)")
+	}
+	return nil
+}
+
+func hintedQueryCount() int {
+	n := 0
+	for _, q := range queries {
+		if q.Hint != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// HintComparison is the A/B result for one query.
+type HintComparison struct {
+	Query        string  `json:"query"`
+	Hint         string  `json:"hint"`
+	BaselineRuns int64   `json:"baseline_runs"`
+	HintedRuns   int64   `json:"hinted_runs"`
+	BaselineP50  float64 `json:"baseline_p50_ms"`
+	HintedP50    float64 `json:"hinted_p50_ms"`
+	BaselineP95  float64 `json:"baseline_p95_ms"`
+	HintedP95    float64 `json:"hinted_p95_ms"`
+	BaselineP99  float64 `json:"baseline_p99_ms"`
+	HintedP99    float64 `json:"hinted_p99_ms"`
+	P95DeltaPct  float64 `json:"p95_delta_pct"` // Negative = hint is faster
+}
+
+func (m *Metrics) CompareHints() []HintComparison {
+	var results []HintComparison
+
+	for _, q := range queries {
+		if q.Hint == "" {
+			continue
+		}
+		base, okBase := m.queryMetrics[q.Name]
+		hinted, okHinted := m.queryMetrics[hintedName(q.Name)]
+		if !okBase || !okHinted {
+			continue
+		}
+		b, h := base.Summary(), hinted.Summary()
+		if b.Count == 0 || h.Count == 0 {
+			continue
+		}
+
+		c := HintComparison{
+			Query:        q.Name,
+			Hint:         q.Hint,
+			BaselineRuns: b.Count,
+			HintedRuns:   h.Count,
+			BaselineP50:  durationMs(b.P50),
+			HintedP50:    durationMs(h.P50),
+			BaselineP95:  durationMs(b.P95),
+			HintedP95:    durationMs(h.P95),
+			BaselineP99:  durationMs(b.P99),
+			HintedP99:    durationMs(h.P99),
+		}
+		if c.BaselineP95 > 0 {
+			c.P95DeltaPct = (c.HintedP95 - c.BaselineP95) / c.BaselineP95 * 100
+		}
+		results = append(results, c)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Query < results[j].Query })
+	return results
+}
+
+func (m *Metrics) PrintHintComparison() {
+	results := m.CompareHints()
+
+	fmt.Printf("\n📌 pg_hint_plan A/B (%.0f%% of executions pinned):\n", config.HintRatio*100)
+	if len(results) == 0 {
+		fmt.Println("   Not enough executions of both variants to compare")
+		return
+	}
+
+	fmt.Printf("   %-24s %8s %8s %10s %10s %10s %10s %9s\n",
+		"Query", "Base N", "Hint N", "Base p50", "Hint p50", "Base p95", "Hint p95", "p95 Δ")
+	for _, c := range results {
+		verdict := "≈"
+		switch {
+		case c.P95DeltaPct <= -10:
+			verdict = "📉 hint faster"
+		case c.P95DeltaPct >= 10:
+			verdict = "📈 hint slower"
+		}
+		fmt.Printf("   %-24s %8d %8d %9.2fms %9.2fms %9.2fms %9.2fms %+8.1f%% %s\n",
+			c.Query, c.BaselineRuns, c.HintedRuns, c.BaselineP50, c.HintedP50,
+			c.BaselineP95, c.HintedP95, c.P95DeltaPct, verdict)
+		fmt.Printf("      hint: %s\n", c.Hint)
+	}
+}
+
+func captureHintedPlan(ctx context.Context, pool *pgxpool.Pool, query Query) {
+	planText, cost, ok := capturePlan(ctx, pool, hintComment(query.Hint)+query.ExplainSQL, generateQueryParams(query))
+	if ok {
+		planMonitor.RecordPlan(hintedName(query.Name), query.SQL, planText, cost)
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+// ============================================================================
+// INDEX CREATION IMPACT BENCHMARK (-index "CREATE INDEX ...")
+// ============================================================================
+//
+// Answers the two questions asked before every index goes to production:
+// what does the build cost the running workload, and what does the index buy
+// once it exists. The proposed index is built with CREATE INDEX CONCURRENTLY
+// while the simulator keeps running, after index.after of baseline load:
+//   - before: workload latency with the current set of indexes
+//   - during: latency while the build scans and sorts the table
+//   - after:  latency with the new index in place
+//
+// Queries are EXPLAINed before and after the build; the ones whose plan
+// mentions the new index are the ones expected to use it, and the report
+// compares their before/after latency. The build's phases are sampled from
+// pg_stat_progress_create_index. Long analytics queries hold snapshots, so
+// expect time in "waiting for old snapshots" under the mixed workload.
+//
+// The index is dropped (CONCURRENTLY) at the end of the run unless
+// index.keep is set; an invalid index left by a failed build is always
+// dropped.
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	indexPhaseBefore int32 = iota
+	indexPhaseDuring
+	indexPhaseAfter
+)
+
+var lastIdentRe = regexp.MustCompile(`(?:"([^"]+)"|([\w$]+))$`)
+
+var indexWindowNames = []string{"before", "during", "after"}
+
+var createIndexRe = regexp.MustCompile(`(?is)^\s*CREATE\s+(UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?(IF\s+NOT\s+EXISTS\s+)?((?:"[^"]+"|[\w$]+)(?:\.(?:"[^"]+"|[\w$]+))?)\s+ON\s`)
+
+// IndexBuildPhase is one phase transition seen in pg_stat_progress_create_index.
+type IndexBuildPhase struct {
+	Phase      string  `json:"phase"`
+	StartedSec float64 `json:"started_sec"` // Offset from the start of the build
+}
+
+type IndexImpact struct {
+	ddl       string // Rewritten to CONCURRENTLY
+	name      string // As written, for DROP INDEX
+	planName  string // Unqualified and unquoted, as it appears in EXPLAIN
+	planRe    *regexp.Regexp
+	phase     int32
+	windows   [3]map[string]*QueryMetrics
+	overall   [3]*QueryMetrics
+	boundary  [4]time.Time // before start, build start, build end, run end
+	phases    []IndexBuildPhase
+	usesIndex map[string]bool
+	planned   map[string]bool // Queries that had a plan captured after the build
+	buildErr  error
+	valid     bool
+	dropped   bool
+	mu        sync.Mutex
+}
+
+var indexImpact *IndexImpact
+
+// newIndexImpact validates the proposed DDL and makes sure it is built
+// CONCURRENTLY; a plain CREATE INDEX would block every write for the whole
+// build and measure something nobody runs in production.
+func newIndexImpact(ddl string) (*IndexImpact, error) {
+	ddl = strings.TrimRight(strings.TrimSpace(ddl), ";")
+	m := createIndexRe.FindStringSubmatchIndex(ddl)
+	if m == nil {
+		return nil, fmt.Errorf("index: expected CREATE [UNIQUE] INDEX <name> ON ... (the index must be named so it can be found and dropped)")
+	}
+	if m[6] >= 0 {
+		return nil, fmt.Errorf("index: IF NOT EXISTS would hide an existing index; drop it or remove the clause")
+	}
+	name := ddl[m[8]:m[9]]
+	if m[4] < 0 {
+		ddl = ddl[:m[8]] + "CONCURRENTLY " + ddl[m[8]:]
+	}
+
+	// EXPLAIN prints the bare relation name: no schema, no quotes.
+	planName := ""
+	if lm := lastIdentRe.FindStringSubmatch(name); lm[1] != "" {
+		planName = lm[1]
+	} else {
+		planName = strings.ToLower(lm[2])
+	}
+
+	ii := &IndexImpact{
+		ddl:       ddl,
+		name:      name,
+		planName:  planName,
+		planRe:    regexp.MustCompile(`(^|[\s"])` + regexp.QuoteMeta(planName) + `($|[\s"])`),
+		usesIndex: make(map[string]bool),
+		planned:   make(map[string]bool),
+	}
+	for i := range ii.windows {
+		ii.windows[i] = make(map[string]*QueryMetrics)
+		ii.overall[i] = &QueryMetrics{Name: indexWindowNames[i]}
+	}
+	ii.boundary[0] = time.Now()
+	return ii, nil
+}
+
+// checkIndexAbsent refuses to run against an index that already exists:
+// there would be no "before" to compare with, and we would drop it.
+func (ii *IndexImpact) checkIndexAbsent(ctx context.Context, pool *pgxpool.Pool) error {
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, ii.name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("index %s already exists; drop it first so the run has a baseline", ii.name)
+	}
+	return nil
+}
+
+// Record files one execution under the current window. Called from
+// Metrics.RecordQuery for every query the workers run.
+func (ii *IndexImpact) Record(queryName string, duration time.Duration, err error) {
+	w := atomic.LoadInt32(&ii.phase)
+
+	ii.mu.Lock()
+	qm, ok := ii.windows[w][queryName]
+	if !ok {
+		qm = &QueryMetrics{Name: queryName}
+		ii.windows[w][queryName] = qm
+	}
+	ii.mu.Unlock()
+
+	for _, m := range []*QueryMetrics{qm, ii.overall[w]} {
+		m.mu.Lock()
+		m.ExecutionCount++
+		m.TotalDuration += duration
+		m.Latencies = append(m.Latencies, duration)
+		if err != nil {
+			m.ErrorCount++
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (ii *IndexImpact) setPhase(phase int32) {
+	ii.mu.Lock()
+	ii.boundary[phase] = time.Now()
+	ii.mu.Unlock()
+	atomic.StoreInt32(&ii.phase, phase)
+}
+
+// runIndexBuild waits out the baseline window, then builds the index on a
+// dedicated connection while the workers keep running.
+func runIndexBuild(ctx context.Context, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ii := indexImpact
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(config.IndexAfter):
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		ii.buildErr = fmt.Errorf("acquire build connection: %w", err)
+		return
+	}
+	defer conn.Release()
+	pid := conn.Conn().PgConn().PID()
+
+	fmt.Printf("\n🏗️  Building index %s (baseline window: %v)\n   %s\n", ii.name, config.IndexAfter, oneLineSQL(ii.ddl))
+	ii.setPhase(indexPhaseDuring)
+	start := time.Now()
+
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		ii.trackProgress(progressCtx, pool, pid, start)
+	}()
+
+	_, err = conn.Exec(ctx, ii.ddl)
+	stopProgress()
+	<-progressDone
+	ii.setPhase(indexPhaseAfter)
+	buildTime := time.Since(start)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("build did not finish before the run ended: %w", err)
+		}
+		ii.buildErr = err
+		fmt.Printf("   ❌ Index build failed after %v: %v\n", buildTime.Round(time.Millisecond), err)
+		return
+	}
+
+	var valid bool
+	err = pool.QueryRow(ctx, `SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`, ii.name).Scan(&valid)
+	ii.valid = err == nil && valid
+	fmt.Printf("   ✅ Index %s built in %v (valid: %v)\n", ii.name, buildTime.Round(time.Millisecond), ii.valid)
+
+	ii.capturePlans(ctx, pool)
+}
+
+// trackProgress samples pg_stat_progress_create_index for the build's
+// backend and records each phase transition.
+func (ii *IndexImpact) trackProgress(ctx context.Context, pool *pgxpool.Pool, pid uint32, start time.Time) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var phase string
+			var blocksDone, blocksTotal int64
+			err := pool.QueryRow(ctx, `
+				SELECT phase, blocks_done, blocks_total
+				FROM pg_stat_progress_create_index
+				WHERE pid = $1`, int32(pid)).Scan(&phase, &blocksDone, &blocksTotal)
+			if err != nil || phase == last {
+				continue
+			}
+			last = phase
+			offset := time.Since(start)
+
+			ii.mu.Lock()
+			ii.phases = append(ii.phases, IndexBuildPhase{Phase: phase, StartedSec: offset.Seconds()})
+			ii.mu.Unlock()
+
+			progress := ""
+			if blocksTotal > 0 {
+				progress = fmt.Sprintf(" (%.0f%% of blocks)", float64(blocksDone)/float64(blocksTotal)*100)
+			}
+			fmt.Printf("   [+%v] %s%s\n", offset.Round(time.Second), phase, progress)
+		}
+	}
+}
+
+// capturePlans EXPLAINs every query once the index exists and notes which
+// plans reference it.
+func (ii *IndexImpact) capturePlans(ctx context.Context, pool *pgxpool.Pool) {
+	for _, q := range queries {
+		if q.ExplainSQL == "" {
+			continue
+		}
+		planText, _, ok := capturePlan(ctx, pool, q.ExplainSQL, generateQueryParams(q))
+		if !ok {
+			continue
+		}
+		uses := ii.planRe.MatchString(planText)
+		ii.mu.Lock()
+		ii.planned[q.Name] = true
+		ii.usesIndex[q.Name] = uses
+		ii.mu.Unlock()
+		if uses {
+			fmt.Printf("   🔎 %s now uses %s\n", q.Name, ii.planName)
+		}
+	}
+}
+
+// finish closes the last window and drops the index unless it should be
+// kept. Runs after the workers have stopped, on the parent context.
+func (ii *IndexImpact) finish(ctx context.Context, pool *pgxpool.Pool) {
+	ii.mu.Lock()
+	ii.boundary[3] = time.Now()
+	ii.mu.Unlock()
+
+	if config.IndexKeep && ii.valid {
+		fmt.Printf("\n🏗️  Keeping index %s (index.keep)\n", ii.name)
+		return
+	}
+	var exists bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, ii.name).Scan(&exists); err != nil || !exists {
+		return
+	}
+	if _, err := pool.Exec(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+ii.name); err != nil {
+		fmt.Printf("\n⚠️  Failed to drop index %s: %v\n", ii.name, err)
+		return
+	}
+	ii.dropped = true
+	fmt.Printf("\n🏗️  Dropped index %s\n", ii.name)
+}
+
+// oneLineSQL collapses whitespace for console output.
+func oneLineSQL(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
+
+// IndexWindowStats is the whole workload's latency in one window.
+type IndexWindowStats struct {
+	Window      string  `json:"window"`
+	DurationSec float64 `json:"duration_sec"`
+	Count       int64   `json:"count"`
+	Errors      int64   `json:"errors"`
+	QPS         float64 `json:"qps"`
+	P50Ms       float64 `json:"p50_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+}
+
+// IndexQueryImpact compares one query across the three windows.
+type IndexQueryImpact struct {
+	Query          string  `json:"query"`
+	UsesIndex      bool    `json:"uses_index"`
+	BeforeP95      float64 `json:"before_p95_ms"`
+	DuringP95      float64 `json:"during_p95_ms"`
+	AfterP95       float64 `json:"after_p95_ms"`
+	BeforeP50      float64 `json:"before_p50_ms"`
+	AfterP50       float64 `json:"after_p50_ms"`
+	DuringDeltaPct float64 `json:"during_p95_delta_pct"` // Build impact; positive = slower during the build
+	AfterDeltaPct  float64 `json:"after_p95_delta_pct"`  // Index benefit; negative = faster with the index
+}
+
+type IndexImpactReport struct {
+	Index      string             `json:"index"`
+	DDL        string             `json:"ddl"`
+	BuildMs    float64            `json:"build_ms,omitempty"`
+	Valid      bool               `json:"valid"`
+	Error      string             `json:"error,omitempty"`
+	Kept       bool               `json:"kept"`
+	Phases     []IndexBuildPhase  `json:"build_phases,omitempty"`
+	Windows    []IndexWindowStats `json:"windows"`
+	Queries    []IndexQueryImpact `json:"queries"`
+	UsedBy     []string           `json:"used_by"`
+	NotPlanned []string           `json:"not_planned,omitempty"` // No plan captured after the build
+}
+
+func pctDelta(base, v float64) float64 {
+	if base <= 0 {
+		return 0
+	}
+	return (v - base) / base * 100
+}
+
+func (ii *IndexImpact) Report() *IndexImpactReport {
+	ii.mu.Lock()
+	defer ii.mu.Unlock()
+
+	r := &IndexImpactReport{
+		Index:  ii.name,
+		DDL:    ii.ddl,
+		Valid:  ii.valid,
+		Kept:   ii.valid && !ii.dropped,
+		Phases: append([]IndexBuildPhase(nil), ii.phases...),
+		UsedBy: []string{},
+	}
+	if ii.buildErr != nil {
+		r.Error = ii.buildErr.Error()
+	}
+	if !ii.boundary[1].IsZero() && !ii.boundary[2].IsZero() {
+		r.BuildMs = durationMs(ii.boundary[2].Sub(ii.boundary[1]))
+	}
+
+	end := time.Now()
+	if !ii.boundary[3].IsZero() {
+		end = ii.boundary[3]
+	}
+	for w := range ii.overall {
+		from, to := ii.boundary[w], ii.boundary[w+1]
+		if from.IsZero() {
+			continue
+		}
+		if to.IsZero() {
+			to = end
+		}
+		s := ii.overall[w].Summary()
+		elapsed := to.Sub(from)
+		ws := IndexWindowStats{
+			Window:      indexWindowNames[w],
+			DurationSec: elapsed.Seconds(),
+			Count:       s.Count,
+			Errors:      s.Errors,
+			P50Ms:       durationMs(s.P50),
+			P95Ms:       durationMs(s.P95),
+			P99Ms:       durationMs(s.P99),
+		}
+		if elapsed > 0 {
+			ws.QPS = float64(s.Count) / elapsed.Seconds()
+		}
+		r.Windows = append(r.Windows, ws)
+	}
+
+	names := make(map[string]bool)
+	for _, win := range ii.windows {
+		for name := range win {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		var s [3]LatencySummary
+		for w, win := range ii.windows {
+			if qm, ok := win[name]; ok {
+				s[w] = qm.Summary()
+			}
+		}
+		base := strings.TrimSuffix(name, hintedSuffix)
+		qi := IndexQueryImpact{
+			Query:     name,
+			UsesIndex: ii.usesIndex[base],
+			BeforeP50: durationMs(s[0].P50),
+			BeforeP95: durationMs(s[0].P95),
+			DuringP95: durationMs(s[1].P95),
+			AfterP50:  durationMs(s[2].P50),
+			AfterP95:  durationMs(s[2].P95),
+		}
+		if s[1].Count > 0 {
+			qi.DuringDeltaPct = pctDelta(qi.BeforeP95, qi.DuringP95)
+		}
+		if s[2].Count > 0 {
+			qi.AfterDeltaPct = pctDelta(qi.BeforeP95, qi.AfterP95)
+		}
+		r.Queries = append(r.Queries, qi)
+	}
+	sort.Slice(r.Queries, func(i, j int) bool {
+		if r.Queries[i].UsesIndex != r.Queries[j].UsesIndex {
+			return r.Queries[i].UsesIndex
+		}
+		return r.Queries[i].Query < r.Queries[j].Query
+	})
+
+	for _, q := range queries {
+		if ii.usesIndex[q.Name] {
+			r.UsedBy = append(r.UsedBy, q.Name)
+		} else if q.ExplainSQL != "" && !ii.planned[q.Name] && ii.valid {
+			r.NotPlanned = append(r.NotPlanned, q.Name)
+		}
+	}
+	return r
+}
+
+func (ii *IndexImpact) PrintReport() {
+	r := ii.Report()
+
+	fmt.Printf("\n🏗️  Index Creation Impact (%s):\n", r.Index)
+	fmt.Printf("   %s\n", oneLineSQL(r.DDL))
+	switch {
+	case r.Error != "":
+		fmt.Printf("   ❌ Build failed: %s\n", r.Error)
+	case len(r.Windows) < 2:
+		fmt.Println("   Build did not start before the run ended (index.after too long?)")
+		return
+	default:
+		fmt.Printf("   Build time:   %v (valid: %v, kept: %v)\n",
+			time.Duration(r.BuildMs*float64(time.Millisecond)).Round(time.Millisecond), r.Valid, r.Kept)
+	}
+	for _, p := range r.Phases {
+		fmt.Printf("      +%6.1fs  %s\n", p.StartedSec, p.Phase)
+	}
+
+	fmt.Printf("\n   %-8s %9s %10s %10s %10s %10s %10s\n", "Window", "Length", "Queries", "QPS", "p50", "p95", "p99")
+	for _, w := range r.Windows {
+		fmt.Printf("   %-8s %8.0fs %10d %10.1f %8.2fms %8.2fms %8.2fms\n",
+			w.Window, w.DurationSec, w.Count, w.QPS, w.P50Ms, w.P95Ms, w.P99Ms)
+	}
+
+	fmt.Printf("\n   %-28s %-5s %11s %11s %11s %9s %9s\n",
+		"Query", "Uses", "Before p95", "During p95", "After p95", "Build Δ", "Index Δ")
+	for _, q := range r.Queries {
+		uses := ""
+		if q.UsesIndex {
+			uses = "✓"
+		}
+		verdict := ""
+		switch {
+		case q.UsesIndex && q.AfterDeltaPct <= -10:
+			verdict = "📉 faster with index"
+		case q.UsesIndex && q.AfterDeltaPct >= 10:
+			verdict = "📈 slower with index"
+		case q.DuringDeltaPct >= 50:
+			verdict = "⚠️  hurt by build"
+		}
+		fmt.Printf("   %-28s %-5s %9.2fms %9.2fms %9.2fms %+8.1f%% %+8.1f%% %s\n",
+			q.Query, uses, q.BeforeP95, q.DuringP95, q.AfterP95, q.DuringDeltaPct, q.AfterDeltaPct, verdict)
+	}
+
+	if len(r.UsedBy) == 0 && r.Valid {
+		fmt.Printf("\n   ⚠️  No query plan uses %s: the index costs writes and buys nothing for this workload\n", r.Index)
+	}
+	if len(r.NotPlanned) > 0 {
+		fmt.Printf("   Plans not captured after the build: %s\n", strings.Join(r.NotPlanned, ", "))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+// ============================================================================
+// PROMETHEUS METRICS (-metrics-addr)
+// ============================================================================
+//
+// With -metrics-addr=:9109 the simulator serves /metrics for the whole run,
+// so a long run can be watched on the same dashboards as production (see
+// postgres/ops cmd/grafana-dashboard):
+//   stress_query_duration_seconds{query}        latency histogram per query
+//                                               (variants such as hinted
+//                                               count under their own name)
+//   stress_query_errors_total{query}            failed queries, after retries
+//   stress_pool_connections{state}              pgxpool connections: acquired, idle
+//   stress_pool_max_connections                 pgxpool MaxConns
+//   stress_pool_acquire_wait_seconds_total      time spent waiting for a pool connection
+// Every series carries the workload type as a label. Pool figures are read
+// on scrape.
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// simMetrics are the series -metrics-addr serves; nil when it is off.
+type simMetrics struct {
+	durations *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+}
+
+var promMetrics *simMetrics
+
+// Observe records one query outcome.
+func (m *simMetrics) Observe(queryName string, duration time.Duration, err error) {
+	m.durations.WithLabelValues(queryName).Observe(duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(queryName).Inc()
+	}
+}
+
+// simPoolCollector reads the pool's stats on every scrape.
+type simPoolCollector struct {
+	pool                  *pgxpool.Pool
+	conns, maxConns, wait *prometheus.Desc
+}
+
+func (c *simPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *simPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.conns, prometheus.GaugeValue, float64(stat.AcquiredConns()), "acquired")
+	ch <- prometheus.MustNewConstMetric(c.conns, prometheus.GaugeValue, float64(stat.IdleConns()), "idle")
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.wait, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
+
+// startMetricsServer serves /metrics on config.MetricsAddr in the
+// background and turns on recording.
+func startMetricsServer(pool *pgxpool.Pool) {
+	workload := prometheus.Labels{"workload": config.WorkloadType}
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc("stress_"+name, help, labels, workload)
+	}
+	m := &simMetrics{
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "stress_query_duration_seconds", Help: "Query latency, per query.", ConstLabels: workload,
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+		}, []string{"query"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "stress_query_errors_total", Help: "Failed queries, per query.", ConstLabels: workload,
+		}, []string{"query"}),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.durations, m.errors, &simPoolCollector{
+		pool:     pool,
+		conns:    desc("pool_connections", "Connections of the simulator's pool by state.", "state"),
+		maxConns: desc("pool_max_connections", "Size limit of the simulator's pool."),
+		wait:     desc("pool_acquire_wait_seconds_total", "Time spent waiting for a pool connection."),
+	})
+	promMetrics = m
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: config.MetricsAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+	fmt.Printf("📡 Prometheus metrics on http://%s/metrics\n", config.MetricsAddr)
+}
@@ -0,0 +1,548 @@
+package main
+
+// ============================================================================
+// NETWORK FAULT PROXY (-proxy-faults "1m+30s:latency=50ms,...")
+// ============================================================================
+//
+// What does the workload do when the network misbehaves? With proxy.enabled
+// (or any proxy.faults) the simulator starts a TCP proxy in-process and
+// every simulator connection (the pool, statement cache pools, churn
+// workers) goes through it to the DSN's host. Faults are scheduled
+// relative to the start of the load, AT[+FOR]:KIND[=VALUE]:
+//   latency=50ms[~10ms]  adds round-trip latency (half each way, per
+//                        chunk forwarded) plus up to the jitter
+//   bandwidth=256KB      caps throughput per direction, shared by all
+//                        connections like a saturated link (bytes/s)
+//   reset                RSTs every open connection at AT, and every new
+//                        one until AT+FOR
+//   blackhole            forwards nothing until AT+FOR; data waits, so it
+//                        behaves like a partition shorter than TCP's
+//                        retransmission timeout (add a reset to model one
+//                        that outlives it)
+// No root, tc or iptables on the database host needed. Overlapping faults
+// combine (highest latency, lowest bandwidth).
+//
+// Each query outcome is filed under the latest fault whose window it
+// overlaps (one-shot resets get the next 10s), or the no-fault baseline,
+// so the report shows latency and errors per fault next to the baseline.
+// Monitoring queries share the pool and see the faults too.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// resetObserveWindow is how long a one-shot reset's aftermath is measured.
+const resetObserveWindow = 10 * time.Second
+
+// ProxyFault is one scheduled fault.
+type ProxyFault struct {
+	Spec      string
+	At        time.Duration
+	For       time.Duration
+	Kind      string // latency, bandwidth, reset or blackhole
+	Latency   time.Duration
+	Jitter    time.Duration
+	Bandwidth int64 // Bytes per second
+}
+
+// window is the span the fault's query outcomes are filed under.
+func (f ProxyFault) window() time.Duration {
+	if f.Kind == "reset" && f.For == 0 {
+		return resetObserveWindow
+	}
+	return f.For
+}
+
+// parseProxyFault parses AT[+FOR]:KIND[=VALUE].
+func parseProxyFault(s string) (ProxyFault, error) {
+	s = strings.TrimSpace(s)
+	f := ProxyFault{Spec: s}
+	bad := func(why string) (ProxyFault, error) {
+		return ProxyFault{}, fmt.Errorf("proxy: invalid fault %q: %s (use AT[+FOR]:latency=D[~J], bandwidth=SIZE, reset or blackhole)", s, why)
+	}
+
+	when, what, ok := strings.Cut(s, ":")
+	if !ok {
+		return bad("missing kind")
+	}
+	atText, forText, hasFor := strings.Cut(when, "+")
+	var err error
+	if f.At, err = time.ParseDuration(atText); err != nil || f.At < 0 {
+		return bad("bad start")
+	}
+	if hasFor {
+		if f.For, err = time.ParseDuration(forText); err != nil || f.For <= 0 {
+			return bad("bad length")
+		}
+	}
+
+	kind, value, hasValue := strings.Cut(what, "=")
+	f.Kind = kind
+	switch kind {
+	case "latency":
+		latText, jitText, hasJitter := strings.Cut(value, "~")
+		if f.Latency, err = time.ParseDuration(latText); err != nil || f.Latency <= 0 {
+			return bad("latency needs a duration")
+		}
+		if hasJitter {
+			if f.Jitter, err = time.ParseDuration(jitText); err != nil || f.Jitter < 0 {
+				return bad("bad jitter")
+			}
+		}
+	case "bandwidth":
+		if f.Bandwidth, err = parseByteSize(strings.TrimSuffix(value, "/s")); err != nil {
+			return bad("bandwidth needs a positive size per second")
+		}
+	case "reset", "blackhole":
+		if hasValue {
+			return bad(kind + " takes no value")
+		}
+	default:
+		return bad("unknown kind")
+	}
+	if f.For == 0 && kind != "reset" {
+		return bad(kind + " needs +FOR")
+	}
+	return f, nil
+}
+
+// parseByteSize parses 500000, 64KB, 64kB or 1MB as bytes.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"kB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("size must be a positive number of B, kB, MB or GB")
+	}
+	return n * mult, nil
+}
+
+// proxyEffect is what the active faults add up to at one moment.
+type proxyEffect struct {
+	latency, jitter time.Duration
+	bandwidth       int64
+	reset           bool
+	blackhole       bool
+	blackholeUntil  time.Time
+}
+
+// rateLimiter spaces writes so a direction never exceeds its rate.
+type rateLimiter struct {
+	next time.Time
+	mu   sync.Mutex
+}
+
+func (rl *rateLimiter) wait(n int, rate int64) {
+	rl.mu.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	rl.next = rl.next.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+	until := rl.next
+	rl.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+type proxyConn struct {
+	client, upstream net.Conn
+	done             chan struct{}
+	once             sync.Once
+}
+
+// close shuts both sides; with reset the client gets an RST, not a FIN.
+func (pc *proxyConn) close(reset bool) {
+	pc.once.Do(func() {
+		if tcp, ok := pc.client.(*net.TCPConn); ok && reset {
+			tcp.SetLinger(0)
+		}
+		pc.client.Close()
+		pc.upstream.Close()
+		close(pc.done)
+	})
+}
+
+type NetProxy struct {
+	faults   []ProxyFault
+	upstream string
+	ln       net.Listener
+	start    time.Time // Zero until the schedule starts
+	conns    map[*proxyConn]struct{}
+	limiters [2]rateLimiter // To server, to client
+
+	accepted   int64
+	resets     int64
+	dialErrors int64
+	bytes      [2]int64
+	heldNs     int64 // Time chunks spent waiting out black-holes
+
+	baseline *QueryMetrics
+	windows  []*QueryMetrics
+	mu       sync.Mutex
+}
+
+var netProxy *NetProxy
+
+func newNetProxy(specs []string) (*NetProxy, error) {
+	p := &NetProxy{
+		conns:    make(map[*proxyConn]struct{}),
+		baseline: &QueryMetrics{Name: "baseline"},
+	}
+	for _, s := range specs {
+		f, err := parseProxyFault(s)
+		if err != nil {
+			return nil, err
+		}
+		p.faults = append(p.faults, f)
+	}
+	sort.SliceStable(p.faults, func(i, j int) bool { return p.faults[i].At < p.faults[j].At })
+	for _, f := range p.faults {
+		p.windows = append(p.windows, &QueryMetrics{Name: f.Spec})
+	}
+	return p, nil
+}
+
+// listen starts accepting on addr and forwarding to the DSN's first host.
+func (p *NetProxy) listen(addr, dsn string) error {
+	cc, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		return fmt.Errorf("proxy: failed to parse DSN: %w", err)
+	}
+	if strings.HasPrefix(cc.Host, "/") {
+		return fmt.Errorf("proxy: %s is a Unix socket; the proxy needs a TCP host", cc.Host)
+	}
+	p.upstream = net.JoinHostPort(cc.Host, strconv.Itoa(int(cc.Port)))
+
+	if p.ln, err = net.Listen("tcp", addr); err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+	go p.acceptLoop()
+	return nil
+}
+
+// route points a connection config (and its fallbacks) at the proxy. TLS
+// settings are kept, including the server name to verify.
+func (p *NetProxy) route(cc *pgconn.Config) {
+	addr := p.ln.Addr().(*net.TCPAddr)
+	routeTo(cc, addr.IP.String(), uint16(addr.Port))
+}
+
+// routeTo points a connection config and its fallbacks at host:port.
+func routeTo(cc *pgconn.Config, host string, port uint16) {
+	cc.Host, cc.Port = host, port
+	for _, fb := range cc.Fallbacks {
+		fb.Host, fb.Port = host, port
+	}
+}
+
+func (p *NetProxy) acceptLoop() {
+	for {
+		c, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(c)
+	}
+}
+
+func (p *NetProxy) handle(client net.Conn) {
+	atomic.AddInt64(&p.accepted, 1)
+	if p.effect(time.Now()).reset {
+		atomic.AddInt64(&p.resets, 1)
+		if tcp, ok := client.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		client.Close()
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", p.upstream, 10*time.Second)
+	if err != nil {
+		atomic.AddInt64(&p.dialErrors, 1)
+		client.Close()
+		return
+	}
+	pc := &proxyConn{client: client, upstream: upstream, done: make(chan struct{})}
+	p.mu.Lock()
+	p.conns[pc] = struct{}{}
+	p.mu.Unlock()
+
+	go p.pipe(pc, client, upstream, 0)
+	p.pipe(pc, upstream, client, 1)
+
+	pc.close(false)
+	p.mu.Lock()
+	delete(p.conns, pc)
+	p.mu.Unlock()
+}
+
+// pipe forwards src to dst through the active faults until either side
+// closes. dir 0 is toward the server, 1 toward the client.
+func (p *NetProxy) pipe(pc *proxyConn, src, dst net.Conn, dir int) {
+	defer pc.close(false)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if !p.shape(pc, dir, n) {
+				return
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+			atomic.AddInt64(&p.bytes[dir], int64(n))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// shape delays one chunk as the active faults dictate. It reports false
+// when the connection was closed meanwhile.
+func (p *NetProxy) shape(pc *proxyConn, dir, n int) bool {
+	e := p.effect(time.Now())
+	if e.blackhole {
+		held := time.Now()
+		for e.blackhole {
+			select {
+			case <-pc.done:
+				return false
+			case <-time.After(min(time.Until(e.blackholeUntil), 100*time.Millisecond)):
+			}
+			e = p.effect(time.Now())
+		}
+		atomic.AddInt64(&p.heldNs, int64(time.Since(held)))
+	}
+	if e.latency > 0 {
+		d := e.latency / 2
+		if e.jitter > 0 {
+			d += time.Duration(rand.Int63n(int64(e.jitter)/2 + 1))
+		}
+		select {
+		case <-pc.done:
+			return false
+		case <-time.After(d):
+		}
+	}
+	if e.bandwidth > 0 {
+		p.limiters[dir].wait(n, e.bandwidth)
+	}
+	return true
+}
+
+// effect combines the faults active at now.
+func (p *NetProxy) effect(now time.Time) proxyEffect {
+	var e proxyEffect
+	p.mu.Lock()
+	start := p.start
+	p.mu.Unlock()
+	if start.IsZero() {
+		return e
+	}
+	for _, f := range p.faults {
+		from, to := start.Add(f.At), start.Add(f.At+f.For)
+		if now.Before(from) || !now.Before(to) {
+			continue
+		}
+		switch f.Kind {
+		case "latency":
+			e.latency = max(e.latency, f.Latency)
+			e.jitter = max(e.jitter, f.Jitter)
+		case "bandwidth":
+			if e.bandwidth == 0 || f.Bandwidth < e.bandwidth {
+				e.bandwidth = f.Bandwidth
+			}
+		case "reset":
+			e.reset = true
+		case "blackhole":
+			e.blackhole = true
+			if to.After(e.blackholeUntil) {
+				e.blackholeUntil = to
+			}
+		}
+	}
+	return e
+}
+
+// runProxySchedule starts the fault clock and fires the faults.
+func runProxySchedule(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	p := netProxy
+	p.mu.Lock()
+	p.start = time.Now()
+	p.mu.Unlock()
+
+	for _, f := range p.faults {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(p.start.Add(f.At))):
+		}
+		log.Printf("🌐 Proxy: %s", f.Spec)
+		if f.Kind == "reset" {
+			p.resetAll()
+		}
+	}
+}
+
+func (p *NetProxy) resetAll() {
+	p.mu.Lock()
+	conns := make([]*proxyConn, 0, len(p.conns))
+	for pc := range p.conns {
+		conns = append(conns, pc)
+	}
+	p.mu.Unlock()
+	for _, pc := range conns {
+		pc.close(true)
+	}
+	atomic.AddInt64(&p.resets, int64(len(conns)))
+}
+
+func (p *NetProxy) close() {
+	if p.ln != nil {
+		p.ln.Close()
+	}
+}
+
+// Record files a query outcome under the latest fault window it overlaps;
+// a query stuck in a black-hole finishes only after the window ends.
+func (p *NetProxy) Record(d time.Duration, err error) {
+	p.mu.Lock()
+	start := p.start
+	p.mu.Unlock()
+	if start.IsZero() {
+		return
+	}
+	end := time.Since(start)
+	qm := p.baseline
+	for i, f := range p.faults {
+		if end >= f.At && end-d < f.At+f.window() {
+			qm = p.windows[i]
+		}
+	}
+	recordLatency(qm, d, err)
+}
+
+// ProxyWindow is the workload seen during one fault, or without any.
+type ProxyWindow struct {
+	Fault    string  `json:"fault"`
+	StartSec float64 `json:"start_sec,omitempty"`
+	EndSec   float64 `json:"end_sec,omitempty"`
+	Queries  int64   `json:"queries"`
+	Errors   int64   `json:"errors"`
+	P50Ms    float64 `json:"p50_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	MaxMs    float64 `json:"max_ms"`
+}
+
+type ProxyReport struct {
+	Listen        string        `json:"listen"`
+	Upstream      string        `json:"upstream"`
+	Connections   int64         `json:"connections"`
+	Resets        int64         `json:"resets"`
+	DialErrors    int64         `json:"dial_errors"`
+	BytesToServer int64         `json:"bytes_to_server"`
+	BytesToClient int64         `json:"bytes_to_client"`
+	HeldSec       float64       `json:"held_sec"` // Chunk-seconds spent in black-holes
+	Baseline      ProxyWindow   `json:"baseline"`
+	Faults        []ProxyWindow `json:"faults"`
+}
+
+func proxyWindow(name string, qm *QueryMetrics) ProxyWindow {
+	s := qm.Summary()
+	w := ProxyWindow{
+		Fault:   name,
+		Queries: s.Count,
+		Errors:  s.Errors,
+		P50Ms:   durationMs(s.P50),
+		P99Ms:   durationMs(s.P99),
+	}
+	qm.mu.Lock()
+	for _, d := range qm.Latencies {
+		w.MaxMs = max(w.MaxMs, durationMs(d))
+	}
+	qm.mu.Unlock()
+	return w
+}
+
+func (p *NetProxy) Report() *ProxyReport {
+	r := &ProxyReport{
+		Listen:        p.ln.Addr().String(),
+		Upstream:      p.upstream,
+		Connections:   atomic.LoadInt64(&p.accepted),
+		Resets:        atomic.LoadInt64(&p.resets),
+		DialErrors:    atomic.LoadInt64(&p.dialErrors),
+		BytesToServer: atomic.LoadInt64(&p.bytes[0]),
+		BytesToClient: atomic.LoadInt64(&p.bytes[1]),
+		HeldSec:       time.Duration(atomic.LoadInt64(&p.heldNs)).Seconds(),
+		Baseline:      proxyWindow("(no fault)", p.baseline),
+	}
+	for i, f := range p.faults {
+		w := proxyWindow(f.Spec, p.windows[i])
+		w.StartSec = f.At.Seconds()
+		w.EndSec = (f.At + f.window()).Seconds()
+		r.Faults = append(r.Faults, w)
+	}
+	return r
+}
+
+// printFaultWindows prints the baseline and one row per fault window.
+func printFaultWindows(baseline ProxyWindow, faults []ProxyWindow) {
+	fmt.Printf("\n   %-34s %13s %9s %7s %9s %9s %9s\n", "Fault", "Window", "Queries", "Errors", "p50", "p99", "max")
+	printWindow := func(w ProxyWindow, span string) {
+		fmt.Printf("   %-34s %13s %9d %7d %7.2fms %7.2fms %7.0fms\n",
+			w.Fault, span, w.Queries, w.Errors, w.P50Ms, w.P99Ms, w.MaxMs)
+	}
+	printWindow(baseline, "-")
+	for _, w := range faults {
+		printWindow(w, fmt.Sprintf("%.0fs-%.0fs", w.StartSec, w.EndSec))
+	}
+}
+
+func (p *NetProxy) PrintReport() {
+	r := p.Report()
+
+	fmt.Printf("\n🌐 Network Fault Proxy (%s → %s):\n", r.Listen, r.Upstream)
+	fmt.Printf("   Connections:  %d accepted, %d reset, %d upstream dial errors\n",
+		r.Connections, r.Resets, r.DialErrors)
+	fmt.Printf("   Traffic:      %s to the server, %s to the client\n",
+		formatBytes(r.BytesToServer), formatBytes(r.BytesToClient))
+
+	printFaultWindows(r.Baseline, r.Faults)
+
+	for i, w := range r.Faults {
+		f := p.faults[i]
+		switch {
+		case f.Kind == "blackhole" && w.MaxMs >= 0.8*durationMs(f.For):
+			fmt.Printf("   ⚠️  %s: queries hung for the whole black-hole. statement_timeout cannot fire (the server\n", f.Spec)
+			fmt.Println("      never got the query); bound them client-side with a context deadline, and set")
+			fmt.Println("      tcp_user_timeout / keepalives so dead connections are noticed.")
+		case f.Kind == "reset" && w.Errors > 0:
+			fmt.Printf("   ⚠️  %s: %d queries failed on reset connections; retry them on a fresh connection.\n", f.Spec, w.Errors)
+		case r.Baseline.P99Ms > 0 && w.P99Ms > 10*r.Baseline.P99Ms:
+			fmt.Printf("   ⚠️  %s: p99 %.0fx the baseline.\n", f.Spec, w.P99Ms/r.Baseline.P99Ms)
+		}
+	}
+}
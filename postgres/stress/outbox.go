@@ -0,0 +1,380 @@
+package main
+
+// ============================================================================
+// TRANSACTIONAL OUTBOX SIMULATOR (-outbox-writers=N)
+// ============================================================================
+//
+// The outbox pattern makes "write the row and publish the event" atomic:
+// the event goes into an outbox table in the same transaction as the
+// business row, and a relay polls the outbox, publishes and deletes. It is
+// also a textbook queue-in-a-table: every event is inserted once and
+// deleted once, so the head of the outbox is a graveyard of dead tuples
+// that the relay's ORDER BY id LIMIT n walks through on every poll until
+// vacuum removes them. Under load this measures:
+//   writes    business row + outbox row per transaction, commit latency
+//   polling   the relay's claim-and-delete (FOR UPDATE SKIP LOCKED, so
+//             several relays share the work), its latency, rows per poll
+//             and empty polls
+//   delivery  outbox insert to relayed, from the server's clock on both
+//             ends (clock_timestamp()), so no client skew
+//   bloat     outbox heap and index size, dead tuples and autovacuum runs,
+//             sampled every 5s; and the buffers one poll touches (EXPLAIN
+//             ANALYZE of the poll's SELECT), which is what bloat costs
+// The writers run next to the read workload; the relays poll every
+// outbox.poll_interval and immediately again after a full batch.
+//
+// Tables dbre_outbox_orders and dbre_outbox_events are created if missing
+// and truncated at the start of the run; they are left in place afterwards
+// for inspection.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	outboxOrdersTable = "dbre_outbox_orders"
+	outboxEventsTable = "dbre_outbox_events"
+)
+
+// OutboxSample is one reading of the outbox table.
+type OutboxSample struct {
+	OffsetSec   float64 `json:"offset_sec"`
+	TableBytes  int64   `json:"table_bytes"`
+	IndexBytes  int64   `json:"index_bytes"`
+	LiveTuples  int64   `json:"live_tuples"`
+	DeadTuples  int64   `json:"dead_tuples"`
+	Autovacuums int64   `json:"autovacuums"`
+	Backlog     int64   `json:"backlog"`      // Written, not relayed yet
+	PollBuffers int64   `json:"poll_buffers"` // Shared buffers one poll touches
+	PollExecMs  float64 `json:"poll_exec_ms"` // Execution time of the probed poll
+}
+
+type OutboxSimulator struct {
+	written  int64
+	relayed  int64
+	polls    int64
+	empty    int64
+	writes   *QueryMetrics
+	pollLat  *QueryMetrics
+	delivery *QueryMetrics
+	start    time.Time
+	samples  []OutboxSample
+	mu       sync.Mutex
+}
+
+var outboxSim *OutboxSimulator
+
+func newOutboxSimulator() *OutboxSimulator {
+	return &OutboxSimulator{
+		writes:   &QueryMetrics{Name: "outbox_write"},
+		pollLat:  &QueryMetrics{Name: "outbox_poll"},
+		delivery: &QueryMetrics{Name: "outbox_delivery"},
+	}
+}
+
+// outboxConnCount is how many pool connections the outbox workers hold.
+func outboxConnCount() int {
+	if config.OutboxWriters <= 0 {
+		return 0
+	}
+	return config.OutboxWriters + config.OutboxRelays
+}
+
+// setup creates the tables if needed and empties them so the bloat
+// numbers start from zero.
+func (ob *OutboxSimulator) setup(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS `+outboxOrdersTable+` (
+			id          bigserial PRIMARY KEY,
+			customer_id bigint NOT NULL,
+			amount      numeric(12,2) NOT NULL,
+			created_at  timestamptz NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS `+outboxEventsTable+` (
+			id           bigserial PRIMARY KEY,
+			aggregate_id bigint NOT NULL,
+			event_type   text NOT NULL,
+			payload      jsonb NOT NULL,
+			created_at   timestamptz NOT NULL DEFAULT clock_timestamp()
+		);
+		TRUNCATE `+outboxOrdersTable+`, `+outboxEventsTable+` RESTART IDENTITY`)
+	if err != nil {
+		return fmt.Errorf("outbox: failed to set up tables: %w", err)
+	}
+	ob.start = time.Now()
+	return nil
+}
+
+// recordLatency files one observation.
+func recordLatency(qm *QueryMetrics, d time.Duration, err error) {
+	qm.mu.Lock()
+	qm.ExecutionCount++
+	if err != nil {
+		qm.ErrorCount++
+	} else {
+		qm.TotalDuration += d
+		qm.Latencies = append(qm.Latencies, d)
+	}
+	qm.mu.Unlock()
+}
+
+// runOutboxWriter inserts an order and its event in one transaction.
+func runOutboxWriter(ctx context.Context, workerID int, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ob := outboxSim
+
+	for ctx.Err() == nil {
+		customerID := rand.Int63n(config.TotalRows/10 + 1)
+		amount := float64(rand.Intn(100000)) / 100
+
+		start := time.Now()
+		err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+			var orderID int64
+			err := tx.QueryRow(ctx, `
+				INSERT INTO `+outboxOrdersTable+` (customer_id, amount) VALUES ($1, $2) RETURNING id
+			`, customerID, amount).Scan(&orderID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO `+outboxEventsTable+` (aggregate_id, event_type, payload)
+				VALUES ($1, 'order_created', jsonb_build_object('order_id', $1::bigint, 'customer_id', $2::bigint,
+				        'amount', $3::numeric, 'pad', repeat('x', $4::int)))
+			`, orderID, customerID, amount, config.OutboxPayload)
+			return err
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		recordLatency(ob.writes, time.Since(start), err)
+		if err != nil {
+			log.Printf("Outbox writer %d: %v", workerID, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		atomic.AddInt64(&ob.written, 1)
+
+		// Think time: 0-10ms
+		time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
+	}
+}
+
+// runOutboxRelay claims, "publishes" and deletes a batch per poll.
+func runOutboxRelay(ctx context.Context, workerID int, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ob := outboxSim
+
+	for ctx.Err() == nil {
+		start := time.Now()
+		rows, err := pool.Query(ctx, `
+			WITH batch AS (
+				SELECT id FROM `+outboxEventsTable+` ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+			)
+			DELETE FROM `+outboxEventsTable+` o USING batch b WHERE o.id = b.id
+			RETURNING extract(epoch FROM clock_timestamp() - o.created_at)
+		`, config.OutboxBatch)
+		var lags []time.Duration
+		if err == nil {
+			for rows.Next() {
+				var secs float64
+				if err = rows.Scan(&secs); err != nil {
+					break
+				}
+				lags = append(lags, time.Duration(secs*float64(time.Second)))
+			}
+			rows.Close()
+			if err == nil {
+				err = rows.Err()
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		recordLatency(ob.pollLat, time.Since(start), err)
+		atomic.AddInt64(&ob.polls, 1)
+		if err != nil {
+			log.Printf("Outbox relay %d: %v", workerID, err)
+		} else {
+			atomic.AddInt64(&ob.relayed, int64(len(lags)))
+			for _, lag := range lags {
+				recordLatency(ob.delivery, lag, nil)
+			}
+			if len(lags) == 0 {
+				atomic.AddInt64(&ob.empty, 1)
+			}
+		}
+
+		// A full batch means there is more waiting: poll again right away.
+		if err == nil && len(lags) == config.OutboxBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.OutboxRelayInterval):
+		}
+	}
+}
+
+// monitorOutbox samples the outbox table every interval.
+func (ob *OutboxSimulator) monitorOutbox(ctx context.Context, pool *pgxpool.Pool, interval time.Duration) {
+	ob.sample(ctx, pool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ob.sample(ctx, pool)
+		}
+	}
+}
+
+func (ob *OutboxSimulator) sample(ctx context.Context, pool *pgxpool.Pool) {
+	s := OutboxSample{
+		OffsetSec: time.Since(ob.start).Seconds(),
+		Backlog:   atomic.LoadInt64(&ob.written) - atomic.LoadInt64(&ob.relayed),
+	}
+	err := pool.QueryRow(ctx, `
+		SELECT pg_relation_size(relid), pg_indexes_size(relid), n_live_tup, n_dead_tup, autovacuum_count
+		FROM pg_stat_user_tables WHERE relid = $1::regclass
+	`, outboxEventsTable).Scan(&s.TableBytes, &s.IndexBytes, &s.LiveTuples, &s.DeadTuples, &s.Autovacuums)
+	if err != nil {
+		return
+	}
+
+	// What one poll reads: the SELECT part, without taking locks.
+	var raw string
+	err = pool.QueryRow(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) SELECT id FROM "+outboxEventsTable+" ORDER BY id LIMIT $1",
+		config.OutboxBatch).Scan(&raw)
+	var results []ExplainResult
+	if err == nil && json.Unmarshal([]byte(raw), &results) == nil && len(results) > 0 {
+		s.PollBuffers = results[0].Plan.SharedHitBlocks + results[0].Plan.SharedReadBlocks
+		s.PollExecMs = results[0].ExecutionTime
+	}
+
+	ob.mu.Lock()
+	ob.samples = append(ob.samples, s)
+	ob.mu.Unlock()
+}
+
+type OutboxReport struct {
+	Writers          int            `json:"writers"`
+	Relays           int            `json:"relays"`
+	Batch            int            `json:"batch"`
+	Written          int64          `json:"written"`
+	Relayed          int64          `json:"relayed"`
+	WritesPerSec     float64        `json:"writes_per_sec"`
+	WriteErrors      int64          `json:"write_errors"`
+	WriteP50Ms       float64        `json:"write_p50_ms"`
+	WriteP95Ms       float64        `json:"write_p95_ms"`
+	WriteP99Ms       float64        `json:"write_p99_ms"`
+	Polls            int64          `json:"polls"`
+	EmptyPolls       int64          `json:"empty_polls"`
+	PollErrors       int64          `json:"poll_errors"`
+	RowsPerPoll      float64        `json:"rows_per_poll"`
+	PollP50Ms        float64        `json:"poll_p50_ms"`
+	PollP95Ms        float64        `json:"poll_p95_ms"`
+	PollP99Ms        float64        `json:"poll_p99_ms"`
+	DeliveryP50Ms    float64        `json:"delivery_p50_ms"`
+	DeliveryP95Ms    float64        `json:"delivery_p95_ms"`
+	DeliveryP99Ms    float64        `json:"delivery_p99_ms"`
+	BacklogEnd       int64          `json:"backlog_end"`
+	BacklogPeak      int64          `json:"backlog_peak"`
+	TableBytesPeak   int64          `json:"table_bytes_peak"`
+	IndexBytesPeak   int64          `json:"index_bytes_peak"`
+	DeadTuplesPeak   int64          `json:"dead_tuples_peak"`
+	Autovacuums      int64          `json:"autovacuums"`
+	PollBuffersFirst int64          `json:"poll_buffers_first"`
+	PollBuffersPeak  int64          `json:"poll_buffers_peak"`
+	PollBuffersLast  int64          `json:"poll_buffers_last"`
+	Samples          []OutboxSample `json:"samples"`
+}
+
+func (ob *OutboxSimulator) Report() *OutboxReport {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	w, p, d := ob.writes.Summary(), ob.pollLat.Summary(), ob.delivery.Summary()
+	r := &OutboxReport{
+		Writers:       config.OutboxWriters,
+		Relays:        config.OutboxRelays,
+		Batch:         config.OutboxBatch,
+		Written:       atomic.LoadInt64(&ob.written),
+		Relayed:       atomic.LoadInt64(&ob.relayed),
+		WriteErrors:   w.Errors,
+		WriteP50Ms:    durationMs(w.P50),
+		WriteP95Ms:    durationMs(w.P95),
+		WriteP99Ms:    durationMs(w.P99),
+		Polls:         atomic.LoadInt64(&ob.polls),
+		EmptyPolls:    atomic.LoadInt64(&ob.empty),
+		PollErrors:    p.Errors,
+		PollP50Ms:     durationMs(p.P50),
+		PollP95Ms:     durationMs(p.P95),
+		PollP99Ms:     durationMs(p.P99),
+		DeliveryP50Ms: durationMs(d.P50),
+		DeliveryP95Ms: durationMs(d.P95),
+		DeliveryP99Ms: durationMs(d.P99),
+		Samples:       append([]OutboxSample(nil), ob.samples...),
+	}
+	r.BacklogEnd = r.Written - r.Relayed
+	if elapsed := time.Since(ob.start).Seconds(); elapsed > 0 {
+		r.WritesPerSec = float64(r.Written) / elapsed
+	}
+	if r.Polls > r.PollErrors {
+		r.RowsPerPoll = float64(r.Relayed) / float64(r.Polls-r.PollErrors)
+	}
+	for i, s := range ob.samples {
+		r.BacklogPeak = max(r.BacklogPeak, s.Backlog)
+		r.TableBytesPeak = max(r.TableBytesPeak, s.TableBytes)
+		r.IndexBytesPeak = max(r.IndexBytesPeak, s.IndexBytes)
+		r.DeadTuplesPeak = max(r.DeadTuplesPeak, s.DeadTuples)
+		r.PollBuffersPeak = max(r.PollBuffersPeak, s.PollBuffers)
+		if i == 0 {
+			r.PollBuffersFirst = s.PollBuffers
+		}
+		r.PollBuffersLast = s.PollBuffers
+		r.Autovacuums = s.Autovacuums - ob.samples[0].Autovacuums
+	}
+	return r
+}
+
+func (ob *OutboxSimulator) PrintReport() {
+	r := ob.Report()
+
+	fmt.Printf("\n📮 Transactional Outbox (%d writers, %d relays, batch %d every %v):\n",
+		r.Writers, r.Relays, r.Batch, config.OutboxRelayInterval)
+	fmt.Printf("   Writes:     %d (%.1f/s, %d errors)  commit p50 %.2fms  p95 %.2fms  p99 %.2fms\n",
+		r.Written, r.WritesPerSec, r.WriteErrors, r.WriteP50Ms, r.WriteP95Ms, r.WriteP99Ms)
+	fmt.Printf("   Polls:      %d (%d empty, %d errors, %.1f rows/poll)  p50 %.2fms  p95 %.2fms  p99 %.2fms\n",
+		r.Polls, r.EmptyPolls, r.PollErrors, r.RowsPerPoll, r.PollP50Ms, r.PollP95Ms, r.PollP99Ms)
+	fmt.Printf("   Delivery:   %d relayed  insert→relayed p50 %.1fms  p95 %.1fms  p99 %.1fms\n",
+		r.Relayed, r.DeliveryP50Ms, r.DeliveryP95Ms, r.DeliveryP99Ms)
+	fmt.Printf("   Backlog:    %d at the end, peak %d\n", r.BacklogEnd, r.BacklogPeak)
+	fmt.Printf("   Bloat:      outbox peak %s heap + %s indexes, peak %d dead tuples, %d autovacuum run(s)\n",
+		formatBytes(r.TableBytesPeak), formatBytes(r.IndexBytesPeak), r.DeadTuplesPeak, r.Autovacuums)
+	fmt.Printf("   Poll cost:  %d buffers per poll at the start, peak %d, %d at the end\n",
+		r.PollBuffersFirst, r.PollBuffersPeak, r.PollBuffersLast)
+
+	if r.PollBuffersFirst > 0 && r.PollBuffersPeak >= 10*r.PollBuffersFirst {
+		fmt.Printf("   ⚠️  Polling got %dx more expensive: the relay walks dead index entries at the head of the\n",
+			r.PollBuffersPeak/r.PollBuffersFirst)
+		fmt.Println("      outbox until vacuum removes them. Vacuum the outbox aggressively (autovacuum_vacuum_scale_factor=0,")
+		fmt.Println("      autovacuum_vacuum_threshold=1000, autovacuum_vacuum_cost_delay=0), and look for long transactions")
+		fmt.Println("      holding back the xmin horizon.")
+	}
+	if r.Polls > 0 && r.BacklogPeak > int64(10*r.Batch) && r.BacklogEnd >= r.BacklogPeak/2 {
+		fmt.Println("   ⚠️  The relays fell behind the writers: add relays (SKIP LOCKED lets them share) or raise the batch.")
+	}
+}
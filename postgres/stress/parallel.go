@@ -0,0 +1,203 @@
+package main
+
+// ============================================================================
+// PARALLEL QUERY UTILIZATION
+// ============================================================================
+//
+// Parallel plans are chosen at plan time, but workers are only launched if
+// max_parallel_workers has free slots at execution time. Under load the
+// analytics queries silently degrade to serial execution. We track:
+//   - planned vs launched workers per query (Gather / Gather Merge nodes in
+//     the EXPLAIN ANALYZE samples)
+//   - leader and parallel worker backends in pg_stat_activity over time
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type QueryParallelStats struct {
+	Samples         int64
+	ParallelSamples int64 // Samples whose plan had a Gather node
+	Degraded        int64 // Launched fewer workers than planned
+	Serial          int64 // Planned workers but launched none
+	WorkersPlanned  int64
+	WorkersLaunched int64
+}
+
+type ParallelTracker struct {
+	queries map[string]*QueryParallelStats
+	mu      sync.Mutex
+
+	activitySamples  int64
+	workerSum        int64
+	peakWorkers      int64
+	peakLeaders      int64
+	maxParallelSetup int64
+}
+
+var parallelTracker = &ParallelTracker{queries: make(map[string]*QueryParallelStats)}
+
+func (pt *ParallelTracker) Record(queryName string, result *ExplainResult) {
+	var planned, launched int64
+	result.Plan.walk(func(n *PlanNode) {
+		if n.NodeType == "Gather" || n.NodeType == "Gather Merge" {
+			planned += n.WorkersPlanned
+			launched += n.WorkersLaunched
+		}
+	})
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	qs, ok := pt.queries[queryName]
+	if !ok {
+		qs = &QueryParallelStats{}
+		pt.queries[queryName] = qs
+	}
+
+	qs.Samples++
+	if planned == 0 {
+		return
+	}
+	qs.ParallelSamples++
+	qs.WorkersPlanned += planned
+	qs.WorkersLaunched += launched
+	switch {
+	case launched == 0:
+		qs.Serial++
+	case launched < planned:
+		qs.Degraded++
+	}
+}
+
+// monitorParallelWorkers samples pg_stat_activity for parallel worker
+// backends and their leaders (leader_pid, PG13+).
+func monitorParallelWorkers(ctx context.Context, pool *pgxpool.Pool, interval time.Duration) {
+	var maxWorkers int64
+	if err := pool.QueryRow(ctx, `SELECT current_setting('max_parallel_workers')::bigint`).Scan(&maxWorkers); err == nil {
+		parallelTracker.mu.Lock()
+		parallelTracker.maxParallelSetup = maxWorkers
+		parallelTracker.mu.Unlock()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var workers, leaders int64
+			err := pool.QueryRow(ctx, `
+				SELECT count(*),
+				       count(DISTINCT leader_pid)
+				FROM pg_stat_activity
+				WHERE backend_type = 'parallel worker'
+			`).Scan(&workers, &leaders)
+			if err != nil {
+				continue
+			}
+
+			parallelTracker.mu.Lock()
+			parallelTracker.activitySamples++
+			parallelTracker.workerSum += workers
+			if workers > parallelTracker.peakWorkers {
+				parallelTracker.peakWorkers = workers
+			}
+			if leaders > parallelTracker.peakLeaders {
+				parallelTracker.peakLeaders = leaders
+			}
+			parallelTracker.mu.Unlock()
+		}
+	}
+}
+
+type ParallelReport struct {
+	MaxParallelWorkers int64                       `json:"max_parallel_workers"`
+	PeakWorkers        int64                       `json:"peak_parallel_workers"`
+	PeakLeaders        int64                       `json:"peak_parallel_leaders"`
+	AvgWorkers         float64                     `json:"avg_parallel_workers"`
+	Queries            map[string]QueryParallelRow `json:"queries"`
+}
+
+type QueryParallelRow struct {
+	Samples         int64   `json:"samples"`
+	ParallelSamples int64   `json:"parallel_samples"`
+	AvgPlanned      float64 `json:"avg_workers_planned"`
+	AvgLaunched     float64 `json:"avg_workers_launched"`
+	DegradedPct     float64 `json:"degraded_pct"` // Fewer workers than planned
+	SerialPct       float64 `json:"serial_pct"`   // No workers at all
+}
+
+func (pt *ParallelTracker) Report() *ParallelReport {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	r := &ParallelReport{
+		MaxParallelWorkers: pt.maxParallelSetup,
+		PeakWorkers:        pt.peakWorkers,
+		PeakLeaders:        pt.peakLeaders,
+		Queries:            make(map[string]QueryParallelRow),
+	}
+	if pt.activitySamples > 0 {
+		r.AvgWorkers = float64(pt.workerSum) / float64(pt.activitySamples)
+	}
+
+	for name, qs := range pt.queries {
+		if qs.ParallelSamples == 0 {
+			continue
+		}
+		n := float64(qs.ParallelSamples)
+		r.Queries[name] = QueryParallelRow{
+			Samples:         qs.Samples,
+			ParallelSamples: qs.ParallelSamples,
+			AvgPlanned:      float64(qs.WorkersPlanned) / n,
+			AvgLaunched:     float64(qs.WorkersLaunched) / n,
+			DegradedPct:     float64(qs.Degraded) / n * 100,
+			SerialPct:       float64(qs.Serial) / n * 100,
+		}
+	}
+	return r
+}
+
+func (pt *ParallelTracker) PrintReport() {
+	r := pt.Report()
+
+	fmt.Printf("\n⚡ Parallel Query Utilization:\n")
+	fmt.Printf("   Parallel Workers:     peak %d / max_parallel_workers %d (avg %.1f, peak leaders %d)\n",
+		r.PeakWorkers, r.MaxParallelWorkers, r.AvgWorkers, r.PeakLeaders)
+	if r.MaxParallelWorkers > 0 && r.PeakWorkers >= r.MaxParallelWorkers {
+		fmt.Println("   ⚠️  Worker pool saturated: new parallel plans cannot launch workers")
+	}
+
+	if len(r.Queries) == 0 {
+		if config.ExplainAnalyze {
+			fmt.Println("   No parallel plans observed in EXPLAIN ANALYZE samples")
+		}
+		return
+	}
+
+	names := make([]string, 0, len(r.Queries))
+	for name := range r.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("   %-28s %8s %8s %9s %10s %10s\n", "Query", "Parallel", "Planned", "Launched", "Degraded", "Serial")
+	for _, name := range names {
+		row := r.Queries[name]
+		status := "✅"
+		if row.DegradedPct > 0 || row.SerialPct > 0 {
+			status = "⚠️ "
+		}
+		fmt.Printf("   %s %-25s %8d %8.1f %9.1f %9.0f%% %9.0f%%\n",
+			status, name, row.ParallelSamples, row.AvgPlanned, row.AvgLaunched, row.DegradedPct, row.SerialPct)
+	}
+}
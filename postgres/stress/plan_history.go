@@ -0,0 +1,105 @@
+package main
+
+// ============================================================================
+// PLAN HISTORY (plan_check.persist_history / -plan-history)
+// ============================================================================
+//
+// The plan monitor only remembers plans for the lifetime of one run. With
+// persistence enabled every observed plan is upserted into a history table
+// (dbre_plan_history by default) on each plan check and once more at the end
+// of the run, keyed by run_id + query + plan hash. That makes drift visible
+// across runs and weeks, e.g.:
+//
+//   SELECT query_name, plan_hash, min(first_seen), max(last_seen),
+//          count(DISTINCT run_id) AS runs
+//   FROM dbre_plan_history
+//   GROUP BY 1, 2
+//   ORDER BY 1, 3;
+//
+// Each row also carries the query's fingerprint (package sqlfingerprint),
+// the same one topqueries and the log tools report, to join plan changes
+// with pg_stat_statements and the server log.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// planHistoryTable quotes the configured table name, allowing schema.table.
+func planHistoryTable() string {
+	return pgx.Identifier(strings.Split(config.PlanHistoryTable, ".")).Sanitize()
+}
+
+func ensurePlanHistoryTable(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s (
+			run_id          uuid             NOT NULL,
+			query_name      text             NOT NULL,
+			plan_hash       text             NOT NULL,
+			plan_text       text             NOT NULL,
+			avg_cost        double precision NOT NULL,
+			check_count     bigint           NOT NULL,
+			first_seen      timestamptz      NOT NULL,
+			last_seen       timestamptz      NOT NULL,
+			target_table    text             NOT NULL,
+			workload        text             NOT NULL,
+			fingerprint     text,
+			PRIMARY KEY (run_id, query_name, plan_hash)
+		)`, planHistoryTable()))
+	if err == nil {
+		// Tables created before the fingerprint column.
+		_, err = pool.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS fingerprint text`, planHistoryTable()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create plan history table %s: %w", config.PlanHistoryTable, err)
+	}
+	return nil
+}
+
+// Snapshot returns a copy of every plan seen so far.
+func (pm *PlanMonitor) Snapshot() []QueryPlan {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	plans := make([]QueryPlan, 0, len(pm.plans))
+	for _, plan := range pm.plans {
+		plans = append(plans, *plan)
+	}
+	return plans
+}
+
+// persistPlanHistory upserts the current plan set for this run in one batch.
+func persistPlanHistory(ctx context.Context, pool *pgxpool.Pool) error {
+	plans := planMonitor.Snapshot()
+	if len(plans) == 0 {
+		return nil
+	}
+
+	workload := config.WorkloadType
+	if config.Profile != "" {
+		workload = config.Profile
+	}
+
+	upsert := fmt.Sprintf(`
+		INSERT INTO %s (run_id, query_name, plan_hash, plan_text, avg_cost, check_count,
+		                first_seen, last_seen, target_table, workload, fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (run_id, query_name, plan_hash) DO UPDATE
+		SET avg_cost    = EXCLUDED.avg_cost,
+		    check_count = EXCLUDED.check_count,
+		    last_seen   = EXCLUDED.last_seen`, planHistoryTable())
+
+	batch := &pgx.Batch{}
+	for _, p := range plans {
+		batch.Queue(upsert, config.RunID, p.QueryName, p.PlanHash, p.PlanText, p.AvgCost,
+			p.ExecutionCount, p.FirstSeen, p.LastSeen, config.TableName, workload, p.Fingerprint)
+	}
+	if err := pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to persist plan history: %w", err)
+	}
+	return nil
+}
@@ -10,10 +10,12 @@ NEW FEATURES:
 - Connection burst mode testing
 - Cache hit rate tracking
 - Buffer pool analysis
+- Tuning advisor: prioritized parameter recommendations from the run's evidence
 
 Usage:
-    go run read_workload.go -duration=5m -sessions=25 -workload=mixed
-    go run read_workload.go -duration=1m -sessions=25 -workload=mixed -burst=100
+    go run . -duration=5m -sessions=25 -workload=mixed
+    go run . -duration=1m -sessions=25 -workload=mixed -burst=100
+    go run . -config run.yaml -duration=10m   # flags override file values
 ================================================================================
 */
 
@@ -21,8 +23,6 @@ package main
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
@@ -34,7 +34,11 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/planhash"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/sqlfingerprint"
 )
 
 // ============================================================================
@@ -46,6 +50,7 @@ type Config struct {
 	TableName        string
 	SessionCount     int
 	BurstSessions    int  // For burst mode testing
+	ChurnFraction    float64 // Fraction of sessions that connect per query
 	Duration         time.Duration
 	WorkloadType     string
 	ReportInterval   time.Duration
@@ -53,10 +58,86 @@ type Config struct {
 	// Workload distribution
 	TotalRows        int64  // Total rows in table (for ID generation)
 	TopCustomerPct   float64 // Top X% of customers for hot spot simulation
+	OLTPPercent      int     // Share of OLTP queries in mixed mode
+	Profile          string  // Built-in canonical workload profile (see profiles.go)
+	QueryWeights     map[string]int // Per-query weight overrides
 	
 	// Plan monitoring
 	PlanCheckEnabled bool
 	PlanCheckInterval time.Duration
+	ExplainAnalyze   bool // Also sample EXPLAIN ANALYZE (spills, parallel workers)
+	AnalyzeOnPlanChange bool          // Run ANALYZE when a plan flips and see if it flips back
+	AnalyzeCooldown  time.Duration // Minimum time between two remediation ANALYZEs
+	PlanHistory      bool   // Persist observed plans across runs
+	PlanHistoryTable string
+	
+	// pg_hint_plan A/B experiment
+	HintsEnabled     bool
+	HintRatio        float64 // Share of executions that run the hinted variant
+	QueryHints       map[string]string
+	
+	// Index creation impact benchmark
+	IndexDDL         string        // CREATE INDEX to build mid-run (empty = disabled)
+	IndexAfter       time.Duration // Baseline load before the build starts
+	IndexKeep        bool          // Keep the index after the run
+	
+	// Transactional outbox simulator
+	OutboxWriters    int           // Writer sessions (0 = disabled)
+	OutboxRelays     int           // Relay sessions polling the outbox
+	OutboxBatch      int           // Events claimed per poll
+	OutboxRelayInterval time.Duration // Pause after a poll that wasn't full
+	OutboxPayload    int           // Padding bytes per event payload
+	
+	// Prepared-statement cache benchmark
+	StmtCacheModes   []string      // pgx exec modes to compare, one phase each (empty = disabled)
+	
+	// Chaos: random backend termination
+	ChaosInterval    time.Duration // Time between terminations (0 = disabled)
+	ChaosTerminatePct float64      // Share of sessions terminated per round (0 = one session)
+	ChaosRetries     int           // Retries of a query that lost its connection
+	ChaosRetryBackoff time.Duration // First retry delay, doubled per retry
+	
+	// Chaos: network faults through the built-in TCP proxy
+	ProxyEnabled     bool          // Route simulator connections through the proxy
+	ProxyListen      string        // Proxy listen address
+	ProxyFaults      []string      // AT[+FOR]:KIND[=VALUE] schedule (see netproxy.go)
+	
+	// Chaos: Toxiproxy scenario
+	ToxiproxyAPI     string        // Toxiproxy API address (empty = disabled)
+	ToxiproxyProxy   string        // Proxy name
+	ToxiproxyListen  string        // Proxy listen address on the Toxiproxy host
+	ToxiproxyUpstream string       // Defaults to the DSN's host:port
+	Toxics           []ToxicSpec   // Toxics and when they are active
+	
+	// Temp-file pressure scenario
+	TempSessions     int           // Spilling sessions (0 = disabled)
+	TempSpillSize    string        // Target temp volume per query, e.g. 256MB
+	TempWorkMem      string        // work_mem of the spilling sessions
+	TempFileLimit    string        // temp_file_limit to SET (empty = server setting)
+	TempAfter        time.Duration // Baseline load before the spilling starts
+	
+	// work_mem sweep
+	WorkMemValues    []string      // work_mem values to rerun the analytics queries under
+	WorkMemRepeats   int           // Rounds over all values
+	
+	// Planner cost sweep
+	CostRandomPageCosts []string   // random_page_cost values (empty = server setting)
+	CostCacheSizes   []string      // effective_cache_size values (empty = server setting)
+	CostRepeats      int           // Rounds over the grid
+	
+	// Stale-statistics drift experiment
+	DriftWriters     int           // Sessions inserting skewed rows (0 = disabled)
+	DriftBatch       int           // Rows per insert
+	DriftAfter       time.Duration // Baseline load before the writers start
+	DriftAnalyzeAfter time.Duration // Drift before the writers stop and the table is ANALYZEd
+	DriftSampleInterval time.Duration // Table stats, estimate error and latency buckets
+	DriftKeep        bool          // Keep the inserted rows after the run
+	
+	// SLOs and output (usually set from -config)
+	SLOs             map[string]SLO
+	ReportJSON       string
+	MetricsAddr      string // Serve Prometheus metrics here (see metrics_server.go)
+	RunID            string // Generated per run; ties plan history rows to a report
 }
 
 var config = Config{
@@ -69,8 +150,31 @@ var config = Config{
 	ReportInterval:    10 * time.Second,
 	TotalRows:         5_000_000,
 	TopCustomerPct:    0.20, // Top 20% of customers
+	OLTPPercent:       70,
 	PlanCheckEnabled:  true,
 	PlanCheckInterval: 30 * time.Second,
+	AnalyzeCooldown:   5 * time.Minute,
+	PlanHistoryTable:  "dbre_plan_history",
+	HintRatio:         0.5,
+	IndexAfter:        time.Minute,
+	OutboxRelays:      1,
+	OutboxBatch:       500,
+	OutboxRelayInterval: 100 * time.Millisecond,
+	OutboxPayload:     512,
+	ChaosRetries:      2,
+	ChaosRetryBackoff: 50 * time.Millisecond,
+	ProxyListen:       "127.0.0.1:0",
+	ToxiproxyProxy:    "dbre_stress",
+	ToxiproxyListen:   "127.0.0.1:26432",
+	TempSpillSize:     "256MB",
+	TempWorkMem:       "4MB",
+	TempAfter:         time.Minute,
+	WorkMemRepeats:    3,
+	CostRepeats:       3,
+	DriftBatch:        1000,
+	DriftAfter:        time.Minute,
+	DriftAnalyzeAfter: 2 * time.Minute,
+	DriftSampleInterval: 15 * time.Second,
 }
 
 // ============================================================================
@@ -170,6 +274,7 @@ var idGen *IDGenerator
 
 type QueryPlan struct {
 	QueryName    string
+	Fingerprint  string // sqlfingerprint of the query, shared with the ops tools
 	PlanHash     string
 	PlanText     string
 	FirstSeen    time.Time
@@ -179,17 +284,21 @@ type QueryPlan struct {
 }
 
 type PlanMonitor struct {
-	plans map[string]*QueryPlan // Key: queryName + planHash
-	mu    sync.RWMutex
+	plans   map[string]*QueryPlan // Key: queryName + planHash
+	current map[string]string     // Key: queryName, value: last observed planHash
+	mu      sync.RWMutex
 }
 
 func NewPlanMonitor() *PlanMonitor {
 	return &PlanMonitor{
-		plans: make(map[string]*QueryPlan),
+		plans:   make(map[string]*QueryPlan),
+		current: make(map[string]string),
 	}
 }
 
-func (pm *PlanMonitor) RecordPlan(queryName, planText string, cost float64) {
+// RecordPlan stores an observed plan of querySQL. It returns the previously
+// observed plan hash and whether this observation is a switch away from it.
+func (pm *PlanMonitor) RecordPlan(queryName, querySQL, planText string, cost float64) (prevHash string, changed bool) {
 	// Create hash of plan structure (ignore costs/actual rows)
 	planHash := hashPlanStructure(planText)
 	key := fmt.Sprintf("%s:%s", queryName, planHash)
@@ -197,6 +306,10 @@ func (pm *PlanMonitor) RecordPlan(queryName, planText string, cost float64) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 	
+	prevHash = pm.current[queryName]
+	changed = prevHash != "" && prevHash != planHash
+	pm.current[queryName] = planHash
+	
 	if plan, exists := pm.plans[key]; exists {
 		plan.LastSeen = time.Now()
 		plan.ExecutionCount++
@@ -204,6 +317,7 @@ func (pm *PlanMonitor) RecordPlan(queryName, planText string, cost float64) {
 	} else {
 		pm.plans[key] = &QueryPlan{
 			QueryName:      queryName,
+			Fingerprint:    sqlfingerprint.Fingerprint(querySQL),
 			PlanHash:       planHash,
 			PlanText:       planText,
 			FirstSeen:      time.Now(),
@@ -212,6 +326,8 @@ func (pm *PlanMonitor) RecordPlan(queryName, planText string, cost float64) {
 			AvgCost:        cost,
 		}
 	}
+	
+	return prevHash, changed
 }
 
 func (pm *PlanMonitor) DetectChanges() []string {
@@ -228,8 +344,8 @@ func (pm *PlanMonitor) DetectChanges() []string {
 	for queryName, plans := range queryPlans {
 		if len(plans) > 1 {
 			// Multiple plans detected for same query!
-			alert := fmt.Sprintf("⚠️  PLAN CHANGE DETECTED: %s has %d different plans", 
-				queryName, len(plans))
+			alert := fmt.Sprintf("⚠️  PLAN CHANGE DETECTED: %s (fingerprint %s) has %d different plans", 
+				queryName, plans[0].Fingerprint, len(plans))
 			alerts = append(alerts, alert)
 			
 			// Sort by first seen
@@ -261,25 +377,10 @@ func (pm *PlanMonitor) GetSummary() map[string]int {
 	return summary
 }
 
+// hashPlanStructure hashes the plan's node structure, ignoring costs and
+// row estimates. explainlog hashes auto_explain plans the same way.
 func hashPlanStructure(planText string) string {
-	// Extract just the node types and join types, ignore costs/rows
-	// This is simplified - in production you'd parse the JSON plan
-	lines := strings.Split(planText, "\n")
-	var structure []string
-	
-	for _, line := range lines {
-		// Extract node types (Index Scan, Seq Scan, etc.)
-		if strings.Contains(line, "Scan") || strings.Contains(line, "Join") || 
-		   strings.Contains(line, "Aggregate") || strings.Contains(line, "Sort") {
-			// Remove costs and row estimates
-			cleaned := strings.Split(line, "(cost=")[0]
-			structure = append(structure, strings.TrimSpace(cleaned))
-		}
-	}
-	
-	combined := strings.Join(structure, "|")
-	hash := md5.Sum([]byte(combined))
-	return hex.EncodeToString(hash[:])
+	return planhash.Hash(planText)
 }
 
 // Global plan monitor
@@ -296,6 +397,8 @@ type Query struct {
 	Weight      int
 	Description string
 	ExplainSQL  string // For plan capture
+	Params      func() []interface{} // Parameter generator (profiles); nil = by name
+	Hint        string // pg_hint_plan hint for -hints A/B runs (without /*+ */)
 }
 
 var queries = []Query{
@@ -517,6 +620,44 @@ type PoolSnapshot struct {
 	TotalConns           int32
 }
 
+type LatencySummary struct {
+	Count  int64
+	Errors int64
+	Avg    time.Duration
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+}
+
+func (s LatencySummary) ErrorPct() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Count) * 100
+}
+
+func (qm *QueryMetrics) Summary() LatencySummary {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	
+	s := LatencySummary{Count: qm.ExecutionCount, Errors: qm.ErrorCount}
+	if qm.ExecutionCount == 0 || len(qm.Latencies) == 0 {
+		return s
+	}
+	
+	latencies := make([]time.Duration, len(qm.Latencies))
+	copy(latencies, qm.Latencies)
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	
+	s.Avg = qm.TotalDuration / time.Duration(qm.ExecutionCount)
+	s.P50 = latencies[len(latencies)*50/100]
+	s.P95 = latencies[len(latencies)*95/100]
+	s.P99 = latencies[len(latencies)*99/100]
+	return s
+}
+
 func NewMetrics() *Metrics {
 	m := &Metrics{
 		queryMetrics: make(map[string]*QueryMetrics),
@@ -530,6 +671,12 @@ func NewMetrics() *Metrics {
 			Name:      q.Name,
 			Latencies: make([]time.Duration, 0, 10000),
 		}
+		if config.HintsEnabled && q.Hint != "" {
+			m.queryMetrics[hintedName(q.Name)] = &QueryMetrics{
+				Name:      hintedName(q.Name),
+				Latencies: make([]time.Duration, 0, 10000),
+			}
+		}
 	}
 	
 	return m
@@ -537,6 +684,30 @@ func NewMetrics() *Metrics {
 
 func (m *Metrics) RecordQuery(queryName string, duration time.Duration, err error) {
 	atomic.AddInt64(&m.totalQueries, 1)
+	if indexImpact != nil {
+		indexImpact.Record(queryName, duration, err)
+	}
+	if stmtCache != nil {
+		stmtCache.Record(queryName, duration, err)
+	}
+	if chaos != nil {
+		chaos.Record(err)
+	}
+	if netProxy != nil {
+		netProxy.Record(duration, err)
+	}
+	if toxiScenario != nil {
+		toxiScenario.Record(duration, err)
+	}
+	if tempPressure != nil {
+		tempPressure.Record(queryName, duration, err)
+	}
+	if staleStats != nil {
+		staleStats.Record(queryName, duration, err)
+	}
+	if promMetrics != nil {
+		promMetrics.Observe(queryName, duration, err)
+	}
 	
 	m.mu.Lock()
 	qm := m.queryMetrics[queryName]
@@ -603,6 +774,15 @@ func (m *Metrics) RecordPoolStats(pool *pgxpool.Pool) {
 	m.mu.Unlock()
 }
 
+// lastPoolStats is the latest pool snapshot, nil before the first one.
+// The caller holds m.mu.
+func (m *Metrics) lastPoolStats() *PoolSnapshot {
+	if len(m.poolStats) == 0 {
+		return nil
+	}
+	return &m.poolStats[len(m.poolStats)-1]
+}
+
 func (m *Metrics) PrintReport() {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -640,29 +820,27 @@ func (m *Metrics) PrintReport() {
 	})
 	
 	for _, qs := range sortedQueries {
-		qm := m.queryMetrics[qs.name]
-		qm.mu.Lock()
-		
-		if qm.ExecutionCount == 0 {
-			qm.mu.Unlock()
+		s := m.queryMetrics[qs.name].Summary()
+		if s.Count == 0 {
 			continue
 		}
 		
-		latencies := make([]time.Duration, len(qm.Latencies))
-		copy(latencies, qm.Latencies)
-		sort.Slice(latencies, func(i, j int) bool {
-			return latencies[i] < latencies[j]
-		})
-		
-		avg := qm.TotalDuration.Milliseconds() / int64(qm.ExecutionCount)
-		p50 := latencies[len(latencies)*50/100].Milliseconds()
-		p95 := latencies[len(latencies)*95/100].Milliseconds()
-		p99 := latencies[len(latencies)*99/100].Milliseconds()
-		
 		fmt.Printf("%-30s %10d %10d %10d %10d %10d %10d\n",
-			qm.Name, qm.ExecutionCount, qm.ErrorCount, avg, p50, p95, p99)
-		
-		qm.mu.Unlock()
+			qs.name, s.Count, s.Errors, s.Avg.Milliseconds(),
+			s.P50.Milliseconds(), s.P95.Milliseconds(), s.P99.Milliseconds())
+	}
+	
+	// SLO compliance
+	if sloResults := m.EvaluateSLOs(); len(sloResults) > 0 {
+		fmt.Printf("\n🎯 SLO Compliance:\n")
+		for _, r := range sloResults {
+			status := "✅"
+			if !r.Passed {
+				status = "❌"
+			}
+			fmt.Printf("   %s %-28s %-10s target=%-10s observed=%s\n",
+				status, r.Query, r.Check, r.Target, r.Observed)
+		}
 	}
 	
 	// Query Plan Summary
@@ -699,6 +877,69 @@ func (m *Metrics) PrintReport() {
 		}
 	}
 	
+	if churnWorkerCount() > 0 {
+		churnStats.PrintReport(duration)
+	}
+	
+	spillTracker.PrintReport()
+	parallelTracker.PrintReport()
+	
+	if config.HintsEnabled {
+		m.PrintHintComparison()
+	}
+	
+	if config.AnalyzeOnPlanChange {
+		remediationLog.PrintReport()
+	}
+	
+	if indexImpact != nil {
+		indexImpact.PrintReport()
+	}
+	
+	if outboxSim != nil {
+		outboxSim.PrintReport()
+	}
+	
+	if stmtCache != nil {
+		stmtCache.PrintReport()
+	}
+	
+	if chaos != nil {
+		chaos.PrintReport()
+	}
+	
+	if netProxy != nil {
+		netProxy.PrintReport()
+	}
+	
+	if toxiScenario != nil {
+		toxiScenario.PrintReport()
+	}
+	
+	if tempPressure != nil {
+		tempPressure.PrintReport()
+	}
+	
+	if workMemSweep != nil {
+		workMemSweep.PrintReport()
+	}
+	
+	if costSweep != nil {
+		costSweep.PrintReport()
+	}
+	
+	if staleStats != nil {
+		staleStats.PrintReport()
+	}
+	
+	tuningAdvisor.PrintReport(m.lastPoolStats())
+	
+	// Resolved configuration (for auditability)
+	fmt.Printf("\n🧾 Resolved Configuration:\n")
+	for _, line := range strings.Split(strings.TrimRight(resolvedConfigYAML(), "\n"), "\n") {
+		fmt.Printf("   %s\n", line)
+	}
+	
 	fmt.Println(strings.Repeat("=", 110))
 }
 
@@ -706,7 +947,20 @@ func (m *Metrics) PrintReport() {
 // CONNECTION POOL SETUP
 // ============================================================================
 
-func initConnectionPool(ctx context.Context, connString string, maxConns int) (*pgxpool.Pool, error) {
+// sessionRuntimeParams are applied to every simulator session, pooled or not.
+func sessionRuntimeParams() map[string]string {
+	return map[string]string{
+		"application_name":     "read_workload_simulator",
+		"statement_timeout":    "120000", // 2 minutes for analytics
+		"idle_in_transaction_session_timeout": "60000",
+		"work_mem":             "256MB",  // Increase for GROUP BY/sorts
+		"max_parallel_workers_per_gather": "4", // Enable parallel query
+	}
+}
+
+// newPoolConfig is the simulator's pool configuration; the statement cache
+// benchmark starts from it too.
+func newPoolConfig(connString string, maxConns int) (*pgxpool.Config, error) {
 	poolConfig, err := pgxpool.ParseConfig(connString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
@@ -718,12 +972,21 @@ func initConnectionPool(ctx context.Context, connString string, maxConns int) (*
 	poolConfig.MaxConnIdleTime = 5 * time.Minute
 	poolConfig.HealthCheckPeriod = 1 * time.Minute
 	
-	poolConfig.ConnConfig.RuntimeParams = map[string]string{
-		"application_name":     "read_workload_simulator",
-		"statement_timeout":    "120000", // 2 minutes for analytics
-		"idle_in_transaction_session_timeout": "60000",
-		"work_mem":             "256MB",  // Increase for GROUP BY/sorts
-		"max_parallel_workers_per_gather": "4", // Enable parallel query
+	poolConfig.ConnConfig.RuntimeParams = sessionRuntimeParams()
+	poolConfig.AfterConnect = loadHintPlan
+	if netProxy != nil {
+		netProxy.route(&poolConfig.ConnConfig.Config)
+	}
+	if toxiScenario != nil {
+		toxiScenario.route(&poolConfig.ConnConfig.Config)
+	}
+	return poolConfig, nil
+}
+	
+func initConnectionPool(ctx context.Context, connString string, maxConns int) (*pgxpool.Pool, error) {
+	poolConfig, err := newPoolConfig(connString, maxConns)
+	if err != nil {
+		return nil, err
 	}
 	
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
@@ -759,7 +1022,7 @@ func selectQuery(workloadType string) Query {
 			}
 		}
 	case "mixed":
-		if rand.Intn(100) < 70 {
+		if rand.Intn(100) < config.OLTPPercent {
 			for _, q := range queries {
 				if q.Type == "oltp" {
 					candidateQueries = append(candidateQueries, q)
@@ -792,6 +1055,10 @@ func selectQuery(workloadType string) Query {
 }
 
 func generateQueryParams(query Query) []interface{} {
+	if query.Params != nil {
+		return query.Params()
+	}
+	
 	switch query.Name {
 	case "pk_lookup":
 		return []interface{}{idGen.GetTransactionID()}
@@ -804,31 +1071,49 @@ func generateQueryParams(query Query) []interface{} {
 	}
 }
 
-func executeQuery(ctx context.Context, pool *pgxpool.Pool, query Query, metrics *Metrics) {
+// querier is satisfied by both *pgxpool.Pool and a dedicated *pgx.Conn.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+func executeQuery(ctx context.Context, db querier, query Query, metrics *Metrics) {
 	params := generateQueryParams(query)
+	sql, metricName := pickVariant(query)
+	
+	duration, err := runQuery(ctx, db, sql, params)
+	if err != nil && chaos != nil {
+		// A write whose connection died after COMMIT has already been
+		// applied: retrying it would apply it twice.
+		if isReadOnlyQuery(query) {
+			duration, err = chaos.retry(ctx, duration, err, func() (time.Duration, error) {
+				return runQuery(ctx, db, sql, params)
+			})
+		} else {
+			chaos.surface(err)
+		}
+	}
 	
+	if err != nil {
+		log.Printf("Query %s failed: %v", metricName, err)
+	}
+	metrics.RecordQuery(metricName, duration, err)
+}
+
+// runQuery runs one attempt and drains its rows. The duration covers the
+// round trip until the first result, errors from the rows included.
+func runQuery(ctx context.Context, db querier, sql string, params []interface{}) (time.Duration, error) {
 	start := time.Now()
-	rows, err := pool.Query(ctx, query.SQL, params...)
+	rows, err := db.Query(ctx, sql, params...)
 	duration := time.Since(start)
 	
 	if err != nil {
-		metrics.RecordQuery(query.Name, duration, err)
-		log.Printf("Query %s failed: %v", query.Name, err)
-		return
+		return duration, err
 	}
 	defer rows.Close()
 	
-	rowCount := 0
 	for rows.Next() {
-		rowCount++
-	}
-	
-	if err := rows.Err(); err != nil {
-		metrics.RecordQuery(query.Name, duration, err)
-		return
 	}
-	
-	metrics.RecordQuery(query.Name, duration, nil)
+	return duration, rows.Err()
 }
 
 func runWorker(ctx context.Context, workerID int, pool *pgxpool.Pool, metrics *Metrics, wg *sync.WaitGroup) {
@@ -840,7 +1125,11 @@ func runWorker(ctx context.Context, workerID int, pool *pgxpool.Pool, metrics *M
 			return
 		default:
 			query := selectQuery(config.WorkloadType)
-			executeQuery(ctx, pool, query, metrics)
+			if stmtCache != nil {
+				executeQuery(ctx, stmtCache.pool(), query, metrics)
+			} else {
+				executeQuery(ctx, pool, query, metrics)
+			}
 			
 			// Think time: 0-10ms
 			time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
@@ -867,36 +1156,27 @@ func monitorQueryPlans(ctx context.Context, pool *pgxpool.Pool) {
 				}
 				
 				params := generateQueryParams(query)
-				rows, err := pool.Query(ctx, query.ExplainSQL, params...)
-				if err != nil {
-					continue
-				}
-				
-				var planLines []string
-				for rows.Next() {
-					var line string
-					if err := rows.Scan(&line); err == nil {
-						planLines = append(planLines, line)
+				if planText, cost, ok := capturePlan(ctx, pool, query.ExplainSQL, params); ok {
+					prevHash, changed := planMonitor.RecordPlan(query.Name, query.SQL, planText, cost)
+					if changed && staleStats != nil {
+						staleStats.planChanged(query.Name, prevHash, planText)
+					}
+					if changed && config.AnalyzeOnPlanChange {
+						runAnalyzeExperiment(ctx, pool, query, params, prevHash, hashPlanStructure(planText))
 					}
 				}
-				rows.Close()
 				
-				if len(planLines) > 0 {
-					planText := strings.Join(planLines, "\n")
-					
-					// Extract cost estimate
-					var cost float64
-					for _, line := range planLines {
-						if strings.Contains(line, "cost=") {
-							fmt.Sscanf(line, "%*s (cost=%f", &cost)
-							break
-						}
-					}
-					
-					planMonitor.RecordPlan(query.Name, planText, cost)
+				// Capture the pinned plan too, so the report shows whether
+				// the hint was honoured.
+				if config.HintsEnabled && query.Hint != "" {
+					captureHintedPlan(ctx, pool, query)
 				}
 			}
 			
+			if config.ExplainAnalyze {
+				sampleExecutionStats(ctx, pool)
+			}
+			
 			// Check for plan changes
 			alerts := planMonitor.DetectChanges()
 			if len(alerts) > 0 {
@@ -906,8 +1186,46 @@ func monitorQueryPlans(ctx context.Context, pool *pgxpool.Pool) {
 				}
 				fmt.Println(strings.Repeat("!", 80) + "\n")
 			}
+			
+			if config.PlanHistory {
+				if err := persistPlanHistory(ctx, pool); err != nil {
+					log.Printf("⚠️  %v", err)
+				}
+			}
+		}
+	}
+}
+
+// capturePlan runs an EXPLAIN statement and returns the plan text and the
+// top-level cost estimate.
+func capturePlan(ctx context.Context, db querier, explainSQL string, params []interface{}) (string, float64, bool) {
+	rows, err := db.Query(ctx, explainSQL, params...)
+	if err != nil {
+		return "", 0, false
+	}
+	defer rows.Close()
+	
+	var planLines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err == nil {
+			planLines = append(planLines, line)
+		}
+	}
+	if len(planLines) == 0 {
+		return "", 0, false
+	}
+	
+	// Extract cost estimate
+	var cost float64
+	for _, line := range planLines {
+		if strings.Contains(line, "cost=") {
+			fmt.Sscanf(line, "%*s (cost=%f", &cost)
+			break
 		}
 	}
+	
+	return strings.Join(planLines, "\n"), cost, true
 }
 
 // ============================================================================
@@ -934,6 +1252,9 @@ func monitorProgress(ctx context.Context, pool *pgxpool.Pool, metrics *Metrics)
 			
 			metrics.RecordPoolStats(pool)
 			metrics.UpdateCacheStats(ctx, pool)
+			if churnWorkerCount() > 0 {
+				churnStats.sampleBackends(ctx, pool)
+			}
 			
 			stat := pool.Stat()
 			cacheHit := metrics.GetCacheHitRatio()
@@ -980,28 +1301,200 @@ func runBurstTest(ctx context.Context, pool *pgxpool.Pool, metrics *Metrics) {
 // ============================================================================
 
 func main() {
-	duration := flag.Duration("duration", 5*time.Minute, "Test duration")
-	sessions := flag.Int("sessions", 25, "Number of concurrent sessions")
-	burst := flag.Int("burst", 0, "Burst sessions (0 = disabled)")
-	workload := flag.String("workload", "mixed", "Workload: oltp, analytics, mixed")
+	// Flags are applied through applyFlagOverrides so only the ones set
+	// explicitly override the config file.
+	flag.Duration("duration", 5*time.Minute, "Test duration")
+	flag.Int("sessions", 25, "Number of concurrent sessions")
+	flag.Int("burst", 0, "Burst sessions (0 = disabled)")
+	flag.Float64("churn", 0, "Fraction of sessions that open a new connection per query (0-1, models serverless clients)")
+	flag.String("workload", "mixed", "Workload: oltp, analytics, mixed")
+	configFile := flag.String("config", "", "YAML run config file (flags override file values)")
+	flag.String("dsn", config.DBConnString, "PostgreSQL connection string")
+	flag.String("report-json", "", "Write a JSON report (with resolved config) to this path")
+	flag.String("metrics-addr", "", "Serve Prometheus metrics (per-query latency, pool) on this address, e.g. :9109")
+	flag.String("profile", "", "Built-in workload profile: pgbench, pgbench-select, pgbench-simple, ycsb-a..ycsb-f (list = show all)")
+	flag.Int64("rows", config.TotalRows, "Rows in the target table (record count for profiles)")
+	flag.Bool("hints", false, "A/B pg_hint_plan hints against the optimizer's choice within the run")
+	flag.Float64("hint-ratio", config.HintRatio, "Share of executions of hinted queries that use the hint")
+	flag.Bool("explain-analyze", false, "Sample EXPLAIN ANALYZE of read queries each plan check (spill detection)")
+	flag.Bool("plan-history", false, "Persist every observed plan to the plan history table (dbre_plan_history)")
+	flag.Bool("analyze-on-plan-change", false, "Run ANALYZE on the table when a plan changes and record whether the plan reverts")
+	flag.String("index", "", "CREATE INDEX statement to build CONCURRENTLY mid-run, measuring build impact and before/after latency")
+	flag.Duration("index-after", config.IndexAfter, "Baseline load before the -index build starts")
+	flag.Bool("index-keep", false, "Keep the -index index after the run instead of dropping it")
+	flag.Int("outbox-writers", 0, "Sessions writing an order plus an outbox event per transaction (0 = disabled)")
+	flag.Int("outbox-relays", config.OutboxRelays, "Relay sessions polling and deleting outbox events")
+	flag.Int("outbox-batch", config.OutboxBatch, "Outbox events claimed per relay poll")
+	flag.Duration("outbox-poll", config.OutboxRelayInterval, "Relay pause after a poll that did not fill a batch")
+	flag.String("stmt-cache", "", "Compare pgx statement modes in equal phases, e.g. exec,cache_describe,cache_statement,cache_statement:8")
+	flag.Duration("chaos-interval", 0, "Terminate random simulator sessions this often (0 = disabled)")
+	flag.Float64("chaos-pct", 0, "Share of simulator sessions terminated per chaos round (0 = one session)")
+	flag.Int("chaos-retries", config.ChaosRetries, "Retries of a query whose connection was terminated")
+	flag.Duration("chaos-backoff", config.ChaosRetryBackoff, "First retry delay after a lost connection, doubled per retry")
+	flag.Bool("proxy", false, "Route simulator connections through the built-in TCP proxy")
+	flag.String("proxy-listen", config.ProxyListen, "Listen address of the built-in TCP proxy")
+	flag.String("toxiproxy", "", "Toxiproxy API address; routes the simulator through a Toxiproxy proxy (toxics come from -config)")
+	flag.String("toxiproxy-listen", config.ToxiproxyListen, "Listen address of the Toxiproxy proxy, on the Toxiproxy host")
+	flag.Int("temp-sessions", 0, "Extra sessions running sort/hash queries sized to spill (0 = disabled)")
+	flag.String("temp-spill", config.TempSpillSize, "Target temp file volume per spilling query")
+	flag.String("temp-work-mem", config.TempWorkMem, "work_mem of the spilling sessions")
+	flag.String("temp-file-limit", "", "temp_file_limit for the spilling sessions (superuser; empty = server setting)")
+	flag.Duration("temp-after", config.TempAfter, "Baseline load before the spilling sessions start")
+	flag.String("work-mem-sweep", "", "Rerun the analytics queries under each work_mem value, e.g. 1MB,4MB,16MB,64MB,256MB")
+	flag.Int("work-mem-repeats", config.WorkMemRepeats, "Rounds over all -work-mem-sweep values")
+	flag.String("cost-rpc", "", "Sweep random_page_cost over these values, e.g. 1.1,1.5,2,4 (with -cost-ecs: the grid of both)")
+	flag.String("cost-ecs", "", "Sweep effective_cache_size over these values, e.g. 4GB,16GB,48GB")
+	flag.Int("cost-repeats", config.CostRepeats, "Rounds over the -cost-rpc/-cost-ecs grid")
+	flag.Int("drift-writers", 0, "Stale-stats experiment: sessions inserting skewed rows with autovacuum off (0 = disabled)")
+	flag.Int("drift-batch", config.DriftBatch, "Rows per drift insert")
+	flag.Duration("drift-after", config.DriftAfter, "Baseline load before the drift writers start")
+	flag.Duration("drift-analyze-after", config.DriftAnalyzeAfter, "Drift before the writers stop and the table is ANALYZEd")
+	flag.Bool("drift-keep", false, "Keep the drift rows after the run instead of deleting them")
+	flag.String("proxy-faults", "", "Network faults on the proxy, e.g. 1m+30s:latency=50ms~10ms,2m+20s:bandwidth=256KB,3m:reset,4m+15s:blackhole")
+	profileSetup := flag.Bool("profile-setup", false, "Create and populate the profile's tables before running")
 	
 	flag.Parse()
 	
-	config.Duration = *duration
-	config.SessionCount = *sessions
-	config.BurstSessions = *burst
-	config.WorkloadType = *workload
+	if *configFile != "" {
+		if err := loadRunConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	applyFlagOverrides()
+	
+	if config.Profile == "list" {
+		printProfiles()
+		return
+	}
+	var profile WorkloadProfile
+	if config.Profile != "" {
+		var err error
+		if profile, err = applyProfile(config.Profile); err != nil {
+			log.Fatal(err)
+		}
+	} else if *profileSetup {
+		log.Fatal("-profile-setup requires -profile")
+	}
+	if err := applyQueryWeights(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if err := applyQueryHints(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	
+	if err := validateConfig(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	if config.IndexDDL != "" {
+		var err error
+		if indexImpact, err = newIndexImpact(config.IndexDDL); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+	}
+	if len(config.StmtCacheModes) > 0 {
+		var err error
+		if stmtCache, err = newStmtCacheBench(config.StmtCacheModes); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+	}
+	if config.ChaosInterval > 0 {
+		chaos = newChaosInjector()
+	}
+	if config.ProxyEnabled || len(config.ProxyFaults) > 0 {
+		var err error
+		if netProxy, err = newNetProxy(config.ProxyFaults); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+	}
+	if config.ToxiproxyAPI != "" {
+		toxiScenario = newToxiproxyScenario()
+	}
+	if config.TempSessions > 0 {
+		var err error
+		if tempPressure, err = newTempPressure(); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+	}
+	if len(config.WorkMemValues) > 0 {
+		var err error
+		if workMemSweep, err = newWorkMemSweep(config.WorkMemValues); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+	}
+	if len(config.CostRandomPageCosts) > 0 || len(config.CostCacheSizes) > 0 {
+		var err error
+		if costSweep, err = newCostSweep(config.CostRandomPageCosts, config.CostCacheSizes); err != nil {
+			log.Fatal("Invalid configuration: ", err)
+		}
+	}
+	if config.DriftWriters > 0 {
+		staleStats = newStaleStats()
+	}
+	
+	config.RunID = uuid.NewString()
 	
 	fmt.Println("🚀 PostgreSQL Read Workload Simulator v2")
 	fmt.Println(strings.Repeat("=", 110))
 	fmt.Printf("Configuration:\n")
+	fmt.Printf("   Run ID:         %s\n", config.RunID)
 	fmt.Printf("   Sessions:       %d\n", config.SessionCount)
 	fmt.Printf("   Duration:       %v\n", config.Duration)
-	fmt.Printf("   Workload Type:  %s (70%% OLTP, 30%% Analytics)\n", config.WorkloadType)
+	fmt.Printf("   Workload Type:  %s (%d%% OLTP, %d%% Analytics)\n", config.WorkloadType, config.OLTPPercent, 100-config.OLTPPercent)
+	if n := churnWorkerCount(); n > 0 {
+		fmt.Printf("   Churn Mode:     %d of %d sessions connect per query\n", n, config.SessionCount)
+	}
 	fmt.Printf("   Burst Mode:     %s\n", map[bool]string{true: fmt.Sprintf("Enabled (%d sessions)", config.BurstSessions), false: "Disabled"}[config.BurstSessions > 0])
 	fmt.Printf("   Table:          %s (%d rows)\n", config.TableName, config.TotalRows)
-	fmt.Printf("   Distribution:   Zipfian (80/20 rule for hot customers)\n")
-	fmt.Printf("   Plan Tracking:  Enabled (check every %v)\n", config.PlanCheckInterval)
+	if config.Profile != "" {
+		fmt.Printf("   Profile:        %s (%s)\n", config.Profile, profileRegistry[config.Profile].description)
+	} else {
+		fmt.Printf("   Distribution:   Zipfian (80/20 rule for hot customers)\n")
+	}
+	fmt.Printf("   Plan Tracking:  %s\n", map[bool]string{true: fmt.Sprintf("Enabled (check every %v)", config.PlanCheckInterval), false: "Disabled"}[config.PlanCheckEnabled])
+	if config.PlanHistory {
+		fmt.Printf("   Plan History:   %s\n", config.PlanHistoryTable)
+	}
+	if config.IndexDDL != "" {
+		fmt.Printf("   Index Build:    %s after %v\n", indexImpact.name, config.IndexAfter)
+	}
+	if stmtCache != nil {
+		fmt.Printf("   Stmt Cache:     %s (%v each)\n", strings.Join(config.StmtCacheModes, ", "),
+			config.Duration/time.Duration(len(config.StmtCacheModes)))
+	}
+	if config.OutboxWriters > 0 {
+		fmt.Printf("   Outbox:         %d writers, %d relays (batch %d, poll %v)\n",
+			config.OutboxWriters, config.OutboxRelays, config.OutboxBatch, config.OutboxRelayInterval)
+	}
+	if chaos != nil {
+		fmt.Printf("   Chaos:          terminate %s every %v, %d retries from %v\n",
+			map[bool]string{true: fmt.Sprintf("%.0f%% of sessions", config.ChaosTerminatePct*100), false: "1 session"}[config.ChaosTerminatePct > 0],
+			config.ChaosInterval, config.ChaosRetries, config.ChaosRetryBackoff)
+	}
+	if netProxy != nil {
+		fmt.Printf("   Net Proxy:      %d fault(s) scheduled\n", len(config.ProxyFaults))
+	}
+	if toxiScenario != nil {
+		fmt.Printf("   Toxiproxy:      %s at %s, %d toxic(s)\n", config.ToxiproxyProxy, config.ToxiproxyAPI, len(config.Toxics))
+	}
+	if tempPressure != nil {
+		fmt.Printf("   Temp Pressure:  %d sessions after %v, ~%s per query (work_mem %s)\n",
+			config.TempSessions, config.TempAfter, config.TempSpillSize, config.TempWorkMem)
+	}
+	if workMemSweep != nil {
+		fmt.Printf("   work_mem Sweep: %s, %d rounds over %d analytics queries\n",
+			strings.Join(workMemSweep.values, ", "), config.WorkMemRepeats, len(workMemSweep.queries))
+	}
+	if costSweep != nil {
+		fmt.Printf("   Cost Sweep:     %d random_page_cost × %d effective_cache_size, %d rounds over %d queries\n",
+			len(config.CostRandomPageCosts), len(config.CostCacheSizes), config.CostRepeats, len(costSweep.queries))
+	}
+	if staleStats != nil {
+		fmt.Printf("   Stale Stats:    autovacuum off, %d writers × %d rows after %v, ANALYZE %v later\n",
+			config.DriftWriters, config.DriftBatch, config.DriftAfter, config.DriftAnalyzeAfter)
+	}
+	if *configFile != "" {
+		fmt.Printf("   Config File:    %s\n", *configFile)
+	}
 	fmt.Println(strings.Repeat("=", 110))
 	
 	ctx := context.Background()
@@ -1012,7 +1505,22 @@ func main() {
 	// Initialize plan monitor
 	planMonitor = NewPlanMonitor()
 	
-	pool, err := initConnectionPool(ctx, config.DBConnString, config.SessionCount+10)
+	if netProxy != nil {
+		if err := netProxy.listen(config.ProxyListen, config.DBConnString); err != nil {
+			log.Fatal(err)
+		}
+		defer netProxy.close()
+		fmt.Printf("🌐 Proxy listening on %s → %s\n", netProxy.ln.Addr(), netProxy.upstream)
+	}
+	if toxiScenario != nil {
+		if err := toxiScenario.setup(config.DBConnString); err != nil {
+			log.Fatal(err)
+		}
+		defer toxiScenario.close()
+		fmt.Printf("☣️  Toxiproxy proxy %s: %s → %s\n", config.ToxiproxyProxy, config.ToxiproxyListen, toxiScenario.upstream)
+	}
+	
+	pool, err := initConnectionPool(ctx, config.DBConnString, config.SessionCount+outboxConnCount()+10)
 	if err != nil {
 		log.Fatal("Failed to initialize connection pool:", err)
 	}
@@ -1020,6 +1528,56 @@ func main() {
 	
 	fmt.Println("✅ Connected to PostgreSQL")
 	
+	if *profileSetup {
+		if err := setupProfile(ctx, pool, profile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	if config.PlanHistory {
+		if err := ensurePlanHistoryTable(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	if config.HintsEnabled {
+		if err := checkHintPlan(ctx, pool); err != nil {
+			log.Fatal("-hints: ", err)
+		}
+		fmt.Printf("📌 pg_hint_plan active: %d hinted queries, %.0f%% of executions pinned\n",
+			hintedQueryCount(), config.HintRatio*100)
+	}
+	
+	if indexImpact != nil {
+		if err := indexImpact.checkIndexAbsent(ctx, pool); err != nil {
+			log.Fatal("-index: ", err)
+		}
+	}
+	
+	if stmtCache != nil {
+		if err := stmtCache.setup(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+		defer stmtCache.close()
+	}
+	
+	if config.OutboxWriters > 0 {
+		outboxSim = newOutboxSimulator()
+		if err := outboxSim.setup(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+	}
+	
+	if staleStats != nil {
+		if err := staleStats.setup(ctx, pool); err != nil {
+			log.Fatal(err)
+		}
+		defer staleStats.finish(ctx, pool)
+	}
+	
+	if config.MetricsAddr != "" {
+		startMetricsServer(pool)
+	}
 	metrics := NewMetrics()
 	
 	workloadCtx, cancel := context.WithTimeout(ctx, config.Duration)
@@ -1027,15 +1585,49 @@ func main() {
 	
 	// Start monitoring goroutines
 	go monitorProgress(workloadCtx, pool, metrics)
-	go monitorQueryPlans(workloadCtx, pool)
+	if config.PlanCheckEnabled {
+		go monitorQueryPlans(workloadCtx, pool)
+	}
+	go monitorParallelWorkers(workloadCtx, pool, 2*time.Second)
+	go tuningAdvisor.monitorBackends(workloadCtx, pool, 5*time.Second)
+	if outboxSim != nil {
+		go outboxSim.monitorOutbox(workloadCtx, pool, 5*time.Second)
+	}
 	
 	// Start worker goroutines
 	var wg sync.WaitGroup
 	fmt.Printf("\n🏃 Starting %d worker sessions...\n\n", config.SessionCount)
 	
+	churnWorkers := churnWorkerCount()
+	if churnWorkers > 0 {
+		churnStats.sampleServerSessions(ctx, pool, true)
+	}
+	spillTracker.SampleDatabaseTemp(ctx, pool, true)
+	tuningAdvisor.SampleStart(ctx, pool)
+	churnConfig, err := churnConnConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	
 	for i := 0; i < config.SessionCount; i++ {
 		wg.Add(1)
-		go runWorker(workloadCtx, i, pool, metrics, &wg)
+		if i < churnWorkers {
+			go runChurnWorker(workloadCtx, i, churnConfig, metrics, &wg)
+		} else {
+			go runWorker(workloadCtx, i, pool, metrics, &wg)
+		}
+	}
+	
+	// Outbox writers and relays run next to the readers
+	for i := 0; i < config.OutboxWriters; i++ {
+		wg.Add(1)
+		go runOutboxWriter(workloadCtx, i, pool, &wg)
+	}
+	if outboxSim != nil {
+		for i := 0; i < config.OutboxRelays; i++ {
+			wg.Add(1)
+			go runOutboxRelay(workloadCtx, i, pool, &wg)
+		}
 	}
 	
 	// Run burst test if enabled
@@ -1044,10 +1636,88 @@ func main() {
 		go runBurstTest(workloadCtx, pool, metrics)
 	}
 	
+	// Switch statement modes phase by phase
+	if stmtCache != nil {
+		wg.Add(1)
+		go runStmtCacheBench(workloadCtx, pool, &wg)
+	}
+	
+	// Build the proposed index mid-run
+	if indexImpact != nil {
+		wg.Add(1)
+		go runIndexBuild(workloadCtx, pool, &wg)
+	}
+	
+	// Terminate simulator sessions on a schedule
+	if chaos != nil {
+		wg.Add(1)
+		go runChaos(workloadCtx, pool, &wg)
+	}
+	if netProxy != nil {
+		wg.Add(1)
+		go runProxySchedule(workloadCtx, &wg)
+	}
+	if toxiScenario != nil {
+		wg.Add(1)
+		go runToxicSchedule(workloadCtx, &wg)
+	}
+	
+	// Start spilling sessions after the baseline window
+	if tempPressure != nil {
+		wg.Add(1)
+		go runTempPressure(workloadCtx, pool, &wg)
+	}
+	
+	// Rerun the analytics queries under each work_mem value
+	if workMemSweep != nil {
+		wg.Add(1)
+		go runWorkMemSweep(workloadCtx, &wg)
+	}
+	
+	// Walk the planner cost grid
+	if costSweep != nil {
+		wg.Add(1)
+		go runCostSweep(workloadCtx, &wg)
+	}
+	
+	// Skew the table with autovacuum off, then ANALYZE
+	if staleStats != nil {
+		wg.Add(1)
+		go runStaleStats(workloadCtx, pool, &wg)
+	}
+	
 	wg.Wait()
 	
+	if indexImpact != nil {
+		indexImpact.finish(ctx, pool)
+	}
+	if outboxSim != nil {
+		outboxSim.sample(ctx, pool)
+	}
+	if tempPressure != nil {
+		tempPressure.finish(ctx, pool)
+	}
+	if churnWorkers > 0 {
+		churnStats.sampleServerSessions(ctx, pool, false)
+	}
+	spillTracker.SampleDatabaseTemp(ctx, pool, false)
+	tuningAdvisor.SampleEnd(ctx, pool)
+	if config.PlanHistory {
+		if err := persistPlanHistory(ctx, pool); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+	
 	metrics.PrintReport()
 	
+	if config.ReportJSON != "" {
+		if err := writeJSONReport(config.ReportJSON, metrics.BuildReport()); err != nil {
+			log.Printf("Failed to write JSON report: %v", err)
+		} else {
+			fmt.Printf("\n📝 JSON report written to %s\n", config.ReportJSON)
+		}
+	}
+	
 	fmt.Println("\n✅ Workload simulation completed!")
 }
 
@@ -1057,16 +1727,98 @@ USAGE EXAMPLES
 ================================================================================
 
 1. Standard 70/30 mixed workload:
-   go run read_workload.go -duration=5m -sessions=25 -workload=mixed
+   go run . -duration=5m -sessions=25 -workload=mixed
 
 2. Test connection exhaustion with burst:
-   go run read_workload.go -duration=2m -sessions=25 -burst=100 -workload=mixed
+   go run . -duration=2m -sessions=25 -burst=100 -workload=mixed
 
 3. Pure OLTP with high concurrency:
-   go run read_workload.go -duration=5m -sessions=50 -workload=oltp
+   go run . -duration=5m -sessions=50 -workload=oltp
 
 4. Analytics workload (lower concurrency):
-   go run read_workload.go -duration=10m -sessions=10 -workload=analytics
+   go run . -duration=10m -sessions=10 -workload=analytics
+
+5. Reproducible run from a config file (SLOs, mix, outputs):
+   go run . -config run.example.yaml -report-json=run-report.json
+
+6. Canonical benchmark profiles (roughly comparable to published numbers):
+   go run . -profile=list
+   go run . -profile=ycsb-b -rows=1000000 -profile-setup -duration=5m
+   go run . -profile=pgbench -rows=5000000 -sessions=32
+
+7. Serverless-style connection churn (25% of sessions connect per query):
+   go run . -duration=5m -sessions=40 -churn=0.25
+
+8. Find queries whose sorts/hashes spill to disk, or whose parallel plans
+   fall back to serial under load:
+   go run . -duration=5m -workload=analytics -explain-analyze
+
+9. A/B a pinned plan (pg_hint_plan) against the optimizer within one run:
+   go run . -duration=10m -hints -hint-ratio=0.5
+
+10. Check whether plan flips are caused by stale statistics (ANALYZE on
+    every plan change, at most once per plan_check.analyze_cooldown):
+   go run . -duration=30m -analyze-on-plan-change
+
+11. Keep plans across runs to track drift over weeks (dbre_plan_history):
+   go run . -duration=10m -plan-history
+
+12. Price a proposed index: build it CONCURRENTLY after 2m of baseline load,
+    compare latency before/during/after and see which queries pick it up:
+   go run . -duration=10m -index-after=2m \
+     -index="CREATE INDEX idx_txn_flagged ON financial_transactions (risk_score DESC) WHERE is_flagged"
+
+13. Every run ends with tuning recommendations (work_mem, max_wal_size,
+    shared_buffers, parallel workers, pool size) backed by the metric that
+    triggered them; -explain-analyze adds the evidence work_mem needs:
+   go run . -duration=20m -workload=analytics -explain-analyze -report-json=run.json
+
+14. Transactional outbox next to the read load: 8 sessions write an order
+    plus an outbox event per transaction, 2 relays poll and delete; shows
+    outbox bloat, poll cost growth and insert-to-relayed latency:
+   go run . -duration=15m -outbox-writers=8 -outbox-relays=2 -outbox-batch=200
+
+15. Prepared statements vs unnamed statements, and a pgx statement cache
+    too small for the workload, 5 minutes each:
+   go run . -duration=20m -stmt-cache=exec,simple_protocol,cache_statement,cache_statement:4
+
+16. Chaos: terminate 10% of the simulator's sessions every 30s and check
+    that retries hide it from callers (errors, retries, recovery time):
+   go run . -duration=10m -chaos-interval=30s -chaos-pct=0.1 -chaos-retries=2
+
+17. Network faults without root on the DB host: the simulator connects
+    through its own TCP proxy; 50ms latency, a 256KB/s link, a reset of
+    every connection and a 15s black-hole, each compared with the baseline:
+   go run . -duration=10m \
+     -proxy-faults="1m+1m:latency=50ms~10ms,3m+1m:bandwidth=256KB,5m:reset,7m+15s:blackhole"
+
+18. The same kind of scenario through a shared Toxiproxy server, declared
+    in the run config (toxiproxy section) so anyone can replay it:
+   go run . -config chaos.yaml -toxiproxy=toxiproxy.internal:8474
+
+19. Temp-file pressure: after 2m of baseline, 4 sessions run sorts and
+    hashes spilling ~512MB each; shows temp volume, OLTP impact and
+    whether a 256MB temp_file_limit cancels them:
+   go run . -duration=10m -temp-after=2m -temp-sessions=4 -temp-spill=512MB -temp-file-limit=256MB
+
+20. work_mem sweep: reruns the analytics queries under each work_mem
+    value on a dedicated session, counts spills and recommends the knee:
+   go run . -duration=15m -sessions=10 -work-mem-sweep=1MB,4MB,16MB,64MB,256MB -work-mem-repeats=5
+
+21. Planner cost sweep: EXPLAINs and runs every read query over a
+    random_page_cost × effective_cache_size grid, reports where plans
+    flip and the fastest setting that keeps them stable:
+   go run . -duration=20m -sessions=10 -cost-rpc=1.1,1.5,2,4 -cost-ecs=4GB,16GB,48GB
+
+22. Stale-statistics drift: autovacuum off, 4 writers pile skewed rows
+    onto the hottest customer for 3m, then ANALYZE; shows when plans and
+    estimates degraded and how fast latency recovered (plan changes are
+    seen every plan_check.interval, 30s; set it shorter with -config):
+   go run . -duration=8m -drift-writers=4 -drift-after=1m -drift-analyze-after=3m
+
+23. Live dashboards: serve per-query latency and pool gauges on /metrics
+    for Prometheus, graphed by postgres/ops cmd/grafana-dashboard:
+   go run . -duration=1h -sessions=25 -metrics-addr=:9109
 
 ================================================================================
 MONITORING TIPS
@@ -0,0 +1,404 @@
+package main
+
+// ============================================================================
+// BUILT-IN CANONICAL WORKLOAD PROFILES (-profile=ycsb-b)
+// ============================================================================
+//
+// Profiles replace the financial_transactions query set with a well-known
+// benchmark shape so results can be roughly compared with published numbers:
+//
+//   pgbench         TPC-B-like transaction (pgbench default script)
+//   pgbench-select  SELECT-only (pgbench -S)
+//   pgbench-simple  simple-update (pgbench -N)
+//   ycsb-a          50% read / 50% update, zipfian
+//   ycsb-b          95% read /  5% update, zipfian
+//   ycsb-c          100% read, zipfian
+//   ycsb-d          95% read latest / 5% insert
+//   ycsb-e          95% short range scan / 5% insert
+//   ycsb-f          50% read / 50% read-modify-write, zipfian
+//
+// The record count is config.TotalRows (-rows). For pgbench it is rounded to
+// a scale factor of 100,000 accounts. Use -profile-setup to create and
+// populate the tables before the run.
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WorkloadProfile struct {
+	Name    string
+	Table   string
+	Setup   []string // DDL + population, run with -profile-setup
+	Queries []Query
+}
+
+type profileEntry struct {
+	description string
+	build       func() WorkloadProfile
+}
+
+var profileRegistry = map[string]profileEntry{
+	"pgbench":        {"pgbench default TPC-B-like transaction", func() WorkloadProfile { return pgbenchProfile("pgbench") }},
+	"pgbench-select": {"pgbench -S (SELECT-only)", func() WorkloadProfile { return pgbenchProfile("pgbench-select") }},
+	"pgbench-simple": {"pgbench -N (simple-update, skips teller/branch updates)", func() WorkloadProfile { return pgbenchProfile("pgbench-simple") }},
+	"ycsb-a":         {"YCSB A: update heavy (50/50 read/update, zipfian)", func() WorkloadProfile { return ycsbProfile("a") }},
+	"ycsb-b":         {"YCSB B: read mostly (95/5 read/update, zipfian)", func() WorkloadProfile { return ycsbProfile("b") }},
+	"ycsb-c":         {"YCSB C: read only (zipfian)", func() WorkloadProfile { return ycsbProfile("c") }},
+	"ycsb-d":         {"YCSB D: read latest (95/5 read/insert, latest)", func() WorkloadProfile { return ycsbProfile("d") }},
+	"ycsb-e":         {"YCSB E: short ranges (95/5 scan/insert, zipfian)", func() WorkloadProfile { return ycsbProfile("e") }},
+	"ycsb-f":         {"YCSB F: read-modify-write (50/50 read/RMW, zipfian)", func() WorkloadProfile { return ycsbProfile("f") }},
+}
+
+// applyProfile swaps in the profile's table and query set. Profile queries
+// are all typed "oltp" so the regular selector picks by weight alone.
+func applyProfile(name string) (WorkloadProfile, error) {
+	entry, ok := profileRegistry[name]
+	if !ok {
+		return WorkloadProfile{}, fmt.Errorf("unknown profile %q (use -profile=list)", name)
+	}
+	p := entry.build()
+
+	for i := range p.Queries {
+		p.Queries[i].Type = "oltp"
+		if p.Queries[i].ExplainSQL == "" {
+			p.Queries[i].ExplainSQL = "EXPLAIN (FORMAT TEXT, COSTS TRUE) " + p.Queries[i].SQL
+		}
+	}
+
+	queries = p.Queries
+	config.TableName = p.Table
+	config.WorkloadType = "oltp"
+	return p, nil
+}
+
+func setupProfile(ctx context.Context, pool *pgxpool.Pool, p WorkloadProfile) error {
+	fmt.Printf("\n📋 Setting up profile %s (%d rows)...\n", p.Name, config.TotalRows)
+	for _, stmt := range p.Setup {
+		start := time.Now()
+		if _, err := pool.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("profile setup failed: %w\n%s", err, stmt)
+		}
+		fmt.Printf("   ✅ %s (took %v)\n", firstLine(stmt), time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func printProfiles() {
+	names := make([]string, 0, len(profileRegistry))
+	for name := range profileRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Available workload profiles:")
+	for _, name := range names {
+		fmt.Printf("   %-16s %s\n", name, profileRegistry[name].description)
+	}
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// ============================================================================
+// PGBENCH-LIKE PROFILES
+// ============================================================================
+
+const pgbenchAccountsPerScale = 100_000
+
+func pgbenchProfile(variant string) WorkloadProfile {
+	scale := config.TotalRows / pgbenchAccountsPerScale
+	if scale < 1 {
+		scale = 1
+	}
+	accounts := scale * pgbenchAccountsPerScale
+
+	aid := func() int64 { return 1 + rand.Int63n(accounts) }
+	bid := func() int64 { return 1 + rand.Int63n(scale) }
+	tid := func() int64 { return 1 + rand.Int63n(scale*10) }
+	delta := func() int64 { return rand.Int63n(10001) - 5000 }
+
+	p := WorkloadProfile{
+		Name:  variant,
+		Table: "pgbench_accounts",
+		Setup: []string{
+			`DROP TABLE IF EXISTS pgbench_history, pgbench_tellers, pgbench_accounts, pgbench_branches`,
+			`CREATE TABLE pgbench_branches (bid INT PRIMARY KEY, bbalance INT, filler CHAR(88))`,
+			`CREATE TABLE pgbench_tellers (tid INT PRIMARY KEY, bid INT, tbalance INT, filler CHAR(84))`,
+			`CREATE TABLE pgbench_accounts (aid INT PRIMARY KEY, bid INT, abalance INT, filler CHAR(84))`,
+			`CREATE TABLE pgbench_history (tid INT, bid INT, aid INT, delta INT, mtime TIMESTAMP, filler CHAR(22))`,
+			fmt.Sprintf(`INSERT INTO pgbench_branches (bid, bbalance) SELECT g, 0 FROM generate_series(1, %d) g`, scale),
+			fmt.Sprintf(`INSERT INTO pgbench_tellers (tid, bid, tbalance) SELECT g, (g - 1) / 10 + 1, 0 FROM generate_series(1, %d) g`, scale*10),
+			fmt.Sprintf(`INSERT INTO pgbench_accounts (aid, bid, abalance, filler) SELECT g, (g - 1) / %d + 1, 0, '' FROM generate_series(1, %d) g`, pgbenchAccountsPerScale, accounts),
+			`VACUUM ANALYZE pgbench_branches, pgbench_tellers, pgbench_accounts, pgbench_history`,
+		},
+	}
+
+	// pgbench runs each script as a multi-statement transaction; a single
+	// data-modifying CTE does the same work in one round trip.
+	tpcb := Query{
+		Name:        "pgbench_tpcb",
+		Weight:      100,
+		Description: "TPC-B-like: update account/teller/branch, insert history",
+		SQL: `WITH acc AS (
+                  UPDATE pgbench_accounts SET abalance = abalance + $2 WHERE aid = $1 RETURNING abalance
+              ), tel AS (
+                  UPDATE pgbench_tellers SET tbalance = tbalance + $2 WHERE tid = $3
+              ), br AS (
+                  UPDATE pgbench_branches SET bbalance = bbalance + $2 WHERE bid = $4
+              )
+              INSERT INTO pgbench_history (tid, bid, aid, delta, mtime)
+              SELECT $3::int, $4::int, $1, $2, CURRENT_TIMESTAMP FROM acc
+              RETURNING (SELECT abalance FROM acc)`,
+		Params: func() []interface{} { return []interface{}{aid(), delta(), tid(), bid()} },
+	}
+	simple := Query{
+		Name:        "pgbench_simple_update",
+		Weight:      100,
+		Description: "Simple-update: update account, insert history",
+		SQL: `WITH acc AS (
+                  UPDATE pgbench_accounts SET abalance = abalance + $2 WHERE aid = $1 RETURNING abalance
+              )
+              INSERT INTO pgbench_history (tid, bid, aid, delta, mtime)
+              SELECT $3::int, $4::int, $1, $2, CURRENT_TIMESTAMP FROM acc
+              RETURNING (SELECT abalance FROM acc)`,
+		Params: func() []interface{} { return []interface{}{aid(), delta(), tid(), bid()} },
+	}
+	selectOnly := Query{
+		Name:        "pgbench_select",
+		Weight:      100,
+		Description: "SELECT-only account balance lookup",
+		SQL:         `SELECT abalance FROM pgbench_accounts WHERE aid = $1`,
+		Params:      func() []interface{} { return []interface{}{aid()} },
+	}
+
+	switch variant {
+	case "pgbench-select":
+		p.Queries = []Query{selectOnly}
+	case "pgbench-simple":
+		p.Queries = []Query{simple}
+	default:
+		p.Queries = []Query{tpcb}
+	}
+	return p
+}
+
+// ============================================================================
+// YCSB CORE WORKLOADS A-F
+// ============================================================================
+
+const (
+	ycsbFieldCount  = 10
+	ycsbFieldLength = 100
+	ycsbMaxScanLen  = 100
+	ycsbZipfTheta   = 0.99 // YCSB zipfian constant
+)
+
+// ycsbKeyspace tracks the record count and hands out insert keys so inserts
+// from all workers extend one contiguous key range.
+type ycsbKeyspace struct {
+	records int64
+	lastKey atomic.Int64
+	zipf    *ycsbZipfian
+}
+
+func newYCSBKeyspace(records int64) *ycsbKeyspace {
+	ks := &ycsbKeyspace{records: records, zipf: newYCSBZipfian(records, ycsbZipfTheta)}
+	ks.lastKey.Store(records)
+	return ks
+}
+
+// zipfianKey returns a hot key scattered across the keyspace (YCSB
+// ScrambledZipfianGenerator) so the hot set is not one contiguous range.
+func (ks *ycsbKeyspace) zipfianKey() int64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	v := uint64(ks.zipf.next())
+	for i := range buf {
+		buf[i] = byte(v >> (8 * i))
+	}
+	h.Write(buf[:])
+	return int64(h.Sum64()%uint64(ks.records)) + 1
+}
+
+// latestKey favours the most recently inserted records (YCSB "latest").
+func (ks *ycsbKeyspace) latestKey() int64 {
+	last := ks.lastKey.Load()
+	key := last - ks.zipf.next()%last
+	if key < 1 {
+		key = 1
+	}
+	return key
+}
+
+func (ks *ycsbKeyspace) nextInsertKey() int64 {
+	return ks.lastKey.Add(1)
+}
+
+// ycsbZipfian is the Gray et al. generator used by YCSB: O(n) setup, O(1)
+// per sample, returning values in [0, n).
+type ycsbZipfian struct {
+	n     int64
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+func newYCSBZipfian(n int64, theta float64) *ycsbZipfian {
+	zetan := 0.0
+	for i := int64(1); i <= n; i++ {
+		zetan += 1.0 / math.Pow(float64(i), theta)
+	}
+	zeta2 := 1.0 + 1.0/math.Pow(2, theta)
+
+	return &ycsbZipfian{
+		n:     n,
+		theta: theta,
+		alpha: 1.0 / (1.0 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2.0/float64(n), 1-theta)) / (1 - zeta2/zetan),
+	}
+}
+
+func (z *ycsbZipfian) next() int64 {
+	u := rand.Float64()
+	uz := u * z.zetan
+	if uz < 1.0 {
+		return 0
+	}
+	if uz < 1.0+math.Pow(0.5, z.theta) {
+		return 1
+	}
+	v := int64(float64(z.n) * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	if v >= z.n {
+		v = z.n - 1
+	}
+	return v
+}
+
+const ycsbAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func ycsbFieldValue() string {
+	b := make([]byte, ycsbFieldLength)
+	for i := range b {
+		b[i] = ycsbAlphabet[rand.Intn(len(ycsbAlphabet))]
+	}
+	return string(b)
+}
+
+func ycsbProfile(workload string) WorkloadProfile {
+	records := config.TotalRows
+	if records < 1 {
+		records = 1
+	}
+	ks := newYCSBKeyspace(records)
+
+	fieldCols := make([]string, ycsbFieldCount)
+	fieldDefs := make([]string, ycsbFieldCount)
+	fieldGen := make([]string, ycsbFieldCount)
+	for i := range fieldCols {
+		fieldCols[i] = fmt.Sprintf("field%d", i)
+		fieldDefs[i] = fieldCols[i] + " TEXT"
+		// 3 x md5 + 4 chars = 100 bytes, matching YCSB's default field length
+		fieldGen[i] = fmt.Sprintf("repeat(md5(g::text || '%d'), 3) || left(md5(g::text), 4)", i)
+	}
+	placeholders := make([]string, ycsbFieldCount)
+	for i := range placeholders {
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+	}
+
+	p := WorkloadProfile{
+		Name:  "ycsb-" + workload,
+		Table: "usertable",
+		Setup: []string{
+			`DROP TABLE IF EXISTS usertable`,
+			fmt.Sprintf(`CREATE TABLE usertable (ycsb_key BIGINT PRIMARY KEY, %s)`, strings.Join(fieldDefs, ", ")),
+			fmt.Sprintf(`INSERT INTO usertable SELECT g, %s FROM generate_series(1, %d) g`, strings.Join(fieldGen, ", "), records),
+			`VACUUM ANALYZE usertable`,
+		},
+	}
+
+	read := Query{
+		Name:        "ycsb_read",
+		Description: "Read one record (zipfian key)",
+		SQL:         `SELECT * FROM usertable WHERE ycsb_key = $1`,
+		Params:      func() []interface{} { return []interface{}{ks.zipfianKey()} },
+	}
+	readLatest := Query{
+		Name:        "ycsb_read_latest",
+		Description: "Read one recently inserted record",
+		SQL:         `SELECT * FROM usertable WHERE ycsb_key = $1`,
+		Params:      func() []interface{} { return []interface{}{ks.latestKey()} },
+	}
+	update := Query{
+		Name:        "ycsb_update",
+		Description: "Update one field of one record",
+		SQL:         `UPDATE usertable SET field0 = $2 WHERE ycsb_key = $1`,
+		Params:      func() []interface{} { return []interface{}{ks.zipfianKey(), ycsbFieldValue()} },
+	}
+	insert := Query{
+		Name:        "ycsb_insert",
+		Description: "Insert a new record at the end of the keyspace",
+		SQL: fmt.Sprintf(`INSERT INTO usertable (ycsb_key, %s) VALUES ($1, %s) ON CONFLICT (ycsb_key) DO NOTHING`,
+			strings.Join(fieldCols, ", "), strings.Join(placeholders, ", ")),
+		Params: func() []interface{} {
+			args := []interface{}{ks.nextInsertKey()}
+			for i := 0; i < ycsbFieldCount; i++ {
+				args = append(args, ycsbFieldValue())
+			}
+			return args
+		},
+	}
+	scan := Query{
+		Name:        "ycsb_scan",
+		Description: "Short range scan starting at a zipfian key",
+		SQL:         `SELECT * FROM usertable WHERE ycsb_key >= $1 ORDER BY ycsb_key LIMIT $2`,
+		Params: func() []interface{} {
+			return []interface{}{ks.zipfianKey(), 1 + rand.Intn(ycsbMaxScanLen)}
+		},
+	}
+	rmw := Query{
+		Name:        "ycsb_read_modify_write",
+		Description: "Read a record, then update it in the same statement",
+		SQL: `WITH r AS (SELECT * FROM usertable WHERE ycsb_key = $1 FOR UPDATE)
+              UPDATE usertable u SET field0 = $2 FROM r WHERE u.ycsb_key = r.ycsb_key
+              RETURNING r.*`,
+		Params: func() []interface{} { return []interface{}{ks.zipfianKey(), ycsbFieldValue()} },
+	}
+
+	weighted := func(q Query, w int) Query {
+		q.Weight = w
+		return q
+	}
+
+	switch workload {
+	case "a":
+		p.Queries = []Query{weighted(read, 50), weighted(update, 50)}
+	case "b":
+		p.Queries = []Query{weighted(read, 95), weighted(update, 5)}
+	case "c":
+		p.Queries = []Query{weighted(read, 100)}
+	case "d":
+		p.Queries = []Query{weighted(readLatest, 95), weighted(insert, 5)}
+	case "e":
+		p.Queries = []Query{weighted(scan, 95), weighted(insert, 5)}
+	case "f":
+		p.Queries = []Query{weighted(read, 50), weighted(rmw, 50)}
+	}
+	return p
+}
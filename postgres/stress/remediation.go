@@ -0,0 +1,167 @@
+package main
+
+// ============================================================================
+// ANALYZE REMEDIATION EXPERIMENT (plan_check.analyze_on_change)
+// ============================================================================
+//
+// The first thing anyone tries after a plan flip is ANALYZE. With
+// -analyze-on-plan-change the plan monitor does it for us: when a query's
+// plan changes we ANALYZE the target table, re-EXPLAIN the query with the
+// same parameters and record what happened:
+//   - reverted:  the old plan came back (stale statistics were the cause)
+//   - persisted: the new plan stuck (statistics are fine; the data or the
+//                parameters really favour it)
+//   - changed:   a third plan appeared
+//
+// ANALYZE takes a SHARE UPDATE EXCLUSIVE lock and reads a sample of the
+// table, so runs are rate limited by plan_check.analyze_cooldown.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RemediationResult struct {
+	Time        time.Time `json:"time"`
+	Query       string    `json:"query"`
+	Table       string    `json:"table"`
+	PrevPlan    string    `json:"prev_plan_hash"`
+	NewPlan     string    `json:"new_plan_hash"`
+	PostPlan    string    `json:"post_analyze_plan_hash,omitempty"`
+	AnalyzeMs   float64   `json:"analyze_ms"`
+	Outcome     string    `json:"outcome"` // reverted, persisted, changed, skipped, failed
+	Description string    `json:"description,omitempty"`
+}
+
+type RemediationLog struct {
+	results     []RemediationResult
+	lastAnalyze time.Time
+	mu          sync.Mutex
+}
+
+var remediationLog = &RemediationLog{}
+
+func (rl *RemediationLog) add(r RemediationResult) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.results = append(rl.results, r)
+}
+
+// reserve claims the next ANALYZE slot unless one ran within the cooldown.
+func (rl *RemediationLog) reserve(now time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if !rl.lastAnalyze.IsZero() && now.Sub(rl.lastAnalyze) < config.AnalyzeCooldown {
+		return false
+	}
+	rl.lastAnalyze = now
+	return true
+}
+
+func (rl *RemediationLog) Results() []RemediationResult {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return append([]RemediationResult(nil), rl.results...)
+}
+
+// runAnalyzeExperiment is called by the plan monitor right after it records
+// a plan change for query. params are the ones the new plan was captured
+// with, so the re-EXPLAIN is comparable.
+func runAnalyzeExperiment(ctx context.Context, pool *pgxpool.Pool, query Query, params []interface{}, prevHash, newHash string) {
+	result := RemediationResult{
+		Time:     time.Now(),
+		Query:    query.Name,
+		Table:    config.TableName,
+		PrevPlan: prevHash,
+		NewPlan:  newHash,
+	}
+
+	if !remediationLog.reserve(result.Time) {
+		result.Outcome = "skipped"
+		result.Description = fmt.Sprintf("within %v analyze cooldown", config.AnalyzeCooldown)
+		remediationLog.add(result)
+		return
+	}
+
+	fmt.Printf("\n🩺 Plan change on %s: running ANALYZE %s\n", query.Name, config.TableName)
+
+	start := time.Now()
+	if _, err := pool.Exec(ctx, "ANALYZE "+config.TableName); err != nil {
+		result.Outcome = "failed"
+		result.Description = err.Error()
+		remediationLog.add(result)
+		fmt.Printf("   ❌ ANALYZE failed: %v\n", err)
+		return
+	}
+	result.AnalyzeMs = durationMs(time.Since(start))
+
+	planText, cost, ok := capturePlan(ctx, pool, query.ExplainSQL, params)
+	if !ok {
+		result.Outcome = "failed"
+		result.Description = "could not re-capture plan after ANALYZE"
+		remediationLog.add(result)
+		return
+	}
+	planMonitor.RecordPlan(query.Name, query.SQL, planText, cost)
+	result.PostPlan = hashPlanStructure(planText)
+
+	switch result.PostPlan {
+	case prevHash:
+		result.Outcome = "reverted"
+		result.Description = "previous plan restored: stale statistics likely caused the flip"
+	case newHash:
+		result.Outcome = "persisted"
+		result.Description = "new plan kept after fresh statistics"
+	default:
+		result.Outcome = "changed"
+		result.Description = "a third plan was chosen after ANALYZE"
+	}
+	remediationLog.add(result)
+
+	fmt.Printf("   ANALYZE took %.0fms, plan %s → %s → %s: %s\n",
+		result.AnalyzeMs, shortHash(prevHash), shortHash(newHash), shortHash(result.PostPlan), result.Outcome)
+}
+
+// shortHash trims a plan hash for console tables; the JSON report keeps the
+// full value.
+func shortHash(h string) string {
+	if len(h) > 8 {
+		return h[:8]
+	}
+	if h == "" {
+		return "-"
+	}
+	return h
+}
+
+func (rl *RemediationLog) PrintReport() {
+	results := rl.Results()
+
+	fmt.Printf("\n🩺 ANALYZE Remediation Experiments:\n")
+	if len(results) == 0 {
+		fmt.Println("   No plan changes triggered an ANALYZE")
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.Outcome]++
+	}
+	fmt.Printf("   Reverted: %d   Persisted: %d   Changed: %d   Skipped: %d   Failed: %d\n",
+		counts["reverted"], counts["persisted"], counts["changed"], counts["skipped"], counts["failed"])
+
+	fmt.Printf("   %-8s %-28s %-10s %-10s %-10s %10s  %s\n", "Time", "Query", "Before", "Flipped", "After", "ANALYZE", "Outcome")
+	for _, r := range results {
+		analyze := "-"
+		if r.AnalyzeMs > 0 {
+			analyze = fmt.Sprintf("%.0fms", r.AnalyzeMs)
+		}
+		fmt.Printf("   %-8s %-28s %-10s %-10s %-10s %10s  %s\n",
+			r.Time.Format("15:04:05"), r.Query, shortHash(r.PrevPlan), shortHash(r.NewPlan),
+			shortHash(r.PostPlan), analyze, r.Outcome)
+	}
+}
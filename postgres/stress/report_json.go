@@ -0,0 +1,150 @@
+package main
+
+// ============================================================================
+// MACHINE-READABLE REPORT (output.report_json / -report-json)
+// ============================================================================
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+type RunReport struct {
+	RunID          string                 `json:"run_id"`
+	StartTime      time.Time              `json:"start_time"`
+	EndTime        time.Time              `json:"end_time"`
+	DurationSec    float64                `json:"duration_sec"`
+	TotalQueries   int64                  `json:"total_queries"`
+	TotalErrors    int64                  `json:"total_errors"`
+	QPS            float64                `json:"qps"`
+	CacheHitRatio  float64                `json:"cache_hit_ratio_pct"`
+	Queries        map[string]QueryReport `json:"queries"`
+	PlanCounts     map[string]int         `json:"plan_counts"`
+	SLOResults     []SLOResult            `json:"slo_results,omitempty"`
+	Churn          *ChurnReport           `json:"churn,omitempty"`
+	Spills         *SpillReport           `json:"spills"`
+	Parallel       *ParallelReport        `json:"parallel"`
+	Hints          []HintComparison       `json:"hints,omitempty"`
+	Remediations   []RemediationResult    `json:"analyze_remediations,omitempty"`
+	IndexImpact    *IndexImpactReport     `json:"index_impact,omitempty"`
+	Outbox         *OutboxReport          `json:"outbox,omitempty"`
+	StmtCache      *StmtCacheReport       `json:"stmt_cache,omitempty"`
+	Chaos          *ChaosReport           `json:"chaos,omitempty"`
+	Proxy          *ProxyReport           `json:"proxy,omitempty"`
+	Toxiproxy      *ToxiproxyReport       `json:"toxiproxy,omitempty"`
+	TempPressure   *TempPressureReport    `json:"temp_pressure,omitempty"`
+	WorkMemSweep   *WorkMemSweepReport    `json:"work_mem_sweep,omitempty"`
+	CostSweep      *CostSweepReport       `json:"cost_sweep,omitempty"`
+	StaleStats     *StaleStatsReport      `json:"stale_stats,omitempty"`
+	Tuning         *TuningReport          `json:"tuning"`
+	ResolvedConfig string                 `json:"resolved_config"` // YAML, DSN password masked
+}
+
+type QueryReport struct {
+	Count  int64   `json:"count"`
+	Errors int64   `json:"errors"`
+	AvgMs  float64 `json:"avg_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (m *Metrics) BuildReport() RunReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	end := time.Now()
+	elapsed := end.Sub(m.startTime)
+
+	report := RunReport{
+		RunID:          config.RunID,
+		StartTime:      m.startTime,
+		EndTime:        end,
+		DurationSec:    elapsed.Seconds(),
+		TotalQueries:   m.totalQueries,
+		TotalErrors:    m.totalErrors,
+		QPS:            float64(m.totalQueries) / elapsed.Seconds(),
+		CacheHitRatio:  m.GetCacheHitRatio(),
+		Queries:        make(map[string]QueryReport),
+		PlanCounts:     planMonitor.GetSummary(),
+		SLOResults:     m.EvaluateSLOs(),
+		Spills:         spillTracker.Report(),
+		Parallel:       parallelTracker.Report(),
+		Tuning:         tuningAdvisor.Report(m.lastPoolStats()),
+		ResolvedConfig: resolvedConfigYAML(),
+	}
+
+	if churnWorkerCount() > 0 {
+		report.Churn = churnStats.Report(elapsed)
+	}
+	if config.HintsEnabled {
+		report.Hints = m.CompareHints()
+	}
+	if config.AnalyzeOnPlanChange {
+		report.Remediations = remediationLog.Results()
+	}
+	if indexImpact != nil {
+		report.IndexImpact = indexImpact.Report()
+	}
+	if outboxSim != nil {
+		report.Outbox = outboxSim.Report()
+	}
+	if stmtCache != nil {
+		report.StmtCache = stmtCache.Report()
+	}
+	if chaos != nil {
+		report.Chaos = chaos.Report()
+	}
+	if netProxy != nil {
+		report.Proxy = netProxy.Report()
+	}
+	if toxiScenario != nil {
+		report.Toxiproxy = toxiScenario.Report()
+	}
+	if tempPressure != nil {
+		report.TempPressure = tempPressure.Report()
+	}
+	if workMemSweep != nil {
+		report.WorkMemSweep = workMemSweep.Report()
+	}
+	if costSweep != nil {
+		report.CostSweep = costSweep.Report()
+	}
+	if staleStats != nil {
+		report.StaleStats = staleStats.Report()
+	}
+
+	for name, qm := range m.queryMetrics {
+		s := qm.Summary()
+		if s.Count == 0 {
+			continue
+		}
+		report.Queries[name] = QueryReport{
+			Count:  s.Count,
+			Errors: s.Errors,
+			AvgMs:  durationMs(s.Avg),
+			P50Ms:  durationMs(s.P50),
+			P95Ms:  durationMs(s.P95),
+			P99Ms:  durationMs(s.P99),
+		}
+	}
+
+	return report
+}
+
+func writeJSONReport(path string, report RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,824 @@
+package main
+
+// ============================================================================
+// RUN CONFIGURATION FILE (-config run.yaml)
+// ============================================================================
+//
+// A single YAML file captures everything needed to reproduce a run: DSN,
+// sessions, duration, workload mix, SLOs, plan-check settings and output
+// options. Values from the file are applied first, then any flag that was
+// set explicitly on the command line overrides them. The resolved result is
+// embedded in the report so every run can be audited after the fact.
+//
+// See run.example.yaml for a complete example.
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type RunConfig struct {
+	DSN            string         `yaml:"dsn"`
+	Table          string         `yaml:"table"`
+	TotalRows      int64          `yaml:"total_rows"`
+	Sessions       int            `yaml:"sessions"`
+	Burst          int            `yaml:"burst"`
+	Churn          float64        `yaml:"churn"` // Fraction of sessions that connect per query
+	Duration       time.Duration  `yaml:"duration"`
+	ReportInterval time.Duration  `yaml:"report_interval"`
+	Workload       WorkloadSpec   `yaml:"workload"`
+	SLOs           map[string]SLO `yaml:"slos,omitempty"`
+	PlanCheck      PlanCheckSpec  `yaml:"plan_check"`
+	Hints          HintSpec       `yaml:"hints"`
+	Index          IndexSpec      `yaml:"index"`
+	Outbox         OutboxSpec     `yaml:"outbox"`
+	StmtCache      StmtCacheSpec  `yaml:"stmt_cache"`
+	Chaos          ChaosSpec      `yaml:"chaos"`
+	Proxy          ProxySpec      `yaml:"proxy"`
+	Toxiproxy      ToxiproxySpec  `yaml:"toxiproxy"`
+	TempPressure   TempSpec       `yaml:"temp_pressure"`
+	WorkMemSweep   WorkMemSpec    `yaml:"work_mem_sweep"`
+	CostSweep      CostSweepSpec  `yaml:"cost_sweep"`
+	StaleStats     StaleStatsSpec `yaml:"stale_stats"`
+	Output         OutputSpec     `yaml:"output"`
+}
+
+type WorkloadSpec struct {
+	Type           string         `yaml:"type"`              // oltp, analytics, mixed
+	Profile        string         `yaml:"profile,omitempty"` // Built-in profile (ycsb-a..f, pgbench, ...)
+	OLTPPercent    int            `yaml:"oltp_percent"`      // Share of OLTP picks in mixed mode
+	TopCustomerPct float64        `yaml:"top_customer_pct"`
+	Weights        map[string]int `yaml:"weights,omitempty"` // Per-query weight overrides (0 disables)
+}
+
+// SLO is a per-query latency/error objective evaluated at the end of the run.
+// Zero values are not checked.
+type SLO struct {
+	P95         time.Duration `yaml:"p95,omitempty"`
+	P99         time.Duration `yaml:"p99,omitempty"`
+	MaxErrorPct float64       `yaml:"max_error_pct,omitempty"`
+}
+
+type HintSpec struct {
+	Enabled bool              `yaml:"enabled"`
+	Ratio   float64           `yaml:"ratio"`             // Share of executions that use the hint
+	Queries map[string]string `yaml:"queries,omitempty"` // query name -> pg_hint_plan hint
+}
+
+// IndexSpec describes an index to build mid-run (index_impact.go).
+type IndexSpec struct {
+	Create string        `yaml:"create,omitempty"` // CREATE INDEX statement; empty disables
+	After  time.Duration `yaml:"after"`            // Baseline load before the build
+	Keep   bool          `yaml:"keep"`             // Keep the index after the run
+}
+
+// OutboxSpec configures the transactional outbox simulator (outbox.go).
+type OutboxSpec struct {
+	Writers      int           `yaml:"writers"`       // 0 disables
+	Relays       int           `yaml:"relays"`        // Relay sessions, sharing work with SKIP LOCKED
+	Batch        int           `yaml:"batch"`         // Events claimed per poll
+	PollInterval time.Duration `yaml:"poll_interval"` // Pause after a poll that wasn't full
+	PayloadBytes int           `yaml:"payload_bytes"` // Padding per event payload
+}
+
+// StmtCacheSpec lists the statement modes to compare (stmt_cache.go).
+type StmtCacheSpec struct {
+	Modes []string `yaml:"modes,omitempty"` // exec, simple_protocol, describe_exec, cache_describe[:n], cache_statement[:n]
+}
+
+// ChaosSpec configures random backend termination (chaos.go).
+type ChaosSpec struct {
+	Interval     time.Duration `yaml:"interval"`      // 0 disables
+	TerminatePct float64       `yaml:"terminate_pct"` // Share of sessions per round; 0 terminates one
+	Retries      int           `yaml:"retries"`       // Retries of a query that lost its connection
+	RetryBackoff time.Duration `yaml:"retry_backoff"` // First retry delay, doubled per retry
+}
+
+// ProxySpec configures the built-in network fault proxy (netproxy.go).
+type ProxySpec struct {
+	Enabled bool     `yaml:"enabled"`          // Implied by faults
+	Listen  string   `yaml:"listen"`           // host:port, port 0 picks a free one
+	Faults  []string `yaml:"faults,omitempty"` // AT[+FOR]:latency=D[~J] | bandwidth=SIZE | reset | blackhole
+}
+
+// ToxiproxySpec describes a Toxiproxy chaos scenario (toxiproxy.go).
+type ToxiproxySpec struct {
+	API      string      `yaml:"api,omitempty"`      // Toxiproxy API host:port; empty disables
+	Proxy    string      `yaml:"proxy"`              // Proxy name, replaced if it exists
+	Listen   string      `yaml:"listen"`             // Proxy listen address on the Toxiproxy host
+	Upstream string      `yaml:"upstream,omitempty"` // Defaults to the DSN's host:port
+	Toxics   []ToxicSpec `yaml:"toxics,omitempty"`
+}
+
+// ToxicSpec is one toxic and when it is active.
+type ToxicSpec struct {
+	Name       string           `yaml:"name,omitempty"`       // Defaults to <type>_<index>
+	Type       string           `yaml:"type"`                 // latency, bandwidth, slow_close, timeout, reset_peer, slicer, limit_data
+	Stream     string           `yaml:"stream,omitempty"`     // downstream (default) or upstream
+	Toxicity   float32          `yaml:"toxicity,omitempty"`   // Share of connections affected; 0 means 1
+	Attributes map[string]int64 `yaml:"attributes,omitempty"` // e.g. latency: 100, jitter: 20
+	At         time.Duration    `yaml:"at"`                   // Offset from the start of the load
+	For        time.Duration    `yaml:"for,omitempty"`        // 0 keeps it until the end
+}
+
+// TempSpec configures the temp-file pressure scenario (temp_pressure.go).
+type TempSpec struct {
+	Sessions      int           `yaml:"sessions"`                  // 0 disables
+	SpillSize     string        `yaml:"spill_size"`                // Target temp volume per query
+	WorkMem       string        `yaml:"work_mem"`                  // work_mem of the spilling sessions
+	TempFileLimit string        `yaml:"temp_file_limit,omitempty"` // SET in the spilling sessions (superuser)
+	After         time.Duration `yaml:"after"`                     // Baseline load before spilling starts
+}
+
+// WorkMemSpec configures the work_mem sweep (work_mem_sweep.go).
+type WorkMemSpec struct {
+	Values  []string `yaml:"values,omitempty"` // work_mem values, e.g. 1MB; empty disables
+	Repeats int      `yaml:"repeats"`          // Rounds over all values
+}
+
+// CostSweepSpec configures the planner cost sweep (cost_sweep.go).
+type CostSweepSpec struct {
+	RandomPageCost     []string `yaml:"random_page_cost,omitempty"`     // Empty keeps the server's
+	EffectiveCacheSize []string `yaml:"effective_cache_size,omitempty"` // Empty keeps the server's
+	Repeats            int      `yaml:"repeats"`                        // Rounds over the grid
+}
+
+// StaleStatsSpec configures the stale-statistics drift experiment
+// (stale_stats.go).
+type StaleStatsSpec struct {
+	Writers        int           `yaml:"writers"`         // Sessions inserting skewed rows; 0 disables
+	Batch          int           `yaml:"batch"`           // Rows per insert
+	After          time.Duration `yaml:"after"`           // Baseline load before the writers start
+	AnalyzeAfter   time.Duration `yaml:"analyze_after"`   // Drift before the writers stop and ANALYZE runs
+	SampleInterval time.Duration `yaml:"sample_interval"` // Table stats, estimate error and latency buckets
+	Keep           bool          `yaml:"keep,omitempty"`  // Keep the inserted rows after the run
+}
+
+type PlanCheckSpec struct {
+	Enabled         bool          `yaml:"enabled"`
+	Interval        time.Duration `yaml:"interval"`
+	ExplainAnalyze  bool          `yaml:"explain_analyze"`   // Sample runtime stats (spills) each check
+	AnalyzeOnChange bool          `yaml:"analyze_on_change"` // ANALYZE the table when a plan flips
+	AnalyzeCooldown time.Duration `yaml:"analyze_cooldown"`  // Minimum time between remediation ANALYZEs
+	PersistHistory  bool          `yaml:"persist_history"`   // Upsert observed plans into history_table
+	HistoryTable    string        `yaml:"history_table"`
+}
+
+type OutputSpec struct {
+	ReportJSON  string `yaml:"report_json,omitempty"`  // Write machine-readable report here
+	MetricsAddr string `yaml:"metrics_addr,omitempty"` // Serve Prometheus metrics here
+}
+
+// loadRunConfig reads a YAML run file and applies it on top of the defaults
+// in config. Keys missing from the file keep their default values.
+func loadRunConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	rc := resolvedRunConfig()
+	if err := yaml.Unmarshal(data, &rc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	config.DBConnString = rc.DSN
+	config.TableName = rc.Table
+	config.TotalRows = rc.TotalRows
+	config.SessionCount = rc.Sessions
+	config.BurstSessions = rc.Burst
+	config.ChurnFraction = rc.Churn
+	config.Duration = rc.Duration
+	config.ReportInterval = rc.ReportInterval
+	config.WorkloadType = rc.Workload.Type
+	config.OLTPPercent = rc.Workload.OLTPPercent
+	config.TopCustomerPct = rc.Workload.TopCustomerPct
+	config.SLOs = rc.SLOs
+	config.PlanCheckEnabled = rc.PlanCheck.Enabled
+	config.PlanCheckInterval = rc.PlanCheck.Interval
+	config.ExplainAnalyze = rc.PlanCheck.ExplainAnalyze
+	config.AnalyzeOnPlanChange = rc.PlanCheck.AnalyzeOnChange
+	config.AnalyzeCooldown = rc.PlanCheck.AnalyzeCooldown
+	config.PlanHistory = rc.PlanCheck.PersistHistory
+	config.PlanHistoryTable = rc.PlanCheck.HistoryTable
+	config.HintsEnabled = rc.Hints.Enabled
+	config.HintRatio = rc.Hints.Ratio
+	config.QueryHints = rc.Hints.Queries
+	config.IndexDDL = rc.Index.Create
+	config.IndexAfter = rc.Index.After
+	config.IndexKeep = rc.Index.Keep
+	config.OutboxWriters = rc.Outbox.Writers
+	config.OutboxRelays = rc.Outbox.Relays
+	config.OutboxBatch = rc.Outbox.Batch
+	config.OutboxRelayInterval = rc.Outbox.PollInterval
+	config.OutboxPayload = rc.Outbox.PayloadBytes
+	config.StmtCacheModes = rc.StmtCache.Modes
+	config.ChaosInterval = rc.Chaos.Interval
+	config.ChaosTerminatePct = rc.Chaos.TerminatePct
+	config.ChaosRetries = rc.Chaos.Retries
+	config.ChaosRetryBackoff = rc.Chaos.RetryBackoff
+	config.ProxyEnabled = rc.Proxy.Enabled
+	config.ProxyListen = rc.Proxy.Listen
+	config.ProxyFaults = rc.Proxy.Faults
+	config.ToxiproxyAPI = rc.Toxiproxy.API
+	config.ToxiproxyProxy = rc.Toxiproxy.Proxy
+	config.ToxiproxyListen = rc.Toxiproxy.Listen
+	config.ToxiproxyUpstream = rc.Toxiproxy.Upstream
+	config.Toxics = rc.Toxiproxy.Toxics
+	config.TempSessions = rc.TempPressure.Sessions
+	config.TempSpillSize = rc.TempPressure.SpillSize
+	config.TempWorkMem = rc.TempPressure.WorkMem
+	config.TempFileLimit = rc.TempPressure.TempFileLimit
+	config.TempAfter = rc.TempPressure.After
+	config.WorkMemValues = rc.WorkMemSweep.Values
+	config.WorkMemRepeats = rc.WorkMemSweep.Repeats
+	config.CostRandomPageCosts = rc.CostSweep.RandomPageCost
+	config.CostCacheSizes = rc.CostSweep.EffectiveCacheSize
+	config.CostRepeats = rc.CostSweep.Repeats
+	config.DriftWriters = rc.StaleStats.Writers
+	config.DriftBatch = rc.StaleStats.Batch
+	config.DriftAfter = rc.StaleStats.After
+	config.DriftAnalyzeAfter = rc.StaleStats.AnalyzeAfter
+	config.DriftSampleInterval = rc.StaleStats.SampleInterval
+	config.DriftKeep = rc.StaleStats.Keep
+	config.ReportJSON = rc.Output.ReportJSON
+	config.MetricsAddr = rc.Output.MetricsAddr
+	config.Profile = rc.Workload.Profile
+	config.QueryWeights = rc.Workload.Weights
+
+	return nil
+}
+
+// applyFlagOverrides copies every flag the user set explicitly into config,
+// so command-line values always win over the config file.
+func applyFlagOverrides() {
+	flag.Visit(func(f *flag.Flag) {
+		v := f.Value.(flag.Getter).Get()
+		switch f.Name {
+		case "duration":
+			config.Duration = v.(time.Duration)
+		case "sessions":
+			config.SessionCount = v.(int)
+		case "burst":
+			config.BurstSessions = v.(int)
+		case "churn":
+			config.ChurnFraction = v.(float64)
+		case "workload":
+			config.WorkloadType = v.(string)
+		case "dsn":
+			config.DBConnString = v.(string)
+		case "report-json":
+			config.ReportJSON = v.(string)
+		case "metrics-addr":
+			config.MetricsAddr = v.(string)
+		case "hints":
+			config.HintsEnabled = v.(bool)
+		case "hint-ratio":
+			config.HintRatio = v.(float64)
+		case "explain-analyze":
+			config.ExplainAnalyze = v.(bool)
+		case "plan-history":
+			config.PlanHistory = v.(bool)
+		case "analyze-on-plan-change":
+			config.AnalyzeOnPlanChange = v.(bool)
+		case "index":
+			config.IndexDDL = v.(string)
+		case "index-after":
+			config.IndexAfter = v.(time.Duration)
+		case "index-keep":
+			config.IndexKeep = v.(bool)
+		case "outbox-writers":
+			config.OutboxWriters = v.(int)
+		case "outbox-relays":
+			config.OutboxRelays = v.(int)
+		case "outbox-batch":
+			config.OutboxBatch = v.(int)
+		case "outbox-poll":
+			config.OutboxRelayInterval = v.(time.Duration)
+		case "stmt-cache":
+			config.StmtCacheModes = nil
+			for _, m := range strings.Split(v.(string), ",") {
+				if m = strings.TrimSpace(m); m != "" {
+					config.StmtCacheModes = append(config.StmtCacheModes, m)
+				}
+			}
+		case "chaos-interval":
+			config.ChaosInterval = v.(time.Duration)
+		case "chaos-pct":
+			config.ChaosTerminatePct = v.(float64)
+		case "chaos-retries":
+			config.ChaosRetries = v.(int)
+		case "chaos-backoff":
+			config.ChaosRetryBackoff = v.(time.Duration)
+		case "proxy":
+			config.ProxyEnabled = v.(bool)
+		case "proxy-listen":
+			config.ProxyListen = v.(string)
+		case "proxy-faults":
+			config.ProxyFaults = nil
+			for _, f := range strings.Split(v.(string), ",") {
+				if f = strings.TrimSpace(f); f != "" {
+					config.ProxyFaults = append(config.ProxyFaults, f)
+				}
+			}
+		case "toxiproxy":
+			config.ToxiproxyAPI = v.(string)
+		case "toxiproxy-listen":
+			config.ToxiproxyListen = v.(string)
+		case "temp-sessions":
+			config.TempSessions = v.(int)
+		case "temp-spill":
+			config.TempSpillSize = v.(string)
+		case "temp-work-mem":
+			config.TempWorkMem = v.(string)
+		case "temp-file-limit":
+			config.TempFileLimit = v.(string)
+		case "temp-after":
+			config.TempAfter = v.(time.Duration)
+		case "work-mem-sweep":
+			config.WorkMemValues = nil
+			for _, w := range strings.Split(v.(string), ",") {
+				if w = strings.TrimSpace(w); w != "" {
+					config.WorkMemValues = append(config.WorkMemValues, w)
+				}
+			}
+		case "work-mem-repeats":
+			config.WorkMemRepeats = v.(int)
+		case "cost-rpc":
+			config.CostRandomPageCosts = nil
+			for _, c := range strings.Split(v.(string), ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					config.CostRandomPageCosts = append(config.CostRandomPageCosts, c)
+				}
+			}
+		case "cost-ecs":
+			config.CostCacheSizes = nil
+			for _, c := range strings.Split(v.(string), ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					config.CostCacheSizes = append(config.CostCacheSizes, c)
+				}
+			}
+		case "cost-repeats":
+			config.CostRepeats = v.(int)
+		case "drift-writers":
+			config.DriftWriters = v.(int)
+		case "drift-batch":
+			config.DriftBatch = v.(int)
+		case "drift-after":
+			config.DriftAfter = v.(time.Duration)
+		case "drift-analyze-after":
+			config.DriftAnalyzeAfter = v.(time.Duration)
+		case "drift-keep":
+			config.DriftKeep = v.(bool)
+		case "profile":
+			config.Profile = v.(string)
+		case "rows":
+			config.TotalRows = v.(int64)
+		}
+	})
+}
+
+// applyQueryWeights applies per-query weight overrides once the final query
+// set (built-in or profile) is known.
+func applyQueryWeights() error {
+	for name, weight := range config.QueryWeights {
+		if weight < 0 {
+			return fmt.Errorf("weight for query %q must be >= 0", name)
+		}
+		found := false
+		for i := range queries {
+			if queries[i].Name == name {
+				queries[i].Weight = weight
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown query %q in workload weights", name)
+		}
+	}
+	return nil
+}
+
+// validateConfig catches settings that would otherwise panic mid-run.
+func validateConfig() error {
+	if config.SessionCount <= 0 {
+		return fmt.Errorf("sessions must be > 0")
+	}
+	if config.Duration <= 0 {
+		return fmt.Errorf("duration must be > 0")
+	}
+	if config.ChurnFraction < 0 || config.ChurnFraction > 1 {
+		return fmt.Errorf("churn must be a fraction between 0 and 1")
+	}
+	if config.HintsEnabled && (config.HintRatio <= 0 || config.HintRatio >= 1) {
+		return fmt.Errorf("hint ratio must be between 0 and 1 (exclusive) to compare both variants")
+	}
+	if config.OLTPPercent < 0 || config.OLTPPercent > 100 {
+		return fmt.Errorf("oltp_percent must be between 0 and 100")
+	}
+	if config.PlanCheckEnabled && config.PlanCheckInterval <= 0 {
+		return fmt.Errorf("plan_check.interval must be > 0 when plan checks are enabled")
+	}
+	if config.ExplainAnalyze && !config.PlanCheckEnabled {
+		return fmt.Errorf("explain_analyze sampling runs on the plan check schedule; enable plan_check")
+	}
+	if config.AnalyzeOnPlanChange && !config.PlanCheckEnabled {
+		return fmt.Errorf("analyze_on_change reacts to plan checks; enable plan_check")
+	}
+	if config.PlanHistory && (!config.PlanCheckEnabled || config.PlanHistoryTable == "") {
+		return fmt.Errorf("persist_history needs plan_check enabled and a history_table")
+	}
+	if config.IndexDDL != "" && (config.IndexAfter <= 0 || config.IndexAfter >= config.Duration) {
+		return fmt.Errorf("index.after must be > 0 and shorter than the run so there are before and after windows")
+	}
+	if config.OutboxWriters < 0 {
+		return fmt.Errorf("outbox.writers must be >= 0")
+	}
+	if config.OutboxWriters > 0 && (config.OutboxRelays <= 0 || config.OutboxBatch <= 0 || config.OutboxRelayInterval <= 0 || config.OutboxPayload < 0) {
+		return fmt.Errorf("outbox needs relays > 0, batch > 0, poll_interval > 0 and payload_bytes >= 0")
+	}
+	if n := len(config.StmtCacheModes); n > 0 {
+		for _, m := range config.StmtCacheModes {
+			if _, err := parseStmtCacheMode(m); err != nil {
+				return err
+			}
+		}
+		if config.Duration/time.Duration(n) < 10*time.Second {
+			return fmt.Errorf("stmt_cache: %d modes leave phases under 10s; lengthen the run", n)
+		}
+	}
+	if config.ChaosInterval < 0 {
+		return fmt.Errorf("chaos.interval must be >= 0")
+	}
+	if config.ChaosInterval > 0 {
+		if config.ChaosInterval >= config.Duration {
+			return fmt.Errorf("chaos.interval must be shorter than the run")
+		}
+		if config.ChaosTerminatePct < 0 || config.ChaosTerminatePct > 1 {
+			return fmt.Errorf("chaos.terminate_pct must be a fraction between 0 and 1")
+		}
+		if config.ChaosRetries < 0 || config.ChaosRetryBackoff < 0 {
+			return fmt.Errorf("chaos.retries and chaos.retry_backoff must be >= 0")
+		}
+	}
+	for _, spec := range config.ProxyFaults {
+		f, err := parseProxyFault(spec)
+		if err != nil {
+			return err
+		}
+		if f.At >= config.Duration {
+			return fmt.Errorf("proxy: fault %q starts after the run ends", spec)
+		}
+	}
+	if (config.ProxyEnabled || len(config.ProxyFaults) > 0) && config.ProxyListen == "" {
+		return fmt.Errorf("proxy.listen must be set when the proxy is enabled")
+	}
+	if len(config.Toxics) > 0 && config.ToxiproxyAPI == "" {
+		return fmt.Errorf("toxiproxy.toxics need toxiproxy.api")
+	}
+	if config.ToxiproxyAPI != "" {
+		if config.ProxyEnabled || len(config.ProxyFaults) > 0 {
+			return fmt.Errorf("route through either the built-in proxy or toxiproxy, not both")
+		}
+		if config.ToxiproxyProxy == "" || config.ToxiproxyListen == "" {
+			return fmt.Errorf("toxiproxy needs a proxy name and a listen address")
+		}
+		names := make(map[string]bool)
+		for i, t := range config.Toxics {
+			if t.Name == "" {
+				t.Name = fmt.Sprintf("%s_%d", t.Type, i)
+			}
+			if err := validateToxic(t); err != nil {
+				return err
+			}
+			if names[t.Name] {
+				return fmt.Errorf("toxiproxy: duplicate toxic name %q", t.Name)
+			}
+			names[t.Name] = true
+		}
+	}
+	if config.TempSessions < 0 {
+		return fmt.Errorf("temp_pressure.sessions must be >= 0")
+	}
+	if config.TempSessions > 0 {
+		if config.TempAfter <= 0 || config.TempAfter >= config.Duration {
+			return fmt.Errorf("temp_pressure.after must be > 0 and shorter than the run so there is a baseline and a pressure window")
+		}
+		if _, err := parseByteSize(config.TempSpillSize); err != nil {
+			return fmt.Errorf("temp_pressure.spill_size: %w", err)
+		}
+		if config.TempWorkMem == "" {
+			return fmt.Errorf("temp_pressure.work_mem must be set")
+		}
+	}
+	if len(config.WorkMemValues) > 0 {
+		if len(config.WorkMemValues) < 2 {
+			return fmt.Errorf("work_mem_sweep.values needs at least two values to compare")
+		}
+		if config.WorkMemRepeats < 1 {
+			return fmt.Errorf("work_mem_sweep.repeats must be >= 1")
+		}
+		seen := make(map[int64]string)
+		for _, v := range config.WorkMemValues {
+			b, err := parseByteSize(v)
+			if err != nil {
+				return fmt.Errorf("work_mem_sweep.values: %q: %w", v, err)
+			}
+			if b < 64<<10 {
+				return fmt.Errorf("work_mem_sweep.values: %q is below the 64kB minimum", v)
+			}
+			if prev, ok := seen[b]; ok {
+				return fmt.Errorf("work_mem_sweep.values: %q and %q are the same size", prev, v)
+			}
+			seen[b] = v
+		}
+	}
+	if len(config.CostRandomPageCosts) > 0 || len(config.CostCacheSizes) > 0 {
+		if config.CostRepeats < 1 {
+			return fmt.Errorf("cost_sweep.repeats must be >= 1")
+		}
+		seenRPC := make(map[float64]string)
+		for _, c := range config.CostRandomPageCosts {
+			rpc, err := strconv.ParseFloat(c, 64)
+			if err != nil || rpc <= 0 {
+				return fmt.Errorf("cost_sweep.random_page_cost: %q must be a number > 0", c)
+			}
+			if prev, ok := seenRPC[rpc]; ok {
+				return fmt.Errorf("cost_sweep.random_page_cost: %q and %q are the same value", prev, c)
+			}
+			seenRPC[rpc] = c
+		}
+		seenECS := make(map[int64]string)
+		for _, ecs := range config.CostCacheSizes {
+			b, err := parseByteSize(ecs)
+			if err != nil {
+				return fmt.Errorf("cost_sweep.effective_cache_size: %q: %w", ecs, err)
+			}
+			if prev, ok := seenECS[b]; ok {
+				return fmt.Errorf("cost_sweep.effective_cache_size: %q and %q are the same size", prev, ecs)
+			}
+			seenECS[b] = ecs
+		}
+	}
+	if config.DriftWriters < 0 {
+		return fmt.Errorf("stale_stats.writers must be >= 0")
+	}
+	if config.DriftWriters > 0 {
+		if config.Profile != "" {
+			return fmt.Errorf("stale_stats inserts into the financial_transactions schema; it cannot run with a workload profile")
+		}
+		if !config.PlanCheckEnabled {
+			return fmt.Errorf("stale_stats reports plan changes from the plan monitor; enable plan_check")
+		}
+		if config.DriftBatch < 1 {
+			return fmt.Errorf("stale_stats.batch must be >= 1")
+		}
+		if config.DriftAfter <= 0 || config.DriftAnalyzeAfter <= 0 || config.DriftAfter+config.DriftAnalyzeAfter >= config.Duration {
+			return fmt.Errorf("stale_stats.after and analyze_after must be > 0 and together shorter than the run so there is a baseline, a drift and a recovery window")
+		}
+		if config.DriftSampleInterval <= 0 {
+			return fmt.Errorf("stale_stats.sample_interval must be > 0")
+		}
+	}
+	if config.AnalyzeCooldown < 0 {
+		return fmt.Errorf("plan_check.analyze_cooldown must be >= 0")
+	}
+
+	var needTypes []string
+	switch config.WorkloadType {
+	case "oltp", "analytics":
+		needTypes = []string{config.WorkloadType}
+	case "mixed":
+		if config.OLTPPercent > 0 {
+			needTypes = append(needTypes, "oltp")
+		}
+		if config.OLTPPercent < 100 {
+			needTypes = append(needTypes, "analytics")
+		}
+	default:
+		return fmt.Errorf("unknown workload type %q (use oltp, analytics, mixed)", config.WorkloadType)
+	}
+	for _, t := range needTypes {
+		total := 0
+		for _, q := range queries {
+			if q.Type == t {
+				total += q.Weight
+			}
+		}
+		if total == 0 {
+			return fmt.Errorf("workload %q needs at least one %s query with weight > 0", config.WorkloadType, t)
+		}
+	}
+
+	for name := range config.SLOs {
+		if _, ok := queryByName(name); !ok {
+			return fmt.Errorf("SLO defined for unknown query %q", name)
+		}
+	}
+	return nil
+}
+
+func queryByName(name string) (Query, bool) {
+	for _, q := range queries {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return Query{}, false
+}
+
+// resolvedRunConfig captures the effective settings (defaults + file + flags)
+// in config file form.
+func resolvedRunConfig() RunConfig {
+	weights := make(map[string]int, len(queries))
+	hints := make(map[string]string)
+	for _, q := range queries {
+		weights[q.Name] = q.Weight
+		if q.Hint != "" {
+			hints[q.Name] = q.Hint
+		}
+	}
+
+	return RunConfig{
+		DSN:            config.DBConnString,
+		Table:          config.TableName,
+		TotalRows:      config.TotalRows,
+		Sessions:       config.SessionCount,
+		Burst:          config.BurstSessions,
+		Churn:          config.ChurnFraction,
+		Duration:       config.Duration,
+		ReportInterval: config.ReportInterval,
+		Workload: WorkloadSpec{
+			Type:           config.WorkloadType,
+			Profile:        config.Profile,
+			OLTPPercent:    config.OLTPPercent,
+			TopCustomerPct: config.TopCustomerPct,
+			Weights:        weights,
+		},
+		SLOs: config.SLOs,
+		PlanCheck: PlanCheckSpec{
+			Enabled:         config.PlanCheckEnabled,
+			Interval:        config.PlanCheckInterval,
+			ExplainAnalyze:  config.ExplainAnalyze,
+			AnalyzeOnChange: config.AnalyzeOnPlanChange,
+			AnalyzeCooldown: config.AnalyzeCooldown,
+			PersistHistory:  config.PlanHistory,
+			HistoryTable:    config.PlanHistoryTable,
+		},
+		Hints: HintSpec{
+			Enabled: config.HintsEnabled,
+			Ratio:   config.HintRatio,
+			Queries: hints,
+		},
+		Index: IndexSpec{
+			Create: config.IndexDDL,
+			After:  config.IndexAfter,
+			Keep:   config.IndexKeep,
+		},
+		Outbox: OutboxSpec{
+			Writers:      config.OutboxWriters,
+			Relays:       config.OutboxRelays,
+			Batch:        config.OutboxBatch,
+			PollInterval: config.OutboxRelayInterval,
+			PayloadBytes: config.OutboxPayload,
+		},
+		StmtCache: StmtCacheSpec{Modes: config.StmtCacheModes},
+		Chaos: ChaosSpec{
+			Interval:     config.ChaosInterval,
+			TerminatePct: config.ChaosTerminatePct,
+			Retries:      config.ChaosRetries,
+			RetryBackoff: config.ChaosRetryBackoff,
+		},
+		Proxy: ProxySpec{
+			Enabled: config.ProxyEnabled,
+			Listen:  config.ProxyListen,
+			Faults:  config.ProxyFaults,
+		},
+		Toxiproxy: ToxiproxySpec{
+			API:      config.ToxiproxyAPI,
+			Proxy:    config.ToxiproxyProxy,
+			Listen:   config.ToxiproxyListen,
+			Upstream: config.ToxiproxyUpstream,
+			Toxics:   config.Toxics,
+		},
+		TempPressure: TempSpec{
+			Sessions:      config.TempSessions,
+			SpillSize:     config.TempSpillSize,
+			WorkMem:       config.TempWorkMem,
+			TempFileLimit: config.TempFileLimit,
+			After:         config.TempAfter,
+		},
+		WorkMemSweep: WorkMemSpec{
+			Values:  config.WorkMemValues,
+			Repeats: config.WorkMemRepeats,
+		},
+		CostSweep: CostSweepSpec{
+			RandomPageCost:     config.CostRandomPageCosts,
+			EffectiveCacheSize: config.CostCacheSizes,
+			Repeats:            config.CostRepeats,
+		},
+		StaleStats: StaleStatsSpec{
+			Writers:        config.DriftWriters,
+			Batch:          config.DriftBatch,
+			After:          config.DriftAfter,
+			AnalyzeAfter:   config.DriftAnalyzeAfter,
+			SampleInterval: config.DriftSampleInterval,
+			Keep:           config.DriftKeep,
+		},
+		Output: OutputSpec{
+			ReportJSON:  config.ReportJSON,
+			MetricsAddr: config.MetricsAddr,
+		},
+	}
+}
+
+// resolvedConfigYAML renders the resolved config for the report with the
+// DSN password masked.
+func resolvedConfigYAML() string {
+	rc := resolvedRunConfig()
+	rc.DSN = maskDSN(rc.DSN)
+
+	out, err := yaml.Marshal(rc)
+	if err != nil {
+		return fmt.Sprintf("# failed to render config: %v\n", err)
+	}
+	return string(out)
+}
+
+var dsnPasswordRe = regexp.MustCompile(`password=\S+`)
+
+func maskDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			return u.String()
+		}
+		return dsn
+	}
+	return dsnPasswordRe.ReplaceAllString(dsn, "password=xxxxx")
+}
+
+// ============================================================================
+// SLO EVALUATION
+// ============================================================================
+
+type SLOResult struct {
+	Query    string `json:"query"`
+	Check    string `json:"check"`
+	Target   string `json:"target"`
+	Observed string `json:"observed"`
+	Passed   bool   `json:"passed"`
+}
+
+func (m *Metrics) EvaluateSLOs() []SLOResult {
+	var results []SLOResult
+
+	names := make([]string, 0, len(config.SLOs))
+	for name := range config.SLOs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		slo := config.SLOs[name]
+		qm, ok := m.queryMetrics[name]
+		if !ok {
+			continue
+		}
+		s := qm.Summary()
+
+		if slo.P95 > 0 {
+			results = append(results, SLOResult{
+				Query: name, Check: "p95",
+				Target: slo.P95.String(), Observed: s.P95.String(),
+				Passed: s.Count > 0 && s.P95 <= slo.P95,
+			})
+		}
+		if slo.P99 > 0 {
+			results = append(results, SLOResult{
+				Query: name, Check: "p99",
+				Target: slo.P99.String(), Observed: s.P99.String(),
+				Passed: s.Count > 0 && s.P99 <= slo.P99,
+			})
+		}
+		if slo.MaxErrorPct > 0 {
+			results = append(results, SLOResult{
+				Query: name, Check: "error_pct",
+				Target:   fmt.Sprintf("%.2f%%", slo.MaxErrorPct),
+				Observed: fmt.Sprintf("%.2f%%", s.ErrorPct()),
+				Passed:   s.ErrorPct() <= slo.MaxErrorPct,
+			})
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,221 @@
+package main
+
+// ============================================================================
+// TEMP-FILE SPILL DETECTION
+// ============================================================================
+//
+// Two views of the same problem:
+//   - database-wide temp_files/temp_bytes deltas from pg_stat_database
+//     (everything that spilled during the run, including other clients)
+//   - per-query spills seen in EXPLAIN ANALYZE samples: Sort "Disk",
+//     Hash with more than one batch, HashAggregate disk usage, Storage: Disk
+//
+// The per-query view is what work_mem tuning should be based on.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type QuerySpillStats struct {
+	Samples      int64
+	SpillSamples int64
+	MaxSpillKB   int64           // Largest on-disk footprint seen in one sample
+	MaxTempBlks  int64           // Largest "Temp Written Blocks" in one sample
+	SpillNodes   map[string]bool // e.g. "Sort (external merge)", "Hash (8 batches)"
+}
+
+type SpillTracker struct {
+	queries map[string]*QuerySpillStats
+	mu      sync.Mutex
+
+	tempFilesStart int64
+	tempBytesStart int64
+	tempFilesEnd   int64
+	tempBytesEnd   int64
+	dbStatsOK      bool
+}
+
+var spillTracker = &SpillTracker{queries: make(map[string]*QuerySpillStats)}
+
+// Record inspects one EXPLAIN ANALYZE result for nodes that went to disk.
+func (st *SpillTracker) Record(queryName string, result *ExplainResult) {
+	spillKB, nodes := planSpills(result)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	qs, ok := st.queries[queryName]
+	if !ok {
+		qs = &QuerySpillStats{SpillNodes: make(map[string]bool)}
+		st.queries[queryName] = qs
+	}
+
+	qs.Samples++
+	if result.Plan.TempWrittenBlocks > qs.MaxTempBlks {
+		qs.MaxTempBlks = result.Plan.TempWrittenBlocks
+	}
+	if len(nodes) == 0 && result.Plan.TempWrittenBlocks == 0 {
+		return
+	}
+
+	qs.SpillSamples++
+	if spillKB > qs.MaxSpillKB {
+		qs.MaxSpillKB = spillKB
+	}
+	for _, n := range nodes {
+		qs.SpillNodes[strings.TrimSpace(n)] = true
+	}
+}
+
+// planSpills sums the on-disk footprint of the nodes in one EXPLAIN
+// ANALYZE result that went to disk and names them.
+func planSpills(result *ExplainResult) (spillKB int64, nodes []string) {
+	result.Plan.walk(func(n *PlanNode) {
+		switch {
+		case n.SortSpaceType == "Disk":
+			spillKB += n.SortSpaceUsedKB
+			nodes = append(nodes, fmt.Sprintf("%s (%s)", n.NodeType, n.SortMethod))
+		case n.NodeType == "Hash" && n.HashBatches > 1:
+			spillKB += n.PeakMemoryKB * n.HashBatches
+			nodes = append(nodes, fmt.Sprintf("Hash (%d batches)", n.HashBatches))
+		case n.DiskUsageKB > 0:
+			spillKB += n.DiskUsageKB
+			nodes = append(nodes, fmt.Sprintf("%s %s (%d batches)", n.Strategy, n.NodeType, n.HashAggBatches))
+		case n.StorageType == "Disk":
+			spillKB += n.MaxStorageKB
+			nodes = append(nodes, n.NodeType)
+		}
+	})
+	return spillKB, nodes
+}
+
+// SampleDatabaseTemp records pg_stat_database temp counters at the start
+// (start=true) or end of the run.
+func (st *SpillTracker) SampleDatabaseTemp(ctx context.Context, pool *pgxpool.Pool, start bool) {
+	var files, bytes int64
+	err := pool.QueryRow(ctx, `
+		SELECT temp_files, temp_bytes FROM pg_stat_database WHERE datname = current_database()
+	`).Scan(&files, &bytes)
+	if err != nil {
+		return
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if start {
+		st.tempFilesStart, st.tempBytesStart = files, bytes
+	} else {
+		st.tempFilesEnd, st.tempBytesEnd = files, bytes
+		st.dbStatsOK = true
+	}
+}
+
+// suggestedWorkMemMB is a rough starting point: an in-memory sort/hash
+// needs noticeably more than its on-disk footprint, so double it and round
+// up to a power of two.
+func suggestedWorkMemMB(spillKB int64) int64 {
+	need := spillKB * 2 / 1024
+	mb := int64(1)
+	for mb < need {
+		mb *= 2
+	}
+	return mb
+}
+
+type SpillReport struct {
+	TempFiles int64                    `json:"db_temp_files"`
+	TempBytes int64                    `json:"db_temp_bytes"`
+	Queries   map[string]QuerySpillRow `json:"queries"`
+}
+
+type QuerySpillRow struct {
+	Samples            int64    `json:"samples"`
+	SpillSamples       int64    `json:"spill_samples"`
+	MaxSpillKB         int64    `json:"max_spill_kb"`
+	MaxTempBlocks      int64    `json:"max_temp_written_blocks"`
+	SpillNodes         []string `json:"spill_nodes,omitempty"`
+	SuggestedWorkMemMB int64    `json:"suggested_work_mem_mb,omitempty"`
+}
+
+func (st *SpillTracker) Report() *SpillReport {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	r := &SpillReport{Queries: make(map[string]QuerySpillRow)}
+	if st.dbStatsOK {
+		r.TempFiles = st.tempFilesEnd - st.tempFilesStart
+		r.TempBytes = st.tempBytesEnd - st.tempBytesStart
+	}
+
+	for name, qs := range st.queries {
+		row := QuerySpillRow{
+			Samples:       qs.Samples,
+			SpillSamples:  qs.SpillSamples,
+			MaxSpillKB:    qs.MaxSpillKB,
+			MaxTempBlocks: qs.MaxTempBlks,
+		}
+		for n := range qs.SpillNodes {
+			row.SpillNodes = append(row.SpillNodes, n)
+		}
+		sort.Strings(row.SpillNodes)
+		if qs.MaxSpillKB > 0 {
+			row.SuggestedWorkMemMB = suggestedWorkMemMB(qs.MaxSpillKB)
+		}
+		r.Queries[name] = row
+	}
+	return r
+}
+
+func (st *SpillTracker) PrintReport() {
+	r := st.Report()
+
+	fmt.Printf("\n💽 Temp File Spills:\n")
+	fmt.Printf("   Database temp files:  %d (%s written, pg_stat_database delta)\n",
+		r.TempFiles, formatBytes(r.TempBytes))
+
+	if len(r.Queries) == 0 {
+		fmt.Println("   No EXPLAIN ANALYZE samples collected (enable -explain-analyze)")
+		return
+	}
+
+	names := make([]string, 0, len(r.Queries))
+	for name := range r.Queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("   %-28s %8s %8s %12s %12s  %s\n", "Query", "Samples", "Spilled", "Max Spill", "work_mem >=", "Nodes")
+	for _, name := range names {
+		row := r.Queries[name]
+		if row.SpillSamples == 0 {
+			fmt.Printf("   ✅ %-25s %8d %8d\n", name, row.Samples, 0)
+			continue
+		}
+		suggestion := "-"
+		if row.SuggestedWorkMemMB > 0 {
+			suggestion = fmt.Sprintf("%dMB", row.SuggestedWorkMemMB)
+		}
+		fmt.Printf("   ⚠️  %-24s %8d %8d %12s %12s  %s\n",
+			name, row.Samples, row.SpillSamples, formatBytes(row.MaxSpillKB*1024),
+			suggestion, strings.Join(row.SpillNodes, ", "))
+	}
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,575 @@
+package main
+
+// ============================================================================
+// STALE-STATISTICS DRIFT EXPERIMENT (-drift-writers=N)
+// ============================================================================
+//
+// What happens between a big data change and the next ANALYZE, and how fast
+// does the workload recover once statistics catch up? The experiment turns
+// autovacuum off on the target table and ANALYZEs it, so the run starts with
+// fresh statistics. After stale_stats.after of baseline load,
+// stale_stats.writers sessions insert batches of skewed rows: all for the
+// hottest customer and account (id 1 under the Zipf generator), dated today,
+// pending, flagged, with a high risk score and an amount above 10000. Every
+// predicate the OLTP queries filter on drifts away from what pg_statistic
+// says. After stale_stats.analyze_after of drift the writers stop and the
+// table is ANALYZEd once more.
+//
+// The plan monitor (plan_check, required) reports each plan change with its
+// offset and phase. Every stale_stats.sample_interval the experiment also
+// samples the table (live tuples vs reltuples, n_mod_since_analyze) and runs
+// the read-only OLTP queries once for the hot ids under EXPLAIN (ANALYZE,
+// TIMING OFF), recording the worst row-estimate error of any node (q-error:
+// the larger of estimate/actual and actual/estimate). The workload's latency
+// is bucketed by the same interval. The report has, per query, latency in
+// the baseline, drift and after-ANALYZE phases, when it degraded (median
+// latency over 2x baseline) and when it recovered (back within 1.2x), and
+// the estimate error before, at its worst and after ANALYZE.
+//
+// At the end autovacuum is restored to what it was and, unless
+// stale_stats.keep is set, the inserted rows (processed_by =
+// 'dbre_stress_drift') are deleted and the table ANALYZEd again. The inserts
+// target the financial_transactions schema and use gen_random_uuid()
+// (PostgreSQL 13+, or pgcrypto).
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	driftPhaseBaseline int32 = iota
+	driftPhaseDrift
+	driftPhaseAfter
+)
+
+var driftPhaseNames = []string{"baseline", "drift", "after ANALYZE"}
+
+const (
+	driftCustomerID = 1 // Hottest under the Zipf generator
+	driftAccountID  = 1
+	driftMarker     = "dbre_stress_drift"
+
+	driftDegradeFactor = 2.0 // Median latency this far over baseline is degraded
+	driftRecoverFactor = 1.2 // and back within this is recovered
+)
+
+// driftBucket is the workload's latency over one sample interval.
+type driftBucket struct {
+	start   time.Duration // Offset from the start of the experiment
+	phase   int32
+	queries map[string]*QueryMetrics
+}
+
+// DriftSample is one look at the table and the estimates.
+type DriftSample struct {
+	OffsetSec        float64            `json:"offset_sec"`
+	Phase            string             `json:"phase"`
+	LiveTuples       int64              `json:"live_tuples"`
+	RelTuples        float64            `json:"reltuples"` // What the planner scales from
+	ModsSinceAnalyze int64              `json:"n_mod_since_analyze"`
+	QError           map[string]float64 `json:"q_error"` // Worst node per query
+}
+
+// DriftPlanChange is a plan change the plan monitor saw.
+type DriftPlanChange struct {
+	OffsetSec float64 `json:"offset_sec"`
+	Phase     string  `json:"phase"`
+	Query     string  `json:"query"`
+	FromPlan  string  `json:"from_plan"`
+	ToPlan    string  `json:"to_plan"`
+	Outline   string  `json:"outline"` // Nodes of the new plan
+}
+
+type StaleStats struct {
+	table       string // Quoted
+	insertSQL   string
+	phase       int32
+	start       time.Time
+	analyzeAt   time.Duration
+	analyzeTook time.Duration
+	analyzeErr  string
+	inserted    int64 // Atomic
+	writeErrors int64 // Atomic
+	oltp        []Query
+	phases      [3]map[string]*QueryMetrics
+	buckets     []*driftBucket
+	samples     []DriftSample
+	changes     []DriftPlanChange
+	reloptions  []string // autovacuum options before the run
+	restored    bool
+	deleted     int64
+	cleanupErr  string
+	mu          sync.Mutex
+}
+
+var staleStats *StaleStats
+
+func newStaleStats() *StaleStats {
+	ss := &StaleStats{
+		table: pgx.Identifier(strings.Split(config.TableName, ".")).Sanitize(),
+		start: time.Now(),
+	}
+	ss.insertSQL = fmt.Sprintf(`
+		INSERT INTO %s (external_txn_id, transaction_date, amount, amount_usd, transaction_type,
+			transaction_status, payment_method, account_id, customer_id, country_code, region,
+			risk_score, is_flagged, fraud_check_status, processed_by)
+		SELECT gen_random_uuid(), CURRENT_DATE, 10000 + g %% 5000, 10000 + g %% 5000, 'purchase',
+			'pending', 'card', $2, $3, 'US', 'North America',
+			95, true, 'review', '%s'
+		FROM generate_series(1, $1::int) g`, ss.table, driftMarker)
+	for i := range ss.phases {
+		ss.phases[i] = make(map[string]*QueryMetrics)
+	}
+	for _, q := range queries {
+		if q.Type == "oltp" && q.Weight > 0 && isReadOnlyQuery(q) {
+			ss.oltp = append(ss.oltp, q)
+		}
+	}
+	ss.buckets = []*driftBucket{{queries: make(map[string]*QueryMetrics)}}
+	return ss
+}
+
+// driftParams are the query's parameters pointed at the ids the drift
+// piles rows onto.
+func driftParams(q Query) []interface{} {
+	switch q.Name {
+	case "customer_recent":
+		return []interface{}{int64(driftCustomerID)}
+	case "account_status_check":
+		return []interface{}{int64(driftAccountID)}
+	}
+	return generateQueryParams(q)
+}
+
+func (ss *StaleStats) offset() time.Duration {
+	return time.Since(ss.start)
+}
+
+// Record files one execution under the current phase and bucket. Called
+// from Metrics.RecordQuery for every query the workers run.
+func (ss *StaleStats) Record(queryName string, d time.Duration, err error) {
+	ss.mu.Lock()
+	phase := ss.phases[atomic.LoadInt32(&ss.phase)]
+	pm, ok := phase[queryName]
+	if !ok {
+		pm = &QueryMetrics{Name: queryName}
+		phase[queryName] = pm
+	}
+	b := ss.buckets[len(ss.buckets)-1]
+	bm, ok := b.queries[queryName]
+	if !ok {
+		bm = &QueryMetrics{Name: queryName}
+		b.queries[queryName] = bm
+	}
+	ss.mu.Unlock()
+
+	recordLatency(pm, d, err)
+	recordLatency(bm, d, err)
+}
+
+// planChanged is called by the plan monitor when a query switches plans.
+func (ss *StaleStats) planChanged(queryName, prevHash, planText string) {
+	c := DriftPlanChange{
+		OffsetSec: ss.offset().Seconds(),
+		Phase:     driftPhaseNames[atomic.LoadInt32(&ss.phase)],
+		Query:     queryName,
+		FromPlan:  prevHash,
+		ToPlan:    hashPlanStructure(planText),
+		Outline:   planOutline(planText),
+	}
+	ss.mu.Lock()
+	ss.changes = append(ss.changes, c)
+	ss.mu.Unlock()
+	fmt.Printf("\n🧊 [+%v %s] %s switched plans %s → %s: %s\n",
+		ss.offset().Round(time.Second), c.Phase, queryName, shortHash(c.FromPlan), shortHash(c.ToPlan), c.Outline)
+}
+
+func (ss *StaleStats) setPhase(phase int32) {
+	ss.mu.Lock()
+	ss.buckets = append(ss.buckets, &driftBucket{start: ss.offset(), phase: phase, queries: make(map[string]*QueryMetrics)})
+	ss.mu.Unlock()
+	atomic.StoreInt32(&ss.phase, phase)
+}
+
+// setup turns autovacuum off on the table, remembering the old options,
+// and ANALYZEs it so the baseline starts from fresh statistics.
+func (ss *StaleStats) setup(ctx context.Context, pool *pgxpool.Pool) error {
+	var opts []string
+	err := pool.QueryRow(ctx, `
+		SELECT coalesce(array_agg(o) FILTER (WHERE o LIKE 'autovacuum_enabled=%'), '{}')
+		FROM pg_class c LEFT JOIN LATERAL unnest(c.reloptions) o ON true
+		WHERE c.oid = $1::regclass`, config.TableName).Scan(&opts)
+	if err != nil {
+		return fmt.Errorf("stale_stats: reading %s options: %w", config.TableName, err)
+	}
+	if _, err := pool.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s SET (autovacuum_enabled = off)`, ss.table)); err != nil {
+		return fmt.Errorf("stale_stats: disabling autovacuum on %s: %w", config.TableName, err)
+	}
+	ss.reloptions = opts
+	if _, err := pool.Exec(ctx, "ANALYZE "+ss.table); err != nil {
+		return fmt.Errorf("stale_stats: ANALYZE %s: %w", config.TableName, err)
+	}
+	ss.mu.Lock()
+	ss.start = time.Now()
+	ss.buckets = []*driftBucket{{queries: make(map[string]*QueryMetrics)}}
+	ss.mu.Unlock()
+	return nil
+}
+
+// runStaleStats samples through the baseline, drives the writers through
+// the drift window, ANALYZEs and keeps sampling until the run ends.
+func runStaleStats(ctx context.Context, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ss := staleStats
+
+	ticker := time.NewTicker(config.DriftSampleInterval)
+	defer ticker.Stop()
+	driftStart := time.After(config.DriftAfter)
+	var analyze <-chan time.Time
+	writeCtx, stopWriters := context.WithCancel(ctx)
+	defer stopWriters()
+	var writers sync.WaitGroup
+
+	ss.sample(ctx, pool)
+	for {
+		select {
+		case <-ctx.Done():
+			writers.Wait()
+			return
+		case <-ticker.C:
+			ss.mu.Lock()
+			ss.buckets = append(ss.buckets, &driftBucket{start: ss.offset(), phase: atomic.LoadInt32(&ss.phase), queries: make(map[string]*QueryMetrics)})
+			ss.mu.Unlock()
+			ss.sample(ctx, pool)
+		case <-driftStart:
+			ss.setPhase(driftPhaseDrift)
+			fmt.Printf("\n🧊 Stale stats: autovacuum off on %s, %d writers inserting skewed rows (customer %d, account %d) for %v\n",
+				config.TableName, config.DriftWriters, driftCustomerID, driftAccountID, config.DriftAnalyzeAfter)
+			for i := 0; i < config.DriftWriters; i++ {
+				writers.Add(1)
+				go ss.runWriter(writeCtx, i, pool, &writers)
+			}
+			analyze = time.After(config.DriftAnalyzeAfter)
+		case <-analyze:
+			stopWriters()
+			writers.Wait()
+			ss.analyze(ctx, pool)
+			ss.sample(ctx, pool)
+		}
+	}
+}
+
+func (ss *StaleStats) runWriter(ctx context.Context, workerID int, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for ctx.Err() == nil {
+		tag, err := pool.Exec(ctx, ss.insertSQL, config.DriftBatch, int64(driftAccountID), int64(driftCustomerID))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if atomic.AddInt64(&ss.writeErrors, 1) == 1 {
+				log.Printf("Drift writer %d: %v", workerID, err)
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		atomic.AddInt64(&ss.inserted, tag.RowsAffected())
+	}
+}
+
+func (ss *StaleStats) analyze(ctx context.Context, pool *pgxpool.Pool) {
+	at := ss.offset()
+	start := time.Now()
+	_, err := pool.Exec(ctx, "ANALYZE "+ss.table)
+	took := time.Since(start)
+
+	ss.mu.Lock()
+	ss.analyzeAt, ss.analyzeTook = at, took
+	if err != nil {
+		ss.analyzeErr = err.Error()
+	}
+	ss.mu.Unlock()
+	ss.setPhase(driftPhaseAfter)
+	if err != nil {
+		fmt.Printf("\n🧊 Stale stats: ANALYZE %s failed: %v\n", config.TableName, err)
+		return
+	}
+	fmt.Printf("\n🧊 Stale stats: writers stopped after %d rows, ANALYZE %s took %v\n",
+		atomic.LoadInt64(&ss.inserted), config.TableName, took.Round(time.Millisecond))
+}
+
+// sample reads the table's statistics and the worst row-estimate error of
+// each OLTP query for the hot ids.
+func (ss *StaleStats) sample(ctx context.Context, pool *pgxpool.Pool) {
+	s := DriftSample{
+		OffsetSec: ss.offset().Seconds(),
+		Phase:     driftPhaseNames[atomic.LoadInt32(&ss.phase)],
+		QError:    make(map[string]float64),
+	}
+	err := pool.QueryRow(ctx, `
+		SELECT s.n_live_tup, c.reltuples::float8, s.n_mod_since_analyze
+		FROM pg_stat_user_tables s JOIN pg_class c ON c.oid = s.relid
+		WHERE s.relid = $1::regclass`, config.TableName).Scan(&s.LiveTuples, &s.RelTuples, &s.ModsSinceAnalyze)
+	if err != nil {
+		return
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Release()
+	for _, q := range ss.oltp {
+		result, err := explainAnalyzeNoTiming(ctx, conn.Conn(), q.SQL, driftParams(q))
+		if err != nil {
+			continue
+		}
+		s.QError[q.Name] = worstQError(&result.Plan)
+	}
+
+	ss.mu.Lock()
+	ss.samples = append(ss.samples, s)
+	ss.mu.Unlock()
+}
+
+// worstQError is the largest row-estimate error of any node in the plan.
+// Estimates and actuals are per loop; both are floored at one row.
+func worstQError(plan *PlanNode) float64 {
+	worst := 1.0
+	plan.walk(func(n *PlanNode) {
+		if n.ActualLoops == 0 {
+			return // Never executed
+		}
+		est, act := math.Max(n.PlanRows, 1), math.Max(n.ActualRows, 1)
+		worst = math.Max(worst, math.Max(est/act, act/est))
+	})
+	return worst
+}
+
+// finish restores autovacuum and deletes the inserted rows unless they
+// should be kept. Runs after the workers have stopped, on the parent
+// context.
+func (ss *StaleStats) finish(ctx context.Context, pool *pgxpool.Pool) {
+	restore := `ALTER TABLE ` + ss.table + ` RESET (autovacuum_enabled)`
+	if len(ss.reloptions) > 0 {
+		restore = `ALTER TABLE ` + ss.table + ` SET (` + strings.Join(ss.reloptions, ", ") + `)`
+	}
+	if _, err := pool.Exec(ctx, restore); err != nil {
+		fmt.Printf("\n⚠️  Failed to restore autovacuum on %s: %v\n", config.TableName, err)
+	} else {
+		ss.restored = true
+	}
+
+	if config.DriftKeep {
+		fmt.Printf("\n🧊 Keeping the drift rows in %s (stale_stats.keep); remove them with DELETE ... WHERE processed_by = '%s'\n",
+			config.TableName, driftMarker)
+		return
+	}
+	tag, err := pool.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE processed_by = '%s'`, ss.table, driftMarker))
+	if err == nil {
+		ss.deleted = tag.RowsAffected()
+		_, err = pool.Exec(ctx, "ANALYZE "+ss.table)
+	}
+	if err != nil {
+		ss.cleanupErr = err.Error()
+		fmt.Printf("\n⚠️  Failed to remove the drift rows from %s: %v\n", config.TableName, err)
+		return
+	}
+	fmt.Printf("\n🧊 Deleted %d drift rows from %s and re-ANALYZEd it\n", ss.deleted, config.TableName)
+}
+
+// DriftQueryRow is one query across the phases.
+type DriftQueryRow struct {
+	Query             string     `json:"query"`
+	P50Ms             [3]float64 `json:"p50_ms"` // baseline, drift, after ANALYZE
+	P95Ms             [3]float64 `json:"p95_ms"`
+	Counts            [3]int64   `json:"counts"`
+	DegradedAtSec     float64    `json:"degraded_at_sec,omitempty"`     // First bucket over 2x baseline p50
+	RecoveredAfterSec float64    `json:"recovered_after_sec,omitempty"` // From the ANALYZE to the first bucket within 1.2x
+	Recovered         bool       `json:"recovered"`
+	QErrorBaseline    float64    `json:"q_error_baseline,omitempty"`
+	QErrorPeak        float64    `json:"q_error_peak,omitempty"`
+	QErrorAfter       float64    `json:"q_error_after,omitempty"` // First sample after ANALYZE
+}
+
+type StaleStatsReport struct {
+	Table        string            `json:"table"`
+	Writers      int               `json:"writers"`
+	RowsInserted int64             `json:"rows_inserted"`
+	WriteErrors  int64             `json:"write_errors"`
+	AnalyzeAtSec float64           `json:"analyze_at_sec,omitempty"`
+	AnalyzeMs    float64           `json:"analyze_ms,omitempty"`
+	AnalyzeError string            `json:"analyze_error,omitempty"`
+	Queries      []DriftQueryRow   `json:"queries"`
+	PlanChanges  []DriftPlanChange `json:"plan_changes,omitempty"`
+	Samples      []DriftSample     `json:"samples"`
+	Restored     bool              `json:"autovacuum_restored"`
+	RowsDeleted  int64             `json:"rows_deleted,omitempty"`
+	CleanupError string            `json:"cleanup_error,omitempty"`
+}
+
+func (ss *StaleStats) Report() *StaleStatsReport {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	r := &StaleStatsReport{
+		Table:        config.TableName,
+		Writers:      config.DriftWriters,
+		RowsInserted: atomic.LoadInt64(&ss.inserted),
+		WriteErrors:  atomic.LoadInt64(&ss.writeErrors),
+		AnalyzeError: ss.analyzeErr,
+		PlanChanges:  append([]DriftPlanChange(nil), ss.changes...),
+		Samples:      append([]DriftSample(nil), ss.samples...),
+		Restored:     ss.restored,
+		RowsDeleted:  ss.deleted,
+		CleanupError: ss.cleanupErr,
+	}
+	analyzed := atomic.LoadInt32(&ss.phase) == driftPhaseAfter
+	if analyzed {
+		r.AnalyzeAtSec = ss.analyzeAt.Seconds()
+		r.AnalyzeMs = durationMs(ss.analyzeTook)
+	}
+
+	names := make(map[string]bool)
+	for _, phase := range ss.phases {
+		for name := range phase {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		row := DriftQueryRow{Query: name}
+		for i, phase := range ss.phases {
+			if qm, ok := phase[name]; ok {
+				s := qm.Summary()
+				row.Counts[i] = s.Count
+				row.P50Ms[i], row.P95Ms[i] = durationMs(s.P50), durationMs(s.P95)
+			}
+		}
+
+		if base := row.P50Ms[driftPhaseBaseline]; base > 0 {
+			for _, b := range ss.buckets {
+				qm, ok := b.queries[name]
+				if !ok || b.phase == driftPhaseBaseline {
+					continue
+				}
+				p50 := durationMs(qm.Summary().P50)
+				if row.DegradedAtSec == 0 && b.phase == driftPhaseDrift && p50 > base*driftDegradeFactor {
+					row.DegradedAtSec = b.start.Seconds()
+				}
+				if analyzed && !row.Recovered && b.phase == driftPhaseAfter && p50 <= base*driftRecoverFactor {
+					row.Recovered = true
+					row.RecoveredAfterSec = math.Max(b.start.Seconds()-ss.analyzeAt.Seconds(), 0)
+				}
+			}
+		}
+
+		afterSeen := false
+		for _, s := range ss.samples {
+			qe, ok := s.QError[name]
+			if !ok {
+				continue
+			}
+			switch s.Phase {
+			case driftPhaseNames[driftPhaseBaseline]:
+				row.QErrorBaseline = math.Max(row.QErrorBaseline, qe)
+			case driftPhaseNames[driftPhaseAfter]:
+				if !afterSeen {
+					row.QErrorAfter, afterSeen = qe, true
+				}
+			}
+			row.QErrorPeak = math.Max(row.QErrorPeak, qe)
+		}
+		r.Queries = append(r.Queries, row)
+	}
+	return r
+}
+
+func (ss *StaleStats) PrintReport() {
+	r := ss.Report()
+
+	fmt.Printf("\n🧊 Stale Statistics Drift (%s, autovacuum off, %d writers × %d rows):\n",
+		r.Table, r.Writers, config.DriftBatch)
+	fmt.Printf("   Rows inserted:  %d (%d write errors)\n", r.RowsInserted, r.WriteErrors)
+	if n := len(r.Samples); n > 0 {
+		first, peak := r.Samples[0], r.Samples[0]
+		for _, s := range r.Samples {
+			if s.ModsSinceAnalyze > peak.ModsSinceAnalyze {
+				peak = s
+			}
+		}
+		fmt.Printf("   Table:          %d live tuples at start; at the worst %d live vs reltuples %.0f, %d changes since ANALYZE\n",
+			first.LiveTuples, peak.LiveTuples, peak.RelTuples, peak.ModsSinceAnalyze)
+	}
+	switch {
+	case r.AnalyzeError != "":
+		fmt.Printf("   ANALYZE:        ❌ %s\n", r.AnalyzeError)
+	case r.AnalyzeAtSec > 0:
+		fmt.Printf("   ANALYZE:        at +%.0fs, took %.0fms\n", r.AnalyzeAtSec, r.AnalyzeMs)
+	default:
+		fmt.Println("   ANALYZE:        not reached; lengthen the run")
+	}
+
+	fmt.Printf("\n   %-22s %21s %21s %21s %10s %10s %22s\n", "Query (p50 / p95)",
+		"baseline", "drift", "after ANALYZE", "Degraded", "Recovered", "q-error base/peak/after")
+	for _, q := range r.Queries {
+		fmt.Printf("   %-22s", q.Query)
+		for i := range q.P50Ms {
+			cell := "-"
+			if q.Counts[i] > 0 {
+				cell = fmt.Sprintf("%.2f / %.2fms", q.P50Ms[i], q.P95Ms[i])
+			}
+			fmt.Printf(" %21s", cell)
+		}
+		degraded, recovered := "-", "-"
+		if q.DegradedAtSec > 0 {
+			degraded = fmt.Sprintf("+%.0fs", q.DegradedAtSec)
+		}
+		if q.Recovered {
+			recovered = fmt.Sprintf("%.0fs", q.RecoveredAfterSec)
+		} else if q.DegradedAtSec > 0 && r.AnalyzeAtSec > 0 {
+			recovered = "no"
+		}
+		qerr := "-"
+		if q.QErrorPeak > 0 {
+			qerr = fmt.Sprintf("%.0f / %.0f / %.0f", q.QErrorBaseline, q.QErrorPeak, q.QErrorAfter)
+		}
+		fmt.Printf(" %10s %10s %22s\n", degraded, recovered, qerr)
+	}
+
+	if len(r.PlanChanges) > 0 {
+		fmt.Printf("\n   Plan changes (plan monitor):\n")
+		for _, c := range r.PlanChanges {
+			fmt.Printf("   [+%4.0fs %-13s] %-22s %s → %s  %s\n",
+				c.OffsetSec, c.Phase, c.Query, shortHash(c.FromPlan), shortHash(c.ToPlan), c.Outline)
+		}
+	} else {
+		fmt.Println("\n   No plan changes seen by the plan monitor: stale statistics made estimates wrong without changing plans")
+	}
+
+	for _, q := range r.Queries {
+		if q.DegradedAtSec > 0 && !q.Recovered && r.AnalyzeAtSec > 0 {
+			fmt.Println("   ⚠️  Some queries stayed slow after ANALYZE: the data itself grew for the hot ids, not only the estimates")
+			break
+		}
+	}
+	if !r.Restored {
+		fmt.Printf("   ⚠️  autovacuum is still off on %s: ALTER TABLE %s RESET (autovacuum_enabled)\n", r.Table, r.Table)
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+// ============================================================================
+// PREPARED-STATEMENT CACHE BENCHMARK (-stmt-cache exec,cache_statement,...)
+// ============================================================================
+//
+// Does preparing statements pay off for this workload, and is pgx's cache
+// big enough? With stmt_cache.modes the run is split into equal phases, one
+// per mode, and the pooled workers switch to a pool configured for it:
+//   exec              unnamed statements: parse, bind and execute on every
+//                     call (pgx QueryExecModeExec)
+//   simple_protocol   literals inlined, one Query message, no bind
+//   describe_exec     an extra Describe round trip per call, nothing cached
+//   cache_describe    descriptions cached, statements still unnamed
+//   cache_statement   named prepared statements cached per connection (the
+//                     pgx default): parsed once, planned by the server's
+//                     plan cache (custom plans, then maybe a generic plan)
+// A mode may carry the cache capacity, cache_statement:16; one smaller than
+// the workload's distinct statements evicts and re-prepares all the time.
+//
+// Each phase gets client-side latency per query and, when
+// pg_stat_statements is installed, its deltas per query: calls, plans per
+// call (below 1 once generic plans are reused; with
+// pg_stat_statements.track_planning on), planning and execution time per
+// call. Client latency minus server time is what the protocol round trips,
+// parse and bind cost. Everything is compared with the first mode.
+//
+// Churn workers (-churn) open their own connections and are not switched.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sjksingh/dbre-knowledge-base/postgres/ops/sqlfingerprint"
+)
+
+var stmtExecModes = map[string]pgx.QueryExecMode{
+	"cache_statement": pgx.QueryExecModeCacheStatement,
+	"cache_describe":  pgx.QueryExecModeCacheDescribe,
+	"describe_exec":   pgx.QueryExecModeDescribeExec,
+	"exec":            pgx.QueryExecModeExec,
+	"simple_protocol": pgx.QueryExecModeSimpleProtocol,
+}
+
+// StmtCacheMode is one phase of the benchmark.
+type StmtCacheMode struct {
+	Name     string // As configured, e.g. cache_statement:16
+	execMode pgx.QueryExecMode
+	capacity int // 0: pgx default
+}
+
+// parseStmtCacheMode parses mode[:capacity].
+func parseStmtCacheMode(s string) (StmtCacheMode, error) {
+	s = strings.TrimSpace(s)
+	name, capText, hasCap := strings.Cut(s, ":")
+	execMode, ok := stmtExecModes[name]
+	if !ok {
+		return StmtCacheMode{}, fmt.Errorf("stmt_cache: unknown mode %q (use exec, simple_protocol, describe_exec, cache_describe or cache_statement[:capacity])", name)
+	}
+	m := StmtCacheMode{Name: s, execMode: execMode}
+	if hasCap {
+		n, err := strconv.Atoi(capText)
+		if err != nil || n < 1 || (name != "cache_statement" && name != "cache_describe") {
+			return StmtCacheMode{}, fmt.Errorf("stmt_cache: invalid %q (a capacity >= 1 goes with cache_statement or cache_describe)", s)
+		}
+		m.capacity = n
+	}
+	return m, nil
+}
+
+// stmtServerStats are pg_stat_statements counters summed per fingerprint.
+type stmtServerStats struct {
+	calls, plans           int64
+	planTimeMs, execTimeMs float64
+}
+
+type StmtCacheBench struct {
+	modes    []StmtCacheMode
+	pools    []*pgxpool.Pool
+	phase    int32
+	windows  []map[string]*QueryMetrics
+	overall  []*QueryMetrics
+	bounds   []time.Time // Phase i runs from bounds[i] to bounds[i+1]
+	server   []map[string]stmtServerStats
+	names    map[string]string // Fingerprint -> query name
+	hasPGSS  bool
+	planTime bool // total_plan_time exists (PostgreSQL 13+)
+	mu       sync.Mutex
+}
+
+var stmtCache *StmtCacheBench
+
+func newStmtCacheBench(specs []string) (*StmtCacheBench, error) {
+	sc := &StmtCacheBench{names: make(map[string]string)}
+	for _, s := range specs {
+		m, err := parseStmtCacheMode(s)
+		if err != nil {
+			return nil, err
+		}
+		sc.modes = append(sc.modes, m)
+		sc.windows = append(sc.windows, make(map[string]*QueryMetrics))
+		sc.overall = append(sc.overall, &QueryMetrics{Name: m.Name})
+		sc.server = append(sc.server, nil)
+	}
+	for _, q := range queries {
+		sc.names[sqlfingerprint.Fingerprint(q.SQL)] = q.Name
+	}
+	return sc, nil
+}
+
+// setup opens one pool per mode and checks for pg_stat_statements.
+func (sc *StmtCacheBench) setup(ctx context.Context, pool *pgxpool.Pool) error {
+	for _, m := range sc.modes {
+		cfg, err := newPoolConfig(config.DBConnString, config.SessionCount+2)
+		if err != nil {
+			return err
+		}
+		cfg.ConnConfig.DefaultQueryExecMode = m.execMode
+		if m.capacity > 0 {
+			cfg.ConnConfig.StatementCacheCapacity = m.capacity
+			cfg.ConnConfig.DescriptionCacheCapacity = m.capacity
+		}
+		p, err := pgxpool.NewWithConfig(ctx, cfg)
+		if err != nil {
+			return fmt.Errorf("stmt_cache %s: %w", m.Name, err)
+		}
+		sc.pools = append(sc.pools, p)
+	}
+
+	var version int
+	err := pool.QueryRow(ctx, `
+		SELECT current_setting('server_version_num')::int
+		FROM pg_extension WHERE extname = 'pg_stat_statements'`).Scan(&version)
+	if err == nil {
+		sc.hasPGSS, sc.planTime = true, version >= 130000
+	} else {
+		fmt.Println("⚠️  stmt_cache: pg_stat_statements is not installed; comparing client-side latency only")
+	}
+	return nil
+}
+
+// pool is the pool of the current phase.
+func (sc *StmtCacheBench) pool() *pgxpool.Pool {
+	return sc.pools[atomic.LoadInt32(&sc.phase)]
+}
+
+// Record files one execution under the current phase. Called from
+// Metrics.RecordQuery for every query the workers run.
+func (sc *StmtCacheBench) Record(queryName string, duration time.Duration, err error) {
+	p := atomic.LoadInt32(&sc.phase)
+
+	sc.mu.Lock()
+	qm, ok := sc.windows[p][queryName]
+	if !ok {
+		qm = &QueryMetrics{Name: queryName}
+		sc.windows[p][queryName] = qm
+	}
+	sc.mu.Unlock()
+
+	for _, m := range []*QueryMetrics{qm, sc.overall[p]} {
+		m.mu.Lock()
+		m.ExecutionCount++
+		m.TotalDuration += duration
+		m.Latencies = append(m.Latencies, duration)
+		if err != nil {
+			m.ErrorCount++
+		}
+		m.mu.Unlock()
+	}
+}
+
+// snapshot reads pg_stat_statements for the workload's queries.
+func (sc *StmtCacheBench) snapshot(ctx context.Context, pool *pgxpool.Pool) map[string]stmtServerStats {
+	if !sc.hasPGSS {
+		return nil
+	}
+	planCols := "0::bigint, 0::float8, total_time"
+	if sc.planTime {
+		planCols = "plans, total_plan_time, total_exec_time"
+	}
+	rows, err := pool.Query(ctx, `
+		SELECT query, calls, `+planCols+`
+		FROM pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())`)
+	if err != nil {
+		fmt.Printf("⚠️  stmt_cache: reading pg_stat_statements: %v\n", err)
+		return nil
+	}
+	defer rows.Close()
+	snap := make(map[string]stmtServerStats)
+	for rows.Next() {
+		var query string
+		var s stmtServerStats
+		if err := rows.Scan(&query, &s.calls, &s.plans, &s.planTimeMs, &s.execTimeMs); err != nil {
+			return nil
+		}
+		name, ok := sc.names[sqlfingerprint.Fingerprint(query)]
+		if !ok {
+			continue
+		}
+		t := snap[name]
+		t.calls += s.calls
+		t.plans += s.plans
+		t.planTimeMs += s.planTimeMs
+		t.execTimeMs += s.execTimeMs
+		snap[name] = t
+	}
+	return snap
+}
+
+// runStmtCacheBench switches the workers from mode to mode, snapshotting
+// pg_stat_statements at each switch.
+func runStmtCacheBench(ctx context.Context, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	sc := stmtCache
+	phaseLen := config.Duration / time.Duration(len(sc.modes))
+
+	sc.mu.Lock()
+	sc.bounds = append(sc.bounds, time.Now())
+	sc.mu.Unlock()
+	before := sc.snapshot(ctx, pool)
+	for i := range sc.modes {
+		if i > 0 {
+			atomic.StoreInt32(&sc.phase, int32(i))
+			fmt.Printf("\n🧾 Statement mode %d/%d: %s\n", i+1, len(sc.modes), sc.modes[i].Name)
+		}
+		if i == len(sc.modes)-1 {
+			<-ctx.Done() // Rounding must not leave the run's tail unaccounted
+		} else {
+			select {
+			case <-ctx.Done():
+			case <-time.After(phaseLen):
+			}
+		}
+		// The last phase ends with the run: snapshot on the parent
+		// context so its deltas are still read.
+		after := sc.snapshot(context.Background(), pool)
+		sc.mu.Lock()
+		sc.bounds = append(sc.bounds, time.Now())
+		sc.server[i] = diffStmtStats(before, after)
+		sc.mu.Unlock()
+		before = after
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func diffStmtStats(before, after map[string]stmtServerStats) map[string]stmtServerStats {
+	if after == nil {
+		return nil
+	}
+	d := make(map[string]stmtServerStats)
+	for name, a := range after {
+		b := before[name]
+		if a.calls < b.calls {
+			b = stmtServerStats{} // Reset in between
+		}
+		d[name] = stmtServerStats{
+			calls:      a.calls - b.calls,
+			plans:      a.plans - b.plans,
+			planTimeMs: a.planTimeMs - b.planTimeMs,
+			execTimeMs: a.execTimeMs - b.execTimeMs,
+		}
+	}
+	return d
+}
+
+// close releases the per-mode pools.
+func (sc *StmtCacheBench) close() {
+	for _, p := range sc.pools {
+		p.Close()
+	}
+}
+
+// StmtCacheQuery is one query under one mode.
+type StmtCacheQuery struct {
+	Query        string  `json:"query"`
+	Count        int64   `json:"count"`
+	P50Ms        float64 `json:"p50_ms"`
+	P95Ms        float64 `json:"p95_ms"`
+	Calls        int64   `json:"server_calls,omitempty"`
+	PlansPerCall float64 `json:"plans_per_call,omitempty"`
+	PlanMs       float64 `json:"plan_ms_per_call,omitempty"`
+	ExecMs       float64 `json:"exec_ms_per_call,omitempty"`
+	OverheadMs   float64 `json:"client_overhead_ms,omitempty"` // Client mean minus plan and execution time
+	P50DeltaPct  float64 `json:"p50_delta_pct"`                // Against the first mode
+}
+
+// StmtCacheModeStats is the workload under one mode.
+type StmtCacheModeStats struct {
+	Mode         string           `json:"mode"`
+	DurationSec  float64          `json:"duration_sec"`
+	Count        int64            `json:"count"`
+	Errors       int64            `json:"errors"`
+	QPS          float64          `json:"qps"`
+	P50Ms        float64          `json:"p50_ms"`
+	P95Ms        float64          `json:"p95_ms"`
+	P99Ms        float64          `json:"p99_ms"`
+	PlansPerCall float64          `json:"plans_per_call,omitempty"`
+	PlanMs       float64          `json:"plan_ms_per_call,omitempty"`
+	ExecMs       float64          `json:"exec_ms_per_call,omitempty"`
+	QPSDeltaPct  float64          `json:"qps_delta_pct"` // Against the first mode
+	Queries      []StmtCacheQuery `json:"queries"`
+}
+
+type StmtCacheReport struct {
+	ServerStats bool                 `json:"server_stats"` // pg_stat_statements deltas included
+	Modes       []StmtCacheModeStats `json:"modes"`
+	Fastest     string               `json:"fastest,omitempty"` // Highest throughput
+}
+
+func (sc *StmtCacheBench) Report() *StmtCacheReport {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	r := &StmtCacheReport{ServerStats: sc.hasPGSS}
+	firstP50 := make(map[string]float64)
+	for i, m := range sc.modes {
+		if i+1 >= len(sc.bounds) {
+			break // Never ran
+		}
+		elapsed := sc.bounds[i+1].Sub(sc.bounds[i])
+		s := sc.overall[i].Summary()
+		ms := StmtCacheModeStats{
+			Mode:        m.Name,
+			DurationSec: elapsed.Seconds(),
+			Count:       s.Count,
+			Errors:      s.Errors,
+			P50Ms:       durationMs(s.P50),
+			P95Ms:       durationMs(s.P95),
+			P99Ms:       durationMs(s.P99),
+		}
+		if elapsed > 0 {
+			ms.QPS = float64(s.Count) / elapsed.Seconds()
+		}
+
+		var calls, plans int64
+		var planMs, execMs float64
+		names := make([]string, 0, len(sc.windows[i]))
+		for name := range sc.windows[i] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			qs := sc.windows[i][name].Summary()
+			q := StmtCacheQuery{Query: name, Count: qs.Count, P50Ms: durationMs(qs.P50), P95Ms: durationMs(qs.P95)}
+			if i == 0 {
+				firstP50[name] = q.P50Ms
+			} else {
+				q.P50DeltaPct = pctDelta(firstP50[name], q.P50Ms)
+			}
+			if st, ok := sc.server[i][strings.TrimSuffix(name, hintedSuffix)]; ok && st.calls > 0 && !strings.HasSuffix(name, hintedSuffix) {
+				n := float64(st.calls)
+				q.Calls = st.calls
+				q.PlansPerCall = float64(st.plans) / n
+				q.PlanMs = st.planTimeMs / n
+				q.ExecMs = st.execTimeMs / n
+				q.OverheadMs = durationMs(qs.Avg) - q.PlanMs - q.ExecMs
+				calls += st.calls
+				plans += st.plans
+				planMs += st.planTimeMs
+				execMs += st.execTimeMs
+			}
+			ms.Queries = append(ms.Queries, q)
+		}
+		if calls > 0 {
+			ms.PlansPerCall = float64(plans) / float64(calls)
+			ms.PlanMs = planMs / float64(calls)
+			ms.ExecMs = execMs / float64(calls)
+		}
+		if i > 0 && len(r.Modes) > 0 {
+			ms.QPSDeltaPct = pctDelta(r.Modes[0].QPS, ms.QPS)
+		}
+		if len(r.Modes) == 0 || ms.QPS > r.modeQPS(r.Fastest) {
+			r.Fastest = ms.Mode
+		}
+		r.Modes = append(r.Modes, ms)
+	}
+	return r
+}
+
+func (r *StmtCacheReport) modeQPS(mode string) float64 {
+	for _, m := range r.Modes {
+		if m.Mode == mode {
+			return m.QPS
+		}
+	}
+	return 0
+}
+
+func (sc *StmtCacheBench) PrintReport() {
+	r := sc.Report()
+	if len(r.Modes) == 0 {
+		return
+	}
+
+	fmt.Printf("\n🧾 Prepared-Statement Cache Benchmark (against %s):\n", r.Modes[0].Mode)
+	fmt.Printf("   %-22s %8s %10s %9s %9s %9s %9s", "Mode", "Length", "QPS", "QPS Δ", "p50", "p95", "p99")
+	if r.ServerStats {
+		fmt.Printf(" %10s %10s %10s", "plans/call", "plan ms", "exec ms")
+	}
+	fmt.Println()
+	for _, m := range r.Modes {
+		fmt.Printf("   %-22s %7.0fs %10.1f %+8.1f%% %7.2fms %7.2fms %7.2fms",
+			m.Mode, m.DurationSec, m.QPS, m.QPSDeltaPct, m.P50Ms, m.P95Ms, m.P99Ms)
+		if r.ServerStats {
+			fmt.Printf(" %10.2f %10.3f %10.3f", m.PlansPerCall, m.PlanMs, m.ExecMs)
+		}
+		if m.Errors > 0 {
+			fmt.Printf("  ⚠️  %d errors", m.Errors)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("\n   %-28s", "Query p50 (Δ vs first)")
+	for _, m := range r.Modes {
+		fmt.Printf(" %20s", m.Mode)
+	}
+	fmt.Println()
+	for _, q := range r.Modes[0].Queries {
+		fmt.Printf("   %-28s", q.Query)
+		for _, m := range r.Modes {
+			cell := "-"
+			for _, mq := range m.Queries {
+				if mq.Query == q.Query {
+					cell = fmt.Sprintf("%.2fms", mq.P50Ms)
+					if m.Mode != r.Modes[0].Mode {
+						cell += fmt.Sprintf(" (%+.0f%%)", mq.P50DeltaPct)
+					}
+				}
+			}
+			fmt.Printf(" %20s", cell)
+		}
+		fmt.Println()
+	}
+	if r.ServerStats {
+		fmt.Println("   Client overhead (mean latency minus plan and execution time) per call:")
+		for _, m := range r.Modes {
+			var total float64
+			var n int
+			for _, q := range m.Queries {
+				if q.Calls > 0 {
+					total += q.OverheadMs
+					n++
+				}
+			}
+			if n > 0 {
+				fmt.Printf("      %-22s %.3fms (mean over %d queries)\n", m.Mode, total/float64(n), n)
+			}
+		}
+	}
+	if len(r.Modes) > 1 {
+		fmt.Printf("   Highest throughput: %s\n", r.Fastest)
+	}
+}
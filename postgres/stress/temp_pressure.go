@@ -0,0 +1,418 @@
+package main
+
+// ============================================================================
+// TEMP-FILE PRESSURE SCENARIO (-temp-sessions=N)
+// ============================================================================
+//
+// What happens to OLTP latency when reports start spilling, and does
+// temp_file_limit stop a runaway query before it fills the temp volume?
+// After temp_pressure.after of baseline load, temp_pressure.sessions extra
+// sessions run sort- and hash-heavy queries back to back, each sized to
+// write roughly temp_pressure.spill_size of temp files with a small
+// work_mem (temp_pressure.work_mem):
+//   temp_sort       window function over an md5 sort (external merge)
+//   temp_hash_join  self-join on md5, a multi-batch hash join
+//   temp_hash_agg   GROUP BY md5, a spilling HashAggregate (PG13+)
+// The rows come from generate_series, so the volume doesn't depend on the
+// table; the function scan's tuplestore spills too and is part of it.
+//
+// The report has temp files and bytes written during the pressure window
+// (pg_stat_database), the peak on disk at once (pg_ls_tmpdir(), PG12+,
+// pg_monitor; default tablespace only), per query kind executions, latency
+// and temp_file_limit errors (53400), and OLTP latency before vs during.
+// With temp_pressure.temp_file_limit the spilling sessions SET it (it is
+// superuser-only; otherwise the server or role setting applies) and the
+// report checks it fired when, and only when, the spill exceeds it. The
+// limit is per process: parallel workers each get their own.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tempBytesPerRow is roughly what one generated row costs on disk.
+const tempBytesPerRow = 64
+
+// tempQuery is one spilling query; $1 is the number of generated rows.
+type tempQuery struct {
+	name string
+	sql  string
+}
+
+var tempQueries = []tempQuery{
+	{"temp_sort", `SELECT max(rn) FROM (
+		SELECT row_number() OVER (ORDER BY md5(g::text)) AS rn
+		FROM generate_series(1, $1::bigint) g) s`},
+	{"temp_hash_join", `SELECT count(*)
+		FROM generate_series(1, $1::bigint / 2) a
+		JOIN generate_series(1, $1::bigint / 2) b ON md5(a::text) = md5(b::text)`},
+	{"temp_hash_agg", `SELECT count(*) FROM (
+		SELECT md5(g::text), count(*) FROM generate_series(1, $1::bigint) g GROUP BY 1) s`},
+}
+
+type TempPressure struct {
+	spillBytes int64
+	rows       int64
+	phase      int32 // 0 baseline, 1 pressure
+	oltp       [2]*QueryMetrics
+	queries    map[string]*QueryMetrics
+	limitHits  map[string]int64
+	oltpNames  map[string]bool
+
+	limitBytes int64 // Effective temp_file_limit in the spilling sessions, -1 unlimited
+	limitSet   bool  // temp_pressure.temp_file_limit was applied
+	limitErr   string
+
+	pressureStart time.Time
+	filesStart    int64
+	bytesStart    int64
+	filesEnd      int64
+	bytesEnd      int64
+	dbStatsOK     bool
+	tmpdirPeak    int64
+	tmpdirOK      bool
+	mu            sync.Mutex
+}
+
+var tempPressure *TempPressure
+
+func newTempPressure() (*TempPressure, error) {
+	spill, err := parseByteSize(config.TempSpillSize)
+	if err != nil {
+		return nil, fmt.Errorf("temp_pressure.spill_size: %w", err)
+	}
+	tp := &TempPressure{
+		spillBytes: spill,
+		rows:       max(spill/tempBytesPerRow, 1),
+		oltp:       [2]*QueryMetrics{{Name: "baseline"}, {Name: "pressure"}},
+		queries:    make(map[string]*QueryMetrics),
+		limitHits:  make(map[string]int64),
+		oltpNames:  make(map[string]bool),
+		limitBytes: -1,
+	}
+	for _, q := range tempQueries {
+		tp.queries[q.name] = &QueryMetrics{Name: q.name}
+	}
+	for _, q := range queries {
+		if q.Type == "oltp" {
+			tp.oltpNames[q.Name] = true
+		}
+	}
+	return tp, nil
+}
+
+// tempConnConfig is the churn config with the spilling sessions' settings.
+func tempConnConfig() (*pgx.ConnConfig, error) {
+	connConfig, err := churnConnConfig()
+	if err != nil {
+		return nil, err
+	}
+	connConfig.RuntimeParams["application_name"] = "read_workload_simulator_temp"
+	connConfig.RuntimeParams["work_mem"] = config.TempWorkMem
+	return connConfig, nil
+}
+
+// Record files OLTP latency under the baseline or pressure window.
+func (tp *TempPressure) Record(queryName string, d time.Duration, err error) {
+	if !tp.oltpNames[queryName] {
+		return
+	}
+	recordLatency(tp.oltp[atomic.LoadInt32(&tp.phase)], d, err)
+}
+
+// runTempPressure waits out the baseline, then starts the spilling
+// sessions and samples the temp directory until the run ends.
+func runTempPressure(ctx context.Context, pool *pgxpool.Pool, wg *sync.WaitGroup) {
+	defer wg.Done()
+	tp := tempPressure
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(config.TempAfter):
+	}
+
+	connConfig, err := tempConnConfig()
+	if err != nil {
+		log.Printf("Temp pressure: %v", err)
+		return
+	}
+	tp.sampleDatabaseTemp(ctx, pool, true)
+	tp.mu.Lock()
+	tp.pressureStart = time.Now()
+	tp.mu.Unlock()
+	atomic.StoreInt32(&tp.phase, 1)
+	fmt.Printf("\n💽 Temp pressure: %d sessions spilling ~%s per query (work_mem %s)\n",
+		config.TempSessions, formatBytes(tp.spillBytes), config.TempWorkMem)
+
+	var workers sync.WaitGroup
+	for i := 0; i < config.TempSessions; i++ {
+		workers.Add(1)
+		go tp.runSpiller(ctx, i, connConfig, &workers)
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	tp.sampleTmpdir(ctx, pool)
+	for {
+		select {
+		case <-ctx.Done():
+			workers.Wait()
+			return
+		case <-ticker.C:
+			tp.sampleTmpdir(ctx, pool)
+		}
+	}
+}
+
+func (tp *TempPressure) runSpiller(ctx context.Context, workerID int, connConfig *pgx.ConnConfig, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Temp spiller %d: connect failed: %v", workerID, err)
+		}
+		return
+	}
+	defer conn.Close(context.Background())
+	tp.applyLimit(ctx, conn)
+
+	for i := workerID; ; i++ {
+		if ctx.Err() != nil {
+			return
+		}
+		q := tempQueries[i%len(tempQueries)]
+		var result int64
+		start := time.Now()
+		err := conn.QueryRow(ctx, q.sql, tp.rows).Scan(&result)
+		d := time.Since(start)
+		if ctx.Err() != nil {
+			return
+		}
+		recordLatency(tp.queries[q.name], d, err)
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "53400" {
+			tp.mu.Lock()
+			tp.limitHits[q.name]++
+			tp.mu.Unlock()
+		} else if err != nil {
+			log.Printf("Temp spiller %d: %s: %v", workerID, q.name, err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// applyLimit sets temp_file_limit if configured and records the limit the
+// spilling sessions actually run with.
+func (tp *TempPressure) applyLimit(ctx context.Context, conn *pgx.Conn) {
+	if config.TempFileLimit != "" {
+		if _, err := conn.Exec(ctx, `SELECT set_config('temp_file_limit', $1, false)`, config.TempFileLimit); err != nil {
+			tp.mu.Lock()
+			first := tp.limitErr == ""
+			tp.limitErr = err.Error()
+			tp.mu.Unlock()
+			if first {
+				log.Printf("⚠️  Temp pressure: cannot set temp_file_limit (superuser only), using the server/role setting: %v", err)
+			}
+		} else {
+			tp.mu.Lock()
+			tp.limitSet = true
+			tp.mu.Unlock()
+		}
+	}
+	var limitKB int64
+	if err := conn.QueryRow(ctx, `SELECT setting::bigint FROM pg_settings WHERE name = 'temp_file_limit'`).Scan(&limitKB); err != nil {
+		return
+	}
+	tp.mu.Lock()
+	if limitKB >= 0 {
+		tp.limitBytes = limitKB * 1024
+	}
+	tp.mu.Unlock()
+}
+
+func (tp *TempPressure) sampleDatabaseTemp(ctx context.Context, pool *pgxpool.Pool, start bool) {
+	var files, bytes int64
+	err := pool.QueryRow(ctx, `
+		SELECT temp_files, temp_bytes FROM pg_stat_database WHERE datname = current_database()
+	`).Scan(&files, &bytes)
+	if err != nil {
+		return
+	}
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if start {
+		tp.filesStart, tp.bytesStart = files, bytes
+	} else {
+		tp.filesEnd, tp.bytesEnd = files, bytes
+		tp.dbStatsOK = true
+	}
+}
+
+// sampleTmpdir tracks the most temp bytes on disk at once.
+func (tp *TempPressure) sampleTmpdir(ctx context.Context, pool *pgxpool.Pool) {
+	var size int64
+	if err := pool.QueryRow(ctx, `SELECT coalesce(sum(size), 0)::bigint FROM pg_ls_tmpdir()`).Scan(&size); err != nil {
+		return
+	}
+	tp.mu.Lock()
+	tp.tmpdirOK = true
+	tp.tmpdirPeak = max(tp.tmpdirPeak, size)
+	tp.mu.Unlock()
+}
+
+// finish takes the closing temp counters once the workers have stopped.
+func (tp *TempPressure) finish(ctx context.Context, pool *pgxpool.Pool) {
+	if atomic.LoadInt32(&tp.phase) == 1 {
+		tp.sampleDatabaseTemp(ctx, pool, false)
+	}
+}
+
+type TempQueryRow struct {
+	Name       string  `json:"name"`
+	Executions int64   `json:"executions"`
+	Errors     int64   `json:"errors"`
+	LimitHits  int64   `json:"temp_file_limit_hits"`
+	P50Ms      float64 `json:"p50_ms"`
+	P95Ms      float64 `json:"p95_ms"`
+}
+
+type TempPressureReport struct {
+	Sessions        int            `json:"sessions"`
+	SpillBytes      int64          `json:"spill_bytes_target"`
+	WorkMem         string         `json:"work_mem"`
+	LimitBytes      int64          `json:"temp_file_limit_bytes"` // -1: unlimited
+	LimitSet        bool           `json:"temp_file_limit_set"`
+	LimitError      string         `json:"temp_file_limit_error,omitempty"`
+	PressureSec     float64        `json:"pressure_sec"`
+	TempFiles       int64          `json:"temp_files"`
+	TempBytes       int64          `json:"temp_bytes"`
+	TempBytesPerSec float64        `json:"temp_bytes_per_sec"`
+	BytesPerQuery   int64          `json:"temp_bytes_per_query"`
+	PeakTmpdir      int64          `json:"peak_tmpdir_bytes,omitempty"`
+	Queries         []TempQueryRow `json:"queries"`
+	OLTPBefore      int64          `json:"oltp_baseline_queries"`
+	OLTPDuring      int64          `json:"oltp_pressure_queries"`
+	OLTPBeforeP95   float64        `json:"oltp_baseline_p95_ms"`
+	OLTPDuringP95   float64        `json:"oltp_pressure_p95_ms"`
+	OLTPBeforeP99   float64        `json:"oltp_baseline_p99_ms"`
+	OLTPDuringP99   float64        `json:"oltp_pressure_p99_ms"`
+	LimitExpected   bool           `json:"temp_file_limit_expected"` // The target spill exceeds the limit
+	LimitBehaved    bool           `json:"temp_file_limit_behaved"`
+	LimitHitsTotal  int64          `json:"temp_file_limit_hits"`
+}
+
+func (tp *TempPressure) Report() *TempPressureReport {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+
+	r := &TempPressureReport{
+		Sessions:   config.TempSessions,
+		SpillBytes: tp.spillBytes,
+		WorkMem:    config.TempWorkMem,
+		LimitBytes: tp.limitBytes,
+		LimitSet:   tp.limitSet,
+		LimitError: tp.limitErr,
+		PeakTmpdir: tp.tmpdirPeak,
+	}
+	before, during := tp.oltp[0].Summary(), tp.oltp[1].Summary()
+	r.OLTPBefore, r.OLTPDuring = before.Count, during.Count
+	r.OLTPBeforeP95, r.OLTPDuringP95 = durationMs(before.P95), durationMs(during.P95)
+	r.OLTPBeforeP99, r.OLTPDuringP99 = durationMs(before.P99), durationMs(during.P99)
+	if !tp.pressureStart.IsZero() {
+		r.PressureSec = time.Since(tp.pressureStart).Seconds()
+	}
+	if tp.dbStatsOK {
+		r.TempFiles = tp.filesEnd - tp.filesStart
+		r.TempBytes = tp.bytesEnd - tp.bytesStart
+		if r.PressureSec > 0 {
+			r.TempBytesPerSec = float64(r.TempBytes) / r.PressureSec
+		}
+	}
+
+	var executions int64
+	for _, q := range tempQueries {
+		s := tp.queries[q.name].Summary()
+		row := TempQueryRow{
+			Name:       q.name,
+			Executions: s.Count,
+			Errors:     s.Errors,
+			LimitHits:  tp.limitHits[q.name],
+			P50Ms:      durationMs(s.P50),
+			P95Ms:      durationMs(s.P95),
+		}
+		executions += s.Count
+		r.LimitHitsTotal += row.LimitHits
+		r.Queries = append(r.Queries, row)
+	}
+	if executions > 0 {
+		r.BytesPerQuery = r.TempBytes / executions
+	}
+
+	r.LimitExpected = r.LimitBytes >= 0 && r.SpillBytes > r.LimitBytes
+	r.LimitBehaved = r.LimitExpected == (r.LimitHitsTotal > 0)
+	return r
+}
+
+func (tp *TempPressure) PrintReport() {
+	r := tp.Report()
+
+	limit := "unlimited (-1)"
+	if r.LimitBytes >= 0 {
+		limit = formatBytes(r.LimitBytes)
+	}
+	fmt.Printf("\n💽 Temp-File Pressure (%d sessions, ~%s per query, work_mem %s, temp_file_limit %s):\n",
+		r.Sessions, formatBytes(r.SpillBytes), r.WorkMem, limit)
+	if r.PressureSec == 0 {
+		fmt.Println("   The pressure window never started (temp_pressure.after is longer than the run).")
+		return
+	}
+	fmt.Printf("   Temp written:  %d files, %s over %.0fs (%s/s, ~%s per query)\n",
+		r.TempFiles, formatBytes(r.TempBytes), r.PressureSec, formatBytes(int64(r.TempBytesPerSec)), formatBytes(r.BytesPerQuery))
+	if r.PeakTmpdir > 0 {
+		fmt.Printf("   Peak on disk:  %s at once (pg_ls_tmpdir)\n", formatBytes(r.PeakTmpdir))
+	}
+
+	fmt.Printf("\n   %-16s %10s %8s %10s %10s %10s\n", "Query", "Executions", "Errors", "Limit hits", "p50", "p95")
+	for _, q := range r.Queries {
+		fmt.Printf("   %-16s %10d %8d %10d %8.0fms %8.0fms\n", q.Name, q.Executions, q.Errors, q.LimitHits, q.P50Ms, q.P95Ms)
+	}
+
+	fmt.Printf("\n   OLTP latency   baseline p95 %.2fms  p99 %.2fms (%d)  →  under pressure p95 %.2fms  p99 %.2fms (%d)\n",
+		r.OLTPBeforeP95, r.OLTPBeforeP99, r.OLTPBefore, r.OLTPDuringP95, r.OLTPDuringP99, r.OLTPDuring)
+	if r.OLTPBeforeP95 > 0 && r.OLTPDuringP95 > 2*r.OLTPBeforeP95 {
+		fmt.Printf("   ⚠️  Spilling queries slowed OLTP p95 %.1fx: temp I/O competes with the data files. Put temp on\n",
+			r.OLTPDuringP95/r.OLTPBeforeP95)
+		fmt.Println("      its own volume (temp_tablespaces), raise work_mem for the reporting role only, or move reports")
+		fmt.Println("      to a replica.")
+	}
+
+	switch {
+	case r.LimitError != "":
+		fmt.Printf("   ⚠️  temp_file_limit could not be set (%s); set it with ALTER ROLE ... SET or in postgresql.conf.\n", r.LimitError)
+	case r.LimitBytes < 0:
+		fmt.Println("   ⚠️  No temp_file_limit: one runaway query can fill the temp volume and take the server down with it.")
+	case r.LimitBehaved && r.LimitExpected:
+		fmt.Printf("   ✅ temp_file_limit fired as expected (%d queries cancelled with 53400).\n", r.LimitHitsTotal)
+	case r.LimitBehaved:
+		fmt.Println("   ✅ temp_file_limit left queries below the limit alone.")
+	case r.LimitExpected:
+		fmt.Println("   ⚠️  temp_file_limit never fired although the target spill exceeds it: parallel workers each get")
+		fmt.Println("      their own limit, and the estimate per row may be off; check the temp written per query.")
+	default:
+		fmt.Printf("   ⚠️  temp_file_limit cancelled %d queries whose target spill is below it; they spill more than\n", r.LimitHitsTotal)
+		fmt.Println("      estimated (the function scan's tuplestore counts too).")
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+// ============================================================================
+// TOXIPROXY SCENARIOS (-toxiproxy=localhost:8474, toxiproxy.toxics)
+// ============================================================================
+//
+// The same question as the built-in proxy (netproxy.go), asked through a
+// Toxiproxy server the team already runs, so a chaos scenario is a run
+// config anyone can replay. At startup the simulator (re)creates
+// toxiproxy.proxy (listen -> the DSN's host, or toxiproxy.upstream) through
+// the API and routes every simulator connection through it; each entry in
+// toxiproxy.toxics is added at its `at` offset and removed after `for`
+// (or at the end of the run):
+//   latency     latency, jitter (ms)        every chunk delayed
+//   bandwidth   rate (KB/s)                 throughput cap
+//   slow_close  delay (ms)                  FIN delayed
+//   timeout     timeout (ms)                data stops; closed after the
+//                                           timeout, or never with 0
+//   reset_peer  timeout (ms)                RST after the timeout
+//   slicer      average_size, size_variation, delay (us)
+//   limit_data  bytes                       closed after that many bytes
+// stream is downstream (server to client, the default) or upstream;
+// toxicity is the share of connections affected (default 1).
+//
+// Query outcomes are filed per toxic window next to the no-toxic baseline,
+// as with the built-in proxy. The proxy is deleted at the end of the run.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	toxiproxy "github.com/Shopify/toxiproxy/v2/client"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// toxicAttributes lists the attributes each toxic type accepts.
+var toxicAttributes = map[string][]string{
+	"latency":    {"latency", "jitter"},
+	"bandwidth":  {"rate"},
+	"slow_close": {"delay"},
+	"timeout":    {"timeout"},
+	"reset_peer": {"timeout"},
+	"slicer":     {"average_size", "size_variation", "delay"},
+	"limit_data": {"bytes"},
+}
+
+// validateToxic checks one toxic against the run length.
+func validateToxic(t ToxicSpec) error {
+	allowed, ok := toxicAttributes[t.Type]
+	if !ok {
+		return fmt.Errorf("toxiproxy: toxic %q: unknown type %q", t.Name, t.Type)
+	}
+	for attr := range t.Attributes {
+		found := false
+		for _, a := range allowed {
+			found = found || a == attr
+		}
+		if !found {
+			return fmt.Errorf("toxiproxy: toxic %q: %s takes %s, not %q", t.Name, t.Type, strings.Join(allowed, ", "), attr)
+		}
+	}
+	if t.Stream != "" && t.Stream != "downstream" && t.Stream != "upstream" {
+		return fmt.Errorf("toxiproxy: toxic %q: stream must be downstream or upstream", t.Name)
+	}
+	if t.Toxicity < 0 || t.Toxicity > 1 {
+		return fmt.Errorf("toxiproxy: toxic %q: toxicity must be between 0 and 1", t.Name)
+	}
+	if t.At < 0 || t.At >= config.Duration || t.For < 0 {
+		return fmt.Errorf("toxiproxy: toxic %q: at must fall inside the run and for must be >= 0", t.Name)
+	}
+	return nil
+}
+
+// toxicEvent adds or removes one toxic at an offset.
+type toxicEvent struct {
+	at    time.Duration
+	toxic int
+	add   bool
+}
+
+type ToxiproxyScenario struct {
+	client   *toxiproxy.Client
+	proxy    *toxiproxy.Proxy
+	toxics   []ToxicSpec
+	active   map[string]bool
+	upstream string
+	host     string // Where the simulator dials the proxy
+	port     uint16
+	start    time.Time
+
+	baseline  *QueryMetrics
+	windows   []*QueryMetrics
+	apiErrors []string
+	mu        sync.Mutex
+}
+
+var toxiScenario *ToxiproxyScenario
+
+func newToxiproxyScenario() *ToxiproxyScenario {
+	ts := &ToxiproxyScenario{
+		client:   toxiproxy.NewClient(config.ToxiproxyAPI),
+		active:   make(map[string]bool),
+		baseline: &QueryMetrics{Name: "baseline"},
+	}
+	for i, t := range config.Toxics {
+		if t.Name == "" {
+			t.Name = fmt.Sprintf("%s_%d", t.Type, i)
+		}
+		if t.Stream == "" {
+			t.Stream = "downstream"
+		}
+		if t.Toxicity == 0 {
+			t.Toxicity = 1
+		}
+		ts.toxics = append(ts.toxics, t)
+		ts.windows = append(ts.windows, &QueryMetrics{Name: t.Name})
+	}
+	return ts
+}
+
+// setup creates (or replaces) the proxy and works out where to dial it.
+func (ts *ToxiproxyScenario) setup(dsn string) error {
+	ts.upstream = config.ToxiproxyUpstream
+	if ts.upstream == "" {
+		cc, err := pgconn.ParseConfig(dsn)
+		if err != nil {
+			return fmt.Errorf("toxiproxy: failed to parse DSN: %w", err)
+		}
+		ts.upstream = net.JoinHostPort(cc.Host, strconv.Itoa(int(cc.Port)))
+	}
+
+	host, portText, err := net.SplitHostPort(config.ToxiproxyListen)
+	if err != nil {
+		return fmt.Errorf("toxiproxy: invalid listen address: %w", err)
+	}
+	port, err := strconv.ParseUint(portText, 10, 16)
+	if err != nil || port == 0 {
+		return fmt.Errorf("toxiproxy: listen needs a fixed port, got %q", portText)
+	}
+	// A proxy listening on all interfaces is dialed on the API's host.
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		api := config.ToxiproxyAPI
+		if !strings.Contains(api, "://") {
+			api = "http://" + api
+		}
+		u, err := url.Parse(api)
+		if err != nil {
+			return fmt.Errorf("toxiproxy: invalid API address: %w", err)
+		}
+		host = u.Hostname()
+	}
+	ts.host, ts.port = host, uint16(port)
+
+	proxies, err := ts.client.Populate([]toxiproxy.Proxy{{
+		Name:     config.ToxiproxyProxy,
+		Listen:   config.ToxiproxyListen,
+		Upstream: ts.upstream,
+		Enabled:  true,
+	}})
+	if err != nil {
+		return fmt.Errorf("toxiproxy: failed to create proxy %s at %s: %w", config.ToxiproxyProxy, config.ToxiproxyAPI, err)
+	}
+	if len(proxies) != 1 {
+		return fmt.Errorf("toxiproxy: expected proxy %s back from the API", config.ToxiproxyProxy)
+	}
+	ts.proxy = proxies[0]
+	return nil
+}
+
+// route points a connection config (and its fallbacks) at the proxy.
+func (ts *ToxiproxyScenario) route(cc *pgconn.Config) {
+	routeTo(cc, ts.host, ts.port)
+}
+
+// runToxicSchedule starts the toxic clock and adds and removes toxics.
+func runToxicSchedule(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ts := toxiScenario
+	ts.mu.Lock()
+	ts.start = time.Now()
+	ts.mu.Unlock()
+
+	var events []toxicEvent
+	for i, t := range ts.toxics {
+		events = append(events, toxicEvent{at: t.At, toxic: i, add: true})
+		if t.For > 0 && t.At+t.For < config.Duration {
+			events = append(events, toxicEvent{at: t.At + t.For, toxic: i})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at < events[j].at })
+
+	for _, e := range events {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(ts.start.Add(e.at))):
+		}
+		t := ts.toxics[e.toxic]
+		if e.add {
+			attrs := make(toxiproxy.Attributes, len(t.Attributes))
+			for k, v := range t.Attributes {
+				attrs[k] = v
+			}
+			if _, err := ts.proxy.AddToxic(t.Name, t.Type, t.Stream, t.Toxicity, attrs); err != nil {
+				ts.apiError(fmt.Sprintf("add %s: %v", t.Name, err))
+				continue
+			}
+			log.Printf("☣️  Toxiproxy: + %s (%s %s %v, toxicity %.2f)", t.Name, t.Type, t.Stream, t.Attributes, t.Toxicity)
+			ts.mu.Lock()
+			ts.active[t.Name] = true
+			ts.mu.Unlock()
+		} else {
+			ts.removeToxic(t.Name)
+		}
+	}
+}
+
+func (ts *ToxiproxyScenario) removeToxic(name string) {
+	ts.mu.Lock()
+	active := ts.active[name]
+	delete(ts.active, name)
+	ts.mu.Unlock()
+	if !active {
+		return
+	}
+	if err := ts.proxy.RemoveToxic(name); err != nil {
+		ts.apiError(fmt.Sprintf("remove %s: %v", name, err))
+		return
+	}
+	log.Printf("☣️  Toxiproxy: - %s", name)
+}
+
+func (ts *ToxiproxyScenario) apiError(msg string) {
+	log.Printf("⚠️  Toxiproxy: %s", msg)
+	ts.mu.Lock()
+	ts.apiErrors = append(ts.apiErrors, msg)
+	ts.mu.Unlock()
+}
+
+// close deletes the proxy, and with it any toxic still active.
+func (ts *ToxiproxyScenario) close() {
+	if ts.proxy == nil {
+		return
+	}
+	if err := ts.proxy.Delete(); err != nil {
+		log.Printf("⚠️  Toxiproxy: failed to delete proxy %s: %v", ts.proxy.Name, err)
+	}
+}
+
+// window is the span toxic i is filed under.
+func (ts *ToxiproxyScenario) window(i int) (from, to time.Duration) {
+	t := ts.toxics[i]
+	if t.For == 0 || t.At+t.For > config.Duration {
+		return t.At, config.Duration
+	}
+	return t.At, t.At + t.For
+}
+
+// Record files a query outcome under the latest toxic window it overlaps.
+func (ts *ToxiproxyScenario) Record(d time.Duration, err error) {
+	ts.mu.Lock()
+	start := ts.start
+	ts.mu.Unlock()
+	if start.IsZero() {
+		return
+	}
+	end := time.Since(start)
+	qm := ts.baseline
+	for i := range ts.toxics {
+		if from, to := ts.window(i); end >= from && end-d < to {
+			qm = ts.windows[i]
+		}
+	}
+	recordLatency(qm, d, err)
+}
+
+type ToxiproxyReport struct {
+	API       string        `json:"api"`
+	Proxy     string        `json:"proxy"`
+	Listen    string        `json:"listen"`
+	Upstream  string        `json:"upstream"`
+	Baseline  ProxyWindow   `json:"baseline"`
+	Toxics    []ProxyWindow `json:"toxics"`
+	APIErrors []string      `json:"api_errors,omitempty"`
+}
+
+func (ts *ToxiproxyScenario) Report() *ToxiproxyReport {
+	r := &ToxiproxyReport{
+		API:      config.ToxiproxyAPI,
+		Proxy:    config.ToxiproxyProxy,
+		Listen:   config.ToxiproxyListen,
+		Upstream: ts.upstream,
+		Baseline: proxyWindow("(no toxic)", ts.baseline),
+	}
+	for i, t := range ts.toxics {
+		w := proxyWindow(fmt.Sprintf("%s (%s %s)", t.Name, t.Type, t.Stream), ts.windows[i])
+		from, to := ts.window(i)
+		w.StartSec, w.EndSec = from.Seconds(), to.Seconds()
+		r.Toxics = append(r.Toxics, w)
+	}
+	ts.mu.Lock()
+	r.APIErrors = append([]string(nil), ts.apiErrors...)
+	ts.mu.Unlock()
+	return r
+}
+
+func (ts *ToxiproxyScenario) PrintReport() {
+	r := ts.Report()
+
+	fmt.Printf("\n☣️  Toxiproxy Scenario (%s at %s: %s → %s):\n", r.Proxy, r.API, r.Listen, r.Upstream)
+	printFaultWindows(r.Baseline, r.Toxics)
+
+	for i, w := range r.Toxics {
+		t := ts.toxics[i]
+		switch {
+		case w.Errors > 0:
+			fmt.Printf("   ⚠️  %s: %d queries failed (%.1f%%).\n", t.Name, w.Errors, float64(w.Errors)/float64(w.Queries)*100)
+		case r.Baseline.P99Ms > 0 && w.P99Ms > 10*r.Baseline.P99Ms:
+			fmt.Printf("   ⚠️  %s: p99 %.0fx the baseline.\n", t.Name, w.P99Ms/r.Baseline.P99Ms)
+		}
+		if t.Type == "timeout" && t.Attributes["timeout"] == 0 && w.MaxMs >= 0.8*(w.EndSec-w.StartSec)*1000 {
+			fmt.Printf("   ⚠️  %s: queries hung until the toxic was removed; only a client-side deadline or\n", t.Name)
+			fmt.Println("      tcp_user_timeout / keepalives end them.")
+		}
+	}
+	if len(r.APIErrors) > 0 {
+		fmt.Printf("   ⚠️  %d Toxiproxy API call(s) failed; the scenario did not run as configured:\n", len(r.APIErrors))
+		for _, e := range r.APIErrors {
+			fmt.Printf("      %s\n", e)
+		}
+	}
+}
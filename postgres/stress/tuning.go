@@ -0,0 +1,575 @@
+package main
+
+// ============================================================================
+// TUNING ADVISOR
+// ============================================================================
+//
+// Turns what the run observed into parameter recommendations, each with the
+// metric that supports it, most urgent first:
+//   - temp-file spills (EXPLAIN ANALYZE samples)       -> work_mem
+//   - requested checkpoints, WAL rate                  -> max_wal_size, checkpoint_timeout
+//   - database cache hit ratio vs table size           -> shared_buffers, effective_cache_size
+//   - parallel workers launched vs planned             -> max_parallel_workers, max_worker_processes
+//   - empty pool acquires, backends vs max_connections -> pool size, pooler
+//
+// Server counters (pg_stat_database, pg_stat_checkpointer/bgwriter, WAL
+// position) are sampled at the start and end of the run, so the advice is
+// about this workload only as far as nothing else ran on the server.
+// Recommendations are a starting point for the next run, not a final
+// configuration: change one thing, rerun, compare.
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ServerSample is one reading of the cumulative server counters.
+type ServerSample struct {
+	At              time.Time
+	BlksHit         int64
+	BlksRead        int64
+	CheckpointsTime int64
+	CheckpointsReq  int64
+	WALBytes        float64 // Bytes since 0/0; 0 on a standby
+	checkpointsOK   bool
+}
+
+// ServerSetting is a pg_settings value in its base unit.
+type ServerSetting struct {
+	Value string
+	Unit  string
+}
+
+type TuningAdvisor struct {
+	mu           sync.Mutex
+	start, end   *ServerSample
+	settings     map[string]ServerSetting // As the workload sessions see them
+	tableBytes   int64                    // Table plus indexes
+	peakBackends int64
+	poolMax      int32
+}
+
+var tuningAdvisor = &TuningAdvisor{}
+
+// tuningSettings are the parameters the advisor reasons about.
+var tuningSettings = []string{
+	"work_mem", "shared_buffers", "effective_cache_size", "max_wal_size",
+	"checkpoint_timeout", "checkpoint_completion_target", "max_connections",
+	"superuser_reserved_connections", "max_parallel_workers",
+	"max_parallel_workers_per_gather", "max_worker_processes",
+}
+
+// sampleServer reads the counters; nil when pg_stat_database is unreadable.
+func sampleServer(ctx context.Context, pool *pgxpool.Pool) *ServerSample {
+	s := &ServerSample{At: time.Now()}
+	if err := pool.QueryRow(ctx, `
+		SELECT blks_hit, blks_read FROM pg_stat_database WHERE datname = current_database()
+	`).Scan(&s.BlksHit, &s.BlksRead); err != nil {
+		return nil
+	}
+
+	// pg_stat_checkpointer is PG17+; older servers keep the counters in
+	// pg_stat_bgwriter.
+	err := pool.QueryRow(ctx, `SELECT num_timed, num_requested FROM pg_stat_checkpointer`).
+		Scan(&s.CheckpointsTime, &s.CheckpointsReq)
+	if err != nil {
+		err = pool.QueryRow(ctx, `SELECT checkpoints_timed, checkpoints_req FROM pg_stat_bgwriter`).
+			Scan(&s.CheckpointsTime, &s.CheckpointsReq)
+	}
+	s.checkpointsOK = err == nil
+
+	_ = pool.QueryRow(ctx, `
+		SELECT CASE WHEN pg_is_in_recovery() THEN 0
+		            ELSE pg_wal_lsn_diff(pg_current_wal_lsn(), '0/0') END::float8
+	`).Scan(&s.WALBytes)
+	return s
+}
+
+// SampleStart records settings and counters before the workers start.
+func (ta *TuningAdvisor) SampleStart(ctx context.Context, pool *pgxpool.Pool) {
+	settings := make(map[string]ServerSetting)
+	rows, err := pool.Query(ctx, `
+		SELECT name, setting, coalesce(unit, '') FROM pg_settings WHERE name = ANY($1)
+	`, tuningSettings)
+	if err == nil {
+		for rows.Next() {
+			var name string
+			var s ServerSetting
+			if rows.Scan(&name, &s.Value, &s.Unit) == nil {
+				settings[name] = s
+			}
+		}
+		rows.Close()
+	}
+
+	var tableBytes int64
+	_ = pool.QueryRow(ctx, `SELECT coalesce(pg_total_relation_size(to_regclass($1)), 0)`, config.TableName).Scan(&tableBytes)
+
+	sample := sampleServer(ctx, pool)
+
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	ta.settings = settings
+	ta.tableBytes = tableBytes
+	ta.start = sample
+	ta.poolMax = pool.Config().MaxConns
+}
+
+// SampleEnd records the counters after the workers stop.
+func (ta *TuningAdvisor) SampleEnd(ctx context.Context, pool *pgxpool.Pool) {
+	sample := sampleServer(ctx, pool)
+
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	ta.end = sample
+}
+
+// monitorBackends tracks the peak number of client backends on the server.
+func (ta *TuningAdvisor) monitorBackends(ctx context.Context, pool *pgxpool.Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var backends int64
+			err := pool.QueryRow(ctx, `
+				SELECT count(*) FROM pg_stat_activity WHERE backend_type = 'client backend'
+			`).Scan(&backends)
+			if err != nil {
+				continue
+			}
+			ta.mu.Lock()
+			if backends > ta.peakBackends {
+				ta.peakBackends = backends
+			}
+			ta.mu.Unlock()
+		}
+	}
+}
+
+// settingInt returns a setting in its pg_settings unit, or -1.
+func (ta *TuningAdvisor) settingInt(name string) int64 {
+	s, ok := ta.settings[name]
+	if !ok {
+		return -1
+	}
+	v, err := strconv.ParseInt(s.Value, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// settingBytes returns a memory setting in bytes, or -1.
+func (ta *TuningAdvisor) settingBytes(name string) int64 {
+	v := ta.settingInt(name)
+	if v < 0 {
+		return -1
+	}
+	switch ta.settings[name].Unit {
+	case "8kB":
+		return v * 8192
+	case "kB":
+		return v * 1024
+	case "MB":
+		return v * 1024 * 1024
+	}
+	return v
+}
+
+// formatSetting renders a setting the way postgresql.conf would.
+func (ta *TuningAdvisor) formatSetting(name string) string {
+	if b := ta.settingBytes(name); b >= 0 && ta.settings[name].Unit != "" && ta.settings[name].Unit != "s" {
+		return pgSize(b)
+	}
+	s, ok := ta.settings[name]
+	if !ok {
+		return "?"
+	}
+	return s.Value + s.Unit
+}
+
+// pgSize renders bytes as a postgresql.conf size (64MB, 4GB).
+func pgSize(b int64) string {
+	switch {
+	case b >= 1<<30 && b%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", b>>30)
+	case b >= 1<<20:
+		return fmt.Sprintf("%dMB", (b+(1<<20)-1)>>20)
+	default:
+		return fmt.Sprintf("%dkB", (b+1023)>>10)
+	}
+}
+
+// roundUpSize rounds up to a power of two MB below 1GB, whole GB above.
+func roundUpSize(b int64) int64 {
+	if b >= 1<<30 {
+		return (b + (1 << 30) - 1) / (1 << 30) * (1 << 30)
+	}
+	mb := int64(1) << 20
+	for mb < b {
+		mb *= 2
+	}
+	return mb
+}
+
+// Recommendation is one parameter change and why.
+type Recommendation struct {
+	Priority    string `json:"priority"` // high, medium or low
+	Parameter   string `json:"parameter"`
+	Current     string `json:"current"`
+	Recommended string `json:"recommended"`
+	Evidence    string `json:"evidence"`
+	Rationale   string `json:"rationale"`
+}
+
+var priorityRank = map[string]int{"high": 0, "medium": 1, "low": 2}
+
+type TuningReport struct {
+	CacheHitRatio      float64          `json:"db_cache_hit_ratio_pct"`
+	CheckpointsTimed   int64            `json:"checkpoints_timed"`
+	CheckpointsReq     int64            `json:"checkpoints_requested"`
+	WALBytesPerSec     float64          `json:"wal_bytes_per_sec"`
+	PeakClientBackends int64            `json:"peak_client_backends"`
+	Recommendations    []Recommendation `json:"recommendations"`
+	Notes              []string         `json:"notes,omitempty"` // Evidence the run could not collect
+}
+
+// Report analyzes the run. lastPool is the final pool snapshot (nil when
+// the run was too short for one).
+func (ta *TuningAdvisor) Report(lastPool *PoolSnapshot) *TuningReport {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+
+	r := &TuningReport{PeakClientBackends: ta.peakBackends, Recommendations: []Recommendation{}}
+	add := func(rec Recommendation) { r.Recommendations = append(r.Recommendations, rec) }
+
+	if len(ta.settings) == 0 {
+		r.Notes = append(r.Notes, "pg_settings unreadable: no recommendations")
+		return r
+	}
+	if ta.start == nil || ta.end == nil {
+		r.Notes = append(r.Notes, "server counters unavailable (pg_stat_database not readable): cache and checkpoint advice skipped")
+	} else {
+		elapsed := ta.end.At.Sub(ta.start.At)
+		ta.adviseCache(r, add)
+		ta.adviseCheckpoints(r, add, elapsed)
+	}
+	ta.adviseWorkMem(r, add)
+	ta.adviseParallel(r, add)
+	ta.adviseConnections(r, add, lastPool)
+
+	sort.SliceStable(r.Recommendations, func(i, j int) bool {
+		return priorityRank[r.Recommendations[i].Priority] < priorityRank[r.Recommendations[j].Priority]
+	})
+	return r
+}
+
+func (ta *TuningAdvisor) adviseCache(r *TuningReport, add func(Recommendation)) {
+	hit := ta.end.BlksHit - ta.start.BlksHit
+	read := ta.end.BlksRead - ta.start.BlksRead
+	if hit+read == 0 {
+		return
+	}
+	r.CacheHitRatio = float64(hit) / float64(hit+read) * 100
+	if hit+read < 10000 {
+		r.Notes = append(r.Notes, fmt.Sprintf("only %d block accesses: too few to judge the cache hit ratio", hit+read))
+		return
+	}
+
+	shared := ta.settingBytes("shared_buffers")
+	target := 99.0
+	if config.WorkloadType == "analytics" {
+		target = 95.0
+	}
+	evidence := fmt.Sprintf("cache hit ratio %.2f%% (%d of %d block reads from disk or OS cache); %s is %s with indexes",
+		r.CacheHitRatio, read, hit+read, config.TableName, formatBytes(ta.tableBytes))
+
+	if r.CacheHitRatio < target && shared > 0 && ta.tableBytes > shared {
+		priority := "medium"
+		if r.CacheHitRatio < target-5 {
+			priority = "high"
+		}
+		add(Recommendation{
+			Priority:    priority,
+			Parameter:   "shared_buffers",
+			Current:     ta.formatSetting("shared_buffers"),
+			Recommended: pgSize(roundUpSize(ta.tableBytes * 5 / 4)),
+			Evidence:    evidence,
+			Rationale:   "the working set does not fit; size shared_buffers to it plus 25% headroom, up to ~25% of RAM (needs a restart). Past that, rely on the OS cache and raise effective_cache_size",
+		})
+	} else if r.CacheHitRatio < target && shared > 0 {
+		add(Recommendation{
+			Priority:    "low",
+			Parameter:   "pg_prewarm",
+			Current:     "cold cache",
+			Recommended: fmt.Sprintf("SELECT pg_prewarm('%s') before the run", config.TableName),
+			Evidence:    evidence,
+			Rationale:   "the table fits in shared_buffers, so the misses are a cold start or other data competing for the cache; warm it up or run longer before measuring",
+		})
+	}
+
+	if ecs := ta.settingBytes("effective_cache_size"); ecs > 0 && shared > 0 && ecs < 2*shared {
+		add(Recommendation{
+			Priority:    "low",
+			Parameter:   "effective_cache_size",
+			Current:     ta.formatSetting("effective_cache_size"),
+			Recommended: pgSize(roundUpSize(3 * shared)),
+			Evidence:    fmt.Sprintf("effective_cache_size is below 2x shared_buffers (%s)", ta.formatSetting("shared_buffers")),
+			Rationale:   "the planner assumes almost no OS cache and prices index scans too high; set it to ~75% of RAM (reload only)",
+		})
+	}
+}
+
+func (ta *TuningAdvisor) adviseCheckpoints(r *TuningReport, add func(Recommendation), elapsed time.Duration) {
+	if !ta.start.checkpointsOK || !ta.end.checkpointsOK {
+		r.Notes = append(r.Notes, "checkpoint counters unavailable: checkpoint advice skipped")
+		return
+	}
+	r.CheckpointsTimed = ta.end.CheckpointsTime - ta.start.CheckpointsTime
+	r.CheckpointsReq = ta.end.CheckpointsReq - ta.start.CheckpointsReq
+	if ta.start.WALBytes > 0 && elapsed > 0 {
+		r.WALBytesPerSec = (ta.end.WALBytes - ta.start.WALBytes) / elapsed.Seconds()
+	}
+
+	total := r.CheckpointsTimed + r.CheckpointsReq
+	timeout := ta.settingInt("checkpoint_timeout") // Seconds
+	if total == 0 {
+		if timeout > 0 && elapsed < time.Duration(timeout)*time.Second {
+			r.Notes = append(r.Notes, fmt.Sprintf("no checkpoints in a %v run (checkpoint_timeout %ds): run longer to judge checkpoint frequency",
+				elapsed.Round(time.Second), timeout))
+		}
+		return
+	}
+
+	interval := elapsed / time.Duration(total)
+	evidence := fmt.Sprintf("%d of %d checkpoints requested (WAL volume), one every %v; WAL %s/s",
+		r.CheckpointsReq, total, interval.Round(time.Second), formatBytes(int64(r.WALBytesPerSec)))
+
+	if r.CheckpointsReq > 0 && float64(r.CheckpointsReq)/float64(total) >= 0.2 {
+		priority := "medium"
+		if r.CheckpointsReq >= r.CheckpointsTimed {
+			priority = "high"
+		}
+		rec := Recommendation{
+			Priority:  priority,
+			Parameter: "max_wal_size",
+			Current:   ta.formatSetting("max_wal_size"),
+			Evidence:  evidence,
+			Rationale: "checkpoints are forced by WAL volume before checkpoint_timeout, multiplying full-page writes and I/O spikes; a checkpoint is requested after max_wal_size / (1 + checkpoint_completion_target) of WAL (reload only)",
+		}
+		cct := 0.9
+		if s, ok := ta.settings["checkpoint_completion_target"]; ok {
+			if v, err := strconv.ParseFloat(s.Value, 64); err == nil {
+				cct = v
+			}
+		}
+		if r.WALBytesPerSec > 0 && timeout > 0 {
+			need := int64(math.Ceil(r.WALBytesPerSec * float64(timeout) * (1 + cct)))
+			rec.Recommended = pgSize(roundUpSize(need))
+		} else if cur := ta.settingBytes("max_wal_size"); cur > 0 {
+			rec.Recommended = pgSize(roundUpSize(cur * 2))
+		}
+		add(rec)
+		return
+	}
+
+	if timeout > 0 && timeout < 900 && interval < 10*time.Minute {
+		add(Recommendation{
+			Priority:    "low",
+			Parameter:   "checkpoint_timeout",
+			Current:     ta.formatSetting("checkpoint_timeout"),
+			Recommended: "15min",
+			Evidence:    evidence,
+			Rationale:   "fewer checkpoints mean fewer full-page writes at the cost of longer crash recovery; raise max_wal_size with it so checkpoints stay timed",
+		})
+	}
+}
+
+func (ta *TuningAdvisor) adviseWorkMem(r *TuningReport, add func(Recommendation)) {
+	spills := spillTracker.Report()
+	if len(spills.Queries) == 0 {
+		if spills.TempFiles > 0 {
+			r.Notes = append(r.Notes, fmt.Sprintf("%d temp files (%s) written but no EXPLAIN ANALYZE samples: rerun with -explain-analyze to size work_mem",
+				spills.TempFiles, formatBytes(spills.TempBytes)))
+		}
+		return
+	}
+
+	var need int64
+	var names []string
+	var samples, spilled int64
+	for name, q := range spills.Queries {
+		samples += q.Samples
+		if q.SpillSamples == 0 {
+			continue
+		}
+		spilled += q.SpillSamples
+		names = append(names, name)
+		if q.SuggestedWorkMemMB > need {
+			need = q.SuggestedWorkMemMB
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	current := ta.settingBytes("work_mem")
+	needBytes := need << 20
+	if current > 0 && needBytes <= current {
+		return
+	}
+	priority := "medium"
+	if samples > 0 && spilled*2 >= samples {
+		priority = "high"
+	}
+	worst := int64(config.SessionCount) * needBytes
+	add(Recommendation{
+		Priority:    priority,
+		Parameter:   "work_mem",
+		Current:     ta.formatSetting("work_mem"),
+		Recommended: pgSize(needBytes),
+		Evidence: fmt.Sprintf("%d of %d EXPLAIN ANALYZE samples spilled (%s); %s temp written database-wide",
+			spilled, samples, strings.Join(names, ", "), formatBytes(spills.TempBytes)),
+		Rationale: fmt.Sprintf("each sort/hash node may use work_mem, so %d sessions could use %s or more; set it for the spilling queries (SET LOCAL or ALTER ROLE ... SET) rather than globally",
+			config.SessionCount, formatBytes(worst)),
+	})
+}
+
+func (ta *TuningAdvisor) adviseParallel(r *TuningReport, add func(Recommendation)) {
+	p := parallelTracker.Report()
+	var samples, starved float64
+	var names []string
+	for name, q := range p.Queries {
+		n := float64(q.ParallelSamples)
+		samples += n
+		if bad := (q.DegradedPct + q.SerialPct) / 100 * n; bad > 0 {
+			starved += bad
+			names = append(names, fmt.Sprintf("%s %.0f%%", name, q.DegradedPct+q.SerialPct))
+		}
+	}
+	saturated := p.MaxParallelWorkers > 0 && p.PeakWorkers >= p.MaxParallelWorkers
+	if starved == 0 && !saturated {
+		return
+	}
+	sort.Strings(names)
+
+	perGather := ta.settingInt("max_parallel_workers_per_gather")
+	demand := p.PeakLeaders * perGather
+	if demand <= p.MaxParallelWorkers {
+		demand = p.MaxParallelWorkers * 2
+	}
+	priority := "medium"
+	if samples > 0 && starved/samples >= 0.25 {
+		priority = "high"
+	}
+	evidence := fmt.Sprintf("peak %d of max_parallel_workers %d busy (%d concurrent parallel queries)",
+		p.PeakWorkers, p.MaxParallelWorkers, p.PeakLeaders)
+	if len(names) > 0 {
+		evidence += "; short of planned workers: " + strings.Join(names, ", ")
+	}
+	add(Recommendation{
+		Priority:    priority,
+		Parameter:   "max_parallel_workers",
+		Current:     ta.formatSetting("max_parallel_workers"),
+		Recommended: strconv.FormatInt(demand, 10),
+		Evidence:    evidence,
+		Rationale: fmt.Sprintf("plans assume %d workers per Gather but run with fewer or none, so their cost estimates are wrong; raise it if there are idle cores, otherwise lower max_parallel_workers_per_gather (%d) so plans match reality",
+			perGather, perGather),
+	})
+
+	if mwp := ta.settingInt("max_worker_processes"); mwp >= 0 && mwp < demand+8 {
+		add(Recommendation{
+			Priority:    priority,
+			Parameter:   "max_worker_processes",
+			Current:     ta.formatSetting("max_worker_processes"),
+			Recommended: strconv.FormatInt(demand+8, 10),
+			Evidence:    fmt.Sprintf("max_parallel_workers %d needs room in max_worker_processes %d", demand, mwp),
+			Rationale:   "parallel workers come out of the background worker pool shared with extensions and logical replication; leave headroom (needs a restart)",
+		})
+	}
+}
+
+func (ta *TuningAdvisor) adviseConnections(r *TuningReport, add func(Recommendation), lastPool *PoolSnapshot) {
+	if lastPool != nil && lastPool.AcquireCount > 0 {
+		emptyPct := float64(lastPool.EmptyAcquireCount) / float64(lastPool.AcquireCount) * 100
+		avgWait := lastPool.AcquireDuration / time.Duration(lastPool.AcquireCount)
+		if emptyPct >= 1 || avgWait >= 5*time.Millisecond {
+			priority := "medium"
+			if emptyPct >= 10 || avgWait >= 20*time.Millisecond {
+				priority = "high"
+			}
+			want := int64(config.SessionCount + config.BurstSessions)
+			recommended := strconv.FormatInt(want, 10)
+			rationale := "callers waited for a connection: size the pool to the peak number of concurrent sessions"
+			maxConn := ta.settingInt("max_connections")
+			// Connections other clients hold are not available to the pool.
+			others := max(ta.peakBackends-int64(lastPool.TotalConns), 0)
+			if room := maxConn - ta.settingInt("superuser_reserved_connections") - others; maxConn > 0 && want > room {
+				recommended = "transaction-mode pooler (PgBouncer)"
+				rationale = fmt.Sprintf("a pool of %d would not fit in max_connections %d next to %d other backends; multiplex sessions through a pooler, or shorten the queries holding connections",
+					want, maxConn, others)
+			}
+			add(Recommendation{
+				Priority:    priority,
+				Parameter:   "pool max_conns",
+				Current:     strconv.Itoa(int(ta.poolMax)),
+				Recommended: recommended,
+				Evidence: fmt.Sprintf("%.1f%% of %d acquires found the pool empty; avg acquire %v",
+					emptyPct, lastPool.AcquireCount, avgWait.Round(time.Microsecond)),
+				Rationale: rationale,
+			})
+		}
+	}
+
+	maxConn := ta.settingInt("max_connections")
+	if maxConn <= 0 || ta.peakBackends == 0 {
+		return
+	}
+	usable := maxConn - ta.settingInt("superuser_reserved_connections")
+	if float64(ta.peakBackends) >= 0.9*float64(usable) {
+		add(Recommendation{
+			Priority:    "high",
+			Parameter:   "max_connections",
+			Current:     ta.formatSetting("max_connections"),
+			Recommended: "connection pooler (PgBouncer, transaction mode)",
+			Evidence:    fmt.Sprintf("peak %d client backends of %d usable connections", ta.peakBackends, usable),
+			Rationale:   "new sessions are about to be refused; more backends add memory and snapshot overhead, so pool connections rather than raising the limit",
+		})
+	}
+}
+
+func (ta *TuningAdvisor) PrintReport(lastPool *PoolSnapshot) {
+	r := ta.Report(lastPool)
+
+	fmt.Printf("\n🩺 Tuning Recommendations:\n")
+	fmt.Printf("   DB Cache Hit Ratio:   %.2f%% (pg_stat_database delta)\n", r.CacheHitRatio)
+	fmt.Printf("   Checkpoints:          %d timed, %d requested (WAL %s/s)\n",
+		r.CheckpointsTimed, r.CheckpointsReq, formatBytes(int64(r.WALBytesPerSec)))
+
+	if len(r.Recommendations) == 0 {
+		fmt.Println("   ✅ No parameter changes indicated by this run")
+	}
+	icons := map[string]string{"high": "🔴", "medium": "🟠", "low": "🟡"}
+	for i, rec := range r.Recommendations {
+		fmt.Printf("   %d. %s %-6s %s: %s -> %s\n", i+1, icons[rec.Priority], strings.ToUpper(rec.Priority),
+			rec.Parameter, rec.Current, rec.Recommended)
+		fmt.Printf("      Evidence: %s\n", rec.Evidence)
+		fmt.Printf("      Why:      %s\n", rec.Rationale)
+	}
+	for _, n := range r.Notes {
+		fmt.Printf("   ℹ️  %s\n", n)
+	}
+}
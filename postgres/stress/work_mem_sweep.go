@@ -0,0 +1,406 @@
+package main
+
+// ============================================================================
+// WORK_MEM SWEEP (-work-mem-sweep=1MB,4MB,16MB,64MB,256MB)
+// ============================================================================
+//
+// How much work_mem do the analytics queries actually need? A dedicated
+// session reruns the workload's analytics queries under each value in
+// work_mem_sweep.values (SET per session), work_mem_sweep.repeats times.
+// Every round visits all values in order, so cache warming and the load the
+// other sessions put on the server are spread over the settings rather than
+// favouring the last one. One unrecorded pass at the largest value warms the
+// cache first.
+//
+// Each execution is an EXPLAIN (ANALYZE, TIMING OFF, BUFFERS, FORMAT JSON):
+// per-node timing is what makes EXPLAIN ANALYZE expensive, and the total
+// execution time and the spill evidence (see spill.go) don't need it.
+//
+// The report has, per value, median execution time per query and in total,
+// how many executions spilled and the temp blocks written, and recommends
+// the knee of the curve: the smallest value whose total median is within
+// 10% of the best one. Larger values buy little and cost memory in every
+// session (hash nodes may use work_mem × hash_mem_multiplier, and each
+// parallel worker gets its own).
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// workMemKneeTolerance is how far above the best total median the
+// recommended value may be.
+const workMemKneeTolerance = 0.10
+
+// workMemCell is one query under one work_mem value.
+type workMemCell struct {
+	latency    *QueryMetrics // Server execution time
+	spills     int64
+	tempBlocks int64
+	maxSpillKB int64
+	nodes      map[string]bool
+}
+
+type WorkMemSweep struct {
+	values  []string // Ascending
+	bytes   map[string]int64
+	queries []Query
+	cells   map[string]map[string]*workMemCell // value -> query -> cell
+	rounds  int                                // Completed rounds
+	mu      sync.Mutex
+}
+
+var workMemSweep *WorkMemSweep
+
+func newWorkMemSweep(values []string) (*WorkMemSweep, error) {
+	ws := &WorkMemSweep{
+		bytes: make(map[string]int64),
+		cells: make(map[string]map[string]*workMemCell),
+	}
+	for _, v := range values {
+		b, err := parseByteSize(v)
+		if err != nil {
+			return nil, fmt.Errorf("work_mem_sweep: %q: %w", v, err)
+		}
+		ws.values = append(ws.values, v)
+		ws.bytes[v] = b
+	}
+	sort.SliceStable(ws.values, func(i, j int) bool { return ws.bytes[ws.values[i]] < ws.bytes[ws.values[j]] })
+
+	for _, q := range queries {
+		if q.Type == "analytics" && q.Weight > 0 && isReadOnlyQuery(q) {
+			ws.queries = append(ws.queries, q)
+		}
+	}
+	if len(ws.queries) == 0 {
+		return nil, fmt.Errorf("work_mem_sweep: the workload has no read-only analytics queries to sweep")
+	}
+	for _, v := range ws.values {
+		ws.cells[v] = make(map[string]*workMemCell)
+		for _, q := range ws.queries {
+			ws.cells[v][q.Name] = &workMemCell{latency: &QueryMetrics{Name: q.Name}, nodes: make(map[string]bool)}
+		}
+	}
+	return ws, nil
+}
+
+// workMemConnConfig is the churn config under the sweep's own
+// application_name.
+func workMemConnConfig() (*pgx.ConnConfig, error) {
+	connConfig, err := churnConnConfig()
+	if err != nil {
+		return nil, err
+	}
+	connConfig.RuntimeParams["application_name"] = "read_workload_simulator_work_mem"
+	return connConfig, nil
+}
+
+// runWorkMemSweep runs the rounds on one dedicated session, reconnecting if
+// it is lost, until they are done or the run ends.
+func runWorkMemSweep(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ws := workMemSweep
+
+	connConfig, err := workMemConnConfig()
+	if err != nil {
+		log.Printf("work_mem sweep: %v", err)
+		return
+	}
+	var conn *pgx.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close(context.Background())
+		}
+	}()
+	connect := func() bool {
+		if conn != nil && !conn.IsClosed() {
+			return true
+		}
+		if conn, err = pgx.ConnectConfig(ctx, connConfig); err != nil {
+			conn = nil
+			if ctx.Err() == nil {
+				log.Printf("work_mem sweep: connect failed: %v", err)
+			}
+			return false
+		}
+		return true
+	}
+
+	for round := 0; round <= config.WorkMemRepeats; round++ {
+		values := ws.values
+		if round == 0 {
+			values = values[len(values)-1:] // Warm-up, not recorded
+		}
+		for _, v := range values {
+			if ctx.Err() != nil || !connect() {
+				return
+			}
+			if _, err := conn.Exec(ctx, `SELECT set_config('work_mem', $1, false)`, v); err != nil {
+				if ctx.Err() == nil {
+					log.Printf("work_mem sweep: SET work_mem = %s: %v", v, err)
+				}
+				return
+			}
+			for _, q := range ws.queries {
+				if ctx.Err() != nil {
+					return
+				}
+				result, err := explainAnalyzeNoTiming(ctx, conn, q.SQL, generateQueryParams(q))
+				if ctx.Err() != nil {
+					return
+				}
+				if round > 0 {
+					ws.record(v, q.Name, result, err)
+				}
+				if err != nil {
+					log.Printf("work_mem sweep: %s at work_mem %s: %v", q.Name, v, err)
+				}
+			}
+		}
+		if round > 0 {
+			ws.mu.Lock()
+			ws.rounds = round
+			ws.mu.Unlock()
+			fmt.Printf("\n🧮 work_mem sweep: round %d/%d done\n", round, config.WorkMemRepeats)
+		}
+	}
+}
+
+func (ws *WorkMemSweep) record(value, queryName string, result *ExplainResult, err error) {
+	c := ws.cells[value][queryName]
+	if err != nil {
+		recordLatency(c.latency, 0, err)
+		return
+	}
+	recordLatency(c.latency, time.Duration(result.ExecutionTime*float64(time.Millisecond)), nil)
+
+	spillKB, nodes := planSpills(result)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	c.tempBlocks += result.Plan.TempWrittenBlocks
+	if len(nodes) == 0 && result.Plan.TempWrittenBlocks == 0 {
+		return
+	}
+	c.spills++
+	c.maxSpillKB = max(c.maxSpillKB, spillKB)
+	for _, n := range nodes {
+		c.nodes[n] = true
+	}
+}
+
+// WorkMemQueryCell is one query under one work_mem value.
+type WorkMemQueryCell struct {
+	Query      string   `json:"query"`
+	Count      int64    `json:"count"`
+	Errors     int64    `json:"errors"`
+	P50Ms      float64  `json:"p50_ms"`
+	P95Ms      float64  `json:"p95_ms"`
+	Spills     int64    `json:"spills"`
+	TempBytes  int64    `json:"temp_bytes_per_exec"`
+	MaxSpillKB int64    `json:"max_spill_kb,omitempty"`
+	SpillNodes []string `json:"spill_nodes,omitempty"`
+}
+
+// WorkMemSetting is the analytics set under one work_mem value.
+type WorkMemSetting struct {
+	WorkMem    string             `json:"work_mem"`
+	Bytes      int64              `json:"bytes"`
+	Count      int64              `json:"count"`
+	Errors     int64              `json:"errors"`
+	SpillPct   float64            `json:"spill_pct"`
+	TempBytes  int64              `json:"temp_bytes_per_exec"`
+	TotalP50Ms float64            `json:"total_p50_ms"` // Sum of the per-query medians
+	DeltaPct   float64            `json:"delta_pct"`    // Against the smallest value
+	Complete   bool               `json:"complete"`     // Every query has a successful run
+	Queries    []WorkMemQueryCell `json:"queries"`
+}
+
+type WorkMemSweepReport struct {
+	Rounds      int               `json:"rounds"`
+	Settings    []WorkMemSetting  `json:"settings"`
+	Recommended string            `json:"recommended,omitempty"` // Knee of the curve
+	Best        string            `json:"best,omitempty"`        // Lowest total median
+	GainPct     float64           `json:"gain_pct,omitempty"`    // Recommended vs the smallest value
+	PerQuery    map[string]string `json:"per_query,omitempty"`   // Knee per query
+}
+
+// workMemKnee is the smallest value within workMemKneeTolerance of the
+// lowest cost, and the lowest-cost value itself.
+func workMemKnee(values []string, cost func(string) (float64, bool)) (knee, best string) {
+	bestCost := -1.0
+	for _, v := range values {
+		if c, ok := cost(v); ok && (bestCost < 0 || c < bestCost) {
+			best, bestCost = v, c
+		}
+	}
+	if best == "" {
+		return "", ""
+	}
+	for _, v := range values {
+		if c, ok := cost(v); ok && c <= bestCost*(1+workMemKneeTolerance) {
+			return v, best
+		}
+	}
+	return best, best
+}
+
+func (ws *WorkMemSweep) Report() *WorkMemSweepReport {
+	ws.mu.Lock()
+	r := &WorkMemSweepReport{Rounds: ws.rounds, PerQuery: make(map[string]string)}
+	spills := make(map[string]map[string]WorkMemQueryCell)
+	for _, v := range ws.values {
+		spills[v] = make(map[string]WorkMemQueryCell)
+		for _, q := range ws.queries {
+			c := ws.cells[v][q.Name]
+			cell := WorkMemQueryCell{Query: q.Name, Spills: c.spills, MaxSpillKB: c.maxSpillKB, TempBytes: c.tempBlocks * 8192}
+			for n := range c.nodes {
+				cell.SpillNodes = append(cell.SpillNodes, n)
+			}
+			sort.Strings(cell.SpillNodes)
+			spills[v][q.Name] = cell
+		}
+	}
+	ws.mu.Unlock()
+
+	p50 := make(map[string]map[string]float64)
+	for _, v := range ws.values {
+		s := WorkMemSetting{WorkMem: v, Bytes: ws.bytes[v], Complete: true}
+		p50[v] = make(map[string]float64)
+		var spilled, tempBytes int64
+		for _, q := range ws.queries {
+			cell := spills[v][q.Name]
+			qs := ws.cells[v][q.Name].latency.Summary()
+			cell.Count, cell.Errors = qs.Count, qs.Errors
+			ok := qs.Count > qs.Errors
+			if ok {
+				cell.P50Ms, cell.P95Ms = durationMs(qs.P50), durationMs(qs.P95)
+				p50[v][q.Name] = cell.P50Ms
+				s.TotalP50Ms += cell.P50Ms
+				tempBytes += cell.TempBytes
+				cell.TempBytes /= qs.Count - qs.Errors
+			} else {
+				s.Complete = false
+			}
+			s.Count += qs.Count
+			s.Errors += qs.Errors
+			spilled += cell.Spills
+			s.Queries = append(s.Queries, cell)
+		}
+		if runs := s.Count - s.Errors; runs > 0 {
+			s.SpillPct = float64(spilled) / float64(runs) * 100
+			s.TempBytes = tempBytes / runs
+		}
+		if len(r.Settings) > 0 && r.Settings[0].Complete && s.Complete {
+			s.DeltaPct = pctDelta(r.Settings[0].TotalP50Ms, s.TotalP50Ms)
+		}
+		r.Settings = append(r.Settings, s)
+	}
+
+	total := func(v string) (float64, bool) {
+		for _, s := range r.Settings {
+			if s.WorkMem == v {
+				return s.TotalP50Ms, s.Complete
+			}
+		}
+		return 0, false
+	}
+	r.Recommended, r.Best = workMemKnee(ws.values, total)
+	if r.Recommended != "" && r.Settings[0].Complete {
+		knee, _ := total(r.Recommended)
+		r.GainPct = -pctDelta(r.Settings[0].TotalP50Ms, knee)
+	}
+	for _, q := range ws.queries {
+		knee, _ := workMemKnee(ws.values, func(v string) (float64, bool) {
+			ms, ok := p50[v][q.Name]
+			return ms, ok
+		})
+		if knee != "" {
+			r.PerQuery[q.Name] = knee
+		}
+	}
+	return r
+}
+
+func (ws *WorkMemSweep) PrintReport() {
+	r := ws.Report()
+
+	fmt.Printf("\n🧮 work_mem Sweep (%d analytics queries, %d of %d rounds, EXPLAIN ANALYZE execution time):\n",
+		len(ws.queries), r.Rounds, config.WorkMemRepeats)
+	if r.Rounds == 0 {
+		fmt.Println("   No complete round; lengthen the run or sweep fewer values")
+	}
+
+	fmt.Printf("   %-10s %7s %7s %9s %13s %13s %9s\n", "work_mem", "Runs", "Errors", "Spilled", "Temp/exec", "Total p50", "Δ")
+	for _, s := range r.Settings {
+		marker := "  "
+		if s.WorkMem == r.Recommended {
+			marker = "👉"
+		}
+		total := "-"
+		if s.Complete {
+			total = fmt.Sprintf("%.1fms", s.TotalP50Ms)
+		}
+		fmt.Printf("   %s%-8s %7d %7d %8.0f%% %13s %13s %+8.1f%%\n",
+			marker, s.WorkMem, s.Count, s.Errors, s.SpillPct, formatBytes(s.TempBytes), total, s.DeltaPct)
+	}
+
+	fmt.Printf("\n   %-24s", "Query p50 (* spilled)")
+	for _, s := range r.Settings {
+		fmt.Printf(" %12s", s.WorkMem)
+	}
+	fmt.Printf(" %10s\n", "Knee")
+	for i, q := range ws.queries {
+		fmt.Printf("   %-24s", q.Name)
+		for _, s := range r.Settings {
+			cell := s.Queries[i]
+			text := "-"
+			if cell.Count > cell.Errors {
+				text = fmt.Sprintf("%.1fms", cell.P50Ms)
+				if cell.Spills > 0 {
+					text += "*"
+				}
+			}
+			fmt.Printf(" %12s", text)
+		}
+		fmt.Printf(" %10s\n", r.PerQuery[q.Name])
+	}
+
+	if r.Recommended == "" {
+		return
+	}
+	last := r.Settings[len(r.Settings)-1]
+	knee := r.Settings[0]
+	for _, s := range r.Settings {
+		if s.WorkMem == r.Recommended {
+			knee = s
+		}
+	}
+	fmt.Printf("\n   👉 Recommended work_mem: %s (knee of the curve: within %.0f%% of the best, %s, and %.0f%% faster than %s)\n",
+		r.Recommended, workMemKneeTolerance*100, r.Best, r.GainPct, r.Settings[0].WorkMem)
+	if knee.SpillPct > 0 {
+		fmt.Printf("   ⚠️  Still spilling in %.0f%% of executions at %s; the spills are cheap here, but watch temp volume\n",
+			knee.SpillPct, knee.WorkMem)
+	}
+	if r.Recommended == last.WorkMem && last.WorkMem != r.Settings[0].WorkMem {
+		fmt.Println("   ⚠️  The knee is the largest value tried; extend the sweep upwards to find where it flattens")
+	}
+	var slow []string
+	for _, q := range ws.queries {
+		if k := r.PerQuery[q.Name]; k != "" && ws.bytes[k] > knee.Bytes {
+			slow = append(slow, fmt.Sprintf("%s (%s)", q.Name, k))
+		}
+	}
+	if len(slow) > 0 {
+		fmt.Printf("   Needs more than the recommendation: %s; SET work_mem for those reports or their role\n",
+			strings.Join(slow, ", "))
+	}
+	fmt.Printf("   Budget: %s × %d sessions = %s if every session runs one sort or hash at once\n",
+		formatBytes(knee.Bytes), config.SessionCount, formatBytes(knee.Bytes*int64(config.SessionCount)))
+}